@@ -0,0 +1,367 @@
+// Package check finds problems in programs without evaluating them:
+// unbound variables, calls of known procedures with wrong number of
+// arguments, duplicate definitions and malformed special forms.
+package check
+
+import (
+	"errors"
+	"fmt"
+	"github.com/vkhonin/scheme/eval"
+	"github.com/vkhonin/scheme/lexer"
+	"github.com/vkhonin/scheme/parser"
+	"slices"
+)
+
+var (
+	DUPLICATE_DEFINITION = errors.New("duplicate definition")
+)
+
+// Problem is problem found in datum starting at Pos, which is zero unless
+// program is read with positions, and for empty list, which has none. Err
+// wraps DUPLICATE_DEFINITION or eval.BAD_SYNTAX, eval.UNBOUND_VARIABLE or
+// eval.WRONG_ARITY, as evaluator would signal it.
+type Problem struct {
+	Pos lexer.Pos
+	Err error
+}
+
+func (p Problem) Error() string {
+	if p.Pos == (lexer.Pos{}) {
+		return p.Err.Error()
+	}
+
+	return fmt.Sprintf("%s: %v", p.Pos, p.Err)
+}
+
+func (p Problem) Unwrap() error {
+	return p.Err
+}
+
+// arity is number of arguments procedure accepts. Max is -1 for variadic
+// procedure.
+type arity struct {
+	min, max int
+}
+
+// binding is variable bound by program or environment. Its arity is nil
+// unless it is bound to known procedure.
+type binding struct {
+	arity *arity
+
+	// assigned is set for variable assigned by set!, which may be bound to
+	// any procedure then.
+	assigned bool
+}
+
+// scope is region of program where variables it binds are visible.
+type scope struct {
+	parent   *scope
+	bindings map[string]*binding
+}
+
+// call is call of variable bound to known procedure, checked once all
+// assignments are seen.
+type call struct {
+	pos     lexer.Pos
+	name    string
+	binding *binding
+	args    int
+}
+
+type checker struct {
+	env *eval.Environment
+
+	// globals are bindings of env used by program.
+	globals map[string]*binding
+
+	problems []Problem
+	calls    []call
+}
+
+// Program returns problems of program, which is checked as it would be
+// evaluated in env, e.g. standard environment, so variables bound there are
+// bound and arities of builtin procedures are known. Env may be nil. Special
+// forms are those of evaluator, so program must have its macros expanded,
+// e.g. by macro.Expander. Problems are sorted by position, and the same
+// problem at the same position, e.g. in datum macro template repeats, is
+// reported once.
+func Program(program []parser.Sexpr, env *eval.Environment) []Problem {
+	c := &checker{env: env, globals: make(map[string]*binding)}
+
+	c.body(program, newScope(nil))
+
+	for _, call := range c.calls {
+		if a := call.binding.arity; !call.binding.assigned && (call.args < a.min || (a.max >= 0 && call.args > a.max)) {
+			c.problems = append(c.problems, Problem{call.pos, fmt.Errorf("%w: %s called with %d, expected %s", eval.WRONG_ARITY, call.name, call.args, a)})
+		}
+	}
+
+	slices.SortStableFunc(c.problems, func(a, b Problem) int {
+		return a.Pos.Offset - b.Pos.Offset
+	})
+
+	return slices.CompactFunc(c.problems, func(a, b Problem) bool {
+		return a.Pos == b.Pos && a.Err.Error() == b.Err.Error()
+	})
+}
+
+func (a *arity) String() string {
+	switch {
+	case a.max < 0:
+		return fmt.Sprintf("at least %d", a.min)
+	case a.min == a.max:
+		return fmt.Sprint(a.min)
+	default:
+		return fmt.Sprintf("%d to %d", a.min, a.max)
+	}
+}
+
+func newScope(parent *scope) *scope {
+	return &scope{parent: parent, bindings: make(map[string]*binding)}
+}
+
+// lookup returns binding of name visible in s, or nil if name is unbound.
+func (c *checker) lookup(name string, s *scope) *binding {
+	for ; s != nil; s = s.parent {
+		if b, ok := s.bindings[name]; ok {
+			return b
+		}
+	}
+
+	if b, ok := c.globals[name]; ok {
+		return b
+	}
+
+	if c.env == nil {
+		return nil
+	}
+
+	value, err := c.env.Lookup(name)
+	if err != nil {
+		return nil
+	}
+
+	b := &binding{}
+	switch p := value.(type) {
+	case *eval.Builtin:
+		b.arity = &arity{p.MinArgs, p.MaxArgs}
+	case *eval.Closure:
+		b.arity = &arity{len(p.Params), len(p.Params)}
+		if p.Rest != "" {
+			b.arity.max = -1
+		}
+	}
+	c.globals[name] = b
+
+	return b
+}
+
+func (c *checker) report(datum parser.Sexpr, err error) {
+	c.problems = append(c.problems, Problem{span(datum).Start, err})
+}
+
+// body checks body of lambda or let-like form, or program. Variables it
+// defines are bound in s before its expressions are checked.
+func (c *checker) body(body []parser.Sexpr, s *scope) {
+	c.declare(body, s, make(map[string]bool))
+
+	for _, expr := range body {
+		c.expr(expr, s)
+	}
+}
+
+// declare binds variables defined by body, including definitions inside
+// begin, in s. Defined are names defined by body so far.
+func (c *checker) declare(body []parser.Sexpr, s *scope, defined map[string]bool) {
+	for _, expr := range body {
+		form, ok := expr.(*parser.Expr)
+		if !ok || isNull(form) {
+			continue
+		}
+
+		operands, ok := list(form.Cdr)
+		switch {
+		case !ok:
+		case isSymbol(form.Car, "begin"):
+			c.declare(operands, s, defined)
+		case isSymbol(form.Car, "define") && len(operands) > 0:
+			name, target, arity := definition(operands)
+			if name == "" {
+				continue
+			}
+
+			if defined[name] {
+				c.report(target, fmt.Errorf("%w: %s", DUPLICATE_DEFINITION, name))
+			}
+			defined[name] = true
+
+			s.bindings[name] = &binding{arity: arity}
+		}
+	}
+}
+
+// expr checks expression in scope s.
+func (c *checker) expr(expr parser.Sexpr, s *scope) {
+	switch e := expr.(type) {
+	case *parser.Atom:
+		if name, ok := symbolName(e); ok && c.lookup(name, s) == nil {
+			c.report(e, fmt.Errorf("%w: %s", eval.UNBOUND_VARIABLE, name))
+		}
+	case *parser.Expr:
+		if isNull(e) {
+			c.report(e, fmt.Errorf("%w: empty combination", eval.BAD_SYNTAX))
+			return
+		}
+
+		operands, ok := list(e.Cdr)
+
+		if name, isName := symbolName(e.Car); isName {
+			if form, isForm := forms[name]; isForm {
+				if !ok {
+					c.report(e, fmt.Errorf("%w: %s", eval.BAD_SYNTAX, name))
+					return
+				}
+				form(c, e, operands, s)
+				return
+			}
+		}
+
+		if !ok {
+			c.report(e, fmt.Errorf("%w: improper combination", eval.BAD_SYNTAX))
+			return
+		}
+
+		c.expr(e.Car, s)
+		for _, operand := range operands {
+			c.expr(operand, s)
+		}
+
+		if name, isName := symbolName(e.Car); isName {
+			if b := c.lookup(name, s); b != nil && b.arity != nil {
+				c.calls = append(c.calls, call{span(e).Start, name, b, len(operands)})
+			}
+		}
+	}
+}
+
+// definition returns name defined by define form with operands, datum
+// naming it and arity of procedure it is bound to, if it is known. Name is
+// empty if operands are malformed.
+func definition(operands []parser.Sexpr) (string, parser.Sexpr, *arity) {
+	if target, ok := operands[0].(*parser.Expr); ok && !isNull(target) {
+		name, _ := symbolName(target.Car)
+		arity, _ := formalsArity(target.Cdr)
+		return name, target.Car, arity
+	}
+
+	name, _ := symbolName(operands[0])
+	if len(operands) != 2 {
+		return name, operands[0], nil
+	}
+
+	return name, operands[0], lambdaArity(operands[1])
+}
+
+// lambdaArity returns arity of procedure expr evaluates to if it is lambda
+// expression, or nil otherwise.
+func lambdaArity(expr parser.Sexpr) *arity {
+	form, ok := expr.(*parser.Expr)
+	if !ok || isNull(form) || !isSymbol(form.Car, "lambda") {
+		return nil
+	}
+
+	operands, ok := list(form.Cdr)
+	if !ok || len(operands) < 2 {
+		return nil
+	}
+
+	arity, _ := formalsArity(operands[0])
+
+	return arity
+}
+
+// formalsArity returns arity of lambda formals and their names, or nil
+// arity if they are malformed, i.e. not symbols or not unique.
+func formalsArity(formals parser.Sexpr) (*arity, []parser.Sexpr) {
+	a := &arity{}
+	seen := make(map[string]bool)
+
+	var names []parser.Sexpr
+
+	for !isNull(formals) {
+		datum := formals
+		pair, isPair := formals.(*parser.Expr)
+		if isPair {
+			datum = pair.Car
+		}
+
+		name, ok := symbolName(datum)
+		if !ok || seen[name] {
+			return nil, names
+		}
+		seen[name] = true
+		names = append(names, datum)
+
+		if !isPair {
+			a.max = -1
+			return a, names
+		}
+
+		a.min++
+		formals = pair.Cdr
+	}
+
+	a.max = a.min
+
+	return a, names
+}
+
+// list returns elements of proper list s, reporting whether it is one.
+func list(s parser.Sexpr) ([]parser.Sexpr, bool) {
+	var items []parser.Sexpr
+
+	for !isNull(s) {
+		pair, ok := s.(*parser.Expr)
+		if !ok {
+			return nil, false
+		}
+		items = append(items, pair.Car)
+		s = pair.Cdr
+	}
+
+	return items, true
+}
+
+func isNull(s parser.Sexpr) bool {
+	e, ok := s.(*parser.Expr)
+	return ok && e.Car == nil && e.Cdr == nil
+}
+
+func isSymbol(s parser.Sexpr, name string) bool {
+	n, ok := symbolName(s)
+	return ok && n == name
+}
+
+func symbolName(s parser.Sexpr) (string, bool) {
+	if a, ok := s.(*parser.Atom); ok && a.Type == parser.SYMBOL {
+		return (a.Value).(string), true
+	}
+
+	return "", false
+}
+
+// span returns span of datum read with its position.
+func span(datum parser.Sexpr) parser.Span {
+	switch d := datum.(type) {
+	case *parser.Atom:
+		return d.Span
+	case *parser.Expr:
+		return d.Span
+	case *parser.Vector:
+		return d.Span
+	case *parser.Bytevector:
+		return d.Span
+	}
+
+	return parser.Span{}
+}
@@ -0,0 +1,78 @@
+package check_test
+
+import (
+	"github.com/vkhonin/scheme/check"
+	"github.com/vkhonin/scheme/eval"
+	"github.com/vkhonin/scheme/lexer"
+	"github.com/vkhonin/scheme/parser"
+	"slices"
+	"testing"
+)
+
+func TestProgram(t *testing.T) {
+	testCases := []struct {
+		Source   string
+		Problems []string
+	}{
+		{"(define (f x) (g x))\n(define (g y) (* y 2))\n(f 1)", nil},
+		{"(define (f x) (+ x y))", []string{"1:20: unbound variable: y"}},
+		{"(car 1 2)\n(list)\n(-)", []string{"1:1: wrong number of arguments: car called with 2, expected 1", "3:1: wrong number of arguments: - called with 0, expected at least 1"}},
+		{"(define (f x . rest) x)\n(f)\n(f 1 2 3)", []string{"2:1: wrong number of arguments: f called with 0, expected at least 1"}},
+		{"(define f (lambda (a b) a))\n(f 1)", []string{"2:1: wrong number of arguments: f called with 1, expected 2"}},
+		{"(define (f) 1)\n(set! f (lambda (x) x))\n(f 1)", nil},
+		{"(define x 1)\n(define x 2)", []string{"2:9: duplicate definition: x"}},
+		{"(define (f) (define a 1) (begin (define a 2)) a)", []string{"1:41: duplicate definition: a"}},
+		{"(let ((x 1) (x 2)) x)", []string{"1:1: bad syntax: let binding"}},
+		{"(if)\n(lambda (x x) x)\n(quote)\n(let ((x)) x)", []string{"1:1: bad syntax: if", "2:1: bad syntax: invalid lambda formals", "3:1: bad syntax: quote", "4:1: bad syntax: let binding"}},
+		{"(cond (else 1) (#t 2))\n(case 1 ((1)))\n(f . x)", []string{"1:1: bad syntax: cond else clause", "2:1: bad syntax: case clause", "3:1: bad syntax: improper combination"}},
+		{"()", []string{"bad syntax: empty combination"}},
+		{"(let loop ((i 0)) (if (< i 10) (loop (+ i 1) 2) i))", []string{"1:32: wrong number of arguments: loop called with 2, expected 1"}},
+		{"(let* ((x 1) (y x)) y)\n(letrec ((even? (lambda (n) (if (= n 0) #t (odd? (- n 1))))) (odd? (lambda (n) (even? n)))) (even? 1))", nil},
+		{"(let ((x 1) (y x)) y)", []string{"1:16: unbound variable: x"}},
+		{"(do ((i 0 (+ i 1))) ((= i 3) i) (display i))", []string{"1:34: unbound variable: display"}},
+		{"(guard (e (#t e)) (raise 'oops))\n(guard (e ((string? e) => f)) 1)", []string{"2:27: unbound variable: f"}},
+		{"`(a ,b ,@(list c) `(d ,e ,,g))", []string{"1:6: unbound variable: b", "1:16: unbound variable: c", "1:28: unbound variable: g"}},
+		{"(set! z 1)\n(if #t (define w 1))\nw", []string{"1:7: unbound variable: z"}},
+	}
+
+	for _, c := range testCases {
+		var problems []string
+		for _, problem := range check.Program(read(t, c.Source), eval.NewStandardEnvironment()) {
+			problems = append(problems, problem.Error())
+		}
+
+		if !slices.Equal(problems, c.Problems) {
+			t.Errorf("expected problems %q got %q for %q", c.Problems, problems, c.Source)
+		}
+	}
+}
+
+func TestProgram_Forms(t *testing.T) {
+	for _, keyword := range eval.SpecialForms() {
+		problems := check.Program(read(t, "("+keyword+")"), nil)
+		if len(problems) == 0 && keyword != "and" && keyword != "or" && keyword != "begin" && keyword != "cond" {
+			t.Errorf("expected %s without operands to be malformed", keyword)
+		}
+	}
+}
+
+// read returns data of src read with positions.
+func read(t *testing.T, src string) []parser.Sexpr {
+	t.Helper()
+
+	var tokens []lexer.Token
+	for token, err := range lexer.NewFromString(src).Tokens() {
+		if err != nil {
+			t.Fatal(err)
+		}
+		tokens = append(tokens, token)
+	}
+
+	p := parser.Parser{Tokens: tokens, WithPositions: true}
+	program, err := p.Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return program
+}
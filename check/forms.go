@@ -0,0 +1,431 @@
+package check
+
+import (
+	"fmt"
+	"github.com/vkhonin/scheme/eval"
+	"github.com/vkhonin/scheme/parser"
+)
+
+// form checks special form with operands in scope s.
+type form func(c *checker, e *parser.Expr, operands []parser.Sexpr, s *scope)
+
+// forms check special forms of evaluator by their keywords.
+var forms map[string]form
+
+func init() {
+	forms = map[string]form{
+		"and":         checkSequence,
+		"begin":       checkSequence,
+		"case":        checkCase,
+		"cond":        checkCond,
+		"define":      checkDefine,
+		"delay":       checkDelay,
+		"delay-force": checkDelay,
+		"do":          checkDo,
+		"guard":       checkGuard,
+		"if":          checkIf,
+		"lambda":      checkLambda,
+		"let":         checkLet,
+		"let*":        checkLet,
+		"letrec":      checkLet,
+		"letrec*":     checkLet,
+		"or":          checkSequence,
+		"quasiquote":  checkQuasiquote,
+		"quote":       checkQuote,
+		"set!":        checkSet,
+		"unless":      checkWhen,
+		"when":        checkWhen,
+	}
+}
+
+// badSyntax reports malformed part of special form e, which is described by
+// what, e.g. "let binding".
+func (c *checker) badSyntax(e *parser.Expr, what string) {
+	c.report(e, fmt.Errorf("%w: %s", eval.BAD_SYNTAX, what))
+}
+
+func checkSequence(c *checker, _ *parser.Expr, operands []parser.Sexpr, s *scope) {
+	for _, operand := range operands {
+		c.expr(operand, s)
+	}
+}
+
+func checkQuote(c *checker, e *parser.Expr, operands []parser.Sexpr, _ *scope) {
+	if len(operands) != 1 {
+		c.badSyntax(e, "quote")
+	}
+}
+
+func checkDelay(c *checker, e *parser.Expr, operands []parser.Sexpr, s *scope) {
+	keyword, _ := symbolName(e.Car)
+	if len(operands) != 1 {
+		c.badSyntax(e, keyword)
+		return
+	}
+
+	c.expr(operands[0], s)
+}
+
+func checkIf(c *checker, e *parser.Expr, operands []parser.Sexpr, s *scope) {
+	if len(operands) < 2 || len(operands) > 3 {
+		c.badSyntax(e, "if")
+		return
+	}
+
+	checkSequence(c, e, operands, s)
+}
+
+func checkWhen(c *checker, e *parser.Expr, operands []parser.Sexpr, s *scope) {
+	if len(operands) < 2 {
+		c.badSyntax(e, "when/unless")
+		return
+	}
+
+	checkSequence(c, e, operands, s)
+}
+
+func checkSet(c *checker, e *parser.Expr, operands []parser.Sexpr, s *scope) {
+	if len(operands) != 2 {
+		c.badSyntax(e, "set!")
+		return
+	}
+
+	name, ok := symbolName(operands[0])
+	if !ok {
+		c.badSyntax(e, "set!")
+		return
+	}
+
+	if b := c.lookup(name, s); b == nil {
+		c.report(operands[0], fmt.Errorf("%w: %s", eval.UNBOUND_VARIABLE, name))
+	} else {
+		b.assigned = true
+	}
+
+	c.expr(operands[1], s)
+}
+
+func checkLambda(c *checker, e *parser.Expr, operands []parser.Sexpr, s *scope) {
+	if len(operands) < 2 {
+		c.badSyntax(e, "lambda")
+		return
+	}
+
+	c.procedure(e, operands[0], operands[1:], s)
+}
+
+// procedure checks lambda with formals and body created in scope s.
+func (c *checker) procedure(e *parser.Expr, formals parser.Sexpr, body []parser.Sexpr, s *scope) {
+	arity, names := formalsArity(formals)
+	if arity == nil {
+		c.badSyntax(e, "invalid lambda formals")
+	}
+
+	bodyScope := newScope(s)
+	for _, name := range names {
+		bodyScope.bindings[name.(*parser.Atom).Value.(string)] = &binding{}
+	}
+
+	c.body(body, bodyScope)
+}
+
+func checkDefine(c *checker, e *parser.Expr, operands []parser.Sexpr, s *scope) {
+	if len(operands) < 2 {
+		c.badSyntax(e, "define")
+		return
+	}
+
+	name, _, arity := definition(operands)
+	if name == "" {
+		c.badSyntax(e, "define")
+		return
+	}
+
+	// Definition outside of body, e.g. in if, is bound where it is made.
+	if _, ok := s.bindings[name]; !ok {
+		s.bindings[name] = &binding{arity: arity}
+	}
+
+	if target, ok := operands[0].(*parser.Expr); ok && !isNull(target) {
+		c.procedure(e, target.Cdr, operands[1:], s)
+		return
+	}
+
+	if len(operands) != 2 {
+		c.badSyntax(e, "define")
+		return
+	}
+
+	c.expr(operands[1], s)
+}
+
+// checkLet checks let, named let, let*, letrec and letrec*. Initializers of
+// let and named let are in scope of form, of let* in scope of preceding
+// bindings and of letrec in scope of all bindings.
+func checkLet(c *checker, e *parser.Expr, operands []parser.Sexpr, s *scope) {
+	keyword, _ := symbolName(e.Car)
+
+	var loop string
+	if keyword == "let" && len(operands) > 0 {
+		if name, ok := symbolName(operands[0]); ok {
+			keyword, loop, operands = "named let", name, operands[1:]
+		}
+	}
+
+	if len(operands) < 2 {
+		c.badSyntax(e, keyword)
+		return
+	}
+
+	bindings, ok := list(operands[0])
+	if !ok {
+		c.badSyntax(e, keyword+" bindings")
+		return
+	}
+
+	names := make([]string, len(bindings))
+	inits := make([]parser.Sexpr, len(bindings))
+	seen := make(map[string]bool)
+
+	for i, b := range bindings {
+		var name string
+
+		pair, ok := list(b)
+		if ok && len(pair) == 2 {
+			name, ok = symbolName(pair[0])
+		}
+		if !ok || len(pair) != 2 || (seen[name] && keyword != "let*") {
+			c.badSyntax(e, keyword+" binding")
+			return
+		}
+		seen[name] = true
+
+		names[i], inits[i] = name, pair[1]
+	}
+
+	body := operands[1:]
+
+	switch keyword {
+	case "let*":
+		for i := range names {
+			c.expr(inits[i], s)
+			s = bind(s, names[i:i+1], inits[i:i+1])
+		}
+		c.body(body, newScope(s))
+	case "letrec", "letrec*":
+		letScope := bind(s, names, inits)
+		checkSequence(c, e, inits, letScope)
+		c.body(body, letScope)
+	case "named let":
+		checkSequence(c, e, inits, s)
+		loopScope := newScope(s)
+		loopScope.bindings[loop] = &binding{arity: &arity{len(names), len(names)}}
+		c.body(body, bind(loopScope, names, nil))
+	default:
+		checkSequence(c, e, inits, s)
+		c.body(body, bind(s, names, inits))
+	}
+}
+
+// bind returns new scope extending s with names bound to values of inits,
+// or to unknown values if inits are nil.
+func bind(s *scope, names []string, inits []parser.Sexpr) *scope {
+	s = newScope(s)
+
+	for i, name := range names {
+		b := &binding{}
+		if inits != nil {
+			b.arity = lambdaArity(inits[i])
+		}
+		s.bindings[name] = b
+	}
+
+	return s
+}
+
+func checkCond(c *checker, e *parser.Expr, operands []parser.Sexpr, s *scope) {
+	c.clauses(e, operands, s)
+}
+
+// clauses checks cond-like clauses of form e.
+func (c *checker) clauses(e *parser.Expr, clauses []parser.Sexpr, s *scope) {
+	for i, cl := range clauses {
+		clause, ok := list(cl)
+		if !ok || len(clause) == 0 {
+			c.badSyntax(e, "cond clause")
+			return
+		}
+
+		if isSymbol(clause[0], "else") {
+			if i != len(clauses)-1 || len(clause) == 1 {
+				c.badSyntax(e, "cond else clause")
+				return
+			}
+			checkSequence(c, e, clause[1:], s)
+			return
+		}
+
+		c.expr(clause[0], s)
+		c.clauseBody(e, clause[1:], s)
+	}
+}
+
+// clauseBody checks body of cond or case clause, which is either "=>
+// receiver" or sequence of expressions.
+func (c *checker) clauseBody(e *parser.Expr, body []parser.Sexpr, s *scope) {
+	if len(body) > 0 && isSymbol(body[0], "=>") {
+		if len(body) != 2 {
+			c.badSyntax(e, "=> clause")
+			return
+		}
+		c.expr(body[1], s)
+		return
+	}
+
+	checkSequence(c, e, body, s)
+}
+
+func checkCase(c *checker, e *parser.Expr, operands []parser.Sexpr, s *scope) {
+	if len(operands) < 1 {
+		c.badSyntax(e, "case")
+		return
+	}
+
+	c.expr(operands[0], s)
+
+	for i, cl := range operands[1:] {
+		clause, ok := list(cl)
+		if !ok || len(clause) < 2 {
+			c.badSyntax(e, "case clause")
+			return
+		}
+
+		if isSymbol(clause[0], "else") {
+			if i != len(operands)-2 {
+				c.badSyntax(e, "case else clause")
+				return
+			}
+		} else if _, ok := list(clause[0]); !ok {
+			c.badSyntax(e, "case clause data")
+			return
+		}
+
+		c.clauseBody(e, clause[1:], s)
+	}
+}
+
+func checkDo(c *checker, e *parser.Expr, operands []parser.Sexpr, s *scope) {
+	if len(operands) < 2 {
+		c.badSyntax(e, "do")
+		return
+	}
+
+	specs, ok := list(operands[0])
+	if !ok {
+		c.badSyntax(e, "do bindings")
+		return
+	}
+
+	names := make([]string, len(specs))
+	var steps []parser.Sexpr
+	seen := make(map[string]bool)
+
+	for i, sp := range specs {
+		var name string
+
+		spec, ok := list(sp)
+		if ok && len(spec) >= 2 && len(spec) <= 3 {
+			name, ok = symbolName(spec[0])
+		}
+		if !ok || len(spec) < 2 || len(spec) > 3 || seen[name] {
+			c.badSyntax(e, "do binding")
+			return
+		}
+		seen[name] = true
+
+		names[i] = name
+		c.expr(spec[1], s)
+		steps = append(steps, spec[2:]...)
+	}
+
+	exit, ok := list(operands[1])
+	if !ok || len(exit) == 0 {
+		c.badSyntax(e, "do exit clause")
+		return
+	}
+
+	loopScope := bind(s, names, nil)
+	checkSequence(c, e, steps, loopScope)
+	checkSequence(c, e, exit, loopScope)
+	checkSequence(c, e, operands[2:], loopScope)
+}
+
+func checkGuard(c *checker, e *parser.Expr, operands []parser.Sexpr, s *scope) {
+	if len(operands) < 2 {
+		c.badSyntax(e, "guard")
+		return
+	}
+
+	spec, ok := list(operands[0])
+	if !ok || len(spec) == 0 {
+		c.badSyntax(e, "guard clauses")
+		return
+	}
+
+	name, ok := symbolName(spec[0])
+	if !ok {
+		c.badSyntax(e, "guard variable")
+		return
+	}
+
+	c.body(operands[1:], newScope(s))
+	c.clauses(e, spec[1:], bind(s, []string{name}, nil))
+}
+
+func checkQuasiquote(c *checker, e *parser.Expr, operands []parser.Sexpr, s *scope) {
+	if len(operands) != 1 {
+		c.badSyntax(e, "quasiquote")
+		return
+	}
+
+	c.template(operands[0], 1, s)
+}
+
+// template checks expressions unquoted in quasiquote template at nesting
+// depth, which are those at depth 1.
+func (c *checker) template(template parser.Sexpr, depth int, s *scope) {
+	switch t := template.(type) {
+	case *parser.Vector:
+		for _, element := range t.Elements {
+			c.template(element, depth, s)
+		}
+	case *parser.Expr:
+		for !isNull(t) {
+			if name, ok := symbolName(t.Car); ok {
+				if operands, ok := list(t.Cdr); ok && len(operands) == 1 {
+					switch name {
+					case "unquote", "unquote-splicing":
+						if depth == 1 {
+							c.expr(operands[0], s)
+						} else {
+							c.template(operands[0], depth-1, s)
+						}
+						return
+					case "quasiquote":
+						c.template(operands[0], depth+1, s)
+						return
+					}
+				}
+			}
+
+			c.template(t.Car, depth, s)
+
+			next, ok := t.Cdr.(*parser.Expr)
+			if !ok {
+				c.template(t.Cdr, depth, s)
+				return
+			}
+			t = next
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"github.com/vkhonin/scheme"
+	"github.com/vkhonin/scheme/check"
+	"github.com/vkhonin/scheme/lexer"
+	"github.com/vkhonin/scheme/macro"
+	"io"
+)
+
+// checkCommand checks files given by args, with macros expanded, without
+// evaluating them, writing problems found to out with their positions. It returns exit status, which
+// is 1 if there are problems.
+func checkCommand(args []string, out, errOut io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprintln(errOut, "usage: scheme check file...")
+		return 2
+	}
+
+	status := 0
+	for _, path := range args {
+		program, err := readProgram(path)
+		if err != nil {
+			fmt.Fprintln(errOut, err)
+			status = 1
+			continue
+		}
+
+		var x macro.Expander
+		if program, err = x.Expand(program); err != nil {
+			fmt.Fprintf(out, "%s: %v\n", path, err)
+			status = 1
+			continue
+		}
+
+		for _, problem := range check.Program(program, scheme.StandardEnvironment()) {
+			if problem.Pos == (lexer.Pos{}) {
+				fmt.Fprintf(out, "%s: %v\n", path, problem.Err)
+			} else {
+				fmt.Fprintf(out, "%s:%v\n", path, problem)
+			}
+			status = 1
+		}
+	}
+
+	return status
+}
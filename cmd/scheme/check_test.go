@@ -0,0 +1,46 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckCommand(t *testing.T) {
+	dir := t.TempDir()
+
+	testCases := []struct {
+		Script string
+		Code   int
+		Output string
+	}{
+		{"(define (f x) (* x 2))\n(f 1)\n", 0, ""},
+		{"(display \"x\")\n(newline)\n", 0, ""},
+		{"(define (f x) (* x 2))\n\n  (f 1 y)\n", 1, "script.scm:3:3: wrong number of arguments: f called with 2, expected 1\nscript.scm:3:8: unbound variable: y\n"},
+		{"()", 1, "script.scm: bad syntax: empty combination\n"},
+		{"(define-syntax inc! (syntax-rules () ((_ v) (set! v (+ v 1)))))\n(inc! x)\n", 1, "script.scm:2:7: unbound variable: x\n"},
+		{"(define-syntax one (syntax-rules () ((_) 1)))\n(one 1)\n", 1, "script.scm: no syntax rule matches: one at 2:1\n"},
+	}
+
+	for _, c := range testCases {
+		path := filepath.Join(dir, "script.scm")
+		if err := os.WriteFile(path, []byte(c.Script), 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		var out, errOut strings.Builder
+		if code := checkCommand([]string{path}, &out, &errOut); code != c.Code {
+			t.Errorf("expected status %d got %d for %q", c.Code, code, c.Script)
+		}
+
+		if expected := strings.ReplaceAll(c.Output, "script.scm", path); out.String() != expected || errOut.Len() != 0 {
+			t.Errorf("expected output %q got %q, %q for %q", expected, out.String(), errOut.String(), c.Script)
+		}
+	}
+
+	var errOut strings.Builder
+	if code := checkCommand(nil, nil, &errOut); code != 2 || !strings.HasPrefix(errOut.String(), "usage:") {
+		t.Errorf("expected usage with status 2 got %d, %q", code, errOut.String())
+	}
+}
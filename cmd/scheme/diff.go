@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// diffContext is number of unchanged lines around changes in diff.
+const diffContext = 3
+
+// edit is line of diff, which is kept, deleted or inserted as its op, ' ',
+// '-' or '+', is.
+type edit struct {
+	op   byte
+	line string
+}
+
+// unifiedDiff returns diff of old and new texts, named oldName and newName,
+// in unified format, or empty string if they are the same.
+func unifiedDiff(oldName, newName, old, new string) string {
+	edits := diffLines(splitLines(old), splitLines(new))
+
+	var sb strings.Builder
+
+	// oldLine and newLine are numbers of lines before edits[i] in old and new.
+	oldLine, newLine := 0, 0
+
+	for i := 0; i < len(edits); {
+		if edits[i].op == ' ' {
+			oldLine, newLine = oldLine+1, newLine+1
+			i++
+			continue
+		}
+
+		// Hunk spans changes closer than twice context to each other.
+		start := max(i-diffContext, 0)
+		end := i
+		for j := i; j < len(edits) && j < end+2*diffContext+1; j++ {
+			if edits[j].op != ' ' {
+				end = j + 1
+			}
+		}
+		end = min(end+diffContext, len(edits))
+
+		oldStart, newStart := oldLine-(i-start), newLine-(i-start)
+		oldCount, newCount := 0, 0
+		for _, e := range edits[start:end] {
+			if e.op != '+' {
+				oldCount++
+			}
+			if e.op != '-' {
+				newCount++
+			}
+		}
+
+		if sb.Len() == 0 {
+			fmt.Fprintf(&sb, "--- %s\n+++ %s\n", oldName, newName)
+		}
+		fmt.Fprintf(&sb, "@@ -%s +%s @@\n", hunkRange(oldStart, oldCount), hunkRange(newStart, newCount))
+		for _, e := range edits[start:end] {
+			sb.WriteByte(e.op)
+			sb.WriteString(e.line)
+			if !strings.HasSuffix(e.line, "\n") {
+				sb.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+
+		oldLine, newLine = oldStart+oldCount, newStart+newCount
+		i = end
+	}
+
+	return sb.String()
+}
+
+// hunkRange returns range of lines of hunk starting after line start.
+func hunkRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if count == 1 {
+		return fmt.Sprint(start + 1)
+	}
+
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
+
+// diffLines returns edits turning old lines into new ones, which keep their
+// longest common subsequence.
+func diffLines(old, new []string) []edit {
+	// lcs[i][j] is length of longest common subsequence of old[i:] and
+	// new[j:].
+	lcs := make([][]int, len(old)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(new)+1)
+	}
+	for i := len(old) - 1; i >= 0; i-- {
+		for j := len(new) - 1; j >= 0; j-- {
+			if old[i] == new[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var edits []edit
+
+	i, j := 0, 0
+	for i < len(old) || j < len(new) {
+		switch {
+		case i < len(old) && j < len(new) && old[i] == new[j]:
+			edits = append(edits, edit{' ', old[i]})
+			i, j = i+1, j+1
+		case j == len(new) || (i < len(old) && lcs[i+1][j] >= lcs[i][j+1]):
+			edits = append(edits, edit{'-', old[i]})
+			i++
+		default:
+			edits = append(edits, edit{'+', new[j]})
+			j++
+		}
+	}
+
+	return edits
+}
+
+// splitLines returns lines of s with their newlines.
+func splitLines(s string) []string {
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	return lines
+}
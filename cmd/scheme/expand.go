@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"github.com/vkhonin/scheme/macro"
+	"github.com/vkhonin/scheme/printer"
+	"io"
+)
+
+// expandCommand writes forms of files given by args with macros expanded,
+// which are core forms evaluator knows. It returns exit status.
+func expandCommand(args []string, out, errOut io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprintln(errOut, "usage: scheme expand file...")
+		return 2
+	}
+
+	status := 0
+	for _, path := range args {
+		program, err := readProgram(path)
+		if err != nil {
+			fmt.Fprintln(errOut, err)
+			status = 1
+			continue
+		}
+
+		var x macro.Expander
+		expanded, err := x.Expand(program)
+		if err != nil {
+			fmt.Fprintf(errOut, "%s: %v\n", path, err)
+			status = 1
+			continue
+		}
+
+		for _, form := range expanded {
+			fmt.Fprintln(out, printer.Pretty(form, printer.Options{}))
+		}
+	}
+
+	return status
+}
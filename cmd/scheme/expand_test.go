@@ -0,0 +1,48 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExpandCommand(t *testing.T) {
+	dir := t.TempDir()
+
+	testCases := []struct {
+		Script string
+		Code   int
+		Output string
+		Errors string
+	}{
+		{"(define x 1)\n(display x)\n", 0, "(define x 1)\n(display x)\n", ""},
+		{"(define-syntax while\n  (syntax-rules ()\n    ((_ c body ...) (let loop () (when c body ... (loop))))))\n(while (< i 3) (set! i (+ i 1)))\n", 0, "(let |loop#1| () (when (< i 3) (set! i (+ i 1)) (|loop#1|)))\n", ""},
+		{"(define-syntax one (syntax-rules () ((_) 1)))\n(one 1)\n", 1, "", "script.scm: no syntax rule matches: one at 2:1\n"},
+		{"(display", 1, "", "script.scm: "},
+	}
+
+	for _, c := range testCases {
+		path := filepath.Join(dir, "script.scm")
+		if err := os.WriteFile(path, []byte(c.Script), 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		var out, errOut strings.Builder
+		if code := expandCommand([]string{path}, &out, &errOut); code != c.Code {
+			t.Errorf("expected status %d got %d for %q", c.Code, code, c.Script)
+		}
+
+		if out.String() != c.Output {
+			t.Errorf("expected output %q got %q for %q", c.Output, out.String(), c.Script)
+		}
+		if expected := strings.ReplaceAll(c.Errors, "script.scm", path); !strings.HasPrefix(errOut.String(), expected) || (expected == "") != (errOut.Len() == 0) {
+			t.Errorf("expected errors %q got %q for %q", expected, errOut.String(), c.Script)
+		}
+	}
+
+	var errOut strings.Builder
+	if code := expandCommand(nil, nil, &errOut); code != 2 || !strings.HasPrefix(errOut.String(), "usage:") {
+		t.Errorf("expected usage with status 2 got %d, %q", code, errOut.String())
+	}
+}
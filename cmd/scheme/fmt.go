@@ -0,0 +1,91 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/vkhonin/scheme/printer"
+	"io"
+	"os"
+)
+
+// fmtCommand formats files given by args, or standard input if there are
+// none, writing them to out unless flags make it write them back to files
+// or write diffs of formatting. It returns exit status, writing errors to
+// errOut.
+func fmtCommand(args []string, in io.Reader, out, errOut io.Writer) int {
+	flags := flag.NewFlagSet("fmt", flag.ContinueOnError)
+	flags.SetOutput(errOut)
+	flags.Usage = func() {
+		fmt.Fprintln(errOut, "usage: scheme fmt [-d] [-w] [file...]")
+		flags.PrintDefaults()
+	}
+
+	write := flags.Bool("w", false, "write result to source file instead of standard output")
+	diff := flags.Bool("d", false, "write diffs instead of formatted source")
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if flags.NArg() == 0 {
+		if *write {
+			fmt.Fprintln(errOut, "error: cannot use -w with standard input")
+			return 2
+		}
+
+		src, err := io.ReadAll(in)
+		if err == nil {
+			err = formatSource("<standard input>", src, out, false, *diff)
+		}
+		if err != nil {
+			fmt.Fprintln(errOut, err)
+			return 1
+		}
+
+		return 0
+	}
+
+	status := 0
+	for _, path := range flags.Args() {
+		src, err := os.ReadFile(path)
+		if err == nil {
+			err = formatSource(path, src, out, *write, *diff)
+		}
+		if err != nil {
+			fmt.Fprintln(errOut, err)
+			status = 1
+		}
+	}
+
+	return status
+}
+
+// formatSource formats src of file path, writing it to out, or back to file
+// if write is set, or writing its diff to out if diff is set.
+func formatSource(path string, src []byte, out io.Writer, write, diff bool) error {
+	formatted, err := printer.Format(string(src), printer.Options{})
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	changed := formatted != string(src)
+
+	if diff && changed {
+		fmt.Fprintf(out, "diff %s.orig %s\n", path, path)
+		fmt.Fprint(out, unifiedDiff(path+".orig", path, string(src), formatted))
+	}
+
+	if write && changed {
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(path, []byte(formatted), info.Mode().Perm())
+	}
+
+	if !write && !diff {
+		_, err = io.WriteString(out, formatted)
+	}
+
+	return err
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFmtCommand(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "script.scm")
+
+	src := "; greeting\n(define  (greet name)\n(display name))\n\n\n\n(greet \"world\")\n"
+	formatted := "; greeting\n(define (greet name) (display name))\n\n(greet \"world\")\n"
+
+	if err := os.WriteFile(path, []byte(src), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	var out, errOut strings.Builder
+
+	if code := fmtCommand([]string{path}, nil, &out, &errOut); code != 0 || out.String() != formatted {
+		t.Errorf("expected %q with status 0 got %q with %d, %q", formatted, out.String(), code, errOut.String())
+	}
+
+	out.Reset()
+	diff := "diff " + path + ".orig " + path + "\n" +
+		"--- " + path + ".orig\n" +
+		"+++ " + path + "\n" +
+		"@@ -1,7 +1,4 @@\n" +
+		" ; greeting\n" +
+		"-(define  (greet name)\n" +
+		"-(display name))\n" +
+		"-\n" +
+		"-\n" +
+		"+(define (greet name) (display name))\n" +
+		" \n" +
+		" (greet \"world\")\n"
+	if code := fmtCommand([]string{"-d", path}, nil, &out, &errOut); code != 0 || out.String() != diff {
+		t.Errorf("expected diff\n%s\ngot\n%s", diff, out.String())
+	}
+
+	out.Reset()
+	if code := fmtCommand([]string{"-w", path}, nil, &out, &errOut); code != 0 || out.Len() != 0 {
+		t.Errorf("expected no output with status 0 got %q with %d", out.String(), code)
+	}
+	if data, _ := os.ReadFile(path); string(data) != formatted {
+		t.Errorf("expected file formatted as %q got %q", formatted, data)
+	}
+
+	out.Reset()
+	if code := fmtCommand([]string{"-d", path}, nil, &out, &errOut); code != 0 || out.Len() != 0 {
+		t.Errorf("expected no diff for formatted file got %q", out.String())
+	}
+
+	out.Reset()
+	if code := fmtCommand(nil, strings.NewReader("( a  b )"), &out, &errOut); code != 0 || out.String() != "(a b)\n" {
+		t.Errorf("expected standard input formatted got %q with %d", out.String(), code)
+	}
+
+	if errOut.Len() != 0 {
+		t.Errorf("expected no errors got %q", errOut.String())
+	}
+
+	if code := fmtCommand(nil, strings.NewReader("(a"), &out, &errOut); code != 1 || !strings.Contains(errOut.String(), "<standard input>: unexpected EOF") {
+		t.Errorf("expected error with status 1 got %q with %d", errOut.String(), code)
+	}
+
+	errOut.Reset()
+	if code := fmtCommand([]string{"-w"}, nil, &out, &errOut); code != 2 {
+		t.Errorf("expected status 2 for -w with standard input got %d", code)
+	}
+}
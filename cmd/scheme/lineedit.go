@@ -0,0 +1,398 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// maxHistory is number of lines lineEditor keeps in history.
+const maxHistory = 1000
+
+// errInterrupt is reported by lineEditor for line abandoned with ^C.
+var errInterrupt = errors.New("interrupted")
+
+// lineReader reads lines of input, writing prompt before each one. Lines
+// end with newline, unless input ends.
+type lineReader interface {
+	readLine(prompt string) (string, error)
+}
+
+// plainReader reads lines as they are, e.g. from file or pipe.
+type plainReader struct {
+	in  *bufio.Reader
+	out io.Writer
+}
+
+func (r *plainReader) readLine(prompt string) (string, error) {
+	fmt.Fprint(r.out, prompt)
+
+	return r.in.ReadString('\n')
+}
+
+// lineEditor reads lines from terminal, which it sets raw while reading,
+// with Emacs-style editing keys and history, which is kept in historyFile
+// unless it is empty.
+type lineEditor struct {
+	in  *bufio.Reader
+	out io.Writer
+
+	// raw sets terminal raw and returns function restoring it.
+	raw func() (func(), error)
+
+	// complete returns sorted completions of identifier prefix, unless nil.
+	complete func(prefix string) []string
+
+	history     []string
+	historyFile string
+
+	// line is line being edited and pos is index of rune cursor is at.
+	line []rune
+	pos  int
+
+	// recalled is index of history line being edited, which is
+	// len(history) for new line, and draft is new line while other are
+	// recalled.
+	recalled int
+	draft    []rune
+}
+
+func newLineEditor(in io.Reader, out io.Writer, historyFile string) *lineEditor {
+	e := &lineEditor{in: bufio.NewReader(in), out: out, historyFile: historyFile}
+	e.loadHistory()
+
+	return e
+}
+
+// loadHistory reads history from history file, if there is one.
+func (e *lineEditor) loadHistory() {
+	if e.historyFile == "" {
+		return
+	}
+
+	data, err := os.ReadFile(e.historyFile)
+	if err != nil {
+		return
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.TrimSpace(line) != "" {
+			e.history = append(e.history, line)
+		}
+	}
+	if len(e.history) > maxHistory {
+		e.history = e.history[len(e.history)-maxHistory:]
+	}
+}
+
+// addHistory adds line to history and appends it to history file, unless
+// it is blank or the same as last line of history.
+func (e *lineEditor) addHistory(line string) {
+	if strings.TrimSpace(line) == "" || (len(e.history) > 0 && e.history[len(e.history)-1] == line) {
+		return
+	}
+
+	e.history = append(e.history, line)
+	if len(e.history) > maxHistory {
+		e.history = e.history[1:]
+	}
+
+	if e.historyFile == "" {
+		return
+	}
+
+	f, err := os.OpenFile(e.historyFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	fmt.Fprintln(f, line)
+}
+
+// readLine reads line, which is edited by keys:
+//   - ←, →, ^B, ^F move cursor, and Home, End, ^A, ^E move it to line ends
+//   - Backspace, Delete, ^D delete rune before or at cursor, and ^W, ^U, ^K
+//     delete word before cursor, line before and after it
+//   - ↑, ↓, ^P, ^N recall lines of history, and ^R searches it backwards
+//   - Tab completes identifier before cursor
+//   - ^L clears screen, ^C abandons line, and ^D at empty line ends input
+func (e *lineEditor) readLine(prompt string) (string, error) {
+	if e.raw != nil {
+		restore, err := e.raw()
+		if err != nil {
+			return "", err
+		}
+		defer restore()
+	}
+
+	e.line, e.pos = nil, 0
+	e.recalled, e.draft = len(e.history), nil
+	e.refresh(prompt)
+
+	for {
+		r, _, err := e.in.ReadRune()
+		if err != nil {
+			if errors.Is(err, io.EOF) && len(e.line) > 0 {
+				return string(e.line), err
+			}
+			return "", err
+		}
+
+		switch r {
+		case '\r', '\n':
+			fmt.Fprint(e.out, "\r\n")
+			line := string(e.line)
+			e.addHistory(line)
+			return line + "\n", nil
+		case 3: // ^C
+			fmt.Fprint(e.out, "^C\r\n")
+			return "", errInterrupt
+		case 4: // ^D
+			if len(e.line) == 0 {
+				return "", io.EOF
+			}
+			e.delete(e.pos, e.pos+1)
+		case 1: // ^A
+			e.pos = 0
+		case 5: // ^E
+			e.pos = len(e.line)
+		case 2: // ^B
+			e.pos = max(e.pos-1, 0)
+		case 6: // ^F
+			e.pos = min(e.pos+1, len(e.line))
+		case 8, 127: // ^H, Backspace
+			e.delete(e.pos-1, e.pos)
+		case 11: // ^K
+			e.delete(e.pos, len(e.line))
+		case 21: // ^U
+			e.delete(0, e.pos)
+		case 23: // ^W
+			start := e.pos
+			for start > 0 && unicode.IsSpace(e.line[start-1]) {
+				start--
+			}
+			for start > 0 && !unicode.IsSpace(e.line[start-1]) {
+				start--
+			}
+			e.delete(start, e.pos)
+		case '\t':
+			e.completeWord()
+		case 12: // ^L
+			fmt.Fprint(e.out, "\x1b[H\x1b[2J")
+		case 16: // ^P
+			e.recall(e.recalled - 1)
+		case 14: // ^N
+			e.recall(e.recalled + 1)
+		case 18: // ^R
+			line, err := e.search()
+			if err != nil {
+				return line, err
+			}
+			if line != "" {
+				return line, nil
+			}
+		case 27: // Escape
+			if err := e.escape(); err != nil {
+				return "", err
+			}
+		default:
+			if unicode.IsPrint(r) {
+				e.line = slices.Insert(e.line, e.pos, r)
+				e.pos++
+			}
+		}
+
+		e.refresh(prompt)
+	}
+}
+
+// completeWord completes identifier before cursor with common prefix of its
+// completions, or lists them if it is complete already.
+func (e *lineEditor) completeWord() {
+	if e.complete == nil {
+		return
+	}
+
+	start := e.pos
+	for start > 0 && !isDelimiter(e.line[start-1]) {
+		start--
+	}
+
+	prefix := string(e.line[start:e.pos])
+	completions := e.complete(prefix)
+	if len(completions) == 0 {
+		return
+	}
+
+	common := completions[0]
+	for _, completion := range completions[1:] {
+		for !strings.HasPrefix(completion, common) {
+			_, size := utf8.DecodeLastRuneInString(common)
+			common = common[:len(common)-size]
+		}
+	}
+
+	if common != prefix {
+		rest := []rune(strings.TrimPrefix(common, prefix))
+		e.line = slices.Insert(e.line, e.pos, rest...)
+		e.pos += len(rest)
+		return
+	}
+
+	if len(completions) > 1 {
+		fmt.Fprintf(e.out, "\r\n%s\r\n", strings.Join(completions, "  "))
+	}
+}
+
+// isDelimiter reports whether r ends identifier.
+func isDelimiter(r rune) bool {
+	return unicode.IsSpace(r) || strings.ContainsRune("()'`,\";|", r)
+}
+
+// escape handles escape sequence of arrow, Home, End or Delete key.
+func (e *lineEditor) escape() error {
+	r, _, err := e.in.ReadRune()
+	if err != nil || (r != '[' && r != 'O') {
+		return err
+	}
+
+	if r, _, err = e.in.ReadRune(); err != nil {
+		return err
+	}
+
+	switch r {
+	case 'A':
+		e.recall(e.recalled - 1)
+	case 'B':
+		e.recall(e.recalled + 1)
+	case 'C':
+		e.pos = min(e.pos+1, len(e.line))
+	case 'D':
+		e.pos = max(e.pos-1, 0)
+	case 'H':
+		e.pos = 0
+	case 'F':
+		e.pos = len(e.line)
+	case '1', '3', '4', '7', '8':
+		// Home, Delete and End sent as ESC [ n ~.
+		if next, _, err := e.in.ReadRune(); err != nil || next != '~' {
+			return err
+		}
+		switch r {
+		case '1', '7':
+			e.pos = 0
+		case '4', '8':
+			e.pos = len(e.line)
+		case '3':
+			e.delete(e.pos, e.pos+1)
+		}
+	}
+
+	return nil
+}
+
+// search searches history backwards for lines containing query typed,
+// older ones on each ^R. Enter returns line found, ^C and ^G cancel search,
+// and other keys make line found line edited and are handled as usual,
+// returning empty string.
+func (e *lineEditor) search() (string, error) {
+	var query []rune
+	found := e.recalled
+
+	for {
+		match := ""
+		if found < len(e.history) {
+			match = e.history[found]
+		}
+		fmt.Fprintf(e.out, "\r(reverse-i-search)`%s': %s\x1b[K", string(query), match)
+
+		r, _, err := e.in.ReadRune()
+		if err != nil {
+			return "", err
+		}
+
+		switch {
+		case r == 18: // ^R
+			if older := e.find(string(query), found-1); older < len(e.history) {
+				found = older
+			}
+		case r == 8 || r == 127:
+			if len(query) > 0 {
+				query = query[:len(query)-1]
+			}
+			found = e.find(string(query), e.recalled-1)
+		case r == 3 || r == 7: // ^C, ^G
+			return "", nil
+		case r == '\r' || r == '\n':
+			fmt.Fprint(e.out, "\r\n")
+			e.addHistory(match)
+			return match + "\n", nil
+		case unicode.IsPrint(r):
+			query = append(query, r)
+			found = e.find(string(query), found)
+		default:
+			if found < len(e.history) {
+				e.line, e.pos = []rune(match), len([]rune(match))
+			}
+			return "", e.in.UnreadRune()
+		}
+	}
+}
+
+// find returns index of last line of history at or before index from
+// containing query, or len(history) if there is none.
+func (e *lineEditor) find(query string, from int) int {
+	for i := min(from, len(e.history)-1); i >= 0; i-- {
+		if strings.Contains(e.history[i], query) {
+			return i
+		}
+	}
+
+	return len(e.history)
+}
+
+// recall replaces line edited with line i of history, or draft for i equal
+// to len(history).
+func (e *lineEditor) recall(i int) {
+	if i < 0 || i > len(e.history) || i == e.recalled {
+		return
+	}
+
+	if e.recalled == len(e.history) {
+		e.draft = e.line
+	}
+	e.recalled = i
+
+	if i == len(e.history) {
+		e.line = e.draft
+	} else {
+		e.line = []rune(e.history[i])
+	}
+	e.pos = len(e.line)
+}
+
+// delete deletes runes of line from start to end, which are clamped to it.
+func (e *lineEditor) delete(start, end int) {
+	start, end = max(start, 0), min(end, len(e.line))
+	if start >= end {
+		return
+	}
+
+	e.line = slices.Delete(slices.Clone(e.line), start, end)
+	e.pos = start
+}
+
+// refresh redraws prompt and line and moves cursor to its position.
+func (e *lineEditor) refresh(prompt string) {
+	fmt.Fprintf(e.out, "\r%s%s\x1b[K", prompt, string(e.line))
+	if back := len(e.line) - e.pos; back > 0 {
+		fmt.Fprintf(e.out, "\x1b[%dD", back)
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestLineEditor(t *testing.T) {
+	testCases := []struct {
+		Keys     string
+		Expected string
+	}{
+		{"ab\r", "ab\n"},
+		{"ab\x1b[Dc\x1b[C d\r", "acb d\n"},
+		{"abc\x01x\x05y\r", "xabcy\n"},
+		{"abc\x02\x02\x7f\x1b[3~\r", "c\n"},
+		{"abc\x02\x0b\r", "ab\n"},
+		{"abc\x02\x15\r", "c\n"},
+		{"(a bc\x17d\r", "(a d\n"},
+		{"λx\x02\x04\r", "λ\n"},
+		{"\x1b[A\r", "(old 2)\n"},
+		{"\x10\x10\x1b[B\r", "(old 2)\n"},
+		{"new\x1b[A\x1b[B!\r", "new!\n"},
+		{"\x12ld 1\r", "(old 1)\n"},
+		{"\x12old\x12\x12\r", "(old 1)\n"},
+		{"\x12x\r", "\n"},
+		{"\x12old\x01!\r", "!(old 2)\n"},
+		{"\x12old\x07x\r", "x\n"},
+	}
+
+	for _, c := range testCases {
+		var out strings.Builder
+
+		e := newLineEditor(strings.NewReader(c.Keys), &out, "")
+		e.history = []string{"(old 1)", "(old 2)"}
+
+		line, err := e.readLine("> ")
+		if err != nil {
+			t.Errorf("unexpected error %v for %q", err, c.Keys)
+			continue
+		}
+
+		if line != c.Expected {
+			t.Errorf("expected %q got %q for %q", c.Expected, line, c.Keys)
+		}
+	}
+
+	e := newLineEditor(strings.NewReader("a\x03\x04"), io.Discard, "")
+	if _, err := e.readLine("> "); !errors.Is(err, errInterrupt) {
+		t.Errorf("expected errInterrupt got %v", err)
+	}
+	if _, err := e.readLine("> "); !errors.Is(err, io.EOF) {
+		t.Errorf("expected io.EOF got %v", err)
+	}
+}
+
+func TestLineEditor_History(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history")
+	if err := os.WriteFile(path, []byte("(old)\n\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	var restored int
+	e := newLineEditor(strings.NewReader("(a)\r(a)\r \r\x1b[A\x1b[A\r"), io.Discard, path)
+	e.raw = func() (func(), error) { return func() { restored++ }, nil }
+
+	var lines []string
+	for range 4 {
+		line, err := e.readLine("> ")
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+		lines = append(lines, line)
+	}
+
+	if expected := []string{"(a)\n", "(a)\n", " \n", "(old)\n"}; !slices.Equal(lines, expected) {
+		t.Errorf("expected %q got %q", expected, lines)
+	}
+	if restored != 4 {
+		t.Errorf("expected terminal restored 4 times got %d", restored)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil || string(data) != "(old)\n\n(a)\n(old)\n" {
+		t.Errorf("unexpected history file %q, %v", data, err)
+	}
+
+	if e = newLineEditor(strings.NewReader(""), io.Discard, path); !slices.Equal(e.history, []string{"(old)", "(a)", "(old)"}) {
+		t.Errorf("unexpected history loaded %q", e.history)
+	}
+}
+
+func TestLineEditor_Complete(t *testing.T) {
+	names := []string{"string->number", "string?", "symbol?"}
+	complete := func(prefix string) []string {
+		var completions []string
+		for _, name := range names {
+			if strings.HasPrefix(name, prefix) {
+				completions = append(completions, name)
+			}
+		}
+		return completions
+	}
+
+	testCases := []struct {
+		Keys     string
+		Expected string
+		Listed   bool
+	}{
+		{"(sy\t 1)\r", "(symbol? 1)\n", false},
+		{"(str\t\r", "(string\n", false},
+		{"(str\t\t\r", "(string\n", true},
+		{"(x\t\r", "(x\n", false},
+		{"'st\x02\x02\t\r", "'sst\n", false},
+	}
+
+	for _, c := range testCases {
+		var out strings.Builder
+
+		e := newLineEditor(strings.NewReader(c.Keys), &out, "")
+		e.complete = complete
+
+		line, err := e.readLine("> ")
+		if err != nil || line != c.Expected {
+			t.Errorf("expected %q got %q, %v for %q", c.Expected, line, err, c.Keys)
+		}
+
+		if listed := strings.Contains(out.String(), "string->number  string?"); listed != c.Listed {
+			t.Errorf("expected completions listed %v got %q for %q", c.Listed, out.String(), c.Keys)
+		}
+	}
+}
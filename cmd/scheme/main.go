@@ -0,0 +1,100 @@
+// Command scheme is Scheme interpreter. Run without arguments, it reads
+// expressions from standard input, evaluates them and prints their values.
+//
+// Usage:
+//
+//	scheme
+//	scheme run [-vm [-noopt] [-fold]] file [arg...]
+//	scheme file [arg...]
+//	scheme fmt [-d] [-w] [file...]
+//	scheme check file...
+//	scheme expand file...
+//
+// Run evaluates script file, exiting with status set by exit procedure. With
+// -vm, script is compiled to bytecode and run on virtual machine, which is
+// faster; -noopt disables optimization of bytecode, and -fold makes it fold
+// calls of standard procedures with constant arguments, which script must
+// not redefine then. File given without command is run too, so scripts
+// starting with #!/usr/bin/env scheme line may be executed directly.
+//
+// Fmt formats files, or standard input, canonically and writes them to
+// standard output. Comments are kept. With -w, files are formatted in place,
+// and with -d, diffs of formatting are written instead.
+//
+// Check reports unbound variables, calls with wrong number of arguments,
+// duplicate definitions and malformed special forms in files without running
+// them, exiting with status 1 if there are any.
+//
+// Expand writes forms of files with syntax-rules macros expanded into core
+// forms, which helps to debug macros.
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/vkhonin/scheme/eval"
+	"os"
+	"path/filepath"
+)
+
+// commands are subcommands by their names, which return exit status given
+// their arguments.
+var commands = map[string]func(args []string) int{
+	"check":  func(args []string) int { return checkCommand(args, os.Stdout, os.Stderr) },
+	"expand": func(args []string) int { return expandCommand(args, os.Stdout, os.Stderr) },
+	"fmt":    func(args []string) int { return fmtCommand(args, os.Stdin, os.Stdout, os.Stderr) },
+	"run":    func(args []string) int { return runCommand(args, os.Stdin, os.Stdout, os.Stderr) },
+}
+
+func main() {
+	if len(os.Args) > 1 {
+		command, ok := commands[os.Args[1]]
+		if _, err := os.Stat(os.Args[1]); !ok && err == nil {
+			os.Exit(runCommand(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+		}
+		if !ok {
+			fmt.Fprintln(os.Stderr, "usage: scheme [run [-vm [-noopt] [-fold]] file [arg...] | file [arg...] | fmt [-d] [-w] [file...] | check file... | expand file...]")
+			os.Exit(2)
+		}
+		os.Exit(command(os.Args[2:]))
+	}
+
+	r := newREPL(os.Stdin, os.Stdout, os.Stderr)
+	if !isTerminal(os.Stdin) {
+		r.prompt, r.continuation = "", ""
+	} else if restore, err := makeRaw(int(os.Stdin.Fd())); err == nil {
+		restore()
+
+		editor := newLineEditor(os.Stdin, os.Stdout, historyFile())
+		editor.raw = func() (func(), error) { return makeRaw(int(os.Stdin.Fd())) }
+		editor.complete = r.complete
+		r.lines = editor
+	}
+
+	if err := r.run(); err != nil {
+		var exit *eval.Exit
+		if errors.As(err, &exit) {
+			os.Exit(exit.Code)
+		}
+
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// historyFile returns path of file REPL history is kept in, which is
+// .scheme_history in home directory, or empty string if there is none.
+func historyFile() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+
+	return filepath.Join(home, ".scheme_history")
+}
+
+// isTerminal reports whether f is terminal rather than file or pipe.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
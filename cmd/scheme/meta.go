@@ -0,0 +1,190 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/vkhonin/scheme/eval"
+	"github.com/vkhonin/scheme/parser"
+	"github.com/vkhonin/scheme/printer"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+var errQuit = errors.New("quit")
+
+// metaCommand handles meta-command of REPL, e.g. ,load file, given its
+// argument, e.g. file. It reports errQuit to end REPL.
+type metaCommand func(r *repl, arg string) error
+
+var metaCommands map[string]metaCommand
+
+func init() {
+	metaCommands = map[string]metaCommand{
+		"env":    metaEnv,
+		"expand": metaExpand,
+		"load":   metaLoad,
+		"quit":   metaQuit,
+		"time":   metaTime,
+		"trace":  metaTrace,
+	}
+}
+
+// meta runs meta-command of line, which starts with comma. It reports
+// errQuit and *eval.Exit to end REPL, and writes other errors to errOut.
+func (r *repl) meta(line string) error {
+	name, arg, _ := strings.Cut(strings.TrimPrefix(strings.TrimSpace(line), ","), " ")
+
+	command, ok := metaCommands[name]
+	if !ok {
+		names := make([]string, 0, len(metaCommands))
+		for name := range metaCommands {
+			names = append(names, ","+name)
+		}
+		slices.Sort(names)
+
+		fmt.Fprintf(r.errOut, "error: unknown command ,%s, expected one of %s\n", name, strings.Join(names, " "))
+		return nil
+	}
+
+	var exit *eval.Exit
+
+	err := command(r, strings.TrimSpace(arg))
+	if err != nil && !errors.Is(err, errQuit) && !errors.As(err, &exit) {
+		fmt.Fprintln(r.errOut, "error:", err)
+		return nil
+	}
+
+	return err
+}
+
+// metaQuit ends REPL.
+func metaQuit(r *repl, arg string) error {
+	return errQuit
+}
+
+// metaEnv writes names bound in environment and their values.
+func metaEnv(r *repl, arg string) error {
+	for _, name := range r.env.Names() {
+		value, err := r.env.Lookup(name)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(r.out, "%s %s\n", name, printer.Write(value))
+	}
+
+	return nil
+}
+
+// metaLoad evaluates file arg in environment.
+func metaLoad(r *repl, arg string) error {
+	if arg == "" {
+		return errors.New("file expected")
+	}
+
+	f, err := os.Open(arg)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	program, err := parser.ParseReader(f)
+	if err != nil {
+		return fmt.Errorf("%s: %w", arg, err)
+	}
+
+	if _, err := r.ev.RunProgram(program, r.env); err != nil {
+		return fmt.Errorf("%s: %w", arg, err)
+	}
+
+	return nil
+}
+
+// metaTime evaluates expressions of arg, writing their values as REPL does,
+// and time it takes.
+func metaTime(r *repl, arg string) error {
+	data, err := parser.ParseString(arg)
+	if err != nil {
+		return err
+	}
+
+	start := time.Now()
+	for _, datum := range data {
+		value, err := r.ev.RunProgram([]parser.Sexpr{datum}, r.env)
+		if err != nil {
+			return err
+		}
+		r.writeValue(value)
+	}
+	fmt.Fprintf(r.out, "; %s\n", time.Since(start))
+
+	return nil
+}
+
+// metaExpand writes expressions of arg with macros defined in REPL expanded.
+// Macros defined by arg are defined in REPL too.
+func metaExpand(r *repl, arg string) error {
+	data, err := parser.ParseString(arg)
+	if err != nil {
+		return err
+	}
+
+	if data, err = r.ev.Expander().Expand(data); err != nil {
+		return err
+	}
+
+	for _, datum := range data {
+		fmt.Fprintln(r.out, printer.Write(datum))
+	}
+
+	return nil
+}
+
+// metaTrace makes procedure bound to arg write its calls and their values,
+// or stops tracing it if it is traced already.
+func metaTrace(r *repl, arg string) error {
+	if original, ok := r.traced[arg]; ok {
+		delete(r.traced, arg)
+		fmt.Fprintf(r.out, "; %s untraced\n", arg)
+		return r.env.Set(arg, original)
+	}
+
+	procedure, err := r.env.Lookup(arg)
+	if err != nil {
+		return err
+	}
+
+	switch procedure.(type) {
+	case *eval.Builtin, *eval.Closure:
+	default:
+		return fmt.Errorf("%s is not a procedure", arg)
+	}
+
+	depth := 0
+	traced := &eval.Builtin{
+		Name:    arg,
+		MaxArgs: -1,
+		Fn: func(ev *eval.Evaluator, args []parser.Sexpr) (parser.Sexpr, error) {
+			indent := strings.Repeat("  ", depth)
+			fmt.Fprintf(r.out, "%s%s\n", indent, printer.Write(parser.Cons(parser.Symbol(arg), parser.List(args...))))
+
+			depth++
+			defer func() { depth-- }()
+
+			value, err := ev.Apply(procedure, args)
+			if err == nil {
+				fmt.Fprintf(r.out, "%s=> %s\n", indent, printer.Write(value))
+			}
+			return value, err
+		},
+	}
+
+	if r.traced == nil {
+		r.traced = make(map[string]parser.Sexpr)
+	}
+	r.traced[arg] = procedure
+	fmt.Fprintf(r.out, "; %s traced\n", arg)
+
+	return r.env.Set(arg, traced)
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"github.com/vkhonin/scheme"
+	"github.com/vkhonin/scheme/eval"
+	"github.com/vkhonin/scheme/parser"
+	"github.com/vkhonin/scheme/printer"
+	"io"
+	"slices"
+	"strings"
+)
+
+// repl reads expressions line by line, evaluates them in standard
+// environment and writes their values. Lines are read until expressions in
+// them are complete, e.g. parentheses and strings are closed. Errors are
+// written to errOut, and reading goes on. Lines starting with comma are
+// meta-commands, e.g. ,quit, unless they continue expressions.
+type repl struct {
+	lines  lineReader
+	out    io.Writer
+	errOut io.Writer
+
+	// prompt is written before each line read, unless empty, and
+	// continuation before lines continuing incomplete expressions.
+	prompt       string
+	continuation string
+
+	ev  *eval.Evaluator
+	env *eval.Environment
+
+	// traced are procedures traced by ,trace by their names.
+	traced map[string]parser.Sexpr
+}
+
+func newREPL(in io.Reader, out, errOut io.Writer) *repl {
+	r := bufio.NewReader(in)
+
+	return &repl{
+		lines:        &plainReader{in: r, out: out},
+		out:          out,
+		errOut:       errOut,
+		prompt:       "> ",
+		continuation: "... ",
+		ev:           &eval.Evaluator{},
+		env:          scheme.StandardEnvironment(scheme.Console(r, out)),
+	}
+}
+
+// run reads and evaluates input until it ends. It reports *eval.Exit if exit
+// procedure is called.
+func (r *repl) run() error {
+	var input string
+
+	for {
+		prompt := r.prompt
+		if input != "" {
+			prompt = r.continuation
+		}
+
+		line, err := r.lines.readLine(prompt)
+		if errors.Is(err, errInterrupt) {
+			input = ""
+			continue
+		}
+		if err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+
+		if input == "" && strings.HasPrefix(strings.TrimSpace(line), ",") {
+			if err := r.meta(line); errors.Is(err, errQuit) {
+				return nil
+			} else if err != nil {
+				return err
+			}
+		} else {
+			input += line
+
+			incomplete, err := r.evalInput(input, err != nil)
+			if err != nil {
+				return err
+			}
+			if !incomplete {
+				input = ""
+			}
+		}
+
+		if err != nil {
+			if r.prompt != "" {
+				fmt.Fprintln(r.out)
+			}
+			return nil
+		}
+	}
+}
+
+// complete returns sorted identifiers bound in environment of r and special
+// form keywords starting with prefix.
+func (r *repl) complete(prefix string) []string {
+	var completions []string
+
+	for _, name := range append(r.env.Names(), eval.SpecialForms()...) {
+		if strings.HasPrefix(name, prefix) {
+			completions = append(completions, name)
+		}
+	}
+
+	slices.Sort(completions)
+
+	return slices.Compact(completions)
+}
+
+// evalInput evaluates data of input and writes their values, except
+// unspecified ones, and errors. It reports whether input is incomplete, in
+// which case nothing is evaluated, unless input has ended. Only *eval.Exit
+// is returned as error.
+func (r *repl) evalInput(input string, ended bool) (bool, error) {
+	data, err := parser.ParseString(input)
+	if errors.Is(err, parser.UNEXPECTED_EOF) && !ended {
+		return true, nil
+	}
+	if err != nil {
+		fmt.Fprintln(r.errOut, "error:", err)
+		return false, nil
+	}
+
+	var exit *eval.Exit
+
+	for _, datum := range data {
+		value, err := r.ev.RunProgram([]parser.Sexpr{datum}, r.env)
+		if errors.As(err, &exit) {
+			return false, err
+		}
+		if err != nil {
+			fmt.Fprintln(r.errOut, "error:", err)
+			return false, nil
+		}
+
+		r.writeValue(value)
+	}
+
+	return false, nil
+}
+
+// writeValue writes value, unless it is unspecified.
+func (r *repl) writeValue(value parser.Sexpr) {
+	if value != eval.Unspecified {
+		fmt.Fprintln(r.out, printer.Write(value))
+	}
+}
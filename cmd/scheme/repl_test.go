@@ -0,0 +1,138 @@
+package main
+
+import (
+	"errors"
+	"github.com/vkhonin/scheme/eval"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestREPL(t *testing.T) {
+	testCases := []struct {
+		Input  string
+		Output string
+		Errors string
+	}{
+		{"(+ 1 2)\n", "3\n", ""},
+		{"(define x 2) (* x x)\n'(a \"b\")", "4\n(a \"b\")\n", ""},
+		{"(car '())\n(+ 1 1)\n", "2\n", "error: "},
+		{")\n#t\n", "#t\n", "error: "},
+		{"y\n", "", "error: unbound variable"},
+		{"(+ 1\n  2)\n\"a\nb\"\n", "3\n\"a\\nb\"\n", ""},
+		{"(define (f x)\n  #| comment\n|# x)\n(f 1)\n", "1\n", ""},
+		{"(+ 1\n", "", "error: unexpected EOF"},
+		{"(begin (display \"hi\") (newline) (read-line))\nnext\n", "hi\n\"next\"\n", ""},
+	}
+
+	for _, c := range testCases {
+		var out, errOut strings.Builder
+
+		r := newREPL(strings.NewReader(c.Input), &out, &errOut)
+		r.prompt, r.continuation = "", ""
+		if err := r.run(); err != nil {
+			t.Errorf("unexpected error %v for %q", err, c.Input)
+			continue
+		}
+
+		if out.String() != c.Output {
+			t.Errorf("expected output %q got %q for %q", c.Output, out.String(), c.Input)
+		}
+		if !strings.HasPrefix(errOut.String(), c.Errors) || (c.Errors == "") != (errOut.Len() == 0) {
+			t.Errorf("expected errors %q got %q for %q", c.Errors, errOut.String(), c.Input)
+		}
+	}
+
+	var out strings.Builder
+	if err := newREPL(strings.NewReader("1\n(+ 1\n1)\n"), &out, &out).run(); err != nil || out.String() != "> 1\n> ... 2\n> \n" {
+		t.Errorf("expected prompts got %q, %v", out.String(), err)
+	}
+}
+
+func TestREPL_Complete(t *testing.T) {
+	r := newREPL(strings.NewReader("(define string-x 1)\n"), io.Discard, io.Discard)
+	r.prompt, r.continuation = "", ""
+	if err := r.run(); err != nil {
+		t.Fatal(err)
+	}
+
+	completions := r.complete("str")
+	if !slices.Contains(completions, "string->number") || !slices.Contains(completions, "string-x") || !slices.IsSorted(completions) {
+		t.Errorf("expected sorted completions of str got %v", completions)
+	}
+
+	if completions := r.complete("lam"); !slices.Equal(completions, []string{"lambda"}) {
+		t.Errorf("expected [lambda] got %v", completions)
+	}
+}
+
+func TestREPL_Meta(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lib.scm")
+	if err := os.WriteFile(path, []byte("(define (twice x) (* 2 x))"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		Input  string
+		Output string
+		Errors string
+	}{
+		{",load " + path + "\n(twice 2)\n", "4\n", ""},
+		{",load missing.scm\n", "", "error: open missing.scm"},
+		{",load\n", "", "error: file expected"},
+		{"1\n,quit\n2\n", "1\n", ""},
+		{" ,quit \n2\n", "", ""},
+		{",time (+ 1 2) (if #f #f)\n", "3\n; ", ""},
+		{",expand (let ((x 1)) x)\n", "(let ((x 1)) x)\n", ""},
+		{"(define-syntax inc! (syntax-rules () ((_ v) (set! v (+ v 1)))))\n,expand (inc! x)\n", "(set! x (+ x 1))\n", ""},
+		{",expand (define-syntax one (syntax-rules () ((_) 1))) (one 1)\n", "", "error: no syntax rule matches: one"},
+		{"(define (f n) (if (= n 0) 0 (f (- n 1))))\n,trace f\n(f 1)\n,trace f\n(f 1)\n", "; f traced\n(f 1)\n  (f 0)\n  => 0\n=> 0\n0\n; f untraced\n0\n", ""},
+		{",trace car\n(car '(1))\n", "; car traced\n(car (1))\n=> 1\n1\n", ""},
+		{",trace undefined\n", "", "error: unbound variable"},
+		{"(define x 1)\n,trace x\n", "", "error: x is not a procedure"},
+		{",what\n", "", "error: unknown command ,what, expected one of ,env ,expand ,load ,quit ,time ,trace"},
+		{"'(a\n,b)\n", "(a (unquote b))\n", ""},
+	}
+
+	for _, c := range testCases {
+		var out, errOut strings.Builder
+
+		r := newREPL(strings.NewReader(c.Input), &out, &errOut)
+		r.prompt, r.continuation = "", ""
+		if err := r.run(); err != nil {
+			t.Errorf("unexpected error %v for %q", err, c.Input)
+			continue
+		}
+
+		if !strings.HasPrefix(out.String(), c.Output) || (!strings.HasSuffix(c.Output, "; ") && out.String() != c.Output) {
+			t.Errorf("expected output %q got %q for %q", c.Output, out.String(), c.Input)
+		}
+		if !strings.HasPrefix(errOut.String(), c.Errors) || (c.Errors == "") != (errOut.Len() == 0) {
+			t.Errorf("expected errors %q got %q for %q", c.Errors, errOut.String(), c.Input)
+		}
+	}
+
+	var out strings.Builder
+	r := newREPL(strings.NewReader("(define y 2)\n,env\n"), &out, &out)
+	r.prompt = ""
+	if err := r.run(); err != nil || !strings.Contains(out.String(), "y 2\n") || !strings.Contains(out.String(), "car #<procedure car>\n") {
+		t.Errorf("expected bindings written got %q, %v", out.String(), err)
+	}
+}
+
+func TestREPL_Exit(t *testing.T) {
+	for _, input := range []string{"1\n(exit 3)\n2\n", ",time (exit 3)\n2\n"} {
+		var out strings.Builder
+
+		r := newREPL(strings.NewReader(input), &out, &out)
+		r.prompt, r.continuation = "", ""
+
+		var exit *eval.Exit
+		if err := r.run(); !errors.As(err, &exit) || exit.Code != 3 || strings.Contains(out.String(), "2") {
+			t.Errorf("expected exit with status 3 got %v, %q for %q", err, out.String(), input)
+		}
+	}
+}
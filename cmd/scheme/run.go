@@ -0,0 +1,116 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/vkhonin/scheme"
+	"github.com/vkhonin/scheme/eval"
+	"github.com/vkhonin/scheme/lexer"
+	"github.com/vkhonin/scheme/parser"
+	"github.com/vkhonin/scheme/vm"
+	"io"
+	"os"
+)
+
+// runCommand evaluates script file given by first of args in standard
+// environment with console of in and out, see scheme.Console, and
+// command-line returning args. It returns exit status,
+// which exit procedure sets, writing errors to errOut with positions of
+// expressions they are signalled in. Flag -vm makes it compile script to
+// bytecode and run it on virtual machine instead, -noopt leaves bytecode
+// unoptimized, and -fold folds calls of standard procedures with constant
+// arguments, which script must not redefine then.
+func runCommand(args []string, in io.Reader, out, errOut io.Writer) int {
+	flags := flag.NewFlagSet("run", flag.ContinueOnError)
+	flags.SetOutput(errOut)
+	flags.Usage = func() {
+		fmt.Fprintln(errOut, "usage: scheme run [-vm [-noopt] [-fold]] file [arg...]")
+		flags.PrintDefaults()
+	}
+
+	useVM := flags.Bool("vm", false, "compile script to bytecode and run it on virtual machine")
+	noOpt := flags.Bool("noopt", false, "do not optimize bytecode, which helps to debug compiler")
+	fold := flags.Bool("fold", false, "fold calls of standard procedures with constant arguments, which script does not redefine")
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if args = flags.Args(); len(args) == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	program, err := readProgram(args[0])
+	if err != nil {
+		fmt.Fprintln(errOut, err)
+		return 1
+	}
+
+	ev := &eval.Evaluator{CommandLine: args}
+	env := scheme.StandardEnvironment(scheme.Console(in, out))
+
+	var backend eval.Backend = ev
+	if *useVM {
+		m := vm.New(ev)
+		m.Options.NoOptimize = *noOpt
+		m.Options.FoldCalls = *fold
+		backend = m
+	}
+
+	for _, datum := range program {
+		if _, err := backend.RunProgram([]parser.Sexpr{datum}, env); err != nil {
+			var exit *eval.Exit
+			if errors.As(err, &exit) {
+				return exit.Code
+			}
+
+			fmt.Fprintf(errOut, "%s:%s: %v\n", args[0], span(datum).Start, err)
+			return 1
+		}
+	}
+
+	return 0
+}
+
+// readProgram returns data of file path, read with their positions.
+func readProgram(path string) ([]parser.Sexpr, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var tokens []lexer.Token
+	for token, err := range lexer.New(f).Tokens() {
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		tokens = append(tokens, token)
+	}
+
+	p := parser.Parser{Tokens: tokens, WithPositions: true}
+	program, err := p.Parse()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return program, nil
+}
+
+// span returns span of datum read with its position.
+func span(datum parser.Sexpr) parser.Span {
+	switch d := datum.(type) {
+	case *parser.Atom:
+		return d.Span
+	case *parser.Expr:
+		return d.Span
+	case *parser.Vector:
+		return d.Span
+	case *parser.Bytevector:
+		return d.Span
+	}
+
+	return parser.Span{}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunCommand(t *testing.T) {
+	dir := t.TempDir()
+
+	testCases := []struct {
+		Script string
+		Args   []string
+		Code   int
+		Errors string
+	}{
+		{"(define x 1)\n(+ x 1)\n", nil, 0, ""},
+		{"(exit (if (equal? (command-line) (list \"" + filepath.Join(dir, "script.scm") + "\" \"a\" \"b\")) 3 4))", []string{"a", "b"}, 3, ""},
+		{"(exit #f)\n(car 1)", nil, 1, ""},
+		{"#!/usr/bin/env scheme run\n(exit 7)\n", nil, 7, ""},
+		{"(define x 1)\n#!/usr/bin/env scheme\n", nil, 1, "script.scm: invalid hash prefixed token: script line #!/usr/bin/env is allowed only at start of source"},
+		{"(define x 1)\n\n  (car x)\n", nil, 1, "script.scm:3:3: wrong type argument"},
+		{"(define x 1)\n  (car x", nil, 1, "script.scm: unexpected EOF"},
+		{"(dynamic-wind (lambda () #f) (lambda () (exit 5)) (lambda () (car 1)))", nil, 1, "script.scm:1:1: wrong type argument"},
+	}
+
+	for _, c := range testCases {
+		path := filepath.Join(dir, "script.scm")
+		if err := os.WriteFile(path, []byte(c.Script), 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		var errOut strings.Builder
+		if code := runCommand(append([]string{path}, c.Args...), strings.NewReader(""), io.Discard, &errOut); code != c.Code {
+			t.Errorf("expected status %d got %d for %q", c.Code, code, c.Script)
+		}
+
+		if !strings.Contains(errOut.String(), c.Errors) || (c.Errors == "") != (errOut.Len() == 0) {
+			t.Errorf("expected errors %q got %q for %q", c.Errors, errOut.String(), c.Script)
+		}
+	}
+
+	for _, flags := range [][]string{{"-vm"}, {"-vm", "-noopt"}, {"-vm", "-fold"}} {
+		for _, c := range testCases {
+			path := filepath.Join(dir, "script.scm")
+			if err := os.WriteFile(path, []byte(c.Script), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			var errOut strings.Builder
+			if code := runCommand(append(append(flags, path), c.Args...), strings.NewReader(""), io.Discard, &errOut); code != c.Code {
+				t.Errorf("expected status %d with %v got %d for %q", c.Code, flags, code, c.Script)
+			}
+
+			if !strings.Contains(errOut.String(), c.Errors) || (c.Errors == "") != (errOut.Len() == 0) {
+				t.Errorf("expected errors %q with %v got %q for %q", c.Errors, flags, errOut.String(), c.Script)
+			}
+		}
+	}
+
+	var errOut strings.Builder
+	if code := runCommand(nil, nil, io.Discard, &errOut); code != 2 || !strings.HasPrefix(errOut.String(), "usage:") {
+		t.Errorf("expected usage with status 2 got %d, %q", code, errOut.String())
+	}
+	if code := runCommand([]string{filepath.Join(dir, "missing.scm")}, nil, io.Discard, &errOut); code != 1 {
+		t.Errorf("expected status 1 for missing file got %d", code)
+	}
+}
+
+func TestRunCommand_Console(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "script.scm")
+	script := "(define name (read-line))\n(display \"hello \")\n(write name)\n(newline)\n"
+	if err := os.WriteFile(path, []byte(script), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, flags := range [][]string{nil, {"-vm"}} {
+		var out, errOut strings.Builder
+		if code := runCommand(append(flags, path), strings.NewReader("world\n"), &out, &errOut); code != 0 || errOut.Len() != 0 {
+			t.Errorf("expected status 0 with %v got %d, %q", flags, code, errOut.String())
+		}
+
+		if expected := "hello \"world\"\n"; out.String() != expected {
+			t.Errorf("expected output %q with %v got %q", expected, flags, out.String())
+		}
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !linux && !darwin
+
+package main
+
+import (
+	"errors"
+)
+
+// makeRaw reports that raw terminal is not supported, so lines are read as
+// they are.
+func makeRaw(fd int) (func(), error) {
+	return nil, errors.ErrUnsupported
+}
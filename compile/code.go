@@ -0,0 +1,229 @@
+package compile
+
+import (
+	"fmt"
+	"github.com/vkhonin/scheme/eval"
+	"github.com/vkhonin/scheme/parser"
+	"strings"
+	"sync/atomic"
+)
+
+// Opcode is operation of instruction. Comments describe effect of
+// instruction with argument n on stack of values machine keeps for frame of
+// procedure call, and on its environment.
+type Opcode uint8
+
+const (
+	CONST             Opcode = iota // Push Consts[n]
+	UNSPECIFIED                     // Push unspecified value
+	REF                             // Push value of global variable Names[n]
+	SET                             // Pop value and assign it to global variable Names[n]
+	DEFINE                          // Pop value and bind global variable Names[n] to it
+	LOCAL                           // Push value of local variable in slot n
+	SET_LOCAL                       // Pop value and assign it to local variable in slot n
+	BIND                            // Pop value and bind local variable in slot n to it anew
+	DECLARE                         // Bind local variable in slot n to unassigned value
+	FREE                            // Push value of free variable Free[n] of closure
+	SET_FREE                        // Pop value and assign it to free variable Free[n]
+	POP                             // Pop value
+	DUP                             // Push value on top again
+	SWAP                            // Swap two values on top
+	JUMP                            // Continue at instruction n
+	JUMP_FALSE                      // Pop value and continue at instruction n if it is #f
+	JUMP_TRUE_OR_POP                // Continue at instruction n if value on top is true, or pop it
+	JUMP_FALSE_OR_POP               // Continue at instruction n if value on top is #f, or pop it
+	CLOSURE                         // Push closure of Procedures[n], capturing its free variables
+	CALL                            // Pop n arguments and procedure, call it and push its value
+	TAIL_CALL                       // As CALL, but replace frame with that of called closure
+	RETURN                          // Return value on top from procedure
+	MEMV                            // Push whether value on top is eqv to any element of list Consts[n]
+	CONS                            // Pop cdr and car and push pair of them
+	APPEND                          // Pop tail and list and push copy of list ending with tail
+	LIST_VECTOR                     // Pop list and push vector of its elements
+	PROMISE                         // Pop procedure and push promise calling it, of delay-force if n is 1
+	GUARD                           // Pop procedure and call it as guard body; push its value and continue at instruction n, or push whether it raises continuably and object it raises
+	RAISE                           // Pop object and whether to raise it continuably, and raise it
+)
+
+// MaxArg is maximum argument of instruction.
+const MaxArg = 1<<24 - 1
+
+// Instruction is opcode together with its argument, which is index of
+// constant, variable name, procedure or instruction, or count.
+type Instruction uint32
+
+// Code is compiled program or lambda expression. Instructions refer to
+// constants, global variable names, local variables and nested lambda
+// expressions by their indices.
+//
+// Local variables are kept in slots of frame of procedure call, parameters
+// first, and variables of nested procedures are captured by their closures
+// when they are created.
+type Code struct {
+	Name   string    // Name of procedure, empty for anonymous ones and programs
+	Params []string  // Names of required parameters
+	Rest   string    // Name of rest parameter, empty unless procedure is variadic
+	Locals []Local   // Local variables by slots
+	Free   []Capture // Variables of enclosing code closure captures
+
+	Instructions []Instruction
+	Consts       []parser.Sexpr
+	Names        []string
+	Procedures   []*Code
+
+	// Globals are bindings of global variables Names, which machines look up
+	// once and keep until they are stale. They are not written to objects.
+	Globals []atomic.Pointer[GlobalBinding]
+}
+
+// GlobalBinding is binding of global variable in environment of given
+// version. It is stale if code is run in other environment or version of
+// environment changed, as it does when variables are defined. Assignments
+// change value of binding, so they do not make it stale.
+type GlobalBinding struct {
+	Env     *eval.Environment
+	Version uint64
+	Binding *eval.Binding
+}
+
+// Local is local variable of procedure. Variables assigned or initialized
+// after closures capture them are boxed, so closures share them with frame.
+type Local struct {
+	Name  string
+	Boxed bool
+}
+
+// Capture is free variable of procedure, captured from slot Index of frame
+// of enclosing procedure if Local is true, or its free variable Index.
+type Capture struct {
+	Name  string
+	Local bool
+	Index int
+}
+
+var opcodeNames = [...]string{
+	CONST:             "CONST",
+	UNSPECIFIED:       "UNSPECIFIED",
+	REF:               "REF",
+	SET:               "SET",
+	DEFINE:            "DEFINE",
+	LOCAL:             "LOCAL",
+	SET_LOCAL:         "SET_LOCAL",
+	BIND:              "BIND",
+	DECLARE:           "DECLARE",
+	FREE:              "FREE",
+	SET_FREE:          "SET_FREE",
+	POP:               "POP",
+	DUP:               "DUP",
+	SWAP:              "SWAP",
+	JUMP:              "JUMP",
+	JUMP_FALSE:        "JUMP_FALSE",
+	JUMP_TRUE_OR_POP:  "JUMP_TRUE_OR_POP",
+	JUMP_FALSE_OR_POP: "JUMP_FALSE_OR_POP",
+	CLOSURE:           "CLOSURE",
+	CALL:              "CALL",
+	TAIL_CALL:         "TAIL_CALL",
+	RETURN:            "RETURN",
+	MEMV:              "MEMV",
+	CONS:              "CONS",
+	APPEND:            "APPEND",
+	LIST_VECTOR:       "LIST_VECTOR",
+	PROMISE:           "PROMISE",
+	GUARD:             "GUARD",
+	RAISE:             "RAISE",
+}
+
+func (op Opcode) String() string {
+	if int(op) < len(opcodeNames) {
+		return opcodeNames[op]
+	}
+
+	return fmt.Sprintf("Opcode(%d)", op)
+}
+
+// Make returns instruction of op with argument arg, which must not exceed
+// MaxArg.
+func Make(op Opcode, arg int) Instruction {
+	return Instruction(arg)<<8 | Instruction(op)
+}
+
+func (i Instruction) Op() Opcode {
+	return Opcode(i & 0xff)
+}
+
+func (i Instruction) Arg() int {
+	return int(i >> 8)
+}
+
+// initGlobals allocates Globals of code and procedures nested in it.
+func (c *Code) initGlobals() {
+	c.Globals = make([]atomic.Pointer[GlobalBinding], len(c.Names))
+
+	for _, p := range c.Procedures {
+		p.initGlobals()
+	}
+}
+
+// String returns listing of code and procedures nested in it, one
+// instruction per line with its index and meaning of its argument.
+func (c *Code) String() string {
+	var sb strings.Builder
+
+	c.list(&sb, "")
+
+	return sb.String()
+}
+
+func (c *Code) list(sb *strings.Builder, path string) {
+	name := c.Name
+	if name == "" {
+		name = "lambda"
+	}
+
+	if path == "" {
+		sb.WriteString("program\n")
+	} else {
+		fmt.Fprintf(sb, "%s %s %s\n", path, name, c.formals())
+	}
+
+	for i, in := range c.Instructions {
+		switch arg := in.Arg(); in.Op() {
+		case CONST, MEMV:
+			fmt.Fprintf(sb, "%4d  %-17s %d ; %v", i, in.Op(), arg, c.Consts[arg])
+		case REF, SET, DEFINE:
+			fmt.Fprintf(sb, "%4d  %-17s %d ; %s", i, in.Op(), arg, c.Names[arg])
+		case LOCAL, SET_LOCAL, BIND, DECLARE:
+			fmt.Fprintf(sb, "%4d  %-17s %d ; %s", i, in.Op(), arg, c.Locals[arg].Name)
+			if c.Locals[arg].Boxed {
+				sb.WriteString(" (boxed)")
+			}
+		case FREE, SET_FREE:
+			fmt.Fprintf(sb, "%4d  %-17s %d ; %s", i, in.Op(), arg, c.Free[arg].Name)
+		case CLOSURE:
+			fmt.Fprintf(sb, "%4d  %-17s %d ; %s/%d", i, in.Op(), arg, path, arg)
+		case JUMP, JUMP_FALSE, JUMP_TRUE_OR_POP, JUMP_FALSE_OR_POP, CALL, TAIL_CALL, PROMISE, GUARD:
+			fmt.Fprintf(sb, "%4d  %-17s %d", i, in.Op(), arg)
+		default:
+			fmt.Fprintf(sb, "%4d  %s", i, in.Op())
+		}
+
+		sb.WriteString("\n")
+	}
+
+	for i, p := range c.Procedures {
+		p.list(sb, fmt.Sprintf("%s/%d", path, i))
+	}
+}
+
+// formals returns parameters of procedure as they are written in lambda
+// expression.
+func (c *Code) formals() string {
+	switch {
+	case len(c.Params) == 0 && c.Rest != "":
+		return c.Rest
+	case c.Rest != "":
+		return "(" + strings.Join(c.Params, " ") + " . " + c.Rest + ")"
+	default:
+		return "(" + strings.Join(c.Params, " ") + ")"
+	}
+}
@@ -0,0 +1,431 @@
+// Package compile translates programs into bytecode for stack machine of vm
+// package. Programs must have their macros expanded, so they consist of
+// special forms evaluator knows and procedure calls.
+//
+// Variables are resolved when program is compiled: local ones to slots of
+// frames of procedure calls, free ones to variables closures capture, and
+// only global ones are looked up by name in environment program runs in,
+// once until definitions may make them refer to other bindings.
+//
+// Unlike evaluator, compiler checks syntax of whole program before it runs,
+// so malformed special forms are reported even if they would never be
+// evaluated. Definitions in procedures are allowed only in their bodies, and
+// they are all in scope of whole body.
+package compile
+
+import (
+	"errors"
+	"fmt"
+	"github.com/vkhonin/scheme/eval"
+	"github.com/vkhonin/scheme/parser"
+	"slices"
+)
+
+var (
+	TOO_LARGE = errors.New("code too large")
+)
+
+type compiler struct {
+	code  *Code
+	names map[string]int
+
+	outer  *compiler         // Compiler of enclosing procedure, nil for program
+	bodies int               // Depth of bodies being compiled
+	scope  []*variable       // Local variables in scope, innermost last
+	locals []*variable       // Local variables by slots
+	free   map[*variable]int // Indices of captured variables in Free
+}
+
+// variable is local variable bound by lambda expression, let-like form or
+// internal definition.
+type variable struct {
+	name     string
+	slot     int
+	captured bool // Referred to by nested procedures
+	assigned bool // Assigned by set! or definition
+	declared bool // Bound before it is initialized, by letrec or definition
+}
+
+// Program returns code of program, which evaluates its data in order in
+// environment it is run in and returns value of the last one. Code is
+// optimized unless opts disable it. It reports eval.BAD_SYNTAX for malformed
+// special forms.
+func Program(program []parser.Sexpr, opts Options) (*Code, error) {
+	c := newCompiler(&Code{}, nil)
+
+	if err := c.sequence(program, false); err != nil {
+		return nil, err
+	}
+	c.emit(RETURN, 0)
+
+	code, err := c.finish()
+	if err != nil {
+		return nil, err
+	}
+
+	if !opts.NoOptimize {
+		optimize(code, opts)
+	}
+	code.initGlobals()
+
+	return code, nil
+}
+
+func newCompiler(code *Code, outer *compiler) *compiler {
+	return &compiler{code: code, names: make(map[string]int), outer: outer, free: make(map[*variable]int)}
+}
+
+// finish returns compiled code, or TOO_LARGE if its instruction arguments do
+// not fit. Local variables captured by closures are boxed if they may change
+// after they are captured.
+func (c *compiler) finish() (*Code, error) {
+	if max(len(c.code.Instructions), len(c.code.Consts), len(c.code.Names), len(c.code.Procedures), len(c.locals), len(c.code.Free)) > MaxArg {
+		return nil, TOO_LARGE
+	}
+
+	c.code.Locals = make([]Local, len(c.locals))
+	for i, v := range c.locals {
+		c.code.Locals[i] = Local{Name: v.name, Boxed: v.captured && (v.assigned || v.declared)}
+	}
+
+	return c.code, nil
+}
+
+// emit appends instruction and returns its index.
+func (c *compiler) emit(op Opcode, arg int) int {
+	c.code.Instructions = append(c.code.Instructions, Make(op, arg))
+	return len(c.code.Instructions) - 1
+}
+
+// label returns index of next instruction, which jumps may target.
+func (c *compiler) label() int {
+	return len(c.code.Instructions)
+}
+
+// patch makes jump at index continue at target.
+func (c *compiler) patch(at, target int) {
+	c.code.Instructions[at] = Make(c.code.Instructions[at].Op(), target)
+}
+
+func (c *compiler) constant(datum parser.Sexpr) {
+	c.code.Consts = append(c.code.Consts, datum)
+	c.emit(CONST, len(c.code.Consts)-1)
+}
+
+// name returns index of global variable name.
+func (c *compiler) name(name string) int {
+	i, ok := c.names[name]
+	if !ok {
+		i = len(c.code.Names)
+		c.names[name] = i
+		c.code.Names = append(c.code.Names, name)
+	}
+
+	return i
+}
+
+// bind adds local variable in new slot to scope.
+func (c *compiler) bind(name string) *variable {
+	v := &variable{name: name, slot: len(c.locals)}
+	c.locals = append(c.locals, v)
+	c.scope = append(c.scope, v)
+
+	return v
+}
+
+// resolve returns variable name refers to, together with its slot if it is
+// local to c, or its index in Free. Variables of enclosing procedures are
+// captured by closure of c and of procedures in between. It returns nil for
+// global variables.
+func (c *compiler) resolve(name string) (v *variable, local bool, index int) {
+	for i := len(c.scope) - 1; i >= 0; i-- {
+		if c.scope[i].name == name {
+			return c.scope[i], true, c.scope[i].slot
+		}
+	}
+
+	if c.outer == nil {
+		return nil, false, 0
+	}
+
+	v, local, index = c.outer.resolve(name)
+	if v == nil {
+		return nil, false, 0
+	}
+	v.captured = true
+
+	i, ok := c.free[v]
+	if !ok {
+		i = len(c.code.Free)
+		c.free[v] = i
+		c.code.Free = append(c.code.Free, Capture{Name: name, Local: local, Index: index})
+	}
+
+	return v, false, i
+}
+
+// ref emits instruction pushing value of variable name.
+func (c *compiler) ref(name string) {
+	switch v, local, i := c.resolve(name); {
+	case v == nil:
+		c.emit(REF, c.name(name))
+	case local:
+		c.emit(LOCAL, i)
+	default:
+		c.emit(FREE, i)
+	}
+}
+
+// assign emits instruction assigning value on top to variable name.
+func (c *compiler) assign(name string) {
+	v, local, i := c.resolve(name)
+	switch {
+	case v == nil:
+		c.emit(SET, c.name(name))
+		return
+	case local:
+		c.emit(SET_LOCAL, i)
+	default:
+		c.emit(SET_FREE, i)
+	}
+	v.assigned = true
+}
+
+// expr compiles expression, which pushes its value. Calls in tail position
+// replace frame of procedure they are in.
+func (c *compiler) expr(expr parser.Sexpr, tail bool) error {
+	switch e := expr.(type) {
+	case *parser.Atom:
+		if name, ok := symbolName(e); ok {
+			c.ref(name)
+			return nil
+		}
+	case *parser.Expr:
+		if isNull(e) {
+			return fmt.Errorf("%w: empty combination", eval.BAD_SYNTAX)
+		}
+
+		operands, ok := list(e.Cdr)
+
+		if name, isName := symbolName(e.Car); isName {
+			if form, isForm := forms[name]; isForm {
+				if !ok {
+					return fmt.Errorf("%w: %s", eval.BAD_SYNTAX, name)
+				}
+				return form(c, operands, tail)
+			}
+		}
+
+		if !ok {
+			return fmt.Errorf("%w: improper combination", eval.BAD_SYNTAX)
+		}
+
+		return c.call(e.Car, operands, tail)
+	}
+
+	c.constant(expr)
+
+	return nil
+}
+
+// call compiles call of procedure expression with operands.
+func (c *compiler) call(procedure parser.Sexpr, operands []parser.Sexpr, tail bool) error {
+	if err := c.expr(procedure, false); err != nil {
+		return err
+	}
+
+	for _, operand := range operands {
+		if err := c.expr(operand, false); err != nil {
+			return err
+		}
+	}
+
+	c.emitCall(len(operands), tail)
+
+	return nil
+}
+
+// emitCall emits call with n arguments. Tail call is followed by return,
+// which returns value of procedure that does not replace frame, e.g. builtin.
+func (c *compiler) emitCall(n int, tail bool) {
+	if !tail {
+		c.emit(CALL, n)
+		return
+	}
+
+	c.emit(TAIL_CALL, n)
+	c.emit(RETURN, 0)
+}
+
+// sequence compiles expressions, which push value of the last one, or
+// unspecified value if there are none.
+func (c *compiler) sequence(exprs []parser.Sexpr, tail bool) error {
+	if len(exprs) == 0 {
+		c.emit(UNSPECIFIED, 0)
+		return nil
+	}
+
+	for _, expr := range exprs[:len(exprs)-1] {
+		if err := c.expr(expr, false); err != nil {
+			return err
+		}
+		c.emit(POP, 0)
+	}
+
+	return c.expr(exprs[len(exprs)-1], tail)
+}
+
+// body compiles body of lambda or let-like form in new scope. Variables of
+// its definitions, including those inside begin, are declared first, which
+// gives them letrec* semantics.
+func (c *compiler) body(body []parser.Sexpr, tail bool) error {
+	body = flattenBegin(body)
+	mark := len(c.scope)
+	c.bodies++
+
+	for _, expr := range body {
+		if name, _, ok := definition(expr); ok {
+			v := c.bind(name)
+			v.declared = true
+			c.emit(DECLARE, v.slot)
+		}
+	}
+
+	for i, expr := range body {
+		if i > 0 {
+			c.emit(POP, 0)
+		}
+
+		var err error
+		if _, _, ok := definition(expr); ok {
+			err = c.define(expr.(*parser.Expr))
+		} else {
+			err = c.expr(expr, tail && i == len(body)-1)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(body) == 0 {
+		c.emit(UNSPECIFIED, 0)
+	}
+
+	c.scope = c.scope[:mark]
+	c.bodies--
+
+	return nil
+}
+
+// flattenBegin returns body with begin forms replaced by their operands.
+func flattenBegin(body []parser.Sexpr) []parser.Sexpr {
+	var flat []parser.Sexpr
+
+	for _, expr := range body {
+		if form, ok := expr.(*parser.Expr); ok && !isNull(form) && isSymbol(form.Car, "begin") {
+			if nested, ok := list(form.Cdr); ok {
+				flat = append(flat, flattenBegin(nested)...)
+				continue
+			}
+		}
+		flat = append(flat, expr)
+	}
+
+	return flat
+}
+
+// definition reports whether expr is define form, returning name it defines
+// and expression of value, which is lambda expression for procedure
+// definitions.
+func definition(expr parser.Sexpr) (string, parser.Sexpr, bool) {
+	form, ok := expr.(*parser.Expr)
+	if !ok || isNull(form) || !isSymbol(form.Car, "define") {
+		return "", nil, false
+	}
+
+	operands, ok := list(form.Cdr)
+	if !ok || len(operands) < 2 {
+		return "", nil, false
+	}
+
+	// (define (name . formals) body ...)
+	if target, ok := operands[0].(*parser.Expr); ok && !isNull(target) {
+		name, ok := symbolName(target.Car)
+		lambda := parser.Cons(parser.Symbol("lambda"), parser.Cons(target.Cdr, parser.List(operands[1:]...)))
+		return name, lambda, ok
+	}
+
+	name, ok := symbolName(operands[0])
+	if !ok || len(operands) != 2 {
+		return "", nil, false
+	}
+
+	return name, operands[1], true
+}
+
+// lambda compiles lambda expression with formals and body, which pushes
+// closure named name.
+func (c *compiler) lambda(name string, formals parser.Sexpr, body []parser.Sexpr) error {
+	p := newCompiler(&Code{Name: name}, c)
+
+	for !isNull(formals) {
+		datum := formals
+		pair, isPair := formals.(*parser.Expr)
+		if isPair {
+			datum = pair.Car
+		}
+
+		param, ok := symbolName(datum)
+		if !ok || slices.ContainsFunc(p.scope, func(v *variable) bool { return v.name == param }) {
+			return fmt.Errorf("%w: invalid lambda formals", eval.BAD_SYNTAX)
+		}
+		p.bind(param)
+
+		if !isPair {
+			p.code.Rest = param
+			break
+		}
+
+		p.code.Params = append(p.code.Params, param)
+		formals = pair.Cdr
+	}
+
+	if err := p.body(body, true); err != nil {
+		return err
+	}
+	p.emit(RETURN, 0)
+
+	code, err := p.finish()
+	if err != nil {
+		return err
+	}
+
+	c.code.Procedures = append(c.code.Procedures, code)
+	c.emit(CLOSURE, len(c.code.Procedures)-1)
+
+	return nil
+}
+
+// list returns elements of proper list s, reporting whether it is one.
+func list(s parser.Sexpr) ([]parser.Sexpr, bool) {
+	items, err := parser.ToSlice(s)
+	return items, err == nil
+}
+
+func isNull(s parser.Sexpr) bool {
+	e, ok := s.(*parser.Expr)
+	return ok && e.Car == nil && e.Cdr == nil
+}
+
+func isSymbol(s parser.Sexpr, name string) bool {
+	n, ok := symbolName(s)
+	return ok && n == name
+}
+
+func symbolName(s parser.Sexpr) (string, bool) {
+	if a, ok := s.(*parser.Atom); ok && a.Type == parser.SYMBOL {
+		return (a.Value).(string), true
+	}
+
+	return "", false
+}
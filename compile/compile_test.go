@@ -0,0 +1,385 @@
+package compile_test
+
+import (
+	"errors"
+	"github.com/vkhonin/scheme/compile"
+	"github.com/vkhonin/scheme/eval"
+	"github.com/vkhonin/scheme/parser"
+	"strings"
+	"testing"
+)
+
+func TestProgram(t *testing.T) {
+	testCases := []struct {
+		Input   string
+		Listing string
+	}{
+		{"", `
+program
+   0  UNSPECIFIED
+   1  RETURN
+`},
+		{"(define (f x) (if (< x 1) x (f (- x 1))))", `
+program
+   0  CLOSURE           0 ; /0
+   1  DEFINE            0 ; f
+   2  UNSPECIFIED
+   3  RETURN
+/0 f (x)
+   0  REF               0 ; <
+   1  LOCAL             0 ; x
+   2  CONST             0 ; 1
+   3  CALL              2
+   4  JUMP_FALSE        7
+   5  LOCAL             0 ; x
+   6  JUMP              14
+   7  REF               1 ; f
+   8  REF               2 ; -
+   9  LOCAL             0 ; x
+  10  CONST             1 ; 1
+  11  CALL              2
+  12  TAIL_CALL         1
+  13  RETURN
+  14  RETURN
+`},
+		{"(let loop ((i 0)) (loop i)) (lambda args (or))", `
+program
+   0  DECLARE           0 ; loop (boxed)
+   1  CLOSURE           0 ; /0
+   2  SET_LOCAL         0 ; loop (boxed)
+   3  LOCAL             0 ; loop (boxed)
+   4  CONST             0 ; 0
+   5  CALL              1
+   6  POP
+   7  CLOSURE           1 ; /1
+   8  RETURN
+/0 loop (i)
+   0  FREE              0 ; loop
+   1  LOCAL             0 ; i
+   2  TAIL_CALL         1
+   3  RETURN
+   4  RETURN
+/1 lambda args
+   0  CONST             0 ; #f
+   1  RETURN
+`},
+		{"`(a ,b c) `(a (b) ,'c)", `
+program
+   0  CONST             0 ; a
+   1  REF               0 ; b
+   2  CONST             1 ; c
+   3  CONST             2 ; ()
+   4  CONS
+   5  CONS
+   6  CONS
+   7  POP
+   8  CONST             3 ; a
+   9  CONST             4 ; (b)
+  10  CONST             5 ; c
+  11  CONST             6 ; ()
+  12  CONS
+  13  CONS
+  14  CONS
+  15  RETURN
+`},
+		{"(case x ((1 2) 'a))", `
+program
+   0  REF               0 ; x
+   1  MEMV              0 ; (1 2)
+   2  JUMP_FALSE        6
+   3  POP
+   4  CONST             1 ; a
+   5  JUMP              8
+   6  POP
+   7  UNSPECIFIED
+   8  RETURN
+`},
+		{"(define (counter) (let ((n 0)) (lambda () (set! n (+ n 1)) n)))", `
+program
+   0  CLOSURE           0 ; /0
+   1  DEFINE            0 ; counter
+   2  UNSPECIFIED
+   3  RETURN
+/0 counter ()
+   0  CONST             0 ; 0
+   1  BIND              0 ; n (boxed)
+   2  CLOSURE           0 ; /0/0
+   3  RETURN
+/0/0 lambda ()
+   0  REF               0 ; +
+   1  FREE              0 ; n
+   2  CONST             0 ; 1
+   3  CALL              2
+   4  SET_FREE          0 ; n
+   5  UNSPECIFIED
+   6  POP
+   7  FREE              0 ; n
+   8  RETURN
+`},
+		{"(lambda (a b) (define (g) (lambda () (list a g))) (let ((a b)) a))", `
+program
+   0  CLOSURE           0 ; /0
+   1  RETURN
+/0 lambda (a b)
+   0  DECLARE           2 ; g (boxed)
+   1  CLOSURE           0 ; /0/0
+   2  SET_LOCAL         2 ; g (boxed)
+   3  UNSPECIFIED
+   4  POP
+   5  LOCAL             1 ; b
+   6  BIND              3 ; a
+   7  LOCAL             3 ; a
+   8  RETURN
+/0/0 g ()
+   0  CLOSURE           0 ; /0/0/0
+   1  RETURN
+/0/0/0 lambda ()
+   0  REF               0 ; list
+   1  FREE              0 ; a
+   2  FREE              1 ; g
+   3  TAIL_CALL         2
+   4  RETURN
+`},
+	}
+
+	for _, c := range testCases {
+		program, err := parser.ParseString(c.Input)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		code, err := compile.Program(program, compile.Options{NoOptimize: true})
+		if err != nil {
+			t.Errorf("unexpected error %v for %s", err, c.Input)
+			continue
+		}
+
+		if listing := "\n" + code.String(); !strings.HasPrefix(listing, c.Listing) {
+			t.Errorf("expected listing%s\ngot%s\nfor %s", c.Listing, listing, c.Input)
+		}
+	}
+}
+
+func TestProgram_Optimize(t *testing.T) {
+	testCases := []struct {
+		Input   string
+		Listing string
+	}{
+		{"(+ 1 (* 2 3))", `
+program
+   0  REF               0 ; +
+   1  CONST             0 ; 1
+   2  REF               1 ; *
+   3  CONST             1 ; 2
+   4  CONST             2 ; 3
+   5  CALL              2
+   6  CALL              2
+   7  RETURN
+`},
+		{"(cond (#f 'a) (0 'b) (else 'c))", `
+program
+   0  CONST             0 ; b
+   1  RETURN
+`},
+		{"(list (and 1 #f x) (or #f #f x))", `
+program
+   0  REF               0 ; list
+   1  CONST             0 ; #f
+   2  REF               1 ; x
+   3  CALL              2
+   4  RETURN
+`},
+		{"(begin 1 2 (f) 'a) (when 1 (f))", `
+program
+   0  REF               0 ; f
+   1  CALL              0
+   2  POP
+   3  REF               0 ; f
+   4  CALL              0
+   5  RETURN
+`},
+		{"(define (f x) (if #t (g x) (h x)))", `
+program
+   0  CLOSURE           0 ; /0
+   1  DEFINE            0 ; f
+   2  UNSPECIFIED
+   3  RETURN
+/0 f (x)
+   0  REF               0 ; g
+   1  LOCAL             0 ; x
+   2  TAIL_CALL         1
+   3  RETURN
+`},
+		{"(define (f) (if #f (lambda () 1) (lambda () 2)))", `
+program
+   0  CLOSURE           0 ; /0
+   1  DEFINE            0 ; f
+   2  UNSPECIFIED
+   3  RETURN
+/0 f ()
+   0  CLOSURE           0 ; /0/0
+   1  RETURN
+/0/0 lambda ()
+   0  CONST             0 ; 2
+   1  RETURN
+`},
+		{"(/ 1 0)", `
+program
+   0  REF               0 ; /
+   1  CONST             0 ; 1
+   2  CONST             1 ; 0
+   3  CALL              2
+   4  RETURN
+`},
+		{"(define (+ a b) 0) (+ 1 2)", `
+program
+   0  CLOSURE           0 ; /0
+   1  DEFINE            0 ; +
+   2  REF               0 ; +
+   3  CONST             0 ; 1
+   4  CONST             1 ; 2
+   5  CALL              2
+   6  RETURN
+`},
+		{"(lambda (-) (- 1))", `
+program
+   0  CLOSURE           0 ; /0
+   1  RETURN
+/0 lambda (-)
+   0  LOCAL             0 ; -
+   1  CONST             0 ; 1
+   2  TAIL_CALL         1
+   3  RETURN
+`},
+	}
+
+	for _, c := range testCases {
+		program, err := parser.ParseString(c.Input)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		code, err := compile.Program(program, compile.Options{})
+		if err != nil {
+			t.Errorf("unexpected error %v for %s", err, c.Input)
+			continue
+		}
+
+		if listing := "\n" + code.String(); !strings.HasPrefix(listing, c.Listing) {
+			t.Errorf("expected listing%s\ngot%s\nfor %s", c.Listing, listing, c.Input)
+		}
+	}
+}
+
+func TestProgram_FoldCalls(t *testing.T) {
+	redefined := eval.NewStandardEnvironment()
+	redefined.Define("*", eval.Unspecified)
+
+	testCases := []struct {
+		Input   string
+		Env     *eval.Environment
+		Listing string
+	}{
+		{"(+ 1 (* 2 3))", nil, `
+program
+   0  CONST             0 ; 7
+   1  RETURN
+`},
+		{"(cond ((= 1 2) 'a) ((zero? 0) 'b) (else 'c))", nil, `
+program
+   0  CONST             0 ; b
+   1  RETURN
+`},
+		{"(list (and 1 (> 2 3) x) (or #f (not 1) x))", nil, `
+program
+   0  REF               0 ; list
+   1  CONST             0 ; #f
+   2  REF               1 ; x
+   3  CALL              2
+   4  RETURN
+`},
+		{"(/ 1 0)", nil, `
+program
+   0  REF               0 ; /
+   1  CONST             0 ; 1
+   2  CONST             1 ; 0
+   3  CALL              2
+   4  RETURN
+`},
+		{"(define (+ a b) 0) (+ 1 2)", nil, `
+program
+   0  CLOSURE           0 ; /0
+   1  DEFINE            0 ; +
+   2  REF               0 ; +
+   3  CONST             0 ; 1
+   4  CONST             1 ; 2
+   5  CALL              2
+   6  RETURN
+`},
+		{"(lambda () (set! - +)) (- 1)", nil, `
+program
+   0  REF               0 ; -
+   1  CONST             0 ; 1
+   2  CALL              1
+   3  RETURN
+`},
+		{"(+ 1 (* 2 3))", redefined, `
+program
+   0  REF               0 ; +
+   1  CONST             0 ; 1
+   2  REF               1 ; *
+   3  CONST             1 ; 2
+   4  CONST             2 ; 3
+   5  CALL              2
+   6  CALL              2
+   7  RETURN
+`},
+	}
+
+	for _, c := range testCases {
+		program, err := parser.ParseString(c.Input)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		code, err := compile.Program(program, compile.Options{FoldCalls: true, Env: c.Env})
+		if err != nil {
+			t.Errorf("unexpected error %v for %s", err, c.Input)
+			continue
+		}
+
+		if listing := "\n" + code.String(); !strings.HasPrefix(listing, c.Listing) {
+			t.Errorf("expected listing%s\ngot%s\nfor %s", c.Listing, listing, c.Input)
+		}
+	}
+}
+
+func TestProgram_Errors(t *testing.T) {
+	for _, input := range []string{
+		"()", "(f . x)", "(if)", "(if #f (quote))", "(lambda (x x) x)", "(define)", "(define 1 2)",
+		"(set! 1 2)", "(let ((x)) x)", "(let loop)", "(letrec ((x 1) (x 2)) x)", "(cond ())",
+		"(cond (else 1) (#t 2))", "(cond (1 => f g))", "(case)", "(case 1 (1 2))", "(case 1 (else 1) ((1) 2))",
+		"(do ((i 0 1 2)) (#t))", "(do () ())", "(delay)", "(guard (1) 1)", "(guard () 1)", "`,@x", "(quasiquote)",
+		"(when #t)", "(begin . 1)", "(lambda () (if #t (define x 1)))", "(let ((x 1)) (when x (define y 2)))",
+	} {
+		program, err := parser.ParseString(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := compile.Program(program, compile.Options{}); !errors.Is(err, eval.BAD_SYNTAX) {
+			t.Errorf("expected bad syntax got %v for %s", err, input)
+		}
+	}
+}
+
+func TestProgram_Forms(t *testing.T) {
+	valid := map[string]bool{"and": true, "or": true, "begin": true, "cond": true}
+
+	for _, keyword := range eval.SpecialForms() {
+		_, err := compile.Program([]parser.Sexpr{parser.List(parser.Symbol(keyword))}, compile.Options{})
+		if valid[keyword] != (err == nil) {
+			t.Errorf("unexpected error %v for (%s)", err, keyword)
+		}
+	}
+}
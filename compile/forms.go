@@ -0,0 +1,704 @@
+package compile
+
+import (
+	"fmt"
+	"github.com/vkhonin/scheme/eval"
+	"github.com/vkhonin/scheme/parser"
+	"slices"
+)
+
+// form compiles special form with operands.
+type form func(c *compiler, operands []parser.Sexpr, tail bool) error
+
+var forms map[string]form
+
+func init() {
+	forms = map[string]form{
+		"and":         compileAnd,
+		"begin":       compileBegin,
+		"case":        compileCase,
+		"cond":        compileCond,
+		"define":      compileDefine,
+		"delay":       compileDelay,
+		"delay-force": compileDelayForce,
+		"do":          compileDo,
+		"guard":       compileGuard,
+		"if":          compileIf,
+		"lambda":      compileLambda,
+		"let":         compileLet,
+		"let*":        compileLetStar,
+		"letrec":      compileLetrec,
+		"letrec*":     compileLetrec,
+		"or":          compileOr,
+		"quasiquote":  compileQuasiquote,
+		"quote":       compileQuote,
+		"set!":        compileSet,
+		"unless":      compileUnless,
+		"when":        compileWhen,
+	}
+}
+
+func compileQuote(c *compiler, operands []parser.Sexpr, _ bool) error {
+	if len(operands) != 1 {
+		return fmt.Errorf("%w: quote", eval.BAD_SYNTAX)
+	}
+
+	c.constant(operands[0])
+
+	return nil
+}
+
+func compileLambda(c *compiler, operands []parser.Sexpr, _ bool) error {
+	if len(operands) < 2 {
+		return fmt.Errorf("%w: lambda", eval.BAD_SYNTAX)
+	}
+
+	return c.lambda("", operands[0], operands[1:])
+}
+
+// value compiles expression, value of which variable name is bound to.
+// Closure of lambda expression gets that name.
+func (c *compiler) value(name string, expr parser.Sexpr) error {
+	if form, ok := expr.(*parser.Expr); ok && !isNull(form) && isSymbol(form.Car, "lambda") {
+		if operands, ok := list(form.Cdr); ok && len(operands) >= 2 {
+			return c.lambda(name, operands[0], operands[1:])
+		}
+	}
+
+	return c.expr(expr, false)
+}
+
+// compileDefine compiles definition outside of bodies, which binds global
+// variable. Bodies compile their definitions themselves.
+func compileDefine(c *compiler, operands []parser.Sexpr, _ bool) error {
+	name, value, ok := definition(parser.Cons(parser.Symbol("define"), parser.List(operands...)))
+	if !ok {
+		return fmt.Errorf("%w: define", eval.BAD_SYNTAX)
+	}
+	if c.outer != nil || c.bodies > 0 {
+		return fmt.Errorf("%w: definition of %s outside of body", eval.BAD_SYNTAX, name)
+	}
+
+	if err := c.value(name, value); err != nil {
+		return err
+	}
+	c.emit(DEFINE, c.name(name))
+	c.emit(UNSPECIFIED, 0)
+
+	return nil
+}
+
+// define compiles internal definition of variable body has declared.
+func (c *compiler) define(form *parser.Expr) error {
+	name, value, _ := definition(form)
+
+	if err := c.value(name, value); err != nil {
+		return err
+	}
+	c.assign(name)
+	c.emit(UNSPECIFIED, 0)
+
+	return nil
+}
+
+func compileSet(c *compiler, operands []parser.Sexpr, _ bool) error {
+	if len(operands) != 2 {
+		return fmt.Errorf("%w: set!", eval.BAD_SYNTAX)
+	}
+
+	name, ok := symbolName(operands[0])
+	if !ok {
+		return fmt.Errorf("%w: set!", eval.BAD_SYNTAX)
+	}
+
+	if err := c.expr(operands[1], false); err != nil {
+		return err
+	}
+	c.assign(name)
+	c.emit(UNSPECIFIED, 0)
+
+	return nil
+}
+
+func compileBegin(c *compiler, operands []parser.Sexpr, tail bool) error {
+	return c.sequence(operands, tail)
+}
+
+func compileIf(c *compiler, operands []parser.Sexpr, tail bool) error {
+	if len(operands) < 2 || len(operands) > 3 {
+		return fmt.Errorf("%w: if", eval.BAD_SYNTAX)
+	}
+
+	if err := c.expr(operands[0], false); err != nil {
+		return err
+	}
+	alternative := c.emit(JUMP_FALSE, 0)
+
+	if err := c.expr(operands[1], tail); err != nil {
+		return err
+	}
+	end := c.emit(JUMP, 0)
+
+	c.patch(alternative, c.label())
+	if len(operands) == 3 {
+		if err := c.expr(operands[2], tail); err != nil {
+			return err
+		}
+	} else {
+		c.emit(UNSPECIFIED, 0)
+	}
+	c.patch(end, c.label())
+
+	return nil
+}
+
+func compileWhen(c *compiler, operands []parser.Sexpr, tail bool) error {
+	return compileWhenUnless(c, operands, tail, true)
+}
+
+func compileUnless(c *compiler, operands []parser.Sexpr, tail bool) error {
+	return compileWhenUnless(c, operands, tail, false)
+}
+
+func compileWhenUnless(c *compiler, operands []parser.Sexpr, tail bool, when bool) error {
+	if len(operands) < 2 {
+		return fmt.Errorf("%w: when/unless", eval.BAD_SYNTAX)
+	}
+
+	if err := c.expr(operands[0], false); err != nil {
+		return err
+	}
+	skip := c.emit(JUMP_FALSE, 0)
+
+	if !when {
+		c.emit(UNSPECIFIED, 0)
+		end := c.emit(JUMP, 0)
+		c.patch(skip, c.label())
+		if err := c.sequence(operands[1:], tail); err != nil {
+			return err
+		}
+		c.patch(end, c.label())
+		return nil
+	}
+
+	if err := c.sequence(operands[1:], tail); err != nil {
+		return err
+	}
+	end := c.emit(JUMP, 0)
+	c.patch(skip, c.label())
+	c.emit(UNSPECIFIED, 0)
+	c.patch(end, c.label())
+
+	return nil
+}
+
+func compileAnd(c *compiler, operands []parser.Sexpr, tail bool) error {
+	return compileAndOr(c, operands, tail, true)
+}
+
+func compileOr(c *compiler, operands []parser.Sexpr, tail bool) error {
+	return compileAndOr(c, operands, tail, false)
+}
+
+// compileAndOr compiles operands, evaluation of which stops at first false
+// (and) or true (or) one. Last operand is in tail position.
+func compileAndOr(c *compiler, operands []parser.Sexpr, tail bool, and bool) error {
+	if len(operands) == 0 {
+		c.constant(parser.Bool(and))
+		return nil
+	}
+
+	op := JUMP_TRUE_OR_POP
+	if and {
+		op = JUMP_FALSE_OR_POP
+	}
+
+	var jumps []int
+	for _, operand := range operands[:len(operands)-1] {
+		if err := c.expr(operand, false); err != nil {
+			return err
+		}
+		jumps = append(jumps, c.emit(op, 0))
+	}
+
+	if err := c.expr(operands[len(operands)-1], tail); err != nil {
+		return err
+	}
+
+	for _, jump := range jumps {
+		c.patch(jump, c.label())
+	}
+
+	return nil
+}
+
+func compileCond(c *compiler, operands []parser.Sexpr, tail bool) error {
+	return c.clauses(operands, tail, func() {
+		c.emit(UNSPECIFIED, 0)
+	})
+}
+
+// clauses compiles cond clauses. Unless there is else clause, otherwise
+// is compiled after them for the case none of them is selected.
+func (c *compiler) clauses(clauses []parser.Sexpr, tail bool, otherwise func()) error {
+	var ends []int
+
+	for i, cl := range clauses {
+		clause, ok := list(cl)
+		if !ok || len(clause) == 0 {
+			return fmt.Errorf("%w: cond clause", eval.BAD_SYNTAX)
+		}
+
+		if isSymbol(clause[0], "else") {
+			if i != len(clauses)-1 || len(clause) == 1 {
+				return fmt.Errorf("%w: cond else clause", eval.BAD_SYNTAX)
+			}
+			if err := c.sequence(clause[1:], tail); err != nil {
+				return err
+			}
+			otherwise = nil
+			break
+		}
+
+		if err := c.expr(clause[0], false); err != nil {
+			return err
+		}
+
+		body := clause[1:]
+		switch {
+		case len(body) == 0:
+			ends = append(ends, c.emit(JUMP_TRUE_OR_POP, 0))
+		case isSymbol(body[0], "=>"):
+			c.emit(DUP, 0)
+			next := c.emit(JUMP_FALSE, 0)
+			if err := c.receiver(body, tail); err != nil {
+				return err
+			}
+			ends = append(ends, c.emit(JUMP, 0))
+			c.patch(next, c.label())
+			c.emit(POP, 0)
+		default:
+			next := c.emit(JUMP_FALSE, 0)
+			if err := c.sequence(body, tail); err != nil {
+				return err
+			}
+			ends = append(ends, c.emit(JUMP, 0))
+			c.patch(next, c.label())
+		}
+	}
+
+	if otherwise != nil {
+		otherwise()
+	}
+
+	for _, end := range ends {
+		c.patch(end, c.label())
+	}
+
+	return nil
+}
+
+// receiver compiles "=> receiver" clause body, which calls receiver with
+// value on top.
+func (c *compiler) receiver(body []parser.Sexpr, tail bool) error {
+	if len(body) != 2 {
+		return fmt.Errorf("%w: => clause", eval.BAD_SYNTAX)
+	}
+
+	if err := c.expr(body[1], false); err != nil {
+		return err
+	}
+	c.emit(SWAP, 0)
+	c.emitCall(1, tail)
+
+	return nil
+}
+
+func compileCase(c *compiler, operands []parser.Sexpr, tail bool) error {
+	if len(operands) < 1 {
+		return fmt.Errorf("%w: case", eval.BAD_SYNTAX)
+	}
+
+	if err := c.expr(operands[0], false); err != nil {
+		return err
+	}
+
+	var ends []int
+	hasElse := false
+
+	for i, cl := range operands[1:] {
+		clause, ok := list(cl)
+		if !ok || len(clause) < 2 {
+			return fmt.Errorf("%w: case clause", eval.BAD_SYNTAX)
+		}
+
+		if isSymbol(clause[0], "else") {
+			if i != len(operands)-2 {
+				return fmt.Errorf("%w: case else clause", eval.BAD_SYNTAX)
+			}
+			if err := c.caseBody(clause[1:], tail); err != nil {
+				return err
+			}
+			hasElse = true
+			break
+		}
+
+		if _, ok := list(clause[0]); !ok {
+			return fmt.Errorf("%w: case clause data", eval.BAD_SYNTAX)
+		}
+
+		c.code.Consts = append(c.code.Consts, clause[0])
+		c.emit(MEMV, len(c.code.Consts)-1)
+		next := c.emit(JUMP_FALSE, 0)
+		if err := c.caseBody(clause[1:], tail); err != nil {
+			return err
+		}
+		ends = append(ends, c.emit(JUMP, 0))
+		c.patch(next, c.label())
+	}
+
+	if !hasElse {
+		c.emit(POP, 0)
+		c.emit(UNSPECIFIED, 0)
+	}
+
+	for _, end := range ends {
+		c.patch(end, c.label())
+	}
+
+	return nil
+}
+
+// caseBody compiles body of case clause selected by key on top.
+func (c *compiler) caseBody(body []parser.Sexpr, tail bool) error {
+	if isSymbol(body[0], "=>") {
+		return c.receiver(body, tail)
+	}
+
+	c.emit(POP, 0)
+
+	return c.sequence(body, tail)
+}
+
+// binding is variable bound by let-like form to value of init.
+type binding struct {
+	name string
+	init parser.Sexpr
+}
+
+// bindings returns bindings and body of let-like form. Duplicate names are
+// rejected except for let*.
+func bindings(operands []parser.Sexpr, form string) ([]binding, []parser.Sexpr, error) {
+	if len(operands) < 2 {
+		return nil, nil, fmt.Errorf("%w: %s", eval.BAD_SYNTAX, form)
+	}
+
+	specs, ok := list(operands[0])
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: %s bindings", eval.BAD_SYNTAX, form)
+	}
+
+	bs := make([]binding, len(specs))
+	seen := make(map[string]bool)
+
+	for i, s := range specs {
+		spec, ok := list(s)
+		if !ok || len(spec) != 2 {
+			return nil, nil, fmt.Errorf("%w: %s binding", eval.BAD_SYNTAX, form)
+		}
+
+		name, ok := symbolName(spec[0])
+		if !ok || (seen[name] && form != "let*") {
+			return nil, nil, fmt.Errorf("%w: %s binding", eval.BAD_SYNTAX, form)
+		}
+		seen[name] = true
+
+		bs[i] = binding{name, spec[1]}
+	}
+
+	return bs, operands[1:], nil
+}
+
+// bindAll binds new local variables of bs to values on top.
+func (c *compiler) bindAll(bs []binding) {
+	vs := make([]*variable, len(bs))
+	for i, b := range bs {
+		vs[i] = c.bind(b.name)
+	}
+
+	for i := len(vs) - 1; i >= 0; i-- {
+		c.emit(BIND, vs[i].slot)
+	}
+}
+
+func compileLet(c *compiler, operands []parser.Sexpr, tail bool) error {
+	if len(operands) > 0 {
+		if name, ok := symbolName(operands[0]); ok {
+			return compileNamedLet(c, name, operands[1:], tail)
+		}
+	}
+
+	bs, body, err := bindings(operands, "let")
+	if err != nil {
+		return err
+	}
+
+	for _, b := range bs {
+		if err := c.expr(b.init, false); err != nil {
+			return err
+		}
+	}
+
+	mark := len(c.scope)
+	c.bindAll(bs)
+	if err := c.body(body, tail); err != nil {
+		return err
+	}
+	c.scope = c.scope[:mark]
+
+	return nil
+}
+
+// compileNamedLet compiles named let, which binds name to procedure with let
+// variables as parameters and body as body in scope of body itself, then
+// calls it with initial values evaluated outside of that scope.
+func compileNamedLet(c *compiler, name string, operands []parser.Sexpr, tail bool) error {
+	bs, body, err := bindings(operands, "named let")
+	if err != nil {
+		return err
+	}
+
+	formals := make([]parser.Sexpr, len(bs))
+	for i, b := range bs {
+		formals[i] = parser.Symbol(b.name)
+	}
+
+	mark := len(c.scope)
+	v := c.bind(name)
+	v.declared = true
+	c.emit(DECLARE, v.slot)
+	if err := c.lambda(name, parser.List(formals...), body); err != nil {
+		return err
+	}
+	c.assign(name)
+	c.ref(name)
+	c.scope = c.scope[:mark]
+
+	for _, b := range bs {
+		if err := c.expr(b.init, false); err != nil {
+			return err
+		}
+	}
+	c.emitCall(len(bs), tail)
+
+	return nil
+}
+
+func compileLetStar(c *compiler, operands []parser.Sexpr, tail bool) error {
+	bs, body, err := bindings(operands, "let*")
+	if err != nil {
+		return err
+	}
+
+	mark := len(c.scope)
+	for _, b := range bs {
+		if err := c.expr(b.init, false); err != nil {
+			return err
+		}
+		c.bindAll([]binding{b})
+	}
+
+	if err := c.body(body, tail); err != nil {
+		return err
+	}
+	c.scope = c.scope[:mark]
+
+	return nil
+}
+
+// compileLetrec compiles both letrec and letrec*, initializing variables left
+// to right, as evaluator does.
+func compileLetrec(c *compiler, operands []parser.Sexpr, tail bool) error {
+	bs, body, err := bindings(operands, "letrec")
+	if err != nil {
+		return err
+	}
+
+	mark := len(c.scope)
+	for _, b := range bs {
+		v := c.bind(b.name)
+		v.declared = true
+		c.emit(DECLARE, v.slot)
+	}
+
+	for _, b := range bs {
+		if err := c.value(b.name, b.init); err != nil {
+			return err
+		}
+		c.assign(b.name)
+	}
+
+	if err := c.body(body, tail); err != nil {
+		return err
+	}
+	c.scope = c.scope[:mark]
+
+	return nil
+}
+
+// compileDo compiles do loop. Each iteration binds variables anew, so
+// closures created by body capture values of their own iteration.
+func compileDo(c *compiler, operands []parser.Sexpr, tail bool) error {
+	if len(operands) < 2 {
+		return fmt.Errorf("%w: do", eval.BAD_SYNTAX)
+	}
+
+	specs, ok := list(operands[0])
+	if !ok {
+		return fmt.Errorf("%w: do bindings", eval.BAD_SYNTAX)
+	}
+
+	bs := make([]binding, len(specs))
+	steps := make([]parser.Sexpr, len(specs))
+	seen := make(map[string]bool)
+
+	for i, s := range specs {
+		spec, ok := list(s)
+		if !ok || len(spec) < 2 || len(spec) > 3 {
+			return fmt.Errorf("%w: do binding", eval.BAD_SYNTAX)
+		}
+
+		name, ok := symbolName(spec[0])
+		if !ok || seen[name] {
+			return fmt.Errorf("%w: do binding", eval.BAD_SYNTAX)
+		}
+		seen[name] = true
+
+		bs[i] = binding{name, spec[1]}
+		steps[i] = spec[0]
+		if len(spec) == 3 {
+			steps[i] = spec[2]
+		}
+	}
+
+	exit, ok := list(operands[1])
+	if !ok || len(exit) == 0 {
+		return fmt.Errorf("%w: do exit clause", eval.BAD_SYNTAX)
+	}
+
+	for _, b := range bs {
+		if err := c.expr(b.init, false); err != nil {
+			return err
+		}
+	}
+
+	mark := len(c.scope)
+	c.bindAll(bs)
+	vs := slices.Clone(c.scope[mark:])
+
+	loop := c.label()
+	if err := c.expr(exit[0], false); err != nil {
+		return err
+	}
+	iteration := c.emit(JUMP_FALSE, 0)
+
+	if err := c.sequence(exit[1:], tail); err != nil {
+		return err
+	}
+	end := c.emit(JUMP, 0)
+
+	c.patch(iteration, c.label())
+	for _, command := range operands[2:] {
+		if err := c.expr(command, false); err != nil {
+			return err
+		}
+		c.emit(POP, 0)
+	}
+
+	for _, step := range steps {
+		if err := c.expr(step, false); err != nil {
+			return err
+		}
+	}
+	for i := len(vs) - 1; i >= 0; i-- {
+		c.emit(BIND, vs[i].slot)
+	}
+	c.emit(JUMP, loop)
+
+	c.patch(end, c.label())
+	c.scope = c.scope[:mark]
+
+	return nil
+}
+
+func compileDelay(c *compiler, operands []parser.Sexpr, _ bool) error {
+	return compilePromise(c, operands, "delay")
+}
+
+func compileDelayForce(c *compiler, operands []parser.Sexpr, _ bool) error {
+	return compilePromise(c, operands, "delay-force")
+}
+
+// compilePromise compiles delay or delay-force, which pushes promise calling
+// procedure with expression as body.
+func compilePromise(c *compiler, operands []parser.Sexpr, form string) error {
+	if len(operands) != 1 {
+		return fmt.Errorf("%w: %s", eval.BAD_SYNTAX, form)
+	}
+
+	if err := c.lambda("", parser.Nil, operands); err != nil {
+		return err
+	}
+
+	lazy := 0
+	if form == "delay-force" {
+		lazy = 1
+	}
+	c.emit(PROMISE, lazy)
+
+	return nil
+}
+
+// compileGuard compiles guard, body of which is called as procedure, so
+// objects it raises are caught. Caught object is bound to variable for cond
+// clauses, and raised again if none of them is selected, continuably if it
+// was raised so, which is kept in local variable out of scope of clauses.
+func compileGuard(c *compiler, operands []parser.Sexpr, tail bool) error {
+	if len(operands) < 2 {
+		return fmt.Errorf("%w: guard", eval.BAD_SYNTAX)
+	}
+
+	spec, ok := list(operands[0])
+	if !ok || len(spec) == 0 {
+		return fmt.Errorf("%w: guard clauses", eval.BAD_SYNTAX)
+	}
+
+	name, ok := symbolName(spec[0])
+	if !ok {
+		return fmt.Errorf("%w: guard variable", eval.BAD_SYNTAX)
+	}
+
+	if err := c.lambda("", parser.Nil, operands[1:]); err != nil {
+		return err
+	}
+	end := c.emit(GUARD, 0)
+
+	mark := len(c.scope)
+	continuable := c.bind("")
+	c.scope = c.scope[:mark]
+	c.bindAll([]binding{{name: name}})
+	c.emit(BIND, continuable.slot)
+	err := c.clauses(spec[1:], tail, func() {
+		c.emit(LOCAL, continuable.slot)
+		c.ref(name)
+		c.emit(RAISE, 0)
+	})
+	if err != nil {
+		return err
+	}
+	c.scope = c.scope[:mark]
+
+	c.patch(end, c.label())
+
+	return nil
+}
@@ -0,0 +1,351 @@
+package compile
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/vkhonin/scheme/parser"
+	"io"
+	"strings"
+)
+
+var (
+	INVALID_OBJECT = errors.New("invalid object")
+	STALE_OBJECT   = errors.New("object of other version")
+)
+
+// ObjectVersion is version of object format and instruction set. It changes
+// whenever either does, so objects written for other machines are rejected
+// rather than run.
+const ObjectVersion = 3
+
+// objectMagic starts every object, followed by ObjectVersion.
+const objectMagic = "SCMO"
+
+// WriteObject writes code to w as object, which ReadObject reads back, so
+// programs may be compiled once and loaded without parsing and compiling
+// them again. Object starts with header of its version, then fields of code
+// and of procedures nested in it follow, counts and integers as unsigned
+// varints and strings with their lengths. Constants are written as
+// write-shared procedure prints them.
+//
+// Objects hold code only: macros defined by program are expanded before it
+// is compiled and are not written.
+func WriteObject(w io.Writer, code *Code) error {
+	buf := binary.BigEndian.AppendUint16([]byte(objectMagic), ObjectVersion)
+	buf = appendCode(buf, code)
+
+	_, err := w.Write(buf)
+	return err
+}
+
+func appendCode(buf []byte, code *Code) []byte {
+	buf = appendString(buf, code.Name)
+	buf = appendStrings(buf, code.Params)
+	buf = appendString(buf, code.Rest)
+
+	buf = binary.AppendUvarint(buf, uint64(len(code.Locals)))
+	for _, local := range code.Locals {
+		buf = appendString(buf, local.Name)
+		buf = appendBool(buf, local.Boxed)
+	}
+
+	buf = binary.AppendUvarint(buf, uint64(len(code.Free)))
+	for _, capture := range code.Free {
+		buf = appendString(buf, capture.Name)
+		buf = appendBool(buf, capture.Local)
+		buf = binary.AppendUvarint(buf, uint64(capture.Index))
+	}
+
+	buf = binary.AppendUvarint(buf, uint64(len(code.Instructions)))
+	for _, in := range code.Instructions {
+		buf = binary.AppendUvarint(buf, uint64(in))
+	}
+
+	buf = binary.AppendUvarint(buf, uint64(len(code.Consts)))
+	for _, datum := range code.Consts {
+		buf = appendString(buf, parser.WriteShared(datum))
+	}
+
+	buf = appendStrings(buf, code.Names)
+
+	buf = binary.AppendUvarint(buf, uint64(len(code.Procedures)))
+	for _, p := range code.Procedures {
+		buf = appendCode(buf, p)
+	}
+
+	return buf
+}
+
+func appendStrings(buf []byte, ss []string) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(ss)))
+	for _, s := range ss {
+		buf = appendString(buf, s)
+	}
+
+	return buf
+}
+
+func appendBool(buf []byte, b bool) []byte {
+	if b {
+		return append(buf, 1)
+	}
+
+	return append(buf, 0)
+}
+
+func appendString(buf []byte, s string) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(s)))
+	return append(buf, s...)
+}
+
+// ReadObject reads object WriteObject wrote and returns its code. It reports
+// STALE_OBJECT for objects of other versions, which must be compiled again,
+// and INVALID_OBJECT for truncated or corrupted ones, e.g. with instructions
+// referring to missing constants.
+func ReadObject(r io.Reader) (*Code, error) {
+	or := objectReader{r: bufio.NewReader(r)}
+
+	header := make([]byte, len(objectMagic)+2)
+	if _, err := io.ReadFull(or.r, header); err != nil || string(header[:len(objectMagic)]) != objectMagic {
+		return nil, fmt.Errorf("%w: missing header", INVALID_OBJECT)
+	}
+	if version := binary.BigEndian.Uint16(header[len(objectMagic):]); version != ObjectVersion {
+		return nil, fmt.Errorf("%w: version %d, expected %d", STALE_OBJECT, version, ObjectVersion)
+	}
+
+	code, err := or.code()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := or.r.ReadByte(); err != io.EOF {
+		return nil, fmt.Errorf("%w: data after code", INVALID_OBJECT)
+	}
+	code.initGlobals()
+
+	return code, nil
+}
+
+type objectReader struct {
+	r *bufio.Reader
+}
+
+func (or *objectReader) code() (*Code, error) {
+	var (
+		code Code
+		err  error
+	)
+
+	if code.Name, err = or.string(); err != nil {
+		return nil, err
+	}
+	if code.Params, err = or.strings(); err != nil {
+		return nil, err
+	}
+	if code.Rest, err = or.string(); err != nil {
+		return nil, err
+	}
+
+	n, err := or.count()
+	if err != nil {
+		return nil, err
+	}
+	for range n {
+		var local Local
+		if local.Name, err = or.string(); err != nil {
+			return nil, err
+		}
+		if local.Boxed, err = or.bool(); err != nil {
+			return nil, err
+		}
+		code.Locals = append(code.Locals, local)
+	}
+
+	if n, err = or.count(); err != nil {
+		return nil, err
+	}
+	for range n {
+		var capture Capture
+		if capture.Name, err = or.string(); err != nil {
+			return nil, err
+		}
+		if capture.Local, err = or.bool(); err != nil {
+			return nil, err
+		}
+		if capture.Index, err = or.count(); err != nil {
+			return nil, err
+		}
+		code.Free = append(code.Free, capture)
+	}
+
+	if n, err = or.count(); err != nil {
+		return nil, err
+	}
+	for range n {
+		in, err := binary.ReadUvarint(or.r)
+		if err != nil || in > 1<<32-1 {
+			return nil, fmt.Errorf("%w: truncated instructions", INVALID_OBJECT)
+		}
+		code.Instructions = append(code.Instructions, Instruction(in))
+	}
+
+	if n, err = or.count(); err != nil {
+		return nil, err
+	}
+	for range n {
+		text, err := or.string()
+		if err != nil {
+			return nil, err
+		}
+		data, err := parser.ParseString(text)
+		if err != nil || len(data) != 1 {
+			return nil, fmt.Errorf("%w: constant %s", INVALID_OBJECT, text)
+		}
+		code.Consts = append(code.Consts, data[0])
+	}
+
+	if code.Names, err = or.strings(); err != nil {
+		return nil, err
+	}
+
+	if n, err = or.count(); err != nil {
+		return nil, err
+	}
+	for range n {
+		p, err := or.code()
+		if err != nil {
+			return nil, err
+		}
+		code.Procedures = append(code.Procedures, p)
+	}
+
+	if err := code.validate(); err != nil {
+		return nil, err
+	}
+
+	return &code, nil
+}
+
+func (or *objectReader) bool() (bool, error) {
+	b, err := or.r.ReadByte()
+	if err != nil || b > 1 {
+		return false, fmt.Errorf("%w: truncated code", INVALID_OBJECT)
+	}
+
+	return b == 1, nil
+}
+
+// count reads count of elements, which does not exceed MaxArg in any code
+// compiler returns.
+func (or *objectReader) count() (int, error) {
+	n, err := binary.ReadUvarint(or.r)
+	if err != nil || n > MaxArg {
+		return 0, fmt.Errorf("%w: truncated code", INVALID_OBJECT)
+	}
+
+	return int(n), nil
+}
+
+func (or *objectReader) strings() ([]string, error) {
+	n, err := or.count()
+	if err != nil {
+		return nil, err
+	}
+
+	ss := make([]string, 0, min(n, 64))
+	for range n {
+		s, err := or.string()
+		if err != nil {
+			return nil, err
+		}
+		ss = append(ss, s)
+	}
+
+	return ss, nil
+}
+
+// string reads string, allocating memory as its bytes are read rather than
+// trusting its length.
+func (or *objectReader) string() (string, error) {
+	n, err := binary.ReadUvarint(or.r)
+	if err != nil {
+		return "", fmt.Errorf("%w: truncated string", INVALID_OBJECT)
+	}
+
+	var sb strings.Builder
+	if copied, err := io.CopyN(&sb, or.r, int64(n)); err != nil || copied != int64(n) {
+		return "", fmt.Errorf("%w: truncated string", INVALID_OBJECT)
+	}
+
+	return sb.String(), nil
+}
+
+// validate reports INVALID_OBJECT unless instructions of code are known and
+// refer to existing constants, names, variables, procedures and instructions,
+// procedures capture existing variables and code ends with return or jump,
+// so machine may run it without checking them.
+func (c *Code) validate() error {
+	params := len(c.Params)
+	if c.Rest != "" {
+		params++
+	}
+	if params > len(c.Locals) {
+		return fmt.Errorf("%w: parameters without slots", INVALID_OBJECT)
+	}
+
+	for _, p := range c.Procedures {
+		for _, capture := range p.Free {
+			if (capture.Local && capture.Index >= len(c.Locals)) || (!capture.Local && capture.Index >= len(c.Free)) {
+				return fmt.Errorf("%w: capture of missing variable %s", INVALID_OBJECT, capture.Name)
+			}
+		}
+	}
+
+	if len(c.Instructions) == 0 {
+		return fmt.Errorf("%w: code does not return", INVALID_OBJECT)
+	}
+	if last := c.Instructions[len(c.Instructions)-1].Op(); last != RETURN && last != JUMP {
+		return fmt.Errorf("%w: code does not return", INVALID_OBJECT)
+	}
+
+	for i, in := range c.Instructions {
+		var limit int
+
+		switch arg := in.Arg(); in.Op() {
+		case CONST:
+			limit = len(c.Consts)
+		case MEMV:
+			if arg < len(c.Consts) {
+				if _, err := parser.Length(c.Consts[arg]); err != nil {
+					return fmt.Errorf("%w: instruction %d takes list", INVALID_OBJECT, i)
+				}
+			}
+			limit = len(c.Consts)
+		case REF, SET, DEFINE:
+			limit = len(c.Names)
+		case LOCAL, SET_LOCAL, BIND, DECLARE:
+			limit = len(c.Locals)
+		case FREE, SET_FREE:
+			limit = len(c.Free)
+		case CLOSURE:
+			limit = len(c.Procedures)
+		case JUMP, JUMP_FALSE, JUMP_TRUE_OR_POP, JUMP_FALSE_OR_POP, GUARD:
+			limit = len(c.Instructions)
+		case PROMISE:
+			limit = 2
+		default:
+			if in.Op() > RAISE {
+				return fmt.Errorf("%w: unknown opcode %d", INVALID_OBJECT, in.Op())
+			}
+			continue
+		}
+
+		if in.Arg() >= limit {
+			return fmt.Errorf("%w: argument of instruction %d out of range", INVALID_OBJECT, i)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,145 @@
+package compile_test
+
+import (
+	"bytes"
+	"errors"
+	"github.com/vkhonin/scheme/compile"
+	"github.com/vkhonin/scheme/eval"
+	"github.com/vkhonin/scheme/parser"
+	"github.com/vkhonin/scheme/vm"
+	"testing"
+)
+
+func TestObject(t *testing.T) {
+	testCases := []struct {
+		Input  string
+		Output string
+	}{
+		{"", ""},
+		{"(define (fact n) (if (= n 0) 1 (* n (fact (- n 1))))) (fact 10)", "3628800"},
+		{`'(|a b| #\x "s\n" #u8(1 2) #(1 "2") 1/2 0.5 -inf.0 . #t)`, `(|a b| #\x "s\n" #u8(1 2) #(1 "2") 1/2 0.5 -inf.0 . #t)`},
+		{"'#0=(a . #0#)", "#0=(a . #0#)"},
+		{"(define x 1) `(a ,x ,@(list 2 3) #(,x))", "(a 1 2 3 #(1))"},
+		{"(case 2 ((1 2) => (lambda args args)) (else 'none))", "(2)"},
+		{"(guard (e (#t (list 'caught e))) (force (delay (raise 'oops))))", "(caught oops)"},
+		{"(let loop ((i 0)) (if (< i 3) (loop (+ i 1)) ((lambda (a . rest) rest) i i)))", "(3)"},
+		{"(define (counter) (let ((n 0)) (lambda () (set! n (+ n 1)) n))) (define c (counter)) (c) (c)", "2"},
+	}
+
+	for _, c := range testCases {
+		program, err := parser.ParseString(c.Input)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		code, err := compile.Program(program, compile.Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var buf bytes.Buffer
+		if err := compile.WriteObject(&buf, code); err != nil {
+			t.Fatal(err)
+		}
+
+		read, err := compile.ReadObject(&buf)
+		if err != nil {
+			t.Errorf("unexpected error %v for %s", err, c.Input)
+			continue
+		}
+
+		if read.String() != code.String() {
+			t.Errorf("expected listing\n%s\ngot\n%s\nfor %s", code, read, c.Input)
+		}
+
+		result, err := vm.New(&eval.Evaluator{}).Run(read, eval.NewStandardEnvironment())
+		if err != nil {
+			t.Errorf("unexpected error %v for %s", err, c.Input)
+			continue
+		}
+
+		if c.Output == "" {
+			continue
+		}
+
+		expected, err := parser.ParseString(c.Output)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !parser.Equal(result, expected[0]) {
+			t.Errorf("expected %v got %v for %s", expected[0], result, c.Input)
+		}
+	}
+}
+
+func TestReadObject_Errors(t *testing.T) {
+	program, err := parser.ParseString("(define (f x) (if x 'a \"b\")) (f #t)")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code, err := compile.Program(program, compile.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := compile.WriteObject(&buf, code); err != nil {
+		t.Fatal(err)
+	}
+	object := buf.Bytes()
+
+	// Every proper prefix of object is truncated one.
+	for n := range len(object) {
+		if _, err := compile.ReadObject(bytes.NewReader(object[:n])); !errors.Is(err, compile.INVALID_OBJECT) {
+			t.Errorf("expected invalid object got %v for %d bytes of %d", err, n, len(object))
+		}
+	}
+
+	stale := bytes.Clone(object)
+	stale[5] = compile.ObjectVersion + 1
+	if _, err := compile.ReadObject(bytes.NewReader(stale)); !errors.Is(err, compile.STALE_OBJECT) {
+		t.Errorf("expected stale object got %v", err)
+	}
+
+	invalid := [][]byte{
+		[]byte("#!/usr/bin/env scheme\n"),
+		append(bytes.Clone(object), 0),
+		bytes.Replace(object, []byte("\"b\""), []byte("(b "), 1),
+	}
+
+	for _, code := range []*compile.Code{
+		{},
+		{Instructions: []compile.Instruction{compile.Make(compile.CONST, 0), compile.Make(compile.RETURN, 0)}},
+		{Instructions: []compile.Instruction{compile.Make(compile.JUMP, 2), compile.Make(compile.RETURN, 0)}},
+		{Instructions: []compile.Instruction{compile.Make(compile.CLOSURE, 0), compile.Make(compile.RETURN, 0)}},
+		{Instructions: []compile.Instruction{compile.Make(compile.REF, 0), compile.Make(compile.RETURN, 0)}, Names: []string{}},
+		{Instructions: []compile.Instruction{compile.Make(compile.RAISE+1, 0), compile.Make(compile.RETURN, 0)}},
+		{Instructions: []compile.Instruction{compile.Make(compile.MEMV, 0), compile.Make(compile.RETURN, 0)}, Consts: []parser.Sexpr{parser.Int(1)}},
+		{Instructions: []compile.Instruction{compile.Make(compile.UNSPECIFIED, 0)}},
+		{Instructions: []compile.Instruction{compile.Make(compile.RETURN, 0)}, Procedures: []*compile.Code{{}}},
+		{Instructions: []compile.Instruction{compile.Make(compile.LOCAL, 1), compile.Make(compile.RETURN, 0)}, Locals: []compile.Local{{Name: "x"}}},
+		{Instructions: []compile.Instruction{compile.Make(compile.FREE, 0), compile.Make(compile.RETURN, 0)}},
+		{Params: []string{"x"}, Instructions: []compile.Instruction{compile.Make(compile.RETURN, 0)}},
+		{
+			Instructions: []compile.Instruction{compile.Make(compile.CLOSURE, 0), compile.Make(compile.RETURN, 0)},
+			Procedures: []*compile.Code{{
+				Free:         []compile.Capture{{Name: "x", Local: true, Index: 0}},
+				Instructions: []compile.Instruction{compile.Make(compile.FREE, 0), compile.Make(compile.RETURN, 0)},
+			}},
+		},
+	} {
+		var buf bytes.Buffer
+		if err := compile.WriteObject(&buf, code); err != nil {
+			t.Fatal(err)
+		}
+		invalid = append(invalid, buf.Bytes())
+	}
+
+	for _, object := range invalid {
+		if _, err := compile.ReadObject(bytes.NewReader(object)); !errors.Is(err, compile.INVALID_OBJECT) {
+			t.Errorf("expected invalid object got %v for %q", err, object)
+		}
+	}
+}
@@ -0,0 +1,359 @@
+package compile
+
+import (
+	"github.com/vkhonin/scheme/eval"
+	"github.com/vkhonin/scheme/parser"
+	"slices"
+	"sync"
+)
+
+// Options control compilation.
+type Options struct {
+	// NoOptimize leaves code as compiled from program, instruction per part
+	// of each form, which helps to debug compiler and machine.
+	NoOptimize bool
+
+	// FoldCalls makes optimizer fold calls of foldable procedures with
+	// constant arguments. It declares that global variables they are bound
+	// to are not assigned by programs run after code is compiled, e.g. next
+	// datum read by interpreter, which code would not notice.
+	FoldCalls bool
+
+	// Env is environment code is run in, if known. Calls are folded only if
+	// procedures are bound to their standard values in it. Without it, they
+	// are assumed to be.
+	Env *eval.Environment
+}
+
+// foldable are standard procedures without side effects, calls of which
+// with constant arguments are replaced by their values if calls are folded.
+var foldable = map[string]bool{
+	"*": true, "+": true, "-": true, "/": true,
+	"<": true, "<=": true, "=": true, ">": true, ">=": true,
+	"not": true, "zero?": true, "boolean?": true, "number?": true, "complex?": true,
+	"real?": true, "rational?": true, "integer?": true, "exact?": true, "inexact?": true,
+}
+
+var standardEnvironment = sync.OnceValue(eval.NewStandardEnvironment)
+
+// optimize rewrites code of program and procedures nested in it:
+//
+//   - calls of foldable procedures with constant arguments become constants,
+//     if FoldCalls of opts is set
+//   - branches on constant conditions, e.g. of if and and forms, become
+//     jumps or are removed
+//   - constants pushed to be popped, e.g. by begin forms, are removed
+//   - jumps to jumps or returns are shortened, and code never run is removed
+//
+// Calls are not folded by default, since code must give the same values as
+// evaluator does even if programs run later assign procedures. With
+// FoldCalls, they are still not folded if program defines or assigns global
+// variables named as procedures anywhere, or if environment of opts binds
+// them to other values. Local variables named so refer to their slots and
+// are not mistaken for procedures.
+func optimize(code *Code, opts Options) {
+	var bound map[string]bool
+	if opts.FoldCalls {
+		bound = make(map[string]bool)
+		code.boundNames(bound)
+	}
+
+	code.optimize(bound, opts.Env)
+}
+
+// boundNames adds names of global variables code and procedures nested in it
+// define or assign.
+func (c *Code) boundNames(bound map[string]bool) {
+	for _, in := range c.Instructions {
+		switch in.Op() {
+		case SET, DEFINE:
+			bound[c.Names[in.Arg()]] = true
+		}
+	}
+
+	for _, p := range c.Procedures {
+		p.boundNames(bound)
+	}
+}
+
+// optimize optimizes code, folding calls unless bound is nil.
+func (c *Code) optimize(bound map[string]bool, env *eval.Environment) {
+	for changed := true; changed; {
+		changed = c.fold(bound, env)
+		changed = c.prune() || changed
+	}
+
+	c.compact()
+
+	for _, p := range c.Procedures {
+		p.optimize(bound, env)
+	}
+}
+
+// isJump reports whether argument of op is index of instruction.
+func isJump(op Opcode) bool {
+	switch op {
+	case JUMP, JUMP_FALSE, JUMP_TRUE_OR_POP, JUMP_FALSE_OR_POP, GUARD:
+		return true
+	}
+
+	return false
+}
+
+// fold rewrites instructions in order, reducing those at the end of already
+// rewritten ones as they are appended. Instructions jumps target are not
+// reduced together with preceding ones, which other paths do not run. It
+// reports whether code changed.
+func (c *Code) fold(bound map[string]bool, env *eval.Environment) bool {
+	targets := make([]bool, len(c.Instructions))
+	for _, in := range c.Instructions {
+		if isJump(in.Op()) {
+			targets[in.Arg()] = true
+		}
+	}
+
+	f := folder{code: c, bound: bound, env: env}
+	index := make([]int, len(c.Instructions))
+
+	for i, in := range c.Instructions {
+		index[i] = len(f.out)
+		f.out = append(f.out, in)
+		f.targets = append(f.targets, targets[i] || f.pending)
+		f.pending = false
+
+		for f.reduce() {
+		}
+	}
+
+	if !f.changed {
+		return false
+	}
+
+	for i, in := range f.out {
+		if isJump(in.Op()) {
+			f.out[i] = Make(in.Op(), index[in.Arg()])
+		}
+	}
+	c.Instructions = f.out
+
+	return true
+}
+
+type folder struct {
+	code  *Code
+	bound map[string]bool // Nil unless calls are folded
+	env   *eval.Environment
+
+	out     []Instruction
+	targets []bool // Whether out instructions are jump targets
+	pending bool   // Whether instruction appended next is jump target
+	changed bool
+}
+
+// reduce rewrites instructions at the end of out and reports whether it did.
+func (f *folder) reduce() bool {
+	n := len(f.out)
+	if n < 2 || f.targets[n-1] {
+		return false
+	}
+
+	last, prev := f.out[n-1], f.out[n-2]
+
+	switch {
+	case last.Op() == CALL && f.bound != nil:
+		return f.foldCall(last.Arg())
+	case last.Op() == POP && (prev.Op() == CONST || prev.Op() == UNSPECIFIED || prev.Op() == DUP || prev.Op() == CLOSURE):
+		f.truncate(n - 2)
+	case prev.Op() != CONST:
+		return false
+	case last.Op() == JUMP_FALSE && eval.IsTrue(f.code.Consts[prev.Arg()]):
+		f.truncate(n - 2)
+	case last.Op() == JUMP_FALSE:
+		f.out = append(f.out[:n-2], Make(JUMP, last.Arg()))
+		f.targets = f.targets[:n-1]
+	case last.Op() == JUMP_FALSE_OR_POP && eval.IsTrue(f.code.Consts[prev.Arg()]),
+		last.Op() == JUMP_TRUE_OR_POP && !eval.IsTrue(f.code.Consts[prev.Arg()]):
+		f.truncate(n - 2)
+	case last.Op() == JUMP_FALSE_OR_POP, last.Op() == JUMP_TRUE_OR_POP:
+		f.out[n-1] = Make(JUMP, last.Arg())
+	default:
+		return false
+	}
+
+	f.changed = true
+
+	return true
+}
+
+// foldCall replaces call with argc constant arguments of foldable procedure
+// by its value. Calls that fail are left to fail when they are run.
+func (f *folder) foldCall(argc int) bool {
+	start := len(f.out) - argc - 2
+	if start < 0 || f.out[start].Op() != REF || slices.Contains(f.targets[start+1:], true) {
+		return false
+	}
+
+	name := f.code.Names[f.out[start].Arg()]
+	if !foldable[name] || f.bound[name] {
+		return false
+	}
+
+	args := make([]parser.Sexpr, argc)
+	for i, in := range f.out[start+1 : len(f.out)-1] {
+		if in.Op() != CONST {
+			return false
+		}
+		args[i] = f.code.Consts[in.Arg()]
+	}
+
+	env := f.env
+	if env == nil {
+		env = standardEnvironment()
+	}
+
+	proc, err := env.Lookup(name)
+	if builtin, ok := proc.(*eval.Builtin); err != nil || !ok || builtin.Name != name {
+		return false
+	}
+
+	value, err := (&eval.Evaluator{}).Apply(proc, args)
+	if err != nil {
+		return false
+	}
+
+	f.code.Consts = append(f.code.Consts, value)
+	f.out = append(f.out[:start], Make(CONST, len(f.code.Consts)-1))
+	f.targets = f.targets[:start+1]
+	f.changed = true
+
+	return true
+}
+
+// truncate removes instructions from index n on. If instruction at n is jump
+// target, one appended next is.
+func (f *folder) truncate(n int) {
+	f.pending = f.targets[n]
+	f.out, f.targets = f.out[:n], f.targets[:n]
+}
+
+// prune makes jumps continue at the end of chains of jumps, turns jumps to
+// return into return and removes instructions never run and jumps to next
+// instruction. It reports whether code changed.
+func (c *Code) prune() bool {
+	changed := false
+
+	for i, in := range c.Instructions {
+		if !isJump(in.Op()) {
+			continue
+		}
+
+		target := in.Arg()
+		for range len(c.Instructions) {
+			if next := c.Instructions[target]; next.Op() != JUMP || next.Arg() == target {
+				break
+			}
+			target = c.Instructions[target].Arg()
+		}
+
+		switch {
+		case in.Op() == JUMP && c.Instructions[target].Op() == RETURN:
+			c.Instructions[i] = Make(RETURN, 0)
+			changed = true
+		case target != in.Arg():
+			c.Instructions[i] = Make(in.Op(), target)
+			changed = true
+		}
+	}
+
+	reachable := make([]bool, len(c.Instructions))
+	for work := []int{0}; len(work) > 0; {
+		i := work[len(work)-1]
+		work = work[:len(work)-1]
+		if reachable[i] {
+			continue
+		}
+		reachable[i] = true
+
+		switch in := c.Instructions[i]; {
+		case in.Op() == RETURN:
+		case in.Op() == JUMP:
+			work = append(work, in.Arg())
+		case isJump(in.Op()):
+			work = append(work, in.Arg(), i+1)
+		default:
+			work = append(work, i+1)
+		}
+	}
+
+	// Jumps over instructions never run continue at next instruction run.
+	for i, in := range c.Instructions {
+		if reachable[i] && in.Op() == JUMP && in.Arg() > i && !slices.Contains(reachable[i+1:in.Arg()], true) {
+			reachable[i] = false
+		}
+	}
+
+	index := make([]int, len(c.Instructions))
+	kept := c.Instructions[:0]
+
+	for i, in := range c.Instructions {
+		index[i] = len(kept)
+		if reachable[i] {
+			kept = append(kept, in)
+		}
+	}
+
+	if len(kept) == len(c.Instructions) {
+		return changed
+	}
+
+	for i, in := range kept {
+		if isJump(in.Op()) {
+			kept[i] = Make(in.Op(), index[in.Arg()])
+		}
+	}
+	c.Instructions = kept
+
+	return true
+}
+
+// compact removes constants, names and procedures instructions no longer
+// refer to.
+func (c *Code) compact() {
+	consts := make(map[int]int)
+	names := make(map[int]int)
+	procedures := make(map[int]int)
+
+	var (
+		newConsts     []parser.Sexpr
+		newNames      []string
+		newProcedures []*Code
+	)
+
+	for i, in := range c.Instructions {
+		var (
+			table map[int]int
+			add   func(old int)
+		)
+
+		switch in.Op() {
+		case CONST, MEMV:
+			table, add = consts, func(old int) { newConsts = append(newConsts, c.Consts[old]) }
+		case REF, SET, DEFINE:
+			table, add = names, func(old int) { newNames = append(newNames, c.Names[old]) }
+		case CLOSURE:
+			table, add = procedures, func(old int) { newProcedures = append(newProcedures, c.Procedures[old]) }
+		default:
+			continue
+		}
+
+		arg, ok := table[in.Arg()]
+		if !ok {
+			arg = len(table)
+			table[in.Arg()] = arg
+			add(in.Arg())
+		}
+		c.Instructions[i] = Make(in.Op(), arg)
+	}
+
+	c.Consts, c.Names, c.Procedures = newConsts, newNames, newProcedures
+}
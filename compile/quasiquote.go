@@ -0,0 +1,159 @@
+package compile
+
+import (
+	"fmt"
+	"github.com/vkhonin/scheme/eval"
+	"github.com/vkhonin/scheme/parser"
+)
+
+func compileQuasiquote(c *compiler, operands []parser.Sexpr, _ bool) error {
+	if len(operands) != 1 {
+		return fmt.Errorf("%w: quasiquote", eval.BAD_SYNTAX)
+	}
+
+	return c.template(operands[0], 1)
+}
+
+// template compiles quasiquote template at given nesting depth, which pushes
+// its value. Parts without unquoted expressions are constants, and the rest
+// is built as evaluator does: unquoted parts are evaluated only at depth 1;
+// nested quasiquote forms increase depth and unquote forms inside them
+// decrease it.
+func (c *compiler) template(template parser.Sexpr, depth int) error {
+	if isConstant(template, depth) {
+		c.constant(template)
+		return nil
+	}
+
+	switch t := template.(type) {
+	case *parser.Vector:
+		if err := c.templateList(parser.List(t.Elements...), depth); err != nil {
+			return err
+		}
+		c.emit(LIST_VECTOR, 0)
+		return nil
+	default:
+		return c.templateList(t, depth)
+	}
+}
+
+// templateList compiles list template. Its elements and tail are pushed in
+// order, then joined from the end, spliced elements by APPEND and others by
+// CONS.
+func (c *compiler) templateList(template parser.Sexpr, depth int) error {
+	var joins []Opcode
+
+	for {
+		pair, ok := template.(*parser.Expr)
+		if !ok || isNull(pair) {
+			if err := c.template(template, depth); err != nil {
+				return err
+			}
+			break
+		}
+
+		// Form in tail position, e.g. (a unquote b) which is (a . ,b).
+		if keyword, operand, ok := qqForm(pair); ok {
+			if err := c.templateForm(keyword, operand, depth); err != nil {
+				return err
+			}
+			break
+		}
+
+		if element, ok := pair.Car.(*parser.Expr); ok {
+			if keyword, operand, ok := qqForm(element); ok && keyword == "unquote-splicing" && depth == 1 {
+				if err := c.expr(operand, false); err != nil {
+					return err
+				}
+				joins = append(joins, APPEND)
+				template = pair.Cdr
+				continue
+			}
+		}
+
+		if err := c.template(pair.Car, depth); err != nil {
+			return err
+		}
+		joins = append(joins, CONS)
+		template = pair.Cdr
+	}
+
+	for i := len(joins) - 1; i >= 0; i-- {
+		c.emit(joins[i], 0)
+	}
+
+	return nil
+}
+
+// templateForm compiles quasiquote, unquote or unquote-splicing form.
+func (c *compiler) templateForm(keyword string, operand parser.Sexpr, depth int) error {
+	switch {
+	case keyword == "unquote" && depth == 1:
+		return c.expr(operand, false)
+	case keyword == "unquote-splicing" && depth == 1:
+		return fmt.Errorf("%w: unquote-splicing outside of list", eval.BAD_SYNTAX)
+	}
+
+	innerDepth := depth - 1
+	if keyword == "quasiquote" {
+		innerDepth = depth + 1
+	}
+
+	c.constant(parser.Intern(keyword))
+	if err := c.template(operand, innerDepth); err != nil {
+		return err
+	}
+	c.constant(parser.Nil)
+	c.emit(CONS, 0)
+	c.emit(CONS, 0)
+
+	return nil
+}
+
+// isConstant reports whether template at depth has no unquoted parts, so its
+// value is template itself.
+func isConstant(template parser.Sexpr, depth int) bool {
+	switch t := template.(type) {
+	case *parser.Vector:
+		for _, element := range t.Elements {
+			if !isConstant(element, depth) {
+				return false
+			}
+		}
+	case *parser.Expr:
+		for pair, ok := t, true; ok && !isNull(pair); pair, ok = pair.Cdr.(*parser.Expr) {
+			if keyword, operand, ok := qqForm(pair); ok {
+				switch {
+				case keyword == "quasiquote":
+					return isConstant(operand, depth+1)
+				case depth == 1:
+					return false
+				default:
+					return isConstant(operand, depth-1)
+				}
+			}
+
+			if !isConstant(pair.Car, depth) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// qqForm reports whether pair is (keyword operand) for one of quasiquote
+// related keywords.
+func qqForm(pair *parser.Expr) (string, parser.Sexpr, bool) {
+	keyword, ok := symbolName(pair.Car)
+	if !ok || (keyword != "quasiquote" && keyword != "unquote" && keyword != "unquote-splicing") {
+		return "", nil, false
+	}
+
+	rest, ok := pair.Cdr.(*parser.Expr)
+	if !ok || isNull(rest) || !isNull(rest.Cdr) {
+		return "", nil, false
+	}
+
+	return keyword, rest.Car, true
+}
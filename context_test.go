@@ -0,0 +1,81 @@
+package scheme_test
+
+import (
+	"context"
+	"errors"
+	"github.com/vkhonin/scheme"
+	"github.com/vkhonin/scheme/eval"
+	"github.com/vkhonin/scheme/printer"
+	"testing"
+	"time"
+)
+
+func TestInterp_EvalContext(t *testing.T) {
+	testCases := []string{
+		"(define (f) (f)) (f)",
+		"(let loop ((i 0)) (loop (+ i 1)))",
+		"(do () (#f))",
+		"(guard (e (#t 'caught)) (let loop () (loop)))",
+		"(call/cc (lambda (k) (with-exception-handler (lambda (e) (k 'handled)) (lambda () (let loop () (loop))))))",
+		"(dynamic-wind (lambda () #f) (lambda () (let loop () (loop))) (lambda () #f))",
+		"(map (lambda (x) (let loop () (loop))) '(1))",
+	}
+
+	for _, options := range [][]scheme.Option{nil, {scheme.WithVM()}} {
+		for _, c := range testCases {
+			interp := scheme.New(options...)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+			_, err := interp.EvalContext(ctx, c)
+			cancel()
+
+			var interrupted *eval.Interrupted
+			if !errors.As(err, &interrupted) || !errors.Is(err, context.DeadlineExceeded) {
+				t.Errorf("expected interruption by deadline got %v for %s", err, c)
+			}
+
+			if result, err := interp.EvalString("(+ 1 2)"); err != nil || printer.Write(result) != "3" {
+				t.Errorf("expected 3 after interruption got %v, %v for %s", result, err, c)
+			}
+		}
+	}
+}
+
+func TestInterp_EvalContext_Cancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := scheme.New().EvalContext(ctx, "(+ 1 2)"); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected error %v got %v", context.Canceled, err)
+	}
+
+	result, err := scheme.New().EvalContext(context.Background(), "(+ 1 2)")
+	if err != nil || printer.Write(result) != "3" {
+		t.Errorf("expected 3 got %v, %v", result, err)
+	}
+}
+
+type contextKey struct{}
+
+func TestInterp_DefineFunc_Context(t *testing.T) {
+	interp := scheme.New()
+
+	err := interp.DefineFunc("request-id", func(ctx context.Context, prefix string) string {
+		id, _ := ctx.Value(contextKey{}).(string)
+		return prefix + id
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.WithValue(context.Background(), contextKey{}, "42")
+
+	result, err := interp.EvalContext(ctx, `(request-id "id-")`)
+	if err != nil || printer.Write(result) != `"id-42"` {
+		t.Errorf(`expected "id-42" got %v, %v`, result, err)
+	}
+
+	if _, err := interp.EvalString("(request-id)"); !errors.Is(err, eval.WRONG_ARITY) {
+		t.Errorf("expected error %v got %v", eval.WRONG_ARITY, err)
+	}
+}
@@ -0,0 +1,344 @@
+package scheme
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/vkhonin/scheme/eval"
+	"github.com/vkhonin/scheme/parser"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Capability grants scripts access to host, binding procedures using it in
+// environment, e.g. Console or ReadFiles.
+type Capability func(env *eval.Environment)
+
+// hostProcedures are standard procedures SafeEnvironment leaves out, since
+// they expose process of host or, as spawn, start goroutines limits of
+// interpreter do not bound.
+var hostProcedures = []string{"command-line", "exit", "spawn"}
+
+// DefaultMaxDepth is limit of depth of recursion of interpreters evaluating
+// in SafeEnvironment unless WithMaxDepth gives other, so that deep recursion
+// of untrusted scripts stops with error rather than overflowing Go stack.
+const DefaultMaxDepth = 10000
+
+// safeRoot is empty parent of environments SafeEnvironment returns, marking
+// them and environments extending them as safe, see isSafe.
+var safeRoot = eval.NewEnvironment(nil)
+
+// SafeEnvironment returns environment for untrusted scripts, binding
+// procedures of pure computation only, procedures of Go objects, see Object,
+// and those of capabilities granted. Unlike StandardEnvironment, it has no
+// command-line, exit and spawn, and scheme-report-environment returns
+// environment without them too. Interpreters evaluating in it limit depth of
+// recursion to DefaultMaxDepth by default.
+func SafeEnvironment(capabilities ...Capability) *eval.Environment {
+	standard := eval.NewStandardEnvironment()
+	env := eval.NewEnvironment(safeRoot)
+
+	for _, name := range standard.Names() {
+		if !slices.Contains(hostProcedures, name) {
+			value, _ := standard.Lookup(name)
+			env.Define(name, value)
+		}
+	}
+
+	if value, err := standard.Lookup("scheme-report-environment"); err == nil {
+		report := value.(*eval.Builtin)
+		env.Define(report.Name, &eval.Builtin{
+			Name:    report.Name,
+			MinArgs: report.MinArgs,
+			MaxArgs: report.MaxArgs,
+			Fn: func(ev *eval.Evaluator, args []parser.Sexpr) (parser.Sexpr, error) {
+				if _, err := report.Fn(ev, args); err != nil {
+					return nil, err
+				}
+				return SafeEnvironment(), nil
+			},
+		})
+	}
+
+	return grant(env, capabilities)
+}
+
+// isSafe reports whether env is environment of SafeEnvironment or extends
+// one.
+func isSafe(env *eval.Environment) bool {
+	for ; env != nil; env = env.Parent() {
+		if env == safeRoot {
+			return true
+		}
+	}
+
+	return false
+}
+
+// StandardEnvironment returns environment with standard procedures,
+// procedures of Go objects, see Object, console of process, see Console, and
+// procedures of capabilities granted. It is environment of New.
+func StandardEnvironment(capabilities ...Capability) *eval.Environment {
+	env := eval.NewStandardEnvironment()
+
+	return grant(env, append([]Capability{Console(os.Stdin, os.Stdout)}, capabilities...))
+}
+
+// grant binds procedures of Go objects and capabilities in env.
+func grant(env *eval.Environment, capabilities []Capability) *eval.Environment {
+	for _, p := range objectProcedures {
+		env.Define(p.Name, p)
+	}
+
+	for _, capability := range capabilities {
+		capability(env)
+	}
+
+	return env
+}
+
+// Console grants procedures reading lines from in and writing data to out:
+//
+//	(display obj)        writes obj as display does, e.g. strings unquoted
+//	(write obj)          writes obj as read reads it
+//	(newline)            writes end of line
+//	(read-line)          reads line, or returns eof object at end of in
+//	(eof-object)         returns eof object
+//	(eof-object? obj)    whether obj is eof object
+func Console(in io.Reader, out io.Writer) Capability {
+	r := bufio.NewReader(in)
+
+	write := func(s string) (parser.Sexpr, error) {
+		if _, err := io.WriteString(out, s); err != nil {
+			return nil, err
+		}
+		return eval.Unspecified, nil
+	}
+
+	return func(env *eval.Environment) {
+		define(env,
+			&eval.Builtin{Name: "display", MinArgs: 1, MaxArgs: 1, Fn: func(_ *eval.Evaluator, args []parser.Sexpr) (parser.Sexpr, error) {
+				return write(parser.Display(args[0]))
+			}},
+			&eval.Builtin{Name: "write", MinArgs: 1, MaxArgs: 1, Fn: func(_ *eval.Evaluator, args []parser.Sexpr) (parser.Sexpr, error) {
+				return write(parser.Write(args[0]))
+			}},
+			&eval.Builtin{Name: "newline", MinArgs: 0, MaxArgs: 0, Fn: func(_ *eval.Evaluator, _ []parser.Sexpr) (parser.Sexpr, error) {
+				return write("\n")
+			}},
+			&eval.Builtin{Name: "read-line", MinArgs: 0, MaxArgs: 0, Fn: func(ev *eval.Evaluator, _ []parser.Sexpr) (parser.Sexpr, error) {
+				line, err := r.ReadString('\n')
+				if err == io.EOF && line == "" {
+					return EOF, nil
+				}
+				if err != nil && err != io.EOF {
+					return raise(ev, err)
+				}
+				return parser.Str(strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")), nil
+			}},
+			&eval.Builtin{Name: "eof-object", MinArgs: 0, MaxArgs: 0, Fn: func(_ *eval.Evaluator, _ []parser.Sexpr) (parser.Sexpr, error) {
+				return EOF, nil
+			}},
+			&eval.Builtin{Name: "eof-object?", MinArgs: 1, MaxArgs: 1, Fn: func(_ *eval.Evaluator, args []parser.Sexpr) (parser.Sexpr, error) {
+				return parser.Bool(args[0] == EOF), nil
+			}},
+		)
+	}
+}
+
+// ReadFiles grants procedures reading files of fsys, e.g. os.DirFS of
+// directory scripts may read:
+//
+//	(file-exists? path)    whether file exists
+//	(read-file path)       contents of file as string
+//
+// Paths are slash-separated and relative to root of fsys, see fs.ValidPath.
+// Errors of fsys are raised as error objects.
+func ReadFiles(fsys fs.FS) Capability {
+	return func(env *eval.Environment) {
+		define(env,
+			&eval.Builtin{Name: "file-exists?", MinArgs: 1, MaxArgs: 1, Fn: func(_ *eval.Evaluator, args []parser.Sexpr) (parser.Sexpr, error) {
+				name, err := toString(args[0])
+				if err != nil {
+					return nil, err
+				}
+				_, err = fs.Stat(fsys, name)
+				return parser.Bool(err == nil), nil
+			}},
+			&eval.Builtin{Name: "read-file", MinArgs: 1, MaxArgs: 1, Fn: func(ev *eval.Evaluator, args []parser.Sexpr) (parser.Sexpr, error) {
+				name, err := toString(args[0])
+				if err != nil {
+					return nil, err
+				}
+				data, err := fs.ReadFile(fsys, name)
+				if err != nil {
+					return raise(ev, err)
+				}
+				return parser.Str(string(data)), nil
+			}},
+		)
+	}
+}
+
+// WriteFiles grants procedures changing files of directory dir:
+//
+//	(write-file path string)    replaces contents of file, creating it
+//	(delete-file path)          removes file
+//
+// Paths are relative to dir and may not leave it, see filepath.IsLocal, nor
+// may symbolic links in dir lead out of it, see os.Root. Errors are raised
+// as error objects.
+func WriteFiles(dir string) Capability {
+	// inRoot calls fn with root of dir and name, which must be local.
+	inRoot := func(op, name string, fn func(root *os.Root, name string) error) error {
+		if !filepath.IsLocal(name) {
+			return &fs.PathError{Op: op, Path: name, Err: fs.ErrPermission}
+		}
+
+		root, err := os.OpenRoot(dir)
+		if err != nil {
+			return err
+		}
+		defer root.Close()
+
+		return fn(root, name)
+	}
+
+	return func(env *eval.Environment) {
+		define(env,
+			&eval.Builtin{Name: "write-file", MinArgs: 2, MaxArgs: 2, Fn: func(ev *eval.Evaluator, args []parser.Sexpr) (parser.Sexpr, error) {
+				name, err := toString(args[0])
+				if err != nil {
+					return nil, err
+				}
+				data, err := toString(args[1])
+				if err != nil {
+					return nil, err
+				}
+				if err := inRoot("write", name, func(root *os.Root, name string) error {
+					return writeFile(root, name, data)
+				}); err != nil {
+					return raise(ev, err)
+				}
+				return eval.Unspecified, nil
+			}},
+			&eval.Builtin{Name: "delete-file", MinArgs: 1, MaxArgs: 1, Fn: func(ev *eval.Evaluator, args []parser.Sexpr) (parser.Sexpr, error) {
+				name, err := toString(args[0])
+				if err != nil {
+					return nil, err
+				}
+				if err := inRoot("remove", name, (*os.Root).Remove); err != nil {
+					return raise(ev, err)
+				}
+				return eval.Unspecified, nil
+			}},
+		)
+	}
+}
+
+// writeFile replaces contents of file name of root with data, creating it.
+func writeFile(root *os.Root, name, data string) error {
+	f, err := root.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o666)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.WriteString(f, data); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// Network grants procedure fetching resources with client, whose transport
+// may restrict hosts scripts reach:
+//
+//	(http-get url)    body of response as string
+//
+// Requests are made with context of evaluation, see EvalContext. Errors of
+// client and responses with status other than 2xx are raised as error
+// objects.
+func Network(client *http.Client) Capability {
+	return func(env *eval.Environment) {
+		define(env,
+			&eval.Builtin{Name: "http-get", MinArgs: 1, MaxArgs: 1, Fn: func(ev *eval.Evaluator, args []parser.Sexpr) (parser.Sexpr, error) {
+				url, err := toString(args[0])
+				if err != nil {
+					return nil, err
+				}
+
+				body, err := httpGet(ev, client, url)
+				if err != nil {
+					return raise(ev, err)
+				}
+				return parser.Str(body), nil
+			}},
+		)
+	}
+}
+
+// httpGet returns body of response to GET request of url.
+func httpGet(ev *eval.Evaluator, client *http.Client, url string) (string, error) {
+	req, err := http.NewRequestWithContext(ev.Context(), http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return "", fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+
+	return string(body), nil
+}
+
+// EOF is eof object read-line of Console returns at end of input.
+var EOF parser.Sexpr = &eofObject{}
+
+// eofObject is not empty, so that EOF is not equal to pointers to other
+// zero-size values, e.g. eval.Unspecified.
+type eofObject struct{ _ byte }
+
+func (e *eofObject) Equals(s parser.Sexpr) bool {
+	return s == e
+}
+
+func (*eofObject) String() string {
+	return "#<eof>"
+}
+
+// define binds builtins in env by their names.
+func define(env *eval.Environment, builtins ...*eval.Builtin) {
+	for _, b := range builtins {
+		env.Define(b.Name, b)
+	}
+}
+
+// raise raises error object of Go error err, which guard catches.
+func raise(ev *eval.Evaluator, err error) (parser.Sexpr, error) {
+	return ev.Raise(&eval.ErrorObject{Message: err.Error(), Err: err}, false)
+}
+
+func toString(s parser.Sexpr) (string, error) {
+	a, ok := s.(*parser.Atom)
+	if !ok || a.Type != parser.STRING {
+		return "", fmt.Errorf("%w: string expected, got %v", eval.WRONG_TYPE, s)
+	}
+
+	return (a.Value).(string), nil
+}
@@ -0,0 +1,198 @@
+package scheme_test
+
+import (
+	"errors"
+	"fmt"
+	"github.com/vkhonin/scheme"
+	"github.com/vkhonin/scheme/eval"
+	"github.com/vkhonin/scheme/printer"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestSafeEnvironment(t *testing.T) {
+	testCases := []struct {
+		Input  string
+		Output string
+		Err    error
+	}{
+		{"(map (lambda (x) (* x x)) '(1 2 3))", "(1 4 9)", nil},
+		{"(go-object? 1)", "#f", nil},
+		{"(eval '(+ 1 2) (scheme-report-environment 5))", "3", nil},
+		{"(command-line)", "", eval.UNBOUND_VARIABLE},
+		{"(exit 1)", "", eval.UNBOUND_VARIABLE},
+		{"(spawn (lambda () 1))", "", eval.UNBOUND_VARIABLE},
+		{"(channel-receive (let ((ch (make-channel 1))) (channel-send! ch 'v) ch))", "v", nil},
+		{"(eval '(exit 1) (scheme-report-environment 5))", "", eval.UNBOUND_VARIABLE},
+		{"(eval '(exit 1) (interaction-environment))", "", eval.UNBOUND_VARIABLE},
+		{"(scheme-report-environment 7)", "", eval.UNSUPPORTED_VERSION},
+		{`(display "x")`, "", eval.UNBOUND_VARIABLE},
+		{`(read-file "x")`, "", eval.UNBOUND_VARIABLE},
+	}
+
+	for _, options := range [][]scheme.Option{nil, {scheme.WithVM()}} {
+		for _, c := range testCases {
+			interp := scheme.New(append(options, scheme.WithEnvironment(scheme.SafeEnvironment()))...)
+
+			result, err := interp.EvalString(c.Input)
+			if c.Err != nil {
+				if !errors.Is(err, c.Err) {
+					t.Errorf("expected error %v got %v for %s", c.Err, err, c.Input)
+				}
+				continue
+			}
+
+			if err != nil || printer.Write(result) != c.Output {
+				t.Errorf("expected %s got %v, %v for %s", c.Output, result, err, c.Input)
+			}
+		}
+	}
+}
+
+func TestSafeEnvironment_Depth(t *testing.T) {
+	const count = "(define (count n) (if (= n 0) 0 (+ 1 (count (- n 1)))))"
+
+	testCases := []struct {
+		Options []scheme.Option
+		Input   string
+		Err     error
+	}{
+		{nil, "(count 1000)", nil},
+		{nil, "(count 1000000)", scheme.ErrResourceLimit},
+		{[]scheme.Option{scheme.WithMaxDepth(100)}, "(count 1000)", scheme.ErrResourceLimit},
+	}
+
+	for _, options := range [][]scheme.Option{nil, {scheme.WithVM()}} {
+		for _, c := range testCases {
+			interp := scheme.New(append(append(options, c.Options...), scheme.WithEnvironment(scheme.SafeEnvironment()))...)
+
+			_, err := interp.EvalString(count + c.Input)
+			if !errors.Is(err, c.Err) {
+				t.Errorf("expected error %v got %v for %s", c.Err, err, c.Input)
+			}
+		}
+	}
+}
+
+func TestConsole(t *testing.T) {
+	var out strings.Builder
+	env := scheme.SafeEnvironment(scheme.Console(strings.NewReader("first\r\nsecond"), &out))
+
+	result, err := scheme.New(scheme.WithEnvironment(env)).EvalString(`
+		(display "a\"b") (write "a\"b") (newline) (display '(1 #\x))
+		(list (read-line) (read-line) (eof-object? (read-line)) (eof-object? (eof-object)) (eof-object? ""))`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := `("first" "second" #t #t #f)`; printer.Write(result) != expected {
+		t.Errorf("expected %s got %s", expected, printer.Write(result))
+	}
+
+	if expected := "a\"b\"a\\\"b\"\n(1 x)"; out.String() != expected {
+		t.Errorf("expected output %q got %q", expected, out.String())
+	}
+}
+
+func TestReadFiles(t *testing.T) {
+	fsys := fstest.MapFS{"data/greeting.txt": {Data: []byte("hello")}}
+	interp := scheme.New(scheme.WithEnvironment(scheme.SafeEnvironment(scheme.ReadFiles(fsys))))
+
+	result, err := interp.EvalString(`
+		(list (read-file "data/greeting.txt") (file-exists? "data/greeting.txt") (file-exists? "missing")
+		      (guard (e ((error-object? e) 'denied)) (read-file "../etc/passwd")))`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := `("hello" #t #f denied)`; printer.Write(result) != expected {
+		t.Errorf("expected %s got %s", expected, printer.Write(result))
+	}
+
+	if _, err := interp.EvalString(`(read-file "missing")`); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected error %v got %v", fs.ErrNotExist, err)
+	}
+
+	if _, err := interp.EvalString(`(read-file 'data)`); !errors.Is(err, eval.WRONG_TYPE) {
+		t.Errorf("expected error %v got %v", eval.WRONG_TYPE, err)
+	}
+}
+
+func TestWriteFiles(t *testing.T) {
+	dir := t.TempDir()
+	interp := scheme.New(scheme.WithEnvironment(scheme.SafeEnvironment(scheme.WriteFiles(dir))))
+
+	if _, err := interp.EvalString(`(write-file "out.txt" "data") (write-file "gone.txt" "") (delete-file "gone.txt")`); err != nil {
+		t.Fatal(err)
+	}
+
+	if data, err := os.ReadFile(filepath.Join(dir, "out.txt")); err != nil || string(data) != "data" {
+		t.Errorf("expected file written got %q, %v", data, err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "gone.txt")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected file deleted got %v", err)
+	}
+
+	for _, input := range []string{`(write-file "../out.txt" "data")`, `(delete-file "/etc/passwd")`} {
+		if _, err := interp.EvalString(input); !errors.Is(err, fs.ErrPermission) {
+			t.Errorf("expected error %v got %v for %s", fs.ErrPermission, err, input)
+		}
+	}
+}
+
+func TestWriteFiles_Symlink(t *testing.T) {
+	dir, outside := t.TempDir(), t.TempDir()
+	if err := os.WriteFile(filepath.Join(outside, "kept.txt"), []byte("kept"), 0o666); err != nil {
+		t.Fatal(err)
+	}
+	for name, target := range map[string]string{"out": outside, "kept.txt": filepath.Join(outside, "kept.txt")} {
+		if err := os.Symlink(target, filepath.Join(dir, name)); err != nil {
+			t.Skip(err)
+		}
+	}
+
+	interp := scheme.New(scheme.WithEnvironment(scheme.SafeEnvironment(scheme.WriteFiles(dir))))
+
+	for _, input := range []string{`(write-file "out/new.txt" "data")`, `(write-file "kept.txt" "data")`, `(delete-file "out/kept.txt")`} {
+		if _, err := interp.EvalString(input); err == nil {
+			t.Errorf("expected error for %s", input)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(outside, "new.txt")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected file outside of directory not created got %v", err)
+	}
+	if data, err := os.ReadFile(filepath.Join(outside, "kept.txt")); err != nil || string(data) != "kept" {
+		t.Errorf("expected file outside of directory kept got %q, %v", data, err)
+	}
+}
+
+func TestNetwork(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/ok" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, "pong")
+	}))
+	defer server.Close()
+
+	interp := scheme.New(scheme.WithEnvironment(scheme.SafeEnvironment(scheme.Network(server.Client()))))
+
+	result, err := interp.EvalString(fmt.Sprintf(`
+		(list (http-get "%[1]s/ok") (guard (e ((error-object? e) 'failed)) (http-get "%[1]s/missing")))`, server.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := `("pong" failed)`; printer.Write(result) != expected {
+		t.Errorf("expected %s got %s", expected, printer.Write(result))
+	}
+}
@@ -0,0 +1,404 @@
+package eval
+
+import (
+	"errors"
+	"fmt"
+	"github.com/vkhonin/scheme/parser"
+	"github.com/vkhonin/scheme/parser/number"
+)
+
+var builtins []*Builtin
+
+// applyBuiltin is apply procedure, calls of which backends replace with calls
+// of procedure it applies, see Applied.
+var applyBuiltin *Builtin
+
+func init() {
+	applyBuiltin = &Builtin{Name: "apply", MinArgs: 2, MaxArgs: -1, Fn: builtinApply}
+
+	builtins = []*Builtin{
+		{Name: "+", MinArgs: 0, MaxArgs: -1, Fn: builtinAdd},
+		{Name: "-", MinArgs: 1, MaxArgs: -1, Fn: builtinSub},
+		{Name: "*", MinArgs: 0, MaxArgs: -1, Fn: builtinMul},
+		{Name: "/", MinArgs: 1, MaxArgs: -1, Fn: builtinDiv},
+		{Name: "=", MinArgs: 1, MaxArgs: -1, Fn: builtinCompare(false, (*number.Number).Equal)},
+		{Name: "<", MinArgs: 1, MaxArgs: -1, Fn: builtinCompare(true, (*number.Number).Less)},
+		{Name: ">", MinArgs: 1, MaxArgs: -1, Fn: builtinCompare(true, func(a, b *number.Number) bool { return b.Less(a) })},
+		{Name: "<=", MinArgs: 1, MaxArgs: -1, Fn: builtinCompare(true, func(a, b *number.Number) bool { return a.Less(b) || a.Equal(b) })},
+		{Name: ">=", MinArgs: 1, MaxArgs: -1, Fn: builtinCompare(true, func(a, b *number.Number) bool { return b.Less(a) || a.Equal(b) })},
+		{Name: "number?", MinArgs: 1, MaxArgs: 1, Fn: builtinIsType(parser.NUMBER)},
+		{Name: "complex?", MinArgs: 1, MaxArgs: 1, Fn: builtinIsType(parser.NUMBER)},
+		{Name: "real?", MinArgs: 1, MaxArgs: 1, Fn: builtinIsNumberKind((*number.Number).IsReal)},
+		{Name: "rational?", MinArgs: 1, MaxArgs: 1, Fn: builtinIsNumberKind((*number.Number).IsRational)},
+		{Name: "integer?", MinArgs: 1, MaxArgs: 1, Fn: builtinIsNumberKind((*number.Number).IsInteger)},
+		{Name: "exact?", MinArgs: 1, MaxArgs: 1, Fn: builtinNumberPredicate((*number.Number).IsExact)},
+		{Name: "inexact?", MinArgs: 1, MaxArgs: 1, Fn: builtinNumberPredicate((*number.Number).Inexact)},
+		{Name: "zero?", MinArgs: 1, MaxArgs: 1, Fn: builtinNumberPredicate((*number.Number).IsZero)},
+		{Name: "number->string", MinArgs: 1, MaxArgs: 2, Fn: builtinNumberToString},
+		{Name: "string->number", MinArgs: 1, MaxArgs: 2, Fn: builtinStringToNumber},
+		{Name: "boolean?", MinArgs: 1, MaxArgs: 1, Fn: builtinIsType(parser.BOOL)},
+		{Name: "char?", MinArgs: 1, MaxArgs: 1, Fn: builtinIsType(parser.CHAR)},
+		{Name: "string?", MinArgs: 1, MaxArgs: 1, Fn: builtinIsType(parser.STRING)},
+		{Name: "symbol?", MinArgs: 1, MaxArgs: 1, Fn: builtinIsType(parser.SYMBOL)},
+		{Name: "vector?", MinArgs: 1, MaxArgs: 1, Fn: builtinIsVector},
+		{Name: "not", MinArgs: 1, MaxArgs: 1, Fn: builtinNot},
+		{Name: "eq?", MinArgs: 2, MaxArgs: 2, Fn: builtinEq},
+		{Name: "eqv?", MinArgs: 2, MaxArgs: 2, Fn: builtinEqv},
+		{Name: "equal?", MinArgs: 2, MaxArgs: 2, Fn: builtinEqual},
+		{Name: "cons", MinArgs: 2, MaxArgs: 2, Fn: builtinCons},
+		{Name: "car", MinArgs: 1, MaxArgs: 1, Fn: builtinCar},
+		{Name: "cdr", MinArgs: 1, MaxArgs: 1, Fn: builtinCdr},
+		{Name: "list", MinArgs: 0, MaxArgs: -1, Fn: builtinList},
+		{Name: "null?", MinArgs: 1, MaxArgs: 1, Fn: builtinIsNull},
+		{Name: "pair?", MinArgs: 1, MaxArgs: 1, Fn: builtinIsPair},
+		{Name: "map", MinArgs: 2, MaxArgs: -1, Fn: builtinMap},
+		{Name: "for-each", MinArgs: 2, MaxArgs: -1, Fn: builtinForEach},
+		{Name: "filter", MinArgs: 2, MaxArgs: 2, Fn: builtinFilter},
+		{Name: "fold", MinArgs: 3, MaxArgs: -1, Fn: builtinFold},
+		{Name: "fold-left", MinArgs: 3, MaxArgs: -1, Fn: builtinFoldLeft},
+		{Name: "fold-right", MinArgs: 3, MaxArgs: -1, Fn: builtinFoldRight},
+		{Name: "procedure?", MinArgs: 1, MaxArgs: 1, Fn: builtinIsProcedure},
+		applyBuiltin,
+		{Name: "call-with-current-continuation", MinArgs: 1, MaxArgs: 1, Fn: builtinCallCC},
+		{Name: "call/cc", MinArgs: 1, MaxArgs: 1, Fn: builtinCallCC},
+		{Name: "dynamic-wind", MinArgs: 3, MaxArgs: 3, Fn: builtinDynamicWind},
+		{Name: "raise", MinArgs: 1, MaxArgs: 1, Fn: builtinRaise},
+		{Name: "raise-continuable", MinArgs: 1, MaxArgs: 1, Fn: builtinRaiseContinuable},
+		{Name: "with-exception-handler", MinArgs: 2, MaxArgs: 2, Fn: builtinWithExceptionHandler},
+		{Name: "error", MinArgs: 1, MaxArgs: -1, Fn: builtinError},
+		{Name: "error-object?", MinArgs: 1, MaxArgs: 1, Fn: builtinIsErrorObject},
+		{Name: "error-object-message", MinArgs: 1, MaxArgs: 1, Fn: builtinErrorObjectMessage},
+		{Name: "error-object-irritants", MinArgs: 1, MaxArgs: 1, Fn: builtinErrorObjectIrritants},
+		{Name: "eval", MinArgs: 2, MaxArgs: 2, Fn: builtinEval},
+		{Name: "scheme-report-environment", MinArgs: 1, MaxArgs: 1, Fn: builtinSchemeReportEnvironment},
+		{Name: "null-environment", MinArgs: 1, MaxArgs: 1, Fn: builtinNullEnvironment},
+		{Name: "interaction-environment", MinArgs: 0, MaxArgs: 0, Fn: builtinInteractionEnvironment},
+		{Name: "force", MinArgs: 1, MaxArgs: 1, Fn: builtinForce},
+		{Name: "make-promise", MinArgs: 1, MaxArgs: 1, Fn: builtinMakePromise},
+		{Name: "promise?", MinArgs: 1, MaxArgs: 1, Fn: builtinIsPromise},
+		{Name: "command-line", MinArgs: 0, MaxArgs: 0, Fn: builtinCommandLine},
+		{Name: "exit", MinArgs: 0, MaxArgs: 1, Fn: builtinExit},
+		{Name: "spawn", MinArgs: 1, MaxArgs: 1, Fn: builtinSpawn},
+		{Name: "make-channel", MinArgs: 0, MaxArgs: 1, Fn: builtinMakeChannel},
+		{Name: "channel-send!", MinArgs: 2, MaxArgs: 2, Fn: builtinChannelSend},
+		{Name: "channel-receive", MinArgs: 1, MaxArgs: 1, Fn: builtinChannelReceive},
+		{Name: "select", MinArgs: 1, MaxArgs: -1, Fn: builtinSelect},
+	}
+}
+
+// NewStandardEnvironment returns environment with builtin procedures bound.
+func NewStandardEnvironment() *Environment {
+	env := NewEnvironment(nil)
+
+	for _, b := range builtins {
+		env.Define(b.Name, b)
+	}
+
+	return env
+}
+
+func makeBool(b bool) parser.Sexpr {
+	return parser.Bool(b)
+}
+
+func makeInt(i int64) parser.Sexpr {
+	return parser.Int(i)
+}
+
+func toNumber(s parser.Sexpr) (*number.Number, error) {
+	a, ok := s.(*parser.Atom)
+	if !ok || a.Type != parser.NUMBER {
+		return nil, fmt.Errorf("%w: number expected, got %v", WRONG_TYPE, s)
+	}
+
+	return (a.Value).(*number.Number), nil
+}
+
+func toPair(s parser.Sexpr) (*parser.Expr, error) {
+	e, ok := s.(*parser.Expr)
+	if !ok || isNull(e) {
+		return nil, fmt.Errorf("%w: pair expected, got %v", WRONG_TYPE, s)
+	}
+
+	return e, nil
+}
+
+// foldNumbers combines numbers left to right starting with first argument,
+// counting cells of results, see allocateNumber.
+func foldNumbers(ev *Evaluator, args []parser.Sexpr, fn func(a, b *number.Number) (*number.Number, error)) (parser.Sexpr, error) {
+	acc, err := toNumber(args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	for _, arg := range args[1:] {
+		n, err := toNumber(arg)
+		if err != nil {
+			return nil, err
+		}
+		if acc, err = fn(acc, n); err != nil {
+			return nil, err
+		}
+		if err := ev.allocateNumber(acc); err != nil {
+			return nil, err
+		}
+	}
+
+	return &parser.Atom{Type: parser.NUMBER, Value: acc}, nil
+}
+
+// infallible adapts number operation which cannot fail to foldNumbers.
+func infallible(op func(a, b *number.Number) *number.Number) func(a, b *number.Number) (*number.Number, error) {
+	return func(a, b *number.Number) (*number.Number, error) {
+		return op(a, b), nil
+	}
+}
+
+func builtinAdd(ev *Evaluator, args []parser.Sexpr) (parser.Sexpr, error) {
+	return foldNumbers(ev, append([]parser.Sexpr{makeInt(0)}, args...), infallible((*number.Number).Add))
+}
+
+func builtinSub(ev *Evaluator, args []parser.Sexpr) (parser.Sexpr, error) {
+	if len(args) == 1 {
+		args = append([]parser.Sexpr{makeInt(0)}, args...)
+	}
+
+	return foldNumbers(ev, args, infallible((*number.Number).Sub))
+}
+
+func builtinMul(ev *Evaluator, args []parser.Sexpr) (parser.Sexpr, error) {
+	return foldNumbers(ev, append([]parser.Sexpr{makeInt(1)}, args...), infallible((*number.Number).Mul))
+}
+
+func builtinDiv(ev *Evaluator, args []parser.Sexpr) (parser.Sexpr, error) {
+	if len(args) == 1 {
+		args = append([]parser.Sexpr{makeInt(1)}, args...)
+	}
+
+	return foldNumbers(ev, args, func(a, b *number.Number) (*number.Number, error) {
+		q, err := a.Div(b)
+		if errors.Is(err, number.DIVISION_BY_ZERO) {
+			return nil, DIVISION_BY_ZERO
+		}
+		return q, err
+	})
+}
+
+// builtinCompare checks that cmp holds for each pair of adjacent arguments.
+// Ordering comparisons accept only real numbers.
+func builtinCompare(ordering bool, cmp func(a, b *number.Number) bool) func(*Evaluator, []parser.Sexpr) (parser.Sexpr, error) {
+	return func(_ *Evaluator, args []parser.Sexpr) (parser.Sexpr, error) {
+		nums := make([]*number.Number, len(args))
+
+		for i, arg := range args {
+			n, err := toNumber(arg)
+			if err != nil {
+				return nil, err
+			}
+			if ordering && !n.IsReal() {
+				return nil, fmt.Errorf("%w: real number expected, got %v", WRONG_TYPE, arg)
+			}
+			nums[i] = n
+		}
+
+		for i := 1; i < len(nums); i++ {
+			if !cmp(nums[i-1], nums[i]) {
+				return makeBool(false), nil
+			}
+		}
+
+		return makeBool(true), nil
+	}
+}
+
+// builtinIsNumberKind returns type predicate which is false for non-numbers.
+func builtinIsNumberKind(pred func(*number.Number) bool) func(*Evaluator, []parser.Sexpr) (parser.Sexpr, error) {
+	return func(_ *Evaluator, args []parser.Sexpr) (parser.Sexpr, error) {
+		n, err := toNumber(args[0])
+		return makeBool(err == nil && pred(n)), nil
+	}
+}
+
+// builtinNumberPredicate returns predicate which accepts only numbers.
+func builtinNumberPredicate(pred func(*number.Number) bool) func(*Evaluator, []parser.Sexpr) (parser.Sexpr, error) {
+	return func(_ *Evaluator, args []parser.Sexpr) (parser.Sexpr, error) {
+		n, err := toNumber(args[0])
+		if err != nil {
+			return nil, err
+		}
+
+		return makeBool(pred(n)), nil
+	}
+}
+
+func builtinNumberToString(_ *Evaluator, args []parser.Sexpr) (parser.Sexpr, error) {
+	n, err := toNumber(args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	radix, err := toRadix(args[1:])
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := n.Format(radix)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", WRONG_TYPE, err)
+	}
+
+	return &parser.Atom{Type: parser.STRING, Value: s}, nil
+}
+
+// builtinStringToNumber returns number denoted by string, or #f if string is
+// not a valid number literal.
+func builtinStringToNumber(_ *Evaluator, args []parser.Sexpr) (parser.Sexpr, error) {
+	a, ok := args[0].(*parser.Atom)
+	if !ok || a.Type != parser.STRING {
+		return nil, fmt.Errorf("%w: string expected, got %v", WRONG_TYPE, args[0])
+	}
+
+	radix, err := toRadix(args[1:])
+	if err != nil {
+		return nil, err
+	}
+
+	n, err := number.Parse((a.Value).(string), radix)
+	if err != nil {
+		return makeBool(false), nil
+	}
+
+	return &parser.Atom{Type: parser.NUMBER, Value: n}, nil
+}
+
+// toRadix returns radix given by optional argument, which defaults to 10.
+func toRadix(args []parser.Sexpr) (int, error) {
+	if len(args) == 0 {
+		return 10, nil
+	}
+
+	n, err := toNumber(args[0])
+	if err != nil {
+		return 0, err
+	}
+
+	if i := n.Integer(); i != nil && i.IsInt64() {
+		switch radix := int(i.Int64()); radix {
+		case 2, 8, 10, 16:
+			return radix, nil
+		}
+	}
+
+	return 0, fmt.Errorf("%w: radix must be 2, 8, 10 or 16, got %v", WRONG_TYPE, args[0])
+}
+
+func builtinIsType(t parser.AtomType) func(*Evaluator, []parser.Sexpr) (parser.Sexpr, error) {
+	return func(_ *Evaluator, args []parser.Sexpr) (parser.Sexpr, error) {
+		a, ok := args[0].(*parser.Atom)
+		return makeBool(ok && a.Type == t), nil
+	}
+}
+
+func builtinIsVector(_ *Evaluator, args []parser.Sexpr) (parser.Sexpr, error) {
+	_, ok := args[0].(*parser.Vector)
+	return makeBool(ok), nil
+}
+
+func builtinNot(_ *Evaluator, args []parser.Sexpr) (parser.Sexpr, error) {
+	return makeBool(!IsTrue(args[0])), nil
+}
+
+func builtinEq(_ *Evaluator, args []parser.Sexpr) (parser.Sexpr, error) {
+	return makeBool(parser.Eq(args[0], args[1])), nil
+}
+
+func builtinEqv(_ *Evaluator, args []parser.Sexpr) (parser.Sexpr, error) {
+	return makeBool(parser.Eqv(args[0], args[1])), nil
+}
+
+func builtinEqual(_ *Evaluator, args []parser.Sexpr) (parser.Sexpr, error) {
+	return makeBool(parser.Equal(args[0], args[1])), nil
+}
+
+func builtinCons(ev *Evaluator, args []parser.Sexpr) (parser.Sexpr, error) {
+	if err := ev.Allocate(1); err != nil {
+		return nil, err
+	}
+
+	return &parser.Expr{Car: args[0], Cdr: args[1]}, nil
+}
+
+func builtinCar(_ *Evaluator, args []parser.Sexpr) (parser.Sexpr, error) {
+	pair, err := toPair(args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	return pair.Car, nil
+}
+
+func builtinCdr(_ *Evaluator, args []parser.Sexpr) (parser.Sexpr, error) {
+	pair, err := toPair(args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	return pair.Cdr, nil
+}
+
+func builtinList(ev *Evaluator, args []parser.Sexpr) (parser.Sexpr, error) {
+	if err := ev.Allocate(len(args)); err != nil {
+		return nil, err
+	}
+
+	return sliceToList(args, parser.Nil), nil
+}
+
+func builtinIsNull(_ *Evaluator, args []parser.Sexpr) (parser.Sexpr, error) {
+	return makeBool(isNull(args[0])), nil
+}
+
+func builtinIsPair(_ *Evaluator, args []parser.Sexpr) (parser.Sexpr, error) {
+	_, err := toPair(args[0])
+	return makeBool(err == nil), nil
+}
+
+func builtinIsProcedure(_ *Evaluator, args []parser.Sexpr) (parser.Sexpr, error) {
+	return makeBool(IsProcedure(args[0])), nil
+}
+
+// IsProcedure reports whether s is procedure, e.g. builtin or closure.
+func IsProcedure(s parser.Sexpr) bool {
+	switch s.(type) {
+	case *Builtin, *Closure, *Continuation, Applier:
+		return true
+	default:
+		return false
+	}
+}
+
+// builtinApply calls procedure with arguments between it and the last one,
+// followed by elements of the last one, which must be a list.
+func builtinApply(ev *Evaluator, args []parser.Sexpr) (parser.Sexpr, error) {
+	proc, callArgs, err := spreadArgs(args)
+	if err != nil {
+		return nil, err
+	}
+
+	return ev.Apply(proc, callArgs)
+}
+
+// spreadArgs returns procedure and arguments apply calls it with given its
+// arguments args.
+func spreadArgs(args []parser.Sexpr) (parser.Sexpr, []parser.Sexpr, error) {
+	spread, err := listToSlice(args[len(args)-1])
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: apply expects list as last argument, got %v", WRONG_TYPE, args[len(args)-1])
+	}
+
+	callArgs := make([]parser.Sexpr, 0, len(args)-2+len(spread))
+	callArgs = append(callArgs, args[1:len(args)-1]...)
+	callArgs = append(callArgs, spread...)
+
+	return args[0], callArgs, nil
+}
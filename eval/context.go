@@ -0,0 +1,54 @@
+package eval
+
+import (
+	"context"
+)
+
+// Interrupted is error evaluation stops with once its context is done or it
+// exceeds its limits. Err is error of context, e.g. context.DeadlineExceeded,
+// or wraps RESOURCE_LIMIT. Like Exit, it unwinds evaluation, and guard and
+// exception handlers don't catch it, so programs can't keep running after
+// they are cancelled.
+type Interrupted struct {
+	Err error
+}
+
+func (i *Interrupted) Error() string {
+	return "evaluation interrupted: " + i.Err.Error()
+}
+
+func (i *Interrupted) Unwrap() error {
+	return i.Err
+}
+
+// SetContext makes evaluation stop with Interrupted at the next step, see
+// Step, once ctx is done. Nil ctx removes context of ev.
+func (ev *Evaluator) SetContext(ctx context.Context) {
+	ev.ctx, ev.done = ctx, nil
+	if ctx != nil {
+		ev.done = ctx.Done()
+	}
+}
+
+// Context returns context of ev, or background context if it has none.
+func (ev *Evaluator) Context() context.Context {
+	if ev.ctx == nil {
+		return context.Background()
+	}
+
+	return ev.ctx
+}
+
+// checkContext returns Interrupted if context of ev is done.
+func (ev *Evaluator) checkContext() error {
+	if ev.done == nil {
+		return nil
+	}
+
+	select {
+	case <-ev.done:
+		return &Interrupted{Err: ev.ctx.Err()}
+	default:
+		return nil
+	}
+}
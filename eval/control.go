@@ -0,0 +1,83 @@
+package eval
+
+import (
+	"errors"
+	"github.com/vkhonin/scheme/parser"
+)
+
+// Continuation is an escaping continuation captured by call/cc. It can be
+// invoked only while call/cc which captured it has not returned; invoking it
+// then unwinds evaluation back to that call/cc. Re-entering continuation
+// after its extent has ended is reported as CONTINUATION_EXPIRED.
+type Continuation struct {
+	active bool
+}
+
+// continuationInvoked is error used to unwind Go stack up to call/cc which
+// captured continuation k.
+type continuationInvoked struct {
+	k     *Continuation
+	value parser.Sexpr
+}
+
+func (k *Continuation) Equals(s parser.Sexpr) bool {
+	k2, ok := s.(*Continuation)
+	return ok && k == k2
+}
+
+func (*Continuation) String() string {
+	return "#<continuation>"
+}
+
+func (*continuationInvoked) Error() string {
+	return "continuation invoked outside of call/cc"
+}
+
+// invoke passes value to continuation by unwinding to its call/cc.
+func (k *Continuation) invoke(args []parser.Sexpr) (parser.Sexpr, error) {
+	if !k.active {
+		return nil, CONTINUATION_EXPIRED
+	}
+
+	value := Unspecified
+	if len(args) > 0 {
+		value = args[0]
+	}
+
+	return nil, &continuationInvoked{k: k, value: value}
+}
+
+func builtinCallCC(ev *Evaluator, args []parser.Sexpr) (parser.Sexpr, error) {
+	k := &Continuation{active: true}
+
+	result, err := ev.Apply(args[0], []parser.Sexpr{k})
+
+	k.active = false
+
+	var invoked *continuationInvoked
+	if errors.As(err, &invoked) && invoked.k == k {
+		return invoked.value, nil
+	}
+
+	return result, err
+}
+
+// builtinDynamicWind calls before, thunk and after in order. After is called
+// however thunk exits, including escape by continuation or error, so it runs
+// whenever control leaves dynamic extent of thunk. Since continuations are
+// escaping, control never re-enters that extent once it is left.
+func builtinDynamicWind(ev *Evaluator, args []parser.Sexpr) (parser.Sexpr, error) {
+	before, thunk, after := args[0], args[1], args[2]
+
+	if _, err := ev.Apply(before, nil); err != nil {
+		return nil, err
+	}
+
+	result, err := ev.Apply(thunk, nil)
+
+	if _, afterErr := ev.Apply(after, nil); afterErr != nil {
+		return nil, afterErr
+	}
+
+	return result, err
+}
@@ -0,0 +1,135 @@
+package eval
+
+import (
+	"fmt"
+	"github.com/vkhonin/scheme/parser"
+	"slices"
+	"sync"
+	"sync/atomic"
+)
+
+// Environment is a frame of variable bindings with optional parent frame.
+// Lookup walks the parent chain, which gives lexical scoping when closures
+// extend the environment they were created in. Frames and bindings may be
+// used by tasks of spawn concurrently; lookups do not lock, as names are
+// bound once and then only read. Each read and assignment of variable is
+// atomic, though sequences of them, e.g. incrementing counter, are not.
+type Environment struct {
+	mu     sync.Mutex // Serializes definitions
+	vars   sync.Map   // Name to *Binding
+	parent *Environment
+	names  atomic.Uint64 // Number of names ever bound in this frame
+}
+
+// Binding is variable bound in environment frame. Assignments and
+// definitions of bound variable change its value in place, so binding may be
+// kept to read current value of variable without looking it up again.
+type Binding struct {
+	value atomic.Pointer[parser.Sexpr]
+}
+
+func NewEnvironment(parent *Environment) *Environment {
+	return &Environment{parent: parent}
+}
+
+func (e *Environment) Equals(s parser.Sexpr) bool {
+	e2, ok := s.(*Environment)
+	return ok && e == e2
+}
+
+func (*Environment) String() string {
+	return "#<environment>"
+}
+
+func (e *Environment) Parent() *Environment {
+	return e.parent
+}
+
+// Define binds name in this frame, replacing value of existing binding if
+// any.
+func (e *Environment) Define(name string, value parser.Sexpr) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if b, ok := e.vars.Load(name); ok {
+		b.(*Binding).Set(value)
+		return
+	}
+
+	b := &Binding{}
+	b.Set(value)
+	e.vars.Store(name, b)
+	e.names.Add(1)
+}
+
+// Lookup returns value bound to name in this frame or closest parent.
+func (e *Environment) Lookup(name string) (parser.Sexpr, error) {
+	b, err := e.Binding(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return b.Value(), nil
+}
+
+// Set rebinds name in frame where it is bound.
+func (e *Environment) Set(name string, value parser.Sexpr) error {
+	b, err := e.Binding(name)
+	if err != nil {
+		return err
+	}
+
+	b.Set(value)
+
+	return nil
+}
+
+// Binding returns binding of name in this frame or closest parent. It stays
+// binding name refers to until Version of e changes.
+func (e *Environment) Binding(name string) (*Binding, error) {
+	for env := e; env != nil; env = env.parent {
+		if b, ok := env.vars.Load(name); ok {
+			return b.(*Binding), nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: %s", UNBOUND_VARIABLE, name)
+}
+
+// Version returns number that changes whenever new name is bound in this
+// frame or its parents, which may make names refer to other bindings, e.g.
+// definition in this frame shadowing one in parent.
+func (e *Environment) Version() uint64 {
+	var version uint64
+	for env := e; env != nil; env = env.parent {
+		version += env.names.Load()
+	}
+
+	return version
+}
+
+// Value returns current value of variable.
+func (b *Binding) Value() parser.Sexpr {
+	return *b.value.Load()
+}
+
+// Set assigns value to variable.
+func (b *Binding) Set(value parser.Sexpr) {
+	b.value.Store(&value)
+}
+
+// Names returns sorted names bound in this frame and its parents.
+func (e *Environment) Names() []string {
+	var names []string
+
+	for env := e; env != nil; env = env.parent {
+		env.vars.Range(func(name, _ any) bool {
+			names = append(names, name.(string))
+			return true
+		})
+	}
+
+	slices.Sort(names)
+
+	return slices.Compact(names)
+}
@@ -0,0 +1,75 @@
+package eval
+
+import (
+	"fmt"
+	"github.com/vkhonin/scheme/parser"
+	"github.com/vkhonin/scheme/parser/number"
+	"math/big"
+)
+
+// reportVersion is the only version accepted by scheme-report-environment and
+// null-environment.
+const reportVersion = 5
+
+// NewNullEnvironment returns environment without variable bindings. Special
+// forms are recognized by evaluator itself, so they are available in it.
+func NewNullEnvironment() *Environment {
+	return NewEnvironment(nil)
+}
+
+func toEnvironment(s parser.Sexpr) (*Environment, error) {
+	env, ok := s.(*Environment)
+	if !ok {
+		return nil, fmt.Errorf("%w: environment expected, got %v", WRONG_TYPE, s)
+	}
+
+	return env, nil
+}
+
+// checkReportVersion validates version argument of report environment
+// procedures.
+func checkReportVersion(s parser.Sexpr) error {
+	n, err := toNumber(s)
+	if err != nil {
+		return err
+	}
+
+	if n.Inexact() || !n.Equal(number.NewFromInt(big.NewInt(reportVersion))) {
+		return fmt.Errorf("%w: %v", UNSUPPORTED_VERSION, s)
+	}
+
+	return nil
+}
+
+func builtinEval(ev *Evaluator, args []parser.Sexpr) (parser.Sexpr, error) {
+	env, err := toEnvironment(args[1])
+	if err != nil {
+		return nil, err
+	}
+
+	return ev.Eval(args[0], env)
+}
+
+func builtinSchemeReportEnvironment(_ *Evaluator, args []parser.Sexpr) (parser.Sexpr, error) {
+	if err := checkReportVersion(args[0]); err != nil {
+		return nil, err
+	}
+
+	return NewStandardEnvironment(), nil
+}
+
+func builtinNullEnvironment(_ *Evaluator, args []parser.Sexpr) (parser.Sexpr, error) {
+	if err := checkReportVersion(args[0]); err != nil {
+		return nil, err
+	}
+
+	return NewNullEnvironment(), nil
+}
+
+func builtinInteractionEnvironment(ev *Evaluator, _ []parser.Sexpr) (parser.Sexpr, error) {
+	if ev.interaction == nil {
+		ev.interaction = NewStandardEnvironment()
+	}
+
+	return ev.interaction, nil
+}
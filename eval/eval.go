@@ -0,0 +1,434 @@
+package eval
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/vkhonin/scheme/macro"
+	"github.com/vkhonin/scheme/parser"
+	"slices"
+)
+
+var (
+	BAD_SYNTAX           = errors.New("bad syntax")
+	CONTINUATION_EXPIRED = errors.New("continuation invoked after its extent ended")
+	DIVISION_BY_ZERO     = errors.New("division by zero")
+	HANDLER_RETURNED     = errors.New("exception handler returned from non-continuable raise")
+	NOT_A_PROCEDURE      = errors.New("not a procedure")
+	RESOURCE_LIMIT       = errors.New("resource limit exceeded")
+	UNASSIGNED           = errors.New("variable used before its definition")
+	UNBOUND_VARIABLE     = errors.New("unbound variable")
+	WRONG_ARITY          = errors.New("wrong number of arguments")
+	UNSUPPORTED_VERSION  = errors.New("unsupported report version")
+	WRONG_TYPE           = errors.New("wrong type argument")
+)
+
+var (
+	// Unspecified is value of expressions whose value is unspecified by report.
+	Unspecified parser.Sexpr = &unspecified{}
+
+	// unassigned is value of letrec and internal define variables until their
+	// initializers are evaluated.
+	unassigned parser.Sexpr = &unassignedValue{}
+
+	specialForms map[string]specialForm
+)
+
+// Evaluator holds dynamic state of evaluation. Zero value is ready to use.
+type Evaluator struct {
+	// handlers is stack of exception handlers installed by
+	// with-exception-handler and guard, innermost last. Guard is recorded as
+	// nil entry, since it catches raised object by unwinding to itself.
+	handlers []parser.Sexpr
+
+	// CommandLine is list command-line procedure returns, e.g. script and
+	// its arguments.
+	CommandLine []string
+
+	// interaction is environment returned by interaction-environment. It is
+	// environment of the first RunProgram call, or new standard environment
+	// if procedure is called before that.
+	interaction *Environment
+
+	// macros are macros defined by programs run, which RunProgram expands.
+	macros macro.Expander
+
+	// ctx is context evaluation stops once it is done, see SetContext, and
+	// done is its Done channel.
+	ctx  context.Context
+	done <-chan struct{}
+
+	// Limits bound resources programs may use, which are counted by steps,
+	// cells and depth.
+	Limits Limits
+	steps  int64
+	cells  int64
+	depth  int
+}
+
+// Backend runs programs, e.g. Evaluator, which evaluates expressions as they
+// are, or bytecode machine, which compiles them first.
+type Backend interface {
+	RunProgram(program []parser.Sexpr, env *Environment) (parser.Sexpr, error)
+}
+
+// specialForm evaluates form with given operands. When returned environment
+// is not nil, returned Sexpr is an expression in tail position that must be
+// evaluated in that environment; otherwise it is the value of the form.
+type specialForm func(ev *Evaluator, operands parser.Sexpr, env *Environment) (parser.Sexpr, *Environment, error)
+
+// unspecified and unassignedValue are not empty, since pointers to distinct
+// zero-size values may be equal, which would make sentinels of these types
+// indistinguishable.
+type unspecified struct{ _ byte }
+
+type unassignedValue struct{ _ byte }
+
+func (u *unspecified) Equals(s parser.Sexpr) bool {
+	return u == s
+}
+
+func (*unspecified) String() string {
+	return "#<unspecified>"
+}
+
+func (u *unassignedValue) Equals(s parser.Sexpr) bool {
+	return u == s
+}
+
+func (*unassignedValue) String() string {
+	return "#<unassigned>"
+}
+
+func init() {
+	specialForms = map[string]specialForm{
+		"and":         evalAnd,
+		"begin":       evalBegin,
+		"case":        evalCase,
+		"cond":        evalCond,
+		"define":      evalDefine,
+		"delay":       evalDelay,
+		"delay-force": evalDelayForce,
+		"do":          evalDo,
+		"guard":       evalGuard,
+		"if":          evalIf,
+		"lambda":      evalLambda,
+		"let":         evalLet,
+		"let*":        evalLetStar,
+		"letrec":      evalLetrec,
+		"letrec*":     evalLetrec,
+		"or":          evalOr,
+		"quasiquote":  evalQuasiquote,
+		"quote":       evalQuote,
+		"set!":        evalSet,
+		"unless":      evalUnless,
+		"when":        evalWhen,
+	}
+}
+
+// SpecialForms returns sorted keywords of special forms, e.g. if and lambda,
+// which are not bound in environments.
+func SpecialForms() []string {
+	keywords := make([]string, 0, len(specialForms))
+	for keyword := range specialForms {
+		keywords = append(keywords, keyword)
+	}
+
+	slices.Sort(keywords)
+
+	return keywords
+}
+
+// RunProgram evaluates program datums in order in new standard environment
+// and returns value of the last one.
+func RunProgram(program []parser.Sexpr) (parser.Sexpr, error) {
+	return (&Evaluator{}).RunProgram(program, NewStandardEnvironment())
+}
+
+// Eval evaluates sexpr in env with new Evaluator.
+func Eval(sexpr parser.Sexpr, env *Environment) (parser.Sexpr, error) {
+	return (&Evaluator{}).Eval(sexpr, env)
+}
+
+// Eval evaluates sexpr in env. Calls in tail position, and bodies of
+// special forms in it, are evaluated in loop, so they don't nest.
+func (ev *Evaluator) Eval(sexpr parser.Sexpr, env *Environment) (parser.Sexpr, error) {
+	defer ev.Leave(1)
+	if err := ev.Enter(); err != nil {
+		return nil, err
+	}
+
+	return ev.eval(sexpr, env)
+}
+
+func (ev *Evaluator) eval(sexpr parser.Sexpr, env *Environment) (parser.Sexpr, error) {
+	for {
+		switch s := sexpr.(type) {
+		case *parser.Atom:
+			if s.Type == parser.SYMBOL {
+				value, err := env.Lookup((s.Value).(string))
+				if value == unassigned {
+					return nil, fmt.Errorf("%w: %s", UNASSIGNED, (s.Value).(string))
+				}
+				return value, err
+			}
+			return s, nil
+		case *parser.Expr:
+			if isNull(s) {
+				return nil, fmt.Errorf("%w: empty combination", BAD_SYNTAX)
+			}
+
+			if err := ev.Step(); err != nil {
+				return nil, err
+			}
+
+			if name, ok := symbolName(s.Car); ok {
+				if form, ok := specialForms[name]; ok {
+					result, tailEnv, err := form(ev, s.Cdr, env)
+					if err != nil || tailEnv == nil {
+						return result, err
+					}
+					sexpr, env = result, tailEnv
+					continue
+				}
+			}
+
+			proc, err := ev.Eval(s.Car, env)
+			if err != nil {
+				return nil, err
+			}
+
+			operands, err := listToSlice(s.Cdr)
+			if err != nil {
+				return nil, fmt.Errorf("%w: improper combination", BAD_SYNTAX)
+			}
+
+			args := make([]parser.Sexpr, len(operands))
+			for i, operand := range operands {
+				if args[i], err = ev.Eval(operand, env); err != nil {
+					return nil, err
+				}
+			}
+
+			if proc, args, err = Applied(proc, args); err != nil {
+				return nil, err
+			}
+
+			closure, ok := proc.(*Closure)
+			if !ok {
+				return ev.Apply(proc, args)
+			}
+
+			if env, err = closure.bind(ev, args); err != nil {
+				return nil, err
+			}
+			if sexpr, err = ev.evalBody(closure.Body, env); err != nil {
+				return nil, err
+			}
+		default:
+			return s, nil
+		}
+	}
+}
+
+// RunProgram evaluates program datums in order in env and returns value of
+// the last one. Evaluation stops at first error. Macros are expanded before
+// each datum is evaluated, so macros defined by datum, or by earlier programs
+// run by ev, may be used by data following it, see macro.Expander.
+func (ev *Evaluator) RunProgram(program []parser.Sexpr, env *Environment) (parser.Sexpr, error) {
+	ev.InitInteraction(env)
+
+	result := Unspecified
+
+	for _, sexpr := range program {
+		expanded, err := ev.macros.Expand([]parser.Sexpr{sexpr})
+		if err != nil {
+			return nil, err
+		}
+
+		result = Unspecified
+		for _, sexpr := range expanded {
+			if result, err = ev.Eval(sexpr, env); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// InitInteraction makes env environment interaction-environment returns,
+// unless ev has one already. RunProgram calls it with its environment, and so
+// should other backends running programs with ev.
+func (ev *Evaluator) InitInteraction(env *Environment) {
+	if ev.interaction == nil {
+		ev.interaction = env
+	}
+}
+
+// Expander returns expander of macros RunProgram expands.
+func (ev *Evaluator) Expander() *macro.Expander {
+	return &ev.macros
+}
+
+// Applied returns procedure and arguments call of proc with args calls: those
+// apply is given if proc is apply, and proc and args otherwise. Backends call
+// them rather than apply, so that apply in tail position is tail call.
+func Applied(proc parser.Sexpr, args []parser.Sexpr) (parser.Sexpr, []parser.Sexpr, error) {
+	for proc == applyBuiltin {
+		if len(args) < applyBuiltin.MinArgs {
+			return nil, nil, fmt.Errorf("%w: %s called with %d", WRONG_ARITY, applyBuiltin.Name, len(args))
+		}
+
+		var err error
+		if proc, args, err = spreadArgs(args); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return proc, args, nil
+}
+
+// Apply calls procedure proc with already evaluated args.
+func (ev *Evaluator) Apply(proc parser.Sexpr, args []parser.Sexpr) (parser.Sexpr, error) {
+	switch p := proc.(type) {
+	case *Builtin:
+		if len(args) < p.MinArgs || (p.MaxArgs >= 0 && len(args) > p.MaxArgs) {
+			return nil, fmt.Errorf("%w: %s called with %d", WRONG_ARITY, p.Name, len(args))
+		}
+		return p.Fn(ev, args)
+	case *Closure:
+		env, err := p.bind(ev, args)
+		if err != nil {
+			return nil, err
+		}
+		return ev.evalSequence(p.Body, env)
+	case *Continuation:
+		return p.invoke(args)
+	case Applier:
+		return p.Apply(ev, args)
+	default:
+		return nil, fmt.Errorf("%w: %v", NOT_A_PROCEDURE, proc)
+	}
+}
+
+// evalSequence evaluates body and returns value of the last expression.
+func (ev *Evaluator) evalSequence(body []parser.Sexpr, env *Environment) (parser.Sexpr, error) {
+	last, err := ev.evalBody(body, env)
+	if err != nil {
+		return nil, err
+	}
+
+	return ev.Eval(last, env)
+}
+
+// declareDefines binds names of internal definitions at the beginning of body
+// as unassigned in env, which gives them letrec* semantics: they shadow outer
+// bindings in the whole body but cannot be referenced before definition.
+func declareDefines(body []parser.Sexpr, env *Environment) {
+	for _, sexpr := range body {
+		form, ok := sexpr.(*parser.Expr)
+		if !ok {
+			return
+		}
+
+		if isSymbol(form.Car, "begin") {
+			if nested, err := listToSlice(form.Cdr); err == nil {
+				declareDefines(nested, env)
+			}
+			continue
+		}
+
+		if !isSymbol(form.Car, "define") {
+			return
+		}
+
+		target, ok := form.Cdr.(*parser.Expr)
+		if !ok || isNull(target) {
+			return
+		}
+
+		if signature, ok := target.Car.(*parser.Expr); ok && !isNull(signature) {
+			target = signature
+		}
+
+		if name, ok := symbolName(target.Car); ok {
+			env.Define(name, unassigned)
+		}
+	}
+}
+
+// evalBody evaluates all but last expression of body and returns the last
+// one, which is in tail position.
+func (ev *Evaluator) evalBody(body []parser.Sexpr, env *Environment) (parser.Sexpr, error) {
+	for _, sexpr := range body[:len(body)-1] {
+		if _, err := ev.Eval(sexpr, env); err != nil {
+			return nil, err
+		}
+	}
+
+	return body[len(body)-1], nil
+}
+
+// IsTrue reports whether value counts as true in conditionals, i.e. is not #f.
+func IsTrue(value parser.Sexpr) bool {
+	a, ok := value.(*parser.Atom)
+	return !ok || a.Type != parser.BOOL || (a.Value).(bool)
+}
+
+// isNull reports whether s is empty list, which is parser.Nil or, for data
+// built by hand, any pair with nil Car and Cdr.
+func isNull(s parser.Sexpr) bool {
+	if s == parser.Nil {
+		return true
+	}
+
+	e, ok := s.(*parser.Expr)
+	return ok && e.Car == nil && e.Cdr == nil
+}
+
+func isSymbol(s parser.Sexpr, name string) bool {
+	n, ok := symbolName(s)
+	return ok && n == name
+}
+
+func symbolName(s parser.Sexpr) (string, bool) {
+	a, ok := s.(*parser.Atom)
+	if !ok || a.Type != parser.SYMBOL {
+		return "", false
+	}
+
+	return (a.Value).(string), true
+}
+
+// listToSlice returns elements of proper list s.
+func listToSlice(s parser.Sexpr) ([]parser.Sexpr, error) {
+	var items []parser.Sexpr
+
+	for !isNull(s) {
+		e, ok := s.(*parser.Expr)
+		if !ok {
+			return nil, fmt.Errorf("%w: proper list expected", WRONG_TYPE)
+		}
+		items = append(items, e.Car)
+		s = e.Cdr
+	}
+
+	return items, nil
+}
+
+// quoted returns expression evaluating to s.
+func quoted(s parser.Sexpr) parser.Sexpr {
+	return sliceToList([]parser.Sexpr{parser.Intern("quote"), s}, parser.Nil)
+}
+
+// sliceToList returns proper list of items ending with tail.
+func sliceToList(items []parser.Sexpr, tail parser.Sexpr) parser.Sexpr {
+	list := tail
+
+	for i := len(items) - 1; i >= 0; i-- {
+		list = &parser.Expr{Car: items[i], Cdr: list}
+	}
+
+	return list
+}
@@ -0,0 +1,935 @@
+package eval_test
+
+import (
+	"context"
+	"errors"
+	"github.com/vkhonin/scheme/eval"
+	"github.com/vkhonin/scheme/lexer"
+	"github.com/vkhonin/scheme/macro"
+	"github.com/vkhonin/scheme/parser"
+	"slices"
+	"strings"
+	"testing"
+)
+
+type testCase struct {
+	Description string
+	Input       string
+	Output      string
+}
+
+type errorTestCase struct {
+	Description string
+	Input       string
+	Error       error
+}
+
+func read(t *testing.T, src string) []parser.Sexpr {
+	t.Helper()
+
+	var tokens []lexer.Token
+
+	for token, err := range lexer.New(strings.NewReader(src)).Tokens() {
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		tokens = append(tokens, token)
+	}
+
+	p := parser.Parser{Tokens: tokens}
+
+	program, err := p.Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return program
+}
+
+// evalAll evaluates every datum of src in env and returns the last value.
+func evalAll(t *testing.T, src string, env *eval.Environment) (parser.Sexpr, error) {
+	t.Helper()
+
+	return (&eval.Evaluator{}).RunProgram(read(t, src), env)
+}
+
+func runTestCases(t *testing.T, testCases []testCase) {
+	t.Helper()
+
+	for _, c := range testCases {
+		result, err := evalAll(t, c.Input, eval.NewStandardEnvironment())
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", c.Description, err)
+			continue
+		}
+
+		expected := read(t, c.Output)[0]
+
+		if !result.Equals(expected) {
+			t.Errorf("%s: expected %v got %v", c.Description, expected, result)
+		}
+	}
+}
+
+func runErrorTestCases(t *testing.T, testCases []errorTestCase) {
+	t.Helper()
+
+	for _, c := range testCases {
+		_, err := evalAll(t, c.Input, eval.NewStandardEnvironment())
+		if !errors.Is(err, c.Error) {
+			t.Errorf("%s: expected error %v got %v", c.Description, c.Error, err)
+		}
+	}
+}
+
+func TestEval(t *testing.T) {
+	runTestCases(t, []testCase{
+		{"Self-evaluating number", "42", "42"},
+		{"Self-evaluating string", `"s"`, `"s"`},
+		{"Self-evaluating boolean", "#t", "#t"},
+		{"Quote symbol", "'a", "a"},
+		{"Quote list", "(quote (a b . c))", "(a b . c)"},
+		{"Addition", "(+ 1 2 3)", "6"},
+		{"Inexact contagion", "(+ 1 2.5)", "3.5"},
+		{"Exact rational division", "(/ 1 3)", "1/3"},
+		{"Exact rational sum", "(+ 1/3 2/3)", "1"},
+		{"Exact complex product", "(* 1/2+1/2i 1/2-1/2i)", "1/2"},
+		{"Big integer product", "(* 4294967296 4294967296 4294967296)", "79228162514264337593543950336"},
+		{"Negation", "(- 5)", "-5"},
+		{"Nested application", "(* (+ 1 2) (- 10 4))", "18"},
+		{"Comparison chain", "(< 1 2 3)", "#t"},
+		{"Broken comparison chain", "(< 1 3 2)", "#f"},
+		{"Exact and inexact equal", "(= 1/2 0.5)", "#t"},
+		{"Big integer comparison", "(< 100000000000000000000 100000000000000000001)", "#t"},
+		{"Less or equal chain", "(<= 1 1 2)", "#t"},
+		{"Complex equality", "(= 1+2i 1+2i)", "#t"},
+		{"Integer predicate on inexact", "(integer? 3.0)", "#t"},
+		{"Rational predicate on complex", "(rational? 1+2i)", "#f"},
+		{"Real predicate on non-number", "(real? 'a)", "#f"},
+		{"Exact predicate", "(list (exact? 1/2) (inexact? 1/2))", "(#t #f)"},
+		{"Zero predicate", "(zero? 0.0)", "#t"},
+		{"Number to string", "(number->string 1/3)", `"1/3"`},
+		{"Number to string with radix", "(number->string 255 16)", `"ff"`},
+		{"Infinite complex to string with radix", "(number->string +inf.0i 16)", `"#i+inf.0i"`},
+		{"String to number", `(string->number "1/3")`, "1/3"},
+		{"String to number with radix", `(string->number "ff" 16)`, "255"},
+		{"String to number with prefix", `(string->number "#b101" 16)`, "5"},
+		{"String to number with uppercase letters", `(string->number "#XFF")`, "255"},
+		{"Invalid string to number", `(string->number "abc")`, "#f"},
+		{"List construction", "(cons 1 (list 2 3))", "(1 2 3)"},
+		{"Car and cdr", "(car (cdr '(1 2 3)))", "2"},
+		{"Null predicate", "(null? '())", "#t"},
+		{"Eq on symbols", "(eq? 'a 'a)", "#t"},
+		{"Equal on lists", "(equal? '(1 (2)) (list 1 (list 2)))", "#t"},
+		{"Eq on strings", `(define s "a") (list (eq? s s) (eq? "a" "a") (eq? #t #t) (eq? '() '()))`, "(#t #f #t #t)"},
+		{"Eqv on numbers", `(list (eqv? 1.5 1.5) (eqv? 2 2.0) (eqv? #\a #\a) (eqv? "a" "a"))`, "(#t #f #t #f)"},
+		{"Equal on strings", `(list (equal? "a" "a") (equal? #u8(1) #u8(1)) (equal? 2 2.0))`, "(#t #t #f)"},
+		{"Not", "(not 0)", "#f"},
+		{"Self-evaluating vector", "#(1 (a) #(b))", "#(1 (a) #(b))"},
+		{"Vector predicate", "(list (vector? #(1)) (vector? '(1)) (vector? \"v\"))", "(#t #f #f)"},
+		{"Eqv on vectors", "(define v #(1)) (list (eqv? v v) (eqv? #() #()) (equal? #(1) #(1)))", "(#t #f #t)"},
+	})
+}
+
+func TestEval_Errors(t *testing.T) {
+	runErrorTestCases(t, []errorTestCase{
+		{"Unbound variable", "undefined-variable", eval.UNBOUND_VARIABLE},
+		{"Not a procedure", "(1 2)", eval.NOT_A_PROCEDURE},
+		{"Wrong arity", "(car 1 2)", eval.WRONG_ARITY},
+		{"Wrong type", "(car 1)", eval.WRONG_TYPE},
+		{"Division by zero", "(/ 1 0)", eval.DIVISION_BY_ZERO},
+		{"Ordering complex numbers", "(< 1 1+2i)", eval.WRONG_TYPE},
+		{"Exact predicate on non-number", "(exact? 'a)", eval.WRONG_TYPE},
+		{"Unsupported radix", "(number->string 1 3)", eval.WRONG_TYPE},
+		{"Empty combination", "()", eval.BAD_SYNTAX},
+	})
+}
+
+func TestEnvironment(t *testing.T) {
+	parent := eval.NewEnvironment(nil)
+	child := eval.NewEnvironment(parent)
+
+	parent.Define("x", &parser.Atom{Type: parser.SYMBOL, Value: "parent"})
+	child.Define("y", &parser.Atom{Type: parser.SYMBOL, Value: "child"})
+
+	if _, err := child.Lookup("x"); err != nil {
+		t.Errorf("expected x to be visible from child, got %v", err)
+	}
+
+	if _, err := parent.Lookup("y"); !errors.Is(err, eval.UNBOUND_VARIABLE) {
+		t.Errorf("expected y to be unbound in parent, got %v", err)
+	}
+
+	if err := child.Set("x", &parser.Atom{Type: parser.SYMBOL, Value: "set"}); err != nil {
+		t.Error(err)
+	}
+
+	if x, _ := parent.Lookup("x"); !x.Equals(&parser.Atom{Type: parser.SYMBOL, Value: "set"}) {
+		t.Errorf("expected set to rebind x in parent, got %v", x)
+	}
+
+	if err := child.Set("z", &parser.Atom{Type: parser.SYMBOL, Value: "z"}); !errors.Is(err, eval.UNBOUND_VARIABLE) {
+		t.Errorf("expected set of unbound z to fail, got %v", err)
+	}
+
+	child.Define("x", parser.Bool(true))
+	if names := child.Names(); !slices.Equal(names, []string{"x", "y"}) {
+		t.Errorf("expected names [x y] got %v", names)
+	}
+
+	if keywords := eval.SpecialForms(); !slices.Contains(keywords, "lambda") || !slices.IsSorted(keywords) {
+		t.Errorf("expected sorted keywords including lambda got %v", keywords)
+	}
+}
+
+func TestEval_Lambda(t *testing.T) {
+	runTestCases(t, []testCase{
+		{"Immediate application", "((lambda (x y) (+ x y)) 1 2)", "3"},
+		{"Closure captures environment", "(((lambda (x) (lambda (y) (+ x y))) 10) 5)", "15"},
+		{"Inner binding shadows outer", "((lambda (x) ((lambda (x) x) 2)) 1)", "2"},
+		{"Rest parameter", "((lambda args args) 1 2 3)", "(1 2 3)"},
+		{"Empty rest parameter", "((lambda args args))", "()"},
+		{"Dotted parameter list", "((lambda (a . b) b) 1 2 3)", "(2 3)"},
+		{"Body sequence", "((lambda () 1 2 3))", "3"},
+		{"Procedure predicate", "(procedure? (lambda () 1))", "#t"},
+	})
+
+	runErrorTestCases(t, []errorTestCase{
+		{"Too few arguments", "((lambda (x y) x) 1)", eval.WRONG_ARITY},
+		{"Too many arguments", "((lambda (x) x) 1 2)", eval.WRONG_ARITY},
+		{"Too few arguments with rest", "((lambda (x . y) x))", eval.WRONG_ARITY},
+		{"Duplicate formals", "(lambda (x x) x)", eval.BAD_SYNTAX},
+		{"Non-symbol formals", "(lambda (1) 1)", eval.BAD_SYNTAX},
+		{"Empty body", "(lambda (x))", eval.BAD_SYNTAX},
+	})
+}
+
+func TestEval_Define(t *testing.T) {
+	runTestCases(t, []testCase{
+		{"Define variable", "(define x 10) x", "10"},
+		{"Redefine variable", "(define x 10) (define x 20) x", "20"},
+		{"Define procedure", "(define (add a b) (+ a b)) (add 1 2)", "3"},
+		{"Define procedure with rest", "(define (f a . rest) rest) (f 1 2 3)", "(2 3)"},
+		{"Define procedure with only rest", "(define (f . rest) rest) (f 1 2)", "(1 2)"},
+		{"Set global from closure", "(define n 0) (define (inc!) (set! n (+ n 1)) n) (inc!) (inc!)", "2"},
+		{"Set local binding", "(define x 1) ((lambda (x) (set! x 5) x) 2)", "5"},
+		{"Set local leaves global", "(define x 1) ((lambda (x) (set! x 5)) 2) x", "1"},
+		{
+			"Closure counter",
+			"(define (make-counter) ((lambda (n) (lambda () (set! n (+ n 1)) n)) 0))" +
+				"(define c1 (make-counter)) (define c2 (make-counter)) (c1) (c1) (c2) (c1)",
+			"3",
+		},
+	})
+
+	for _, src := range []string{
+		"(define y (if #f #f)) y",
+		"(define (id x) x) (id (when #f 1))",
+		"(define (f) (define y (if #f #f)) y) (f)",
+		"(let ((z (if #f #f))) z)",
+		"(letrec ((z (if #f #f))) z)",
+	} {
+		result, err := evalAll(t, src, eval.NewStandardEnvironment())
+		if err != nil || result != eval.Unspecified {
+			t.Errorf("expected unspecified value bound for %s, got %v (%v)", src, result, err)
+		}
+	}
+
+	runErrorTestCases(t, []errorTestCase{
+		{"Set unbound variable", "(set! undefined-variable 1)", eval.UNBOUND_VARIABLE},
+		{"Define non-symbol", "(define 1 2)", eval.BAD_SYNTAX},
+		{"Define without value", "(define x)", eval.BAD_SYNTAX},
+		{"Define with extra values", "(define x 1 2)", eval.BAD_SYNTAX},
+		{"Set non-symbol", "(set! 1 2)", eval.BAD_SYNTAX},
+	})
+}
+
+func TestEval_Conditionals(t *testing.T) {
+	runTestCases(t, []testCase{
+		{"If true branch", "(if #t 1 2)", "1"},
+		{"If false branch", "(if #f 1 2)", "2"},
+		{"If treats non-boolean as true", "(if '() 1 2)", "1"},
+		{"Cond first match", "(cond ((> 1 2) 'a) ((< 1 2) 'b) (else 'c))", "b"},
+		{"Cond else", "(cond (#f 'a) (else 'b 'c))", "c"},
+		{"Cond test only clause", "(cond (#f) (42))", "42"},
+		{"Cond arrow clause", "(cond ((car '(7 8)) => (lambda (x) (* x 2))) (else 0))", "14"},
+		{"Case match", "(case (* 2 3) ((2 3 5 7) 'prime) ((1 4 6 8 9) 'composite))", "composite"},
+		{"Case symbols", "(case 'x ((a) 1) ((x y) 2) (else 3))", "2"},
+		{"Case else", "(case 10 ((1) 'one) (else 'other))", "other"},
+		{"Case arrow clause", "(case 5 ((5) => (lambda (x) (+ x 1))) (else 0))", "6"},
+		{"Case else arrow clause", "(case 5 ((1) 0) (else => (lambda (x) (* x 2))))", "10"},
+		{"When true", "(when (= 1 1) 'a 'b)", "b"},
+		{"Unless false", "(unless (= 1 2) 'a 'b)", "b"},
+		{"And empty", "(and)", "#t"},
+		{"And returns last value", "(and 1 2 3)", "3"},
+		{"And stops at false", "(and 1 #f undefined-variable)", "#f"},
+		{"Or empty", "(or)", "#f"},
+		{"Or returns first true value", "(or #f 2 undefined-variable)", "2"},
+		{
+			"Tail recursion through if",
+			"(define (loop n) (if (= n 0) 'done (loop (- n 1)))) (loop 100000)",
+			"done",
+		},
+		{
+			"Tail recursion through cond",
+			"(define (loop n) (cond ((= n 0) 'done) (else (loop (- n 1))))) (loop 100000)",
+			"done",
+		},
+	})
+
+	for _, src := range []string{
+		"(if #f #f)",
+		"(cond (#f 1))",
+		"(case 1 ((2) 2))",
+		"(when #f 1)",
+		"(unless #t 1)",
+	} {
+		result, err := evalAll(t, src, eval.NewStandardEnvironment())
+		if err != nil || result != eval.Unspecified {
+			t.Errorf("expected unspecified value for %s, got %v (%v)", src, result, err)
+		}
+	}
+
+	runErrorTestCases(t, []errorTestCase{
+		{"If without branches", "(if #t)", eval.BAD_SYNTAX},
+		{"Cond else not last", "(cond (else 1) (#t 2))", eval.BAD_SYNTAX},
+		{"Cond empty clause", "(cond ())", eval.BAD_SYNTAX},
+		{"Case clause without body", "(case 1 ((1)))", eval.BAD_SYNTAX},
+		{"When without body", "(when #t)", eval.BAD_SYNTAX},
+	})
+}
+
+func TestEval_Let(t *testing.T) {
+	runTestCases(t, []testCase{
+		{"Let", "(let ((x 1) (y 2)) (+ x y))", "3"},
+		{"Let inits see outer scope", "(define x 10) (let ((x 1) (y x)) y)", "10"},
+		{"Let empty bindings", "(let () 5)", "5"},
+		{"Let star sequential", "(let* ((x 1) (y (+ x 1))) (* x y))", "2"},
+		{"Let star shadowing", "(let* ((x 1) (x (+ x 1))) x)", "2"},
+		{
+			"Letrec mutual recursion",
+			"(letrec ((even? (lambda (n) (if (= n 0) #t (odd? (- n 1)))))" +
+				"(odd? (lambda (n) (if (= n 0) #f (even? (- n 1))))))" +
+				"(even? 1000))",
+			"#t",
+		},
+		{"Letrec star sequential", "(letrec* ((x 1) (f (lambda () x)) (y (f))) y)", "1"},
+		{
+			"Internal defines",
+			"(define (f x) (define y (* x 2)) (define (g) (+ y 1)) (g)) (f 5)",
+			"11",
+		},
+		{
+			"Internal defines are mutually recursive",
+			"(define (f n) (define (ev? n) (if (= n 0) #t (od? (- n 1)))) (define (od? n) (if (= n 0) #f (ev? (- n 1)))) (ev? n))" +
+				"(f 10)",
+			"#t",
+		},
+		{"Internal define in let body", "(define x 1) (let () (define x 2) x)", "2"},
+		{"Internal define does not leak", "(define x 1) (let () (define x 2) x) x", "1"},
+	})
+
+	runErrorTestCases(t, []errorTestCase{
+		{"Let duplicate names", "(let ((x 1) (x 2)) x)", eval.BAD_SYNTAX},
+		{"Let malformed binding", "(let ((x)) x)", eval.BAD_SYNTAX},
+		{"Let without body", "(let ((x 1)))", eval.BAD_SYNTAX},
+		{"Letrec reference before init", "(letrec ((x y) (y 1)) x)", eval.UNASSIGNED},
+		{
+			"Internal define shadows outer binding in whole body",
+			"(define x 1) (define (f) (define y x) (define x 2) y) (f)",
+			eval.UNASSIGNED,
+		},
+	})
+}
+
+func TestEval_Begin(t *testing.T) {
+	runTestCases(t, []testCase{
+		{"Begin sequence", "(begin 1 2 3)", "3"},
+		{"Begin side effects", "(define x 1) (begin (set! x (+ x 1)) (set! x (* x 10))) x", "20"},
+		{"Top-level begin defines", "(begin (define a 1) (define b 2)) (+ a b)", "3"},
+		{"Body begin defines", "(define (f) (begin (define a 1)) (define b 2) (+ a b)) (f)", "3"},
+		{
+			"Begin tail position",
+			"(define (loop n) (begin (if (= n 0) 'done (loop (- n 1))))) (loop 100000)",
+			"done",
+		},
+	})
+}
+
+func TestRunProgram(t *testing.T) {
+	result, err := eval.RunProgram(read(t, "(define (square x) (* x x)) (square 12)"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := read(t, "144")[0]; !result.Equals(expected) {
+		t.Errorf("expected %v got %v", expected, result)
+	}
+
+	if result, err = eval.RunProgram(nil); err != nil || result != eval.Unspecified {
+		t.Errorf("expected unspecified value for empty program, got %v (%v)", result, err)
+	}
+
+	if _, err = eval.RunProgram(read(t, "(define x 1) (car x) (set! x 2)")); !errors.Is(err, eval.WRONG_TYPE) {
+		t.Errorf("expected program to stop at first error, got %v", err)
+	}
+}
+
+func TestEval_Iteration(t *testing.T) {
+	runTestCases(t, []testCase{
+		{"Named let", "(let loop ((i 0) (acc '())) (if (= i 3) acc (loop (+ i 1) (cons i acc))))", "(2 1 0)"},
+		{"Named let long loop", "(let loop ((i 0)) (if (< i 100000) (loop (+ i 1)) i))", "100000"},
+		{"Named let name scoped to body", "(define loop 1) (let loop ((i 0)) i) loop", "1"},
+		{"Named let inits see outer scope", "(define (loop) 5) (let loop ((i (loop))) i)", "5"},
+		{
+			"Do loop",
+			"(do ((vec '()) (i 0 (+ i 1))) ((= i 5) vec) (set! vec (cons i vec)))",
+			"(4 3 2 1 0)",
+		},
+		{"Do sum", "(let ((x '(1 3 5 7 9))) (do ((x x (cdr x)) (sum 0 (+ sum (car x)))) ((null? x) sum)))", "25"},
+		{
+			"Do fresh binding per iteration",
+			"(define procs '()) (do ((i 0 (+ i 1))) ((= i 3)) (set! procs (cons (lambda () i) procs))) ((car procs))",
+			"2",
+		},
+	})
+
+	result, err := evalAll(t, "(do ((i 0 (+ i 1))) ((= i 3)))", eval.NewStandardEnvironment())
+	if err != nil || result != eval.Unspecified {
+		t.Errorf("expected unspecified value for do without result expressions, got %v (%v)", result, err)
+	}
+
+	runErrorTestCases(t, []errorTestCase{
+		{"Named let duplicate names", "(let loop ((x 1) (x 2)) x)", eval.BAD_SYNTAX},
+		{"Do without exit clause", "(do ((i 0)))", eval.BAD_SYNTAX},
+		{"Do empty exit clause", "(do ((i 0)) ())", eval.BAD_SYNTAX},
+		{"Do malformed binding", "(do ((i 0 1 2)) (#t))", eval.BAD_SYNTAX},
+	})
+}
+
+func TestEval_CallCC(t *testing.T) {
+	runTestCases(t, []testCase{
+		{"Normal return", "(call/cc (lambda (k) 1))", "1"},
+		{"Escape", "(+ 1 (call/cc (lambda (k) (+ 10 (k 2)))))", "3"},
+		{"Long name", "(call-with-current-continuation (lambda (k) (k 'x) 'y))", "x"},
+		{
+			"Non-local exit from loop",
+			"(define (find-first pred lst)" +
+				"  (call/cc (lambda (return)" +
+				"    (let loop ((l lst)) (if (null? l) #f (begin (if (pred (car l)) (return (car l))) (loop (cdr l))))))))" +
+				"(find-first (lambda (x) (> x 2)) '(1 2 3 4))",
+			"3",
+		},
+		{
+			"Non-local exit from deep recursion",
+			"(define (product lst)" +
+				"  (call/cc (lambda (break)" +
+				"    (let loop ((l lst)) (cond ((null? l) 1) ((= (car l) 0) (break 0)) (else (* (car l) (loop (cdr l)))))))))" +
+				"(product '(1 2 3 0 4 5))",
+			"0",
+		},
+		{
+			"Inner continuation escapes through outer",
+			"(call/cc (lambda (outer) (+ 1 (call/cc (lambda (inner) (outer 'outer))))))",
+			"outer",
+		},
+		{
+			"Generator",
+			"(define (make-generator lst)" +
+				"  (lambda () (call/cc (lambda (yield)" +
+				"    (if (null? lst) (yield 'done))" +
+				"    (let ((x (car lst))) (set! lst (cdr lst)) (yield x) 'unreachable)))))" +
+				"(define gen (make-generator '(a b)))" +
+				"(list (gen) (gen) (gen))",
+			"(a b done)",
+		},
+		{"Continuation is procedure", "(call/cc procedure?)", "#t"},
+	})
+
+	runErrorTestCases(t, []errorTestCase{
+		{"Re-entry", "(define k #f) (+ 1 (call/cc (lambda (c) (set! k c) 1))) (k 10)", eval.CONTINUATION_EXPIRED},
+		{"Non-procedure receiver", "(call/cc 1)", eval.NOT_A_PROCEDURE},
+	})
+}
+
+func TestEval_DynamicWind(t *testing.T) {
+	runTestCases(t, []testCase{
+		{
+			"Normal exit",
+			"(define trace '())" +
+				"(define (note x) (set! trace (cons x trace)))" +
+				"(define result (dynamic-wind (lambda () (note 'before)) (lambda () (note 'during) 'value) (lambda () (note 'after))))" +
+				"(list result trace)",
+			"(value (after during before))",
+		},
+		{
+			"Escape runs after thunk",
+			"(define trace '())" +
+				"(define (note x) (set! trace (cons x trace)))" +
+				"(define result (call/cc (lambda (k)" +
+				"  (dynamic-wind (lambda () (note 'before)) (lambda () (k 'escaped) (note 'unreachable)) (lambda () (note 'after))))))" +
+				"(list result trace)",
+			"(escaped (after before))",
+		},
+		{
+			"Nested winders unwind innermost first",
+			"(define trace '())" +
+				"(define (note x) (set! trace (cons x trace)))" +
+				"(call/cc (lambda (k)" +
+				"  (dynamic-wind (lambda () (note 'outer-before))" +
+				"    (lambda () (dynamic-wind (lambda () (note 'inner-before)) (lambda () (k 0)) (lambda () (note 'inner-after))))" +
+				"    (lambda () (note 'outer-after)))))" +
+				"trace",
+			"(outer-after inner-after inner-before outer-before)",
+		},
+		{
+			"Escape within extent skips after",
+			"(define trace '())" +
+				"(define (note x) (set! trace (cons x trace)))" +
+				"(dynamic-wind (lambda () (note 'before))" +
+				"  (lambda () (call/cc (lambda (k) (k 1))) (note 'during))" +
+				"  (lambda () (note 'after)))" +
+				"trace",
+			"(after during before)",
+		},
+		{
+			"Error runs after thunk",
+			"(define trace '())" +
+				"(define (note x) (set! trace (cons x trace)))" +
+				"(define (safe thunk) (call/cc (lambda (k) (dynamic-wind (lambda () #f) thunk (lambda () (k 'recovered))))))" +
+				"(list (safe (lambda () (car '()))) trace)",
+			"(recovered ())",
+		},
+	})
+
+	runErrorTestCases(t, []errorTestCase{
+		{"Error propagates", "(dynamic-wind (lambda () 1) (lambda () (car 1)) (lambda () 2))", eval.WRONG_TYPE},
+		{"Wrong arity", "(dynamic-wind (lambda () 1) (lambda () 2))", eval.WRONG_ARITY},
+	})
+}
+
+func TestEval_Promises(t *testing.T) {
+	runTestCases(t, []testCase{
+		{"Force delay", "(force (delay (+ 1 2)))", "3"},
+		{"Delay is lazy", "(define p (delay (car '()))) (promise? p)", "#t"},
+		{
+			"Memoization",
+			"(define count 0) (define p (delay (begin (set! count (+ count 1)) count))) (force p) (force p) count",
+			"1",
+		},
+		{"Make promise", "(force (make-promise 5))", "5"},
+		{"Make promise of promise", "(define p (delay 1)) (eq? p (make-promise p))", "#t"},
+		{"Force non-promise", "(force 7)", "7"},
+		{"Delay force", "(force (delay-force (delay 'x)))", "x"},
+		{
+			"Delay force iterates in constant space",
+			"(define (loop n) (delay-force (if (= n 0) (delay 'done) (loop (- n 1))))) (force (loop 100000))",
+			"done",
+		},
+		{
+			"Reentrant force",
+			"(define x 5)" +
+				"(define p (delay (begin (set! x (+ x 1)) (if (> x 7) x (force p)))))" +
+				"(list (force p) (begin (set! x 10) (force p)))",
+			"(8 8)",
+		},
+		{
+			"Stream",
+			"(define (ints n) (cons n (delay (ints (+ n 1)))))" +
+				"(define (take s k) (if (= k 0) '() (cons (car s) (take (force (cdr s)) (- k 1)))))" +
+				"(take (ints 0) 4)",
+			"(0 1 2 3)",
+		},
+	})
+
+	runErrorTestCases(t, []errorTestCase{
+		{"Delay without expression", "(delay)", eval.BAD_SYNTAX},
+		{"Delay force yields non-promise", "(force (delay-force 1))", eval.WRONG_TYPE},
+	})
+}
+
+func TestEval_Quasiquote(t *testing.T) {
+	runTestCases(t, []testCase{
+		{"Plain template", "`(a b c)", "(a b c)"},
+		{"Atom template", "`a", "a"},
+		{"Unquote", "(define x 2) `(a ,x ,(+ x 1))", "(a 2 3)"},
+		{"Unquote splicing", "(define l '(1 2)) `(a ,@l b)", "(a 1 2 b)"},
+		{"Unquote splicing at end", "(define l '(1 2)) `(a ,@l)", "(a 1 2)"},
+		{"Unquote splicing empty list", "`(a ,@'() b)", "(a b)"},
+		{"Splicing does not share structure", "(define l '(1 2)) (eq? (cdr `(a ,@l)) l)", "#f"},
+		{"Dotted unquote", "(define x 2) `(a . ,x)", "(a . 2)"},
+		{"Dotted template", "`(a . b)", "(a . b)"},
+		{"Nested list", "(define x 1) `((a ,x) (b ,x))", "((a 1) (b 1))"},
+		{"Vector template", "(define x 1) `#(a ,x ,@(list 2 3))", "#(a 1 2 3)"},
+		{"Nested quasiquote keeps inner unquote", "`(a `(b ,(c ,(+ 1 2))))", "(a `(b ,(c 3)))"},
+		{"Nested quasiquote at depth two", "(define x 5) `(1 `,(+ 1 ,x))", "(1 `,(+ 1 5))"},
+		{"Nested unquote splicing", "`(1 `(2 ,@(3 ,@(list 4 5))))", "(1 `(2 ,@(3 4 5)))"},
+	})
+
+	runErrorTestCases(t, []errorTestCase{
+		{"Splicing non-list", "`(a ,@1)", eval.WRONG_TYPE},
+		{"Splicing outside of list", "`,@(list 1)", eval.BAD_SYNTAX},
+		{"Wrong operand count", "(quasiquote 1 2)", eval.BAD_SYNTAX},
+	})
+}
+
+func TestEval_Apply(t *testing.T) {
+	runTestCases(t, []testCase{
+		{"Builtin", "(apply + '(1 2 3))", "6"},
+		{"Spread with leading arguments", "(apply + 1 2 '(3 4))", "10"},
+		{"Empty list", "(apply list '())", "()"},
+		{"Closure", "(apply (lambda (a b) (- a b)) '(10 3))", "7"},
+		{"Closure with rest", "(apply (lambda (a . r) r) 1 '(2 3))", "(2 3)"},
+		{"Apply apply", "(apply apply (list + (list 1 2)))", "3"},
+		{"Continuation", "(call/cc (lambda (k) (apply k '(5))))", "5"},
+		{
+			"Apply in tail position is tail call",
+			"(define (loop n) (apply (lambda (m) (if (= m 0) 'ok (loop (- m 1)))) (list n))) (loop 1000000)",
+			"ok",
+		},
+		{"Apply apply in tail position", "(define (loop n) (if (= n 0) 'ok (apply apply loop (list (list (- n 1)))))) (loop 10000)", "ok"},
+	})
+
+	runErrorTestCases(t, []errorTestCase{
+		{"Last argument not list", "(apply + 1 2)", eval.WRONG_TYPE},
+		{"Improper list", "(apply + '(1 . 2))", eval.WRONG_TYPE},
+		{"Arity of applied closure", "(apply (lambda (a) a) '(1 2))", eval.WRONG_ARITY},
+		{"Not a procedure", "(apply 1 '())", eval.NOT_A_PROCEDURE},
+		{"Too few arguments", "(apply +)", eval.WRONG_ARITY},
+	})
+}
+
+func TestEval_HigherOrder(t *testing.T) {
+	runTestCases(t, []testCase{
+		{"Map", "(map (lambda (x) (* x x)) '(1 2 3))", "(1 4 9)"},
+		{"Map builtin", "(map car '((a 1) (b 2)))", "(a b)"},
+		{"Map multiple lists", "(map + '(1 2 3) '(10 20 30))", "(11 22 33)"},
+		{"Map stops at shortest list", "(map cons '(1 2 3) '(a b))", "((1 . a) (2 . b))"},
+		{"Map empty list", "(map car '())", "()"},
+		{
+			"For each",
+			"(define acc '()) (for-each (lambda (x y) (set! acc (cons (+ x y) acc))) '(1 2) '(3 4)) acc",
+			"(6 4)",
+		},
+		{"For each value", "(eq? (for-each car '()) (if #f #f))", "#t"},
+		{"Filter", "(filter (lambda (x) (> x 1)) '(0 1 2 3 1))", "(2 3)"},
+		{"Fold", "(fold cons '() '(1 2 3))", "(3 2 1)"},
+		{"Fold multiple lists", "(fold (lambda (a b acc) (+ acc (* a b))) 0 '(1 2 3) '(4 5 6))", "32"},
+		{"Fold left", "(fold-left (lambda (acc x) (cons x acc)) '() '(1 2 3))", "(3 2 1)"},
+		{"Fold right", "(fold-right cons '() '(1 2 3))", "(1 2 3)"},
+		{"Fold right multiple lists", "(fold-right (lambda (a b acc) (cons (list a b) acc)) '() '(1 2) '(x y))", "((1 x) (2 y))"},
+		{
+			"Escape from for-each",
+			"(call/cc (lambda (k) (for-each (lambda (x) (if (> x 1) (k x))) '(1 2 3)) 'none))",
+			"2",
+		},
+	})
+
+	runErrorTestCases(t, []errorTestCase{
+		{"Map improper list", "(map car 1)", eval.WRONG_TYPE},
+		{"Map error in procedure", "(map car '(1))", eval.WRONG_TYPE},
+		{"Map arity", "(map (lambda (x) x) '(1) '(2))", eval.WRONG_ARITY},
+		{"Fold without list", "(fold + 0)", eval.WRONG_ARITY},
+	})
+}
+
+func TestEval_Exceptions(t *testing.T) {
+	runTestCases(t, []testCase{
+		{"Guard catches raise", "(guard (e (#t (list 'caught e))) (raise 'oops))", "(caught oops)"},
+		{"Guard without raise", "(guard (e (#t 'caught)) 1 2)", "2"},
+		{"Guard selects clause", "(guard (e ((symbol? e) 'symbol) ((string? e) 'string)) (raise \"s\"))", "string"},
+		{"Guard else", "(guard (e ((symbol? e) 'symbol) (else 'other)) (raise 1))", "other"},
+		{"Guard arrow clause", "(guard (e ((and (pair? e) (car e)) => (lambda (x) (* x 2)))) (raise (list 21)))", "42"},
+		{"Guard reraises to outer guard", "(guard (outer (#t (list 'outer outer))) (guard (inner ((string? inner) 'inner)) (raise 'x)))", "(outer x)"},
+		{"Guard reraises continuably", "(with-exception-handler (lambda (e) 42) (lambda () (+ 1 (guard (e (#f 0)) (raise-continuable 1)))))", "43"},
+		{"Error message", "(guard (e (#t (error-object-message e))) (error \"bad thing\" 1 2))", `"bad thing"`},
+		{"Error irritants", "(guard (e (#t (error-object-irritants e))) (error \"bad thing\" 1 'x))", "(1 x)"},
+		{"Error object predicate", "(guard (e (#t (error-object? e))) (error \"msg\"))", "#t"},
+		{"Raised non-error object", "(guard (e (#t (error-object? e))) (raise 1))", "#f"},
+		{"Raise continuable caught by guard", "(guard (e (#t e)) (+ 1 (raise-continuable 5)))", "5"},
+		{"Guard catches builtin errors", "(guard (e ((error-object? e) 'type-error)) (car 1))", "type-error"},
+		{"Guard catches unbound variable", "(guard (e (#t 'unbound)) undefined-variable)", "unbound"},
+		{
+			"Guard runs dynamic wind after",
+			"(define trace '())" +
+				"(guard (e (#t (cons e trace)))" +
+				"  (dynamic-wind (lambda () #f) (lambda () (raise 'x)) (lambda () (set! trace (cons 'after trace)))))",
+			"(x after)",
+		},
+		{
+			"Continuation passes through guard",
+			"(call/cc (lambda (k) (guard (e (#t 'caught)) (k 'escaped))))",
+			"escaped",
+		},
+		{"Guard body defines", "(guard (e (#t e)) (define x 5) x)", "5"},
+	})
+
+	runErrorTestCases(t, []errorTestCase{
+		{"Guard without clauses", "(guard () 1)", eval.BAD_SYNTAX},
+		{"Guard reraises builtin errors", "(guard (e ((string? e) 'string)) (car 1))", eval.WRONG_TYPE},
+		{"Message of non error object", "(error-object-message 1)", eval.WRONG_TYPE},
+	})
+
+	_, err := evalAll(t, "(raise 'boom)", eval.NewStandardEnvironment())
+
+	var condition *eval.Condition
+	if !errors.As(err, &condition) || !condition.Payload.Equals(&parser.Atom{Type: parser.SYMBOL, Value: "boom"}) {
+		t.Errorf("expected uncaught condition with boom payload, got %v", err)
+	}
+
+	_, err = evalAll(t, `(error "failed" 42)`, eval.NewStandardEnvironment())
+	if err == nil || !strings.HasPrefix(err.Error(), "failed") {
+		t.Errorf("expected error message of error object, got %v", err)
+	}
+}
+
+func TestEval_ExceptionHandlers(t *testing.T) {
+	runTestCases(t, []testCase{
+		{
+			"Handler value returned by raise continuable",
+			"(with-exception-handler (lambda (c) 42) (lambda () (+ (raise-continuable 'oops) 2)))",
+			"44",
+		},
+		{"Thunk value", "(with-exception-handler (lambda (c) 0) (lambda () 'ok))", "ok"},
+		{
+			"Handler called at raise point",
+			"(define trace '())" +
+				"(call/cc (lambda (k)" +
+				"  (with-exception-handler (lambda (c) (set! trace (cons c trace)) (k 'escaped))" +
+				"    (lambda () (dynamic-wind (lambda () #f) (lambda () (raise 'x)) (lambda () (set! trace (cons 'after trace))))))))" +
+				"trace",
+			"(after x)",
+		},
+		{
+			"Handler runs with outer handlers",
+			"(with-exception-handler (lambda (c) (list 'outer c))" +
+				"  (lambda () (with-exception-handler (lambda (c) (raise-continuable (list 'inner c)))" +
+				"    (lambda () (raise-continuable 'x)))))",
+			"(outer (inner x))",
+		},
+		{
+			"Guard catches secondary error",
+			"(guard (e ((error-object? e) (error-object-irritants e)))" +
+				"  (with-exception-handler (lambda (c) 'ignored) (lambda () (raise 'x))))",
+			"(x)",
+		},
+		{
+			"Inner guard is consulted first",
+			"(with-exception-handler (lambda (c) 'handler) (lambda () (guard (e (#t 'guard)) (raise 'x))))",
+			"guard",
+		},
+		{
+			"Unmatched guard reraises to handler",
+			"(call/cc (lambda (k)" +
+				"  (with-exception-handler (lambda (c) (k (list 'handler c)))" +
+				"    (lambda () (guard (e ((string? e) 'guard)) (raise 'x))))))",
+			"(handler x)",
+		},
+		{
+			"Builtin errors reach handler",
+			"(call/cc (lambda (k) (with-exception-handler (lambda (c) (k (error-object? c))) (lambda () (car 1)))))",
+			"#t",
+		},
+		{
+			"Error raised by handler goes to outer handler",
+			"(call/cc (lambda (k)" +
+				"  (with-exception-handler (lambda (c) (k (list 'outer (error-object-message c))))" +
+				"    (lambda () (with-exception-handler (lambda (c) (error \"inner failed\")) (lambda () (raise 'x)))))))",
+			`(outer "inner failed")`,
+		},
+	})
+
+	runErrorTestCases(t, []errorTestCase{
+		{"Handler returns from raise", "(with-exception-handler (lambda (c) 1) (lambda () (raise 'x)))", eval.HANDLER_RETURNED},
+		{"Handler returns from error", `(with-exception-handler (lambda (c) 1) (lambda () (error "e")))`, eval.HANDLER_RETURNED},
+		{"Handler returns from builtin error", "(with-exception-handler (lambda (c) 1) (lambda () (car 1)))", eval.HANDLER_RETURNED},
+		{"Non-procedure handler", "(with-exception-handler 1 (lambda () 1))", eval.NOT_A_PROCEDURE},
+	})
+
+	_, err := evalAll(t, "(with-exception-handler (lambda (c) (raise (list 'wrapped c))) (lambda () (car 1)))", eval.NewStandardEnvironment())
+
+	var condition *eval.Condition
+	if !errors.As(err, &condition) {
+		t.Fatalf("expected uncaught condition, got %v", err)
+	}
+
+	if expected := read(t, "wrapped")[0]; !condition.Payload.(*parser.Expr).Car.Equals(expected) {
+		t.Errorf("expected payload raised by handler, got %v", condition.Payload)
+	}
+
+	if _, err = evalAll(t, "(guard (e ((string? e) 'string)) (raise 'x))", eval.NewStandardEnvironment()); !errors.As(err, &condition) {
+		t.Errorf("expected condition reraised by guard, got %v", err)
+	}
+}
+
+func TestEval_EvalProcedure(t *testing.T) {
+	runTestCases(t, []testCase{
+		{"Eval in report environment", "(eval '(* 7 3) (scheme-report-environment 5))", "21"},
+		{"Eval constructed expression", "(eval (list '+ 1 2) (scheme-report-environment 5))", "3"},
+		{"Eval special form in null environment", "(eval '(if #t 'yes 'no) (null-environment 5))", "yes"},
+		{"Eval sees interaction environment", "(define x 10) (eval '(+ x 1) (interaction-environment))", "11"},
+		{"Eval defines in interaction environment", "(eval '(define y 5) (interaction-environment)) y", "5"},
+		{"Report environment is separate", "(define x 10) (define env (scheme-report-environment 5)) (eval '(define x 1) env) x", "10"},
+		{"Eval lambda", "((eval '(lambda (x) (* x x)) (scheme-report-environment 5)) 4)", "16"},
+	})
+
+	runErrorTestCases(t, []errorTestCase{
+		{"Null environment has no procedures", "(eval '(+ 1 2) (null-environment 5))", eval.UNBOUND_VARIABLE},
+		{"Report environment does not see program", "(define x 1) (eval 'x (scheme-report-environment 5))", eval.UNBOUND_VARIABLE},
+		{"Unsupported version", "(scheme-report-environment 7)", eval.UNSUPPORTED_VERSION},
+		{"Non-environment", "(eval 1 2)", eval.WRONG_TYPE},
+	})
+}
+
+func TestEval_Process(t *testing.T) {
+	testCases := []struct {
+		Input string
+		Code  int
+	}{
+		{"(exit)", 0},
+		{"(exit #t)", 0},
+		{"(exit #f)", 1},
+		{"(exit 3)", 3},
+		{"(exit 'other)", 0},
+		{"(guard (e (#t 'caught)) (exit 2))", 2},
+		{"(with-exception-handler (lambda (e) 'handled) (lambda () (exit 4)))", 4},
+		{"(define done #f) (dynamic-wind (lambda () #f) (lambda () (exit (if done 9 5))) (lambda () (set! done #t)))", 5},
+	}
+
+	for _, c := range testCases {
+		_, err := evalAll(t, c.Input, eval.NewStandardEnvironment())
+
+		var exit *eval.Exit
+		if !errors.As(err, &exit) || exit.Code != c.Code {
+			t.Errorf("expected exit with status %d got %v for %s", c.Code, err, c.Input)
+		}
+	}
+
+	ev := &eval.Evaluator{CommandLine: []string{"script.scm", "a"}}
+	result, err := ev.RunProgram(read(t, "(command-line)"), eval.NewStandardEnvironment())
+	if err != nil || !result.Equals(read(t, `("script.scm" "a")`)[0]) {
+		t.Errorf(`expected ("script.scm" "a") got %v, %v`, result, err)
+	}
+}
+
+func TestEval_Context(t *testing.T) {
+	testCases := []string{
+		"(let loop () (loop))",
+		"(do () (#f))",
+		"(guard (e (#t 'caught)) (let loop () (loop)))",
+		"(with-exception-handler (lambda (e) 'handled) (lambda () (let loop () (loop))))",
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	for _, c := range testCases {
+		ev := &eval.Evaluator{}
+		ev.SetContext(ctx)
+
+		_, err := ev.RunProgram(read(t, c), eval.NewStandardEnvironment())
+
+		var interrupted *eval.Interrupted
+		if !errors.As(err, &interrupted) || !errors.Is(err, context.Canceled) {
+			t.Errorf("expected interruption got %v for %s", err, c)
+		}
+	}
+
+	ev := &eval.Evaluator{}
+	ev.SetContext(ctx)
+	env := eval.NewStandardEnvironment()
+	_, err := ev.RunProgram(read(t, "(define after #f) (dynamic-wind (lambda () #f) (lambda () (let loop () (loop))) (lambda () (set! after #t)))"), env)
+
+	ev.SetContext(nil)
+	if after, _ := env.Lookup("after"); !errors.Is(err, context.Canceled) || !eval.IsTrue(after) {
+		t.Errorf("expected after thunk run on interruption got %v, %v", after, err)
+	}
+}
+
+func TestEval_Tasks(t *testing.T) {
+	runTestCases(t, []testCase{
+		{"Spawn value", "(channel-receive (spawn (lambda () (* 6 7))))", "42"},
+		{"Spawn raise", "(channel-receive (spawn (lambda () (raise 'oops))))", "oops"},
+		{"Spawn error", "(error-object-message (channel-receive (spawn (lambda () (error \"failed\" 1)))))", `"failed"`},
+		{"Spawn Go error", "(error-object? (channel-receive (spawn (lambda () (car 1)))))", "#t"},
+		{"Unbuffered channel", "(define ch (make-channel)) (spawn (lambda () (channel-send! ch 'ping))) (channel-receive ch)", "ping"},
+		{"Buffered channel", "(define ch (make-channel 2)) (channel-send! ch 1) (channel-send! ch 2) (list (channel-receive ch) (channel-receive ch))", "(1 2)"},
+		{"Workers", `(define results (make-channel))
+			(define (worker n) (spawn (lambda () (channel-send! results (* n n)))))
+			(for-each worker '(1 2 3 4))
+			(define (sum k acc) (if (= k 0) acc (sum (- k 1) (+ acc (channel-receive results)))))
+			(sum 4 0)`, "30"},
+		{"Handlers of task", "(guard (e (#t (list 'outer e))) (channel-receive (spawn (lambda () (guard (e (#t (list 'inner e))) (raise 'x))))))", "(inner x)"},
+		{"Select receive", "(define a (make-channel 1)) (define b (make-channel 1)) (channel-send! b 'v) (select (list a (lambda (x) (list 'a x))) (list b (lambda (x) (list 'b x))))", "(b v)"},
+		{"Select send", "(define a (make-channel 1)) (select (list a 'v (lambda () 'sent))) (channel-receive a)", "v"},
+		{"Select default", "(select (list (make-channel) (lambda (x) x)) (lambda () 'none))", "none"},
+		{"Select waits", "(define ch (make-channel)) (spawn (lambda () (channel-send! ch 'late))) (select (list ch (lambda (x) x)))", "late"},
+	})
+
+	runErrorTestCases(t, []errorTestCase{
+		{"Spawn non-procedure", "(spawn 1)", eval.WRONG_TYPE},
+		{"Negative capacity", "(make-channel -1)", eval.WRONG_TYPE},
+		{"Send to non-channel", "(channel-send! 1 2)", eval.WRONG_TYPE},
+		{"Receive from non-channel", "(channel-receive 'ch)", eval.WRONG_TYPE},
+		{"Malformed select clause", "(select (list (make-channel)))", eval.WRONG_TYPE},
+	})
+}
+
+func TestEval_Tasks_Context(t *testing.T) {
+	testCases := []string{
+		"(channel-receive (make-channel))",
+		"(channel-send! (make-channel) 1)",
+		"(select (list (make-channel) (lambda (x) x)))",
+		"(channel-receive (spawn (lambda () (let loop () (loop)))))",
+	}
+
+	for _, c := range testCases {
+		ctx, cancel := context.WithCancel(context.Background())
+		ev := &eval.Evaluator{}
+		ev.SetContext(ctx)
+
+		done := make(chan error)
+		go func() {
+			_, err := ev.RunProgram(read(t, c), eval.NewStandardEnvironment())
+			done <- err
+		}()
+		cancel()
+
+		var interrupted *eval.Interrupted
+		if err := <-done; !errors.As(err, &interrupted) || !errors.Is(err, context.Canceled) {
+			t.Errorf("expected interruption got %v for %s", err, c)
+		}
+	}
+}
+
+func TestEval_Macros(t *testing.T) {
+	runTestCases(t, []testCase{
+		{"swap", "(define-syntax swap! (syntax-rules () ((_ a b) (let ((tmp a)) (set! a b) (set! b tmp))))) (define x 1) (define y 2) (swap! x y) (list x y)", "(2 1)"},
+		{"recursive", "(define-syntax my-or (syntax-rules () ((_) #f) ((_ e) e) ((_ e r ...) (let ((t e)) (if t t (my-or r ...)))))) (my-or #f #f 3)", "3"},
+		{"in procedure", "(define-syntax inc! (syntax-rules () ((_ v) (set! v (+ v 1))))) (define (f n) (inc! n) (inc! n) n) (f 1)", "3"},
+		{"let-syntax", "(let-syntax ((twice (syntax-rules () ((_ e) (begin e e))))) (define n 0) (twice (set! n (+ n 1))) n)", "2"},
+		{"without operands", "(define-syntax nothing (syntax-rules () ((_) #f))) (nothing)", "#f"},
+		{"hygienic let", "(define-syntax my-or (syntax-rules () ((_ a b) (let ((t a)) (if t t b))))) (let ((t 5)) (my-or #f t))", "5"},
+		{"hygienic swap", "(define-syntax swap! (syntax-rules () ((_ a b) (let ((tmp a)) (set! a b) (set! b tmp))))) (define tmp 1) (define other 2) (swap! tmp other) (list tmp other)", "(2 1)"},
+		{"hygienic lambda", "(define-syntax thunk-of (syntax-rules () ((_ e) (lambda (x) e)))) (define x 7) ((thunk-of (* x 2)) 1)", "14"},
+		{"hygienic named let", "(define-syntax repeat (syntax-rules () ((_ n e) (let loop ((i n)) (if (> i 0) (begin e (loop (- i 1)))))))) (define i 10) (define total 0) (repeat 3 (set! total (+ total i))) total", "30"},
+		{"hygienic do", "(define-syntax sum-to (syntax-rules () ((_ n) (do ((k 0 (+ k 1)) (s 0 (+ s k))) ((> k n) s))))) (let ((k 10) (s 1)) (list (sum-to k) s))", "(55 1)"},
+		{"hygienic internal define", "(define-syntax with-double (syntax-rules () ((_ v e) (let () (define d (* v 2)) (+ d e))))) (let ((d 1)) (with-double 3 d))", "7"},
+		{"quasiquote in template", "(define-syntax tag (syntax-rules () ((_ e) (let ((v e)) `(v ,v))))) (let ((v 1)) (tag (+ v 1)))", "(v 2)"},
+	})
+
+	runErrorTestCases(t, []errorTestCase{
+		{"no matching rule", "(define-syntax one (syntax-rules () ((_ a) a))) (one 1 2)", macro.NO_MATCHING_RULE},
+		{"invalid macro", "(define-syntax bad (syntax-rules () ((_ a ...) a)))", macro.INVALID_MACRO},
+	})
+
+	ev := &eval.Evaluator{}
+	env := eval.NewStandardEnvironment()
+	if _, err := ev.RunProgram(read(t, "(define-syntax unless* (syntax-rules () ((_ c e) (if c #f e))))"), env); err != nil {
+		t.Fatal(err)
+	}
+	if result, err := ev.RunProgram(read(t, "(unless* #f 'kept)"), env); err != nil || !result.Equals(parser.Symbol("kept")) {
+		t.Errorf("expected macro kept between programs, got %v, %v", result, err)
+	}
+}
@@ -0,0 +1,288 @@
+package eval
+
+import (
+	"errors"
+	"fmt"
+	"github.com/vkhonin/scheme/parser"
+	"strings"
+)
+
+// Condition is Go error carrying object raised by Scheme code. It is returned
+// by evaluation when raised object is not caught.
+type Condition struct {
+	Payload     parser.Sexpr
+	Continuable bool
+}
+
+// ErrorObject is object raised by error procedure or created from Go error
+// signalled by builtin procedure or evaluator, in which case Err holds it.
+type ErrorObject struct {
+	Message   string
+	Irritants []parser.Sexpr
+	Err       error
+}
+
+func (c *Condition) Error() string {
+	if e, ok := c.Payload.(*ErrorObject); ok {
+		return e.describe()
+	}
+
+	return fmt.Sprintf("uncaught exception: %v", c.Payload)
+}
+
+// Unwrap makes Go error behind error object visible to errors.Is and As.
+func (c *Condition) Unwrap() error {
+	if e, ok := c.Payload.(*ErrorObject); ok {
+		return e.Err
+	}
+
+	return nil
+}
+
+func (e *ErrorObject) Equals(s parser.Sexpr) bool {
+	e2, ok := s.(*ErrorObject)
+	return ok && e == e2
+}
+
+func (e *ErrorObject) String() string {
+	return "#<error " + e.describe() + ">"
+}
+
+func (e *ErrorObject) describe() string {
+	var sb strings.Builder
+
+	sb.WriteString(e.Message)
+
+	for _, irritant := range e.Irritants {
+		sb.WriteString(fmt.Sprintf(" %v", irritant))
+	}
+
+	return sb.String()
+}
+
+// conditionPayload returns object guard clauses should see for err. Go
+// errors not raised by Scheme code are converted to error objects. Errors
+// used for control transfer are not conditions.
+func conditionPayload(err error) (parser.Sexpr, bool) {
+	condition, ok := asCondition(err)
+	if !ok {
+		return nil, false
+	}
+
+	return condition.Payload, true
+}
+
+// asCondition returns condition guard catches for err, see conditionPayload.
+func asCondition(err error) (*Condition, bool) {
+	var (
+		condition   *Condition
+		invoked     *continuationInvoked
+		exit        *Exit
+		interrupted *Interrupted
+	)
+
+	switch {
+	case errors.As(err, &invoked), errors.As(err, &exit), errors.As(err, &interrupted):
+		return nil, false
+	case errors.As(err, &condition):
+		return condition, true
+	default:
+		return &Condition{Payload: &ErrorObject{Message: err.Error(), Err: err}}, true
+	}
+}
+
+// evalGuard evaluates body and, if it raises, evaluates cond-like clauses with
+// raised object bound to variable. When no clause matches, object is raised
+// again, continuably if it was raised so.
+func evalGuard(ev *Evaluator, operands parser.Sexpr, env *Environment) (parser.Sexpr, *Environment, error) {
+	args, err := listToSlice(operands)
+	if err != nil || len(args) < 2 {
+		return nil, nil, fmt.Errorf("%w: guard", BAD_SYNTAX)
+	}
+
+	spec, err := listToSlice(args[0])
+	if err != nil || len(spec) == 0 {
+		return nil, nil, fmt.Errorf("%w: guard clauses", BAD_SYNTAX)
+	}
+
+	name, ok := symbolName(spec[0])
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: guard variable", BAD_SYNTAX)
+	}
+
+	bodyEnv := NewEnvironment(env)
+	declareDefines(args[1:], bodyEnv)
+
+	result, raised, err := ev.catch(func() (parser.Sexpr, error) {
+		return ev.evalSequence(args[1:], bodyEnv)
+	})
+	if raised == nil {
+		return result, nil, err
+	}
+
+	guardEnv := NewEnvironment(env)
+	guardEnv.Define(name, raised.Payload)
+
+	result, tailEnv, matched, err := evalCondClauses(ev, spec[1:], guardEnv)
+	if err == nil && !matched {
+		result, err = ev.raise(raised.Payload, raised.Continuable)
+		return result, nil, err
+	}
+
+	return result, tailEnv, err
+}
+
+// catch calls body as guard does, with objects it raises caught rather than
+// passed to handlers installed outside of it. Caught object is returned as
+// condition; errors used for control transfer are returned as they are.
+func (ev *Evaluator) catch(body func() (parser.Sexpr, error)) (parser.Sexpr, *Condition, error) {
+	handlers := ev.handlers
+	ev.handlers = append(handlers[:len(handlers):len(handlers)], nil)
+	result, raised := body()
+	ev.handlers = handlers
+
+	if raised == nil {
+		return result, nil, nil
+	}
+
+	condition, ok := asCondition(raised)
+	if !ok {
+		return nil, nil, raised
+	}
+
+	return nil, condition, nil
+}
+
+// Catch calls thunk, procedure without parameters, as body of guard. It
+// returns value of thunk, or condition of object raised by it, which is nil
+// unless thunk raises. Errors signalled by thunk are raised as error objects.
+func (ev *Evaluator) Catch(thunk parser.Sexpr) (value parser.Sexpr, raised *Condition, err error) {
+	return ev.catch(func() (parser.Sexpr, error) {
+		return ev.Apply(thunk, nil)
+	})
+}
+
+// Raise raises payload as raise or, if continuable is set, as
+// raise-continuable does.
+func (ev *Evaluator) Raise(payload parser.Sexpr, continuable bool) (parser.Sexpr, error) {
+	return ev.raise(payload, continuable)
+}
+
+// raise delivers payload to the innermost exception handler, which is called
+// with outer handlers installed. Guard catches payload by unwinding, so for it
+// and when no handler is installed payload is returned as Condition error.
+// When handler returns from non-continuable raise, secondary error object is
+// raised to outer handlers. Errors signalled by handler itself are raised to
+// outer handlers as well, so raise never returns plain Go error.
+func (ev *Evaluator) raise(payload parser.Sexpr, continuable bool) (parser.Sexpr, error) {
+	handlers := ev.handlers
+	if len(handlers) == 0 || handlers[len(handlers)-1] == nil {
+		return nil, &Condition{Payload: payload, Continuable: continuable}
+	}
+
+	ev.handlers = handlers[:len(handlers)-1]
+	defer func() { ev.handlers = handlers }()
+
+	result, err := ev.Apply(handlers[len(handlers)-1], []parser.Sexpr{payload})
+	if err != nil {
+		return nil, ev.propagate(err)
+	}
+
+	if continuable {
+		return result, nil
+	}
+
+	_, err = ev.raise(&ErrorObject{
+		Message:   HANDLER_RETURNED.Error(),
+		Irritants: []parser.Sexpr{payload},
+		Err:       HANDLER_RETURNED,
+	}, false)
+
+	return nil, err
+}
+
+// propagate raises Go error signalled outside of raise to installed handlers.
+// Conditions have already been delivered to them, and continuation
+// invocations, exits and interruptions are not conditions, so these are
+// returned unchanged.
+func (ev *Evaluator) propagate(err error) error {
+	var (
+		condition   *Condition
+		invoked     *continuationInvoked
+		exit        *Exit
+		interrupted *Interrupted
+	)
+
+	if errors.As(err, &condition) || errors.As(err, &invoked) || errors.As(err, &exit) || errors.As(err, &interrupted) {
+		return err
+	}
+
+	_, err = ev.raise(&ErrorObject{Message: err.Error(), Err: err}, false)
+
+	return err
+}
+
+// builtinWithExceptionHandler calls thunk with handler installed. Objects
+// raised by thunk are passed to handler at the point of raise. Errors
+// signalled by builtins and evaluator are passed to it once they reach this
+// call, i.e. after dynamic-wind after thunks inside thunk have run; since
+// continuations are escaping, handler can only return or escape outward either
+// way.
+func builtinWithExceptionHandler(ev *Evaluator, args []parser.Sexpr) (parser.Sexpr, error) {
+	handler, thunk := args[0], args[1]
+
+	if !IsProcedure(handler) {
+		return nil, fmt.Errorf("%w: %v", NOT_A_PROCEDURE, handler)
+	}
+
+	handlers := ev.handlers
+	ev.handlers = append(handlers[:len(handlers):len(handlers)], handler)
+	defer func() { ev.handlers = handlers }()
+
+	result, err := ev.Apply(thunk, nil)
+	if err != nil {
+		return nil, ev.propagate(err)
+	}
+
+	return result, nil
+}
+
+func builtinRaise(ev *Evaluator, args []parser.Sexpr) (parser.Sexpr, error) {
+	return ev.raise(args[0], false)
+}
+
+func builtinRaiseContinuable(ev *Evaluator, args []parser.Sexpr) (parser.Sexpr, error) {
+	return ev.raise(args[0], true)
+}
+
+func builtinError(ev *Evaluator, args []parser.Sexpr) (parser.Sexpr, error) {
+	message := fmt.Sprint(args[0])
+	if a, ok := args[0].(*parser.Atom); ok && a.Type == parser.STRING {
+		message = (a.Value).(string)
+	}
+
+	return ev.raise(&ErrorObject{Message: message, Irritants: args[1:]}, false)
+}
+
+func builtinIsErrorObject(_ *Evaluator, args []parser.Sexpr) (parser.Sexpr, error) {
+	_, ok := args[0].(*ErrorObject)
+	return makeBool(ok), nil
+}
+
+func builtinErrorObjectMessage(_ *Evaluator, args []parser.Sexpr) (parser.Sexpr, error) {
+	e, ok := args[0].(*ErrorObject)
+	if !ok {
+		return nil, fmt.Errorf("%w: error object expected, got %v", WRONG_TYPE, args[0])
+	}
+
+	return &parser.Atom{Type: parser.STRING, Value: e.Message}, nil
+}
+
+func builtinErrorObjectIrritants(_ *Evaluator, args []parser.Sexpr) (parser.Sexpr, error) {
+	e, ok := args[0].(*ErrorObject)
+	if !ok {
+		return nil, fmt.Errorf("%w: error object expected, got %v", WRONG_TYPE, args[0])
+	}
+
+	return sliceToList(e.Irritants, parser.Nil), nil
+}
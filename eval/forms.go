@@ -0,0 +1,542 @@
+package eval
+
+import (
+	"fmt"
+	"github.com/vkhonin/scheme/parser"
+)
+
+func evalLambda(_ *Evaluator, operands parser.Sexpr, env *Environment) (parser.Sexpr, *Environment, error) {
+	args, err := listToSlice(operands)
+	if err != nil || len(args) < 2 {
+		return nil, nil, fmt.Errorf("%w: lambda", BAD_SYNTAX)
+	}
+
+	closure, err := newClosure(args[0], args[1:], env)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return closure, nil, nil
+}
+
+func evalQuote(_ *Evaluator, operands parser.Sexpr, _ *Environment) (parser.Sexpr, *Environment, error) {
+	args, err := listToSlice(operands)
+	if err != nil || len(args) != 1 {
+		return nil, nil, fmt.Errorf("%w: quote", BAD_SYNTAX)
+	}
+
+	return args[0], nil, nil
+}
+
+func evalDefine(ev *Evaluator, operands parser.Sexpr, env *Environment) (parser.Sexpr, *Environment, error) {
+	args, err := listToSlice(operands)
+	if err != nil || len(args) < 2 {
+		return nil, nil, fmt.Errorf("%w: define", BAD_SYNTAX)
+	}
+
+	var (
+		name  string
+		value parser.Sexpr
+	)
+
+	// (define (name . formals) body ...)
+	if target, ok := args[0].(*parser.Expr); ok && !isNull(target) {
+		if name, ok = symbolName(target.Car); !ok {
+			return nil, nil, fmt.Errorf("%w: define", BAD_SYNTAX)
+		}
+
+		closure, err := newClosure(target.Cdr, args[1:], env)
+		if err != nil {
+			return nil, nil, err
+		}
+		closure.Name = name
+
+		env.Define(name, closure)
+
+		return Unspecified, nil, nil
+	}
+
+	name, ok := symbolName(args[0])
+	if !ok || len(args) != 2 {
+		return nil, nil, fmt.Errorf("%w: define", BAD_SYNTAX)
+	}
+
+	if value, err = ev.Eval(args[1], env); err != nil {
+		return nil, nil, err
+	}
+
+	if closure, ok := value.(*Closure); ok && closure.Name == "" {
+		closure.Name = name
+	}
+
+	env.Define(name, value)
+
+	return Unspecified, nil, nil
+}
+
+func evalSet(ev *Evaluator, operands parser.Sexpr, env *Environment) (parser.Sexpr, *Environment, error) {
+	args, err := listToSlice(operands)
+	if err != nil || len(args) != 2 {
+		return nil, nil, fmt.Errorf("%w: set!", BAD_SYNTAX)
+	}
+
+	name, ok := symbolName(args[0])
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: set!", BAD_SYNTAX)
+	}
+
+	value, err := ev.Eval(args[1], env)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err = env.Set(name, value); err != nil {
+		return nil, nil, err
+	}
+
+	return Unspecified, nil, nil
+}
+
+// evalBegin evaluates expressions in order. Definitions inside begin are made
+// in env, so begin at top level or at body start may contain them.
+func evalBegin(ev *Evaluator, operands parser.Sexpr, env *Environment) (parser.Sexpr, *Environment, error) {
+	body, err := listToSlice(operands)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: begin", BAD_SYNTAX)
+	}
+
+	if len(body) == 0 {
+		return Unspecified, nil, nil
+	}
+
+	return evalTailBody(ev, body, env)
+}
+
+func evalIf(ev *Evaluator, operands parser.Sexpr, env *Environment) (parser.Sexpr, *Environment, error) {
+	args, err := listToSlice(operands)
+	if err != nil || len(args) < 2 || len(args) > 3 {
+		return nil, nil, fmt.Errorf("%w: if", BAD_SYNTAX)
+	}
+
+	test, err := ev.Eval(args[0], env)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if IsTrue(test) {
+		return args[1], env, nil
+	}
+
+	if len(args) == 3 {
+		return args[2], env, nil
+	}
+
+	return Unspecified, nil, nil
+}
+
+func evalCond(ev *Evaluator, operands parser.Sexpr, env *Environment) (parser.Sexpr, *Environment, error) {
+	clauses, err := listToSlice(operands)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: cond", BAD_SYNTAX)
+	}
+
+	result, tailEnv, matched, err := evalCondClauses(ev, clauses, env)
+	if err == nil && !matched {
+		return Unspecified, nil, nil
+	}
+
+	return result, tailEnv, err
+}
+
+// evalCondClauses evaluates first clause whose test is true, reporting
+// whether there was such clause.
+func evalCondClauses(ev *Evaluator, clauses []parser.Sexpr, env *Environment) (parser.Sexpr, *Environment, bool, error) {
+	for i, c := range clauses {
+		clause, err := listToSlice(c)
+		if err != nil || len(clause) == 0 {
+			return nil, nil, false, fmt.Errorf("%w: cond clause", BAD_SYNTAX)
+		}
+
+		if isSymbol(clause[0], "else") {
+			if i != len(clauses)-1 || len(clause) == 1 {
+				return nil, nil, false, fmt.Errorf("%w: cond else clause", BAD_SYNTAX)
+			}
+			result, tailEnv, err := evalTailBody(ev, clause[1:], env)
+			return result, tailEnv, true, err
+		}
+
+		test, err := ev.Eval(clause[0], env)
+		if err != nil {
+			return nil, nil, false, err
+		}
+
+		if IsTrue(test) {
+			result, tailEnv, err := evalClauseBody(ev, test, clause[1:], env)
+			return result, tailEnv, true, err
+		}
+	}
+
+	return nil, nil, false, nil
+}
+
+func evalCase(ev *Evaluator, operands parser.Sexpr, env *Environment) (parser.Sexpr, *Environment, error) {
+	args, err := listToSlice(operands)
+	if err != nil || len(args) < 1 {
+		return nil, nil, fmt.Errorf("%w: case", BAD_SYNTAX)
+	}
+
+	key, err := ev.Eval(args[0], env)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for i, c := range args[1:] {
+		clause, err := listToSlice(c)
+		if err != nil || len(clause) < 2 {
+			return nil, nil, fmt.Errorf("%w: case clause", BAD_SYNTAX)
+		}
+
+		if isSymbol(clause[0], "else") {
+			if i != len(args)-2 {
+				return nil, nil, fmt.Errorf("%w: case else clause", BAD_SYNTAX)
+			}
+			return evalClauseBody(ev, key, clause[1:], env)
+		}
+
+		data, err := listToSlice(clause[0])
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: case clause data", BAD_SYNTAX)
+		}
+
+		for _, datum := range data {
+			if parser.Eqv(key, datum) {
+				return evalClauseBody(ev, key, clause[1:], env)
+			}
+		}
+	}
+
+	return Unspecified, nil, nil
+}
+
+func evalWhen(ev *Evaluator, operands parser.Sexpr, env *Environment) (parser.Sexpr, *Environment, error) {
+	return evalWhenUnless(ev, operands, env, true)
+}
+
+func evalUnless(ev *Evaluator, operands parser.Sexpr, env *Environment) (parser.Sexpr, *Environment, error) {
+	return evalWhenUnless(ev, operands, env, false)
+}
+
+func evalWhenUnless(ev *Evaluator, operands parser.Sexpr, env *Environment, when bool) (parser.Sexpr, *Environment, error) {
+	args, err := listToSlice(operands)
+	if err != nil || len(args) < 2 {
+		return nil, nil, fmt.Errorf("%w: when/unless", BAD_SYNTAX)
+	}
+
+	test, err := ev.Eval(args[0], env)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if IsTrue(test) != when {
+		return Unspecified, nil, nil
+	}
+
+	return evalTailBody(ev, args[1:], env)
+}
+
+func evalAnd(ev *Evaluator, operands parser.Sexpr, env *Environment) (parser.Sexpr, *Environment, error) {
+	return evalAndOr(ev, operands, env, true)
+}
+
+func evalOr(ev *Evaluator, operands parser.Sexpr, env *Environment) (parser.Sexpr, *Environment, error) {
+	return evalAndOr(ev, operands, env, false)
+}
+
+// evalAndOr evaluates operands until one is false (and) or true (or). Last
+// operand is in tail position.
+func evalAndOr(ev *Evaluator, operands parser.Sexpr, env *Environment, and bool) (parser.Sexpr, *Environment, error) {
+	args, err := listToSlice(operands)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: and/or", BAD_SYNTAX)
+	}
+
+	if len(args) == 0 {
+		return makeBool(and), nil, nil
+	}
+
+	for _, arg := range args[:len(args)-1] {
+		value, err := ev.Eval(arg, env)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if IsTrue(value) != and {
+			return value, nil, nil
+		}
+	}
+
+	return args[len(args)-1], env, nil
+}
+
+// evalClauseBody handles body of cond or case clause which was selected by
+// value: either "=> receiver" or sequence of expressions. Clause without
+// expressions evaluates to value.
+func evalClauseBody(ev *Evaluator, value parser.Sexpr, body []parser.Sexpr, env *Environment) (parser.Sexpr, *Environment, error) {
+	if len(body) == 0 {
+		return value, nil, nil
+	}
+
+	if isSymbol(body[0], "=>") {
+		if len(body) != 2 {
+			return nil, nil, fmt.Errorf("%w: => clause", BAD_SYNTAX)
+		}
+
+		receiver, err := ev.Eval(body[1], env)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		return sliceToList([]parser.Sexpr{quoted(receiver), quoted(value)}, parser.Nil), env, nil
+	}
+
+	return evalTailBody(ev, body, env)
+}
+
+// evalTailBody evaluates body leaving last expression in tail position.
+func evalTailBody(ev *Evaluator, body []parser.Sexpr, env *Environment) (parser.Sexpr, *Environment, error) {
+	last, err := ev.evalBody(body, env)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return last, env, nil
+}
+
+func evalLet(ev *Evaluator, operands parser.Sexpr, env *Environment) (parser.Sexpr, *Environment, error) {
+	if pair, ok := operands.(*parser.Expr); ok && !isNull(pair) {
+		if name, ok := symbolName(pair.Car); ok {
+			return evalNamedLet(ev, name, pair.Cdr, env)
+		}
+	}
+
+	names, inits, body, err := parseLet(operands, "let")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	letEnv := NewEnvironment(env)
+
+	for i, name := range names {
+		value, err := ev.Eval(inits[i], env)
+		if err != nil {
+			return nil, nil, err
+		}
+		letEnv.Define(name, value)
+	}
+
+	return evalLetBody(ev, body, letEnv)
+}
+
+// evalNamedLet binds name to procedure with let variables as parameters and
+// body as body in scope of body itself, then calls it with initial values.
+func evalNamedLet(ev *Evaluator, name string, operands parser.Sexpr, env *Environment) (parser.Sexpr, *Environment, error) {
+	names, inits, body, err := parseLet(operands, "named let")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	args := make([]parser.Sexpr, len(inits))
+	for i, init := range inits {
+		if args[i], err = ev.Eval(init, env); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	loopEnv := NewEnvironment(env)
+	closure := &Closure{Name: name, Params: names, Body: body, Env: loopEnv}
+	loopEnv.Define(name, closure)
+
+	bodyEnv, err := closure.bind(ev, args)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return evalTailBody(ev, body, bodyEnv)
+}
+
+func evalLetStar(ev *Evaluator, operands parser.Sexpr, env *Environment) (parser.Sexpr, *Environment, error) {
+	names, inits, body, err := parseLet(operands, "let*")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for i, name := range names {
+		value, err := ev.Eval(inits[i], env)
+		if err != nil {
+			return nil, nil, err
+		}
+		env = NewEnvironment(env)
+		env.Define(name, value)
+	}
+
+	return evalLetBody(ev, body, NewEnvironment(env))
+}
+
+// evalLetrec implements both letrec and letrec*, initializing variables left
+// to right, which is a valid evaluation order for letrec as well.
+func evalLetrec(ev *Evaluator, operands parser.Sexpr, env *Environment) (parser.Sexpr, *Environment, error) {
+	names, inits, body, err := parseLet(operands, "letrec")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	letEnv := NewEnvironment(env)
+
+	for _, name := range names {
+		letEnv.Define(name, unassigned)
+	}
+
+	for i, name := range names {
+		value, err := ev.Eval(inits[i], letEnv)
+		if err != nil {
+			return nil, nil, err
+		}
+		if closure, ok := value.(*Closure); ok && closure.Name == "" {
+			closure.Name = name
+		}
+		letEnv.Define(name, value)
+	}
+
+	return evalLetBody(ev, body, letEnv)
+}
+
+func evalLetBody(ev *Evaluator, body []parser.Sexpr, env *Environment) (parser.Sexpr, *Environment, error) {
+	declareDefines(body, env)
+
+	return evalTailBody(ev, body, env)
+}
+
+// parseLet splits operands of let-like form into variable names, their
+// initializers and body. Duplicate names are rejected except for let*.
+func parseLet(operands parser.Sexpr, form string) ([]string, []parser.Sexpr, []parser.Sexpr, error) {
+	args, err := listToSlice(operands)
+	if err != nil || len(args) < 2 {
+		return nil, nil, nil, fmt.Errorf("%w: %s", BAD_SYNTAX, form)
+	}
+
+	bindings, err := listToSlice(args[0])
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("%w: %s bindings", BAD_SYNTAX, form)
+	}
+
+	names := make([]string, len(bindings))
+	inits := make([]parser.Sexpr, len(bindings))
+	seen := make(map[string]bool)
+
+	for i, b := range bindings {
+		binding, err := listToSlice(b)
+		if err != nil || len(binding) != 2 {
+			return nil, nil, nil, fmt.Errorf("%w: %s binding", BAD_SYNTAX, form)
+		}
+
+		name, ok := symbolName(binding[0])
+		if !ok || (seen[name] && form != "let*") {
+			return nil, nil, nil, fmt.Errorf("%w: %s binding", BAD_SYNTAX, form)
+		}
+		seen[name] = true
+
+		names[i], inits[i] = name, binding[1]
+	}
+
+	return names, inits, args[1:], nil
+}
+
+// evalDo runs do loop. Each iteration binds variables in fresh environment,
+// so closures created by body capture values of their own iteration.
+func evalDo(ev *Evaluator, operands parser.Sexpr, env *Environment) (parser.Sexpr, *Environment, error) {
+	args, err := listToSlice(operands)
+	if err != nil || len(args) < 2 {
+		return nil, nil, fmt.Errorf("%w: do", BAD_SYNTAX)
+	}
+
+	specs, err := listToSlice(args[0])
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: do bindings", BAD_SYNTAX)
+	}
+
+	names := make([]string, len(specs))
+	inits := make([]parser.Sexpr, len(specs))
+	steps := make([]parser.Sexpr, len(specs))
+	seen := make(map[string]bool)
+
+	for i, s := range specs {
+		spec, err := listToSlice(s)
+		if err != nil || len(spec) < 2 || len(spec) > 3 {
+			return nil, nil, fmt.Errorf("%w: do binding", BAD_SYNTAX)
+		}
+
+		name, ok := symbolName(spec[0])
+		if !ok || seen[name] {
+			return nil, nil, fmt.Errorf("%w: do binding", BAD_SYNTAX)
+		}
+		seen[name] = true
+
+		names[i], inits[i] = name, spec[1]
+		if len(spec) == 3 {
+			steps[i] = spec[2]
+		}
+	}
+
+	exit, err := listToSlice(args[1])
+	if err != nil || len(exit) == 0 {
+		return nil, nil, fmt.Errorf("%w: do exit clause", BAD_SYNTAX)
+	}
+
+	commands := args[2:]
+
+	values := make([]parser.Sexpr, len(inits))
+	for i, init := range inits {
+		if values[i], err = ev.Eval(init, env); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	for {
+		if err := ev.Step(); err != nil {
+			return nil, nil, err
+		}
+
+		loopEnv := NewEnvironment(env)
+		for i, name := range names {
+			loopEnv.Define(name, values[i])
+		}
+
+		test, err := ev.Eval(exit[0], loopEnv)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if IsTrue(test) {
+			if len(exit) == 1 {
+				return Unspecified, nil, nil
+			}
+			return evalTailBody(ev, exit[1:], loopEnv)
+		}
+
+		for _, command := range commands {
+			if _, err = ev.Eval(command, loopEnv); err != nil {
+				return nil, nil, err
+			}
+		}
+
+		for i, step := range steps {
+			if step == nil {
+				if values[i], err = loopEnv.Lookup(names[i]); err != nil {
+					return nil, nil, err
+				}
+			} else if values[i], err = ev.Eval(step, loopEnv); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package eval
+
+import (
+	"fmt"
+	"github.com/vkhonin/scheme/parser/number"
+)
+
+// Limits bound resources programs run by evaluator may use. Zero fields are
+// not limited. Evaluator counts resources used by all programs it runs until
+// ResetUsage, and stops with Interrupted wrapping RESOURCE_LIMIT once they
+// exceed limits.
+type Limits struct {
+	MaxSteps int64 // Steps of evaluation, see Step
+	MaxCells int64 // Pairs, vector elements and words of big numbers allocated, see Allocate
+	MaxDepth int   // Nested calls in progress, see Enter
+}
+
+// ResetUsage makes evaluator count steps and cells from zero.
+func (ev *Evaluator) ResetUsage() {
+	ev.steps, ev.cells = 0, 0
+}
+
+// Step counts step of evaluation. It returns Interrupted if steps exceed
+// limit or context of ev is done. Evaluator steps before evaluating
+// combinations and iterations of do loops, and other backends should at
+// their safe points, e.g. calls and jumps.
+func (ev *Evaluator) Step() error {
+	ev.steps++
+	if ev.Limits.MaxSteps > 0 && ev.steps > ev.Limits.MaxSteps {
+		return &Interrupted{Err: fmt.Errorf("%w: more than %d steps", RESOURCE_LIMIT, ev.Limits.MaxSteps)}
+	}
+
+	return ev.checkContext()
+}
+
+// Allocate counts n cells allocated, e.g. pairs of list, returning
+// Interrupted if cells exceed limit.
+func (ev *Evaluator) Allocate(n int) error {
+	ev.cells += int64(n)
+	if ev.Limits.MaxCells > 0 && ev.cells > ev.Limits.MaxCells {
+		return &Interrupted{Err: fmt.Errorf("%w: more than %d cells", RESOURCE_LIMIT, ev.Limits.MaxCells)}
+	}
+
+	return nil
+}
+
+// Enter counts call entered, returning Interrupted if calls nest deeper
+// than limit. Calls entered, even if Enter fails, are left with Leave.
+// Evaluator enters evaluation of each expression, since it nests as Go
+// calls, and machine enters calls that are not tail calls.
+func (ev *Evaluator) Enter() error {
+	ev.depth++
+	if ev.Limits.MaxDepth > 0 && ev.depth > ev.Limits.MaxDepth {
+		return &Interrupted{Err: fmt.Errorf("%w: calls nested deeper than %d", RESOURCE_LIMIT, ev.Limits.MaxDepth)}
+	}
+
+	return nil
+}
+
+// Leave counts n calls left.
+func (ev *Evaluator) Leave(n int) {
+	ev.depth -= n
+}
+
+// allocateNumber counts cells of number n computed by arithmetic, one per
+// machine word of its digits beyond the first, so that numbers growing
+// without bound exceed limit as lists do.
+func (ev *Evaluator) allocateNumber(n *number.Number) error {
+	return ev.Allocate(n.Words() - 1)
+}
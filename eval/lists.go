@@ -0,0 +1,148 @@
+package eval
+
+import (
+	"fmt"
+	"github.com/vkhonin/scheme/parser"
+)
+
+// listArgs converts list arguments of map-like procedure to slices and
+// returns length of the shortest one.
+func listArgs(name string, lists []parser.Sexpr) ([][]parser.Sexpr, int, error) {
+	slices := make([][]parser.Sexpr, len(lists))
+	shortest := -1
+
+	for i, list := range lists {
+		items, err := listToSlice(list)
+		if err != nil {
+			return nil, 0, fmt.Errorf("%w: %s expects lists, got %v", WRONG_TYPE, name, list)
+		}
+
+		slices[i] = items
+		if shortest < 0 || len(items) < shortest {
+			shortest = len(items)
+		}
+	}
+
+	return slices, shortest, nil
+}
+
+// column returns i-th elements of lists followed by extra arguments.
+func column(slices [][]parser.Sexpr, i int, extra ...parser.Sexpr) []parser.Sexpr {
+	args := make([]parser.Sexpr, 0, len(slices)+len(extra))
+
+	for _, items := range slices {
+		args = append(args, items[i])
+	}
+
+	return append(args, extra...)
+}
+
+func builtinMap(ev *Evaluator, args []parser.Sexpr) (parser.Sexpr, error) {
+	slices, n, err := listArgs("map", args[1:])
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]parser.Sexpr, n)
+	for i := range n {
+		if results[i], err = ev.Apply(args[0], column(slices, i)); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := ev.Allocate(n); err != nil {
+		return nil, err
+	}
+
+	return sliceToList(results, parser.Nil), nil
+}
+
+func builtinForEach(ev *Evaluator, args []parser.Sexpr) (parser.Sexpr, error) {
+	slices, n, err := listArgs("for-each", args[1:])
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range n {
+		if _, err = ev.Apply(args[0], column(slices, i)); err != nil {
+			return nil, err
+		}
+	}
+
+	return Unspecified, nil
+}
+
+func builtinFilter(ev *Evaluator, args []parser.Sexpr) (parser.Sexpr, error) {
+	slices, n, err := listArgs("filter", args[1:])
+	if err != nil {
+		return nil, err
+	}
+
+	var results []parser.Sexpr
+	for i := range n {
+		keep, err := ev.Apply(args[0], column(slices, i))
+		if err != nil {
+			return nil, err
+		}
+		if IsTrue(keep) {
+			results = append(results, slices[0][i])
+		}
+	}
+
+	if err := ev.Allocate(len(results)); err != nil {
+		return nil, err
+	}
+
+	return sliceToList(results, parser.Nil), nil
+}
+
+// builtinFold implements SRFI 1 fold: (kons elem ... acc) from left to right.
+func builtinFold(ev *Evaluator, args []parser.Sexpr) (parser.Sexpr, error) {
+	slices, n, err := listArgs("fold", args[2:])
+	if err != nil {
+		return nil, err
+	}
+
+	acc := args[1]
+	for i := range n {
+		if acc, err = ev.Apply(args[0], column(slices, i, acc)); err != nil {
+			return nil, err
+		}
+	}
+
+	return acc, nil
+}
+
+// builtinFoldLeft implements (f acc elem ...) from left to right.
+func builtinFoldLeft(ev *Evaluator, args []parser.Sexpr) (parser.Sexpr, error) {
+	slices, n, err := listArgs("fold-left", args[2:])
+	if err != nil {
+		return nil, err
+	}
+
+	acc := args[1]
+	for i := range n {
+		if acc, err = ev.Apply(args[0], append([]parser.Sexpr{acc}, column(slices, i)...)); err != nil {
+			return nil, err
+		}
+	}
+
+	return acc, nil
+}
+
+// builtinFoldRight implements (f elem ... acc) from right to left.
+func builtinFoldRight(ev *Evaluator, args []parser.Sexpr) (parser.Sexpr, error) {
+	slices, n, err := listArgs("fold-right", args[2:])
+	if err != nil {
+		return nil, err
+	}
+
+	acc := args[1]
+	for i := n - 1; i >= 0; i-- {
+		if acc, err = ev.Apply(args[0], column(slices, i, acc)); err != nil {
+			return nil, err
+		}
+	}
+
+	return acc, nil
+}
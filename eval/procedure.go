@@ -0,0 +1,115 @@
+package eval
+
+import (
+	"fmt"
+	"github.com/vkhonin/scheme/parser"
+)
+
+// Builtin is a procedure implemented in Go. MaxArgs is -1 for variadic ones.
+type Builtin struct {
+	Name    string
+	MinArgs int
+	MaxArgs int
+	Fn      func(ev *Evaluator, args []parser.Sexpr) (parser.Sexpr, error)
+}
+
+// Closure is a procedure created by lambda. It keeps environment it was
+// created in, so free variables of Body are resolved lexically. Rest is
+// empty unless procedure accepts variable number of arguments.
+type Closure struct {
+	Name   string
+	Params []string
+	Rest   string
+	Body   []parser.Sexpr
+	Env    *Environment
+}
+
+// Applier is procedure implemented outside of evaluator, e.g. closure
+// compiled to bytecode, which Apply calls with its evaluator.
+type Applier interface {
+	parser.Sexpr
+	Apply(ev *Evaluator, args []parser.Sexpr) (parser.Sexpr, error)
+}
+
+func (b *Builtin) Equals(s parser.Sexpr) bool {
+	b2, ok := s.(*Builtin)
+	return ok && b == b2
+}
+
+func (b *Builtin) String() string {
+	return "#<procedure " + b.Name + ">"
+}
+
+// newClosure creates closure from lambda formals and body. Formals are
+// either a symbol, a proper list of symbols or a dotted list of symbols.
+func newClosure(formals parser.Sexpr, body []parser.Sexpr, env *Environment) (*Closure, error) {
+	closure := &Closure{Body: body, Env: env}
+	seen := make(map[string]bool)
+
+	for !isNull(formals) {
+		var (
+			name string
+			ok   bool
+		)
+
+		pair, isPair := formals.(*parser.Expr)
+		if isPair {
+			name, ok = symbolName(pair.Car)
+		} else {
+			name, ok = symbolName(formals)
+		}
+
+		if !ok || seen[name] {
+			return nil, fmt.Errorf("%w: invalid lambda formals", BAD_SYNTAX)
+		}
+		seen[name] = true
+
+		if !isPair {
+			closure.Rest = name
+			break
+		}
+
+		closure.Params = append(closure.Params, name)
+		formals = pair.Cdr
+	}
+
+	return closure, nil
+}
+
+func (c *Closure) Equals(s parser.Sexpr) bool {
+	c2, ok := s.(*Closure)
+	return ok && c == c2
+}
+
+func (c *Closure) String() string {
+	if c.Name == "" {
+		return "#<procedure>"
+	}
+
+	return "#<procedure " + c.Name + ">"
+}
+
+// bind returns new environment extending closure one with args bound to
+// parameters. List of rest arguments is allocated by ev.
+func (c *Closure) bind(ev *Evaluator, args []parser.Sexpr) (*Environment, error) {
+	if len(args) < len(c.Params) || (c.Rest == "" && len(args) > len(c.Params)) {
+		return nil, fmt.Errorf("%w: %v called with %d", WRONG_ARITY, c, len(args))
+	}
+
+	env := NewEnvironment(c.Env)
+
+	for i, name := range c.Params {
+		env.Define(name, args[i])
+	}
+
+	if c.Rest != "" {
+		if err := ev.Allocate(len(args) - len(c.Params)); err != nil {
+			return nil, err
+		}
+		env.Define(c.Rest, sliceToList(args[len(c.Params):], parser.Nil))
+	}
+
+	declareDefines(c.Body, env)
+
+	return env, nil
+}
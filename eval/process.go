@@ -0,0 +1,47 @@
+package eval
+
+import (
+	"fmt"
+	"github.com/vkhonin/scheme/parser"
+	"github.com/vkhonin/scheme/parser/number"
+)
+
+// Exit is error evaluation ends with when exit procedure is called. It
+// unwinds evaluation like escaping continuation, so after thunks of
+// dynamic-wind run, and guard and exception handlers don't catch it. Code is
+// exit status: n for (exit n) with exact integer n, 1 for (exit #f), and 0
+// otherwise.
+type Exit struct {
+	Code int
+}
+
+func (e *Exit) Error() string {
+	return fmt.Sprintf("exit with status %d", e.Code)
+}
+
+func builtinCommandLine(ev *Evaluator, _ []parser.Sexpr) (parser.Sexpr, error) {
+	args := make([]parser.Sexpr, len(ev.CommandLine))
+	for i, arg := range ev.CommandLine {
+		args[i] = parser.Str(arg)
+	}
+
+	return parser.List(args...), nil
+}
+
+func builtinExit(_ *Evaluator, args []parser.Sexpr) (parser.Sexpr, error) {
+	if len(args) == 0 {
+		return nil, &Exit{}
+	}
+
+	a, ok := args[0].(*parser.Atom)
+	switch {
+	case ok && a.Type == parser.BOOL && !(a.Value).(bool):
+		return nil, &Exit{Code: 1}
+	case ok && a.Type == parser.NUMBER:
+		if i := (a.Value).(*number.Number).Integer(); i != nil && i.IsInt64() {
+			return nil, &Exit{Code: int(i.Int64())}
+		}
+	}
+
+	return nil, &Exit{}
+}
@@ -0,0 +1,111 @@
+package eval
+
+import (
+	"fmt"
+	"github.com/vkhonin/scheme/parser"
+)
+
+// Promise is a delayed computation created by delay, delay-force or
+// make-promise. Forcing memoizes result. Promises chained by delay-force
+// share one box, so forcing long chains runs in constant space.
+type Promise struct {
+	box *promiseBox
+}
+
+// promiseBox holds either the result or the expression computing it. When
+// delay is false, expression yields another promise to continue with.
+type promiseBox struct {
+	done  bool
+	value parser.Sexpr
+	expr  parser.Sexpr
+	env   *Environment
+	delay bool
+}
+
+func (p *Promise) Equals(s parser.Sexpr) bool {
+	p2, ok := s.(*Promise)
+	return ok && p == p2
+}
+
+func (*Promise) String() string {
+	return "#<promise>"
+}
+
+func evalDelay(_ *Evaluator, operands parser.Sexpr, env *Environment) (parser.Sexpr, *Environment, error) {
+	args, err := listToSlice(operands)
+	if err != nil || len(args) != 1 {
+		return nil, nil, fmt.Errorf("%w: delay", BAD_SYNTAX)
+	}
+
+	return &Promise{box: &promiseBox{expr: args[0], env: env, delay: true}}, nil, nil
+}
+
+func evalDelayForce(_ *Evaluator, operands parser.Sexpr, env *Environment) (parser.Sexpr, *Environment, error) {
+	args, err := listToSlice(operands)
+	if err != nil || len(args) != 1 {
+		return nil, nil, fmt.Errorf("%w: delay-force", BAD_SYNTAX)
+	}
+
+	return &Promise{box: &promiseBox{expr: args[0], env: env}}, nil, nil
+}
+
+// NewPromise returns promise forcing which calls thunk, procedure without
+// parameters, as delay does with its expression. If lazy is set, thunk must
+// return promise to continue with, as expression of delay-force does.
+func NewPromise(thunk parser.Sexpr, lazy bool) *Promise {
+	return &Promise{box: &promiseBox{expr: parser.List(thunk), env: NewNullEnvironment(), delay: !lazy}}
+}
+
+// Force returns value of promise p, computing it if necessary.
+func (ev *Evaluator) Force(p *Promise) (parser.Sexpr, error) {
+	for !p.box.done {
+		box := p.box
+
+		value, err := ev.Eval(box.expr, box.env)
+		if err != nil {
+			return nil, err
+		}
+
+		// Promise may have been forced while its expression was evaluated.
+		if box.done {
+			break
+		}
+
+		if box.delay {
+			box.done, box.value, box.expr, box.env = true, value, nil, nil
+			break
+		}
+
+		next, ok := value.(*Promise)
+		if !ok {
+			return nil, fmt.Errorf("%w: delay-force expression must yield promise, got %v", WRONG_TYPE, value)
+		}
+
+		*box = *next.box
+		next.box = box
+	}
+
+	return p.box.value, nil
+}
+
+func builtinForce(ev *Evaluator, args []parser.Sexpr) (parser.Sexpr, error) {
+	p, ok := args[0].(*Promise)
+	if !ok {
+		return args[0], nil
+	}
+
+	return ev.Force(p)
+}
+
+func builtinMakePromise(_ *Evaluator, args []parser.Sexpr) (parser.Sexpr, error) {
+	if p, ok := args[0].(*Promise); ok {
+		return p, nil
+	}
+
+	return &Promise{box: &promiseBox{done: true, value: args[0]}}, nil
+}
+
+func builtinIsPromise(_ *Evaluator, args []parser.Sexpr) (parser.Sexpr, error) {
+	_, ok := args[0].(*Promise)
+	return makeBool(ok), nil
+}
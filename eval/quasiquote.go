@@ -0,0 +1,151 @@
+package eval
+
+import (
+	"fmt"
+	"github.com/vkhonin/scheme/parser"
+)
+
+func evalQuasiquote(ev *Evaluator, operands parser.Sexpr, env *Environment) (parser.Sexpr, *Environment, error) {
+	args, err := listToSlice(operands)
+	if err != nil || len(args) != 1 {
+		return nil, nil, fmt.Errorf("%w: quasiquote", BAD_SYNTAX)
+	}
+
+	result, err := ev.quasiquote(args[0], 1, env)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return result, nil, nil
+}
+
+// quasiquote builds value of template at given nesting depth. Unquoted parts
+// are evaluated only at depth 1; nested quasiquote forms increase depth and
+// unquote forms inside them decrease it.
+func (ev *Evaluator) quasiquote(template parser.Sexpr, depth int, env *Environment) (parser.Sexpr, error) {
+	switch t := template.(type) {
+	case *parser.Vector:
+		items, err := ev.quasiquoteList(sliceToList(t.Elements, parser.Nil), depth, env)
+		if err != nil {
+			return nil, err
+		}
+
+		elements, err := listToSlice(items)
+		if err != nil {
+			return nil, err
+		}
+		if elements == nil {
+			elements = make([]parser.Sexpr, 0)
+		}
+		if err := ev.Allocate(len(elements)); err != nil {
+			return nil, err
+		}
+
+		return &parser.Vector{Elements: elements}, nil
+	case *parser.Expr:
+		return ev.quasiquoteList(t, depth, env)
+	default:
+		return template, nil
+	}
+}
+
+// quasiquoteList processes list template walking its spine iteratively.
+func (ev *Evaluator) quasiquoteList(template parser.Sexpr, depth int, env *Environment) (parser.Sexpr, error) {
+	var items []parser.Sexpr
+
+	for {
+		pair, ok := template.(*parser.Expr)
+		if ok && isNull(pair) {
+			return ev.templateList(items, parser.Nil)
+		}
+		if !ok {
+			tail, err := ev.quasiquote(template, depth, env)
+			if err != nil {
+				return nil, err
+			}
+			return ev.templateList(items, tail)
+		}
+
+		// Form in tail position, e.g. (a unquote b) which is (a . ,b).
+		if keyword, operand, ok := qqForm(pair); ok {
+			tail, err := ev.quasiquoteForm(keyword, operand, depth, env)
+			if err != nil {
+				return nil, err
+			}
+			return ev.templateList(items, tail)
+		}
+
+		if element, ok := pair.Car.(*parser.Expr); ok {
+			if keyword, operand, ok := qqForm(element); ok && keyword == "unquote-splicing" && depth == 1 {
+				value, err := ev.Eval(operand, env)
+				if err != nil {
+					return nil, err
+				}
+
+				spliced, err := listToSlice(value)
+				if err != nil {
+					return nil, fmt.Errorf("%w: unquote-splicing of %v", WRONG_TYPE, value)
+				}
+				items = append(items, spliced...)
+				template = pair.Cdr
+				continue
+			}
+		}
+
+		item, err := ev.quasiquote(pair.Car, depth, env)
+		if err != nil {
+			return nil, err
+		}
+
+		items = append(items, item)
+		template = pair.Cdr
+	}
+}
+
+// quasiquoteForm handles quasiquote, unquote and unquote-splicing forms.
+func (ev *Evaluator) quasiquoteForm(keyword string, operand parser.Sexpr, depth int, env *Environment) (parser.Sexpr, error) {
+	switch {
+	case keyword == "unquote" && depth == 1:
+		return ev.Eval(operand, env)
+	case keyword == "unquote-splicing" && depth == 1:
+		return nil, fmt.Errorf("%w: unquote-splicing outside of list", BAD_SYNTAX)
+	}
+
+	innerDepth := depth - 1
+	if keyword == "quasiquote" {
+		innerDepth = depth + 1
+	}
+
+	inner, err := ev.quasiquote(operand, innerDepth, env)
+	if err != nil {
+		return nil, err
+	}
+
+	return ev.templateList([]parser.Sexpr{parser.Intern(keyword), inner}, parser.Nil)
+}
+
+// templateList returns list of items ending with tail, counting its pairs as
+// allocated, since all of them are built, spliced elements included.
+func (ev *Evaluator) templateList(items []parser.Sexpr, tail parser.Sexpr) (parser.Sexpr, error) {
+	if err := ev.Allocate(len(items)); err != nil {
+		return nil, err
+	}
+
+	return sliceToList(items, tail), nil
+}
+
+// qqForm reports whether pair is (keyword operand) for one of quasiquote
+// related keywords.
+func qqForm(pair *parser.Expr) (string, parser.Sexpr, bool) {
+	keyword, ok := symbolName(pair.Car)
+	if !ok || (keyword != "quasiquote" && keyword != "unquote" && keyword != "unquote-splicing") {
+		return "", nil, false
+	}
+
+	rest, ok := pair.Cdr.(*parser.Expr)
+	if !ok || isNull(rest) || !isNull(rest.Cdr) {
+		return "", nil, false
+	}
+
+	return keyword, rest.Car, true
+}
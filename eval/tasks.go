@@ -0,0 +1,169 @@
+package eval
+
+import (
+	"fmt"
+	"github.com/vkhonin/scheme/parser"
+	"reflect"
+)
+
+// Channel is channel tasks of spawn communicate with, see make-channel.
+type Channel struct {
+	ch chan parser.Sexpr
+}
+
+func (c *Channel) Equals(s parser.Sexpr) bool {
+	c2, ok := s.(*Channel)
+	return ok && c == c2
+}
+
+func (*Channel) String() string {
+	return "#<channel>"
+}
+
+// fork returns evaluator for task spawned by ev. It shares configuration of
+// ev, i.e. command line, interaction environment, context and limits, but
+// not dynamic state, e.g. exception handlers or resources used.
+func (ev *Evaluator) fork() *Evaluator {
+	return &Evaluator{
+		CommandLine: ev.CommandLine,
+		interaction: ev.interaction,
+		ctx:         ev.ctx,
+		done:        ev.done,
+		Limits:      ev.Limits,
+	}
+}
+
+// builtinSpawn calls thunk in new goroutine with its own evaluator, and
+// returns channel getting value of thunk, or object it raises, once it
+// returns.
+func builtinSpawn(ev *Evaluator, args []parser.Sexpr) (parser.Sexpr, error) {
+	thunk := args[0]
+	if !IsProcedure(thunk) {
+		return nil, fmt.Errorf("%w: procedure expected, got %v", WRONG_TYPE, thunk)
+	}
+
+	task := ev.fork()
+	result := &Channel{ch: make(chan parser.Sexpr, 1)}
+
+	go func() {
+		value, err := task.Apply(thunk, nil)
+		if err != nil {
+			var ok bool
+			if value, ok = conditionPayload(err); !ok {
+				value = &ErrorObject{Message: err.Error(), Err: err}
+			}
+		}
+		result.ch <- value
+	}()
+
+	return result, nil
+}
+
+func builtinMakeChannel(_ *Evaluator, args []parser.Sexpr) (parser.Sexpr, error) {
+	capacity := 0
+
+	if len(args) > 0 {
+		n, err := toNumber(args[0])
+		if err != nil {
+			return nil, err
+		}
+
+		i := n.Integer()
+		if i == nil || !i.IsInt64() || i.Sign() < 0 || i.Int64() > 1<<20 {
+			return nil, fmt.Errorf("%w: capacity must be exact integer from 0 to %d, got %v", WRONG_TYPE, 1<<20, args[0])
+		}
+		capacity = int(i.Int64())
+	}
+
+	return &Channel{ch: make(chan parser.Sexpr, capacity)}, nil
+}
+
+func builtinChannelSend(ev *Evaluator, args []parser.Sexpr) (parser.Sexpr, error) {
+	c, err := toChannel(args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	select {
+	case c.ch <- args[1]:
+		return Unspecified, nil
+	case <-ev.done:
+		return nil, ev.checkContext()
+	}
+}
+
+func builtinChannelReceive(ev *Evaluator, args []parser.Sexpr) (parser.Sexpr, error) {
+	c, err := toChannel(args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	select {
+	case value := <-c.ch:
+		return value, nil
+	case <-ev.done:
+		return nil, ev.checkContext()
+	}
+}
+
+// builtinSelect waits until one of channel operations given by clauses may
+// proceed, performs it and returns value of its handler. Clause (ch handler)
+// receives value from ch and calls handler with it, and clause (ch value
+// handler) sends value to ch and calls handler without arguments. Procedure
+// given after clauses is called if no operation may proceed at once.
+func builtinSelect(ev *Evaluator, args []parser.Sexpr) (parser.Sexpr, error) {
+	var otherwise parser.Sexpr
+	if last := args[len(args)-1]; IsProcedure(last) {
+		otherwise, args = last, args[:len(args)-1]
+	}
+
+	cases := make([]reflect.SelectCase, 0, len(args)+1)
+	handlers := make([]parser.Sexpr, 0, len(args))
+
+	for _, arg := range args {
+		clause, err := listToSlice(arg)
+		if err != nil || len(clause) < 2 || len(clause) > 3 {
+			return nil, fmt.Errorf("%w: select clause expected, got %v", WRONG_TYPE, arg)
+		}
+
+		c, err := toChannel(clause[0])
+		if err != nil {
+			return nil, err
+		}
+
+		if len(clause) == 2 {
+			cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(c.ch)})
+		} else {
+			cases = append(cases, reflect.SelectCase{Dir: reflect.SelectSend, Chan: reflect.ValueOf(c.ch), Send: reflect.ValueOf(&clause[1]).Elem()})
+		}
+		handlers = append(handlers, clause[len(clause)-1])
+	}
+
+	if otherwise != nil {
+		cases = append(cases, reflect.SelectCase{Dir: reflect.SelectDefault})
+	} else if ev.done != nil {
+		cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ev.done)})
+	}
+
+	chosen, value, _ := reflect.Select(cases)
+
+	switch {
+	case chosen == len(handlers) && otherwise != nil:
+		return ev.Apply(otherwise, nil)
+	case chosen == len(handlers):
+		return nil, ev.checkContext()
+	case cases[chosen].Dir == reflect.SelectRecv:
+		return ev.Apply(handlers[chosen], []parser.Sexpr{value.Interface().(parser.Sexpr)})
+	default:
+		return ev.Apply(handlers[chosen], nil)
+	}
+}
+
+func toChannel(s parser.Sexpr) (*Channel, error) {
+	c, ok := s.(*Channel)
+	if !ok {
+		return nil, fmt.Errorf("%w: channel expected, got %v", WRONG_TYPE, s)
+	}
+
+	return c, nil
+}
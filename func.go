@@ -0,0 +1,380 @@
+package scheme
+
+import (
+	"context"
+	"fmt"
+	"github.com/vkhonin/scheme/eval"
+	"github.com/vkhonin/scheme/parser"
+	"github.com/vkhonin/scheme/parser/number"
+	"math/big"
+	"reflect"
+	"sync"
+)
+
+var (
+	sexprType   = reflect.TypeFor[parser.Sexpr]()
+	errorType   = reflect.TypeFor[error]()
+	contextType = reflect.TypeFor[context.Context]()
+	bigInt      = reflect.TypeFor[*big.Int]()
+	bigRat      = reflect.TypeFor[*big.Rat]()
+	bytesType   = reflect.TypeFor[[]byte]()
+)
+
+// DefineFunc binds name to procedure calling Go function fn, e.g.
+//
+//	interp.DefineFunc("http-get", func(url string) (string, error) { ... })
+//
+// Arguments are converted to types of parameters of fn, see Decode, and
+// variadic functions take any number of trailing arguments. If the first
+// parameter is context.Context, fn gets context of evaluation, see
+// EvalContext, and procedure takes arguments of the rest. Procedure returns
+// value of the first result of fn converted as by Value, or unspecified value
+// if fn has none. Non-nil error returned as the last result is raised as
+// error object, which guard and with-exception-handler catch, and which
+// wraps it for errors.Is and errors.As of embedder.
+//
+// It reports UNSUPPORTED_TYPE if fn is not function, has parameters of types
+// Decode does not convert, or has results other than value, error or both.
+func (i *Interp) DefineFunc(name string, fn any) error {
+	builtin, err := newBuiltin(name, fn)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+
+	i.env.Define(name, builtin)
+
+	return nil
+}
+
+// newBuiltin returns builtin procedure name calling Go function fn.
+func newBuiltin(name string, fn any) (*eval.Builtin, error) {
+	f := reflect.ValueOf(fn)
+	if f.Kind() != reflect.Func || f.IsNil() {
+		return nil, fmt.Errorf("%w: function expected, got %T", UNSUPPORTED_TYPE, fn)
+	}
+
+	c, err := callerOf(f.Type())
+	if err != nil {
+		return nil, err
+	}
+
+	return &eval.Builtin{
+		Name:    name,
+		MinArgs: c.minArgs,
+		MaxArgs: c.maxArgs,
+		Fn: func(ev *eval.Evaluator, args []parser.Sexpr) (parser.Sexpr, error) {
+			return c.call(ev, f, args)
+		},
+	}, nil
+}
+
+// caller calls Go functions of some type with arguments converted from data.
+type caller struct {
+	decoders    []decoder
+	withContext bool // Whether the first parameter is context.Context
+	minArgs     int
+	maxArgs     int  // Maximum number of arguments, -1 for variadic functions
+	values      int  // Number of results but error, 0 or 1
+	withError   bool // Whether the last result is error
+}
+
+// callers are callers by types of functions they call.
+var callers sync.Map
+
+// callerOf returns caller of functions of type t, or reports UNSUPPORTED_TYPE
+// if arguments or results of t are not converted.
+func callerOf(t reflect.Type) (*caller, error) {
+	if c, ok := callers.Load(t); ok {
+		return c.(*caller), nil
+	}
+
+	params := t.NumIn()
+	c := &caller{withContext: params > 0 && t.In(0) == contextType}
+	if c.withContext {
+		params--
+	}
+
+	c.decoders = make([]decoder, params)
+	c.minArgs, c.maxArgs = params, params
+	if t.IsVariadic() {
+		c.minArgs, c.maxArgs = params-1, -1
+	}
+
+	for i := range c.decoders {
+		in := t.In(t.NumIn() - params + i)
+		if t.IsVariadic() && i == len(c.decoders)-1 {
+			in = in.Elem()
+		}
+
+		d, err := decoderOf(in)
+		if err != nil {
+			return nil, fmt.Errorf("parameter %d: %w", i+1, err)
+		}
+		c.decoders[i] = d
+	}
+
+	c.withError = t.NumOut() > 0 && t.Out(t.NumOut()-1) == errorType
+	c.values = t.NumOut()
+	if c.withError {
+		c.values--
+	}
+	if c.values > 1 {
+		return nil, fmt.Errorf("%w: function with %d results", UNSUPPORTED_TYPE, t.NumOut())
+	}
+
+	callers.Store(t, c)
+
+	return c, nil
+}
+
+// call calls function f with converted args and returns its converted
+// value. Error f returns is raised as error object.
+func (c *caller) call(ev *eval.Evaluator, f reflect.Value, args []parser.Sexpr) (parser.Sexpr, error) {
+	in := make([]reflect.Value, 0, len(args)+1)
+	if c.withContext {
+		in = append(in, reflect.ValueOf(ev.Context()))
+	}
+
+	for i, arg := range args {
+		v, err := c.decoders[min(i, len(c.decoders)-1)](arg)
+		if err != nil {
+			return nil, err
+		}
+		in = append(in, v)
+	}
+
+	out := f.Call(in)
+
+	if c.withError {
+		if err, _ := out[len(out)-1].Interface().(error); err != nil {
+			return raise(ev, err)
+		}
+	}
+
+	if c.values == 0 {
+		return eval.Unspecified, nil
+	}
+
+	return Value(out[0].Interface())
+}
+
+// decoder converts datum to Go value of some type.
+type decoder func(datum parser.Sexpr) (reflect.Value, error)
+
+// Decode converts datum to value of Go type t, which is:
+//
+//   - interface implemented by data, e.g. parser.Sexpr or any, which gets
+//     datum as it is, or type of data, which gets datum of that type
+//   - bool, which gets boolean
+//   - integer type, which gets exact integer in its range
+//   - float type, which gets real number
+//   - string, which gets string
+//   - *big.Int, which gets exact integer, and *big.Rat, which gets exact real
+//   - []byte, which gets bytevector, sharing its bytes
+//   - other slice type, which gets list or vector of data its elements get
+//   - map type, which gets association list of data its keys and values get
+//   - pointer, struct or interface type, which gets Object of value
+//     assignable to it, copied for structs
+//
+// Interfaces implemented by data get Go values of objects assignable to
+// them, e.g. any gets 1 for 1 and Go value of object for object.
+//
+// It reports UNSUPPORTED_TYPE for other types and eval.WRONG_TYPE for data t
+// does not get.
+func Decode(datum parser.Sexpr, t reflect.Type) (reflect.Value, error) {
+	d, err := decoderOf(t)
+	if err != nil {
+		return reflect.Value{}, err
+	}
+
+	return d(datum)
+}
+
+// decoderOf returns decoder of type t, see Decode.
+func decoderOf(t reflect.Type) (decoder, error) {
+	switch {
+	case t.Kind() == reflect.Interface && sexprType.Implements(t), t.Implements(sexprType):
+		return func(datum parser.Sexpr) (reflect.Value, error) {
+			if v, ok := objectValue(datum, t); ok {
+				return v, nil
+			}
+			if !reflect.TypeOf(datum).AssignableTo(t) {
+				return reflect.Value{}, fmt.Errorf("%w: %v expected, got %v", eval.WRONG_TYPE, t, datum)
+			}
+			v := reflect.New(t).Elem()
+			v.Set(reflect.ValueOf(datum))
+			return v, nil
+		}, nil
+	case t == bigInt:
+		return func(datum parser.Sexpr) (reflect.Value, error) {
+			n, err := exactInteger(datum)
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			return reflect.ValueOf(new(big.Int).Set(n)), nil
+		}, nil
+	case t == bigRat:
+		return func(datum parser.Sexpr) (reflect.Value, error) {
+			n, ok := toNumber(datum)
+			if !ok || n.Rat() == nil {
+				return reflect.Value{}, fmt.Errorf("%w: exact real expected, got %v", eval.WRONG_TYPE, datum)
+			}
+			return reflect.ValueOf(n.Rat()), nil
+		}, nil
+	case t == bytesType:
+		return func(datum parser.Sexpr) (reflect.Value, error) {
+			b, ok := datum.(*parser.Bytevector)
+			if !ok {
+				return reflect.Value{}, fmt.Errorf("%w: bytevector expected, got %v", eval.WRONG_TYPE, datum)
+			}
+			return reflect.ValueOf(b.Bytes), nil
+		}, nil
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return func(datum parser.Sexpr) (reflect.Value, error) {
+			a, ok := datum.(*parser.Atom)
+			if !ok || a.Type != parser.BOOL {
+				return reflect.Value{}, fmt.Errorf("%w: boolean expected, got %v", eval.WRONG_TYPE, datum)
+			}
+			return reflect.ValueOf(a.Value).Convert(t), nil
+		}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return func(datum parser.Sexpr) (reflect.Value, error) {
+			n, err := exactInteger(datum)
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			v := reflect.New(t).Elem()
+			if !n.IsInt64() || v.OverflowInt(n.Int64()) {
+				return reflect.Value{}, fmt.Errorf("%w: integer of %v expected, got %v", eval.WRONG_TYPE, t, datum)
+			}
+			v.SetInt(n.Int64())
+			return v, nil
+		}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return func(datum parser.Sexpr) (reflect.Value, error) {
+			n, err := exactInteger(datum)
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			v := reflect.New(t).Elem()
+			if !n.IsUint64() || v.OverflowUint(n.Uint64()) {
+				return reflect.Value{}, fmt.Errorf("%w: integer of %v expected, got %v", eval.WRONG_TYPE, t, datum)
+			}
+			v.SetUint(n.Uint64())
+			return v, nil
+		}, nil
+	case reflect.Float32, reflect.Float64:
+		return func(datum parser.Sexpr) (reflect.Value, error) {
+			n, ok := toNumber(datum)
+			if !ok || !n.IsReal() {
+				return reflect.Value{}, fmt.Errorf("%w: real number expected, got %v", eval.WRONG_TYPE, datum)
+			}
+			return reflect.ValueOf(n.Float()).Convert(t), nil
+		}, nil
+	case reflect.String:
+		return func(datum parser.Sexpr) (reflect.Value, error) {
+			a, ok := datum.(*parser.Atom)
+			if !ok || a.Type != parser.STRING {
+				return reflect.Value{}, fmt.Errorf("%w: string expected, got %v", eval.WRONG_TYPE, datum)
+			}
+			return reflect.ValueOf(a.Value).Convert(t), nil
+		}, nil
+	case reflect.Slice:
+		elem, err := decoderOf(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return func(datum parser.Sexpr) (reflect.Value, error) {
+			items, err := elements(datum)
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			v := reflect.MakeSlice(t, len(items), len(items))
+			for i, item := range items {
+				e, err := elem(item)
+				if err != nil {
+					return reflect.Value{}, err
+				}
+				v.Index(i).Set(e)
+			}
+			return v, nil
+		}, nil
+	case reflect.Map:
+		key, err := decoderOf(t.Key())
+		if err != nil {
+			return nil, err
+		}
+		elem, err := decoderOf(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return func(datum parser.Sexpr) (reflect.Value, error) {
+			entries, err := parser.ToSlice(datum)
+			if err != nil {
+				return reflect.Value{}, fmt.Errorf("%w: association list expected, got %v", eval.WRONG_TYPE, datum)
+			}
+			m := reflect.MakeMapWithSize(t, len(entries))
+			for _, entry := range entries {
+				pair, ok := entry.(*parser.Expr)
+				if !ok || pair.Car == nil {
+					return reflect.Value{}, fmt.Errorf("%w: pair expected, got %v", eval.WRONG_TYPE, entry)
+				}
+				k, err := key(pair.Car)
+				if err != nil {
+					return reflect.Value{}, err
+				}
+				v, err := elem(pair.Cdr)
+				if err != nil {
+					return reflect.Value{}, err
+				}
+				m.SetMapIndex(k, v)
+			}
+			return m, nil
+		}, nil
+	case reflect.Pointer, reflect.Struct, reflect.Interface:
+		return func(datum parser.Sexpr) (reflect.Value, error) {
+			v, ok := objectValue(datum, t)
+			if !ok {
+				return reflect.Value{}, fmt.Errorf("%w: %v expected, got %v", eval.WRONG_TYPE, t, datum)
+			}
+			return v, nil
+		}, nil
+	}
+
+	return nil, fmt.Errorf("%w: %v", UNSUPPORTED_TYPE, t)
+}
+
+func toNumber(datum parser.Sexpr) (*number.Number, bool) {
+	a, ok := datum.(*parser.Atom)
+	if !ok || a.Type != parser.NUMBER {
+		return nil, false
+	}
+
+	return (a.Value).(*number.Number), true
+}
+
+func exactInteger(datum parser.Sexpr) (*big.Int, error) {
+	n, ok := toNumber(datum)
+	if !ok || n.Integer() == nil {
+		return nil, fmt.Errorf("%w: exact integer expected, got %v", eval.WRONG_TYPE, datum)
+	}
+
+	return n.Integer(), nil
+}
+
+// elements returns elements of list or vector datum.
+func elements(datum parser.Sexpr) ([]parser.Sexpr, error) {
+	if v, ok := datum.(*parser.Vector); ok {
+		return v.Elements, nil
+	}
+
+	items, err := parser.ToSlice(datum)
+	if err != nil {
+		return nil, fmt.Errorf("%w: list expected, got %v", eval.WRONG_TYPE, datum)
+	}
+
+	return items, nil
+}
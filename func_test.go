@@ -0,0 +1,173 @@
+package scheme_test
+
+import (
+	"errors"
+	"github.com/vkhonin/scheme"
+	"github.com/vkhonin/scheme/eval"
+	"github.com/vkhonin/scheme/parser"
+	"github.com/vkhonin/scheme/printer"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var errNotFound = errors.New("not found")
+
+func newFuncInterp(t *testing.T, options ...scheme.Option) *scheme.Interp {
+	interp := scheme.New(options...)
+
+	funcs := map[string]any{
+		"go-add":    func(a, b int) int { return a + b },
+		"go-concat": func(parts ...string) string { return strings.Join(parts, "") },
+		"go-sum": func(scale float64, xs []int8) float64 {
+			s := 0.0
+			for _, x := range xs {
+				s += float64(x)
+			}
+			return s * scale
+		},
+		"go-lookup": func(key string) (string, error) {
+			if key == "a" {
+				return "found", nil
+			}
+			return "", errNotFound
+		},
+		"go-check": func(ok bool) error {
+			if !ok {
+				return errNotFound
+			}
+			return nil
+		},
+		"go-noop":  func() {},
+		"go-first": func(p *parser.Expr) parser.Sexpr { return p.Car },
+		"go-any":   func(v any) []any { return []any{v, v} },
+		"go-big":   func(n *big.Int, r *big.Rat) *big.Rat { return new(big.Rat).Add(new(big.Rat).SetInt(n), r) },
+		"go-bytes": func(b []byte) int { return len(b) },
+		"go-uint":  func(u uint8) uint8 { return u },
+	}
+
+	for name, fn := range funcs {
+		if err := interp.DefineFunc(name, fn); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return interp
+}
+
+func TestInterp_DefineFunc(t *testing.T) {
+	testCases := []struct {
+		Input  string
+		Output string
+	}{
+		{"(go-add 1 2)", "3"},
+		{"(map go-add '(1 2) '(10 20))", "(11 22)"},
+		{`(list (go-concat) (go-concat "a" "b" "c"))`, `("" "abc")`},
+		{"(go-sum 0.5 '(1 2 3))", "3.0"},
+		{"(go-sum 2 #(1 2))", "6.0"},
+		{`(go-lookup "a")`, `"found"`},
+		{`(guard (e ((error-object? e) (error-object-message e))) (go-lookup "b"))`, `"not found"`},
+		{"(call/cc (lambda (k) (with-exception-handler (lambda (e) (k (error-object-message e))) (lambda () (go-check #f)))))", `"not found"`},
+		{"(go-check #t)", ""},
+		{"(go-noop)", ""},
+		{"(go-first '(a b))", "a"},
+		{"(go-any 'x)", "(x x)"},
+		{"(go-big 1 1/2)", "3/2"},
+		{"(go-bytes #u8(1 2 3))", "3"},
+		{"(go-uint 255)", "255"},
+	}
+
+	for _, options := range [][]scheme.Option{nil, {scheme.WithVM()}} {
+		for _, c := range testCases {
+			result, err := newFuncInterp(t, options...).EvalString(c.Input)
+			if err != nil {
+				t.Errorf("unexpected error %v for %s", err, c.Input)
+				continue
+			}
+
+			if c.Output == "" {
+				if result != eval.Unspecified {
+					t.Errorf("expected unspecified value got %v for %s", printer.Write(result), c.Input)
+				}
+				continue
+			}
+
+			if printer.Write(result) != c.Output {
+				t.Errorf("expected %s got %s for %s", c.Output, printer.Write(result), c.Input)
+			}
+		}
+	}
+}
+
+func TestInterp_DefineFunc_Errors(t *testing.T) {
+	testCases := []struct {
+		Input string
+		Err   error
+	}{
+		{`(go-lookup "b")`, errNotFound},
+		{"(go-add 1)", eval.WRONG_ARITY},
+		{"(go-add 1 2 3)", eval.WRONG_ARITY},
+		{`(go-add 1 "2")`, eval.WRONG_TYPE},
+		{"(go-add 1 2.)", eval.WRONG_TYPE},
+		{"(go-add 1 100000000000000000000)", eval.WRONG_TYPE},
+		{"(go-uint 256)", eval.WRONG_TYPE},
+		{"(go-uint -1)", eval.WRONG_TYPE},
+		{"(go-sum 1 '(1 . 2))", eval.WRONG_TYPE},
+		{"(go-sum 1 '(1 1000))", eval.WRONG_TYPE},
+		{"(go-sum 1+2i '())", eval.WRONG_TYPE},
+		{"(go-check 1)", eval.WRONG_TYPE},
+		{"(go-first '())", nil},
+		{"(go-first 'a)", eval.WRONG_TYPE},
+		{"(go-big 1.5 1)", eval.WRONG_TYPE},
+		{"(go-big 1 0.5)", eval.WRONG_TYPE},
+		{`(go-bytes "abc")`, eval.WRONG_TYPE},
+		{`(go-concat "a" 'b)`, eval.WRONG_TYPE},
+	}
+
+	for _, options := range [][]scheme.Option{nil, {scheme.WithVM()}} {
+		for _, c := range testCases {
+			_, err := newFuncInterp(t, options...).EvalString(c.Input)
+			if c.Err == nil && err != nil {
+				t.Errorf("unexpected error %v for %s", err, c.Input)
+			}
+			if c.Err != nil && !errors.Is(err, c.Err) {
+				t.Errorf("expected error %v got %v for %s", c.Err, err, c.Input)
+			}
+		}
+	}
+}
+
+func TestInterp_DefineFunc_Unsupported(t *testing.T) {
+	testCases := []any{
+		nil,
+		42,
+		(func())(nil),
+		func(chan int) {},
+		func(map[string]chan int) {},
+		func() (int, int) { return 0, 0 },
+		func() (int, string, error) { return 0, "", nil },
+	}
+
+	for _, fn := range testCases {
+		if err := scheme.New().DefineFunc("f", fn); !errors.Is(err, scheme.UNSUPPORTED_TYPE) {
+			t.Errorf("expected error %v got %v for %T", scheme.UNSUPPORTED_TYPE, err, fn)
+		}
+	}
+}
+
+func TestDecode(t *testing.T) {
+	datum, err := parser.ParseString(`("a" "b")`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := scheme.Decode(datum[0], reflect.TypeFor[[]string]())
+	if err != nil || !reflect.DeepEqual(v.Interface(), []string{"a", "b"}) {
+		t.Errorf("expected [a b] got %v, %v", v, err)
+	}
+
+	if _, err := scheme.Decode(datum[0], reflect.TypeFor[[]int]()); !errors.Is(err, eval.WRONG_TYPE) {
+		t.Errorf("expected error %v got %v", eval.WRONG_TYPE, err)
+	}
+}
@@ -1,3 +1,3 @@
 module github.com/vkhonin/scheme
 
-go 1.23.3
+go 1.24
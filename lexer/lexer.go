@@ -2,53 +2,358 @@ package lexer
 
 import (
 	"errors"
+	"fmt"
 	"github.com/vkhonin/scheme/parser/number"
+	"io"
+	"iter"
+	"strconv"
 	"strings"
 	"text/scanner"
+	"unicode"
+	"unicode/utf8"
+	"unsafe"
 )
 
 // Type of token as in <token> (7.1.1. Lexical structure).
 const (
-	LPAREN TokenType = iota // Literal: (
-	RPAREN                  // Literal: )
-	HPAREN                  // Literal: #(
-	SQUOTE                  // Literal: '
-	BQUOTE                  // Literal: `
-	COMMA                   // Literal: ,
-	COMMAT                  // Literal: ,@
-	DOT                     // Literal: .
-	BOOL                    // Literal example: #t
-	CHAR                    // Literal example: #\t
-	IDENT                   // Literal example: t
-	STRING                  // Literal example: "t"
-	NUMBER                  // Literal example: 1
+	LPAREN     TokenType = iota // Literal: (
+	RPAREN                      // Literal: )
+	HPAREN                      // Literal: #(
+	SQUOTE                      // Literal: '
+	BQUOTE                      // Literal: `
+	COMMA                       // Literal: ,
+	COMMAT                      // Literal: ,@
+	DOT                         // Literal: .
+	BOOL                        // Literal example: #t
+	CHAR                        // Literal example: #\t
+	IDENT                       // Literal example: t
+	STRING                      // Literal example: "t"
+	NUMBER                      // Literal example: 1
+	DCOMMENT                    // Literal: #;
+	LABEL                       // Literal example: #0=
+	LABELREF                    // Literal example: #0#
+	U8PAREN                     // Literal: #u8(
+	EXTENSION                   // Literal example: #hash, see RegisterPrefix
+	WHITESPACE                  // Literal example: " \n", see KeepTrivia
+	LCOMMENT                    // Literal example: ; text, see KeepTrivia
+	BCOMMENT                    // Literal example: #| text |#, see KeepTrivia
+	DIRECTIVE                   // Literal example: #!fold-case, see KeepTrivia
+)
+
+// Zero width non-joiner and joiner, which may occur in identifiers.
+const (
+	zwnj = '\u200c'
+	zwj  = '\u200d'
+)
+
+var (
+	// identifierInitialRanges are Unicode categories of non-ASCII characters
+	// allowed in identifiers.
+	identifierInitialRanges = []*unicode.RangeTable{
+		unicode.L, unicode.Mn, unicode.Nl, unicode.No, unicode.Pd, unicode.Pc,
+		unicode.Po, unicode.Sc, unicode.Sm, unicode.Sk, unicode.So, unicode.Co,
+	}
+
+	// identifierSubsequentRanges are Unicode categories of non-ASCII characters
+	// allowed in identifiers after first character only.
+	identifierSubsequentRanges = []*unicode.RangeTable{unicode.Nd, unicode.Mc, unicode.Me}
+
+	// charNames are names of characters as in <character name>.
+	charNames = map[string]rune{
+		"alarm":     '\a',
+		"backspace": '\b',
+		"delete":    0x7f,
+		"escape":    0x1b,
+		"newline":   '\n',
+		"nul":       0,
+		"null":      0,
+		"return":    '\r',
+		"space":     ' ',
+		"tab":       '\t',
+	}
+
+	// charLiteralNames are names CharLiteral writes characters with.
+	charLiteralNames = map[rune]string{
+		'\a': "alarm",
+		'\b': "backspace",
+		0x7f: "delete",
+		0x1b: "escape",
+		'\n': "newline",
+		0:    "null",
+		'\r': "return",
+		' ':  "space",
+		'\t': "tab",
+	}
+
+	// stringEscapes are escape sequences QuoteString writes characters with.
+	stringEscapes = map[rune]string{
+		'\a': `\a`,
+		'\b': `\b`,
+		'\t': `\t`,
+		'\n': `\n`,
+		'\r': `\r`,
+		'"':  `\"`,
+		'\\': `\\`,
+	}
 )
 
 var (
 	EOF            = errors.New("EOF")
 	INVALID_DOT    = errors.New("invalid dot token")
+	INVALID_ESCAPE = errors.New("invalid escape sequence")
 	INVALID_HASH   = errors.New("invalid hash prefixed token")
 	INVALID_IDENT  = errors.New("invalid identifier")
 	INVALID_NUMBER = errors.New("invalid number")
+	INVALID_UNREAD = errors.New("invalid use of UnreadToken")
 	UNEXPECTED_EOF = errors.New("unexpected EOF")
 	UNKNOWN_NCHAR  = errors.New("unknown character name")
 )
 
+// Lexer reads tokens either from Scanner, which must be initialized by
+// caller, or from in-memory source given to NewFromString or NewFromBytes.
 type Lexer struct {
 	Scanner scanner.Scanner
+
+	// FoldCase makes lexer fold case of identifiers and character names, as
+	// after #!fold-case directive. Directives in source change it.
+	FoldCase bool
+
+	// KeepTrivia makes lexer return whitespace, comments and directives as
+	// WHITESPACE, LCOMMENT, BCOMMENT and DIRECTIVE tokens, literals of which
+	// are their source text, rather than skip them. Directives take effect
+	// anyway. Script line, e.g. #!/usr/bin/env scheme, which is skipped at
+	// start of source, is returned as LCOMMENT.
+	KeepTrivia bool
+
+	// prefixes are registered by RegisterPrefix.
+	prefixes map[string]bool
+
+	// Source of lexer created by NewFromString or NewFromBytes and current
+	// position in it.
+	src                  string
+	inMemory             bool
+	offset, line, column int
+
+	// start is position of current token; buf holds runes of current token
+	// read from Scanner.
+	start Pos
+	buf   []byte
+
+	// last is token most recently returned by NextToken together with its
+	// error. It is returned again by NextToken if unread is set.
+	last    Token
+	lastErr error
+	hasLast bool
+	unread  bool
+}
+
+// Pos is position of token in source.
+type Pos struct {
+	Line   int // Line number, starting at 1
+	Column int // Column number in characters, starting at 1
+	Offset int // Byte offset, starting at 0
 }
 
 type Token struct {
 	Type    TokenType
 	Literal string
+	Pos     Pos
+	End     Pos // Position right after token
 }
 
 type TokenType uint8
 
+// New returns lexer reading source from r.
+func New(r io.Reader) *Lexer {
+	l := &Lexer{}
+	l.Scanner.Init(r)
+
+	return l
+}
+
+// NewFromString returns lexer reading source from s. Literals of tokens are
+// substrings of s, so lexing does not copy source.
+func NewFromString(s string) *Lexer {
+	return &Lexer{src: s, inMemory: true, line: 1, column: 1}
+}
+
+// NewFromBytes returns lexer reading source from b without copying it.
+// Literals of tokens share memory with b, so b must not be modified while
+// lexer or any of its tokens are in use.
+func NewFromBytes(b []byte) *Lexer {
+	return NewFromString(unsafe.String(unsafe.SliceData(b), len(b)))
+}
+
+// Reset makes lexer read source from r as if it was returned by New(r),
+// dropping unread token and FoldCase setting but keeping KeepTrivia setting
+// and registered prefixes.
+// Memory allocated for previous source is reused, so one lexer may read many
+// small sources.
+func (l *Lexer) Reset(r io.Reader) {
+	*l = Lexer{Scanner: l.Scanner, buf: l.buf[:0], KeepTrivia: l.KeepTrivia, prefixes: l.prefixes}
+	l.Scanner.Init(r)
+}
+
+// RegisterPrefix makes lexer read # followed by prefix and delimiter, e.g.
+// #hash( or #rx", as EXTENSION token, which parser reads with reader
+// registered by Parser.RegisterReader. Prefix must not start with character
+// of standard hash prefixed tokens, i.e. digit or any of t, f, \, i, e, b, o,
+// d, x and u, in either case.
+func (l *Lexer) RegisterPrefix(prefix string) {
+	if l.prefixes == nil {
+		l.prefixes = make(map[string]bool)
+	}
+
+	l.prefixes[prefix] = true
+}
+
+// Tokens returns iterator over remaining tokens, which are read lazily.
+// Iteration ends at EOF, which is not yielded, or after first error.
+func (l *Lexer) Tokens() iter.Seq2[Token, error] {
+	return func(yield func(Token, error) bool) {
+		for {
+			token, err := l.NextToken()
+			if errors.Is(err, EOF) || !yield(token, err) || err != nil {
+				return
+			}
+		}
+	}
+}
+
+// NextToken returns next token, or EOF error at end of source.
 func (l *Lexer) NextToken() (Token, error) {
-	l.skipAtmosphere()
+	if l.unread {
+		l.unread = false
+		return l.last, l.lastErr
+	}
+
+	l.last, l.lastErr = l.scanNextToken()
+	l.hasLast = true
+
+	return l.last, l.lastErr
+}
+
+// PeekToken returns next token, or EOF error, without consuming it.
+func (l *Lexer) PeekToken() (Token, error) {
+	token, err := l.NextToken()
+	l.unread = true
+
+	return token, err
+}
+
+// UnreadToken makes NextToken return token it has returned last again. Only
+// one token may be unread, so it reports INVALID_UNREAD if there is no token
+// to unread, or if it is already unread or peeked.
+func (l *Lexer) UnreadToken() error {
+	if !l.hasLast || l.unread {
+		return INVALID_UNREAD
+	}
+
+	l.unread = true
+
+	return nil
+}
+
+func (l *Lexer) scanNextToken() (Token, error) {
+	r, trivia, err := l.skipAtmosphere()
+
+	var token Token
+	if trivia != nil {
+		token = *trivia
+	} else if err == nil {
+		token, err = l.scanToken(r)
+	}
+
+	if err != nil && !errors.Is(err, EOF) {
+		return Token{}, fmt.Errorf("%w at %s", err, l.start)
+	}
+
+	token.Pos, token.End = l.start, l.pos()
+
+	return token, err
+}
 
-	switch r := l.Scanner.Next(); r {
+func (p Pos) String() string {
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
+}
+
+// begin marks current position as start of token.
+func (l *Lexer) begin() {
+	l.start = l.pos()
+	l.buf = l.buf[:0]
+}
+
+// text returns source text of current token read so far.
+func (l *Lexer) text() string {
+	if l.inMemory {
+		return l.src[l.start.Offset:l.offset]
+	}
+
+	return string(l.buf)
+}
+
+func (l *Lexer) pos() Pos {
+	if l.inMemory {
+		return Pos{Line: l.line, Column: l.column, Offset: l.offset}
+	}
+
+	p := l.Scanner.Pos()
+
+	return Pos{Line: p.Line, Column: p.Column, Offset: p.Offset}
+}
+
+// peek returns next rune of source without consuming it, or scanner.EOF.
+func (l *Lexer) peek() rune {
+	if !l.inMemory {
+		return l.Scanner.Peek()
+	}
+
+	r, _ := l.decode()
+
+	return r
+}
+
+// next consumes and returns next rune of source, or scanner.EOF.
+func (l *Lexer) next() rune {
+	if !l.inMemory {
+		r := l.Scanner.Next()
+		if r != scanner.EOF {
+			l.buf = utf8.AppendRune(l.buf, r)
+		}
+		return r
+	}
+
+	r, size := l.decode()
+	if r == scanner.EOF {
+		return r
+	}
+
+	l.offset += size
+	if r == '\n' {
+		l.line, l.column = l.line+1, 1
+	} else {
+		l.column++
+	}
+
+	return r
+}
+
+// decode returns rune at current offset of in-memory source and its size.
+func (l *Lexer) decode() (rune, int) {
+	if l.offset >= len(l.src) {
+		return scanner.EOF, 0
+	}
+
+	if c := l.src[l.offset]; c < utf8.RuneSelf {
+		return rune(c), 1
+	}
+
+	return utf8.DecodeRuneInString(l.src[l.offset:])
+}
+
+// scanToken scans token starting with r, which is already read.
+func (l *Lexer) scanToken(r rune) (Token, error) {
+	switch r {
 	case scanner.EOF:
 		return Token{}, EOF
 	case '(':
@@ -60,127 +365,292 @@ func (l *Lexer) NextToken() (Token, error) {
 	case '`':
 		return Token{Type: BQUOTE, Literal: "`"}, nil
 	case ',':
-		if l.Scanner.Peek() == '@' {
-			l.Scanner.Next()
+		if l.peek() == '@' {
+			l.next()
 			return Token{Type: COMMAT, Literal: ",@"}, nil
 		}
 		return Token{Type: COMMA, Literal: ","}, nil
 	case '.':
-		if l.isDelimiter(l.Scanner.Peek()) {
+		if l.isDelimiter(l.peek()) {
 			return Token{Type: DOT, Literal: "."}, nil
-		} else if '0' <= l.Scanner.Peek() && l.Scanner.Peek() <= '9' {
-			return l.scanNumber(r)
-		} else if l.Scanner.Next() == '.' && l.Scanner.Next() == '.' {
+		} else if '0' <= l.peek() && l.peek() <= '9' {
+			return l.scanNumber()
+		} else if l.next() == '.' && l.next() == '.' {
 			return Token{Type: IDENT, Literal: "..."}, nil
 		}
 		return Token{}, INVALID_DOT
 	case '"':
-		return l.scanString()
+		return l.scanQuoted('"', STRING)
 	case '#':
-		switch l.Scanner.Peek() {
+		switch l.peek() {
 		case '(':
-			return Token{Type: HPAREN, Literal: "#" + string(l.Scanner.Next())}, nil
+			l.next()
+			return Token{Type: HPAREN, Literal: "#("}, nil
+		case ';':
+			l.next()
+			return Token{Type: DCOMMENT, Literal: "#;"}, nil
 		case 't', 'f':
-			return Token{Type: BOOL, Literal: "#" + string(l.Scanner.Next())}, nil
+			l.next()
+			return Token{Type: BOOL, Literal: l.text()}, nil
 		case '\\':
-			l.Scanner.Next()
-			char := l.Scanner.Next()
-			if l.isDelimiter(l.Scanner.Peek()) {
-				return Token{Type: CHAR, Literal: "#\\" + string(char)}, nil
-			}
-			return l.scanNchar(char)
-		case 'i', 'e', 'b', 'o', 'd', 'x':
-			return l.scanNumber(r)
-		default:
+			l.next()
+			if l.next() == scanner.EOF {
+				return Token{}, UNEXPECTED_EOF
+			}
+			if l.isDelimiter(l.peek()) {
+				return Token{Type: CHAR, Literal: l.text()}, nil
+			}
+			return l.scanNchar()
+		case 'i', 'e', 'b', 'o', 'd', 'x', 'I', 'E', 'B', 'O', 'D', 'X':
+			return l.scanNumber()
+		case '0', '1', '2', '3', '4', '5', '6', '7', '8', '9':
+			return l.scanLabel()
+		case 'u', 'U':
+			l.next()
+			if l.next() == '8' && l.next() == '(' {
+				return Token{Type: U8PAREN, Literal: "#u8("}, nil
+			}
 			return Token{}, INVALID_HASH
+		default:
+			return l.scanExtension()
 		}
 	case '+', '-':
-		if l.isDelimiter(l.Scanner.Peek()) {
-			return Token{Type: IDENT, Literal: string(r)}, nil
+		if l.isDelimiter(l.peek()) {
+			return Token{Type: IDENT, Literal: l.text()}, nil
 		}
-		return l.scanNumber(r)
+		return l.scanNumber()
 	case '0', '1', '2', '3', '4', '5', '6', '7', '8', '9':
-		return l.scanNumber(r)
+		return l.scanNumber()
+	case '|':
+		return l.scanQuoted('|', IDENT)
 	default:
 		return l.scanIdentifier(r)
 	}
 }
 
-func (l *Lexer) skipAtmosphere() {
-	for l.isAtmosphere(l.Scanner.Peek()) {
-		if l.isComment(l.Scanner.Peek()) {
-			for !l.isNewline(l.Scanner.Peek()) {
-				l.Scanner.Next()
+// skipAtmosphere skips whitespace, comments and directives, marks start of
+// following token and returns its first rune, which is read. Distinguishing
+// block comment or directive from other hash prefixed tokens takes two runes,
+// so that rune is read here rather than by scanToken. If KeepTrivia is set,
+// it returns first whitespace, comment or directive as token instead.
+func (l *Lexer) skipAtmosphere() (rune, *Token, error) {
+	for {
+		l.begin()
+
+		switch r := l.peek(); {
+		case l.isWhitespace(r):
+			for l.isWhitespace(l.peek()) {
+				l.next()
+			}
+			if l.KeepTrivia {
+				return 0, &Token{Type: WHITESPACE, Literal: l.text()}, nil
+			}
+			continue
+		case l.isComment(r):
+			l.skipLine()
+			if l.KeepTrivia {
+				return 0, &Token{Type: LCOMMENT, Literal: l.text()}, nil
+			}
+			continue
+		}
+
+		r := l.next()
+		if r != '#' {
+			return r, nil, nil
+		}
+
+		var (
+			err     error
+			trivium TokenType
+		)
+
+		switch l.peek() {
+		case '|':
+			l.next()
+			err, trivium = l.skipBlockComment(), BCOMMENT
+		case '!':
+			l.next()
+			if l.isScriptLine() {
+				l.skipLine()
+				trivium = LCOMMENT
+				break
+			}
+			err, trivium = l.scanDirective(), DIRECTIVE
+		default:
+			return r, nil, nil
+		}
+
+		if err != nil {
+			return r, nil, err
+		}
+		if l.KeepTrivia {
+			return 0, &Token{Type: trivium, Literal: l.text()}, nil
+		}
+	}
+}
+
+// scanDirective scans rest of directive after its #!, which is either
+// #!fold-case or #!no-fold-case. Script line not at start of source is
+// reported apart from unknown directives.
+func (l *Lexer) scanDirective() error {
+	l.skipToDelimiter()
+
+	switch directive := l.text(); {
+	case directive == "#!fold-case":
+		l.FoldCase = true
+	case directive == "#!no-fold-case":
+		l.FoldCase = false
+	case directive == "#!" || strings.HasPrefix(directive, "#!/"):
+		return fmt.Errorf("%w: script line %s is allowed only at start of source", INVALID_HASH, directive)
+	default:
+		return fmt.Errorf("%w: unknown directive %s", INVALID_HASH, directive)
+	}
+
+	return nil
+}
+
+// isScriptLine reports whether #! just read starts script line, e.g.
+// #!/usr/bin/env scheme, which is first line of source followed by / or
+// space, unlike directives.
+func (l *Lexer) isScriptLine() bool {
+	r := l.peek()
+	return l.start.Offset == 0 && (r == '/' || l.isIntralineWhitespace(r))
+}
+
+// skipLine skips rest of line, not including its line ending.
+func (l *Lexer) skipLine() {
+	for r := l.peek(); !l.isNewline(r) && r != scanner.EOF; r = l.peek() {
+		l.next()
+	}
+}
+
+// skipBlockComment skips rest of block comment after its opening #|. Block
+// comments may be nested.
+func (l *Lexer) skipBlockComment() error {
+	for depth := 1; depth > 0; {
+		switch l.next() {
+		case scanner.EOF:
+			return UNEXPECTED_EOF
+		case '|':
+			if l.peek() == '#' {
+				l.next()
+				depth--
+			}
+		case '#':
+			if l.peek() == '|' {
+				l.next()
+				depth++
 			}
 		}
-		l.Scanner.Next()
 	}
+
+	return nil
 }
 
 func (l *Lexer) isAtmosphere(r rune) bool {
 	return l.isWhitespace(r) || l.isComment(r)
 }
 
+// isWhitespace reports whether r is whitespace, including any Unicode
+// whitespace, e.g. no-break space.
 func (l *Lexer) isWhitespace(r rune) bool {
-	return r == ' ' || l.isNewline(r)
+	return l.isIntralineWhitespace(r) || l.isNewline(r) || unicode.IsSpace(r)
 }
 
+// isNewline reports whether r starts line ending, which is \n, \r\n or \r.
 func (l *Lexer) isNewline(r rune) bool {
-	return r == '\n'
+	return r == '\n' || r == '\r'
 }
 
 func (l *Lexer) isComment(r rune) bool {
 	return r == ';'
 }
 
+// isDelimiter reports whether r ends token. End of source ends token too.
 func (l *Lexer) isDelimiter(r rune) bool {
-	return l.isWhitespace(r) || strings.ContainsRune("();\"", r)
+	return r == scanner.EOF || l.isWhitespace(r) || strings.ContainsRune("|();\"", r)
 }
 
-func (l *Lexer) scanNchar(prefix rune) (Token, error) {
-	var sb strings.Builder
+// scanNchar scans name of character, first rune of which is already read.
+func (l *Lexer) scanNchar() (Token, error) {
+	l.skipToDelimiter()
 
-	sb.WriteRune(prefix)
-
-	for r := l.Scanner.Peek(); !l.isDelimiter(r) && r != scanner.EOF; r = l.Scanner.Peek() {
-		sb.WriteRune(l.Scanner.Next())
+	literal := l.text()
+	if l.FoldCase {
+		literal = literal[:2] + strings.ToLower(literal[2:])
 	}
 
-	if sb.String() != "space" && sb.String() != "newline" {
+	if _, ok := CharValue(literal[2:]); !ok {
 		return Token{}, UNKNOWN_NCHAR
 	}
 
-	return Token{Type: CHAR, Literal: "#\\" + sb.String()}, nil
+	return Token{Type: CHAR, Literal: literal}, nil
 }
 
-func (l *Lexer) scanNumber(prefix rune) (Token, error) {
-	var sb strings.Builder
+// CharValue returns character denoted by character literal without its #\
+// prefix, e.g. a, space or x3bb, and reports whether literal is valid.
+func CharValue(name string) (rune, bool) {
+	if name == "" {
+		return 0, false
+	}
 
-	sb.WriteRune(prefix)
+	if r, size := utf8.DecodeRuneInString(name); size == len(name) && r != utf8.RuneError {
+		return r, true
+	}
 
-	for r := l.Scanner.Peek(); !l.isDelimiter(r) && r != scanner.EOF; r = l.Scanner.Peek() {
-		sb.WriteRune(l.Scanner.Next())
+	if r, ok := charNames[name]; ok {
+		return r, true
 	}
 
-	if !number.NewFromLiteral(sb.String()).IsNumber() {
-		return Token{}, INVALID_NUMBER
+	if name[0] != 'x' {
+		return 0, false
+	}
+
+	value, err := strconv.ParseUint(name[1:], 16, 32)
+	if err != nil || !utf8.ValidRune(rune(value)) || strings.ContainsAny(name[1:], "+-_") {
+		return 0, false
 	}
 
-	return Token{Type: NUMBER, Literal: sb.String()}, nil
+	return rune(value), true
 }
 
-func (l *Lexer) scanString() (Token, error) {
-	var sb strings.Builder
+// scanLabel scans datum label #N= or reference to it #N# after its #.
+func (l *Lexer) scanLabel() (Token, error) {
+	for '0' <= l.peek() && l.peek() <= '9' {
+		l.next()
+	}
 
-	for p, c := '"', l.Scanner.Next(); !(p != '\\' && c == '"'); p, c = c, l.Scanner.Next() {
-		if c == scanner.EOF {
-			return Token{}, UNEXPECTED_EOF
-		}
+	switch l.next() {
+	case '=':
+		return Token{Type: LABEL, Literal: l.text()}, nil
+	case '#':
+		return Token{Type: LABELREF, Literal: l.text()}, nil
+	default:
+		return Token{}, INVALID_HASH
+	}
+}
+
+// scanExtension scans # followed by registered prefix after its #.
+func (l *Lexer) scanExtension() (Token, error) {
+	l.skipToDelimiter()
+
+	literal := l.text()
+	if !l.prefixes[literal[1:]] {
+		return Token{}, INVALID_HASH
+	}
+
+	return Token{Type: EXTENSION, Literal: literal}, nil
+}
 
-		sb.WriteRune(c)
+func (l *Lexer) scanNumber() (Token, error) {
+	l.skipToDelimiter()
+
+	literal := l.text()
+	if !number.NewFromLiteral(literal).IsNumber() {
+		return Token{}, INVALID_NUMBER
 	}
 
-	return Token{Type: STRING, Literal: sb.String()}, nil
+	return Token{Type: NUMBER, Literal: literal}, nil
 }
 
 func (l *Lexer) scanIdentifier(initial rune) (Token, error) {
@@ -188,29 +658,230 @@ func (l *Lexer) scanIdentifier(initial rune) (Token, error) {
 		return Token{}, INVALID_IDENT
 	}
 
+	for r := l.peek(); !l.isDelimiter(r) && r != scanner.EOF; r = l.peek() {
+		if !l.isIdentifierSubsequent(r) {
+			return Token{}, INVALID_IDENT
+		}
+
+		l.next()
+	}
+
+	if l.FoldCase {
+		return Token{Type: IDENT, Literal: strings.ToLower(l.text())}, nil
+	}
+
+	return Token{Type: IDENT, Literal: l.text()}, nil
+}
+
+// scanQuoted scans string or identifier enclosed in vertical lines, e.g.
+// |a b|, after opening quote. Literal is content between quotes with escapes
+// decoded, so it is a substring of source unless there are escapes.
+func (l *Lexer) scanQuoted(quote rune, tokenType TokenType) (Token, error) {
+	var (
+		sb      strings.Builder
+		escaped bool
+	)
+
+	for {
+		switch r := l.next(); r {
+		case scanner.EOF:
+			return Token{}, UNEXPECTED_EOF
+		case quote:
+			if !escaped {
+				literal := l.text()
+				return Token{Type: tokenType, Literal: literal[1 : len(literal)-1]}, nil
+			}
+			return Token{Type: tokenType, Literal: sb.String()}, nil
+		case '\\':
+			if !escaped {
+				literal := l.text()
+				sb.WriteString(literal[1 : len(literal)-1])
+				escaped = true
+			}
+			if r := l.peek(); quote == '"' && (l.isIntralineWhitespace(r) || l.isNewline(r)) {
+				if !l.skipLineContinuation() {
+					return Token{}, fmt.Errorf("%w: newline expected in line continuation", INVALID_ESCAPE)
+				}
+				continue
+			}
+			decoded, err := l.scanEscape()
+			if err != nil {
+				return Token{}, err
+			}
+			sb.WriteRune(decoded)
+		default:
+			if escaped {
+				sb.WriteRune(r)
+			}
+		}
+	}
+}
+
+// skipLineContinuation skips line continuation after backslash, which is
+// intraline whitespace, newline and intraline whitespace again. It reports
+// false if there is no newline.
+func (l *Lexer) skipLineContinuation() bool {
+	for l.isIntralineWhitespace(l.peek()) {
+		l.next()
+	}
+
+	if !l.isNewline(l.peek()) {
+		return false
+	}
+
+	if l.next() == '\r' && l.peek() == '\n' {
+		l.next()
+	}
+
+	for l.isIntralineWhitespace(l.peek()) {
+		l.next()
+	}
+
+	return true
+}
+
+func (l *Lexer) isIntralineWhitespace(r rune) bool {
+	return r == ' ' || r == '\t' || unicode.Is(unicode.Zs, r)
+}
+
+// scanEscape scans escape sequence after backslash and returns rune it
+// denotes. Escapes are \a, \b, \t, \n, \r, \", \\, \| and hex scalar value
+// \xHH; of any length.
+func (l *Lexer) scanEscape() (rune, error) {
+	switch r := l.next(); r {
+	case 'a':
+		return '\a', nil
+	case 'b':
+		return '\b', nil
+	case 't':
+		return '\t', nil
+	case 'n':
+		return '\n', nil
+	case 'r':
+		return '\r', nil
+	case '"', '\\', '|':
+		return r, nil
+	case 'x', 'X':
+		var value rune
+		for digits := 0; ; digits++ {
+			d := l.next()
+			switch {
+			case d == ';' && digits > 0 && utf8.ValidRune(value):
+				return value, nil
+			case '0' <= d && d <= '9':
+				value = value<<4 | (d - '0')
+			case 'a' <= d && d <= 'f', 'A' <= d && d <= 'F':
+				value = value<<4 | (unicode.ToLower(d) - 'a' + 10)
+			default:
+				return 0, fmt.Errorf("%w \\x", INVALID_ESCAPE)
+			}
+			if value > unicode.MaxRune {
+				return 0, fmt.Errorf("%w \\x", INVALID_ESCAPE)
+			}
+		}
+	case scanner.EOF:
+		return 0, UNEXPECTED_EOF
+	default:
+		return 0, fmt.Errorf("%w \\%c", INVALID_ESCAPE, r)
+	}
+}
+
+// QuoteIdentifier returns name written as identifier which reads back as
+// name. Name which is not valid ordinary identifier is enclosed in vertical
+// lines, with vertical lines, backslashes and control characters escaped.
+func QuoteIdentifier(name string) string {
+	var l Lexer
+
+	if name == "+" || name == "-" || name == "..." {
+		return name
+	}
+
+	plain := name != ""
+	for i, r := range name {
+		if (i == 0 && !l.isIdentifierInitial(r)) || !l.isIdentifierSubsequent(r) {
+			plain = false
+			break
+		}
+	}
+
+	if plain {
+		return name
+	}
+
 	var sb strings.Builder
 
-	sb.WriteRune(initial)
+	sb.WriteByte('|')
 
-	for r := l.Scanner.Peek(); !l.isDelimiter(r) && r != scanner.EOF; r = l.Scanner.Peek() {
-		if !l.isIdentifierSubsequent(r) {
-			return Token{}, INVALID_IDENT
+	for _, r := range name {
+		switch {
+		case r == '|' || r == '\\':
+			sb.WriteByte('\\')
+			sb.WriteRune(r)
+		case unicode.IsControl(r):
+			fmt.Fprintf(&sb, "\\x%x;", r)
+		default:
+			sb.WriteRune(r)
+		}
+	}
+
+	sb.WriteByte('|')
+
+	return sb.String()
+}
+
+// QuoteString returns s written as string literal which reads back as s.
+func QuoteString(s string) string {
+	var sb strings.Builder
+
+	sb.WriteByte('"')
+
+	for _, r := range s {
+		if escape, ok := stringEscapes[r]; ok {
+			sb.WriteString(escape)
+		} else if unicode.IsControl(r) {
+			fmt.Fprintf(&sb, "\\x%x;", r)
+		} else {
+			sb.WriteRune(r)
 		}
+	}
+
+	sb.WriteByte('"')
 
-		sb.WriteRune(l.Scanner.Next())
+	return sb.String()
+}
+
+// CharLiteral returns character literal which reads back as r, e.g. #\a,
+// #\space or #\x3000. Characters which are neither graphic nor named are
+// written in hex.
+func CharLiteral(r rune) string {
+	if name, ok := charLiteralNames[r]; ok {
+		return `#\` + name
+	}
+
+	if unicode.IsGraphic(r) && !unicode.IsSpace(r) {
+		return `#\` + string(r)
 	}
 
-	return Token{Type: IDENT, Literal: sb.String()}, nil
+	return fmt.Sprintf(`#\x%x`, r)
+}
+
+// skipToDelimiter consumes runes up to delimiter or end of source.
+func (l *Lexer) skipToDelimiter() {
+	for r := l.peek(); !l.isDelimiter(r) && r != scanner.EOF; r = l.peek() {
+		l.next()
+	}
 }
 
 func (l *Lexer) isIdentifierInitial(r rune) bool {
 	return ('a' <= r && r <= 'z') ||
 		('A' <= r && r <= 'Z') ||
-		strings.ContainsRune("!$%&*/:<=>?^_~", r)
+		strings.ContainsRune("!$%&*/:<=>?^_~", r) ||
+		(r >= utf8.RuneSelf && unicode.In(r, identifierInitialRanges...))
 }
 
 func (l *Lexer) isIdentifierSubsequent(r rune) bool {
 	return l.isIdentifierInitial(r) ||
 		('0' <= r && r <= '9') ||
-		strings.ContainsRune("+-.@", r)
+		strings.ContainsRune("+-.@", r) ||
+		(r >= utf8.RuneSelf && (unicode.In(r, identifierSubsequentRanges...) || r == zwnj || r == zwj))
 }
@@ -14,9 +14,16 @@ type testCase struct {
 	Output      []lexer.Token
 }
 
-func TestLexer_NextToken(t *testing.T) {
-	l := lexer.Lexer{}
+// newLexers returns lexers of every kind reading input.
+func newLexers(input string) map[string]*lexer.Lexer {
+	return map[string]*lexer.Lexer{
+		"reader": lexer.New(strings.NewReader(input)),
+		"string": lexer.NewFromString(input),
+		"bytes":  lexer.NewFromBytes([]byte(input)),
+	}
+}
 
+func TestLexer_NextToken(t *testing.T) {
 	testCases := []testCase{
 		{
 			Description: "Identifiers",
@@ -28,6 +35,19 @@ func TestLexer_NextToken(t *testing.T) {
 				{Type: lexer.IDENT, Literal: "!$%&*/:<=>?^_~1qQ+-.@"},
 			},
 		},
+		{
+			Description: "Unicode identifiers and whitespace",
+			Input:       "λ café\tx₁\r\nа٣\u00a0∀x\u2003e\u0301\u200d\v→",
+			Output: []lexer.Token{
+				{Type: lexer.IDENT, Literal: "λ"},
+				{Type: lexer.IDENT, Literal: "café"},
+				{Type: lexer.IDENT, Literal: "x₁"},
+				{Type: lexer.IDENT, Literal: "а٣"},
+				{Type: lexer.IDENT, Literal: "∀x"},
+				{Type: lexer.IDENT, Literal: "e\u0301\u200d"},
+				{Type: lexer.IDENT, Literal: "→"},
+			},
+		},
 		{
 			Description: "Booleans",
 			Input:       "#t#f",
@@ -52,13 +72,49 @@ func TestLexer_NextToken(t *testing.T) {
 				{Type: lexer.NUMBER, Literal: "55#.l-5"},
 			},
 		},
+		{
+			Description: "Numbers with uppercase letters",
+			Input:       "#X1A #B101 1E5 #xAF #E#O17 #I#D1L2 1+2I",
+			Output: []lexer.Token{
+				{Type: lexer.NUMBER, Literal: "#X1A"},
+				{Type: lexer.NUMBER, Literal: "#B101"},
+				{Type: lexer.NUMBER, Literal: "1E5"},
+				{Type: lexer.NUMBER, Literal: "#xAF"},
+				{Type: lexer.NUMBER, Literal: "#E#O17"},
+				{Type: lexer.NUMBER, Literal: "#I#D1L2"},
+				{Type: lexer.NUMBER, Literal: "1+2I"},
+			},
+		},
+		{
+			Description: "Infinities and NaN",
+			Input:       "+inf.0 -inf.0 +nan.0 1+inf.0i",
+			Output: []lexer.Token{
+				{Type: lexer.NUMBER, Literal: "+inf.0"},
+				{Type: lexer.NUMBER, Literal: "-inf.0"},
+				{Type: lexer.NUMBER, Literal: "+nan.0"},
+				{Type: lexer.NUMBER, Literal: "1+inf.0i"},
+			},
+		},
 		{
 			Description: "Characters",
-			Input:       "#\\a #\\space #\\newline",
+			Input:       "#\\a #\\space #\\newline #\\tab #\\nul #\\null #\\delete #\\alarm #\\backspace #\\return #\\escape #\\x #\\x41 #\\x3BB #\\λ #\\(",
 			Output: []lexer.Token{
 				{Type: lexer.CHAR, Literal: "#\\a"},
 				{Type: lexer.CHAR, Literal: "#\\space"},
 				{Type: lexer.CHAR, Literal: "#\\newline"},
+				{Type: lexer.CHAR, Literal: "#\\tab"},
+				{Type: lexer.CHAR, Literal: "#\\nul"},
+				{Type: lexer.CHAR, Literal: "#\\null"},
+				{Type: lexer.CHAR, Literal: "#\\delete"},
+				{Type: lexer.CHAR, Literal: "#\\alarm"},
+				{Type: lexer.CHAR, Literal: "#\\backspace"},
+				{Type: lexer.CHAR, Literal: "#\\return"},
+				{Type: lexer.CHAR, Literal: "#\\escape"},
+				{Type: lexer.CHAR, Literal: "#\\x"},
+				{Type: lexer.CHAR, Literal: "#\\x41"},
+				{Type: lexer.CHAR, Literal: "#\\x3BB"},
+				{Type: lexer.CHAR, Literal: "#\\λ"},
+				{Type: lexer.CHAR, Literal: "#\\("},
 			},
 		},
 		{
@@ -70,6 +126,108 @@ func TestLexer_NextToken(t *testing.T) {
 				{Type: lexer.STRING, Literal: "\n"},
 			},
 		},
+		{
+			Description: "Block comments",
+			Input:       "#| comment |#a #|#| nested |# (still comment) |# b #|\n|##t #|||#1",
+			Output: []lexer.Token{
+				{Type: lexer.IDENT, Literal: "a"},
+				{Type: lexer.IDENT, Literal: "b"},
+				{Type: lexer.BOOL, Literal: "#t"},
+				{Type: lexer.NUMBER, Literal: "1"},
+			},
+		},
+		{
+			Description: "Datum comments",
+			Input:       "#;a #;(b)#;#;",
+			Output: []lexer.Token{
+				{Type: lexer.DCOMMENT, Literal: "#;"},
+				{Type: lexer.IDENT, Literal: "a"},
+				{Type: lexer.DCOMMENT, Literal: "#;"},
+				{Type: lexer.LPAREN, Literal: "("},
+				{Type: lexer.IDENT, Literal: "b"},
+				{Type: lexer.RPAREN, Literal: ")"},
+				{Type: lexer.DCOMMENT, Literal: "#;"},
+				{Type: lexer.DCOMMENT, Literal: "#;"},
+			},
+		},
+		{
+			Description: "Pipe identifiers",
+			Input:       `|foo bar| || |1+| |a\|b| |\x41;\x3bb;\t| |(|x`,
+			Output: []lexer.Token{
+				{Type: lexer.IDENT, Literal: "foo bar"},
+				{Type: lexer.IDENT, Literal: ""},
+				{Type: lexer.IDENT, Literal: "1+"},
+				{Type: lexer.IDENT, Literal: "a|b"},
+				{Type: lexer.IDENT, Literal: "A\u03bb\t"},
+				{Type: lexer.IDENT, Literal: "("},
+				{Type: lexer.IDENT, Literal: "x"},
+			},
+		},
+		{
+			Description: "String escapes",
+			Input:       "\"a\\nb\" \"\\t\\\"\\\\\\|\\a\\b\\r\" \"\\x3bb;\\X41;\" \"one \\  \n   two\" \"\\\ntwo\"",
+			Output: []lexer.Token{
+				{Type: lexer.STRING, Literal: "a\nb"},
+				{Type: lexer.STRING, Literal: "\t\"\\|\a\b\r"},
+				{Type: lexer.STRING, Literal: "\u03bbA"},
+				{Type: lexer.STRING, Literal: "one two"},
+				{Type: lexer.STRING, Literal: "two"},
+			},
+		},
+		{
+			Description: "Case folding directives",
+			Input:       "Foo #!fold-case Foo ΛX #\\A #\\SPACE #\\X41 |Foo| #!no-fold-case Foo",
+			Output: []lexer.Token{
+				{Type: lexer.IDENT, Literal: "Foo"},
+				{Type: lexer.IDENT, Literal: "foo"},
+				{Type: lexer.IDENT, Literal: "λx"},
+				{Type: lexer.CHAR, Literal: "#\\A"},
+				{Type: lexer.CHAR, Literal: "#\\space"},
+				{Type: lexer.CHAR, Literal: "#\\x41"},
+				{Type: lexer.IDENT, Literal: "Foo"},
+				{Type: lexer.IDENT, Literal: "Foo"},
+			},
+		},
+		{
+			Description: "Line endings and intraline whitespace",
+			Input:       "a\r\nb\rc\td\v\fe ; comment\r\n\"x\\\r\n\ty\" \"p\\\rq\" f ; comment at end",
+			Output: []lexer.Token{
+				{Type: lexer.IDENT, Literal: "a"},
+				{Type: lexer.IDENT, Literal: "b"},
+				{Type: lexer.IDENT, Literal: "c"},
+				{Type: lexer.IDENT, Literal: "d"},
+				{Type: lexer.IDENT, Literal: "e"},
+				{Type: lexer.STRING, Literal: "xy"},
+				{Type: lexer.STRING, Literal: "pq"},
+				{Type: lexer.IDENT, Literal: "f"},
+			},
+		},
+		{
+			Description: "Datum labels",
+			Input:       "#0=(a . #0#) #12=#12#",
+			Output: []lexer.Token{
+				{Type: lexer.LABEL, Literal: "#0="},
+				{Type: lexer.LPAREN, Literal: "("},
+				{Type: lexer.IDENT, Literal: "a"},
+				{Type: lexer.DOT, Literal: "."},
+				{Type: lexer.LABELREF, Literal: "#0#"},
+				{Type: lexer.RPAREN, Literal: ")"},
+				{Type: lexer.LABEL, Literal: "#12="},
+				{Type: lexer.LABELREF, Literal: "#12#"},
+			},
+		},
+		{
+			Description: "Bytevectors",
+			Input:       "#u8(0 255)#U8()",
+			Output: []lexer.Token{
+				{Type: lexer.U8PAREN, Literal: "#u8("},
+				{Type: lexer.NUMBER, Literal: "0"},
+				{Type: lexer.NUMBER, Literal: "255"},
+				{Type: lexer.RPAREN, Literal: ")"},
+				{Type: lexer.U8PAREN, Literal: "#u8("},
+				{Type: lexer.RPAREN, Literal: ")"},
+			},
+		},
 		{
 			Description: "Special tokens",
 			Input:       "()#('`,,@. ",
@@ -87,26 +245,550 @@ func TestLexer_NextToken(t *testing.T) {
 	}
 
 	for _, c := range testCases {
-		l.Scanner.Init(strings.NewReader(c.Input))
+		for kind, l := range newLexers(c.Input) {
+			tokens := make([]lexer.Token, 0, len(c.Output))
+
+			for token, err := l.NextToken(); ; token, err = l.NextToken() {
+				if err != nil {
+					if errors.Is(err, lexer.EOF) {
+						break
+					}
+
+					t.Error(err)
+
+					continue
+				}
+
+				// Positions are checked by TestLexer_Pos.
+				token.Pos, token.End = lexer.Pos{}, lexer.Pos{}
+
+				tokens = append(tokens, token)
+			}
+
+			if !reflect.DeepEqual(c.Output, tokens) {
+				t.Errorf("expected %v got %v from %s", c.Output, tokens, kind)
+			}
+		}
+	}
+}
+
+func TestLexer_Pos(t *testing.T) {
+	expected := [][2]lexer.Pos{
+		{{Line: 1, Column: 1, Offset: 0}, {Line: 1, Column: 2, Offset: 1}},
+		{{Line: 1, Column: 2, Offset: 1}, {Line: 1, Column: 8, Offset: 7}},
+		{{Line: 1, Column: 9, Offset: 8}, {Line: 1, Column: 10, Offset: 9}},
+		{{Line: 2, Column: 3, Offset: 22}, {Line: 2, Column: 6, Offset: 26}},
+		{{Line: 2, Column: 7, Offset: 27}, {Line: 2, Column: 9, Offset: 29}},
+		{{Line: 2, Column: 9, Offset: 29}, {Line: 2, Column: 10, Offset: 30}},
+		{{Line: 3, Column: 1, Offset: 31}, {Line: 3, Column: 3, Offset: 33}},
+	}
+
+	for kind, l := range newLexers("(define x ; comment\n  \"λ\" 42)\n#t") {
+		for _, pos := range expected {
+			token, err := l.NextToken()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if token.Pos != pos[0] || token.End != pos[1] {
+				t.Errorf("expected %+v got %+v-%+v for %s from %s", pos, token.Pos, token.End, token.Literal, kind)
+			}
+		}
+	}
+
+	for kind, l := range newLexers("\n  1/x") {
+		if _, err := l.NextToken(); !errors.Is(err, lexer.INVALID_NUMBER) || !strings.HasSuffix(err.Error(), "at 2:3") {
+			t.Errorf("expected invalid number at 2:3 from %s, got %v", kind, err)
+		}
+	}
+}
+
+func TestLexer_BlockComment(t *testing.T) {
+	for kind, l := range newLexers("a #| #| |# ") {
+		if _, err := l.NextToken(); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := l.NextToken(); !errors.Is(err, lexer.UNEXPECTED_EOF) || !strings.HasSuffix(err.Error(), "at 1:3") {
+			t.Errorf("expected unexpected EOF at 1:3 from %s, got %v", kind, err)
+		}
+	}
+}
+
+func TestLexer_PipeIdentifierErrors(t *testing.T) {
+	testCases := map[string]error{
+		"|abc":         lexer.UNEXPECTED_EOF,
+		`|a\q|`:        lexer.INVALID_ESCAPE,
+		`|\x;|`:        lexer.INVALID_ESCAPE,
+		`|\x41|`:       lexer.INVALID_ESCAPE,
+		`|\xd800;|`:    lexer.INVALID_ESCAPE,
+		`|\x1000000;|`: lexer.INVALID_ESCAPE,
+	}
+
+	for input, expected := range testCases {
+		for kind, l := range newLexers(input) {
+			if _, err := l.NextToken(); !errors.Is(err, expected) {
+				t.Errorf("expected %v got %v for %s from %s", expected, err, input, kind)
+			}
+		}
+	}
+}
+
+func TestLexer_StringErrors(t *testing.T) {
+	testCases := map[string]error{
+		`"abc`:       lexer.UNEXPECTED_EOF,
+		`"abc\`:      lexer.UNEXPECTED_EOF,
+		`"a\qb"`:     lexer.INVALID_ESCAPE,
+		`"a\x41"`:    lexer.INVALID_ESCAPE,
+		`"a\xzz;"`:   lexer.INVALID_ESCAPE,
+		`"a\  b"`:    lexer.INVALID_ESCAPE,
+		"\n \"\\q\"": lexer.INVALID_ESCAPE,
+	}
+
+	for input, expected := range testCases {
+		for kind, l := range newLexers(input) {
+			if _, err := l.NextToken(); !errors.Is(err, expected) {
+				t.Errorf("expected %v got %v for %s from %s", expected, err, input, kind)
+			}
+		}
+	}
+
+	if _, err := lexer.NewFromString("\n \"\\q\"").NextToken(); err == nil || !strings.HasSuffix(err.Error(), "at 2:2") {
+		t.Errorf("expected error at 2:2, got %v", err)
+	}
+}
+
+func TestLexer_InvalidUnicodeIdentifier(t *testing.T) {
+	for _, input := range []string{"٣a", "a\u0007b", "a\u00adb"} {
+		for kind, l := range newLexers(input) {
+			if _, err := l.NextToken(); !errors.Is(err, lexer.INVALID_IDENT) {
+				t.Errorf("expected invalid identifier for %q from %s, got %v", input, kind, err)
+			}
+		}
+	}
+}
+
+func TestLexer_HashErrors(t *testing.T) {
+	for _, input := range []string{"#q", "#u8", "#u7(", "#u8 (", "#0", "#1x", "#!foo", " #!/usr/bin/env scheme", "\n#! scheme"} {
+		for kind, l := range newLexers(input) {
+			if _, err := l.NextToken(); !errors.Is(err, lexer.INVALID_HASH) {
+				t.Errorf("expected invalid hash for %s from %s, got %v", input, kind, err)
+			}
+		}
+	}
+}
+
+func TestLexer_RegisterPrefix(t *testing.T) {
+	expected := []lexer.Token{
+		{Type: lexer.EXTENSION, Literal: "#hash"},
+		{Type: lexer.LPAREN, Literal: "("},
+		{Type: lexer.IDENT, Literal: "a"},
+		{Type: lexer.RPAREN, Literal: ")"},
+		{Type: lexer.EXTENSION, Literal: "#rx"},
+		{Type: lexer.STRING, Literal: "a+"},
+		{Type: lexer.EXTENSION, Literal: "#hash"},
+		{Type: lexer.BOOL, Literal: "#t"},
+	}
+
+	for kind, l := range newLexers(`#hash(a) #rx"a+" #hash #t #hashy`) {
+		l.RegisterPrefix("hash")
+		l.RegisterPrefix("rx")
+
+		for _, e := range expected {
+			token, err := l.NextToken()
+			if err != nil || token.Type != e.Type || token.Literal != e.Literal {
+				t.Errorf("expected %v got %v, %v from %s", e, token, err, kind)
+			}
+		}
+
+		if _, err := l.NextToken(); !errors.Is(err, lexer.INVALID_HASH) {
+			t.Errorf("expected invalid hash for #hashy from %s, got %v", kind, err)
+		}
+	}
+
+	l := lexer.New(strings.NewReader(""))
+	l.RegisterPrefix("rx")
+	l.Reset(strings.NewReader(`#rx"."`))
+	if token, err := l.NextToken(); err != nil || token.Type != lexer.EXTENSION {
+		t.Errorf("expected prefix registered after Reset, got %v, %v", token, err)
+	}
+
+	if _, err := lexer.NewFromString("#hash()").NextToken(); !errors.Is(err, lexer.INVALID_HASH) {
+		t.Errorf("expected invalid hash for unregistered prefix, got %v", err)
+	}
+}
+
+func TestLexer_KeepTrivia(t *testing.T) {
+	input := "a ;c\r\n#|b #|c|# |# #!fold-case X\t#;y ; end"
+	expected := []lexer.Token{
+		{Type: lexer.IDENT, Literal: "a"},
+		{Type: lexer.WHITESPACE, Literal: " "},
+		{Type: lexer.LCOMMENT, Literal: ";c"},
+		{Type: lexer.WHITESPACE, Literal: "\r\n"},
+		{Type: lexer.BCOMMENT, Literal: "#|b #|c|# |#"},
+		{Type: lexer.WHITESPACE, Literal: " "},
+		{Type: lexer.DIRECTIVE, Literal: "#!fold-case"},
+		{Type: lexer.WHITESPACE, Literal: " "},
+		{Type: lexer.IDENT, Literal: "x"},
+		{Type: lexer.WHITESPACE, Literal: "\t"},
+		{Type: lexer.DCOMMENT, Literal: "#;"},
+		{Type: lexer.IDENT, Literal: "y"},
+		{Type: lexer.WHITESPACE, Literal: " "},
+		{Type: lexer.LCOMMENT, Literal: "; end"},
+	}
+
+	for kind, l := range newLexers(input) {
+		l.KeepTrivia = true
+
+		var (
+			tokens []lexer.Token
+			sb     strings.Builder
+		)
+
+		for token, err := range l.Tokens() {
+			if err != nil {
+				t.Fatalf("unexpected error %v from %s", err, kind)
+			}
+			if input[token.Pos.Offset:token.End.Offset] != token.Literal && token.Type != lexer.IDENT {
+				t.Errorf("expected literal %q to be source of token from %s", token.Literal, kind)
+			}
+			tokens = append(tokens, lexer.Token{Type: token.Type, Literal: token.Literal})
+			sb.WriteString(input[token.Pos.Offset:token.End.Offset])
+		}
+
+		if !reflect.DeepEqual(tokens, expected) {
+			t.Errorf("expected %v got %v from %s", expected, tokens, kind)
+		}
+		if sb.String() != input {
+			t.Errorf("expected tokens to cover source %q got %q from %s", input, sb.String(), kind)
+		}
+	}
+}
+
+func TestLexer_CharErrors(t *testing.T) {
+	testCases := map[string]error{
+		"#\\":        lexer.UNEXPECTED_EOF,
+		"#\\foo":     lexer.UNKNOWN_NCHAR,
+		"#\\Space":   lexer.UNKNOWN_NCHAR,
+		"#\\xzz":     lexer.UNKNOWN_NCHAR,
+		"#\\x-1":     lexer.UNKNOWN_NCHAR,
+		"#\\xd800":   lexer.UNKNOWN_NCHAR,
+		"#\\x110000": lexer.UNKNOWN_NCHAR,
+	}
+
+	for input, expected := range testCases {
+		for kind, l := range newLexers(input) {
+			if _, err := l.NextToken(); !errors.Is(err, expected) {
+				t.Errorf("expected %v got %v for %s from %s", expected, err, input, kind)
+			}
+		}
+	}
+}
+
+func TestLexer_FoldCase(t *testing.T) {
+	for kind, l := range newLexers("Foo #\\Newline #!no-fold-case Bar") {
+		l.FoldCase = true
+
+		var literals []string
+		for token, err := range l.Tokens() {
+			if err != nil {
+				t.Fatal(err)
+			}
+			literals = append(literals, token.Literal)
+		}
+
+		if expected := []string{"foo", "#\\newline", "Bar"}; !reflect.DeepEqual(expected, literals) {
+			t.Errorf("expected %v got %v from %s", expected, literals, kind)
+		}
+	}
+
+	for kind, l := range newLexers("#!FOLD-CASE x") {
+		if _, err := l.NextToken(); !errors.Is(err, lexer.INVALID_HASH) {
+			t.Errorf("expected invalid hash for unknown directive from %s, got %v", kind, err)
+		}
+	}
+}
+
+func TestLexer_ScriptLine(t *testing.T) {
+	testCases := []struct {
+		Input  string
+		Output []lexer.Token
+	}{
+		{"#!/usr/bin/env scheme\n(x)", []lexer.Token{{Type: lexer.LPAREN, Literal: "("}, {Type: lexer.IDENT, Literal: "x"}, {Type: lexer.RPAREN, Literal: ")"}}},
+		{"#! /usr/local/bin/scheme -q\r\nx", []lexer.Token{{Type: lexer.IDENT, Literal: "x"}}},
+		{"#!/usr/bin/env scheme", nil},
+		{"#!fold-case X", []lexer.Token{{Type: lexer.IDENT, Literal: "x"}}},
+	}
+
+	for _, c := range testCases {
+		for kind, l := range newLexers(c.Input) {
+			var tokens []lexer.Token
+			for token, err := range l.Tokens() {
+				if err != nil {
+					t.Fatalf("unexpected error %v for %q from %s", err, c.Input, kind)
+				}
+				tokens = append(tokens, lexer.Token{Type: token.Type, Literal: token.Literal})
+			}
+
+			if !reflect.DeepEqual(tokens, c.Output) {
+				t.Errorf("expected %v got %v for %q from %s", c.Output, tokens, c.Input, kind)
+			}
+		}
+	}
+
+	for kind, l := range newLexers("#!/usr/bin/env scheme\nx") {
+		l.KeepTrivia = true
+		if token, err := l.NextToken(); err != nil || token.Type != lexer.LCOMMENT || token.Literal != "#!/usr/bin/env scheme" {
+			t.Errorf("expected script line as line comment from %s, got %v, %v", kind, token, err)
+		}
+	}
+
+	for kind, l := range newLexers("(x)\n#!/usr/bin/env scheme") {
+		var err error
+		for _, err = range l.Tokens() {
+		}
+		if !errors.Is(err, lexer.INVALID_HASH) || !strings.Contains(err.Error(), "start of source") {
+			t.Errorf("expected script line error from %s, got %v", kind, err)
+		}
+	}
+}
+
+func TestLexer_PeekToken(t *testing.T) {
+	for kind, l := range newLexers("(a b)") {
+		if err := l.UnreadToken(); !errors.Is(err, lexer.INVALID_UNREAD) {
+			t.Errorf("expected invalid unread before first token from %s, got %v", kind, err)
+		}
 
-		tokens := make([]lexer.Token, 0, len(c.Output))
+		var literals []string
 
-		for token, err := l.NextToken(); ; token, err = l.NextToken() {
+		peeked, _ := l.PeekToken()
+		literals = append(literals, peeked.Literal)
+
+		token, _ := l.NextToken()
+		literals = append(literals, token.Literal)
+
+		token, _ = l.NextToken()
+		if err := l.UnreadToken(); err != nil {
+			t.Errorf("unexpected error from %s: %v", kind, err)
+		}
+		if err := l.UnreadToken(); !errors.Is(err, lexer.INVALID_UNREAD) {
+			t.Errorf("expected invalid unread of unread token from %s, got %v", kind, err)
+		}
+		literals = append(literals, token.Literal)
+
+		for token, err := range l.Tokens() {
 			if err != nil {
-				if errors.Is(err, lexer.EOF) {
-					break
+				t.Fatal(err)
+			}
+			literals = append(literals, token.Literal)
+		}
+
+		if _, err := l.PeekToken(); !errors.Is(err, lexer.EOF) {
+			t.Errorf("expected EOF from %s, got %v", kind, err)
+		}
+		if _, err := l.NextToken(); !errors.Is(err, lexer.EOF) {
+			t.Errorf("expected EOF from %s, got %v", kind, err)
+		}
+
+		if expected := []string{"(", "(", "a", "a", "b", ")"}; !reflect.DeepEqual(expected, literals) {
+			t.Errorf("expected %v got %v from %s", expected, literals, kind)
+		}
+	}
+}
+
+func TestLexer_Reset(t *testing.T) {
+	for kind, l := range newLexers("#!fold-case (A") {
+		l.PeekToken()
+		l.NextToken()
+		l.UnreadToken()
+
+		for _, input := range []string{"B c", "\n  d"} {
+			l.Reset(strings.NewReader(input))
+
+			var tokens []lexer.Token
+			for token, err := range l.Tokens() {
+				if err != nil {
+					t.Fatal(err)
 				}
+				tokens = append(tokens, token)
+			}
+
+			expected := lexer.NewFromString(input)
+			for i, token := range tokens {
+				if e, _ := expected.NextToken(); e != token {
+					t.Errorf("expected %v got %v at %d after reset of %s", e, token, i, kind)
+				}
+			}
+			if _, err := expected.NextToken(); !errors.Is(err, lexer.EOF) {
+				t.Errorf("expected %d tokens got %d after reset of %s", len(tokens)+1, len(tokens), kind)
+			}
+		}
+	}
+}
+
+func TestQuoteIdentifier(t *testing.T) {
+	testCases := map[string]string{
+		"foo":      "foo",
+		"set-car!": "set-car!",
+		"+":        "+",
+		"...":      "...",
+		"<=?":      "<=?",
+		"foo bar":  "|foo bar|",
+		"":         "||",
+		"1+":       "|1+|",
+		"a|b":      `|a\|b|`,
+		`a\b`:      `|a\\b|`,
+		"a\tb":     `|a\x9;b|`,
+		"(":        "|(|",
+		"λ":        "λ",
+		"٣":        "|٣|",
+	}
+
+	for name, expected := range testCases {
+		quoted := lexer.QuoteIdentifier(name)
+		if quoted != expected {
+			t.Errorf("expected %s got %s for %q", expected, quoted, name)
+		}
+
+		token, err := lexer.NewFromString(quoted).NextToken()
+		if err != nil || token.Type != lexer.IDENT || token.Literal != name {
+			t.Errorf("expected %s to read back as %q, got %v (%v)", quoted, name, token, err)
+		}
+	}
+}
+
+func TestQuoteString(t *testing.T) {
+	testCases := map[string]string{
+		"":         `""`,
+		"abc":      `"abc"`,
+		"a\"b":     `"a\"b"`,
+		`a\b`:      `"a\\b"`,
+		"a\nb\tc":  `"a\nb\tc"`,
+		"\a\b\r":   `"\a\b\r"`,
+		"\x00\x7f": `"\x0;\x7f;"`,
+		"λ|":       `"λ|"`,
+	}
+
+	for s, expected := range testCases {
+		quoted := lexer.QuoteString(s)
+		if quoted != expected {
+			t.Errorf("expected %s got %s for %q", expected, quoted, s)
+		}
+
+		token, err := lexer.NewFromString(quoted).NextToken()
+		if err != nil || token.Type != lexer.STRING || token.Literal != s {
+			t.Errorf("expected %s to read back as %q, got %v (%v)", quoted, s, token, err)
+		}
+	}
+}
+
+func TestCharLiteral(t *testing.T) {
+	testCases := map[rune]string{
+		'a':      `#\a`,
+		'(':      `#\(`,
+		'λ':      `#\λ`,
+		' ':      `#\space`,
+		'\n':     `#\newline`,
+		0:        `#\null`,
+		0x7f:     `#\delete`,
+		'\u3000': `#\x3000`,
+		'\u200b': `#\x200b`,
+		0x10ffff: `#\x10ffff`,
+	}
+
+	for r, expected := range testCases {
+		literal := lexer.CharLiteral(r)
+		if literal != expected {
+			t.Errorf("expected %s got %s for %q", expected, literal, r)
+		}
+
+		token, err := lexer.NewFromString(literal).NextToken()
+		if value, ok := lexer.CharValue(token.Literal[2:]); err != nil || token.Type != lexer.CHAR || !ok || value != r {
+			t.Errorf("expected %s to read back as %q, got %v (%v)", literal, r, token, err)
+		}
+	}
+}
 
-				t.Error(err)
+func TestLexer_Tokens(t *testing.T) {
+	var literals []string
 
-				continue
+	for token, err := range lexer.New(strings.NewReader("(a 1) #t")).Tokens() {
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		literals = append(literals, token.Literal)
+	}
+
+	if expected := []string{"(", "a", "1", ")", "#t"}; !reflect.DeepEqual(expected, literals) {
+		t.Errorf("expected %v got %v", expected, literals)
+	}
+
+	var errs []error
+
+	for _, err := range lexer.New(strings.NewReader("a 1/x b")).Tokens() {
+		errs = append(errs, err)
+	}
+
+	if len(errs) != 2 || errs[0] != nil || !errors.Is(errs[1], lexer.INVALID_NUMBER) {
+		t.Errorf("expected iteration to stop after invalid number, got %v", errs)
+	}
+
+	count := 0
+
+	for range lexer.New(strings.NewReader("a b c")).Tokens() {
+		count++
+		break
+	}
+
+	if count != 1 {
+		t.Errorf("expected early break, got %d iterations", count)
+	}
+}
+
+var benchmarkSource = strings.Repeat(`; compute factorial
+(define (fact n)
+  (if (= n 0) 1 (* n (fact (- n 1)))))
+(display "factorial of 20 is ") (fact 20) #\space #(1 2.5 #xff) '(a . b) #t
+`, 1000)
+
+func BenchmarkLexer_Reader(b *testing.B) {
+	b.ReportAllocs()
+	b.SetBytes(int64(len(benchmarkSource)))
+
+	for range b.N {
+		for _, err := range lexer.New(strings.NewReader(benchmarkSource)).Tokens() {
+			if err != nil {
+				b.Fatal(err)
 			}
+		}
+	}
+}
+
+func BenchmarkLexer_String(b *testing.B) {
+	b.ReportAllocs()
+	b.SetBytes(int64(len(benchmarkSource)))
 
-			tokens = append(tokens, token)
+	for range b.N {
+		for _, err := range lexer.NewFromString(benchmarkSource).Tokens() {
+			if err != nil {
+				b.Fatal(err)
+			}
 		}
+	}
+}
 
-		if !reflect.DeepEqual(c.Output, tokens) {
-			t.Errorf("expected %v got %v", c.Output, tokens)
+func BenchmarkLexer_Bytes(b *testing.B) {
+	source := []byte(benchmarkSource)
+
+	b.ReportAllocs()
+	b.SetBytes(int64(len(source)))
+
+	for range b.N {
+		for _, err := range lexer.NewFromBytes(source).Tokens() {
+			if err != nil {
+				b.Fatal(err)
+			}
 		}
 	}
 }
@@ -0,0 +1,106 @@
+package lexer
+
+import (
+	"fmt"
+)
+
+// Category of token for syntax highlighting.
+const (
+	PUNCTUATION Category = iota // Parentheses, abbreviations, dot, labels and extensions
+	LITERAL                     // Booleans, characters, strings and numbers
+	IDENTIFIER                  // Identifiers other than keywords
+	KEYWORD                     // Identifiers naming standard syntax, e.g. define
+	COMMENT                     // Comments, datum comment prefix #; and directives
+	BLANK                       // Whitespace
+)
+
+var (
+	tokenTypeNames = [...]string{
+		LPAREN:     "LPAREN",
+		RPAREN:     "RPAREN",
+		HPAREN:     "HPAREN",
+		SQUOTE:     "SQUOTE",
+		BQUOTE:     "BQUOTE",
+		COMMA:      "COMMA",
+		COMMAT:     "COMMAT",
+		DOT:        "DOT",
+		BOOL:       "BOOL",
+		CHAR:       "CHAR",
+		IDENT:      "IDENT",
+		STRING:     "STRING",
+		NUMBER:     "NUMBER",
+		DCOMMENT:   "DCOMMENT",
+		LABEL:      "LABEL",
+		LABELREF:   "LABELREF",
+		U8PAREN:    "U8PAREN",
+		EXTENSION:  "EXTENSION",
+		WHITESPACE: "WHITESPACE",
+		LCOMMENT:   "LCOMMENT",
+		BCOMMENT:   "BCOMMENT",
+		DIRECTIVE:  "DIRECTIVE",
+	}
+
+	categoryNames = [...]string{
+		PUNCTUATION: "punctuation",
+		LITERAL:     "literal",
+		IDENTIFIER:  "identifier",
+		KEYWORD:     "keyword",
+		COMMENT:     "comment",
+		BLANK:       "blank",
+	}
+
+	// keywords are syntactic keywords of R7RS (7.1.3. Expressions, 7.1.5.
+	// Transformers, 7.1.6. Programs and definitions and 7.1.7. Libraries).
+	keywords = map[string]bool{
+		"=>": true, "...": true, "_": true, "and": true, "begin": true,
+		"case": true, "case-lambda": true, "cond": true, "cond-expand": true,
+		"define": true, "define-library": true, "define-record-type": true,
+		"define-syntax": true, "define-values": true, "delay": true,
+		"delay-force": true, "do": true, "else": true, "export": true,
+		"guard": true, "if": true, "import": true, "include": true,
+		"include-ci": true, "lambda": true, "let": true, "let*": true,
+		"let*-values": true, "let-syntax": true, "let-values": true,
+		"letrec": true, "letrec*": true, "letrec-syntax": true, "or": true,
+		"parameterize": true, "quasiquote": true, "quote": true, "set!": true,
+		"syntax-error": true, "syntax-rules": true, "unless": true,
+		"unquote": true, "unquote-splicing": true, "when": true,
+	}
+)
+
+type Category uint8
+
+func (t TokenType) String() string {
+	if int(t) < len(tokenTypeNames) {
+		return tokenTypeNames[t]
+	}
+
+	return fmt.Sprintf("TokenType(%d)", t)
+}
+
+func (c Category) String() string {
+	if int(c) < len(categoryNames) {
+		return categoryNames[c]
+	}
+
+	return fmt.Sprintf("Category(%d)", c)
+}
+
+// Classify returns category of token. Identifier is keyword if it names
+// standard syntax, whether or not it is bound to that syntax where it occurs.
+func Classify(token Token) Category {
+	switch token.Type {
+	case BOOL, CHAR, STRING, NUMBER:
+		return LITERAL
+	case IDENT:
+		if keywords[token.Literal] {
+			return KEYWORD
+		}
+		return IDENTIFIER
+	case DCOMMENT, LCOMMENT, BCOMMENT, DIRECTIVE:
+		return COMMENT
+	case WHITESPACE:
+		return BLANK
+	default:
+		return PUNCTUATION
+	}
+}
@@ -0,0 +1,70 @@
+package lexer_test
+
+import (
+	"github.com/vkhonin/scheme/lexer"
+	"testing"
+)
+
+func TestTokenType_String(t *testing.T) {
+	testCases := map[lexer.TokenType]string{
+		lexer.LPAREN:         "LPAREN",
+		lexer.COMMAT:         "COMMAT",
+		lexer.IDENT:          "IDENT",
+		lexer.DCOMMENT:       "DCOMMENT",
+		lexer.LABELREF:       "LABELREF",
+		lexer.U8PAREN:        "U8PAREN",
+		lexer.EXTENSION:      "EXTENSION",
+		lexer.DIRECTIVE:      "DIRECTIVE",
+		lexer.DIRECTIVE + 1:  "TokenType(22)",
+		lexer.TokenType(255): "TokenType(255)",
+	}
+
+	for tokenType, expected := range testCases {
+		if actual := tokenType.String(); actual != expected {
+			t.Errorf("expected %s got %s", expected, actual)
+		}
+	}
+}
+
+func TestClassify(t *testing.T) {
+	testCases := map[string][]lexer.Category{
+		"(define (f x) 'x)": {
+			lexer.PUNCTUATION, lexer.KEYWORD, lexer.PUNCTUATION, lexer.IDENTIFIER, lexer.IDENTIFIER,
+			lexer.PUNCTUATION, lexer.PUNCTUATION, lexer.IDENTIFIER, lexer.PUNCTUATION,
+		},
+		`#(1 #t #\a "s") . #;`: {
+			lexer.PUNCTUATION, lexer.LITERAL, lexer.LITERAL, lexer.LITERAL, lexer.LITERAL,
+			lexer.PUNCTUATION, lexer.PUNCTUATION, lexer.COMMENT,
+		},
+		"|if| else ... `,@": {
+			lexer.KEYWORD, lexer.KEYWORD, lexer.KEYWORD, lexer.PUNCTUATION, lexer.PUNCTUATION,
+		},
+		"#0=(#0#)": {
+			lexer.PUNCTUATION, lexer.PUNCTUATION, lexer.PUNCTUATION, lexer.PUNCTUATION,
+		},
+	}
+
+	for input, expected := range testCases {
+		var categories []lexer.Category
+		for token, err := range lexer.NewFromString(input).Tokens() {
+			if err != nil {
+				t.Fatal(err)
+			}
+			categories = append(categories, lexer.Classify(token))
+		}
+
+		if len(categories) != len(expected) {
+			t.Fatalf("expected %v got %v for %s", expected, categories, input)
+		}
+		for i := range expected {
+			if categories[i] != expected[i] {
+				t.Errorf("expected %v got %v for %s", expected, categories, input)
+				break
+			}
+		}
+	}
+
+	if actual := lexer.KEYWORD.String(); actual != "keyword" {
+		t.Errorf("expected keyword got %s", actual)
+	}
+}
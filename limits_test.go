@@ -0,0 +1,83 @@
+package scheme_test
+
+import (
+	"context"
+	"errors"
+	"github.com/vkhonin/scheme"
+	"github.com/vkhonin/scheme/eval"
+	"github.com/vkhonin/scheme/printer"
+	"testing"
+	"time"
+)
+
+func TestInterp_Limits(t *testing.T) {
+	testCases := []struct {
+		Option scheme.Option
+		Input  string
+	}{
+		{scheme.WithMaxSteps(1000), "(define (f) (f)) (f)"},
+		{scheme.WithMaxSteps(1000), "(do () (#f))"},
+		{scheme.WithMaxSteps(1000), "(guard (e (#t 'caught)) (let loop () (loop)))"},
+		{scheme.WithMaxCells(1000), "(let loop ((l '())) (loop (cons 1 l)))"},
+		{scheme.WithMaxCells(1000), "(define (grow l) (grow `(1 ,@l ,@l))) (grow '())"},
+		{scheme.WithMaxCells(1000), "(let loop ((n 0)) `(,n ,n ,n) (loop (+ n 1)))"},
+		{scheme.WithMaxCells(1000), "(let loop ((n 0)) `#(,n) (loop (+ n 1)))"},
+		{scheme.WithMaxCells(1000), "(let loop ((l '())) (loop (map (lambda (x) x) (list 1 2 3 4 5 6 7 8 9 10))))"},
+		{scheme.WithMaxCells(1000), "(define (f . rest) (f 1 2 3)) (f)"},
+		{scheme.WithMaxCells(1000), "(define (f x) (f (* x x))) (f 3)"},
+		{scheme.WithMaxCells(1000), "(define (f x) (f (/ 1 (+ x 1)))) (f 1)"},
+		{scheme.WithMaxDepth(100), "(define (f n) (+ 1 (f n))) (f 0)"},
+		{scheme.WithMaxDepth(100), "(define (f n) (if (= n 0) 0 (+ 1 (f (- n 1))))) (guard (e (#t 'caught)) (f 1000))"},
+	}
+
+	for _, options := range [][]scheme.Option{nil, {scheme.WithVM()}} {
+		for _, c := range testCases {
+			interp := scheme.New(append(options, c.Option)...)
+
+			_, err := interp.EvalString(c.Input)
+
+			var interrupted *eval.Interrupted
+			if !errors.As(err, &interrupted) || !errors.Is(err, scheme.ErrResourceLimit) {
+				t.Errorf("expected error %v got %v for %s", scheme.ErrResourceLimit, err, c.Input)
+			}
+
+			if result, err := interp.EvalString("(+ 1 2)"); err != nil || printer.Write(result) != "3" {
+				t.Errorf("expected 3 after exceeding limit got %v, %v for %s", result, err, c.Input)
+			}
+		}
+	}
+}
+
+func TestInterp_Limits_Numbers(t *testing.T) {
+	for _, options := range [][]scheme.Option{nil, {scheme.WithVM()}} {
+		interp := scheme.New(append(options, scheme.WithMaxCells(1000))...)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		_, err := interp.EvalContext(ctx, "(define (f x) (f (* x x))) (f 3)")
+		cancel()
+
+		if !errors.Is(err, scheme.ErrResourceLimit) {
+			t.Errorf("expected error %v got %v", scheme.ErrResourceLimit, err)
+		}
+	}
+}
+
+func TestInterp_Limits_Within(t *testing.T) {
+	limits := []scheme.Option{scheme.WithMaxSteps(10000), scheme.WithMaxCells(1000), scheme.WithMaxDepth(200)}
+	input := "(define (count n) (if (= n 0) '() (cons n (count (- n 1))))) (length (count 50))"
+
+	for _, options := range [][]scheme.Option{limits, append(limits, scheme.WithVM())} {
+		interp := scheme.New(options...)
+
+		if _, err := interp.EvalString("(define (length l) (if (null? l) 0 (+ 1 (length (cdr l)))))"); err != nil {
+			t.Fatal(err)
+		}
+
+		for range 3 {
+			result, err := interp.EvalString(input)
+			if err != nil || printer.Write(result) != "50" {
+				t.Errorf("expected 50 got %v, %v", result, err)
+			}
+		}
+	}
+}
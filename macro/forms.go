@@ -0,0 +1,532 @@
+package macro
+
+import (
+	"fmt"
+	"github.com/vkhonin/scheme/parser"
+)
+
+// form expands operands of core form e, which are expressions, bodies,
+// bindings etc. depending on form, in scope s. Malformed forms are returned
+// as they are for evaluator to report.
+type form func(x *Expander, e *parser.Expr, operands []parser.Sexpr, s *scope) (parser.Sexpr, error)
+
+// forms expand core forms by their keywords. Forms missing, e.g. if, have
+// expressions as all operands.
+var forms map[string]form
+
+func init() {
+	forms = map[string]form{
+		"case":          expandCase,
+		"cond":          expandCond,
+		"define":        expandDefine,
+		"define-syntax": expandDefineSyntax,
+		"do":            expandDo,
+		"guard":         expandGuard,
+		"lambda":        expandLambda,
+		"let":           expandLet,
+		"let*":          expandLet,
+		"let-syntax":    expandLetSyntax,
+		"letrec":        expandLet,
+		"letrec*":       expandLet,
+		"letrec-syntax": expandLetSyntax,
+		"quasiquote":    expandQuasiquote,
+		"quote":         expandQuote,
+		"set!":          expandSet,
+		"syntax-rules":  expandQuote,
+	}
+}
+
+// expr expands expression form in scope s.
+func (x *Expander) expr(form parser.Sexpr, s *scope) (parser.Sexpr, error) {
+	form, err := x.use(form, s)
+	if err != nil {
+		return nil, err
+	}
+
+	keyword, operands, ok := coreForm(form)
+	if !ok {
+		return form, nil
+	}
+
+	e := form.(*parser.Expr)
+
+	if expand, ok := forms[keyword]; ok {
+		return expand(x, e, operands, s)
+	}
+
+	items, err := x.exprs(append([]parser.Sexpr{e.Car}, operands...), s)
+	if err != nil {
+		return nil, err
+	}
+
+	return withSpan(parser.List(items...), e), nil
+}
+
+// exprs expands expressions forms in scope s.
+func (x *Expander) exprs(forms []parser.Sexpr, s *scope) ([]parser.Sexpr, error) {
+	expanded := make([]parser.Sexpr, len(forms))
+
+	for i, form := range forms {
+		var err error
+		if expanded[i], err = x.expr(form, s); err != nil {
+			return nil, err
+		}
+	}
+
+	return expanded, nil
+}
+
+func expandQuote(_ *Expander, e *parser.Expr, _ []parser.Sexpr, _ *scope) (parser.Sexpr, error) {
+	return e, nil
+}
+
+func expandSet(x *Expander, e *parser.Expr, operands []parser.Sexpr, s *scope) (parser.Sexpr, error) {
+	if len(operands) != 2 {
+		return e, nil
+	}
+
+	value, err := x.expr(operands[1], s)
+	if err != nil {
+		return nil, err
+	}
+
+	return rebuild(e, []parser.Sexpr{operands[0], value}), nil
+}
+
+func expandLambda(x *Expander, e *parser.Expr, operands []parser.Sexpr, s *scope) (parser.Sexpr, error) {
+	if len(operands) < 2 {
+		return e, nil
+	}
+
+	return x.procedure(e, operands[0], operands[0], operands[1:], s)
+}
+
+// procedure expands lambda or procedure definition e, target of which is
+// formals or, for definition, name and formals, with body in scope s.
+func (x *Expander) procedure(e *parser.Expr, target, formals parser.Sexpr, body []parser.Sexpr, s *scope) (parser.Sexpr, error) {
+	bodyScope := newScope(s)
+	bodyScope.shadow(formalNames(formals)...)
+
+	body, err := x.body(body, bodyScope)
+	if err != nil {
+		return nil, err
+	}
+
+	return rebuild(e, append([]parser.Sexpr{target}, body...)), nil
+}
+
+func expandDefine(x *Expander, e *parser.Expr, operands []parser.Sexpr, s *scope) (parser.Sexpr, error) {
+	if len(operands) < 2 {
+		return e, nil
+	}
+
+	s.shadow(definedName(operands)...)
+
+	if target, ok := operands[0].(*parser.Expr); ok && !isNull(target) {
+		return x.procedure(e, target, target.Cdr, operands[1:], s)
+	}
+
+	values, err := x.exprs(operands[1:], s)
+	if err != nil {
+		return nil, err
+	}
+
+	return rebuild(e, append([]parser.Sexpr{operands[0]}, values...)), nil
+}
+
+// expandDefineSyntax defines macro where definitions are not expected, e.g.
+// inside if, and replaces definition with empty begin.
+func expandDefineSyntax(x *Expander, _ *parser.Expr, operands []parser.Sexpr, s *scope) (parser.Sexpr, error) {
+	if err := x.defineSyntax(operands, s); err != nil {
+		return nil, err
+	}
+
+	return parser.List(parser.Symbol("begin")), nil
+}
+
+// expandLetSyntax defines macros of let-syntax or letrec-syntax in scope of
+// its body, which is expanded into let without bindings.
+func expandLetSyntax(x *Expander, e *parser.Expr, operands []parser.Sexpr, s *scope) (parser.Sexpr, error) {
+	if len(operands) < 1 {
+		return e, nil
+	}
+
+	bindings, ok := list(operands[0])
+	if !ok {
+		return e, nil
+	}
+
+	bodyScope := newScope(s)
+	for _, b := range bindings {
+		binding, ok := list(b)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s binding", INVALID_MACRO, e.Car)
+		}
+		if err := x.defineSyntax(binding, bodyScope); err != nil {
+			return nil, err
+		}
+	}
+
+	body, err := x.body(operands[1:], bodyScope)
+	if err != nil {
+		return nil, err
+	}
+
+	return withSpan(parser.List(append([]parser.Sexpr{parser.Symbol("let"), parser.Nil}, body...)...), e), nil
+}
+
+// expandLet expands let, named let, let*, letrec and letrec*. Initializers
+// of letrec are in scope of its variables.
+func expandLet(x *Expander, e *parser.Expr, operands []parser.Sexpr, s *scope) (parser.Sexpr, error) {
+	keyword, _ := symbolName(e.Car)
+
+	var name []parser.Sexpr
+	if _, ok := symbolName(itemAt(operands, 0)); ok && keyword == "let" {
+		name, operands = operands[:1], operands[1:]
+	}
+
+	if len(operands) < 2 {
+		return e, nil
+	}
+
+	bindings, ok := list(operands[0])
+	if !ok {
+		return e, nil
+	}
+
+	bodyScope := newScope(s)
+	for _, n := range name {
+		bodyScope.shadow(definedName([]parser.Sexpr{n})...)
+	}
+
+	initScope := s
+	if keyword == "letrec" || keyword == "letrec*" {
+		initScope = bodyScope
+	}
+
+	expanded := make([]parser.Sexpr, len(bindings))
+	for i, b := range bindings {
+		binding, ok := list(b)
+		if !ok || len(binding) != 2 {
+			return e, nil
+		}
+
+		bodyScope.shadow(definedName(binding)...)
+
+		init, err := x.expr(binding[1], initScope)
+		if err != nil {
+			return nil, err
+		}
+		expanded[i] = parser.List(binding[0], init)
+	}
+
+	body, err := x.body(operands[1:], bodyScope)
+	if err != nil {
+		return nil, err
+	}
+
+	return rebuild(e, append(append(name, parser.List(expanded...)), body...)), nil
+}
+
+func expandDo(x *Expander, e *parser.Expr, operands []parser.Sexpr, s *scope) (parser.Sexpr, error) {
+	if len(operands) < 2 {
+		return e, nil
+	}
+
+	specs, ok := list(operands[0])
+	if !ok {
+		return e, nil
+	}
+
+	loopScope := newScope(s)
+	for _, sp := range specs {
+		spec, ok := list(sp)
+		if !ok || len(spec) < 2 {
+			return e, nil
+		}
+		loopScope.shadow(definedName(spec)...)
+	}
+
+	expanded := make([]parser.Sexpr, len(specs))
+	for i, sp := range specs {
+		spec, _ := list(sp)
+
+		init, err := x.expr(spec[1], s)
+		if err != nil {
+			return nil, err
+		}
+		steps, err := x.exprs(spec[2:], loopScope)
+		if err != nil {
+			return nil, err
+		}
+
+		expanded[i] = parser.List(append([]parser.Sexpr{spec[0], init}, steps...)...)
+	}
+
+	exit, ok := list(operands[1])
+	if !ok {
+		return e, nil
+	}
+	exit, err := x.exprs(exit, loopScope)
+	if err != nil {
+		return nil, err
+	}
+
+	commands, err := x.exprs(operands[2:], loopScope)
+	if err != nil {
+		return nil, err
+	}
+
+	return rebuild(e, append([]parser.Sexpr{parser.List(expanded...), parser.List(exit...)}, commands...)), nil
+}
+
+func expandCond(x *Expander, e *parser.Expr, operands []parser.Sexpr, s *scope) (parser.Sexpr, error) {
+	clauses, ok, err := x.clauses(operands, 0, s)
+	if err != nil || !ok {
+		return e, err
+	}
+
+	return rebuild(e, clauses), nil
+}
+
+func expandCase(x *Expander, e *parser.Expr, operands []parser.Sexpr, s *scope) (parser.Sexpr, error) {
+	if len(operands) < 1 {
+		return e, nil
+	}
+
+	key, err := x.expr(operands[0], s)
+	if err != nil {
+		return nil, err
+	}
+
+	clauses, ok, err := x.clauses(operands[1:], 1, s)
+	if err != nil || !ok {
+		return e, err
+	}
+
+	return rebuild(e, append([]parser.Sexpr{key}, clauses...)), nil
+}
+
+func expandGuard(x *Expander, e *parser.Expr, operands []parser.Sexpr, s *scope) (parser.Sexpr, error) {
+	if len(operands) < 2 {
+		return e, nil
+	}
+
+	spec, ok := list(operands[0])
+	if !ok || len(spec) == 0 {
+		return e, nil
+	}
+
+	guardScope := newScope(s)
+	guardScope.shadow(definedName(spec)...)
+
+	clauses, ok, err := x.clauses(spec[1:], 0, guardScope)
+	if err != nil || !ok {
+		return e, err
+	}
+
+	body, err := x.body(operands[1:], newScope(s))
+	if err != nil {
+		return nil, err
+	}
+
+	return rebuild(e, append([]parser.Sexpr{parser.List(append(spec[:1:1], clauses...)...)}, body...)), nil
+}
+
+// clauses expands cond-like clauses, all elements of which are expressions,
+// except for first skip ones, e.g. data of case clauses, which are kept as
+// they are. It returns false if any clause is not list.
+func (x *Expander) clauses(clauses []parser.Sexpr, skip int, s *scope) ([]parser.Sexpr, bool, error) {
+	expanded := make([]parser.Sexpr, len(clauses))
+
+	for i, c := range clauses {
+		clause, ok := list(c)
+		if !ok || len(clause) < skip {
+			return nil, false, nil
+		}
+
+		exprs, err := x.exprs(clause[skip:], s)
+		if err != nil {
+			return nil, false, err
+		}
+
+		expanded[i] = parser.List(append(clause[:skip:skip], exprs...)...)
+	}
+
+	return expanded, true, nil
+}
+
+func expandQuasiquote(x *Expander, e *parser.Expr, operands []parser.Sexpr, s *scope) (parser.Sexpr, error) {
+	if len(operands) != 1 {
+		return e, nil
+	}
+
+	template, err := x.template(operands[0], 1, s)
+	if err != nil {
+		return nil, err
+	}
+
+	return rebuild(e, []parser.Sexpr{template}), nil
+}
+
+// template expands expressions unquoted in quasiquote template at nesting
+// depth, which are those at depth 1.
+func (x *Expander) template(template parser.Sexpr, depth int, s *scope) (parser.Sexpr, error) {
+	switch t := template.(type) {
+	case *parser.Vector:
+		elements := make([]parser.Sexpr, len(t.Elements))
+		for i, element := range t.Elements {
+			var err error
+			if elements[i], err = x.template(element, depth, s); err != nil {
+				return nil, err
+			}
+		}
+		return &parser.Vector{Elements: elements, Span: t.Span}, nil
+	case *parser.Expr:
+		if isNull(t) {
+			return t, nil
+		}
+
+		if keyword, operands, ok := coreForm(t); ok && len(operands) == 1 {
+			var (
+				operand parser.Sexpr
+				err     error
+			)
+
+			switch {
+			case (keyword == "unquote" || keyword == "unquote-splicing") && depth == 1:
+				operand, err = x.expr(operands[0], s)
+			case keyword == "unquote" || keyword == "unquote-splicing":
+				operand, err = x.template(operands[0], depth-1, s)
+			case keyword == "quasiquote":
+				operand, err = x.template(operands[0], depth+1, s)
+			}
+			if err != nil {
+				return nil, err
+			}
+			if operand != nil {
+				return rebuild(t, []parser.Sexpr{operand}), nil
+			}
+		}
+
+		car, err := x.template(t.Car, depth, s)
+		if err != nil {
+			return nil, err
+		}
+		cdr, err := x.template(t.Cdr, depth, s)
+		if err != nil {
+			return nil, err
+		}
+
+		return &parser.Expr{Car: car, Cdr: cdr, Span: t.Span}, nil
+	default:
+		return template, nil
+	}
+}
+
+// coreForm returns keyword and operands of form if it is non-empty proper
+// list. Keyword is empty unless first element of form is symbol.
+func coreForm(form parser.Sexpr) (string, []parser.Sexpr, bool) {
+	e, ok := form.(*parser.Expr)
+	if !ok || isNull(e) {
+		return "", nil, false
+	}
+
+	operands, ok := list(e.Cdr)
+	if !ok {
+		return "", nil, false
+	}
+
+	keyword, _ := symbolName(e.Car)
+
+	return keyword, operands, true
+}
+
+// rebuild returns form e with operands replaced.
+func rebuild(e *parser.Expr, operands []parser.Sexpr) *parser.Expr {
+	return &parser.Expr{Car: e.Car, Cdr: parser.List(operands...), Span: e.Span}
+}
+
+// withSpan returns list with span of e.
+func withSpan(list *parser.Expr, e *parser.Expr) *parser.Expr {
+	if !isNull(list) {
+		list.Span = e.Span
+	}
+
+	return list
+}
+
+// definedName returns name defined by first of operands of definition or
+// binding, e.g. x of (x 1) or f of (f a b), if there is one.
+func definedName(operands []parser.Sexpr) []string {
+	target := itemAt(operands, 0)
+	if pair, ok := target.(*parser.Expr); ok && !isNull(pair) {
+		target = pair.Car
+	}
+
+	if name, ok := symbolName(target); ok {
+		return []string{name}
+	}
+
+	return nil
+}
+
+// formalNames returns names of lambda formals, which may be symbol or
+// proper or dotted list of symbols.
+func formalNames(formals parser.Sexpr) []string {
+	var names []string
+
+	for {
+		pair, ok := formals.(*parser.Expr)
+		if !ok || isNull(pair) {
+			break
+		}
+		if name, ok := symbolName(pair.Car); ok {
+			names = append(names, name)
+		}
+		formals = pair.Cdr
+	}
+
+	if name, ok := symbolName(formals); ok {
+		names = append(names, name)
+	}
+
+	return names
+}
+
+// list returns elements of proper list s, reporting whether it is one.
+func list(s parser.Sexpr) ([]parser.Sexpr, bool) {
+	var items []parser.Sexpr
+
+	for !isNull(s) {
+		pair, ok := s.(*parser.Expr)
+		if !ok {
+			return nil, false
+		}
+		items = append(items, pair.Car)
+		s = pair.Cdr
+	}
+
+	return items, true
+}
+
+func itemAt(items []parser.Sexpr, i int) parser.Sexpr {
+	if i < len(items) {
+		return items[i]
+	}
+
+	return nil
+}
+
+func isNull(s parser.Sexpr) bool {
+	e, ok := s.(*parser.Expr)
+	return ok && e.Car == nil && e.Cdr == nil
+}
+
+func symbolName(s parser.Sexpr) (string, bool) {
+	if a, ok := s.(*parser.Atom); ok && a.Type == parser.SYMBOL {
+		return (a.Value).(string), true
+	}
+
+	return "", false
+}
@@ -0,0 +1,286 @@
+// Package macro expands uses of syntax-rules macros, defined by
+// define-syntax, let-syntax and letrec-syntax, into core forms, which
+// evaluator knows.
+//
+// Variables bound by templates are renamed at each expansion, so they don't
+// capture variables of macro use, but expansion is not fully hygienic: other
+// identifiers inserted by templates refer to bindings visible where macro is
+// used. Variables bound by program shadow macros of the same names in their
+// scopes.
+package macro
+
+import (
+	"errors"
+	"fmt"
+	"github.com/vkhonin/scheme/parser"
+	"github.com/vkhonin/scheme/rewrite"
+	"strconv"
+)
+
+// MaxExpansions is number of macro uses Expand expands before it reports
+// TOO_MANY_EXPANSIONS, which stops macros expanding endlessly.
+const MaxExpansions = rewrite.MaxRewrites
+
+var (
+	INVALID_MACRO       = errors.New("invalid macro")
+	NO_MATCHING_RULE    = errors.New("no syntax rule matches")
+	TOO_MANY_EXPANSIONS = errors.New("too many macro expansions")
+)
+
+// Expander expands macros of programs. Macros defined at top level of
+// program are kept, so they may be used by programs expanded later, e.g.
+// expressions entered into REPL. Zero value is ready to use.
+type Expander struct {
+	macros     map[string]*macro
+	expansions int
+	renames    int // Expansions renaming variables, which are never reset
+}
+
+// macro is syntax-rules macro, uses of which are rewritten with first of
+// its rules matching them.
+type macro struct {
+	name  string
+	rules []syntaxRule
+}
+
+// syntaxRule is rule of macro with names of its pattern variables.
+type syntaxRule struct {
+	rewrite.Rule
+	variables map[string]bool
+}
+
+// scope is region of program where macros it defines are visible. Nil macro
+// is variable shadowing macro of the same name.
+type scope struct {
+	parent *scope
+	macros map[string]*macro
+}
+
+// Expand returns program with macros expanded and macro definitions
+// removed. Definitions at top level are kept by x. It reports INVALID_MACRO
+// for malformed macro definitions, NO_MATCHING_RULE for macro uses none of
+// rules of macro matches and TOO_MANY_EXPANSIONS if macros expand endlessly.
+// Program is not modified, and is returned as it is if it has nothing to
+// expand.
+func (x *Expander) Expand(program []parser.Sexpr) ([]parser.Sexpr, error) {
+	if len(x.macros) == 0 && !definesSyntax(program) {
+		return program, nil
+	}
+
+	if x.macros == nil {
+		x.macros = make(map[string]*macro)
+	}
+	x.expansions = 0
+
+	return x.body(program, &scope{macros: x.macros})
+}
+
+// definesSyntax reports whether program may define macros, i.e. has any of
+// their keywords.
+func definesSyntax(program []parser.Sexpr) bool {
+	found := false
+
+	for _, datum := range program {
+		parser.Walk(datum, func(s parser.Sexpr) bool {
+			switch name, _ := symbolName(s); name {
+			case "define-syntax", "let-syntax", "letrec-syntax":
+				found = true
+			}
+			return !found
+		})
+	}
+
+	return found
+}
+
+func (s *scope) lookup(name string) *macro {
+	for ; s != nil; s = s.parent {
+		if m, ok := s.macros[name]; ok {
+			return m
+		}
+	}
+
+	return nil
+}
+
+// shadow makes variables names shadow macros in s.
+func (s *scope) shadow(names ...string) {
+	for _, name := range names {
+		s.macros[name] = nil
+	}
+}
+
+func newScope(parent *scope) *scope {
+	return &scope{parent: parent, macros: make(map[string]*macro)}
+}
+
+// body expands body or program, in which macro definitions, also inside
+// begin, define macros in s for rest of it and are removed.
+func (x *Expander) body(body []parser.Sexpr, s *scope) ([]parser.Sexpr, error) {
+	expanded := make([]parser.Sexpr, 0, len(body))
+
+	for _, form := range body {
+		form, err := x.use(form, s)
+		if err != nil {
+			return nil, err
+		}
+
+		keyword, operands, _ := coreForm(form)
+		switch keyword {
+		case "define-syntax":
+			if err := x.defineSyntax(operands, s); err != nil {
+				return nil, err
+			}
+			continue
+		case "begin":
+			items, err := x.body(operands, s)
+			if err != nil {
+				return nil, err
+			}
+			form = rebuild(form.(*parser.Expr), items)
+		default:
+			if keyword == "define" {
+				s.shadow(definedName(operands)...)
+			}
+			if form, err = x.expr(form, s); err != nil {
+				return nil, err
+			}
+		}
+
+		expanded = append(expanded, form)
+	}
+
+	return expanded, nil
+}
+
+// use returns form expanded while it is macro use.
+func (x *Expander) use(form parser.Sexpr, s *scope) (parser.Sexpr, error) {
+	for {
+		e, ok := form.(*parser.Expr)
+		if !ok || isNull(e) {
+			return form, nil
+		}
+
+		name, ok := symbolName(e.Car)
+		if !ok {
+			return form, nil
+		}
+		m := s.lookup(name)
+		if m == nil {
+			return form, nil
+		}
+
+		if x.expansions++; x.expansions > MaxExpansions {
+			return nil, fmt.Errorf("%w: more than %d", TOO_MANY_EXPANSIONS, MaxExpansions)
+		}
+
+		x.renames++
+		expanded, err := m.expand(e, strconv.Itoa(x.renames))
+		if err != nil {
+			return nil, err
+		}
+		form = expanded
+	}
+}
+
+// expand returns use of m rewritten with first rule matching it. Variables
+// bound by template are renamed with suffix, see renamer. Expansion gets span
+// of use, unless it has one already, so errors in it are reported where macro
+// is used.
+func (m *macro) expand(use *parser.Expr, suffix string) (parser.Sexpr, error) {
+	for _, rule := range m.rules {
+		bindings, ok := rule.Match(use)
+		if !ok {
+			continue
+		}
+
+		r := &renamer{variables: rule.variables, suffix: suffix}
+		if template := r.rename(rule.Template, nil); r.renamed {
+			rule.Template = template
+		}
+
+		expanded, err := rule.Expand(bindings)
+		if err != nil {
+			return nil, err
+		}
+
+		if e, ok := expanded.(*parser.Expr); ok && !isNull(e) && e.Span == (parser.Span{}) {
+			e.Span = use.Span
+		}
+
+		return expanded, nil
+	}
+
+	if use.Span != (parser.Span{}) {
+		return nil, fmt.Errorf("%w: %s at %s", NO_MATCHING_RULE, m.name, use.Span.Start)
+	}
+
+	return nil, fmt.Errorf("%w: %s", NO_MATCHING_RULE, m.name)
+}
+
+// defineSyntax defines macro of define-syntax operands in s.
+func (x *Expander) defineSyntax(operands []parser.Sexpr, s *scope) error {
+	if len(operands) != 2 {
+		return fmt.Errorf("%w: define-syntax", INVALID_MACRO)
+	}
+
+	name, ok := symbolName(operands[0])
+	if !ok {
+		return fmt.Errorf("%w: define-syntax", INVALID_MACRO)
+	}
+
+	m, err := syntaxRules(name, operands[1])
+	if err != nil {
+		return err
+	}
+	s.macros[name] = m
+
+	return nil
+}
+
+// syntaxRules returns macro name of transformer spec, which is syntax-rules
+// form. Keyword position of patterns is ignored. Custom ellipsis is not
+// supported.
+func syntaxRules(name string, spec parser.Sexpr) (*macro, error) {
+	keyword, operands, _ := coreForm(spec)
+	if keyword != "syntax-rules" || len(operands) == 0 {
+		return nil, fmt.Errorf("%w: %s: syntax-rules expected", INVALID_MACRO, name)
+	}
+
+	literals, ok := list(operands[0])
+	if !ok {
+		return nil, fmt.Errorf("%w: %s: literals", INVALID_MACRO, name)
+	}
+
+	var names []string
+	for _, literal := range literals {
+		l, ok := symbolName(literal)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s: literals", INVALID_MACRO, name)
+		}
+		names = append(names, l)
+	}
+
+	m := &macro{name: name}
+
+	for _, r := range operands[1:] {
+		rule, ok := list(r)
+		if !ok || len(rule) != 2 {
+			return nil, fmt.Errorf("%w: %s: syntax rule", INVALID_MACRO, name)
+		}
+
+		pattern, ok := rule[0].(*parser.Expr)
+		if !ok || isNull(pattern) {
+			return nil, fmt.Errorf("%w: %s: pattern", INVALID_MACRO, name)
+		}
+
+		rr := rewrite.Rule{Pattern: parser.Cons(parser.Symbol("_"), pattern.Cdr), Template: rule[1], Literals: names}
+		if err := rr.Check(); err != nil {
+			return nil, fmt.Errorf("%w: %s: %w", INVALID_MACRO, name, err)
+		}
+
+		m.rules = append(m.rules, syntaxRule{Rule: rr, variables: patternVariables(rr.Pattern, names)})
+	}
+
+	return m, nil
+}
@@ -0,0 +1,135 @@
+package macro_test
+
+import (
+	"errors"
+	"github.com/vkhonin/scheme/macro"
+	"github.com/vkhonin/scheme/parser"
+	"github.com/vkhonin/scheme/printer"
+	"github.com/vkhonin/scheme/rewrite"
+	"strings"
+	"testing"
+)
+
+const swap = "(define-syntax swap! (syntax-rules () ((_ a b) (let ((tmp a)) (set! a b) (set! b tmp)))))\n"
+
+func TestExpander_Expand(t *testing.T) {
+	testCases := []struct {
+		Input  string
+		Output string
+	}{
+		{"(define x 1) (car '(1))", "(define x 1)\n(car (quote (1)))"},
+		{swap + "(swap! x y)", "(let ((|tmp#1| x)) (set! x y) (set! y |tmp#1|))"},
+		{swap + "(define (f a b) (swap! a b) (list a b))", "(define (f a b) (let ((|tmp#1| a)) (set! a b) (set! b |tmp#1|)) (list a b))"},
+		{swap + "'(swap! x y)", "(quote (swap! x y))"},
+		{swap + "`(swap! ,(swap! x y) (unquote-splicing (list 1)))", "(quasiquote (swap! (unquote (let ((|tmp#1| x)) (set! x y) (set! y |tmp#1|))) (unquote-splicing (list 1))))"},
+		{swap + "(lambda (swap!) (swap! 1 2))", "(lambda (swap!) (swap! 1 2))"},
+		{swap + "(let loop ((swap! 1)) (swap! x y))", "(let loop ((swap! 1)) (swap! x y))"},
+		{swap + "(define swap! list) (swap! x y)", "(define swap! list)\n(swap! x y)"},
+		{
+			"(define-syntax my-or (syntax-rules () ((_) #f) ((_ e) e) ((_ e r ...) (let ((t e)) (if t t (my-or r ...))))))\n(my-or a b c)",
+			"(let ((|t#1| a)) (if |t#1| |t#1| (let ((|t#2| b)) (if |t#2| |t#2| c))))",
+		},
+		{
+			"(define-syntax my-or (syntax-rules () ((_ a b) (let ((t a)) (if t t b)))))\n(let ((t 5)) (my-or #f t))",
+			"(let ((t 5)) (let ((|t#1| #f)) (if |t#1| |t#1| t)))",
+		},
+		{
+			"(define-syntax f (syntax-rules () ((_ e) (lambda (x . r) (define (g y) (list 'x `(x ,x ,y) e)) (let* ((x 1) (z x)) (do ((i z (+ i 1))) (i e)))))))\n(f x)",
+			"(lambda (|x#1| . |r#1|) (define (|g#1| |y#1|) (list (quote x) (quasiquote (x (unquote |x#1|) (unquote |y#1|))) x)) " +
+				"(let* ((|x#1| 1) (|z#1| |x#1|)) (do ((|i#1| |z#1| (+ |i#1| 1))) (|i#1| x))))",
+		},
+		{
+			"(define-syntax for (syntax-rules (in) ((_ x in lst body ...) (for-each (lambda (x) body ...) lst))))\n(for x in '(1 2) (display x))",
+			"(for-each (lambda (x) (display x)) (quote (1 2)))",
+		},
+		{
+			"(let-syntax ((twice (syntax-rules () ((_ e) (begin e e))))) (twice (f)))\n(twice (f))",
+			"(let () (begin (f) (f)))\n(twice (f))",
+		},
+		{
+			"(define (f) (define-syntax one (syntax-rules () ((_) 1))) (one))\n(one)",
+			"(define (f) 1)\n(one)",
+		},
+		{
+			"(begin (define-syntax one (syntax-rules () ((_) 1))) (one))",
+			"(begin 1)",
+		},
+		{
+			swap + "(cond ((swap! a b) => f) (else (swap! a b)))\n(case (swap! a b) ((swap!) (swap! a b)))",
+			"(cond ((let ((|tmp#1| a)) (set! a b) (set! b |tmp#1|)) => f) (else (let ((|tmp#2| a)) (set! a b) (set! b |tmp#2|))))\n" +
+				"(case (let ((|tmp#3| a)) (set! a b) (set! b |tmp#3|)) ((swap!) (let ((|tmp#4| a)) (set! a b) (set! b |tmp#4|))))",
+		},
+	}
+
+	for _, c := range testCases {
+		program, err := parser.ParseString(c.Input)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var x macro.Expander
+		expanded, err := x.Expand(program)
+		if err != nil {
+			t.Errorf("unexpected error %v for %s", err, c.Input)
+			continue
+		}
+
+		var output []string
+		for _, datum := range expanded {
+			output = append(output, printer.Write(datum))
+		}
+		if strings.Join(output, "\n") != c.Output {
+			t.Errorf("expected\n%s\ngot\n%s", c.Output, strings.Join(output, "\n"))
+		}
+	}
+}
+
+func TestExpander_Expand_Kept(t *testing.T) {
+	var x macro.Expander
+
+	for _, src := range []string{swap, "(swap! x y)"} {
+		program, err := parser.ParseString(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expanded, err := x.Expand(program)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if src == swap && len(expanded) != 0 {
+			t.Errorf("expected definition removed, got %v", expanded)
+		}
+		if src != swap && (len(expanded) != 1 || printer.Write(expanded[0]) != "(let ((|tmp#1| x)) (set! x y) (set! y |tmp#1|))") {
+			t.Errorf("expected macro defined earlier expanded, got %v", expanded)
+		}
+	}
+}
+
+func TestExpander_Expand_Errors(t *testing.T) {
+	testCases := []struct {
+		Input string
+		Err   error
+	}{
+		{"(define-syntax one (syntax-rules () ((_) 1))) (one 2)", macro.NO_MATCHING_RULE},
+		{"(define-syntax one (lambda (x) x))", macro.INVALID_MACRO},
+		{"(define-syntax one (syntax-rules (1) ((_) 1)))", macro.INVALID_MACRO},
+		{"(define-syntax one (syntax-rules () (_ 1)))", macro.INVALID_MACRO},
+		{"(define-syntax one (syntax-rules () ((_ a) (a ...))))", rewrite.INVALID_TEMPLATE},
+		{"(let-syntax (one) 1)", macro.INVALID_MACRO},
+		{"(define-syntax loop (syntax-rules () ((_ x) (loop x)))) (loop 1)", macro.TOO_MANY_EXPANSIONS},
+	}
+
+	for _, c := range testCases {
+		program, err := parser.ParseString(c.Input)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var x macro.Expander
+		if _, err := x.Expand(program); !errors.Is(err, c.Err) {
+			t.Errorf("expected error %v got %v for %s", c.Err, err, c.Input)
+		}
+	}
+}
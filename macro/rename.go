@@ -0,0 +1,271 @@
+package macro
+
+import (
+	"github.com/vkhonin/scheme/parser"
+)
+
+const ellipsis = "..."
+
+// renamer renames variables template binds, so they don't capture variables
+// of macro use, which may be inserted into their scope by pattern variables.
+// Variables are bound by lambda, let forms, do and definitions in bodies of
+// those. Pattern variables, which are replaced by data of macro use, and
+// quoted data, except unquoted parts of quasiquote, are never renamed.
+type renamer struct {
+	variables map[string]bool
+	suffix    string
+	renamed   bool
+}
+
+// rename returns template with variables bound in it renamed, where names
+// maps variables of enclosing scopes to their new names. Fresh name is
+// variable name followed by # and suffix, which reader never produces, so
+// it can't be name of variable of macro use. Template is not modified.
+func (r *renamer) rename(template parser.Sexpr, names map[string]string) parser.Sexpr {
+	switch t := template.(type) {
+	case *parser.Atom:
+		if name, ok := symbolName(t); ok {
+			if fresh, ok := names[name]; ok {
+				r.renamed = true
+				return parser.Symbol(fresh)
+			}
+		}
+		return t
+	case *parser.Expr:
+		if isNull(t) {
+			return t
+		}
+
+		keyword, operands, ok := coreForm(t)
+		if _, local := names[keyword]; !ok || local {
+			return r.pairs(t, names)
+		}
+
+		switch keyword {
+		case "quote":
+			return t
+		case "quasiquote":
+			return r.quasiquote(t, 0, names)
+		case "lambda":
+			if len(operands) > 0 {
+				inner := r.bind(names, formalNames(operands[0]), operands[1:])
+				return rebuild(t, append([]parser.Sexpr{r.pairs(operands[0], inner)}, r.body(operands[1:], inner)...))
+			}
+		case "define":
+			if target, ok := itemAt(operands, 0).(*parser.Expr); ok && !isNull(target) {
+				inner := r.bind(names, formalNames(target.Cdr), operands[1:])
+				target = &parser.Expr{Car: r.rename(target.Car, names), Cdr: r.pairs(target.Cdr, inner), Span: target.Span}
+				return rebuild(t, append([]parser.Sexpr{target}, r.body(operands[1:], inner)...))
+			}
+		case "let", "let*", "letrec", "letrec*":
+			if renamed, ok := r.let(t, keyword, operands, names); ok {
+				return renamed
+			}
+		case "do":
+			if renamed, ok := r.do(t, operands, names); ok {
+				return renamed
+			}
+		}
+
+		return r.pairs(t, names)
+	default:
+		return template
+	}
+}
+
+// pairs renames elements of list, which may be improper, as expressions.
+func (r *renamer) pairs(s parser.Sexpr, names map[string]string) parser.Sexpr {
+	e, ok := s.(*parser.Expr)
+	if !ok || isNull(e) {
+		return r.rename(s, names)
+	}
+
+	return &parser.Expr{Car: r.rename(e.Car, names), Cdr: r.pairs(e.Cdr, names), Span: e.Span}
+}
+
+// quasiquote renames unquoted parts of quasiquote template s, which is
+// nested in depth quasiquotes.
+func (r *renamer) quasiquote(s parser.Sexpr, depth int, names map[string]string) parser.Sexpr {
+	switch t := s.(type) {
+	case *parser.Vector:
+		elements := make([]parser.Sexpr, len(t.Elements))
+		for i, element := range t.Elements {
+			elements[i] = r.quasiquote(element, depth, names)
+		}
+		return &parser.Vector{Elements: elements}
+	case *parser.Expr:
+		if isNull(t) {
+			return t
+		}
+
+		switch keyword, operands, _ := coreForm(t); keyword {
+		case "quasiquote":
+			depth++
+		case "unquote", "unquote-splicing":
+			if depth--; depth == 0 && len(operands) == 1 {
+				return rebuild(t, []parser.Sexpr{r.rename(operands[0], names)})
+			}
+		}
+
+		return &parser.Expr{Car: r.quasiquote(t.Car, depth, names), Cdr: r.quasiquoteTail(t.Cdr, depth, names), Span: t.Span}
+	default:
+		return s
+	}
+}
+
+// quasiquoteTail renames unquoted parts of rest of quasiquote template list.
+func (r *renamer) quasiquoteTail(s parser.Sexpr, depth int, names map[string]string) parser.Sexpr {
+	e, ok := s.(*parser.Expr)
+	if !ok || isNull(e) {
+		return r.quasiquote(s, depth, names)
+	}
+
+	return &parser.Expr{Car: r.quasiquote(e.Car, depth, names), Cdr: r.quasiquoteTail(e.Cdr, depth, names), Span: e.Span}
+}
+
+func (r *renamer) body(body []parser.Sexpr, names map[string]string) []parser.Sexpr {
+	renamed := make([]parser.Sexpr, len(body))
+	for i, form := range body {
+		renamed[i] = r.rename(form, names)
+	}
+
+	return renamed
+}
+
+// bind returns names extended with fresh names of variables and of those
+// defined by body.
+func (r *renamer) bind(names map[string]string, variables []string, body []parser.Sexpr) map[string]string {
+	for _, form := range body {
+		if keyword, operands, _ := coreForm(form); keyword == "define" {
+			variables = append(variables, definedName(operands)...)
+		}
+	}
+
+	var inner map[string]string
+	for _, v := range variables {
+		if r.variables[v] || v == ellipsis {
+			continue
+		}
+		if inner == nil {
+			inner = make(map[string]string, len(names)+len(variables))
+			for name, fresh := range names {
+				inner[name] = fresh
+			}
+		}
+		inner[v] = v + "#" + r.suffix
+	}
+
+	if inner == nil {
+		return names
+	}
+
+	return inner
+}
+
+// let renames let form e, reporting false if it is malformed. Initializers
+// of let are in scope of enclosing variables, those of let* in scope of
+// variables bound before and those of letrec in scope of all variables.
+func (r *renamer) let(e *parser.Expr, keyword string, operands []parser.Sexpr, names map[string]string) (parser.Sexpr, bool) {
+	var name parser.Sexpr
+	if _, ok := symbolName(itemAt(operands, 0)); ok && keyword == "let" {
+		name, operands = operands[0], operands[1:]
+	}
+
+	if len(operands) == 0 {
+		return nil, false
+	}
+
+	bindings, ok := list(operands[0])
+	if !ok {
+		return nil, false
+	}
+
+	var variables []string
+	for _, b := range bindings {
+		if binding, ok := list(b); ok {
+			variables = append(variables, definedName(binding)...)
+		}
+	}
+
+	inner := r.bind(names, append(definedName([]parser.Sexpr{name}), variables...), operands[1:])
+	scope := names
+	if keyword == "letrec" || keyword == "letrec*" {
+		scope = inner
+	}
+
+	renamed := make([]parser.Sexpr, len(bindings))
+	for i, b := range bindings {
+		binding, ok := list(b)
+		if !ok || len(binding) != 2 {
+			renamed[i] = r.rename(b, scope)
+			continue
+		}
+
+		renamed[i] = withSpan(parser.List(r.rename(binding[0], inner), r.rename(binding[1], scope)), b.(*parser.Expr))
+		if keyword == "let*" {
+			scope = r.bind(scope, definedName(binding), nil)
+		}
+	}
+
+	var head []parser.Sexpr
+	if name != nil {
+		head = append(head, r.rename(name, inner))
+	}
+
+	return rebuild(e, append(append(head, parser.List(renamed...)), r.body(operands[1:], inner)...)), true
+}
+
+// do renames do loop e, reporting false if it is malformed. Initializers
+// are in scope of enclosing variables, steps, exit clause and commands in
+// scope of loop variables.
+func (r *renamer) do(e *parser.Expr, operands []parser.Sexpr, names map[string]string) (parser.Sexpr, bool) {
+	if len(operands) < 2 {
+		return nil, false
+	}
+
+	specs, ok := list(operands[0])
+	if !ok {
+		return nil, false
+	}
+
+	var variables []string
+	for _, sp := range specs {
+		if spec, ok := list(sp); ok {
+			variables = append(variables, definedName(spec)...)
+		}
+	}
+	inner := r.bind(names, variables, nil)
+
+	renamed := make([]parser.Sexpr, len(specs))
+	for i, sp := range specs {
+		spec, ok := list(sp)
+		if !ok || len(spec) < 2 {
+			renamed[i] = r.rename(sp, inner)
+			continue
+		}
+
+		items := []parser.Sexpr{r.rename(spec[0], inner), r.rename(spec[1], names)}
+		renamed[i] = withSpan(parser.List(append(items, r.body(spec[2:], inner)...)...), sp.(*parser.Expr))
+	}
+
+	return rebuild(e, append([]parser.Sexpr{parser.List(renamed...), r.pairs(operands[1], inner)}, r.body(operands[2:], inner)...)), true
+}
+
+// patternVariables returns names of pattern variables of pattern, which are
+// its symbols except literals, underscore and ellipsis.
+func patternVariables(pattern parser.Sexpr, literals []string) map[string]bool {
+	variables := make(map[string]bool)
+
+	parser.Walk(pattern, func(s parser.Sexpr) bool {
+		if name, ok := symbolName(s); ok && name != "_" && name != ellipsis {
+			variables[name] = true
+		}
+		return true
+	})
+
+	for _, l := range literals {
+		delete(variables, l)
+	}
+
+	return variables
+}
@@ -0,0 +1,174 @@
+package scheme
+
+import (
+	"errors"
+	"fmt"
+	"github.com/vkhonin/scheme/eval"
+	"github.com/vkhonin/scheme/parser"
+	"reflect"
+)
+
+var (
+	NO_SUCH_MEMBER = errors.New("no such field or method")
+)
+
+// Object is Go value Value does not convert to datum, e.g. struct or value
+// with methods, which scripts drive with procedures:
+//
+//	(go-object? obj)                     whether obj is Go value
+//	(go-field obj 'Name)                 value of exported field
+//	(go-set-field! obj 'Name value)      sets exported field
+//	(go-call obj 'Method arg ...)        calls exported method
+//
+// Names of fields and methods are symbols or strings. Arguments and values
+// are converted as for procedures of DefineFunc. Structs are held by pointers,
+// so their fields may be set and methods with pointer receivers called, and
+// fields of nested structs are objects sharing them.
+type Object struct {
+	value reflect.Value
+}
+
+// Value returns Go value of object, which is pointer for structs.
+func (o *Object) Value() any {
+	return o.value.Interface()
+}
+
+// Equals reports whether objects hold the same Go value, e.g. pointers to
+// the same struct, which equal? compares. Objects are created as values are
+// converted, so eqv? tells apart objects of the same value.
+func (o *Object) Equals(s parser.Sexpr) bool {
+	o2, ok := s.(*Object)
+	return ok && o.value.Type() == o2.value.Type() && o.value.Comparable() && o.value.Equal(o2.value)
+}
+
+func (o *Object) String() string {
+	return fmt.Sprintf("#<go %v>", o.value.Type())
+}
+
+var objectProcedures = []*eval.Builtin{
+	{Name: "go-object?", MinArgs: 1, MaxArgs: 1, Fn: builtinIsObject},
+	{Name: "go-field", MinArgs: 2, MaxArgs: 2, Fn: builtinField},
+	{Name: "go-set-field!", MinArgs: 3, MaxArgs: 3, Fn: builtinSetField},
+	{Name: "go-call", MinArgs: 2, MaxArgs: -1, Fn: builtinCall},
+}
+
+func builtinIsObject(_ *eval.Evaluator, args []parser.Sexpr) (parser.Sexpr, error) {
+	_, ok := args[0].(*Object)
+	return parser.Bool(ok), nil
+}
+
+func builtinField(_ *eval.Evaluator, args []parser.Sexpr) (parser.Sexpr, error) {
+	f, err := field(args[0], args[1])
+	if err != nil {
+		return nil, err
+	}
+
+	if f.Kind() == reflect.Struct && f.CanAddr() {
+		return &Object{value: f.Addr()}, nil
+	}
+
+	return Value(f.Interface())
+}
+
+func builtinSetField(_ *eval.Evaluator, args []parser.Sexpr) (parser.Sexpr, error) {
+	f, err := field(args[0], args[1])
+	if err != nil {
+		return nil, err
+	}
+
+	if !f.CanSet() {
+		return nil, fmt.Errorf("%w: field %v of %v is not settable", NO_SUCH_MEMBER, args[1], args[0])
+	}
+
+	v, err := Decode(args[2], f.Type())
+	if err != nil {
+		return nil, err
+	}
+	f.Set(v)
+
+	return eval.Unspecified, nil
+}
+
+func builtinCall(ev *eval.Evaluator, args []parser.Sexpr) (parser.Sexpr, error) {
+	o, name, err := member(args[0], args[1])
+	if err != nil {
+		return nil, err
+	}
+
+	m := o.value.MethodByName(name)
+	if !m.IsValid() {
+		return nil, fmt.Errorf("%w: method %s of %v", NO_SUCH_MEMBER, name, o)
+	}
+
+	c, err := callerOf(m.Type())
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+
+	if n := len(args) - 2; n < c.minArgs || (c.maxArgs >= 0 && n > c.maxArgs) {
+		return nil, fmt.Errorf("%w: %s called with %d", eval.WRONG_ARITY, name, n)
+	}
+
+	return c.call(ev, m, args[2:])
+}
+
+// member returns object and name of its member, which is symbol or string.
+func member(obj, name parser.Sexpr) (*Object, string, error) {
+	o, ok := obj.(*Object)
+	if !ok {
+		return nil, "", fmt.Errorf("%w: Go object expected, got %v", eval.WRONG_TYPE, obj)
+	}
+
+	a, ok := name.(*parser.Atom)
+	if !ok || (a.Type != parser.SYMBOL && a.Type != parser.STRING) {
+		return nil, "", fmt.Errorf("%w: symbol or string expected, got %v", eval.WRONG_TYPE, name)
+	}
+
+	return o, (a.Value).(string), nil
+}
+
+// field returns exported field name of struct object obj.
+func field(obj, name parser.Sexpr) (reflect.Value, error) {
+	o, n, err := member(obj, name)
+	if err != nil {
+		return reflect.Value{}, err
+	}
+
+	v := o.value
+	if v.Kind() == reflect.Pointer {
+		v = v.Elem()
+	}
+
+	if v.Kind() == reflect.Struct {
+		if sf, ok := v.Type().FieldByName(n); ok && sf.IsExported() {
+			if f, err := v.FieldByIndexErr(sf.Index); err == nil {
+				return f, nil
+			}
+		}
+	}
+
+	return reflect.Value{}, fmt.Errorf("%w: field %s of %v", NO_SUCH_MEMBER, n, o)
+}
+
+// objectValue returns Go value of object datum as value of type t, reporting
+// whether datum is object of value assignable to t. Structs are copied.
+func objectValue(datum parser.Sexpr, t reflect.Type) (reflect.Value, bool) {
+	o, ok := datum.(*Object)
+	if !ok {
+		return reflect.Value{}, false
+	}
+
+	v := o.value
+	if v.Kind() == reflect.Pointer && v.Type().Elem() == t && t.Kind() != reflect.Interface {
+		v = v.Elem()
+	}
+
+	if !v.Type().AssignableTo(t) {
+		return reflect.Value{}, false
+	}
+
+	r := reflect.New(t).Elem()
+	r.Set(v)
+
+	return r, true
+}
@@ -0,0 +1,156 @@
+package scheme_test
+
+import (
+	"errors"
+	"fmt"
+	"github.com/vkhonin/scheme"
+	"github.com/vkhonin/scheme/eval"
+	"github.com/vkhonin/scheme/printer"
+	"testing"
+)
+
+type address struct {
+	City string
+}
+
+type account struct {
+	Owner   string
+	Balance int
+	Tags    []string
+	Limits  map[string]int
+	Address address
+	Parent  *account
+
+	audit []string
+}
+
+var errOverdrawn = errors.New("overdrawn")
+
+func (a *account) Deposit(amounts ...int) int {
+	for _, n := range amounts {
+		a.Balance += n
+	}
+	return a.Balance
+}
+
+func (a *account) Withdraw(n int) error {
+	if n > a.Balance {
+		return errOverdrawn
+	}
+	a.Balance -= n
+	return nil
+}
+
+func (a account) Summary() string {
+	return fmt.Sprintf("%s: %d", a.Owner, a.Balance)
+}
+
+func (a *account) Open(owner string) account {
+	return account{Owner: owner, Parent: a}
+}
+
+func (a *account) Merge(other *account) {
+	a.Balance += other.Balance
+	other.Balance = 0
+}
+
+func newObjectInterp(t *testing.T, options ...scheme.Option) (*scheme.Interp, *account) {
+	acct := &account{Owner: "ann", Balance: 10, Tags: []string{"a", "b"}, Limits: map[string]int{"day": 100}, Address: address{City: "Riga"}}
+
+	interp := scheme.New(options...)
+	if err := interp.Define("acct", acct); err != nil {
+		t.Fatal(err)
+	}
+
+	return interp, acct
+}
+
+func TestObject(t *testing.T) {
+	testCases := []struct {
+		Input  string
+		Output string
+	}{
+		{"(list (go-object? acct) (go-object? 1))", "(#t #f)"},
+		{"(list (go-field acct 'Owner) (go-field acct \"Balance\") (go-field acct 'Tags) (go-field acct 'Limits))", `("ann" 10 ("a" "b") (("day" . 100)))`},
+		{"(go-field acct 'Parent)", "()"},
+		{"(go-field acct 'Address)", "#<go *scheme_test.address>"},
+		{"(go-field (go-field acct 'Address) 'City)", `"Riga"`},
+		{"(go-set-field! (go-field acct 'Address) 'City \"Oslo\") (go-field (go-field acct 'Address) 'City)", `"Oslo"`},
+		{"(go-set-field! acct 'Tags #(\"x\")) (go-set-field! acct 'Limits '((\"week\" . 5))) (list (go-field acct 'Tags) (go-field acct 'Limits))", `(("x") (("week" . 5)))`},
+		{"(list (go-call acct 'Deposit 5 5) (go-call acct 'Summary))", `(20 "ann: 20")`},
+		{"(go-call acct 'Deposit)", "10"},
+		{"(guard (e ((error-object? e) (error-object-message e))) (go-call acct 'Withdraw 100))", `"overdrawn"`},
+		{"(define sub (go-call acct 'Open \"bob\")) (list (go-field sub 'Owner) (equal? (go-field sub 'Parent) acct))", `("bob" #t)`},
+		{"(define sub (go-call acct 'Open \"bob\")) (go-call sub 'Deposit 7) (go-call acct 'Merge sub) (list (go-field acct 'Balance) (go-field sub 'Balance))", "(17 0)"},
+	}
+
+	for _, options := range [][]scheme.Option{nil, {scheme.WithVM()}} {
+		for _, c := range testCases {
+			interp, _ := newObjectInterp(t, options...)
+
+			result, err := interp.EvalString(c.Input)
+			if err != nil {
+				t.Errorf("unexpected error %v for %s", err, c.Input)
+				continue
+			}
+
+			if printer.Write(result) != c.Output {
+				t.Errorf("expected %s got %s for %s", c.Output, printer.Write(result), c.Input)
+			}
+		}
+	}
+}
+
+func TestObject_Shared(t *testing.T) {
+	interp, acct := newObjectInterp(t)
+
+	if _, err := interp.EvalString("(go-set-field! acct 'Balance 42) (go-call acct 'Withdraw 2)"); err != nil {
+		t.Fatal(err)
+	}
+
+	if acct.Balance != 40 {
+		t.Errorf("expected balance of Go value set by script, got %d", acct.Balance)
+	}
+
+	if err := interp.DefineFunc("balance", func(a *account) int { return a.Balance }); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := interp.EvalString("(balance acct)")
+	if err != nil || printer.Write(result) != "40" {
+		t.Errorf("expected 40 got %v, %v", result, err)
+	}
+}
+
+func TestObject_Errors(t *testing.T) {
+	testCases := []struct {
+		Input string
+		Err   error
+	}{
+		{"(go-call acct 'Withdraw 100)", errOverdrawn},
+		{"(go-field acct 'Missing)", scheme.NO_SUCH_MEMBER},
+		{"(go-field acct 'audit)", scheme.NO_SUCH_MEMBER},
+		{"(go-field (go-call acct 'Open \"bob\") 'Parent)", nil},
+		{"(go-field (go-field acct 'Parent) 'Owner)", eval.WRONG_TYPE},
+		{"(go-call acct 'Missing)", scheme.NO_SUCH_MEMBER},
+		{"(go-call acct 'Withdraw)", eval.WRONG_ARITY},
+		{"(go-call acct 'Withdraw \"1\")", eval.WRONG_TYPE},
+		{"(go-call acct 'Merge 1)", eval.WRONG_TYPE},
+		{"(go-set-field! acct 'Balance \"1\")", eval.WRONG_TYPE},
+		{"(go-set-field! acct 'Limits '(1))", eval.WRONG_TYPE},
+		{"(go-field 1 'Owner)", eval.WRONG_TYPE},
+		{"(go-field acct 1)", eval.WRONG_TYPE},
+	}
+
+	for _, c := range testCases {
+		interp, _ := newObjectInterp(t)
+
+		_, err := interp.EvalString(c.Input)
+		if c.Err == nil && err != nil {
+			t.Errorf("unexpected error %v for %s", err, c.Input)
+		}
+		if c.Err != nil && !errors.Is(err, c.Err) {
+			t.Errorf("expected error %v got %v for %s", c.Err, err, c.Input)
+		}
+	}
+}
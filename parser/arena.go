@@ -0,0 +1,86 @@
+package parser
+
+// arenaChunkSize is number of pairs or atoms arena allocates at once.
+const arenaChunkSize = 1024
+
+// Arena allocates pairs and atoms of data parser reads in chunks, so reading
+// large source takes few allocations. Released arena reuses its chunks, so
+// data allocated in it must not be used after Release.
+type Arena struct {
+	pairs [][]Expr
+	atoms [][]Atom
+
+	// pairsUsed and atomsUsed are numbers of pairs and atoms allocated.
+	pairsUsed int
+	atomsUsed int
+}
+
+// WithArena makes p allocate data it reads in arena it returns, which is
+// new unless p has one already.
+func (p *Parser) WithArena() *Arena {
+	if p.arena == nil {
+		p.arena = &Arena{}
+	}
+
+	return p.arena
+}
+
+// Release makes memory of data allocated in a available for reuse.
+func (a *Arena) Release() {
+	for i := 0; i*arenaChunkSize < a.pairsUsed; i++ {
+		clear(a.pairs[i])
+	}
+	for i := 0; i*arenaChunkSize < a.atomsUsed; i++ {
+		clear(a.atoms[i])
+	}
+
+	a.pairsUsed, a.atomsUsed = 0, 0
+}
+
+func (a *Arena) newPair() *Expr {
+	chunk, i := a.pairsUsed/arenaChunkSize, a.pairsUsed%arenaChunkSize
+	if chunk == len(a.pairs) {
+		a.pairs = append(a.pairs, make([]Expr, arenaChunkSize))
+	}
+
+	a.pairsUsed++
+
+	return &a.pairs[chunk][i]
+}
+
+func (a *Arena) newAtom() *Atom {
+	chunk, i := a.atomsUsed/arenaChunkSize, a.atomsUsed%arenaChunkSize
+	if chunk == len(a.atoms) {
+		a.atoms = append(a.atoms, make([]Atom, arenaChunkSize))
+	}
+
+	a.atomsUsed++
+
+	return &a.atoms[chunk][i]
+}
+
+// newPair returns new empty immutable pair, allocated in arena of p if it
+// has one.
+func (p *Parser) newPair() *Expr {
+	if p.arena == nil {
+		return &Expr{Immutable: true}
+	}
+
+	pair := p.arena.newPair()
+	pair.Immutable = true
+
+	return pair
+}
+
+// newAtom returns new atom of type t and value, allocated in arena of p if
+// it has one.
+func (p *Parser) newAtom(t AtomType, value interface{}) *Atom {
+	if p.arena == nil {
+		return &Atom{Type: t, Value: value}
+	}
+
+	atom := p.arena.newAtom()
+	atom.Type, atom.Value = t, value
+
+	return atom
+}
@@ -0,0 +1,98 @@
+package parser_test
+
+import (
+	"github.com/vkhonin/scheme/lexer"
+	"github.com/vkhonin/scheme/parser"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+var benchmarkSource = strings.Repeat(`; compute factorial
+(define (fact n)
+  (if (= n 0) 1 (* n (fact (- n 1)))))
+(display "factorial of 20 is ") (fact 20) #\space #(1 2.5 #xff) '(a . b) #t
+`, 1000)
+
+func TestParser_WithArena(t *testing.T) {
+	tokens := lexTokens(t, benchmarkSource)
+
+	p := parser.Parser{Tokens: tokens}
+	expected, err := p.Parse()
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	p = parser.Parser{Tokens: tokens}
+	arena := p.WithArena()
+	if p.WithArena() != arena {
+		t.Error("expected parser to keep its arena")
+	}
+
+	for range 2 {
+		actual, err := p.Parse()
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+
+		if parser.Write(parser.List(actual...)) != parser.Write(parser.List(expected...)) {
+			t.Error("expected data read in arena to be equal to data read without it")
+		}
+
+		arena.Release()
+	}
+
+	p = parser.Parser{Tokens: lexTokens(t, "#0=(a . #0#) '() #(1 \"s\")")}
+	p.WithArena()
+	data, err := p.Parse()
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if actual := parser.Write(parser.List(data...)); actual != "(#0=(a . #0#) (quote ()) #(1 \"s\"))" {
+		t.Errorf("unexpected data read in arena %s", actual)
+	}
+}
+
+func benchmarkParser(b *testing.B, withArena bool) {
+	var tokens []lexer.Token
+	for token, err := range lexer.NewFromString(benchmarkSource).Tokens() {
+		if err != nil {
+			b.Fatal(err)
+		}
+		tokens = append(tokens, token)
+	}
+
+	p := parser.Parser{Tokens: tokens}
+	var arena *parser.Arena
+	if withArena {
+		arena = p.WithArena()
+	}
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+
+	b.ReportAllocs()
+	b.SetBytes(int64(len(benchmarkSource)))
+	b.ResetTimer()
+
+	for range b.N {
+		if _, err := p.Parse(); err != nil {
+			b.Fatal(err)
+		}
+		if arena != nil {
+			arena.Release()
+		}
+	}
+
+	b.StopTimer()
+	runtime.ReadMemStats(&after)
+	b.ReportMetric(float64(after.NumGC-before.NumGC)/float64(b.N), "gc/op")
+}
+
+func BenchmarkParser(b *testing.B) {
+	benchmarkParser(b, false)
+}
+
+func BenchmarkParser_WithArena(b *testing.B) {
+	benchmarkParser(b, true)
+}
@@ -0,0 +1,121 @@
+package parser
+
+import (
+	"errors"
+	"github.com/vkhonin/scheme/parser/number"
+	"math/big"
+)
+
+var (
+	NOT_A_LIST = errors.New("proper list expected")
+)
+
+// List returns proper list of items, which is Nil if there are none.
+func List(items ...Sexpr) *Expr {
+	list := Nil
+
+	for i := len(items) - 1; i >= 0; i-- {
+		list = &Expr{Car: items[i], Cdr: list}
+	}
+
+	return list
+}
+
+// Cons returns new pair of car and cdr.
+func Cons(car, cdr Sexpr) *Expr {
+	return &Expr{Car: car, Cdr: cdr}
+}
+
+func Symbol(name string) *Atom {
+	return &Atom{Type: SYMBOL, Value: name}
+}
+
+func Str(s string) *Atom {
+	return &Atom{Type: STRING, Value: s}
+}
+
+func Bool(b bool) *Atom {
+	return &Atom{Type: BOOL, Value: b}
+}
+
+func Char(r rune) *Atom {
+	return &Atom{Type: CHAR, Value: r}
+}
+
+func Num(n *number.Number) *Atom {
+	return &Atom{Type: NUMBER, Value: n}
+}
+
+// Int returns exact integer i.
+func Int(i int64) *Atom {
+	return Num(number.NewFromInt(big.NewInt(i)))
+}
+
+// Float returns inexact real f.
+func Float(f float64) *Atom {
+	return Num(number.NewFromValue(complex(f, 0), true))
+}
+
+// Length returns number of elements of proper list s. It reports NOT_A_LIST
+// for improper and cyclic lists and for anything but list.
+func Length(s Sexpr) (int, error) {
+	length := 0
+
+	// Slow moves one pair per two pairs s moves, so they meet in cycle.
+	slow := s
+
+	for ; ; length++ {
+		pair, ok := s.(*Expr)
+		if !ok {
+			return 0, NOT_A_LIST
+		}
+		if isNull(pair) {
+			return length, nil
+		}
+
+		s = pair.Cdr
+
+		if length%2 == 1 {
+			slow = slow.(*Expr).Cdr
+			if slow == s {
+				return 0, NOT_A_LIST
+			}
+		}
+	}
+}
+
+// ToSlice returns elements of proper list s. It reports NOT_A_LIST as
+// Length does.
+func ToSlice(s Sexpr) ([]Sexpr, error) {
+	length, err := Length(s)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]Sexpr, length)
+
+	for i := range items {
+		pair := s.(*Expr)
+		items[i], s = pair.Car, pair.Cdr
+	}
+
+	return items, nil
+}
+
+// IsImmutable reports whether s is literal that must not be modified, i.e.
+// pair, vector, bytevector or string with Immutable set, or empty list.
+// Mutation procedures, e.g. set-car!, should report error for such data.
+func IsImmutable(s Sexpr) bool {
+	switch s := s.(type) {
+	case *Expr:
+		return s.Immutable || isNull(s)
+	case *Vector:
+		return s.Immutable
+	case *Bytevector:
+		return s.Immutable
+	case *Atom:
+		return s.Type == STRING && s.Immutable
+	}
+
+	return false
+}
@@ -0,0 +1,100 @@
+package parser_test
+
+import (
+	"errors"
+	"github.com/vkhonin/scheme/parser"
+	"testing"
+)
+
+func TestConstructors(t *testing.T) {
+	testCases := map[string]parser.Sexpr{
+		"()":                   parser.List(),
+		`(a "b" #t #\c 1 2.5)`: parser.List(parser.Symbol("a"), parser.Str("b"), parser.Bool(true), parser.Char('c'), parser.Int(1), parser.Float(2.5)),
+		"(a . b)":              parser.Cons(parser.Symbol("a"), parser.Symbol("b")),
+		"((1) #f)":             parser.List(parser.List(parser.Int(1)), parser.Bool(false)),
+		"(a b . c)":            parser.Cons(parser.Symbol("a"), parser.Cons(parser.Symbol("b"), parser.Symbol("c"))),
+	}
+
+	for expected, s := range testCases {
+		if actual := parser.Write(s); actual != expected {
+			t.Errorf("expected %s got %s", expected, actual)
+		}
+	}
+
+	if parser.List() != parser.Nil {
+		t.Error("expected empty list to be Nil")
+	}
+}
+
+func TestLength(t *testing.T) {
+	cyclic := parser.List(parser.Int(1), parser.Int(2), parser.Int(3))
+	cyclic.Cdr.(*parser.Expr).Cdr.(*parser.Expr).Cdr = cyclic
+
+	selfCyclic := parser.Cons(parser.Int(1), nil)
+	selfCyclic.Cdr = selfCyclic
+
+	testCases := []struct {
+		List   parser.Sexpr
+		Length int
+		Error  error
+	}{
+		{parser.Nil, 0, nil},
+		{&parser.Expr{}, 0, nil},
+		{parser.List(parser.Int(1), parser.Int(2), parser.Int(3)), 3, nil},
+		{parser.Cons(parser.Int(1), parser.Int(2)), 0, parser.NOT_A_LIST},
+		{parser.Int(1), 0, parser.NOT_A_LIST},
+		{cyclic, 0, parser.NOT_A_LIST},
+		{selfCyclic, 0, parser.NOT_A_LIST},
+	}
+
+	for _, c := range testCases {
+		length, err := parser.Length(c.List)
+		if length != c.Length || !errors.Is(err, c.Error) {
+			t.Errorf("expected %d, %v got %d, %v for %v", c.Length, c.Error, length, err, c.List)
+		}
+
+		items, err := parser.ToSlice(c.List)
+		if len(items) != c.Length || !errors.Is(err, c.Error) {
+			t.Errorf("expected %d items, %v got %v, %v for %v", c.Length, c.Error, items, err, c.List)
+		}
+	}
+
+	items, _ := parser.ToSlice(parser.List(parser.Symbol("a"), parser.Symbol("b")))
+	if len(items) != 2 || !items[0].Equals(parser.Symbol("a")) || !items[1].Equals(parser.Symbol("b")) {
+		t.Errorf("expected [a b] got %v", items)
+	}
+}
+
+func TestIsImmutable(t *testing.T) {
+	data, err := parser.ParseString(`(a . (b)) #(1) #u8(1) "s" 'x #0=(#0#) (#;1)`)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	for _, datum := range data {
+		parser.Walk(datum, func(s parser.Sexpr) bool {
+			if a, ok := s.(*parser.Atom); ok && a.Type != parser.STRING {
+				return true
+			}
+			if !parser.IsImmutable(s) {
+				t.Errorf("expected %s read immutable", parser.Write(s))
+			}
+			return true
+		})
+	}
+
+	pair := data[0].(*parser.Expr)
+	if !parser.IsImmutable(pair.Cdr) || !parser.IsImmutable(data[4].(*parser.Expr).Cdr) {
+		t.Error("expected every pair of list read immutable")
+	}
+
+	for _, s := range []parser.Sexpr{parser.List(parser.Int(1)), parser.Cons(parser.Nil, parser.Nil), &parser.Vector{}, &parser.Bytevector{}, parser.Str("s"), parser.Symbol("s")} {
+		if parser.IsImmutable(s) {
+			t.Errorf("expected %s built mutable", parser.Write(s))
+		}
+	}
+
+	if !parser.IsImmutable(parser.Nil) || !parser.IsImmutable(parser.List()) {
+		t.Error("expected empty list immutable")
+	}
+}
@@ -0,0 +1,102 @@
+package parser
+
+// Eq reports whether a and b are the same object, as eq? does. Booleans,
+// symbols and empty lists are the same object if they are equal, as they are
+// unique in Scheme; any other data are only if they are identical.
+func Eq(a, b Sexpr) bool {
+	if a == b {
+		return true
+	}
+
+	switch a := a.(type) {
+	case *Expr:
+		b, ok := b.(*Expr)
+		return ok && a != nil && b != nil && isNull(a) && isNull(b)
+	case *Atom:
+		b, ok := b.(*Atom)
+		return ok && a.Type == b.Type && (a.Type == BOOL || a.Type == SYMBOL) && a.Equals(b)
+	}
+
+	return false
+}
+
+// Eqv reports whether a and b are equivalent, as eqv? does, i.e. they are
+// the same object by Eq, or numbers of the same exactness and value, or equal
+// characters.
+func Eqv(a, b Sexpr) bool {
+	if Eq(a, b) {
+		return true
+	}
+
+	a1, ok := a.(*Atom)
+	if !ok || (a1.Type != NUMBER && a1.Type != CHAR) {
+		return false
+	}
+
+	return a1.Equals(b)
+}
+
+// Equal reports whether a and b are structurally equal, as equal? does:
+// pairs and vectors are compared element by element, strings and
+// bytevectors by contents and anything else by Eqv. Data of other types,
+// e.g. procedures of evaluator, are compared by their Equals. Equal stops on
+// cyclic data, which are equal if they can't be told apart by traversal,
+// e.g. #0=(a . #0#) and (a . #1=(a . #1#)).
+func Equal(a, b Sexpr) bool {
+	// Pairs and vectors compared are assumed equal while their elements are
+	// compared, so comparison of elements doesn't compare them again.
+	assumed := make(map[[2]Sexpr]bool)
+	stack := [][2]Sexpr{{a, b}}
+
+	for len(stack) > 0 {
+		a, b := stack[len(stack)-1][0], stack[len(stack)-1][1]
+		stack = stack[:len(stack)-1]
+
+		if Eqv(a, b) {
+			continue
+		}
+		if a == nil || b == nil {
+			return false
+		}
+
+		switch a := a.(type) {
+		case *Atom:
+			b, ok := b.(*Atom)
+			if !ok || a.Type != STRING || b.Type != STRING || (a.Value).(string) != (b.Value).(string) {
+				return false
+			}
+		case *Bytevector:
+			if !a.Equals(b) {
+				return false
+			}
+		case *Vector:
+			b, ok := b.(*Vector)
+			if !ok || len(a.Elements) != len(b.Elements) {
+				return false
+			}
+			if assumed[[2]Sexpr{a, b}] {
+				continue
+			}
+			assumed[[2]Sexpr{a, b}] = true
+			for i := len(a.Elements) - 1; i >= 0; i-- {
+				stack = append(stack, [2]Sexpr{a.Elements[i], b.Elements[i]})
+			}
+		case *Expr:
+			b, ok := b.(*Expr)
+			if !ok || a == nil || b == nil || isNull(a) || isNull(b) {
+				return false
+			}
+			if assumed[[2]Sexpr{a, b}] {
+				continue
+			}
+			assumed[[2]Sexpr{a, b}] = true
+			stack = append(stack, [2]Sexpr{a.Cdr, b.Cdr}, [2]Sexpr{a.Car, b.Car})
+		default:
+			if !a.Equals(b) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
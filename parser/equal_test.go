@@ -0,0 +1,131 @@
+package parser_test
+
+import (
+	"fmt"
+	"github.com/vkhonin/scheme/lexer"
+	"github.com/vkhonin/scheme/parser"
+	"strings"
+	"testing"
+)
+
+func TestEquality(t *testing.T) {
+	str := parser.Str("s")
+	pair := parser.Cons(parser.Int(1), parser.Nil)
+	vector := &parser.Vector{Elements: []parser.Sexpr{parser.Int(1)}}
+
+	cyclic := parser.List(parser.Symbol("a"))
+	cyclic.Cdr = cyclic
+	unrolled := parser.List(parser.Symbol("a"), parser.Symbol("a"))
+	unrolled.Cdr.(*parser.Expr).Cdr = unrolled.Cdr
+	otherCyclic := parser.List(parser.Symbol("a"), parser.Symbol("b"))
+	otherCyclic.Cdr.(*parser.Expr).Cdr = otherCyclic
+
+	testCases := []struct {
+		A, B           parser.Sexpr
+		Eq, Eqv, Equal bool
+	}{
+		{parser.Bool(true), parser.Bool(true), true, true, true},
+		{parser.Bool(true), parser.Bool(false), false, false, false},
+		{parser.Symbol("a"), parser.Symbol("a"), true, true, true},
+		{parser.Symbol("a"), parser.Str("a"), false, false, false},
+		{parser.Nil, &parser.Expr{}, true, true, true},
+		{parser.Int(1), parser.Int(1), false, true, true},
+		{parser.Int(1), parser.Float(1), false, false, false},
+		{parser.Char('x'), parser.Char('x'), false, true, true},
+		{str, str, true, true, true},
+		{parser.Str("s"), parser.Str("s"), false, false, true},
+		{pair, pair, true, true, true},
+		{pair, parser.Cons(parser.Int(1), parser.Nil), false, false, true},
+		{pair, parser.Cons(parser.Int(1), parser.Int(2)), false, false, false},
+		{pair, parser.Nil, false, false, false},
+		{vector, &parser.Vector{Elements: []parser.Sexpr{parser.Int(1)}}, false, false, true},
+		{vector, &parser.Vector{}, false, false, false},
+		{&parser.Bytevector{Bytes: []byte{1}}, &parser.Bytevector{Bytes: []byte{1}}, false, false, true},
+		{parser.List(str, vector), parser.List(parser.Str("s"), &parser.Vector{Elements: []parser.Sexpr{parser.Int(1)}}), false, false, true},
+		{cyclic, unrolled, false, false, true},
+		{cyclic, otherCyclic, false, false, false},
+	}
+
+	for _, c := range testCases {
+		if parser.Eq(c.A, c.B) != c.Eq || parser.Eq(c.B, c.A) != c.Eq {
+			t.Errorf("expected Eq %v for %v and %v", c.Eq, c.A, c.B)
+		}
+		if parser.Eqv(c.A, c.B) != c.Eqv || parser.Eqv(c.B, c.A) != c.Eqv {
+			t.Errorf("expected Eqv %v for %v and %v", c.Eqv, c.A, c.B)
+		}
+		if parser.Equal(c.A, c.B) != c.Equal || parser.Equal(c.B, c.A) != c.Equal {
+			t.Errorf("expected Equal %v for %v and %v", c.Equal, c.A, c.B)
+		}
+	}
+}
+
+func TestDeepData(t *testing.T) {
+	const n = 100000
+
+	var sb strings.Builder
+	for i := range n {
+		fmt.Fprintf(&sb, " %d", i)
+	}
+	src := "(" + sb.String() + ")"
+
+	var tokens []lexer.Token
+	for token, err := range lexer.NewFromString(src).Tokens() {
+		if err != nil {
+			t.Fatal(err)
+		}
+		tokens = append(tokens, token)
+	}
+
+	p := parser.Parser{Tokens: tokens}
+	long, err := p.ParseDatum()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Nested both ways, e.g. ((((() . 0) . 1) . 2) . 3).
+	var deep, otherDeep parser.Sexpr = parser.Nil, parser.Nil
+	for i := range n {
+		deep = parser.Cons(deep, parser.Int(int64(i)))
+		otherDeep = parser.Cons(otherDeep, parser.Int(int64(i)))
+		deep = &parser.Vector{Elements: []parser.Sexpr{deep}}
+		otherDeep = &parser.Vector{Elements: []parser.Sexpr{otherDeep}}
+	}
+
+	for _, s := range []parser.Sexpr{long, deep} {
+		written := parser.Write(s)
+		if !strings.HasSuffix(written, "99999)") && !strings.HasSuffix(written, "99999))") {
+			t.Errorf("unexpected end of %s", written[len(written)-20:])
+		}
+
+		copied := parser.Map(s, func(s parser.Sexpr) parser.Sexpr { return s })
+		if !s.Equals(copied) || !parser.Equal(copied, s) {
+			t.Errorf("expected copy to be equal")
+		}
+
+		count := 0
+		parser.Walk(s, func(parser.Sexpr) bool {
+			count++
+			return true
+		})
+		if count < n {
+			t.Errorf("expected at least %d data walked got %d", n, count)
+		}
+
+		if parser.IsCyclic(s) {
+			t.Errorf("expected data not to be cyclic")
+		}
+	}
+
+	if !deep.Equals(otherDeep) {
+		t.Errorf("expected deep data to be equal")
+	}
+
+	if parser.Equal(long, parser.Map(long, func(s parser.Sexpr) parser.Sexpr {
+		if s.Equals(parser.Int(n - 1)) {
+			return parser.Int(0)
+		}
+		return s
+	})) {
+		t.Errorf("expected changed copy not to be equal")
+	}
+}
@@ -0,0 +1,72 @@
+package parser
+
+import (
+	"runtime"
+	"strings"
+	"sync"
+	"weak"
+)
+
+// SymbolTable interns symbols, i.e. keeps one symbol atom per name, so
+// interned symbols are Eq by pointer and their names are stored once.
+// Symbols are held weakly: once no data use symbol, it is released and its
+// name is removed from table, so tables of long-running programs reading
+// many names do not grow without bound. Eq compares symbols by names, so
+// symbol interned again after it is released is not told apart. It is safe
+// for concurrent use.
+type SymbolTable struct {
+	mu      sync.Mutex
+	symbols map[string]weak.Pointer[Atom]
+}
+
+// symbols is symbol table of Intern.
+var symbols = NewSymbolTable()
+
+func NewSymbolTable() *SymbolTable {
+	return &SymbolTable{symbols: make(map[string]weak.Pointer[Atom])}
+}
+
+// Intern returns symbol atom of name, which is the same for the same name
+// while it is used. Name is copied, so it may refer to memory caller reuses,
+// e.g. source of lexer.NewFromBytes. Atoms interned must not be modified.
+func (t *SymbolTable) Intern(name string) *Atom {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if symbol := t.symbols[name].Value(); symbol != nil {
+		return symbol
+	}
+
+	name = strings.Clone(name)
+	symbol := &Atom{Type: SYMBOL, Value: name}
+	t.symbols[name] = weak.Make(symbol)
+	runtime.AddCleanup(symbol, t.release, name)
+
+	return symbol
+}
+
+// release removes name from table once its symbol is released, unless name
+// is interned again since.
+func (t *SymbolTable) release(name string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if p, ok := t.symbols[name]; ok && p.Value() == nil {
+		delete(t.symbols, name)
+	}
+}
+
+// Len returns number of symbols interned in t, including those released but
+// not yet removed.
+func (t *SymbolTable) Len() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return len(t.symbols)
+}
+
+// Intern returns symbol atom of name interned in default symbol table, which
+// parser and evaluator share, see SymbolTable.
+func Intern(name string) *Atom {
+	return symbols.Intern(name)
+}
@@ -0,0 +1,111 @@
+package parser_test
+
+import (
+	"fmt"
+	"github.com/vkhonin/scheme/lexer"
+	"github.com/vkhonin/scheme/parser"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestIntern(t *testing.T) {
+	if parser.Intern("a") != parser.Intern("a") {
+		t.Error("expected symbols of the same name to be the same atom")
+	}
+	if parser.Intern("a") == parser.Intern("b") || parser.Intern("a") == parser.Symbol("a") {
+		t.Error("expected symbols of other names and not interned to be other atoms")
+	}
+
+	table := parser.NewSymbolTable()
+	a := table.Intern("a")
+	if a == parser.Intern("a") || a != table.Intern("a") || table.Len() != 1 {
+		t.Error("expected symbol table to intern symbols apart from default table")
+	}
+
+	data, err := parser.ParseString("(a 'a)")
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	list := data[0].(*parser.Expr)
+	quoted := list.Cdr.(*parser.Expr).Car.(*parser.Expr)
+	if list.Car != parser.Intern("a") || quoted.Car != parser.Intern("quote") || quoted.Cdr.(*parser.Expr).Car != list.Car {
+		t.Errorf("expected symbols of %s interned", parser.Write(list))
+	}
+
+	p := parser.Parser{Tokens: lexTokens(t, "(a a)"), Symbols: table, WithPositions: true}
+	data, err = p.Parse()
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	list = data[0].(*parser.Expr)
+	if list.Car == list.Cdr.(*parser.Expr).Car {
+		t.Error("expected symbols with positions not interned")
+	}
+
+	p = parser.Parser{Tokens: lexTokens(t, "a"), Symbols: table}
+	if data, err = p.Parse(); err != nil || data[0] != a {
+		t.Errorf("expected symbol interned in parser table got %v, %v", data, err)
+	}
+}
+
+func TestIntern_Source(t *testing.T) {
+	src := []byte("(reused-name)")
+
+	var tokens []lexer.Token
+	for token, err := range lexer.NewFromBytes(src).Tokens() {
+		if err != nil {
+			t.Fatal(err)
+		}
+		tokens = append(tokens, token)
+	}
+
+	p := parser.Parser{Tokens: tokens}
+	data, err := p.Parse()
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	copy(src, "(xxxxxxxxxx)")
+
+	symbol := data[0].(*parser.Expr).Car.(*parser.Atom)
+	if symbol.Value != "reused-name" || parser.Intern("reused-name") != symbol {
+		t.Errorf("expected interned name copied from source got %v", symbol.Value)
+	}
+}
+
+func TestSymbolTable_Release(t *testing.T) {
+	table := parser.NewSymbolTable()
+	kept := table.Intern("kept")
+	for i := range 100 {
+		table.Intern(fmt.Sprint("unused", i))
+	}
+
+	for range 100 {
+		if table.Len() == 1 {
+			break
+		}
+		runtime.GC()
+		time.Sleep(time.Millisecond)
+	}
+
+	if table.Len() != 1 || table.Intern("kept") != kept {
+		t.Errorf("expected symbols no longer used released, got %d symbols", table.Len())
+	}
+}
+
+func lexTokens(t *testing.T, src string) []lexer.Token {
+	t.Helper()
+
+	var tokens []lexer.Token
+	for token, err := range lexer.NewFromString(src).Tokens() {
+		if err != nil {
+			t.Fatal(err)
+		}
+		tokens = append(tokens, token)
+	}
+
+	return tokens
+}
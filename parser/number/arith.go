@@ -0,0 +1,103 @@
+package number
+
+import (
+	"math/big"
+)
+
+// Add returns n + m. Result is exact if both operands are exact.
+func (n *Number) Add(m *Number) *Number {
+	return n.arith(m, (*big.Rat).Add, componentwise((*big.Rat).Add), func(a, b float64) float64 {
+		return a + b
+	}, func(a, b complex128) complex128 {
+		return a + b
+	})
+}
+
+// Sub returns n - m. Result is exact if both operands are exact.
+func (n *Number) Sub(m *Number) *Number {
+	return n.arith(m, (*big.Rat).Sub, componentwise((*big.Rat).Sub), func(a, b float64) float64 {
+		return a - b
+	}, func(a, b complex128) complex128 {
+		return a - b
+	})
+}
+
+// Mul returns n * m. Result is exact if both operands are exact.
+func (n *Number) Mul(m *Number) *Number {
+	return n.arith(m, (*big.Rat).Mul, gaussianMul, func(a, b float64) float64 {
+		return a * b
+	}, func(a, b complex128) complex128 {
+		return a * b
+	})
+}
+
+// Div returns n / m. Result is exact if both operands are exact, in which case
+// division by zero is reported as DIVISION_BY_ZERO. Inexact division by zero
+// yields infinity or NaN.
+func (n *Number) Div(m *Number) (*Number, error) {
+	if m.kind == KindInteger && m.integer.Sign() == 0 {
+		return nil, DIVISION_BY_ZERO
+	}
+
+	return n.arith(m, (*big.Rat).Quo, gaussianQuo, func(a, b float64) float64 {
+		return a / b
+	}, func(a, b complex128) complex128 {
+		return a / b
+	}), nil
+}
+
+// arith applies operation matching representations of n and m: rational one
+// when both are exact reals, Gaussian one when both are exact and one is
+// complex, float one when both are reals and complex one otherwise.
+func (n *Number) arith(
+	m *Number,
+	ratOp func(z, x, y *big.Rat) *big.Rat,
+	gaussianOp func(a, b, c, d *big.Rat) (*big.Rat, *big.Rat),
+	floatOp func(a, b float64) float64,
+	complexOp func(a, b complex128) complex128,
+) *Number {
+	result := &Number{isNumber: true, radixVal: base10}
+	inexact := n.Inexact() || m.Inexact()
+
+	switch {
+	case n.IsReal() && m.IsReal() && inexact:
+		result.setReal(floatOp(n.Float(), m.Float()))
+	case n.IsReal() && m.IsReal():
+		result.setExact(ratOp(new(big.Rat), n.Rat(), m.Rat()))
+	case inexact:
+		result.setComplex(complexOp(n.Value(), m.Value()), true)
+	default:
+		a, b := n.parts()
+		c, d := m.parts()
+		result.setGaussian(gaussianOp(a, b, c, d))
+	}
+
+	return result
+}
+
+// componentwise returns Gaussian operation applying op to real and imaginary
+// parts separately.
+func componentwise(op func(z, x, y *big.Rat) *big.Rat) func(a, b, c, d *big.Rat) (*big.Rat, *big.Rat) {
+	return func(a, b, c, d *big.Rat) (*big.Rat, *big.Rat) {
+		return op(new(big.Rat), a, c), op(new(big.Rat), b, d)
+	}
+}
+
+// gaussianMul returns (a+bi)(c+di) = (ac-bd) + (ad+bc)i.
+func gaussianMul(a, b, c, d *big.Rat) (*big.Rat, *big.Rat) {
+	re := new(big.Rat).Sub(new(big.Rat).Mul(a, c), new(big.Rat).Mul(b, d))
+	im := new(big.Rat).Add(new(big.Rat).Mul(a, d), new(big.Rat).Mul(b, c))
+
+	return re, im
+}
+
+// gaussianQuo returns (a+bi)/(c+di) = ((ac+bd) + (bc-ad)i) / (c²+d²). Divisor
+// must not be zero.
+func gaussianQuo(a, b, c, d *big.Rat) (*big.Rat, *big.Rat) {
+	norm := new(big.Rat).Add(new(big.Rat).Mul(c, c), new(big.Rat).Mul(d, d))
+
+	re := new(big.Rat).Add(new(big.Rat).Mul(a, c), new(big.Rat).Mul(b, d))
+	im := new(big.Rat).Sub(new(big.Rat).Mul(b, c), new(big.Rat).Mul(a, d))
+
+	return re.Quo(re, norm), im.Quo(im, norm)
+}
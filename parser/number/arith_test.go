@@ -0,0 +1,103 @@
+package number_test
+
+import (
+	"errors"
+	"github.com/vkhonin/scheme/parser/number"
+	"testing"
+)
+
+type arithTestCase struct {
+	A, B   string
+	Result string
+}
+
+func parse(literal string) *number.Number {
+	n, err := number.NewFromLiteral(literal).Parse()
+	if err != nil {
+		panic(err)
+	}
+
+	return n
+}
+
+func runArithTestCases(t *testing.T, op string, fn func(a, b *number.Number) *number.Number, testCases []arithTestCase) {
+	t.Helper()
+
+	for _, c := range testCases {
+		if s := fn(parse(c.A), parse(c.B)).String(); s != c.Result {
+			t.Errorf("expected %s %s %s = %s got %s", c.A, op, c.B, c.Result, s)
+		}
+	}
+}
+
+func TestNumber_Add(t *testing.T) {
+	runArithTestCases(t, "+", (*number.Number).Add, []arithTestCase{
+		{"1", "2", "3"},
+		{"1/3", "1/6", "1/2"},
+		{"1/2", "1/2", "1"},
+		{"123456789012345678901234567890", "1", "123456789012345678901234567891"},
+		{"1", "2.5", "3.5"},
+		{"1/2", "#i1", "1.5"},
+		{"1+2i", "3-2i", "4"},
+		{"1+2i", "1", "2+2i"},
+		{"1.5+2i", "1", "2.5+2.0i"},
+		{"1/2+1/3i", "1/2+2/3i", "1+i"},
+		{"+1/3i", "1/3", "1/3+1/3i"},
+	})
+}
+
+func TestNumber_Sub(t *testing.T) {
+	runArithTestCases(t, "-", (*number.Number).Sub, []arithTestCase{
+		{"1", "2", "-1"},
+		{"1/2", "1/3", "1/6"},
+		{"100000000000000000000", "1", "99999999999999999999"},
+		{"3", "0.5", "2.5"},
+		{"2+i", "+i", "2"},
+	})
+}
+
+func TestNumber_Mul(t *testing.T) {
+	runArithTestCases(t, "*", (*number.Number).Mul, []arithTestCase{
+		{"6", "7", "42"},
+		{"2/3", "3/4", "1/2"},
+		{"4294967296", "4294967296", "18446744073709551616"},
+		{"2", "1.5", "3.0"},
+		{"+i", "+i", "-1"},
+		{"0", "1.5", "0.0"},
+		{"1/2+1/2i", "1/2-1/2i", "1/2"},
+		{"1+2i", "3+4i", "-5+10i"},
+		{"1/3+i", "3", "1+3i"},
+	})
+}
+
+func TestNumber_Div(t *testing.T) {
+	div := func(a, b *number.Number) *number.Number {
+		q, err := a.Div(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return q
+	}
+
+	runArithTestCases(t, "/", div, []arithTestCase{
+		{"1", "3", "1/3"},
+		{"6", "3", "2"},
+		{"1/2", "1/4", "2"},
+		{"1", "2.0", "0.5"},
+		{"1", "0.0", "+inf.0"},
+		{"-1", "#i0", "-inf.0"},
+		{"2+2i", "2", "1+i"},
+		{"1", "+i", "-i"},
+		{"-5+10i", "1+2i", "3+4i"},
+		{"1/2+1/3i", "2", "1/4+1/6i"},
+		{"1+i", "2.0", "0.5+0.5i"},
+	})
+
+	if _, err := parse("1").Div(parse("0")); !errors.Is(err, number.DIVISION_BY_ZERO) {
+		t.Errorf("expected division by zero, got %v", err)
+	}
+
+	if _, err := parse("1.5").Div(parse("0/3")); !errors.Is(err, number.DIVISION_BY_ZERO) {
+		t.Errorf("expected division by exact zero to fail, got %v", err)
+	}
+}
@@ -0,0 +1,105 @@
+package number
+
+import (
+	"math"
+	"math/big"
+)
+
+// Cmp compares real numbers n and m and returns -1, 0 or +1. Exact and
+// inexact numbers are compared by value without rounding exact one to float.
+// Cmp reports DOMAIN_ERROR if either number is complex; result for NaN is
+// unspecified, so Less and Equal should be used when operands may be NaN.
+func (n *Number) Cmp(m *Number) (int, error) {
+	if !n.IsReal() || !m.IsReal() {
+		return 0, DOMAIN_ERROR
+	}
+	return n.cmp(m), nil
+}
+
+// cmp compares real numbers n and m.
+func (n *Number) cmp(m *Number) int {
+	a, b := n.Rat(), m.Rat()
+
+	if a == nil {
+		if f := n.float; math.IsInf(f, 0) || math.IsNaN(f) {
+			return compareFloats(f, m.Float())
+		}
+		a = new(big.Rat).SetFloat64(n.float)
+	}
+
+	if b == nil {
+		if f := m.float; math.IsInf(f, 0) || math.IsNaN(f) {
+			return compareFloats(n.Float(), f)
+		}
+		b = new(big.Rat).SetFloat64(m.float)
+	}
+
+	return a.Cmp(b)
+}
+
+// Equal reports whether n and m are numerically equal, regardless of their
+// exactness, as = does. NaN is not equal to anything.
+func (n *Number) Equal(m *Number) bool {
+	switch {
+	case n.IsReal() && m.IsReal():
+		return !n.IsNaN() && !m.IsNaN() && n.cmp(m) == 0
+	case n.IsReal() || m.IsReal():
+		return false
+	case n.kind == KindExactComplex && m.kind == KindExactComplex:
+		return n.re.Cmp(m.re) == 0 && n.im.Cmp(m.im) == 0
+	default:
+		return n.Value() == m.Value()
+	}
+}
+
+// Less reports whether real n is less than real m. It is false when either is
+// NaN or complex, as complex numbers are not ordered.
+func (n *Number) Less(m *Number) bool {
+	return n.IsReal() && m.IsReal() && !n.IsNaN() && !m.IsNaN() && n.cmp(m) < 0
+}
+
+func (n *Number) IsExact() bool {
+	return !n.Inexact()
+}
+
+func (n *Number) IsZero() bool {
+	switch n.kind {
+	case KindInteger:
+		return n.integer.Sign() == 0
+	case KindReal:
+		return n.float == 0
+	default:
+		return false
+	}
+}
+
+func (n *Number) IsNaN() bool {
+	return n.kind == KindReal && math.IsNaN(n.float)
+}
+
+// IsReal reports whether n has no imaginary part.
+func (n *Number) IsReal() bool {
+	return n.kind != KindComplex && n.kind != KindExactComplex
+}
+
+// IsRational reports whether n is real and finite.
+func (n *Number) IsRational() bool {
+	return n.kind == KindInteger || n.kind == KindRational ||
+		(n.kind == KindReal && !math.IsInf(n.float, 0) && !math.IsNaN(n.float))
+}
+
+// IsInteger reports whether n is real with integer value, e.g. 2 or 2.0.
+func (n *Number) IsInteger() bool {
+	return n.kind == KindInteger || (n.kind == KindReal && n.float == math.Trunc(n.float) && !math.IsInf(n.float, 0))
+}
+
+func compareFloats(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
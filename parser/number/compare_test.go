@@ -0,0 +1,115 @@
+package number_test
+
+import (
+	"errors"
+	"github.com/vkhonin/scheme/parser/number"
+	"math"
+	"testing"
+)
+
+func TestNumber_Cmp(t *testing.T) {
+	testCases := []struct {
+		A, B string
+		Cmp  int
+	}{
+		{"1", "2", -1},
+		{"2", "1", 1},
+		{"1/2", "0.5", 0},
+		{"1/3", "0.3333333333333333", 1},
+		{"100000000000000000001", "1e20", 1},
+		{"-1/2", "-1/3", -1},
+		{"#e1.5", "3/2", 0},
+	}
+
+	for _, c := range testCases {
+		if cmp, err := parse(c.A).Cmp(parse(c.B)); err != nil || cmp != c.Cmp {
+			t.Errorf("expected %d got %d, %v comparing %s and %s", c.Cmp, cmp, err, c.A, c.B)
+		}
+	}
+
+	for _, c := range [][2]string{{"1+2i", "1"}, {"1", "+i"}, {"1.5+2.5i", "1.5+2.5i"}} {
+		if cmp, err := parse(c[0]).Cmp(parse(c[1])); !errors.Is(err, number.DOMAIN_ERROR) {
+			t.Errorf("expected domain error comparing %s and %s got %d, %v", c[0], c[1], cmp, err)
+		}
+	}
+}
+
+func TestNumber_EqualLess(t *testing.T) {
+	testCases := []struct {
+		A, B  string
+		Equal bool
+		Less  bool
+	}{
+		{"1", "1.0", true, false},
+		{"1", "1.5", false, true},
+		{"1/2", "1/2", true, false},
+		{"1+2i", "1+2i", true, false},
+		{"1+2i", "1.0+2.0i", true, false},
+		{"1+2i", "1", false, false},
+		{"1", "1+2i", false, false},
+		{"1+2i", "2+2i", false, false},
+	}
+
+	for _, c := range testCases {
+		a, b := parse(c.A), parse(c.B)
+
+		if a.Equal(b) != c.Equal {
+			t.Errorf("expected Equal %v for %s and %s", c.Equal, c.A, c.B)
+		}
+
+		if a.Less(b) != c.Less {
+			t.Errorf("expected Less %v for %s and %s", c.Less, c.A, c.B)
+		}
+	}
+}
+
+func TestNumber_Predicates(t *testing.T) {
+	testCases := []struct {
+		Literal                              string
+		Zero, Integer, Rational, Real, Exact bool
+	}{
+		{"0", true, true, true, true, true},
+		{"0.0", true, true, true, true, false},
+		{"3", false, true, true, true, true},
+		{"3.0", false, true, true, true, false},
+		{"#e3.0", false, true, true, true, true},
+		{"1/2", false, false, true, true, true},
+		{"1.5", false, false, true, true, false},
+		{"1+2i", false, false, false, false, true},
+		{"1.0+0.0i", false, true, true, true, false},
+	}
+
+	for _, c := range testCases {
+		n := parse(c.Literal)
+
+		if n.IsZero() != c.Zero || n.IsInteger() != c.Integer || n.IsRational() != c.Rational ||
+			n.IsReal() != c.Real || n.IsExact() != c.Exact {
+			t.Errorf(
+				"expected zero %v, integer %v, rational %v, real %v, exact %v for %s",
+				c.Zero, c.Integer, c.Rational, c.Real, c.Exact, c.Literal,
+			)
+		}
+	}
+}
+
+func TestNumber_Infinities(t *testing.T) {
+	inf := number.NewFromValue(complex(math.Inf(1), 0), true)
+	nan := number.NewFromValue(complex(math.NaN(), 0), true)
+	big := parse("100000000000000000000000000000000000000000000000000")
+
+	if a, _ := inf.Cmp(big); a != 1 {
+		t.Errorf("expected +inf.0 to be greater than exact number")
+	}
+
+	if b, _ := big.Cmp(inf); b != -1 || !big.Less(inf) {
+		t.Errorf("expected exact number to be less than +inf.0")
+	}
+
+	if inf.IsRational() || inf.IsInteger() || !inf.IsReal() {
+		t.Errorf("expected +inf.0 to be real only")
+	}
+
+	if nan.Equal(nan) || nan.Less(big) || big.Less(nan) || !nan.IsNaN() {
+		t.Errorf("expected NaN to be unordered")
+	}
+}
@@ -0,0 +1,70 @@
+package number
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+)
+
+// Format returns literal of n in given radix, or reports INVALID_RADIX unless
+// it is 2, 8, 10 or 16. Literal has no radix prefix and parses back to number
+// equal to n when read in that radix. Exact numbers are written as integers
+// or a/b fractions. Inexact ones are written with decimal point in radix 10
+// and as #i prefixed fractions in other radixes, which have no decimal
+// notation.
+func (n *Number) Format(radix int) (string, error) {
+	switch radix {
+	case base10:
+		return n.Sprint(PrintCanonical), nil
+	case base2, base8, base16:
+	default:
+		return "", fmt.Errorf("%w: %d", INVALID_RADIX, radix)
+	}
+
+	switch n.kind {
+	case KindInteger:
+		return n.integer.Text(radix), nil
+	case KindRational:
+		return formatRat(n.rational, radix), nil
+	case KindReal:
+		return "#i" + formatFloat(n.float, radix), nil
+	}
+
+	var reStr, imStr string
+	if n.kind == KindExactComplex {
+		if n.re.Sign() != 0 {
+			reStr = formatRat(n.re, radix)
+		}
+		return joinComplex(reStr, formatRat(n.im, radix)), nil
+	}
+
+	if re := real(n.complex); re != 0 {
+		reStr = formatFloat(re, radix)
+	}
+	imStr = formatFloat(imag(n.complex), radix)
+
+	return "#i" + joinComplex(reStr, imStr), nil
+}
+
+// formatFloat writes float as exact fraction in radix, or as +inf.0, -inf.0
+// or +nan.0 if it is not finite.
+func formatFloat(f float64, radix int) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+inf.0"
+	case math.IsInf(f, -1):
+		return "-inf.0"
+	case math.IsNaN(f):
+		return "+nan.0"
+	}
+
+	return formatRat(new(big.Rat).SetFloat64(f), radix)
+}
+
+func formatRat(r *big.Rat, radix int) string {
+	if r.IsInt() {
+		return r.Num().Text(radix)
+	}
+
+	return r.Num().Text(radix) + "/" + r.Denom().Text(radix)
+}
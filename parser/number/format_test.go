@@ -0,0 +1,74 @@
+package number_test
+
+import (
+	"errors"
+	"github.com/vkhonin/scheme/parser/number"
+	"testing"
+)
+
+func TestNumber_Format(t *testing.T) {
+	testCases := []struct {
+		Literal string
+		Radix   int
+		Result  string
+	}{
+		{"255", 16, "ff"},
+		{"-255", 16, "-ff"},
+		{"5", 2, "101"},
+		{"8", 8, "10"},
+		{"123456789012345678901234567890", 16, "18ee90ff6c373e0ee4e3f0ad2"},
+		{"-3/4", 2, "-11/100"},
+		{"1/3", 10, "1/3"},
+		{"0.5", 10, "0.5"},
+		{"2.0", 10, "2.0"},
+		{"0.5", 2, "#i1/10"},
+		{"-1.5", 16, "#i-3/2"},
+		{"1+2i", 2, "1+10i"},
+		{"-i", 16, "-i"},
+		{"1.5-0.5i", 2, "#i11/10-1/10i"},
+		{"+inf.0i", 2, "#i+inf.0i"},
+		{"+inf.0i", 8, "#i+inf.0i"},
+		{"+inf.0i", 16, "#i+inf.0i"},
+		{"-nan.0+1i", 2, "#i+nan.0+i"},
+		{"-nan.0+1i", 8, "#i+nan.0+i"},
+		{"-nan.0+1i", 16, "#i+nan.0+i"},
+		{"1+inf.0i", 2, "#i1+inf.0i"},
+		{"1+inf.0i", 8, "#i1+inf.0i"},
+		{"1+inf.0i", 16, "#i1+inf.0i"},
+		{"-inf.0", 16, "#i-inf.0"},
+	}
+
+	for _, c := range testCases {
+		if s, err := parse(c.Literal).Format(c.Radix); err != nil || s != c.Result {
+			t.Errorf("expected %s got %s formatting %s in radix %d", c.Result, s, c.Literal, c.Radix)
+		}
+	}
+}
+
+func TestNumber_Format_InvalidRadix(t *testing.T) {
+	for _, radix := range []int{0, 3, 36} {
+		if _, err := parse("1").Format(radix); !errors.Is(err, number.INVALID_RADIX) {
+			t.Errorf("expected error %v got %v for radix %d", number.INVALID_RADIX, err, radix)
+		}
+	}
+}
+
+func TestNumber_FormatRoundTrip(t *testing.T) {
+	prefixes := map[int]string{2: "#b", 8: "#o", 10: "", 16: "#x"}
+
+	for _, literal := range []string{"0", "42", "-17", "1/3", "-7/9", "0.25", "-2.5", "1+2i", "3/4-i", "1.5+0.5i", "+inf.0i", "1-inf.0i"} {
+		for radix, prefix := range prefixes {
+			n := parse(literal)
+			formatted, err := n.Format(radix)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			reparsed := parse(prefix + formatted)
+
+			if !reparsed.Equal(n) || reparsed.Inexact() != n.Inexact() {
+				t.Errorf("expected %s in radix %d (%s) to parse back, got %v", literal, radix, formatted, reparsed)
+			}
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package number
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"math"
+	"math/big"
+)
+
+// Hash returns hash of n consistent with eqv?: numbers of the same exactness
+// which are numerically equal hash equally, e.g. 0.0 and -0.0, while exact 2
+// and inexact 2.0 hash differently. Hash is stable across processes.
+func (n *Number) Hash() uint64 {
+	h := fnv.New64a()
+
+	var buf [8]byte
+
+	writeFloat := func(f float64) {
+		if f == 0 {
+			f = 0
+		}
+		binary.LittleEndian.PutUint64(buf[:], math.Float64bits(f))
+		h.Write(buf[:])
+	}
+
+	// Magnitudes are length prefixed, so numerator and denominator can not
+	// run into each other.
+	writeInt := func(i *big.Int) {
+		b := i.Bytes()
+		binary.LittleEndian.PutUint64(buf[:], uint64(len(b)))
+		h.Write(buf[:])
+		h.Write(b)
+	}
+
+	writeRat := func(r *big.Rat) {
+		h.Write([]byte{byte(r.Sign() + 1)})
+		writeInt(r.Num())
+		writeInt(r.Denom())
+	}
+
+	h.Write([]byte{byte(n.kind)})
+
+	switch n.kind {
+	case KindInteger:
+		writeRat(new(big.Rat).SetInt(n.integer))
+	case KindRational:
+		writeRat(n.rational)
+	case KindReal:
+		writeFloat(n.float)
+	case KindComplex:
+		writeFloat(real(n.complex))
+		writeFloat(imag(n.complex))
+	case KindExactComplex:
+		writeRat(n.re)
+		writeRat(n.im)
+	}
+
+	return h.Sum64()
+}
@@ -0,0 +1,46 @@
+package number_test
+
+import (
+	"github.com/vkhonin/scheme/parser/number"
+	"math/big"
+	"testing"
+)
+
+func TestNumber_Hash(t *testing.T) {
+	equal := [][2]string{
+		{"2", "#e2.0"},
+		{"1/2", "2/4"},
+		{"#xff", "255"},
+		{"0.0", "-0.0"},
+		{"1.5", "#i3/2"},
+		{"1+2i", "#e1.0+2.0i"},
+		{"1.5-2.5i", "#i3/2-5/2i"},
+		{"1+0i", "1"},
+	}
+
+	for _, c := range equal {
+		if a, b := parse(c[0]).Hash(), parse(c[1]).Hash(); a != b {
+			t.Errorf("expected equal hashes for %s and %s, got %d and %d", c[0], c[1], a, b)
+		}
+	}
+
+	distinct := [][2]string{
+		{"2", "2.0"},
+		{"1/2", "0.5"},
+		{"1", "-1"},
+		{"1/2", "-1/2"},
+		{"1+2i", "1.0+2.0i"},
+		{"1+2i", "2+i"},
+		{"256", "1/256"},
+	}
+
+	for _, c := range distinct {
+		if a, b := parse(c[0]).Hash(), parse(c[1]).Hash(); a == b {
+			t.Errorf("expected distinct hashes for %s and %s, got %d", c[0], c[1], a)
+		}
+	}
+
+	if a, b := number.NewFromInt(big.NewInt(42)).Hash(), parse("42").Hash(); a != b {
+		t.Errorf("expected hash independent of construction, got %d and %d", a, b)
+	}
+}
@@ -0,0 +1,20 @@
+package number
+
+// MarshalText implements encoding.TextMarshaler. Number is written in
+// canonical form, which reads back as number of the same value and exactness.
+func (n *Number) MarshalText() ([]byte, error) {
+	return []byte(n.Sprint(PrintCanonical)), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler. Text is read as number
+// literal, so any literal is accepted, not only canonical one.
+func (n *Number) UnmarshalText(text []byte) error {
+	parsed, err := NewFromLiteral(string(text)).Parse()
+	if err != nil {
+		return err
+	}
+
+	*n = *parsed
+
+	return nil
+}
@@ -0,0 +1,70 @@
+package number_test
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/vkhonin/scheme/parser/number"
+	"math"
+	"math/big"
+	"testing"
+)
+
+func TestNumber_MarshalText(t *testing.T) {
+	numbers := []*number.Number{
+		parse("42"),
+		parse("-123456789012345678901234567890"),
+		parse("#xff"),
+		parse("1/3"),
+		parse("#e1.5"),
+		parse("2.0"),
+		parse("-0.0"),
+		parse("1e21"),
+		parse("1.5e-7"),
+		parse("1/2-1/3i"),
+		parse("1.5+2.0i"),
+		parse("+i"),
+		number.NewFromValue(complex(0.1, 0), false),
+		number.NewFromValue(complex(math.Inf(1), 0), true),
+		number.NewFromValue(complex(math.Inf(-1), 0), true),
+		number.NewFromValue(complex(1, math.Inf(-1)), true),
+		number.NewFromRat(big.NewRat(-22, 7)),
+	}
+
+	for _, n := range numbers {
+		text, err := n.MarshalText()
+		if err != nil {
+			t.Errorf("unexpected error %v for %v", err, n)
+			continue
+		}
+
+		var m number.Number
+		if err := m.UnmarshalText(text); err != nil {
+			t.Errorf("unexpected error %v for %s", err, text)
+			continue
+		}
+
+		if m.Inexact() != n.Inexact() || m.Hash() != n.Hash() {
+			t.Errorf("expected %v to round-trip, got %v", n, &m)
+		}
+	}
+
+	var nan number.Number
+	if err := nan.UnmarshalText([]byte("+nan.0")); err != nil || !nan.IsNaN() {
+		t.Errorf("expected NaN, got %v (%v)", &nan, err)
+	}
+
+	var invalid number.Number
+	if err := invalid.UnmarshalText([]byte("1/0")); !errors.Is(err, number.DIVISION_BY_ZERO) {
+		t.Errorf("expected division by zero, got %v", err)
+	}
+
+	data, err := json.Marshal(map[string]*number.Number{"n": parse("#e1.25")})
+	if err != nil || string(data) != `{"n":"5/4"}` {
+		t.Errorf("expected {\"n\":\"5/4\"} got %s (%v)", data, err)
+	}
+
+	var decoded map[string]*number.Number
+	if err := json.Unmarshal(data, &decoded); err != nil || decoded["n"].String() != "5/4" {
+		t.Errorf("expected 5/4 got %v (%v)", decoded, err)
+	}
+}
@@ -1,218 +1,480 @@
 package number
 
 import (
+	"errors"
 	"fmt"
 	"math"
-	"regexp"
+	"math/big"
 	"strconv"
 	"strings"
 )
 
-// Number-related regexp as in <number> and children (7.1.1. Lexical structure).
 const (
-	prefix2  = `#b(#[ie])?|(#[ie])?#b`
-	prefix8  = `#o(#[ie])?|(#[ie])?#o`
-	prefix10 = `(#d)?(#[ie])?|(#[ie])?(#d)?`
-	prefix16 = `#x(#[ie])?|(#[ie])?#x`
-
-	uinteger2  = `[0-1]+#*`
-	uinteger8  = `[0-7]+#*`
-	uinteger10 = `[0-9]+#*`
-	uinteger16 = `[0-9a-f]+#*`
-
-	decimal10 = `(\.?` + uinteger10 + `|[0-9]+\.[0-9]*#*` + `|[0-9]+#+\.#*)` + `([esfdl][+-]?[0-9]+)?`
-
-	ureal2  = `(?P<dividend>` + uinteger2 + `)(/(?P<divisor>` + uinteger2 + `))?`
-	ureal8  = `(?P<dividend>` + uinteger8 + `)(/(?P<divisor>` + uinteger8 + `))?`
-	ureal10 = `(?P<dividend>` + uinteger10 + `)(/(?P<divisor>` + uinteger10 + `))?|(?P<decimal>` + decimal10 + `)`
-	ureal16 = `(?P<dividend>` + uinteger16 + `)(/(?P<divisor>` + uinteger16 + `))?`
-
-	real2  = `(?P<realSign>[+-]?)(?P<realUreal>` + ureal2 + `)`
-	real8  = `(?P<realSign>[+-]?)(?P<realUreal>` + ureal8 + `)`
-	real10 = `(?P<realSign>[+-]?)(?P<realUreal>` + ureal10 + `)`
-	real16 = `(?P<realSign>[+-]?)(?P<realUreal>` + ureal16 + `)`
-
-	complex2  = `(?P<complexReal>` + real2 + `)(@(?P<complexImag>` + real2 + `)|(?P<complexImagSign>[+-])(?P<complexImag>` + ureal2 + `)?i` + `)?|(?P<complexImagSign>[+-])(?P<complexImag>` + ureal2 + `)?i`
-	complex8  = `(?P<complexReal>` + real8 + `)(@(?P<complexImag>` + real8 + `)|(?P<complexImagSign>[+-])(?P<complexImag>` + ureal8 + `)?i` + `)?|(?P<complexImagSign>[+-])(?P<complexImag>` + ureal8 + `)?i`
-	complex10 = `(?P<complexReal>` + real10 + `)(@(?P<complexImag>` + real10 + `)|(?P<complexImagSign>[+-])(?P<complexImag>` + ureal10 + `)?i` + `)?|(?P<complexImagSign>[+-])(?P<complexImag>` + ureal10 + `)?i`
-	complex16 = `(?P<complexReal>` + real16 + `)(@(?P<complexImag>` + real16 + `)|(?P<complexImagSign>[+-])(?P<complexImag>` + ureal16 + `)?i` + `)?|(?P<complexImagSign>[+-])(?P<complexImag>` + ureal16 + `)?i`
-
-	number2  = `(?P<prefix>` + prefix2 + `)(?P<complex>` + complex2 + `)`
-	number8  = `(?P<prefix>` + prefix8 + `)(?P<complex>` + complex8 + `)`
-	number10 = `(?P<prefix>` + prefix10 + `)(?P<complex>` + complex10 + `)`
-	number16 = `(?P<prefix>` + prefix16 + `)(?P<complex>` + complex16 + `)`
-
-	number = number2 + `|` + number8 + `|` + number10 + `|` + number16
-)
-
-const (
-	typeNumber = iota
-	typeComplex
-	typeReal
-	typeUreal
-
-	baseN  = 0
 	base2  = 2
 	base8  = 8
 	base10 = 10
 	base16 = 16
 )
 
-var regexps map[int]map[int]*struct {
-	Regexp *regexp.Regexp
-	Groups []string
-}
+// Kinds of number representation.
+const (
+	KindInteger      Kind = iota // Exact integer
+	KindRational                 // Exact non-integer rational
+	KindReal                     // Inexact real
+	KindComplex                  // Inexact complex with non-zero imaginary part
+	KindExactComplex             // Exact complex with non-zero imaginary part
+)
+
+// Policy used by Sprint to choose between source and canonical text.
+const (
+	PrintCanonical PrintPolicy = iota // Canonical form, e.g. 255 for #xFF
+	PrintLiteral                      // Source literal if known, e.g. #xFF
+)
+
+var (
+	DIVISION_BY_ZERO = errors.New("division by zero")
+	DOMAIN_ERROR     = errors.New("argument out of domain")
+	INVALID_NUMBER   = errors.New("invalid number")
+	INVALID_RADIX    = errors.New("invalid radix")
+)
 
+// Number is a tagged union of number representations. Kind tells which
+// fields hold value; numbers are normalized, so exact reals with integer
+// value are always KindInteger and complex numbers have non-zero imaginary
+// part.
 type Number struct {
 	literal string
 
-	complex complex128
+	kind     Kind
+	integer  *big.Int   // Value of KindInteger
+	rational *big.Rat   // Value of KindRational
+	float    float64    // Value of KindReal
+	complex  complex128 // Value of KindComplex
+	re, im   *big.Rat   // Value of KindExactComplex
+
+	// inexact is set while literal is parsed when it demands inexact value.
 	inexact bool
 
 	isNumber bool
 	radixVal int
+
+	// exact is set when literal has #e prefix.
+	exact bool
 }
 
+type Kind uint8
+
+type PrintPolicy uint8
+
 func (n *Number) String() string {
-	return fmt.Sprintf("%e (i=%t)", n.complex, n.inexact)
-}
-
-func init() {
-	regexps = map[int]map[int]*struct {
-		Regexp *regexp.Regexp
-		Groups []string
-	}{
-		typeNumber: {
-			baseN: {Regexp: compileRegexp(number)},
-		},
-		typeComplex: {
-			base2:  {Regexp: compileRegexp(complex2)},
-			base8:  {Regexp: compileRegexp(complex8)},
-			base10: {Regexp: compileRegexp(complex10)},
-			base16: {Regexp: compileRegexp(complex16)},
-		},
-		typeReal: {
-			base2:  {Regexp: compileRegexp(real2)},
-			base8:  {Regexp: compileRegexp(real8)},
-			base10: {Regexp: compileRegexp(real10)},
-			base16: {Regexp: compileRegexp(real16)},
-		},
-		typeUreal: {
-			base2:  {Regexp: compileRegexp(ureal2)},
-			base8:  {Regexp: compileRegexp(ureal8)},
-			base10: {Regexp: compileRegexp(ureal10)},
-			base16: {Regexp: compileRegexp(ureal16)},
-		},
-	}
-
-	for t := range regexps {
-		for b := range regexps[t] {
-			regexps[t][b].Groups = regexps[t][b].Regexp.SubexpNames()
+	return n.Sprint(PrintCanonical)
+}
+
+// Sprint returns textual representation of number according to policy. Numbers
+// created with NewFromValue have no literal and are always printed canonically.
+func (n *Number) Sprint(policy PrintPolicy) string {
+	if policy == PrintLiteral && n.literal != "" {
+		return n.literal
+	}
+
+	switch n.kind {
+	case KindInteger:
+		return n.integer.String()
+	case KindRational:
+		return n.rational.RatString()
+	case KindReal:
+		return formatReal(n.float, true)
+	case KindExactComplex:
+		var re string
+		if n.re.Sign() != 0 {
+			re = n.re.RatString()
 		}
+		return joinComplex(re, n.im.RatString())
 	}
+
+	var re string
+	if r := real(n.complex); r != 0 {
+		re = formatReal(r, true)
+	}
+
+	return joinComplex(re, formatReal(imag(n.complex), true))
 }
 
-func compileRegexp(s string) *regexp.Regexp {
-	return regexp.MustCompile(`^(` + s + `)$`)
+// joinComplex returns rectangular notation of complex number with given
+// parts. Empty real part is omitted and unit imaginary part is written as
+// sign only.
+func joinComplex(re, im string) string {
+	var sb strings.Builder
+
+	sb.WriteString(re)
+
+	switch {
+	case im == "1":
+		sb.WriteRune('+')
+	case im == "-1":
+		sb.WriteRune('-')
+	default:
+		if im[0] != '-' && im[0] != '+' {
+			sb.WriteRune('+')
+		}
+		sb.WriteString(im)
+	}
+
+	sb.WriteRune('i')
+
+	return sb.String()
+}
+
+// Parse parses literal at runtime, as string->number does. Literal without
+// radix prefix is read in defaultRadix, which must be 2, 8, 10 or 16.
+func Parse(literal string, defaultRadix int) (*Number, error) {
+	var prefix string
+
+	switch defaultRadix {
+	case base2:
+		prefix = "#b"
+	case base8:
+		prefix = "#o"
+	case base10:
+	case base16:
+		prefix = "#x"
+	default:
+		return nil, fmt.Errorf("%w: %d", INVALID_RADIX, defaultRadix)
+	}
+
+	if !hasRadixPrefix(literal) {
+		literal = prefix + literal
+	}
+
+	return NewFromLiteral(literal).Parse()
+}
+
+// hasRadixPrefix reports whether prefix of literal has radix mark.
+func hasRadixPrefix(literal string) bool {
+	for i := 0; i+1 < len(literal) && literal[i] == '#'; i += 2 {
+		if strings.IndexByte("bodxBODX", literal[i+1]) >= 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isNumber reports whether literal is <number>.
+func isNumber(literal string) bool {
+	_, ok := scan(literal)
+	return ok
 }
 
 func NewFromLiteral(literal string) *Number {
 	return &Number{
 		literal:  literal,
-		isNumber: regexps[typeNumber][baseN].Regexp.MatchString(literal),
+		isNumber: isNumber(literal),
 	}
 }
 
+// NewFromValue returns number with given value. Exact values are converted
+// from float exactly, so NewFromRat should be used to create exact rationals
+// which have no float representation. Infinities and NaN are always inexact.
 func NewFromValue(value complex128, inexact bool) *Number {
+	n := &Number{isNumber: true, radixVal: 10}
+
+	if imag(value) != 0 {
+		n.setComplex(value, inexact)
+		return n
+	}
+
+	r := real(value)
+	if inexact || math.IsInf(r, 0) || math.IsNaN(r) {
+		n.setReal(r)
+		return n
+	}
+
+	n.setExact(new(big.Rat).SetFloat64(r))
+
+	return n
+}
+
+// NewFromRat returns exact real number with value of r.
+func NewFromRat(r *big.Rat) *Number {
+	n := &Number{isNumber: true, radixVal: 10}
+	n.setExact(new(big.Rat).Set(r))
+
+	return n
+}
+
+// NewFromInt returns exact integer number with value of i.
+func NewFromInt(i *big.Int) *Number {
 	return &Number{
-		complex:  value,
-		inexact:  inexact,
+		kind:     KindInteger,
+		integer:  new(big.Int).Set(i),
 		isNumber: true,
 		radixVal: 10,
 	}
 }
 
+// Literal returns source literal number was created from, if any.
+func (n *Number) Literal() string {
+	return n.literal
+}
+
 func (n *Number) IsNumber() bool {
 	return n.isNumber
 }
 
+func (n *Number) Kind() Kind {
+	return n.kind
+}
+
 func (n *Number) Inexact() bool {
-	return n.inexact
+	return n.kind == KindReal || n.kind == KindComplex
 }
 
+// Value returns value of number as complex128. Exact numbers which have no
+// float64 representation are approximated.
 func (n *Number) Value() complex128 {
-	return n.complex
+	switch n.kind {
+	case KindComplex:
+		return n.complex
+	case KindExactComplex:
+		im, _ := n.im.Float64()
+		return complex(n.Float(), im)
+	default:
+		return complex(n.Float(), 0)
+	}
 }
 
-func (n *Number) Parse() *Number {
-	groupVals := n.getGroupVals(n.literal, typeNumber, baseN)
+// Float returns value of real number, or real part of complex one, as float64.
+func (n *Number) Float() float64 {
+	switch n.kind {
+	case KindInteger:
+		return toFloat(n.integer)
+	case KindRational:
+		f, _ := n.rational.Float64()
+		return f
+	case KindReal:
+		return n.float
+	case KindExactComplex:
+		f, _ := n.re.Float64()
+		return f
+	default:
+		return real(n.complex)
+	}
+}
 
-	n.parsePrefix(groupVals["prefix"])
-	n.parseComplex(groupVals["complex"])
+// Integer returns value of exact integer number, or nil for any other number.
+func (n *Number) Integer() *big.Int {
+	if n.kind != KindInteger {
+		return nil
+	}
 
-	return n
+	return n.integer
 }
 
-func (n *Number) parseComplex(literal string) {
-	groupVals := n.getGroupVals(literal, typeComplex, n.radixVal)
+// Words returns number of machine words digits of exact number take, or 1
+// for inexact number, which is of fixed size.
+func (n *Number) Words() int {
+	switch n.kind {
+	case KindInteger:
+		return max(len(n.integer.Bits()), 1)
+	case KindRational:
+		return len(n.rational.Num().Bits()) + len(n.rational.Denom().Bits())
+	case KindExactComplex:
+		return len(n.re.Num().Bits()) + len(n.re.Denom().Bits()) + len(n.im.Num().Bits()) + len(n.im.Denom().Bits())
+	default:
+		return 1
+	}
+}
+
+// Rat returns value of exact real number, or nil for any other number.
+func (n *Number) Rat() *big.Rat {
+	switch n.kind {
+	case KindInteger:
+		return new(big.Rat).SetInt(n.integer)
+	case KindRational:
+		return new(big.Rat).Set(n.rational)
+	default:
+		return nil
+	}
+}
+
+// setExact makes n exact real with value r.
+func (n *Number) setExact(r *big.Rat) {
+	if r.IsInt() {
+		n.kind, n.integer = KindInteger, new(big.Int).Set(r.Num())
+	} else {
+		n.kind, n.rational = KindRational, r
+	}
+}
+
+// setReal makes n inexact real with value f.
+func (n *Number) setReal(f float64) {
+	n.kind, n.float = KindReal, f
+}
 
+// setComplex makes n complex with value c, or real if c has no imaginary part.
+func (n *Number) setComplex(c complex128, inexact bool) {
+	switch {
+	case !inexact:
+		n.setGaussian(new(big.Rat).SetFloat64(real(c)), new(big.Rat).SetFloat64(imag(c)))
+	case imag(c) != 0:
+		n.kind, n.complex = KindComplex, c
+	default:
+		n.setReal(real(c))
+	}
+}
+
+// setGaussian makes n exact complex with given parts, or exact real if im is
+// zero.
+func (n *Number) setGaussian(re, im *big.Rat) {
+	if im.Sign() == 0 {
+		n.setExact(re)
+		return
+	}
+
+	n.kind, n.re, n.im = KindExactComplex, re, im
+}
+
+// parts returns real and imaginary parts of exact number. They may be shared
+// with n, so they must not be modified.
+func (n *Number) parts() (*big.Rat, *big.Rat) {
+	if n.kind == KindExactComplex {
+		return n.re, n.im
+	}
+
+	return n.Rat(), new(big.Rat)
+}
+
+// Parse computes value of number from its literal. It fails if literal is
+// not a number or denotes no value, e.g. 1/0.
+func (n *Number) Parse() (*Number, error) {
+	stx, ok := scan(n.literal)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", INVALID_NUMBER, n.literal)
+	}
+
+	n.radixVal, n.exact, n.inexact = stx.radix, stx.exact, stx.inexact
+
+	if err := n.parseComplex(stx); err != nil {
+		return nil, fmt.Errorf("%w: %s", err, n.literal)
+	}
+
+	return n, nil
+}
+
+// parseComplex computes value of number from parts of its literal.
+func (n *Number) parseComplex(stx syntax) error {
 	var (
-		rVal = n.parseReal(groupVals["complexReal"])
-		iVal float64
+		iVal   float64
+		iExact = new(big.Rat)
 	)
 
-	if strings.ContainsRune(literal, '@') {
-		iRaw := n.parseReal(groupVals["complexImag"])
-		sin := math.Sin(iRaw)
-		if math.Abs(sin) > 1e-52 {
+	rVal, rExact, err := n.parseReal(stx.re)
+	if err != nil {
+		return err
+	}
+
+	if stx.polar {
+		angle, angleExact, err := n.parseReal(stx.im)
+		if err != nil {
+			return err
+		}
+		if angleExact == nil || angleExact.Sign() != 0 {
+			iVal = rVal * math.Sin(angle)
+			rVal = rVal * math.Cos(angle)
+			rExact, iExact = nil, nil
 			n.inexact = true
 		}
-		iVal = rVal * sin
-		rVal = rVal * math.Cos(iRaw)
-	} else if strings.ContainsRune(literal, 'i') {
-		iRaw := 1.0
-		if groupVals["complexImag"] != "" {
-			iRaw = n.parseUreal(groupVals["complexImag"])
+	} else if stx.hasImag {
+		if iVal, iExact, err = n.parseReal(stx.im); err != nil {
+			return err
+		}
+	}
+
+	if n.exact {
+		n.inexact = false
+		if rExact == nil {
+			rExact = new(big.Rat).SetFloat64(rVal)
+		}
+		if iExact == nil {
+			iExact = new(big.Rat).SetFloat64(iVal)
 		}
-		iVal = n.getSign(groupVals["complexImagSign"]) * iRaw
 	}
 
-	n.complex = complex(rVal, iVal)
+	if !n.inexact && rExact != nil && iExact != nil {
+		n.setGaussian(rExact, iExact)
+		return nil
+	}
+
+	n.setComplex(complex(rVal, iVal), true)
+
+	return nil
 }
 
-func (n *Number) parseReal(literal string) float64 {
-	if literal == "" {
-		return 0
+// parseReal returns value of real and, when it is known, its exact value.
+func (n *Number) parseReal(r realSyntax) (float64, *big.Rat, error) {
+	if !r.hasDigits() {
+		return 0, new(big.Rat), nil
+	}
+
+	if r.infnan != "" {
+		if n.exact {
+			return 0, nil, INVALID_NUMBER
+		}
+		n.inexact = true
+		if r.infnan == "nan.0" {
+			return math.NaN(), nil, nil
+		}
+		return math.Inf(int(n.getSign(r.sign))), nil, nil
 	}
 
-	groupVals := n.getGroupVals(literal, typeReal, n.radixVal)
+	ureal, exact, err := n.parseUreal(r)
+	if err != nil {
+		return 0, nil, err
+	}
 
-	ureal := n.parseUreal(groupVals["realUreal"])
+	if r.sign == '-' && exact != nil {
+		exact.Neg(exact)
+	}
 
-	return n.getSign(groupVals["realSign"]) * ureal
+	return n.getSign(r.sign) * ureal, exact, nil
 }
 
-func (n *Number) parseUreal(literal string) float64 {
-	groupVals := n.getGroupVals(literal, typeUreal, n.radixVal)
+// parseUreal returns value of unsigned real and, when it is known, its exact
+// value. Exact value of decimal is known only when #e prefix demands it.
+func (n *Number) parseUreal(r realSyntax) (float64, *big.Rat, error) {
+	if r.decimal != "" {
+		return n.parseDecimal(r.decimal)
+	}
 
-	if groupVals["decimal"] != "" {
-		return n.parseDecimal(groupVals["decimal"])
+	dividend, err := n.parseUint(r.dividend)
+	if err != nil {
+		return 0, nil, err
 	}
 
-	dividend := n.parseUint(groupVals["dividend"])
+	divisor := big.NewInt(1)
+	if r.divisor != "" {
+		if divisor, err = n.parseUint(r.divisor); err != nil {
+			return 0, nil, err
+		}
+	}
 
-	divisor := 1.0
-	if strings.ContainsRune(literal, '/') {
-		divisor = n.parseUint(groupVals["divisor"])
+	if divisor.Sign() == 0 {
+		return 0, nil, DIVISION_BY_ZERO
 	}
 
-	return dividend / divisor
+	exact := new(big.Rat).SetFrac(dividend, divisor)
+	value, _ := exact.Float64()
+
+	return value, exact, nil
 }
 
-func (n *Number) parseDecimal(literal string) float64 {
+// parseDecimal returns value of decimal. Decimals out of float64 range are
+// rounded to infinity or zero.
+func (n *Number) parseDecimal(literal string) (float64, *big.Rat, error) {
 	literal = strings.Map(func(r rune) rune {
 		switch r {
-		case 's', 'f', 'd', 'l':
+		case 's', 'f', 'd', 'l', 'S', 'F', 'D', 'L', 'E':
 			return 'e'
 		case '#':
 			n.inexact = true
@@ -225,64 +487,64 @@ func (n *Number) parseDecimal(literal string) float64 {
 		n.inexact = true
 	}
 
-	value, err := strconv.ParseFloat(literal, 0)
-	if err != nil {
-		panic(err)
+	value, err := strconv.ParseFloat(literal, 64)
+	if err != nil && !errors.Is(err, strconv.ErrRange) {
+		return 0, nil, fmt.Errorf("%w: %w", INVALID_NUMBER, err)
 	}
 
-	return value
+	if !n.exact {
+		return value, nil, nil
+	}
+
+	exact, ok := new(big.Rat).SetString(literal)
+	if !ok {
+		return 0, nil, INVALID_NUMBER
+	}
+
+	return value, exact, nil
 }
 
-func (n *Number) parseUint(literal string) float64 {
+func (n *Number) parseUint(literal string) (*big.Int, error) {
 	if strings.ContainsRune(literal, '#') {
 		literal = strings.ReplaceAll(literal, "#", "0")
 		n.inexact = true
 	}
 
-	value, err := strconv.ParseInt(literal, n.radixVal, 0)
-	if err != nil {
-		panic(err)
+	value, ok := new(big.Int).SetString(literal, n.radixVal)
+	if !ok {
+		return nil, INVALID_NUMBER
 	}
 
-	return float64(value)
+	return value, nil
 }
 
-func (n *Number) parsePrefix(literal string) {
+func formatReal(f float64, inexact bool) string {
 	switch {
-	case strings.ContainsRune(literal, 'b'):
-		n.radixVal = base2
-	case strings.ContainsRune(literal, 'o'):
-		n.radixVal = base8
-	case strings.ContainsRune(literal, 'x'):
-		n.radixVal = base16
+	case math.IsInf(f, 1):
+		return "+inf.0"
+	case math.IsInf(f, -1):
+		return "-inf.0"
+	case math.IsNaN(f):
+		return "+nan.0"
+	case inexact:
+		s := strconv.FormatFloat(f, 'g', -1, 64)
+		if !strings.ContainsAny(s, ".e") {
+			s += ".0"
+		}
+		return s
 	default:
-		n.radixVal = base10
-	}
-
-	if strings.ContainsRune(literal, 'i') {
-		n.inexact = true
+		return new(big.Rat).SetFloat64(f).RatString()
 	}
 }
 
-func (n *Number) getGroupVals(l string, t, b int) map[string]string {
-	regex := regexps[t][b].Regexp
-	groups := regexps[t][b].Groups
-
-	matches := regex.FindStringSubmatch(l)
-
-	vals := make(map[string]string, len(matches))
-
-	for i, match := range matches {
-		if match != "" && groups[i] != "" {
-			vals[groups[i]] = match
-		}
-	}
-
-	return vals
+// toFloat returns float64 closest to i.
+func toFloat(i *big.Int) float64 {
+	f, _ := new(big.Float).SetInt(i).Float64()
+	return f
 }
 
-func (n *Number) getSign(l string) float64 {
-	if l == "-" {
+func (n *Number) getSign(sign byte) float64 {
+	if sign == '-' {
 		return -1
 	}
 
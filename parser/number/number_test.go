@@ -0,0 +1,327 @@
+package number_test
+
+import (
+	"errors"
+	"github.com/vkhonin/scheme/parser/number"
+	"math"
+	"math/big"
+	"testing"
+)
+
+type sprintTestCase struct {
+	Literal   string
+	Canonical string
+}
+
+func TestNumber_Sprint(t *testing.T) {
+	testCases := []sprintTestCase{
+		{"#xff", "255"},
+		{"#b-101", "-5"},
+		{"#o17/2", "15/2"},
+		{"#X1A", "26"},
+		{"#I#B1/10", "0.5"},
+		{"1E3", "1000.0"},
+		{"1L2", "100.0"},
+		{"2-3I", "2-3i"},
+		{"#i3", "3.0"},
+		{"1.5", "1.5"},
+		{"-2.5e3", "-2500.0"},
+		{"1#", "10.0"},
+		{"1+2i", "1+2i"},
+		{"+i", "+i"},
+		{"-i", "-i"},
+		{"3-i", "3-i"},
+		{"#i+i", "+1.0i"},
+		{"1.5-2.5i", "1.5-2.5i"},
+	}
+
+	for _, c := range testCases {
+		n := parse(c.Literal)
+
+		if s := n.Sprint(number.PrintLiteral); s != c.Literal {
+			t.Errorf("expected %s got %s for literal policy", c.Literal, s)
+		}
+
+		if s := n.Sprint(number.PrintCanonical); s != c.Canonical {
+			t.Errorf("expected %s got %s for %s", c.Canonical, s, c.Literal)
+		}
+
+		if s := n.String(); s != c.Canonical {
+			t.Errorf("expected %s got %s for %s", c.Canonical, s, c.Literal)
+		}
+	}
+
+	n := number.NewFromValue(complex(42, 0), false)
+
+	if s := n.Sprint(number.PrintLiteral); s != "42" {
+		t.Errorf("expected 42 got %s for value without literal", s)
+	}
+}
+
+var benchmarkLiterals = []string{
+	"0", "42", "-17", "3.14159", "6.02e23", "1/3", "#xff", "#b-101", "#e#o17/2", "1#.#", "1+2i", "-1.5-2.5i", "1@2",
+}
+
+func BenchmarkNumber_Parse(b *testing.B) {
+	b.ReportAllocs()
+
+	for range b.N {
+		for _, l := range benchmarkLiterals {
+			parse(l)
+		}
+	}
+}
+
+// BenchmarkNewFromLiteral measures literal recognition alone, as done by lexer.
+func BenchmarkNewFromLiteral(b *testing.B) {
+	b.ReportAllocs()
+
+	for range b.N {
+		for _, l := range benchmarkLiterals {
+			number.NewFromLiteral(l)
+		}
+	}
+}
+
+// BenchmarkNewFromLiteral_Invalid measures rejection of non-number literals.
+func BenchmarkNewFromLiteral_Invalid(b *testing.B) {
+	b.ReportAllocs()
+
+	for range b.N {
+		for _, l := range []string{"abc", "1/", "#x1.5", "1+2", "--1", "#e#i1", "1e", "1@"} {
+			number.NewFromLiteral(l)
+		}
+	}
+}
+
+func TestNumber_BigInteger(t *testing.T) {
+	testCases := []sprintTestCase{
+		{"#e123456789012345678901234567890", "123456789012345678901234567890"},
+		{"-98765432109876543210", "-98765432109876543210"},
+		{"#x123456789abcdef0123456789abcdef", "1512366075204170929049582354406559215"},
+		{"#b11111111111111111111111111111111111111111111111111111111111111111", "36893488147419103231"},
+		{"#e1#", "10"},
+	}
+
+	for _, c := range testCases {
+		n := parse(c.Literal)
+
+		if n.Integer() == nil || n.Inexact() {
+			t.Errorf("expected exact integer for %s, got %v", c.Literal, n)
+			continue
+		}
+
+		if s := n.Integer().String(); s != c.Canonical {
+			t.Errorf("expected %s got %s for %s", c.Canonical, s, c.Literal)
+		}
+
+		if s := parse(c.Canonical).String(); s != c.Canonical {
+			t.Errorf("expected %s to round-trip, got %s", c.Canonical, s)
+		}
+	}
+
+	if n := parse("1.0"); n.Integer() != nil {
+		t.Errorf("expected no exact integer for 1.0, got %v", n.Integer())
+	}
+
+	if n := number.NewFromInt(big.NewInt(-7)); n.String() != "-7" || n.Value() != -7 {
+		t.Errorf("expected -7, got %v", n)
+	}
+}
+
+func TestNumber_Rational(t *testing.T) {
+	testCases := []sprintTestCase{
+		{"1/3", "1/3"},
+		{"-2/6", "-1/3"},
+		{"4/2", "2"},
+		{"#x-a/f", "-2/3"},
+		{"#e1.5", "3/2"},
+		{"#e1e3", "1000"},
+		{"#e.125", "1/8"},
+		{"#e1#.#", "10"},
+		{"#i1/4", "0.25"},
+		{"#i#b1/10", "0.5"},
+	}
+
+	for _, c := range testCases {
+		if s := parse(c.Literal).String(); s != c.Canonical {
+			t.Errorf("expected %s got %s for %s", c.Canonical, s, c.Literal)
+		}
+	}
+
+	n := parse("1/3")
+
+	if n.Inexact() || n.Integer() != nil || n.Rat().Cmp(big.NewRat(1, 3)) != 0 {
+		t.Errorf("expected exact 1/3, got %v", n)
+	}
+
+	if r := parse("1.5").Rat(); r != nil {
+		t.Errorf("expected no exact value for inexact number, got %v", r)
+	}
+
+	if s := number.NewFromRat(big.NewRat(6, -4)).String(); s != "-3/2" {
+		t.Errorf("expected -3/2 got %s", s)
+	}
+}
+
+func TestNumber_Kind(t *testing.T) {
+	testCases := []struct {
+		Literal string
+		Kind    number.Kind
+		Inexact bool
+		Float   float64
+	}{
+		{"42", number.KindInteger, false, 42},
+		{"#e1.0", number.KindInteger, false, 1},
+		{"1+0i", number.KindInteger, false, 1},
+		{"-1/2", number.KindRational, false, -0.5},
+		{"#e.5", number.KindRational, false, 0.5},
+		{"1.5", number.KindReal, true, 1.5},
+		{"#i3", number.KindReal, true, 3},
+		{"1.0+0.0i", number.KindReal, true, 1},
+		{"1+2i", number.KindExactComplex, false, 1},
+		{"1.5-2i", number.KindComplex, true, 1.5},
+	}
+
+	for _, c := range testCases {
+		n := parse(c.Literal)
+
+		if n.Kind() != c.Kind || n.Inexact() != c.Inexact || n.Float() != c.Float {
+			t.Errorf(
+				"expected kind %d, inexact %v, float %v got %d, %v, %v for %s",
+				c.Kind, c.Inexact, c.Float, n.Kind(), n.Inexact(), n.Float(), c.Literal,
+			)
+		}
+	}
+
+	if n := number.NewFromValue(complex(0.5, 0), false); n.Kind() != number.KindRational || n.String() != "1/2" {
+		t.Errorf("expected exact 1/2 from value, got %v", n)
+	}
+
+	if n := number.NewFromValue(complex(2, 0), true); n.Kind() != number.KindReal || n.String() != "2.0" {
+		t.Errorf("expected inexact 2.0 from value, got %v", n)
+	}
+}
+
+func TestParse(t *testing.T) {
+	testCases := []struct {
+		Literal string
+		Radix   int
+		Result  string
+	}{
+		{"ff", 16, "255"},
+		{"-ff/2", 16, "-255/2"},
+		{"101", 2, "5"},
+		{"#e101", 2, "5"},
+		{"#i101", 2, "5.0"},
+		{"17", 8, "15"},
+		{"#d17", 16, "17"},
+		{"#xff", 10, "255"},
+		{"1.5", 10, "1.5"},
+		{"1+i", 2, "1+i"},
+		{"FF", 16, "255"},
+		{"#XfF", 10, "255"},
+		{"#B101", 16, "5"},
+		{"1E2", 10, "100.0"},
+	}
+
+	for _, c := range testCases {
+		n, err := number.Parse(c.Literal, c.Radix)
+		if err != nil {
+			t.Errorf("unexpected error %v for %s in radix %d", err, c.Literal, c.Radix)
+			continue
+		}
+
+		if s := n.String(); s != c.Result {
+			t.Errorf("expected %s got %s for %s in radix %d", c.Result, s, c.Literal, c.Radix)
+		}
+	}
+
+	for _, l := range []string{"", "abc", "1.5", "12", "#b2"} {
+		if _, err := number.Parse(l, 2); !errors.Is(err, number.INVALID_NUMBER) {
+			t.Errorf("expected invalid number for %q, got %v", l, err)
+		}
+	}
+
+	if _, err := number.Parse("1", 3); !errors.Is(err, number.INVALID_RADIX) {
+		t.Errorf("expected invalid radix, got %v", err)
+	}
+}
+
+func TestNumber_ExactComplex(t *testing.T) {
+	testCases := []sprintTestCase{
+		{"#e1/2+1/3i", "1/2+1/3i"},
+		{"1/2-1/3i", "1/2-1/3i"},
+		{"#e1.5+0.25i", "3/2+1/4i"},
+		{"-2/4i", "-1/2i"},
+		{"0+i", "+i"},
+		{"#e1.0+1.0i", "1+i"},
+		{"#i1/2+1/2i", "0.5+0.5i"},
+	}
+
+	for _, c := range testCases {
+		n := parse(c.Literal)
+
+		if s := n.String(); s != c.Canonical {
+			t.Errorf("expected %s got %s for %s", c.Canonical, s, c.Literal)
+		}
+	}
+
+	if n := parse("1/3+1/3i"); n.Inexact() || n.Kind() != number.KindExactComplex {
+		t.Errorf("expected exact complex, got %v", n)
+	}
+}
+
+func TestNumber_ParseErrors(t *testing.T) {
+	testCases := []struct {
+		Literal string
+		Error   error
+	}{
+		{"1/0", number.DIVISION_BY_ZERO},
+		{"#x-a/0+i", number.DIVISION_BY_ZERO},
+		{"1+1/0i", number.DIVISION_BY_ZERO},
+		{"abc", number.INVALID_NUMBER},
+		{"", number.INVALID_NUMBER},
+		{"#e+inf.0", number.INVALID_NUMBER},
+	}
+
+	for _, c := range testCases {
+		if _, err := number.NewFromLiteral(c.Literal).Parse(); !errors.Is(err, c.Error) {
+			t.Errorf("expected %v got %v for %q", c.Error, err, c.Literal)
+		}
+	}
+
+	if n := parse("1e400"); !math.IsInf(n.Float(), 1) || !n.Inexact() {
+		t.Errorf("expected +inf.0 for 1e400, got %v", n)
+	}
+
+	if n := parse("-1e-400"); n.Float() != 0 || !n.Inexact() {
+		t.Errorf("expected -0.0 for -1e-400, got %v", n)
+	}
+}
+
+func TestNumber_Words(t *testing.T) {
+	testCases := []struct {
+		Input string
+		Words int
+	}{
+		{"0", 1},
+		{"-12", 1},
+		{"18446744073709551616", 2},
+		{"1/18446744073709551616", 3},
+		{"1.5", 1},
+		{"+inf.0", 1},
+		{"1/2+18446744073709551616i", 5},
+	}
+
+	for _, c := range testCases {
+		n, err := number.NewFromLiteral(c.Input).Parse()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if words := n.Words(); words != c.Words {
+			t.Errorf("expected %d words got %d for %s", c.Words, words, c.Input)
+		}
+	}
+}
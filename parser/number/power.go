@@ -0,0 +1,205 @@
+package number
+
+import (
+	"math"
+	"math/big"
+	"math/cmplx"
+)
+
+// maxExactRootDegree bounds degree of roots Expt tries to take exactly. Roots
+// of higher degree of anything but 0 and 1 are not integers anyway for
+// numbers which fit in memory.
+const maxExactRootDegree = 1 << 16
+
+// Expt returns n raised to power m. Result is exact if n is exact and m is
+// exact integer, or if m is exact rational and root of n it demands is
+// exact, e.g. (expt 8 2/3) is exact 4. Exact zero raised to negative power is
+// reported as DIVISION_BY_ZERO.
+func (n *Number) Expt(m *Number) (*Number, error) {
+	if n.IsExact() && m.kind == KindInteger {
+		return n.exptInt(m.integer)
+	}
+
+	if n.IsExact() && n.IsReal() && m.kind == KindRational {
+		base, degree := n.Rat(), m.rational.Denom()
+		if base.Sign() >= 0 && degree.IsInt64() && degree.Int64() <= maxExactRootDegree {
+			if root, ok := exactRoot(base, int(degree.Int64())); ok {
+				return NewFromRat(root).exptInt(m.rational.Num())
+			}
+		}
+	}
+
+	result := &Number{isNumber: true, radixVal: base10}
+
+	if b, e := n.Float(), m.Float(); n.IsReal() && m.IsReal() && (b >= 0 || e == math.Trunc(e) || math.IsNaN(b)) {
+		result.setReal(math.Pow(b, e))
+	} else {
+		result.setComplex(cmplx.Pow(n.Value(), m.Value()), true)
+	}
+
+	return result, nil
+}
+
+// exptInt returns exact n raised to integer power e.
+func (n *Number) exptInt(e *big.Int) (*Number, error) {
+	abs := new(big.Int).Abs(e)
+	result := &Number{isNumber: true, radixVal: base10}
+
+	if n.IsReal() {
+		r := n.Rat()
+		if e.Sign() < 0 {
+			if r.Sign() == 0 {
+				return nil, DIVISION_BY_ZERO
+			}
+			r.Inv(r)
+		}
+
+		num := new(big.Int).Exp(r.Num(), abs, nil)
+		den := new(big.Int).Exp(r.Denom(), abs, nil)
+		result.setExact(new(big.Rat).SetFrac(num, den))
+
+		return result, nil
+	}
+
+	// Gaussian power is computed by repeated squaring.
+	a, b := n.parts()
+	re, im := big.NewRat(1, 1), new(big.Rat)
+	for i := abs.BitLen() - 1; i >= 0; i-- {
+		re, im = gaussianMul(re, im, re, im)
+		if abs.Bit(i) == 1 {
+			re, im = gaussianMul(re, im, a, b)
+		}
+	}
+
+	if e.Sign() < 0 {
+		re, im = gaussianQuo(big.NewRat(1, 1), new(big.Rat), re, im)
+	}
+
+	result.setGaussian(re, im)
+
+	return result, nil
+}
+
+// Sqrt returns principal square root of n. Result is exact if n is exact and
+// its root is exact, e.g. (sqrt 4) is 2, (sqrt -4) is +2i and (sqrt 1/4) is
+// 1/2. Square root of negative real is complex.
+func (n *Number) Sqrt() *Number {
+	result := &Number{isNumber: true, radixVal: base10}
+
+	switch n.kind {
+	case KindInteger, KindRational:
+		r := n.Rat()
+		root, ok := exactRoot(new(big.Rat).Abs(r), 2)
+		switch {
+		case ok && r.Sign() < 0:
+			result.setGaussian(new(big.Rat), root)
+		case ok:
+			result.setExact(root)
+		case r.Sign() < 0:
+			result.setComplex(complex(0, math.Sqrt(-n.Float())), true)
+		default:
+			result.setReal(math.Sqrt(n.Float()))
+		}
+	case KindReal:
+		if n.float < 0 {
+			result.setComplex(complex(0, math.Sqrt(-n.float)), true)
+		} else {
+			result.setReal(math.Sqrt(n.float))
+		}
+	case KindExactComplex:
+		if re, im, ok := gaussianSqrt(n.re, n.im); ok {
+			result.setGaussian(re, im)
+		} else {
+			result.setComplex(cmplx.Sqrt(n.Value()), true)
+		}
+	default:
+		result.setComplex(cmplx.Sqrt(n.complex), true)
+	}
+
+	return result
+}
+
+// ExactIntegerSqrt returns s and r such that n = s² + r and n < (s+1)². It
+// reports DOMAIN_ERROR unless n is exact non-negative integer.
+func (n *Number) ExactIntegerSqrt() (*Number, *Number, error) {
+	if n.kind != KindInteger || n.integer.Sign() < 0 {
+		return nil, nil, DOMAIN_ERROR
+	}
+
+	s := new(big.Int).Sqrt(n.integer)
+	r := new(big.Int).Sub(n.integer, new(big.Int).Mul(s, s))
+
+	return NewFromInt(s), NewFromInt(r), nil
+}
+
+// gaussianSqrt returns exact principal square root of a+bi, if there is one.
+// Root is x+yi with x = √((|z|+a)/2) and y = ±√((|z|-a)/2), where sign of y is
+// sign of b.
+func gaussianSqrt(a, b *big.Rat) (*big.Rat, *big.Rat, bool) {
+	abs, ok := exactRoot(new(big.Rat).Add(new(big.Rat).Mul(a, a), new(big.Rat).Mul(b, b)), 2)
+	if !ok {
+		return nil, nil, false
+	}
+
+	half := big.NewRat(1, 2)
+
+	x, ok := exactRoot(new(big.Rat).Mul(new(big.Rat).Add(abs, a), half), 2)
+	if !ok {
+		return nil, nil, false
+	}
+
+	y, ok := exactRoot(new(big.Rat).Mul(new(big.Rat).Sub(abs, a), half), 2)
+	if !ok {
+		return nil, nil, false
+	}
+
+	if b.Sign() < 0 {
+		y.Neg(y)
+	}
+
+	return x, y, true
+}
+
+// exactRoot returns k-th root of non-negative r if it is rational.
+func exactRoot(r *big.Rat, k int) (*big.Rat, bool) {
+	num, ok := intRoot(r.Num(), k)
+	if !ok {
+		return nil, false
+	}
+
+	den, ok := intRoot(r.Denom(), k)
+	if !ok {
+		return nil, false
+	}
+
+	return new(big.Rat).SetFrac(num, den), true
+}
+
+// intRoot returns k-th root of non-negative x if it is integer. Root is found
+// by Newton's method starting above it, so iterations decrease monotonically.
+func intRoot(x *big.Int, k int) (*big.Int, bool) {
+	if x.Sign() == 0 || k == 1 {
+		return new(big.Int).Set(x), true
+	}
+
+	var root *big.Int
+
+	if k == 2 {
+		root = new(big.Int).Sqrt(x)
+	} else {
+		root = new(big.Int).Lsh(big.NewInt(1), uint((x.BitLen()+k-1)/k))
+		bigK, bigK1 := big.NewInt(int64(k)), big.NewInt(int64(k-1))
+		for {
+			next := new(big.Int).Exp(root, bigK1, nil)
+			next.Quo(x, next)
+			next.Add(next, new(big.Int).Mul(bigK1, root))
+			next.Quo(next, bigK)
+			if next.Cmp(root) >= 0 {
+				break
+			}
+			root = next
+		}
+	}
+
+	return root, new(big.Int).Exp(root, big.NewInt(int64(k)), nil).Cmp(x) == 0
+}
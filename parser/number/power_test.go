@@ -0,0 +1,95 @@
+package number_test
+
+import (
+	"errors"
+	"github.com/vkhonin/scheme/parser/number"
+	"testing"
+)
+
+func TestNumber_Expt(t *testing.T) {
+	runArithTestCases(t, "^", func(a, b *number.Number) *number.Number {
+		n, err := a.Expt(b)
+		if err != nil {
+			t.Fatalf("unexpected error %v for (expt %v %v)", err, a, b)
+		}
+		return n
+	}, []arithTestCase{
+		{"2", "10", "1024"},
+		{"2", "100", "1267650600228229401496703205376"},
+		{"2", "-2", "1/4"},
+		{"-2/3", "3", "-8/27"},
+		{"7", "0", "1"},
+		{"0", "0", "1"},
+		{"0", "5", "0"},
+		{"4", "1/2", "2"},
+		{"8", "2/3", "4"},
+		{"1/4", "-1/2", "2"},
+		{"+i", "2", "-1"},
+		{"1+i", "4", "-4"},
+		{"1+i", "-1", "1/2-1/2i"},
+		{"2", "0.5", "1.4142135623730951"},
+		{"2.0", "3", "8.0"},
+		{"2", "1/2", "1.4142135623730951"},
+		{"-8.0", "2", "64.0"},
+		{"-1", "0.5", "6.123233995736757e-17+1.0i"},
+	})
+
+	if _, err := parse("0").Expt(parse("-1")); !errors.Is(err, number.DIVISION_BY_ZERO) {
+		t.Errorf("expected division by zero, got %v", err)
+	}
+
+	if n, err := parse("0.0").Expt(parse("-1")); err != nil || n.String() != "+inf.0" {
+		t.Errorf("expected +inf.0, got %v, %v", n, err)
+	}
+}
+
+func TestNumber_Sqrt(t *testing.T) {
+	testCases := []sprintTestCase{
+		{"4", "2"},
+		{"0", "0"},
+		{"1/4", "1/2"},
+		{"-4", "+2i"},
+		{"-9/4", "+3/2i"},
+		{"152415787532388367504942236884722755800955129", "12345678901234567890123"},
+		{"2", "1.4142135623730951"},
+		{"-2", "+1.4142135623730951i"},
+		{"4.0", "2.0"},
+		{"-4.0", "+2.0i"},
+		{"-3+4i", "1+2i"},
+		{"-3-4i", "1-2i"},
+		{"+2i", "1+i"},
+		{"+i", "0.7071067811865476+0.7071067811865476i"},
+	}
+
+	for _, c := range testCases {
+		if s := parse(c.Literal).Sqrt().String(); s != c.Canonical {
+			t.Errorf("expected (sqrt %s) = %s got %s", c.Literal, c.Canonical, s)
+		}
+	}
+}
+
+func TestNumber_ExactIntegerSqrt(t *testing.T) {
+	testCases := []struct {
+		Literal string
+		S, R    string
+	}{
+		{"0", "0", "0"},
+		{"4", "2", "0"},
+		{"5", "2", "1"},
+		{"99", "9", "18"},
+		{"100000000000000000000000000000000000001", "10000000000000000000", "1"},
+	}
+
+	for _, c := range testCases {
+		s, r, err := parse(c.Literal).ExactIntegerSqrt()
+		if err != nil || s.String() != c.S || r.String() != c.R {
+			t.Errorf("expected %s %s got %v %v (%v) for %s", c.S, c.R, s, r, err, c.Literal)
+		}
+	}
+
+	for _, l := range []string{"-1", "4.0", "1/4", "+i"} {
+		if _, _, err := parse(l).ExactIntegerSqrt(); !errors.Is(err, number.DOMAIN_ERROR) {
+			t.Errorf("expected domain error for %s, got %v", l, err)
+		}
+	}
+}
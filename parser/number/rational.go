@@ -0,0 +1,88 @@
+package number
+
+import (
+	"math/big"
+)
+
+// GCD returns greatest common divisor of integers n and m, which is always
+// non-negative. Result is inexact if either operand is, e.g. (gcd 4.0 6) is
+// 2.0. GCD reports DOMAIN_ERROR if either operand is not integer.
+func (n *Number) GCD(m *Number) (*Number, error) {
+	return n.integerOp(m, func(a, b *big.Int) *big.Int {
+		return new(big.Int).GCD(nil, nil, new(big.Int).Abs(a), new(big.Int).Abs(b))
+	})
+}
+
+// LCM returns least common multiple of integers n and m, which is always
+// non-negative. Result is inexact if either operand is. LCM reports
+// DOMAIN_ERROR if either operand is not integer.
+func (n *Number) LCM(m *Number) (*Number, error) {
+	return n.integerOp(m, func(a, b *big.Int) *big.Int {
+		if a.Sign() == 0 || b.Sign() == 0 {
+			return new(big.Int)
+		}
+		gcd := new(big.Int).GCD(nil, nil, new(big.Int).Abs(a), new(big.Int).Abs(b))
+		lcm := new(big.Int).Mul(a, b)
+		return lcm.Abs(lcm.Quo(lcm, gcd))
+	})
+}
+
+// Numerator returns numerator of rational n in lowest terms, computed as if n
+// was exact. Result is inexact if n is, e.g. (numerator 0.5) is 1.0.
+// Numerator reports DOMAIN_ERROR if n is not rational.
+func (n *Number) Numerator() (*Number, error) {
+	return n.rationalPart((*big.Rat).Num)
+}
+
+// Denominator returns positive denominator of rational n in lowest terms,
+// computed as if n was exact. Result is inexact if n is, e.g. (denominator
+// 0.5) is 2.0. Denominator reports DOMAIN_ERROR if n is not rational.
+func (n *Number) Denominator() (*Number, error) {
+	return n.rationalPart((*big.Rat).Denom)
+}
+
+// integerOp applies op to exact values of integers n and m.
+func (n *Number) integerOp(m *Number, op func(a, b *big.Int) *big.Int) (*Number, error) {
+	if !n.IsInteger() || !m.IsInteger() {
+		return nil, DOMAIN_ERROR
+	}
+
+	return newFromInt(op(n.exactInt(), m.exactInt()), n.Inexact() || m.Inexact()), nil
+}
+
+// rationalPart returns part of exact value of rational n.
+func (n *Number) rationalPart(part func(r *big.Rat) *big.Int) (*Number, error) {
+	if !n.IsRational() {
+		return nil, DOMAIN_ERROR
+	}
+
+	r := n.Rat()
+	if r == nil {
+		r = new(big.Rat).SetFloat64(n.float)
+	}
+
+	return newFromInt(part(r), n.Inexact()), nil
+}
+
+// exactInt returns exact value of integer n.
+func (n *Number) exactInt() *big.Int {
+	if n.kind == KindInteger {
+		return n.integer
+	}
+
+	i, _ := big.NewFloat(n.float).Int(nil)
+
+	return i
+}
+
+// newFromInt returns integer number with value of i, inexact if requested.
+func newFromInt(i *big.Int, inexact bool) *Number {
+	if !inexact {
+		return NewFromInt(i)
+	}
+
+	result := &Number{isNumber: true, radixVal: base10}
+	result.setReal(toFloat(i))
+
+	return result
+}
@@ -0,0 +1,74 @@
+package number_test
+
+import (
+	"errors"
+	"github.com/vkhonin/scheme/parser/number"
+	"testing"
+)
+
+func TestNumber_GCD(t *testing.T) {
+	testCases := []struct {
+		A, B     string
+		GCD, LCM string
+	}{
+		{"32", "-36", "4", "288"},
+		{"-4", "6", "2", "12"},
+		{"0", "5", "5", "0"},
+		{"0", "0", "0", "0"},
+		{"4.0", "6", "2.0", "12.0"},
+		{"123456789012345678901234567890", "987654321098765432109876543210", "9000000000900000000090", "13548070124980948012498094801236261410"},
+	}
+
+	for _, c := range testCases {
+		a, b := parse(c.A), parse(c.B)
+
+		if n, err := a.GCD(b); err != nil || n.String() != c.GCD {
+			t.Errorf("expected (gcd %s %s) = %s got %v (%v)", c.A, c.B, c.GCD, n, err)
+		}
+
+		if n, err := a.LCM(b); err != nil || n.String() != c.LCM {
+			t.Errorf("expected (lcm %s %s) = %s got %v (%v)", c.A, c.B, c.LCM, n, err)
+		}
+	}
+
+	for _, l := range []string{"1/2", "1.5", "+i"} {
+		if _, err := parse(l).GCD(parse("2")); !errors.Is(err, number.DOMAIN_ERROR) {
+			t.Errorf("expected domain error for (gcd %s 2), got %v", l, err)
+		}
+
+		if _, err := parse("2").LCM(parse(l)); !errors.Is(err, number.DOMAIN_ERROR) {
+			t.Errorf("expected domain error for (lcm 2 %s), got %v", l, err)
+		}
+	}
+}
+
+func TestNumber_Numerator(t *testing.T) {
+	testCases := []struct {
+		Literal                string
+		Numerator, Denominator string
+	}{
+		{"6/4", "3", "2"},
+		{"-6/4", "-3", "2"},
+		{"5", "5", "1"},
+		{"0", "0", "1"},
+		{"0.5", "1.0", "2.0"},
+		{"-0.75", "-3.0", "4.0"},
+		{"3.0", "3.0", "1.0"},
+	}
+
+	for _, c := range testCases {
+		n := parse(c.Literal)
+
+		if num, err := n.Numerator(); err != nil || num.String() != c.Numerator {
+			t.Errorf("expected (numerator %s) = %s got %v (%v)", c.Literal, c.Numerator, num, err)
+		}
+
+		if den, err := n.Denominator(); err != nil || den.String() != c.Denominator {
+			t.Errorf("expected (denominator %s) = %s got %v (%v)", c.Literal, c.Denominator, den, err)
+		}
+	}
+
+	if _, err := parse("1+i").Numerator(); !errors.Is(err, number.DOMAIN_ERROR) {
+		t.Errorf("expected domain error, got %v", err)
+	}
+}
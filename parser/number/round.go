@@ -0,0 +1,76 @@
+package number
+
+import (
+	"math"
+	"math/big"
+)
+
+// Floor returns largest integer not greater than n. Result is exact if n is
+// exact. Floor reports DOMAIN_ERROR if n is complex.
+func (n *Number) Floor() (*Number, error) {
+	return n.round(math.Floor, floorQuo)
+}
+
+// Ceiling returns smallest integer not less than n. Result is exact if n is
+// exact. Ceiling reports DOMAIN_ERROR if n is
+// complex.
+func (n *Number) Ceiling() (*Number, error) {
+	return n.round(math.Ceil, func(num, den *big.Int) *big.Int {
+		q := floorQuo(num, den)
+		if new(big.Int).Mul(q, den).Cmp(num) != 0 {
+			q.Add(q, big.NewInt(1))
+		}
+		return q
+	})
+}
+
+// Round returns integer closest to n, rounding to even when n is halfway
+// between two integers, so (round 2.5) is 2.0 and (round 7/2) is 4. Result is
+// exact if n is exact. Round reports DOMAIN_ERROR if n is complex.
+func (n *Number) Round() (*Number, error) {
+	return n.round(math.RoundToEven, func(num, den *big.Int) *big.Int {
+		q, m := new(big.Int).DivMod(num, den, new(big.Int))
+		switch m.Lsh(m, 1).Cmp(den) {
+		case 1:
+			q.Add(q, big.NewInt(1))
+		case 0:
+			if q.Bit(0) == 1 {
+				q.Add(q, big.NewInt(1))
+			}
+		}
+		return q
+	})
+}
+
+// Truncate returns integer closest to n whose absolute value is not greater
+// than that of n. Result is exact if n is exact. Truncate reports
+// DOMAIN_ERROR if n is complex.
+func (n *Number) Truncate() (*Number, error) {
+	return n.round(math.Trunc, func(num, den *big.Int) *big.Int {
+		return new(big.Int).Quo(num, den)
+	})
+}
+
+// round applies floatOp to inexact real and ratOp to numerator and positive
+// denominator of exact rational. Exact integers are returned as is, as well
+// as infinities and NaN. Complex numbers are reported as DOMAIN_ERROR.
+func (n *Number) round(floatOp func(float64) float64, ratOp func(num, den *big.Int) *big.Int) (*Number, error) {
+	switch n.kind {
+	case KindInteger:
+		return n, nil
+	case KindRational:
+		return NewFromInt(ratOp(n.rational.Num(), n.rational.Denom())), nil
+	case KindReal:
+		result := &Number{isNumber: true, radixVal: base10}
+		result.setReal(floatOp(n.float))
+		return result, nil
+	default:
+		return nil, DOMAIN_ERROR
+	}
+}
+
+// floorQuo returns num/den rounded towards negative infinity. Denominator must
+// be positive.
+func floorQuo(num, den *big.Int) *big.Int {
+	return new(big.Int).Div(num, den)
+}
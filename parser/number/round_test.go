@@ -0,0 +1,64 @@
+package number_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/vkhonin/scheme/parser/number"
+)
+
+func TestNumber_Round(t *testing.T) {
+	testCases := []struct {
+		Literal                         string
+		Floor, Ceiling, Round, Truncate string
+	}{
+		{"3", "3", "3", "3", "3"},
+		{"-3", "-3", "-3", "-3", "-3"},
+		{"7/2", "3", "4", "4", "3"},
+		{"5/2", "2", "3", "2", "2"},
+		{"-7/2", "-4", "-3", "-4", "-3"},
+		{"-5/2", "-3", "-2", "-2", "-2"},
+		{"1/3", "0", "1", "0", "0"},
+		{"-1/3", "-1", "0", "0", "0"},
+		{"5/3", "1", "2", "2", "1"},
+		{"-4.3", "-5.0", "-4.0", "-4.0", "-4.0"},
+		{"3.5", "3.0", "4.0", "4.0", "3.0"},
+		{"2.5", "2.0", "3.0", "2.0", "2.0"},
+		{"-2.5", "-3.0", "-2.0", "-2.0", "-2.0"},
+		{"#i7", "7.0", "7.0", "7.0", "7.0"},
+		{"123456789012345678901234567891/2", "61728394506172839450617283945", "61728394506172839450617283946", "61728394506172839450617283946", "61728394506172839450617283945"},
+	}
+
+	for _, c := range testCases {
+		n := parse(c.Literal)
+
+		if r, err := n.Floor(); err != nil || r.String() != c.Floor {
+			t.Errorf("expected (floor %s) = %s got %v, %v", c.Literal, c.Floor, r, err)
+		}
+
+		if r, err := n.Ceiling(); err != nil || r.String() != c.Ceiling {
+			t.Errorf("expected (ceiling %s) = %s got %v, %v", c.Literal, c.Ceiling, r, err)
+		}
+
+		if r, err := n.Round(); err != nil || r.String() != c.Round {
+			t.Errorf("expected (round %s) = %s got %v, %v", c.Literal, c.Round, r, err)
+		}
+
+		if r, err := n.Truncate(); err != nil || r.String() != c.Truncate {
+			t.Errorf("expected (truncate %s) = %s got %v, %v", c.Literal, c.Truncate, r, err)
+		}
+	}
+}
+
+func TestNumber_Round_Complex(t *testing.T) {
+	for _, l := range []string{"1+2i", "+i", "1.5+2.5i", "-1/2-1/3i"} {
+		n := parse(l)
+		for name, round := range map[string]func() (*number.Number, error){
+			"floor": n.Floor, "ceiling": n.Ceiling, "round": n.Round, "truncate": n.Truncate,
+		} {
+			if r, err := round(); !errors.Is(err, number.DOMAIN_ERROR) {
+				t.Errorf("expected domain error for (%s %s) got %v, %v", name, l, r, err)
+			}
+		}
+	}
+}
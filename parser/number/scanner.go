@@ -0,0 +1,301 @@
+package number
+
+import (
+	"strings"
+)
+
+// syntax holds parts of number literal as in <number> (7.1.1. Lexical
+// structure). Parts are substrings of literal, so scanning allocates nothing.
+type syntax struct {
+	radix int
+
+	// exact and inexact are set by #e and #i prefixes.
+	exact, inexact bool
+
+	// re and im are real and imaginary parts, or magnitude and angle when
+	// polar is set.
+	re, im  realSyntax
+	hasImag bool
+	polar   bool
+}
+
+// realSyntax is <real>, i.e. optional sign followed by <ureal>. Real without
+// digits has value 0.
+type realSyntax struct {
+	sign     byte
+	dividend string
+	divisor  string // Non-empty for rational, e.g. 2 in 1/2
+	decimal  string // Non-empty for decimal, e.g. 1.5e3
+	infnan   string // Non-empty for infinity or NaN, i.e. inf.0 or nan.0
+}
+
+// scanner is recursive descent recognizer of <number>. Case of letters is not
+// significant, so #X1A and 1E5 are numbers.
+type scanner struct {
+	src   string
+	pos   int
+	radix int
+}
+
+// scan recognizes literal as <number> and returns its parts.
+func scan(literal string) (syntax, bool) {
+	s := scanner{src: literal, radix: base10}
+
+	var stx syntax
+
+	if !s.scanPrefix(&stx) || !s.scanComplex(&stx) || s.pos != len(s.src) {
+		return syntax{}, false
+	}
+
+	stx.radix = s.radix
+
+	return stx, true
+}
+
+func (r *realSyntax) hasDigits() bool {
+	return r.dividend != "" || r.decimal != "" || r.infnan != ""
+}
+
+// peek returns current byte of literal, or 0 at its end.
+func (s *scanner) peek() byte {
+	if s.pos < len(s.src) {
+		return s.src[s.pos]
+	}
+
+	return 0
+}
+
+// scanPrefix scans <prefix>, which is radix and exactness in any order, both
+// optional.
+func (s *scanner) scanPrefix(stx *syntax) bool {
+	var hasRadix, hasExactness bool
+
+	for s.peek() == '#' && s.pos+1 < len(s.src) {
+		switch mark := lower(s.src[s.pos+1]); mark {
+		case 'b', 'o', 'd', 'x':
+			if hasRadix {
+				return false
+			}
+			hasRadix = true
+			s.radix = radixByMark(mark)
+		case 'e', 'i':
+			if hasExactness {
+				return false
+			}
+			hasExactness = true
+			stx.exact, stx.inexact = mark == 'e', mark == 'i'
+		default:
+			return false
+		}
+
+		s.pos += 2
+	}
+
+	return true
+}
+
+// scanComplex scans <complex>. Imaginary part without digits, as in 1+i, is
+// read as 1.
+func (s *scanner) scanComplex(stx *syntax) bool {
+	re, ok := s.scanReal()
+	if !ok {
+		return false
+	}
+
+	switch lower(s.peek()) {
+	case '@':
+		s.pos++
+		im, ok := s.scanReal()
+		stx.re, stx.im, stx.hasImag, stx.polar = re, im, true, true
+		return ok && re.hasDigits() && im.hasDigits()
+	case '+', '-':
+		im, ok := s.scanReal()
+		if !ok || !re.hasDigits() || lower(s.peek()) != 'i' {
+			return false
+		}
+		s.pos++
+		stx.re, stx.im, stx.hasImag = re, s.imagUnit(im), true
+		return true
+	case 'i':
+		if re.sign == 0 {
+			return false
+		}
+		s.pos++
+		stx.im, stx.hasImag = s.imagUnit(re), true
+		return true
+	}
+
+	stx.re = re
+
+	return re.hasDigits()
+}
+
+// imagUnit returns imaginary part im, reading it as 1 if it has no digits.
+func (s *scanner) imagUnit(im realSyntax) realSyntax {
+	if !im.hasDigits() {
+		im.dividend = "1"
+	}
+
+	return im
+}
+
+// scanReal scans optional sign and <ureal>, if any. Signed real may also be
+// <infnan>, i.e. +inf.0, -inf.0, +nan.0 or -nan.0.
+func (s *scanner) scanReal() (realSyntax, bool) {
+	var r realSyntax
+
+	if c := s.peek(); c == '+' || c == '-' {
+		r.sign = c
+		s.pos++
+
+		if end := s.pos + len("inf.0"); end <= len(s.src) {
+			if infnan := strings.ToLower(s.src[s.pos:end]); infnan == "inf.0" || infnan == "nan.0" {
+				r.infnan = infnan
+				s.pos = end
+				return r, true
+			}
+		}
+	}
+
+	if c := s.peek(); !s.isDigit(c) && !(c == '.' && s.radix == base10) {
+		return r, true
+	}
+
+	return r, s.scanUreal(&r)
+}
+
+// scanUreal scans <ureal>. Decimals are recognized only in radix 10.
+func (s *scanner) scanUreal(r *realSyntax) bool {
+	start := s.pos
+
+	if s.peek() == '.' {
+		s.pos++
+		if !s.scanDigits() {
+			return false
+		}
+		s.scanHashes()
+		s.scanSuffix()
+		r.decimal = s.src[start:s.pos]
+		return true
+	}
+
+	if !s.scanDigits() {
+		return false
+	}
+
+	hasHashes := s.scanHashes()
+
+	switch {
+	case s.peek() == '/':
+		r.dividend = s.src[start:s.pos]
+		s.pos++
+		divisorStart := s.pos
+		if !s.scanDigits() {
+			return false
+		}
+		s.scanHashes()
+		r.divisor = s.src[divisorStart:s.pos]
+		return true
+	case s.radix != base10:
+	case s.peek() == '.':
+		s.pos++
+		if !hasHashes {
+			s.scanDigits()
+		}
+		s.scanHashes()
+		s.scanSuffix()
+		r.decimal = s.src[start:s.pos]
+		return true
+	case s.scanSuffix():
+		r.decimal = s.src[start:s.pos]
+		return true
+	}
+
+	r.dividend = s.src[start:s.pos]
+
+	return true
+}
+
+// scanDigits scans digits of current radix and reports whether there were any.
+func (s *scanner) scanDigits() bool {
+	start := s.pos
+
+	for s.isDigit(s.peek()) {
+		s.pos++
+	}
+
+	return s.pos > start
+}
+
+// scanHashes scans # placeholders of digits and reports whether there were any.
+func (s *scanner) scanHashes() bool {
+	start := s.pos
+
+	for s.peek() == '#' {
+		s.pos++
+	}
+
+	return s.pos > start
+}
+
+// scanSuffix scans <suffix>, i.e. exponent, and reports whether there was one.
+func (s *scanner) scanSuffix() bool {
+	switch lower(s.peek()) {
+	case 'e', 's', 'f', 'd', 'l':
+	default:
+		return false
+	}
+
+	i := s.pos + 1
+	if i < len(s.src) && (s.src[i] == '+' || s.src[i] == '-') {
+		i++
+	}
+
+	start := i
+	for i < len(s.src) && '0' <= s.src[i] && s.src[i] <= '9' {
+		i++
+	}
+
+	if i == start {
+		return false
+	}
+
+	s.pos = i
+
+	return true
+}
+
+func (s *scanner) isDigit(c byte) bool {
+	switch s.radix {
+	case base2:
+		return c == '0' || c == '1'
+	case base8:
+		return '0' <= c && c <= '7'
+	case base16:
+		return ('0' <= c && c <= '9') || ('a' <= lower(c) && lower(c) <= 'f')
+	default:
+		return '0' <= c && c <= '9'
+	}
+}
+
+func radixByMark(mark byte) int {
+	switch mark {
+	case 'b':
+		return base2
+	case 'o':
+		return base8
+	case 'x':
+		return base16
+	default:
+		return base10
+	}
+}
+
+// lower returns lower case of ASCII letter c, or c itself for anything else.
+func lower(c byte) byte {
+	if 'A' <= c && c <= 'Z' {
+		return c + 'a' - 'A'
+	}
+
+	return c
+}
@@ -0,0 +1,84 @@
+package number_test
+
+import (
+	"github.com/vkhonin/scheme/parser/number"
+	"testing"
+)
+
+func TestNumber_IsNumber(t *testing.T) {
+	testCases := []struct {
+		Literal  string
+		IsNumber bool
+	}{
+		{"0", true},
+		{"-17", true},
+		{"1/2", true},
+		{"1#/2#", true},
+		{".5", true},
+		{"1.", true},
+		{"1.5#", true},
+		{"1#.#", true},
+		{"1e10", true},
+		{"1.5d-3", true},
+		{"+i", true},
+		{"-2.5i", true},
+		{"1-i", true},
+		{"1/2+3/4i", true},
+		{"1@2", true},
+		{"-1.5@.5", true},
+		{"#x-ff", true},
+		{"#e#x10", true},
+		{"#x#e10", true},
+		{"#b101/11", true},
+		{"#o777", true},
+		{"#d1.5", true},
+		{"#X1A", true},
+		{"#xAf", true},
+		{"#B101", true},
+		{"#E#O17", true},
+		{"1E5", true},
+		{"1.5D-3", true},
+		{"-I", true},
+		{"+inf.0", true},
+		{"-nan.0", true},
+		{"+INF.0", true},
+		{"1-inf.0i", true},
+		{"+inf.0i", true},
+		{"-inf.0@1", true},
+		{"", false},
+		{"+", false},
+		{".", false},
+		{"1/", false},
+		{"/2", false},
+		{"1.5/2", false},
+		{"1#5", false},
+		{"1#.5", false},
+		{"1e", false},
+		{"1e+", false},
+		{"5i", false},
+		{"1+2", false},
+		{"1@", false},
+		{"@1", false},
+		{"+-i", false},
+		{"#b2", false},
+		{"#o8", false},
+		{"#x1.5", false},
+		{"#b1e1", false},
+		{"#x#b1", false},
+		{"#e#i1", false},
+		{"#q1", false},
+		{"#", false},
+		{"#XG", false},
+		{"1A", false},
+		{"inf.0", false},
+		{"+inf.1", false},
+		{"+inf", false},
+		{"1inf.0i", false},
+	}
+
+	for _, c := range testCases {
+		if n := number.NewFromLiteral(c.Literal); n.IsNumber() != c.IsNumber {
+			t.Errorf("expected %v got %v for %q", c.IsNumber, n.IsNumber(), c.Literal)
+		}
+	}
+}
@@ -1,19 +1,50 @@
 package parser
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
 	"github.com/vkhonin/scheme/lexer"
 	"github.com/vkhonin/scheme/parser/number"
+	"math/big"
 )
 
+// DefaultMaxDepth is nesting depth of data parser reads if MaxDepth is zero.
+const DefaultMaxDepth = 10000
+
 const (
 	BOOL AtomType = iota
 	NUMBER
 	CHAR
 	STRING
 	SYMBOL
-	VECTOR
 )
 
+var (
+	CYCLIC_DATUM      = errors.New("cyclic datum")
+	DEPTH_EXCEEDED    = errors.New("datum nested too deeply")
+	DUPLICATE_LABEL   = errors.New("duplicate datum label")
+	INVALID_BYTE      = errors.New("invalid byte")
+	LIST_END_EXPECTED = errors.New("list end expected")
+	UNDEFINED_LABEL   = errors.New("undefined datum label")
+	UNEXPECTED_DOT    = errors.New("unexpected dot")
+	UNEXPECTED_RPAREN = errors.New("unexpected closing parenthesis")
+	UNKNOWN_READER    = errors.New("unknown reader extension")
+
+	// EOF is reported by ParseDatum when there are no more data.
+	EOF = lexer.EOF
+
+	// UNEXPECTED_EOF is reported when tokens end inside datum. It is the same
+	// error lexer reports for unterminated strings and comments, so both mean
+	// more input is needed.
+	UNEXPECTED_EOF = lexer.UNEXPECTED_EOF
+)
+
+// Nil is the empty list. Parser reads every () as Nil, unless it keeps its
+// trivia, so empty list read may be told by identity. Equals treats any pair
+// with nil Car and Cdr as empty list too. Nil must not be modified.
+var Nil = &Expr{}
+
 var (
 	abbrevToIdent = map[string]string{
 		"'":  "quote",
@@ -25,16 +56,75 @@ var (
 
 type Parser struct {
 	Tokens []lexer.Token
-	index  int
+
+	// WithPositions makes parser set Span of data it reads.
+	WithPositions bool
+
+	// RejectCycles makes parser report CYCLIC_DATUM for datum label
+	// referenced inside datum it labels, e.g. #0=(a . #0#). Shared data
+	// which are not cyclic, e.g. (#0=(a) #0#), are read anyway.
+	RejectCycles bool
+
+	// MaxDepth is maximum number of lists, vectors, abbreviations, labels
+	// and reader extensions datum may be nested in, beyond which
+	// DEPTH_EXCEEDED is reported.
+	// It is DefaultMaxDepth if zero and unlimited if negative.
+	MaxDepth int
+
+	index int
+	depth int
+
+	// KeepTrivia makes parser set Trivia of data it reads from whitespace,
+	// comment and directive tokens, which lexer returns with its KeepTrivia
+	// set, and datum comments. Parser skips such tokens anyway. Empty list
+	// with trivia is read as new empty pair rather than Nil.
+	KeepTrivia bool
+
+	// Trailing are trivia after last datum read by Parse with KeepTrivia
+	// set.
+	Trailing []lexer.Token
+
+	// Symbols is symbol table symbols read are interned in, unless they have
+	// span or trivia set. It is table of Intern if nil.
+	Symbols *SymbolTable
+
+	// arena is set by WithArena.
+	arena *Arena
+
+	// readers are registered by RegisterReader.
+	readers map[string]ReaderFunc
+
+	// trivia are trivia read but not set on datum yet.
+	trivia []lexer.Token
+
+	// labels are datum labels of outermost datum being read.
+	labels map[string]*label
 }
 
+// label is datum labelled by #N=. Pair or vector is allocated before it is
+// read, so it may be referenced inside itself. Datum is complete once read.
+type label struct {
+	datum    Sexpr
+	complete bool
+}
+
+// ReaderFunc returns datum of reader extension, e.g. hash table of #hash((a
+// . 1)), given datum following its prefix, e.g. ((a . 1)).
+type ReaderFunc func(datum Sexpr) (Sexpr, error)
+
 type Sexpr interface {
 	Equals(s Sexpr) bool
 }
 
 type Atom struct {
-	Type  AtomType
-	Value interface{}
+	Type   AtomType
+	Value  interface{}
+	Span   Span
+	Trivia *Trivia
+
+	// Immutable is set for strings parser reads, which are literals that
+	// must not be modified.
+	Immutable bool
 }
 
 func (a *Atom) Equals(s Sexpr) bool {
@@ -54,24 +144,10 @@ func (a *Atom) Equals(s Sexpr) bool {
 		return (a.Value).(rune) == (a2.Value).(rune)
 	case STRING, SYMBOL:
 		return (a.Value).(string) == (a2.Value).(string)
-	case VECTOR:
-		aVector := (a.Value).([]Sexpr)
-		a2Vector := (a2.Value).([]Sexpr)
-		la := len(aVector)
-		la2 := len(a2Vector)
-		if la != la2 {
-			return false
-		}
-		for i := range la {
-			if !aVector[i].Equals(a2Vector[i]) {
-				return false
-			}
-		}
-		return true
 	case NUMBER:
 		aNum := (a.Value).(*number.Number)
 		a2Num := (a2.Value).(*number.Number)
-		return aNum.IsNumber() && a2Num.IsNumber() && aNum.Inexact() == a2Num.Inexact() && aNum.Value() == a2Num.Value()
+		return aNum.IsNumber() && a2Num.IsNumber() && aNum.Inexact() == a2Num.Inexact() && aNum.Equal(a2Num)
 	default:
 		panic("type comparison not implemented")
 	}
@@ -79,168 +155,617 @@ func (a *Atom) Equals(s Sexpr) bool {
 
 type AtomType uint8
 
+// Vector is vector of data. Its elements may be modified in place.
+type Vector struct {
+	Elements []Sexpr
+	Span     Span
+	Trivia   *Trivia
+
+	// Immutable is set for vectors parser reads, which are literals that
+	// must not be modified.
+	Immutable bool
+}
+
+// Equals reports whether v and s are equal as by Equal.
+func (v *Vector) Equals(s Sexpr) bool {
+	return Equal(v, s)
+}
+
+// Bytevector is vector of bytes. Its bytes may be modified in place.
+type Bytevector struct {
+	Bytes  []byte
+	Span   Span
+	Trivia *Trivia
+
+	// Immutable is set for bytevectors parser reads, which are literals that
+	// must not be modified.
+	Immutable bool
+}
+
+func (b *Bytevector) Equals(s Sexpr) bool {
+	b2, ok := s.(*Bytevector)
+	return ok && bytes.Equal(b.Bytes, b2.Bytes)
+}
+
+// Expr is pair. Span of list is set on its first pair only.
 type Expr struct {
-	Car Sexpr
-	Cdr Sexpr
+	Car    Sexpr
+	Cdr    Sexpr
+	Span   Span
+	Trivia *Trivia
+
+	// Immutable is set for pairs parser reads, which are literals that must
+	// not be modified. Nil is immutable regardless.
+	Immutable bool
+}
+
+// Span is range of source datum is read from. It is zero unless datum is read
+// by parser with WithPositions set. Spans are not compared by Equals.
+type Span struct {
+	Start lexer.Pos
+	End   lexer.Pos // Position right after datum
 }
 
+// Trivia are whitespace, comments, directives and datum comments around
+// datum, which parser with KeepTrivia set keeps as tokens, so source may be
+// written back as it is. Trivia are not compared by Equals.
+type Trivia struct {
+	// Leading are trivia before datum. Leading trivia of tail of improper
+	// list include its dot, e.g. " . " is read as whitespace, DOT and
+	// whitespace tokens.
+	Leading []lexer.Token
+
+	// Inner are trivia before closing parenthesis of list, vector or
+	// bytevector.
+	Inner []lexer.Token
+}
+
+// Equals reports whether e and s are equal as by Equal, which compares long
+// lists without recursion.
 func (e *Expr) Equals(s Sexpr) bool {
-	e2, ok := s.(*Expr)
-	if !ok {
-		return false
-	}
+	return Equal(e, s)
+}
 
-	if e == nil || e2 == nil {
-		return e == e2
+func (p *Parser) Parse() ([]Sexpr, error) {
+	p.index = 0
+	p.trivia, p.Trailing = nil, nil
+
+	var program []Sexpr
+
+	for p.index < len(p.Tokens) {
+		if err := p.skipAtmosphere(); err != nil {
+			return nil, err
+		}
+		if p.index == len(p.Tokens) {
+			break
+		}
+
+		p.labels = nil
+
+		sexpr, err := p.ParseNextNode()
+		if err != nil {
+			return nil, err
+		}
+		program = append(program, sexpr)
 	}
 
-	var isCarsEqual, isCdrsEqual bool
+	p.Trailing = p.takeTrivia()
+
+	return program, nil
+}
+
+// ParseDatum parses next datum, unlike Parse continuing from where previous
+// call has stopped. It reports EOF if there are no more data and
+// UNEXPECTED_EOF if tokens end inside datum. Parser is left unchanged on
+// error, so tokens of rest of datum may be appended to Tokens and ParseDatum
+// called again.
+func (p *Parser) ParseDatum() (Sexpr, error) {
+	start, trivia := p.index, p.trivia
+
+	if err := p.skipAtmosphere(); err != nil {
+		p.index, p.trivia = start, trivia
+		return nil, err
+	}
 
-	if e.Car == nil || e2.Car == nil {
-		isCarsEqual = e.Car == e2.Car
-	} else {
-		isCarsEqual = e.Car.Equals(e2.Car)
+	if p.index == len(p.Tokens) {
+		return nil, EOF
 	}
 
-	if e.Cdr == nil || e2.Cdr == nil {
-		isCdrsEqual = e.Cdr == e2.Cdr
-	} else {
-		isCdrsEqual = e.Cdr.Equals(e2.Cdr)
+	p.labels = nil
+
+	sexpr, err := p.ParseNextNode()
+	if err != nil {
+		p.index, p.trivia = start, trivia
+		return nil, err
 	}
 
-	return isCarsEqual && isCdrsEqual
+	return sexpr, nil
 }
 
-func (p *Parser) Parse() []Sexpr {
-	p.index = 0
+func (p *Parser) ParseNextNode() (Sexpr, error) {
+	return p.parseNode(nil)
+}
 
-	var program []Sexpr
+// parseNode parses datum at current token. Pair or vector is read into node
+// unless it is nil.
+func (p *Parser) parseNode(node Sexpr) (Sexpr, error) {
+	if err := p.skipAtmosphere(); err != nil {
+		return nil, err
+	}
 
-	for p.index < len(p.Tokens) {
-		program = append(program, p.ParseNextNode())
+	currentToken, err := p.token()
+	if err != nil {
+		return nil, err
 	}
 
-	return program
-}
+	leading := p.takeTrivia()
+
+	switch currentToken.Type {
+	case lexer.HPAREN, lexer.LPAREN, lexer.SQUOTE, lexer.BQUOTE, lexer.COMMA, lexer.COMMAT, lexer.LABEL, lexer.EXTENSION:
+		p.depth++
+		defer func() { p.depth-- }()
+
+		if maxDepth := p.maxDepth(); maxDepth >= 0 && p.depth > maxDepth {
+			return nil, fmt.Errorf("%w at %s", DEPTH_EXCEEDED, currentToken.Pos)
+		}
+	}
 
-func (p *Parser) ParseNextNode() Sexpr {
-	currentToken := &p.Tokens[p.index]
 	var sexpr Sexpr
 
 	switch currentToken.Type {
 	case lexer.BOOL:
-		sexpr = &Atom{Type: BOOL, Value: p.parseBool(currentToken.Literal)}
+		sexpr = p.newAtom(BOOL, p.parseBool(currentToken.Literal))
 	case lexer.NUMBER:
-		sexpr = &Atom{Type: NUMBER, Value: p.parseNumber(currentToken.Literal)}
+		var value *number.Number
+		if value, err = p.parseNumber(currentToken.Literal); err != nil {
+			err = fmt.Errorf("%w at %s", err, currentToken.Pos)
+		}
+		sexpr = p.newAtom(NUMBER, value)
 	case lexer.CHAR:
-		sexpr = &Atom{Type: CHAR, Value: p.parseChar(currentToken.Literal)}
+		sexpr = p.newAtom(CHAR, p.parseChar(currentToken.Literal))
 	case lexer.STRING:
-		sexpr = &Atom{Type: STRING, Value: currentToken.Literal}
+		atom := p.newAtom(STRING, currentToken.Literal)
+		atom.Immutable = true
+		sexpr = atom
 	case lexer.IDENT:
-		sexpr = &Atom{Type: SYMBOL, Value: currentToken.Literal}
+		if p.WithPositions || p.KeepTrivia {
+			sexpr = p.newAtom(SYMBOL, currentToken.Literal)
+		} else {
+			sexpr = p.intern(currentToken.Literal)
+		}
 	case lexer.HPAREN:
-		sexpr = &Atom{Type: VECTOR, Value: p.parseVector()}
+		vector, ok := node.(*Vector)
+		if !ok {
+			vector = &Vector{Immutable: true}
+		}
+		vector.Elements, err = p.parseVector()
+		sexpr = vector
 	case lexer.SQUOTE, lexer.BQUOTE, lexer.COMMA, lexer.COMMAT:
-		sexpr = p.parseAbbrev()
+		sexpr, err = p.parseAbbrev(p.newPairOf(node))
 	case lexer.LPAREN:
-		sexpr = p.parseList()
+		sexpr, err = p.parseList(p.newPairOf(node))
+	case lexer.U8PAREN:
+		sexpr, err = p.parseBytevector()
+	case lexer.LABEL:
+		sexpr, err = p.parseLabel()
+	case lexer.LABELREF:
+		sexpr, err = p.labelRef(currentToken)
+	case lexer.EXTENSION:
+		sexpr, err = p.parseExtension(currentToken)
+	case lexer.DOT:
+		err = fmt.Errorf("%w at %s", UNEXPECTED_DOT, currentToken.Pos)
+	case lexer.RPAREN:
+		err = fmt.Errorf("%w at %s", UNEXPECTED_RPAREN, currentToken.Pos)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if p.KeepTrivia {
+		switch currentToken.Type {
+		case lexer.LPAREN, lexer.HPAREN, lexer.U8PAREN:
+			sexpr = p.setTrivia(sexpr, nil, p.takeTrivia())
+		}
+
+		// Reference is datum it refers to, trivia of which are set already,
+		// so its trivia are left for next datum.
+		if currentToken.Type == lexer.LABELREF {
+			p.trivia = leading
+		} else {
+			sexpr = p.setTrivia(sexpr, leading, nil)
+		}
+	}
+
+	// Current token is last token of datum now. Reference shares span of
+	// datum it refers to.
+	if p.WithPositions && currentToken.Type != lexer.LABELREF {
+		span := Span{Start: currentToken.Pos, End: p.Tokens[p.index].End}
+		switch s := sexpr.(type) {
+		case *Atom:
+			s.Span = span
+		case *Expr:
+			if s != Nil {
+				s.Span = span
+			}
+		case *Vector:
+			s.Span = span
+		case *Bytevector:
+			s.Span = span
+		}
 	}
+
 	p.index++
 
-	return sexpr
+	return sexpr, nil
+}
+
+func (p *Parser) maxDepth() int {
+	if p.MaxDepth == 0 {
+		return DefaultMaxDepth
+	}
+
+	return p.MaxDepth
 }
 
 func (*Parser) parseBool(literal string) bool {
 	return literal[1] == 't'
 }
 
-func (p *Parser) parseNumber(literal string) any {
+func (p *Parser) parseNumber(literal string) (*number.Number, error) {
 	return number.NewFromLiteral(literal).Parse()
 }
 
 func (*Parser) parseChar(literal string) rune {
-	var char rune
-	switch literal[2:] {
-	case "space":
-		char = ' '
-	case "newline":
-		char = '\n'
-	default:
-		for i, c := range literal {
-			if i == 2 {
-				char = c
-				break
-			}
-		}
-	}
+	char, _ := lexer.CharValue(literal[2:])
 	return char
 }
 
-func (p *Parser) parseVector() []Sexpr {
+func (p *Parser) parseVector() ([]Sexpr, error) {
 	value := make([]Sexpr, 0)
 
 	p.index++
-	node := &p.Tokens[p.index]
+	if err := p.skipAtmosphere(); err != nil {
+		return nil, err
+	}
+	node, err := p.token()
+	if err != nil {
+		return nil, err
+	}
 
 	for node.Type != lexer.RPAREN {
-		value = append(value, p.ParseNextNode())
-		node = &p.Tokens[p.index]
+		sexpr, err := p.ParseNextNode()
+		if err != nil {
+			return nil, err
+		}
+		value = append(value, sexpr)
+		if err := p.skipAtmosphere(); err != nil {
+			return nil, err
+		}
+		if node, err = p.token(); err != nil {
+			return nil, err
+		}
 	}
 
-	return value
+	return value, nil
 }
 
-func (p *Parser) parseAbbrev() *Expr {
+func (p *Parser) parseAbbrev(value *Expr) (*Expr, error) {
 	node := &p.Tokens[p.index]
 
-	value := Expr{
-		Car: &Atom{Type: SYMBOL, Value: abbrevToIdent[node.Literal]},
-	}
+	value.Car = p.intern(abbrevToIdent[node.Literal])
 
 	p.index++
 
-	value.Cdr = &Expr{
-		Car: p.ParseNextNode(),
-		Cdr: &Expr{Car: nil, Cdr: nil},
+	datum, err := p.ParseNextNode()
+	if err != nil {
+		return nil, err
 	}
 
+	cdr := p.newPair()
+	cdr.Car, cdr.Cdr = datum, Nil
+	value.Cdr = cdr
+
 	p.index--
 
-	return &value
+	return value, nil
 }
 
-func (p *Parser) parseList() *Expr {
-	var value Expr
+// parseList parses list into value, unless list is empty, which is Nil.
+func (p *Parser) parseList(value *Expr) (*Expr, error) {
 	var previousNode *Expr
-	currentNode := &value
 
 	p.index++
-	node := &p.Tokens[p.index]
+	if err := p.skipAtmosphere(); err != nil {
+		return nil, err
+	}
+	node, err := p.token()
+	if err != nil {
+		return nil, err
+	}
 
 	if node.Type == lexer.DOT {
-		panic("unexpected list end")
+		return nil, fmt.Errorf("%w at %s", UNEXPECTED_DOT, node.Pos)
 	}
 
 	for node.Type != lexer.RPAREN {
 		if node.Type == lexer.DOT {
+			if p.KeepTrivia {
+				p.trivia = append(p.trivia, *node)
+			}
+
 			p.index++
-			previousNode.Cdr = p.ParseNextNode()
+			cdr, err := p.ParseNextNode()
+			if err != nil {
+				return nil, err
+			}
+			previousNode.Cdr = cdr
 
-			node = &p.Tokens[p.index]
+			if err := p.skipAtmosphere(); err != nil {
+				return nil, err
+			}
+			if node, err = p.token(); err != nil {
+				return nil, err
+			}
 			if node.Type != lexer.RPAREN {
-				panic("list end expected")
+				return nil, fmt.Errorf("%w at %s", LIST_END_EXPECTED, node.Pos)
 			}
 
 			break
 		}
 
-		currentNode.Car = p.ParseNextNode()
-		currentNode.Cdr = &Expr{}
+		car, err := p.ParseNextNode()
+		if err != nil {
+			return nil, err
+		}
+
+		currentNode := value
+		if previousNode != nil {
+			currentNode = p.newPair()
+			previousNode.Cdr = currentNode
+		}
+		currentNode.Car, currentNode.Cdr = car, Nil
 		previousNode = currentNode
-		currentNode = currentNode.Cdr.(*Expr)
 
-		node = &p.Tokens[p.index]
+		if err := p.skipAtmosphere(); err != nil {
+			return nil, err
+		}
+		if node, err = p.token(); err != nil {
+			return nil, err
+		}
+	}
+
+	if previousNode == nil {
+		return Nil, nil
+	}
+
+	return value, nil
+}
+
+// parseBytevector parses bytevector, elements of which must be exact integers
+// from 0 to 255.
+func (p *Parser) parseBytevector() (*Bytevector, error) {
+	data := make([]byte, 0)
+
+	p.index++
+
+	for {
+		if err := p.skipAtmosphere(); err != nil {
+			return nil, err
+		}
+		node, err := p.token()
+		if err != nil {
+			return nil, err
+		}
+		if node.Type == lexer.RPAREN {
+			break
+		}
+
+		element, err := p.ParseNextNode()
+		if err != nil {
+			return nil, err
+		}
+
+		var value *big.Int
+		if atom, ok := element.(*Atom); ok && atom.Type == NUMBER {
+			value = (atom.Value).(*number.Number).Integer()
+		}
+		if value == nil || !value.IsUint64() || value.Uint64() > 255 {
+			return nil, fmt.Errorf("%w %s at %s", INVALID_BYTE, node.Literal, node.Pos)
+		}
+
+		data = append(data, byte(value.Uint64()))
+	}
+
+	return &Bytevector{Bytes: data, Immutable: true}, nil
+}
+
+// parseLabel parses datum labelled by #N= at current token.
+func (p *Parser) parseLabel() (Sexpr, error) {
+	token := &p.Tokens[p.index]
+	name := token.Literal[1 : len(token.Literal)-1]
+
+	if _, ok := p.labels[name]; ok {
+		return nil, fmt.Errorf("%w %s at %s", DUPLICATE_LABEL, token.Literal, token.Pos)
+	}
+
+	p.index++
+	if err := p.skipAtmosphere(); err != nil {
+		return nil, err
+	}
+	next, err := p.token()
+	if err != nil {
+		return nil, err
+	}
+
+	l := &label{}
+
+	switch next.Type {
+	case lexer.LPAREN, lexer.SQUOTE, lexer.BQUOTE, lexer.COMMA, lexer.COMMAT:
+		l.datum = p.newPair()
+	case lexer.HPAREN:
+		l.datum = &Vector{Immutable: true}
+	}
+
+	if p.labels == nil {
+		p.labels = make(map[string]*label)
+	}
+	p.labels[name] = l
+
+	datum, err := p.parseNode(l.datum)
+	if err != nil {
+		return nil, err
+	}
+	l.datum, l.complete = datum, true
+
+	p.index--
+
+	return datum, nil
+}
+
+// RegisterReader makes parser read EXTENSION token #prefix and datum
+// following it as datum fn returns for that datum. Lexer must be told to read
+// #prefix as EXTENSION token by its RegisterPrefix.
+func (p *Parser) RegisterReader(prefix string, fn ReaderFunc) {
+	if p.readers == nil {
+		p.readers = make(map[string]ReaderFunc)
+	}
+
+	p.readers[prefix] = fn
+}
+
+// parseExtension parses datum following EXTENSION token and returns result of
+// reader of its prefix.
+func (p *Parser) parseExtension(token *lexer.Token) (Sexpr, error) {
+	fn, ok := p.readers[token.Literal[1:]]
+	if !ok {
+		return nil, fmt.Errorf("%w %s at %s", UNKNOWN_READER, token.Literal, token.Pos)
+	}
+
+	p.index++
+
+	datum, err := p.ParseNextNode()
+	if err != nil {
+		return nil, err
+	}
+
+	p.index--
+
+	sexpr, err := fn(datum)
+	if err != nil {
+		return nil, fmt.Errorf("%w in %s at %s", err, token.Literal, token.Pos)
+	}
+
+	return sexpr, nil
+}
+
+// labelRef returns datum referenced by #N# token.
+func (p *Parser) labelRef(token *lexer.Token) (Sexpr, error) {
+	l, ok := p.labels[token.Literal[1:len(token.Literal)-1]]
+
+	switch {
+	case !ok || l.datum == nil:
+		return nil, fmt.Errorf("%w %s at %s", UNDEFINED_LABEL, token.Literal, token.Pos)
+	case !l.complete && p.RejectCycles:
+		return nil, fmt.Errorf("%w %s at %s", CYCLIC_DATUM, token.Literal, token.Pos)
+	}
+
+	return l.datum, nil
+}
+
+// newPairOf returns node if it is pair, or new pair otherwise.
+func (p *Parser) newPairOf(node Sexpr) *Expr {
+	if pair, ok := node.(*Expr); ok {
+		return pair
+	}
+
+	return p.newPair()
+}
+
+// token returns current token, or UNEXPECTED_EOF if tokens have ended.
+func (p *Parser) token() (*lexer.Token, error) {
+	if p.index >= len(p.Tokens) {
+		return nil, UNEXPECTED_EOF
+	}
+
+	return &p.Tokens[p.index], nil
+}
+
+// skipAtmosphere skips whitespace, comment and directive tokens and datum
+// comments at current token together with datum each of them comments out.
+// Skipped tokens are kept as trivia if KeepTrivia is set.
+func (p *Parser) skipAtmosphere() error {
+	for p.index < len(p.Tokens) {
+		switch token := p.Tokens[p.index]; token.Type {
+		case lexer.WHITESPACE, lexer.LCOMMENT, lexer.BCOMMENT, lexer.DIRECTIVE:
+			if p.KeepTrivia {
+				p.trivia = append(p.trivia, token)
+			}
+			p.index++
+		case lexer.DCOMMENT:
+			start, trivia := p.index, p.trivia
+			p.index++
+			if _, err := p.ParseNextNode(); err != nil {
+				return err
+			}
+			if p.KeepTrivia {
+				p.trivia = append(trivia[:len(trivia):len(trivia)], p.Tokens[start:p.index]...)
+			}
+		default:
+			return nil
+		}
+	}
+
+	return nil
+}
+
+// takeTrivia returns trivia read but not set on datum yet and forgets them.
+func (p *Parser) takeTrivia() []lexer.Token {
+	trivia := p.trivia
+	p.trivia = nil
+
+	return trivia
+}
+
+func (p *Parser) intern(name string) *Atom {
+	if p.Symbols != nil {
+		return p.Symbols.Intern(name)
+	}
+
+	return Intern(name)
+}
+
+// setTrivia prepends leading and inner trivia to those of sexpr and returns
+// it, or new empty pair if sexpr is Nil. Trivia of data of other types, e.g.
+// returned by reader extensions, are dropped.
+func (p *Parser) setTrivia(sexpr Sexpr, leading, inner []lexer.Token) Sexpr {
+	if len(leading) == 0 && len(inner) == 0 {
+		return sexpr
+	}
+
+	if sexpr == Nil {
+		sexpr = &Expr{Immutable: true}
 	}
 
-	return &value
+	var trivia **Trivia
+
+	switch s := sexpr.(type) {
+	case *Atom:
+		trivia = &s.Trivia
+	case *Expr:
+		trivia = &s.Trivia
+	case *Vector:
+		trivia = &s.Trivia
+	case *Bytevector:
+		trivia = &s.Trivia
+	default:
+		return sexpr
+	}
+
+	if *trivia == nil {
+		*trivia = &Trivia{}
+	}
+	(*trivia).Leading = append(leading, (*trivia).Leading...)
+	(*trivia).Inner = append(inner, (*trivia).Inner...)
+
+	return sexpr
 }
@@ -1,10 +1,14 @@
 package parser_test
 
 import (
+	"errors"
 	"github.com/vkhonin/scheme/lexer"
 	"github.com/vkhonin/scheme/parser"
 	"github.com/vkhonin/scheme/parser/number"
 	"math"
+	"math/big"
+	"slices"
+	"strings"
 	"testing"
 )
 
@@ -249,12 +253,30 @@ func TestParser_Parse(t *testing.T) {
 		{"#x-ai", complex(0, -10), false},
 	}
 
+	// Exact rationals such as 1/7 have no complex128 representation, so numbers
+	// are compared by approximate value and exactness.
+	for _, c := range numberTestCases {
+		p.Tokens = []lexer.Token{{Type: lexer.NUMBER, Literal: c.Literal}}
+
+		program, err := p.Parse()
+		if err != nil {
+			t.Errorf("unexpected error %v for %s", err, c.Literal)
+			continue
+		}
+
+		atom, ok := program[0].(*parser.Atom)
+		if !ok || atom.Type != parser.NUMBER {
+			t.Errorf("expected number got %v for %s", atom, c.Literal)
+			continue
+		}
+
+		n := (atom.Value).(*number.Number)
+		if n.Inexact() != c.Inexact || n.Value() != c.Value {
+			t.Errorf("expected %v (inexact %v) got %v (inexact %v) for %s", c.Value, c.Inexact, n.Value(), n.Inexact(), c.Literal)
+		}
+	}
+
 	testCases := []testCase{
-		{
-			Description: "Number",
-			Input:       make([]lexer.Token, len(numberTestCases), len(numberTestCases)),
-			Output:      make([]parser.Sexpr, len(numberTestCases), len(numberTestCases)),
-		},
 		{
 			Description: "Bool",
 			Input: []lexer.Token{
@@ -272,11 +294,31 @@ func TestParser_Parse(t *testing.T) {
 				{Type: lexer.CHAR, Literal: "#\\space"},
 				{Type: lexer.CHAR, Literal: "#\\newline"},
 				{Type: lexer.CHAR, Literal: "#\\a"},
+				{Type: lexer.CHAR, Literal: "#\\tab"},
+				{Type: lexer.CHAR, Literal: "#\\nul"},
+				{Type: lexer.CHAR, Literal: "#\\delete"},
+				{Type: lexer.CHAR, Literal: "#\\alarm"},
+				{Type: lexer.CHAR, Literal: "#\\backspace"},
+				{Type: lexer.CHAR, Literal: "#\\return"},
+				{Type: lexer.CHAR, Literal: "#\\escape"},
+				{Type: lexer.CHAR, Literal: "#\\x"},
+				{Type: lexer.CHAR, Literal: "#\\x3bb"},
+				{Type: lexer.CHAR, Literal: "#\\λ"},
 			},
 			Output: []parser.Sexpr{
 				&parser.Atom{Type: parser.CHAR, Value: ' '},
 				&parser.Atom{Type: parser.CHAR, Value: '\n'},
 				&parser.Atom{Type: parser.CHAR, Value: 'a'},
+				&parser.Atom{Type: parser.CHAR, Value: '\t'},
+				&parser.Atom{Type: parser.CHAR, Value: rune(0)},
+				&parser.Atom{Type: parser.CHAR, Value: rune(0x7f)},
+				&parser.Atom{Type: parser.CHAR, Value: '\a'},
+				&parser.Atom{Type: parser.CHAR, Value: '\b'},
+				&parser.Atom{Type: parser.CHAR, Value: '\r'},
+				&parser.Atom{Type: parser.CHAR, Value: rune(0x1b)},
+				&parser.Atom{Type: parser.CHAR, Value: 'x'},
+				&parser.Atom{Type: parser.CHAR, Value: 'λ'},
+				&parser.Atom{Type: parser.CHAR, Value: 'λ'},
 			},
 		},
 		{
@@ -311,16 +353,72 @@ func TestParser_Parse(t *testing.T) {
 				{Type: lexer.RPAREN, Literal: ")"},
 			},
 			Output: []parser.Sexpr{
-				&parser.Atom{Type: parser.VECTOR, Value: []parser.Sexpr{}},
-				&parser.Atom{Type: parser.VECTOR, Value: []parser.Sexpr{
+				&parser.Vector{Elements: []parser.Sexpr{}},
+				&parser.Vector{Elements: []parser.Sexpr{
 					&parser.Atom{Type: parser.STRING, Value: "string"},
 				}},
-				&parser.Atom{Type: parser.VECTOR, Value: []parser.Sexpr{
+				&parser.Vector{Elements: []parser.Sexpr{
 					&parser.Atom{Type: parser.STRING, Value: "string"},
 					&parser.Atom{Type: parser.SYMBOL, Value: "symbol"},
 				}},
 			},
 		},
+		{
+			Description: "Datum comments",
+			Input: []lexer.Token{
+				{Type: lexer.DCOMMENT, Literal: "#;"},
+				{Type: lexer.IDENT, Literal: "a"},
+				{Type: lexer.LPAREN, Literal: "("},
+				{Type: lexer.IDENT, Literal: "b"},
+				{Type: lexer.DCOMMENT, Literal: "#;"},
+				{Type: lexer.IDENT, Literal: "c"},
+				{Type: lexer.RPAREN, Literal: ")"},
+				{Type: lexer.HPAREN, Literal: "#("},
+				{Type: lexer.DCOMMENT, Literal: "#;"},
+				{Type: lexer.DCOMMENT, Literal: "#;"},
+				{Type: lexer.IDENT, Literal: "d"},
+				{Type: lexer.IDENT, Literal: "e"},
+				{Type: lexer.IDENT, Literal: "f"},
+				{Type: lexer.RPAREN, Literal: ")"},
+				{Type: lexer.DCOMMENT, Literal: "#;"},
+				{Type: lexer.LPAREN, Literal: "("},
+				{Type: lexer.IDENT, Literal: "g"},
+				{Type: lexer.RPAREN, Literal: ")"},
+				{Type: lexer.SQUOTE, Literal: "'"},
+				{Type: lexer.DCOMMENT, Literal: "#;"},
+				{Type: lexer.IDENT, Literal: "h"},
+				{Type: lexer.IDENT, Literal: "i"},
+				{Type: lexer.LPAREN, Literal: "("},
+				{Type: lexer.IDENT, Literal: "j"},
+				{Type: lexer.DOT, Literal: "."},
+				{Type: lexer.IDENT, Literal: "k"},
+				{Type: lexer.DCOMMENT, Literal: "#;"},
+				{Type: lexer.IDENT, Literal: "l"},
+				{Type: lexer.RPAREN, Literal: ")"},
+				{Type: lexer.DCOMMENT, Literal: "#;"},
+				{Type: lexer.IDENT, Literal: "m"},
+			},
+			Output: []parser.Sexpr{
+				&parser.Expr{
+					Car: &parser.Atom{Type: parser.SYMBOL, Value: "b"},
+					Cdr: &parser.Expr{},
+				},
+				&parser.Vector{Elements: []parser.Sexpr{
+					&parser.Atom{Type: parser.SYMBOL, Value: "f"},
+				}},
+				&parser.Expr{
+					Car: &parser.Atom{Type: parser.SYMBOL, Value: "quote"},
+					Cdr: &parser.Expr{
+						Car: &parser.Atom{Type: parser.SYMBOL, Value: "i"},
+						Cdr: &parser.Expr{},
+					},
+				},
+				&parser.Expr{
+					Car: &parser.Atom{Type: parser.SYMBOL, Value: "j"},
+					Cdr: &parser.Atom{Type: parser.SYMBOL, Value: "k"},
+				},
+			},
+		},
 		{
 			Description: "Abbreviation",
 			Input: []lexer.Token{
@@ -403,15 +501,14 @@ func TestParser_Parse(t *testing.T) {
 		},
 	}
 
-	for i, c := range numberTestCases {
-		testCases[0].Input[i] = lexer.Token{Type: lexer.NUMBER, Literal: c.Literal}
-		testCases[0].Output[i] = &parser.Atom{Type: parser.NUMBER, Value: number.NewFromValue(c.Value, c.Inexact)}
-	}
-
 	for _, c := range testCases {
 		p.Tokens = c.Input
 
-		result := p.Parse()
+		result, err := p.Parse()
+		if err != nil {
+			t.Errorf("unexpected error %v for %s", err, c.Description)
+			continue
+		}
 
 		if len(result) != len(c.Output) {
 			t.Errorf("expected %v got %v", c.Output, result)
@@ -425,3 +522,573 @@ func TestParser_Parse(t *testing.T) {
 		}
 	}
 }
+
+func TestParser_ParseErrors(t *testing.T) {
+	testCases := []struct {
+		Description string
+		Input       []lexer.Token
+		Error       error
+	}{
+		{
+			"Division by zero in number",
+			[]lexer.Token{{Type: lexer.NUMBER, Literal: "1/0"}},
+			number.DIVISION_BY_ZERO,
+		},
+		{
+			"Invalid number in list",
+			[]lexer.Token{
+				{Type: lexer.LPAREN, Literal: "("},
+				{Type: lexer.NUMBER, Literal: "1/0"},
+				{Type: lexer.RPAREN, Literal: ")"},
+			},
+			number.DIVISION_BY_ZERO,
+		},
+		{
+			"Dot at list start",
+			[]lexer.Token{
+				{Type: lexer.LPAREN, Literal: "("},
+				{Type: lexer.DOT, Literal: "."},
+				{Type: lexer.NUMBER, Literal: "1"},
+				{Type: lexer.RPAREN, Literal: ")"},
+			},
+			parser.UNEXPECTED_DOT,
+		},
+		{
+			"Several data after dot",
+			[]lexer.Token{
+				{Type: lexer.LPAREN, Literal: "("},
+				{Type: lexer.NUMBER, Literal: "1"},
+				{Type: lexer.DOT, Literal: "."},
+				{Type: lexer.NUMBER, Literal: "2"},
+				{Type: lexer.NUMBER, Literal: "3"},
+				{Type: lexer.RPAREN, Literal: ")"},
+			},
+			parser.LIST_END_EXPECTED,
+		},
+	}
+
+	for _, c := range testCases {
+		p := parser.Parser{Tokens: c.Input}
+
+		if _, err := p.Parse(); !errors.Is(err, c.Error) {
+			t.Errorf("expected %v got %v for %s", c.Error, err, c.Description)
+		}
+	}
+
+	p := parser.Parser{Tokens: []lexer.Token{
+		{Type: lexer.LPAREN, Literal: "(", Pos: lexer.Pos{Line: 1, Column: 1}},
+		{Type: lexer.NUMBER, Literal: "1/0", Pos: lexer.Pos{Line: 2, Column: 3, Offset: 4}},
+		{Type: lexer.RPAREN, Literal: ")", Pos: lexer.Pos{Line: 2, Column: 6, Offset: 7}},
+	}}
+
+	if _, err := p.Parse(); err == nil || !strings.HasSuffix(err.Error(), "at 2:3") {
+		t.Errorf("expected error at 2:3, got %v", err)
+	}
+}
+
+func TestParser_UnexpectedEOF(t *testing.T) {
+	for _, input := range []string{"(a b", "#(1 2", "'", "(a . ", "(a . b", "(a #;", "#;", "`(a ,", "((a) (b)"} {
+		var tokens []lexer.Token
+		for token, err := range lexer.NewFromString(input).Tokens() {
+			if err != nil {
+				t.Fatal(err)
+			}
+			tokens = append(tokens, token)
+		}
+
+		p := parser.Parser{Tokens: tokens}
+
+		if _, err := p.Parse(); !errors.Is(err, parser.UNEXPECTED_EOF) {
+			t.Errorf("expected %v got %v for %s", parser.UNEXPECTED_EOF, err, input)
+		}
+	}
+
+	if !errors.Is(parser.UNEXPECTED_EOF, lexer.UNEXPECTED_EOF) {
+		t.Error("expected parser and lexer to report same unexpected EOF")
+	}
+}
+
+func TestParser_ParseDatum(t *testing.T) {
+	tokens := func(input string) []lexer.Token {
+		var tokens []lexer.Token
+		for token, err := range lexer.NewFromString(input).Tokens() {
+			if err != nil {
+				t.Fatal(err)
+			}
+			tokens = append(tokens, token)
+		}
+		return tokens
+	}
+
+	p := parser.Parser{Tokens: tokens("1 #;2 (a")}
+
+	datum, err := p.ParseDatum()
+	if err != nil || !datum.Equals(&parser.Atom{Type: parser.NUMBER, Value: number.NewFromInt(big.NewInt(1))}) {
+		t.Errorf("expected 1 got %v, %v", datum, err)
+	}
+
+	if _, err := p.ParseDatum(); !errors.Is(err, parser.UNEXPECTED_EOF) {
+		t.Errorf("expected %v got %v", parser.UNEXPECTED_EOF, err)
+	}
+
+	p.Tokens = append(p.Tokens, tokens("b) #;c")...)
+
+	expected := &parser.Expr{
+		Car: &parser.Atom{Type: parser.SYMBOL, Value: "a"},
+		Cdr: &parser.Expr{Car: &parser.Atom{Type: parser.SYMBOL, Value: "b"}, Cdr: &parser.Expr{}},
+	}
+	if datum, err := p.ParseDatum(); err != nil || !datum.Equals(expected) {
+		t.Errorf("expected (a b) got %v, %v", datum, err)
+	}
+
+	if _, err := p.ParseDatum(); !errors.Is(err, parser.EOF) {
+		t.Errorf("expected %v got %v", parser.EOF, err)
+	}
+
+	for input, expected := range map[string]error{")": parser.UNEXPECTED_RPAREN, "(a . . b)": parser.UNEXPECTED_DOT} {
+		p := parser.Parser{Tokens: tokens(input)}
+		if _, err := p.ParseDatum(); !errors.Is(err, expected) {
+			t.Errorf("expected %v got %v for %s", expected, err, input)
+		}
+	}
+}
+
+func TestParser_WithPositions(t *testing.T) {
+	var tokens []lexer.Token
+	for token, err := range lexer.NewFromString("(a 'b)\n  #(1 \"λ\")").Tokens() {
+		if err != nil {
+			t.Fatal(err)
+		}
+		tokens = append(tokens, token)
+	}
+
+	span := func(line, startColumn, startOffset, endColumn, endOffset int) parser.Span {
+		return parser.Span{
+			Start: lexer.Pos{Line: line, Column: startColumn, Offset: startOffset},
+			End:   lexer.Pos{Line: line, Column: endColumn, Offset: endOffset},
+		}
+	}
+
+	p := parser.Parser{Tokens: tokens, WithPositions: true}
+
+	program, err := p.Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	list := program[0].(*parser.Expr)
+	quote := list.Cdr.(*parser.Expr).Car.(*parser.Expr)
+	vector := program[1].(*parser.Vector)
+	str := vector.Elements[1].(*parser.Atom)
+
+	testCases := map[string][2]parser.Span{
+		"list":   {list.Span, span(1, 1, 0, 7, 6)},
+		"symbol": {list.Car.(*parser.Atom).Span, span(1, 2, 1, 3, 2)},
+		"quote":  {quote.Span, span(1, 4, 3, 6, 5)},
+		"vector": {vector.Span, span(2, 3, 9, 11, 18)},
+		"string": {str.Span, span(2, 7, 13, 10, 17)},
+	}
+
+	for description, c := range testCases {
+		if c[0] != c[1] {
+			t.Errorf("expected %+v got %+v for %s", c[1], c[0], description)
+		}
+	}
+
+	p = parser.Parser{Tokens: tokens}
+
+	withoutPositions, err := p.Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if withoutPositions[0].(*parser.Expr).Span != (parser.Span{}) || !withoutPositions[0].Equals(program[0]) {
+		t.Errorf("expected equal data without spans, got %v", withoutPositions[0])
+	}
+}
+
+func TestParser_DatumLabels(t *testing.T) {
+	parse := func(input string, rejectCycles bool) ([]parser.Sexpr, error) {
+		var tokens []lexer.Token
+		for token, err := range lexer.NewFromString(input).Tokens() {
+			if err != nil {
+				t.Fatal(err)
+			}
+			tokens = append(tokens, token)
+		}
+
+		p := parser.Parser{Tokens: tokens, RejectCycles: rejectCycles}
+
+		return p.Parse()
+	}
+
+	program, err := parse("#0=(a . #0#) #1=#(b #1#) (#2=(c) #;#3=d #2#) '#4='#4#", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if list := program[0].(*parser.Expr); list.Cdr != list {
+		t.Errorf("expected cyclic list, got cdr %v", list.Cdr)
+	}
+
+	if vector := program[1].(*parser.Vector); vector.Elements[1] != vector {
+		t.Errorf("expected vector containing itself")
+	}
+
+	if list := program[2].(*parser.Expr); list.Car != list.Cdr.(*parser.Expr).Car {
+		t.Errorf("expected shared element, got %v", list)
+	}
+
+	quoted := program[3].(*parser.Expr).Cdr.(*parser.Expr).Car.(*parser.Expr)
+	if quoted.Cdr.(*parser.Expr).Car != quoted {
+		t.Errorf("expected cyclic quotation")
+	}
+
+	if _, err := parse("(#0=(c) #0#)", true); err != nil {
+		t.Errorf("unexpected error for shared datum with cycles rejected: %v", err)
+	}
+
+	testCases := map[string]error{
+		"#0=(a . #0#)":   parser.CYCLIC_DATUM,
+		"#0=#(#0#)":      parser.CYCLIC_DATUM,
+		"#0#":            parser.UNDEFINED_LABEL,
+		"#0=#0#":         parser.UNDEFINED_LABEL,
+		"#0=a #0#":       parser.UNDEFINED_LABEL,
+		"(#0=a #0=b)":    parser.DUPLICATE_LABEL,
+		"#0=":            parser.UNEXPECTED_EOF,
+		"(#0=(a . #0#))": parser.CYCLIC_DATUM,
+	}
+
+	for input, expected := range testCases {
+		if _, err := parse(input, true); !errors.Is(err, expected) {
+			t.Errorf("expected %v got %v for %s", expected, err, input)
+		}
+	}
+}
+
+func TestParser_Nil(t *testing.T) {
+	var tokens []lexer.Token
+	for token, err := range lexer.NewFromString("() (a) '() #(()) #0=()").Tokens() {
+		if err != nil {
+			t.Fatal(err)
+		}
+		tokens = append(tokens, token)
+	}
+
+	p := parser.Parser{Tokens: tokens, WithPositions: true}
+
+	program, err := p.Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	quoted := program[2].(*parser.Expr).Cdr.(*parser.Expr)
+	nils := []parser.Sexpr{
+		program[0],
+		program[1].(*parser.Expr).Cdr,
+		quoted.Car,
+		quoted.Cdr,
+		program[3].(*parser.Vector).Elements[0],
+		program[4],
+	}
+
+	for i, s := range nils {
+		if s != parser.Nil {
+			t.Errorf("expected Nil got %v at %d", s, i)
+		}
+	}
+
+	if *parser.Nil != (parser.Expr{}) {
+		t.Errorf("expected Nil unchanged, got %+v", *parser.Nil)
+	}
+
+	if !parser.Nil.Equals(&parser.Expr{}) || !(&parser.Expr{}).Equals(parser.Nil) {
+		t.Error("expected Nil to equal pair with nil Car and Cdr")
+	}
+}
+
+func TestParser_Bytevector(t *testing.T) {
+	parse := func(input string) ([]parser.Sexpr, error) {
+		var tokens []lexer.Token
+		for token, err := range lexer.NewFromString(input).Tokens() {
+			if err != nil {
+				t.Fatal(err)
+			}
+			tokens = append(tokens, token)
+		}
+
+		p := parser.Parser{Tokens: tokens}
+
+		return p.Parse()
+	}
+
+	program, err := parse("#u8(0 #;1 #xff #e1.0) #u8() #0=#u8(7)")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []parser.Sexpr{
+		&parser.Bytevector{Bytes: []byte{0, 255, 1}},
+		&parser.Bytevector{Bytes: []byte{}},
+		&parser.Bytevector{Bytes: []byte{7}},
+	}
+
+	for i := range expected {
+		if !program[i].Equals(expected[i]) {
+			t.Errorf("expected %v got %v", expected[i], program[i])
+		}
+	}
+
+	if program[0].Equals(&parser.Vector{Elements: []parser.Sexpr{}}) || program[1].Equals(&parser.Bytevector{Bytes: []byte{0}}) {
+		t.Error("expected bytevectors to differ")
+	}
+
+	testCases := map[string]error{
+		"#u8(256)":   parser.INVALID_BYTE,
+		"#u8(-1)":    parser.INVALID_BYTE,
+		"#u8(1.0)":   parser.INVALID_BYTE,
+		"#u8(1/2)":   parser.INVALID_BYTE,
+		"#u8(a)":     parser.INVALID_BYTE,
+		"#u8((1))":   parser.INVALID_BYTE,
+		"#u8(1 2":    parser.UNEXPECTED_EOF,
+		"#u8(1 . 2)": parser.UNEXPECTED_DOT,
+	}
+
+	for input, expected := range testCases {
+		if _, err := parse(input); !errors.Is(err, expected) {
+			t.Errorf("expected %v got %v for %s", expected, err, input)
+		}
+	}
+
+	if _, err := parse("#u8(1\n 300)"); err == nil || !strings.HasSuffix(err.Error(), "300 at 2:2") {
+		t.Errorf("expected invalid byte 300 at 2:2, got %v", err)
+	}
+}
+
+func TestParser_MaxDepth(t *testing.T) {
+	parse := func(input string, maxDepth int) error {
+		var tokens []lexer.Token
+		for token, err := range lexer.NewFromString(input).Tokens() {
+			if err != nil {
+				t.Fatal(err)
+			}
+			tokens = append(tokens, token)
+		}
+
+		p := parser.Parser{Tokens: tokens, MaxDepth: maxDepth}
+		_, err := p.Parse()
+
+		return err
+	}
+
+	nested := func(depth int) string {
+		return strings.Repeat("(", depth) + strings.Repeat(")", depth)
+	}
+
+	testCases := []struct {
+		Input    string
+		MaxDepth int
+		Error    error
+	}{
+		{"((a)) #(#(b)) '`c #0=(d)", 2, nil},
+		{"(#(a))", 1, parser.DEPTH_EXCEEDED},
+		{"''a", 1, parser.DEPTH_EXCEEDED},
+		{"#0=(a)", 1, parser.DEPTH_EXCEEDED},
+		{"(#;(()) a)", 2, parser.DEPTH_EXCEEDED},
+		{"a (b) ((c)) (d)", 2, nil},
+		{nested(parser.DefaultMaxDepth), 0, nil},
+		{nested(parser.DefaultMaxDepth + 1), 0, parser.DEPTH_EXCEEDED},
+		{nested(2 * parser.DefaultMaxDepth), -1, nil},
+	}
+
+	for _, c := range testCases {
+		if err := parse(c.Input, c.MaxDepth); !errors.Is(err, c.Error) {
+			t.Errorf("expected %v got %v for %.20s with maximum depth %d", c.Error, err, c.Input, c.MaxDepth)
+		}
+	}
+
+	if err := parse("(a\n (b))", 1); err == nil || !strings.HasSuffix(err.Error(), "at 2:2") {
+		t.Errorf("expected depth exceeded at 2:2, got %v", err)
+	}
+}
+
+func TestParser_RegisterReader(t *testing.T) {
+	parse := func(input string) ([]parser.Sexpr, error) {
+		l := lexer.NewFromString(input)
+		l.RegisterPrefix("hash")
+		l.RegisterPrefix("rx")
+
+		var tokens []lexer.Token
+		for token, err := range l.Tokens() {
+			if err != nil {
+				t.Fatal(err)
+			}
+			tokens = append(tokens, token)
+		}
+
+		p := parser.Parser{Tokens: tokens, WithPositions: true}
+		p.RegisterReader("hash", func(datum parser.Sexpr) (parser.Sexpr, error) {
+			entries, err := parser.ToSlice(datum)
+			if err != nil {
+				return nil, err
+			}
+			return parser.Cons(parser.Symbol("hash-table"), parser.List(entries...)), nil
+		})
+
+		return p.Parse()
+	}
+
+	program, err := parse("#hash((a . 1)) (x #hash() y) (#0=(a) #hash((k . #0#)))")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"(hash-table (a . 1))", "(x (hash-table) y)", "((a) (hash-table (k a)))"}
+	for i := range expected {
+		if actual := parser.Write(program[i]); actual != expected[i] {
+			t.Errorf("expected %s got %s", expected[i], actual)
+		}
+	}
+
+	if span := program[0].(*parser.Expr).Span; span.Start.Offset != 0 || span.End.Offset != 14 {
+		t.Errorf("expected span of whole extension, got %v", span)
+	}
+
+	testCases := map[string]error{
+		`#rx"a"`:        parser.UNKNOWN_READER,
+		"#hash a":       parser.NOT_A_LIST,
+		"#hash(1 .":     parser.UNEXPECTED_EOF,
+		"#hash":         parser.UNEXPECTED_EOF,
+		"#0=#hash(#0#)": parser.UNDEFINED_LABEL,
+	}
+
+	for input, expected := range testCases {
+		if _, err := parse(input); !errors.Is(err, expected) {
+			t.Errorf("expected %v got %v for %s", expected, err, input)
+		}
+	}
+}
+
+func TestParser_KeepTrivia(t *testing.T) {
+	src := "; header\n#!fold-case\n(define (f x) ; trailing\n  #| block |# 'x)\n\n" +
+		"#(1 #;(skipped) 2 ( ; empty\n)) (a . ,@b) #u8(1 ;c\n) ; end\n"
+
+	l := lexer.NewFromString(src)
+	l.KeepTrivia = true
+
+	var tokens []lexer.Token
+	for token, err := range l.Tokens() {
+		if err != nil {
+			t.Fatal(err)
+		}
+		tokens = append(tokens, token)
+	}
+
+	p := parser.Parser{Tokens: tokens, WithPositions: true, KeepTrivia: true}
+	program, err := p.Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var sb strings.Builder
+
+	writeTrivia := func(trivia *parser.Trivia, inner bool) {
+		if trivia == nil {
+			return
+		}
+		tokens := trivia.Leading
+		if inner {
+			tokens = trivia.Inner
+		}
+		for _, token := range tokens {
+			sb.WriteString(src[token.Pos.Offset:token.End.Offset])
+		}
+	}
+
+	// write writes datum back from its trivia and source of its atoms.
+	var write func(s parser.Sexpr)
+	write = func(s parser.Sexpr) {
+		switch d := s.(type) {
+		case *parser.Atom:
+			writeTrivia(d.Trivia, false)
+			sb.WriteString(src[d.Span.Start.Offset:d.Span.End.Offset])
+		case *parser.Bytevector:
+			writeTrivia(d.Trivia, false)
+			sb.WriteString(src[d.Span.Start.Offset:d.Span.End.Offset])
+		case *parser.Vector:
+			writeTrivia(d.Trivia, false)
+			sb.WriteString("#(")
+			for _, element := range d.Elements {
+				write(element)
+			}
+			writeTrivia(d.Trivia, true)
+			sb.WriteString(")")
+		case *parser.Expr:
+			writeTrivia(d.Trivia, false)
+			if rest := src[d.Span.Start.Offset:]; strings.HasPrefix(rest, ",@") {
+				sb.WriteString(",@")
+				write(d.Cdr.(*parser.Expr).Car)
+				return
+			} else if strings.ContainsRune("'`,", rune(rest[0])) {
+				sb.WriteByte(rest[0])
+				write(d.Cdr.(*parser.Expr).Car)
+				return
+			}
+			sb.WriteString("(")
+			for pair := d; pair.Car != nil; {
+				write(pair.Car)
+				// Tail of improper list has dot in its leading trivia.
+				next, ok := pair.Cdr.(*parser.Expr)
+				if !ok || (next.Trivia != nil && slices.ContainsFunc(next.Trivia.Leading, func(token lexer.Token) bool {
+					return token.Type == lexer.DOT
+				})) {
+					write(pair.Cdr)
+					break
+				}
+				pair = next
+			}
+			writeTrivia(d.Trivia, true)
+			sb.WriteString(")")
+		}
+	}
+
+	for _, datum := range program {
+		write(datum)
+	}
+	for _, token := range p.Trailing {
+		sb.WriteString(token.Literal)
+	}
+
+	if sb.String() != src {
+		t.Errorf("expected source written back as\n%s\ngot\n%s", src, sb.String())
+	}
+
+	define := program[0].(*parser.Expr)
+	if leading := define.Trivia.Leading; len(leading) != 4 || leading[2].Type != lexer.DIRECTIVE {
+		t.Errorf("expected comment, directive and whitespace before define, got %v", leading)
+	}
+
+	if vector := program[1].(*parser.Vector); vector.Elements[2].(*parser.Expr) == parser.Nil {
+		t.Errorf("expected empty list with trivia not to be Nil")
+	} else if !vector.Elements[2].Equals(parser.Nil) {
+		t.Errorf("expected empty list with trivia to equal Nil")
+	}
+
+	if len(p.Trailing) != 3 || p.Trailing[1].Literal != "; end" {
+		t.Errorf("expected trailing trivia, got %v", p.Trailing)
+	}
+
+	p = parser.Parser{Tokens: tokens}
+	withoutTrivia, err := p.Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range program {
+		if !withoutTrivia[i].Equals(program[i]) {
+			t.Errorf("expected %v got %v without trivia", program[i], withoutTrivia[i])
+		}
+	}
+	if p.Trailing != nil || withoutTrivia[0].(*parser.Expr).Trivia != nil {
+		t.Errorf("expected no trivia kept")
+	}
+}
@@ -0,0 +1,33 @@
+package parser
+
+import (
+	"github.com/vkhonin/scheme/lexer"
+	"io"
+)
+
+// ParseString returns data of source src, as Parse returns them for tokens of
+// src. Errors of lexer are reported as they are.
+func ParseString(src string) ([]Sexpr, error) {
+	return parseTokens(lexer.NewFromString(src))
+}
+
+// ParseReader returns data of source read from r, as ParseString does.
+func ParseReader(r io.Reader) ([]Sexpr, error) {
+	return parseTokens(lexer.New(r))
+}
+
+func parseTokens(l *lexer.Lexer) ([]Sexpr, error) {
+	var tokens []lexer.Token
+
+	for token, err := range l.Tokens() {
+		if err != nil {
+			return nil, err
+		}
+
+		tokens = append(tokens, token)
+	}
+
+	p := Parser{Tokens: tokens}
+
+	return p.Parse()
+}
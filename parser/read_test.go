@@ -0,0 +1,59 @@
+package parser_test
+
+import (
+	"errors"
+	"github.com/vkhonin/scheme/lexer"
+	"github.com/vkhonin/scheme/parser"
+	"strings"
+	"testing"
+)
+
+func TestParseString(t *testing.T) {
+	src := `(define (f x) "doc" x) #(1 #\a) ; comment`
+	expected := []parser.Sexpr{
+		parser.List(
+			parser.Symbol("define"),
+			parser.List(parser.Symbol("f"), parser.Symbol("x")),
+			parser.Str("doc"),
+			parser.Symbol("x"),
+		),
+		&parser.Vector{Elements: []parser.Sexpr{parser.Int(1), parser.Char('a')}},
+	}
+
+	for name, parse := range map[string]func(string) ([]parser.Sexpr, error){
+		"ParseString": parser.ParseString,
+		"ParseReader": func(src string) ([]parser.Sexpr, error) { return parser.ParseReader(strings.NewReader(src)) },
+	} {
+		program, err := parse(src)
+		if err != nil {
+			t.Fatalf("%s: unexpected error %v", name, err)
+		}
+
+		if len(program) != len(expected) {
+			t.Fatalf("%s: expected %v got %v", name, expected, program)
+		}
+		for i := range expected {
+			if !program[i].Equals(expected[i]) {
+				t.Errorf("%s: expected %v got %v", name, expected[i], program[i])
+			}
+		}
+
+		if program, err := parse(""); err != nil || len(program) != 0 {
+			t.Errorf("%s: expected no data got %v, %v", name, program, err)
+		}
+
+		testCases := map[string]error{
+			"(a":     parser.UNEXPECTED_EOF,
+			`"abc`:   lexer.UNEXPECTED_EOF,
+			"a)":     parser.UNEXPECTED_RPAREN,
+			"#0#":    parser.UNDEFINED_LABEL,
+			"(a . )": parser.UNEXPECTED_RPAREN,
+		}
+
+		for input, expectedErr := range testCases {
+			if _, err := parse(input); !errors.Is(err, expectedErr) {
+				t.Errorf("%s: expected %v got %v for %s", name, expectedErr, err, input)
+			}
+		}
+	}
+}
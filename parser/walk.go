@@ -0,0 +1,152 @@
+package parser
+
+import (
+	"slices"
+)
+
+// Walk calls fn for s and, if fn returns true, for each element of s if it is
+// list or vector, in depth-first order. Improper tail of list is
+// walked after its elements; empty list ending proper list is not. Pairs and
+// vectors containing themselves are not walked again, so Walk stops on
+// cyclic data.
+func Walk(s Sexpr, fn func(Sexpr) bool) {
+	type frame struct {
+		sexpr Sexpr
+		kind  int
+	}
+
+	const (
+		datum = iota // Datum fn is called for
+		spine        // Rest of list being walked
+		exit         // Walk of pair or vector ends
+	)
+
+	// Pairs and vectors being walked
+	active := make(map[Sexpr]bool)
+
+	stack := []frame{{sexpr: s, kind: datum}}
+	for len(stack) > 0 {
+		top := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		switch top.kind {
+		case exit:
+			delete(active, top.sexpr)
+			continue
+		case datum:
+			if active[top.sexpr] || !fn(top.sexpr) {
+				continue
+			}
+		}
+
+		switch d := top.sexpr.(type) {
+		case *Vector:
+			active[d] = true
+			stack = append(stack, frame{sexpr: d, kind: exit})
+			for i := len(d.Elements) - 1; i >= 0; i-- {
+				stack = append(stack, frame{sexpr: d.Elements[i], kind: datum})
+			}
+		case *Expr:
+			if isNull(d) || active[d] {
+				continue
+			}
+
+			active[d] = true
+			stack = append(stack, frame{sexpr: d, kind: exit})
+
+			if _, ok := d.Cdr.(*Expr); ok {
+				stack = append(stack, frame{sexpr: d.Cdr, kind: spine})
+			} else {
+				stack = append(stack, frame{sexpr: d.Cdr, kind: datum})
+			}
+			stack = append(stack, frame{sexpr: d.Car, kind: datum})
+		}
+	}
+}
+
+// Map returns copy of s with each datum replaced by result of fn for it.
+// Elements of lists and vectors are mapped before containing data, so fn
+// receives lists and vectors of mapped elements. Empty list ending proper
+// list is kept as it is. Spans and trivia of pairs and vectors are copied.
+// Map doesn't modify s, which must not be cyclic.
+func Map(s Sexpr, fn func(Sexpr) Sexpr) Sexpr {
+	// frame is datum to map or, if spine or vector is set, list or vector
+	// elements of which are mapped.
+	type frame struct {
+		sexpr    Sexpr
+		spine    []*Expr
+		improper bool
+		vector   *Vector
+	}
+
+	var results []Sexpr
+
+	// pop returns last n results.
+	pop := func(n int) []Sexpr {
+		popped := results[len(results)-n:]
+		results = results[:len(results)-n]
+		return popped
+	}
+
+	stack := []frame{{sexpr: s}}
+	for len(stack) > 0 {
+		top := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		switch {
+		case top.vector != nil:
+			elements := slices.Clone(pop(len(top.vector.Elements)))
+			results = append(results, fn(&Vector{Elements: elements, Span: top.vector.Span, Trivia: top.vector.Trivia}))
+			continue
+		case top.spine != nil:
+			tail := Sexpr(Nil)
+			if top.improper {
+				tail = pop(1)[0]
+			}
+
+			cars := pop(len(top.spine))
+			for i := len(top.spine) - 1; i >= 0; i-- {
+				tail = &Expr{Car: cars[i], Cdr: tail, Span: top.spine[i].Span, Trivia: top.spine[i].Trivia}
+			}
+
+			results = append(results, fn(tail))
+			continue
+		}
+
+		switch d := top.sexpr.(type) {
+		case *Vector:
+			stack = append(stack, frame{vector: d})
+			for i := len(d.Elements) - 1; i >= 0; i-- {
+				stack = append(stack, frame{sexpr: d.Elements[i]})
+			}
+		case *Expr:
+			if isNull(d) {
+				results = append(results, fn(d))
+				continue
+			}
+
+			var spine []*Expr
+
+			tail := Sexpr(d)
+			for pair, ok := d, true; ok && !isNull(pair); pair, ok = tail.(*Expr) {
+				spine = append(spine, pair)
+				tail = pair.Cdr
+			}
+
+			e, ok := tail.(*Expr)
+			improper := !ok || !isNull(e)
+
+			stack = append(stack, frame{spine: spine, improper: improper})
+			if improper {
+				stack = append(stack, frame{sexpr: tail})
+			}
+			for i := len(spine) - 1; i >= 0; i-- {
+				stack = append(stack, frame{sexpr: spine[i].Car})
+			}
+		default:
+			results = append(results, fn(d))
+		}
+	}
+
+	return results[0]
+}
@@ -0,0 +1,92 @@
+package parser_test
+
+import (
+	"github.com/vkhonin/scheme/parser"
+	"slices"
+	"testing"
+)
+
+func TestWalk(t *testing.T) {
+	a, b, c, d := parser.Symbol("a"), parser.Symbol("b"), parser.Symbol("c"), parser.Symbol("d")
+
+	inner := parser.Cons(b, c)
+	vector := &parser.Vector{Elements: []parser.Sexpr{d, parser.Nil}}
+	list := parser.List(a, inner, vector)
+
+	var visited []string
+	parser.Walk(list, func(s parser.Sexpr) bool {
+		visited = append(visited, parser.Write(s))
+		return true
+	})
+
+	expected := []string{"(a (b . c) #(d ()))", "a", "(b . c)", "b", "c", "#(d ())", "d", "()"}
+	if !slices.Equal(visited, expected) {
+		t.Errorf("expected %v got %v", expected, visited)
+	}
+
+	visited = nil
+	parser.Walk(list, func(s parser.Sexpr) bool {
+		visited = append(visited, parser.Write(s))
+		return s == list
+	})
+
+	expected = []string{"(a (b . c) #(d ()))", "a", "(b . c)", "#(d ())"}
+	if !slices.Equal(visited, expected) {
+		t.Errorf("expected %v got %v", expected, visited)
+	}
+
+	cyclic := parser.List(a, b)
+	cyclic.Cdr.(*parser.Expr).Cdr = cyclic
+	cyclicVector := &parser.Vector{Elements: []parser.Sexpr{c, nil}}
+	cyclicVector.Elements[1] = cyclicVector
+
+	count := 0
+	parser.Walk(parser.List(cyclic, cyclicVector), func(s parser.Sexpr) bool {
+		count++
+		return true
+	})
+
+	if count != 6 {
+		t.Errorf("expected 6 data walked got %d", count)
+	}
+}
+
+func TestMap(t *testing.T) {
+	source := parser.List(parser.Int(1), parser.Cons(parser.Int(2), parser.Int(3)), &parser.Vector{Elements: []parser.Sexpr{parser.Int(4)}}, parser.Nil)
+	written := parser.Write(source)
+
+	var order []string
+	mapped := parser.Map(source, func(s parser.Sexpr) parser.Sexpr {
+		order = append(order, parser.Write(s))
+
+		if a, ok := s.(*parser.Atom); ok && a.Type == parser.NUMBER {
+			return parser.Symbol("n" + parser.Write(a))
+		}
+		return s
+	})
+
+	if actual := parser.Write(mapped); actual != "(n1 (n2 . n3) #(n4) ())" {
+		t.Errorf("expected (n1 (n2 . n3) #(n4) ()) got %s", actual)
+	}
+
+	expected := []string{"1", "2", "3", "(n2 . n3)", "4", "#(n4)", "()", "(n1 (n2 . n3) #(n4) ())"}
+	if !slices.Equal(order, expected) {
+		t.Errorf("expected %v got %v", expected, order)
+	}
+
+	if actual := parser.Write(source); actual != written {
+		t.Errorf("expected source %s unchanged got %s", written, actual)
+	}
+
+	// Function may replace lists, e.g. expanding macros.
+	expanded := parser.Map(parser.List(parser.Symbol("not"), parser.Bool(true)), func(s parser.Sexpr) parser.Sexpr {
+		if e, ok := s.(*parser.Expr); ok && e.Car.Equals(parser.Symbol("not")) {
+			return parser.List(parser.Symbol("if"), e.Cdr.(*parser.Expr).Car, parser.Bool(false), parser.Bool(true))
+		}
+		return s
+	})
+
+	if actual := parser.Write(expanded); actual != "(if #t #f #t)" {
+		t.Errorf("expected (if #t #f #t) got %s", actual)
+	}
+}
@@ -0,0 +1,223 @@
+package parser
+
+import (
+	"fmt"
+	"github.com/vkhonin/scheme/lexer"
+	"github.com/vkhonin/scheme/parser/number"
+	"strconv"
+	"strings"
+)
+
+type printer struct {
+	sb strings.Builder
+
+	// display makes printer write strings and characters as their contents
+	// and symbols as their names.
+	display bool
+
+	// labels are pairs and vectors written with datum labels, mapped to
+	// their label numbers, or to -1 until they are written first.
+	labels    map[Sexpr]int
+	nextLabel int
+}
+
+// Write returns external representation of sexpr as write procedure prints
+// it. Representation of datum reads back as equal datum: strings are quoted,
+// characters are written as literals and symbols are quoted if needed.
+// Datum labels are written for cycles only, e.g. #0=(a . #0#).
+func Write(sexpr Sexpr) string {
+	p := printer{}
+	p.labels, _ = findLabels(sexpr, false)
+	p.print(sexpr)
+
+	return p.sb.String()
+}
+
+// WriteShared returns representation of sexpr as write-shared procedure
+// prints it, which is like Write, except that datum labels are written for
+// any pair or vector occurring in sexpr more than once.
+func WriteShared(sexpr Sexpr) string {
+	p := printer{}
+	p.labels, _ = findLabels(sexpr, true)
+	p.print(sexpr)
+
+	return p.sb.String()
+}
+
+// WriteSimple returns representation of sexpr as write-simple procedure
+// prints it, which is like Write, except that no datum labels are written,
+// so shared data are written as many times as they occur. It reports
+// CYCLIC_DATUM for cyclic data, which would be written infinitely.
+func WriteSimple(sexpr Sexpr) (string, error) {
+	if _, cyclic := findLabels(sexpr, false); cyclic {
+		return "", CYCLIC_DATUM
+	}
+
+	p := printer{}
+	p.print(sexpr)
+
+	return p.sb.String(), nil
+}
+
+// Display returns representation of sexpr as display procedure prints it,
+// which is like Write, except that strings, characters and symbols are
+// written as they are, e.g. string "a b" is a b and character #\a is a.
+func Display(sexpr Sexpr) string {
+	p := printer{display: true}
+	p.labels, _ = findLabels(sexpr, false)
+	p.print(sexpr)
+
+	return p.sb.String()
+}
+
+func (a *Atom) String() string {
+	return Write(a)
+}
+
+func (e *Expr) String() string {
+	return Write(e)
+}
+
+func (v *Vector) String() string {
+	return Write(v)
+}
+
+func (b *Bytevector) String() string {
+	return Write(b)
+}
+
+// print writes sexpr. Data are written with explicit stack of data and text
+// left to write rather than recursively, so deep data don't exhaust Go stack.
+func (p *printer) print(sexpr Sexpr) {
+	stack := []printItem{{sexpr: sexpr}}
+
+	for len(stack) > 0 {
+		top := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		if top.sexpr == nil {
+			p.sb.WriteString(top.text)
+			continue
+		}
+
+		stack = p.printDatum(top.sexpr, stack)
+	}
+}
+
+// printItem is datum or, if it is nil, text left to write.
+type printItem struct {
+	sexpr Sexpr
+	text  string
+}
+
+// printDatum writes start of sexpr and returns stack with rest of it pushed.
+func (p *printer) printDatum(sexpr Sexpr, stack []printItem) []printItem {
+	if label, ok := p.labels[sexpr]; ok {
+		if label >= 0 {
+			fmt.Fprintf(&p.sb, "#%d#", label)
+			return stack
+		}
+
+		p.labels[sexpr] = p.nextLabel
+		fmt.Fprintf(&p.sb, "#%d=", p.nextLabel)
+		p.nextLabel++
+	}
+
+	switch s := sexpr.(type) {
+	case *Atom:
+		p.printAtom(s)
+	case *Expr:
+		return p.printList(s, stack)
+	case *Vector:
+		p.sb.WriteString("#(")
+		stack = append(stack, printItem{text: ")"})
+		for i := len(s.Elements) - 1; i >= 0; i-- {
+			stack = append(stack, printItem{sexpr: s.Elements[i]})
+			if i > 0 {
+				stack = append(stack, printItem{text: " "})
+			}
+		}
+	case *Bytevector:
+		p.sb.WriteString("#u8(")
+		for i, b := range s.Bytes {
+			if i > 0 {
+				p.sb.WriteByte(' ')
+			}
+			p.sb.WriteString(strconv.Itoa(int(b)))
+		}
+		p.sb.WriteByte(')')
+	default:
+		fmt.Fprint(&p.sb, s)
+	}
+
+	return stack
+}
+
+func (p *printer) printAtom(a *Atom) {
+	switch a.Type {
+	case BOOL:
+		if (a.Value).(bool) {
+			p.sb.WriteString("#t")
+		} else {
+			p.sb.WriteString("#f")
+		}
+	case NUMBER:
+		p.sb.WriteString((a.Value).(*number.Number).String())
+	case CHAR:
+		if p.display {
+			p.sb.WriteRune((a.Value).(rune))
+		} else {
+			p.sb.WriteString(lexer.CharLiteral((a.Value).(rune)))
+		}
+	case STRING:
+		if p.display {
+			p.sb.WriteString((a.Value).(string))
+		} else {
+			p.sb.WriteString(lexer.QuoteString((a.Value).(string)))
+		}
+	case SYMBOL:
+		if p.display {
+			p.sb.WriteString((a.Value).(string))
+		} else {
+			p.sb.WriteString(lexer.QuoteIdentifier((a.Value).(string)))
+		}
+	default:
+		fmt.Fprintf(&p.sb, "#<atom %d %v>", a.Type, a.Value)
+	}
+}
+
+// printList writes start of list e and returns stack with its elements
+// pushed, walking its spine iteratively. Improper list is written with its
+// tail after dot, e.g. (a b . c), and so is labelled tail.
+func (p *printer) printList(e *Expr, stack []printItem) []printItem {
+	p.sb.WriteByte('(')
+
+	var items []printItem
+
+	for first := true; !isNull(e); first = false {
+		if !first {
+			items = append(items, printItem{text: " "})
+		}
+		items = append(items, printItem{sexpr: e.Car})
+
+		next, ok := e.Cdr.(*Expr)
+		if _, labelled := p.labels[next]; !ok || labelled {
+			items = append(items, printItem{text: " . "}, printItem{sexpr: e.Cdr})
+			break
+		}
+		e = next
+	}
+
+	stack = append(stack, printItem{text: ")"})
+	for i := len(items) - 1; i >= 0; i-- {
+		stack = append(stack, items[i])
+	}
+
+	return stack
+}
+
+// isNull reports whether e is empty list, i.e. Nil or any other pair
+// with nil Car and Cdr.
+func isNull(e *Expr) bool {
+	return e == Nil || (e.Car == nil && e.Cdr == nil)
+}
@@ -0,0 +1,101 @@
+package parser
+
+// labelFinder finds pairs and vectors of datum which need datum labels.
+type labelFinder struct {
+	// shared makes finder label data occurring more than once, not only
+	// cycles.
+	shared bool
+
+	visited map[Sexpr]bool // Visited data, true while being visited
+	labels  map[Sexpr]int
+}
+
+// findLabels returns pairs and vectors of sexpr which need datum labels,
+// mapped to -1, and reports whether sexpr is cyclic. Labelled are data
+// referenced from inside themselves, or, if shared is set, any data
+// referenced more than once.
+func findLabels(sexpr Sexpr, shared bool) (map[Sexpr]int, bool) {
+	f := labelFinder{shared: shared, visited: make(map[Sexpr]bool)}
+	cyclic := f.visit(sexpr)
+
+	return f.labels, cyclic
+}
+
+// IsCyclic reports whether sexpr contains itself, e.g. as #0=(a . #0#) does.
+func IsCyclic(sexpr Sexpr) bool {
+	_, cyclic := findLabels(sexpr, false)
+
+	return cyclic
+}
+
+// visit visits sexpr and reports whether cycle is found in it. Data are
+// visited with explicit stack rather than recursively, so deep data don't
+// exhaust Go stack. Pair or vector stays being visited until its elements
+// are, so reference to it from them is cycle.
+func (f *labelFinder) visit(sexpr Sexpr) bool {
+	type frame struct {
+		sexpr Sexpr
+		exit  bool // Visit of sexpr ends
+	}
+
+	var cyclic bool
+
+	stack := []frame{{sexpr: sexpr}}
+	for len(stack) > 0 {
+		top := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		if top.exit {
+			f.visited[top.sexpr] = false
+			continue
+		}
+		if !f.enter(top.sexpr, &cyclic) {
+			continue
+		}
+
+		stack = append(stack, frame{sexpr: top.sexpr, exit: true})
+
+		switch s := top.sexpr.(type) {
+		case *Vector:
+			for i := len(s.Elements) - 1; i >= 0; i-- {
+				stack = append(stack, frame{sexpr: s.Elements[i]})
+			}
+		case *Expr:
+			stack = append(stack, frame{sexpr: s.Cdr}, frame{sexpr: s.Car})
+		}
+	}
+
+	return cyclic
+}
+
+// enter marks sexpr visited and reports whether it should be visited, i.e.
+// it is pair or vector not visited before. Datum visited before is labelled
+// if it is being visited, which means cycle, or if shared is set.
+func (f *labelFinder) enter(sexpr Sexpr, cyclic *bool) bool {
+	switch s := sexpr.(type) {
+	case *Expr:
+		if isNull(s) {
+			return false
+		}
+	case *Vector:
+	default:
+		return false
+	}
+
+	active, visited := f.visited[sexpr]
+	if !visited {
+		f.visited[sexpr] = true
+		return true
+	}
+
+	if active || f.shared {
+		if f.labels == nil {
+			f.labels = make(map[Sexpr]int)
+		}
+		f.labels[sexpr] = -1
+	}
+
+	*cyclic = *cyclic || active
+
+	return false
+}
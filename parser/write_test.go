@@ -0,0 +1,40 @@
+package parser_test
+
+import (
+	"fmt"
+	"github.com/vkhonin/scheme/parser"
+	"github.com/vkhonin/scheme/parser/number"
+	"math/big"
+	"testing"
+)
+
+func TestSexpr_String(t *testing.T) {
+	list := &parser.Expr{
+		Car: &parser.Atom{Type: parser.SYMBOL, Value: "a"},
+		Cdr: &parser.Expr{Car: &parser.Atom{Type: parser.STRING, Value: "b c"}, Cdr: parser.Nil},
+	}
+
+	cyclic := &parser.Expr{Car: &parser.Atom{Type: parser.BOOL, Value: true}}
+	cyclic.Cdr = cyclic
+
+	testCases := map[string]fmt.Stringer{
+		`#\x`:           &parser.Atom{Type: parser.CHAR, Value: 'x'},
+		"42":            &parser.Atom{Type: parser.NUMBER, Value: number.NewFromInt(big.NewInt(42))},
+		"|odd name|":    &parser.Atom{Type: parser.SYMBOL, Value: "odd name"},
+		`(a "b c")`:     list,
+		"()":            parser.Nil,
+		"#0=(#t . #0#)": cyclic,
+		`#((a "b c"))`:  &parser.Vector{Elements: []parser.Sexpr{list}},
+		"#u8(1 2)":      &parser.Bytevector{Bytes: []byte{1, 2}},
+	}
+
+	for expected, s := range testCases {
+		if actual := s.String(); actual != expected {
+			t.Errorf("expected %s got %s", expected, actual)
+		}
+	}
+
+	if actual := fmt.Sprintf("%v", []parser.Sexpr{list, parser.Nil}); actual != `[(a "b c") ()]` {
+		t.Errorf("expected [(a \"b c\") ()] got %s", actual)
+	}
+}
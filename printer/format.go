@@ -0,0 +1,326 @@
+package printer
+
+import (
+	"github.com/vkhonin/scheme/lexer"
+	"github.com/vkhonin/scheme/parser"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	atomNode formatNodeKind = iota
+	listNode
+	prefixNode // Abbreviation, datum label or reader extension and its datum
+	commentNode
+	dotNode
+)
+
+type formatNodeKind uint8
+
+// formatNode is datum, comment or dot of source being formatted.
+type formatNode struct {
+	kind formatNodeKind
+
+	// text is source of atom, comment or dot, prefix of prefix node or
+	// opening parenthesis of list, vector or bytevector.
+	text   string
+	symbol bool
+	items  []*formatNode
+
+	// newlines is number of newlines before node in source.
+	newlines int
+
+	// line is set for line comment, which line has to end after.
+	line bool
+}
+
+type formatter struct {
+	prettyPrinter
+}
+
+// formatReader reads nodes of source from its tokens, which lexer returns
+// with KeepTrivia set.
+type formatReader struct {
+	src    string
+	tokens []lexer.Token
+	index  int
+}
+
+// Format returns source of program src formatted canonically. Data are
+// broken into lines as by Pretty, but atoms, e.g. numbers, and abbreviations,
+// e.g. 'x, are written as they are in src. Comments are kept, on their own
+// lines or after data they follow on the same line, as are single blank lines
+// between data on separate lines. It returns error if src is not valid
+// program.
+func Format(src string, opts Options) (string, error) {
+	l := lexer.NewFromString(src)
+	l.KeepTrivia = true
+
+	var tokens []lexer.Token
+	for token, err := range l.Tokens() {
+		if err != nil {
+			return "", err
+		}
+		tokens = append(tokens, token)
+	}
+
+	p := parser.Parser{Tokens: tokens, KeepTrivia: true}
+	if _, err := p.Parse(); err != nil {
+		return "", err
+	}
+
+	r := formatReader{src: src, tokens: tokens}
+	items := r.readItems()
+	if len(items) == 0 {
+		return "", nil
+	}
+	items[0].newlines = 0
+
+	f := formatter{prettyPrinter{width: opts.Width, indent: opts.Indent}}
+	if f.width <= 0 {
+		f.width = defaultWidth
+	}
+	if f.indent <= 0 {
+		f.indent = defaultIndent
+	}
+
+	f.printItems(items, func(int) (bool, int) { return false, 0 })
+	f.sb.WriteByte('\n')
+
+	return f.sb.String(), nil
+}
+
+// readItems reads nodes up to closing parenthesis, which it skips, or end of
+// tokens.
+func (r *formatReader) readItems() []*formatNode {
+	var (
+		items    []*formatNode
+		newlines int
+	)
+
+	for r.index < len(r.tokens) {
+		switch token := r.tokens[r.index]; token.Type {
+		case lexer.WHITESPACE:
+			newlines += strings.Count(r.text(token), "\n")
+			r.index++
+		case lexer.RPAREN:
+			r.index++
+			return items
+		default:
+			node := r.readNode()
+			node.newlines, newlines = newlines, 0
+			items = append(items, node)
+		}
+	}
+
+	return items
+}
+
+// readNode reads node at current token.
+func (r *formatReader) readNode() *formatNode {
+	token := r.tokens[r.index]
+	r.index++
+
+	switch token.Type {
+	case lexer.LCOMMENT:
+		return &formatNode{kind: commentNode, text: strings.TrimRightFunc(r.text(token), unicode.IsSpace), line: true}
+	case lexer.BCOMMENT, lexer.DIRECTIVE:
+		return &formatNode{kind: commentNode, text: r.text(token)}
+	case lexer.DCOMMENT:
+		r.readDatum()
+		return &formatNode{kind: commentNode, text: r.src[token.Pos.Offset:r.tokens[r.index-1].End.Offset]}
+	case lexer.DOT:
+		return &formatNode{kind: dotNode, text: "."}
+	case lexer.LPAREN, lexer.HPAREN, lexer.U8PAREN:
+		return &formatNode{kind: listNode, text: r.text(token), items: r.readItems()}
+	case lexer.SQUOTE, lexer.BQUOTE, lexer.COMMA, lexer.COMMAT, lexer.LABEL, lexer.EXTENSION:
+		return &formatNode{kind: prefixNode, text: r.text(token), items: r.readDatum()}
+	default:
+		return &formatNode{kind: atomNode, text: r.text(token), symbol: token.Type == lexer.IDENT}
+	}
+}
+
+// readDatum reads nodes up to and including next datum, i.e. comments before
+// it and datum itself.
+func (r *formatReader) readDatum() []*formatNode {
+	var (
+		items    []*formatNode
+		newlines int
+	)
+
+	for r.index < len(r.tokens) {
+		if token := r.tokens[r.index]; token.Type == lexer.WHITESPACE {
+			newlines += strings.Count(r.text(token), "\n")
+			r.index++
+			continue
+		}
+
+		node := r.readNode()
+		node.newlines, newlines = newlines, 0
+		items = append(items, node)
+
+		if node.kind != commentNode {
+			break
+		}
+	}
+
+	return items
+}
+
+func (r *formatReader) text(token lexer.Token) string {
+	return r.src[token.Pos.Offset:token.End.Offset]
+}
+
+// print writes n starting at current column, on one line if it fits.
+func (f *formatter) print(n *formatNode) {
+	if flat, ok := n.flat(); ok && f.column()+utf8.RuneCountInString(flat) <= f.width {
+		f.sb.WriteString(flat)
+		return
+	}
+
+	switch n.kind {
+	case listNode:
+		f.printList(n)
+	case prefixNode:
+		f.sb.WriteString(n.text)
+		f.printItems(n.items, func(int) (bool, int) { return true, f.column() })
+	default:
+		f.sb.WriteString(n.text)
+	}
+}
+
+// printList writes list, vector or bytevector n, laid out as Pretty does.
+func (f *formatter) printList(n *formatNode) {
+	column := f.column()
+	aligned := column + utf8.RuneCountInString(n.text)
+
+	f.sb.WriteString(n.text)
+
+	var data []*formatNode
+	for _, item := range n.items {
+		if item.kind != commentNode {
+			data = append(data, item)
+		}
+	}
+
+	var name string
+	if n.text == "(" && len(n.items) > 0 && n.items[0].symbol {
+		name = n.items[0].text
+	}
+	kept, isBodyForm := bodyForms[name]
+
+	// layout reports whether d-th datum of n is written on line of previous
+	// one, and column it is written at otherwise.
+	var layout func(d int) (bool, int)
+
+	switch {
+	case name != "" && isBodyForm:
+		// Named let keeps its name on line of keyword too.
+		if name == "let" && len(data) > 1 && data[1].symbol {
+			kept++
+		}
+		layout = func(d int) (bool, int) { return d <= kept, column + f.indent }
+	case name != "" && len(data) > 1 && column+utf8.RuneCountInString(name)+2 <= f.width/2:
+		operands := column + utf8.RuneCountInString(name) + 2
+		layout = func(d int) (bool, int) { return d <= 1, operands }
+	case name != "":
+		layout = func(d int) (bool, int) { return d == 0, column + f.indent }
+	case len(data) == len(n.items) && !hasListItems(n):
+		// Atoms are filled into lines.
+		layout = func(d int) (bool, int) {
+			flat, _ := data[d].flat()
+			return d == 0 || f.column()+1+utf8.RuneCountInString(flat) <= f.width, aligned
+		}
+	default:
+		layout = func(d int) (bool, int) { return d == 0, aligned }
+	}
+
+	f.printItems(n.items, layout)
+
+	if len(n.items) > 0 && n.items[len(n.items)-1].line {
+		_, column := layout(len(data))
+		f.newline(column)
+	}
+
+	f.sb.WriteByte(')')
+}
+
+// printItems writes items, placing each datum as layout reports given its
+// index among data. Comments stay on their own lines or after items they
+// follow, and single blank lines before items on their own lines are kept.
+// Dot and tail of improper list are written on line of last element.
+func (f *formatter) printItems(items []*formatNode, layout func(d int) (bool, int)) {
+	d := 0
+
+	for i, item := range items {
+		sameLine, column := layout(d)
+
+		switch {
+		case item.kind == commentNode:
+			sameLine = item.newlines == 0
+		case item.kind == dotNode, i > 0 && items[i-1].kind == dotNode:
+			sameLine = true
+		}
+		if i > 0 && items[i-1].kind == commentNode && (items[i-1].line || item.newlines > 0) {
+			sameLine = false
+		}
+
+		switch {
+		case i == 0 && (item.kind != commentNode || sameLine):
+		case sameLine:
+			f.sb.WriteByte(' ')
+		default:
+			if i > 0 && item.newlines > 1 {
+				f.sb.WriteByte('\n')
+			}
+			f.newline(column)
+		}
+
+		f.print(item)
+
+		if item.kind != commentNode {
+			d++
+		}
+	}
+}
+
+// flat returns n written on one line, unless it has comments which have to be
+// on their own lines.
+func (n *formatNode) flat() (string, bool) {
+	switch n.kind {
+	case commentNode:
+		return n.text, !n.line && n.newlines == 0 && !strings.Contains(n.text, "\n")
+	case atomNode, dotNode:
+		return n.text, true
+	}
+
+	var sb strings.Builder
+
+	sb.WriteString(n.text)
+	for i, item := range n.items {
+		flat, ok := item.flat()
+		if !ok {
+			return "", false
+		}
+		if i > 0 {
+			sb.WriteByte(' ')
+		}
+		sb.WriteString(flat)
+	}
+	if n.kind == listNode {
+		sb.WriteByte(')')
+	}
+
+	return sb.String(), true
+}
+
+func hasListItems(n *formatNode) bool {
+	for _, item := range n.items {
+		if item.kind == listNode || item.kind == prefixNode {
+			return true
+		}
+	}
+
+	return false
+}
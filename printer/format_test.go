@@ -0,0 +1,96 @@
+package printer_test
+
+import (
+	"errors"
+	"github.com/vkhonin/scheme/parser"
+	"github.com/vkhonin/scheme/printer"
+	"testing"
+)
+
+func TestFormat(t *testing.T) {
+	testCases := []struct {
+		Input   string
+		Options printer.Options
+		Output  string
+	}{
+		{"", printer.Options{}, ""},
+		{"  (define  x\n  1)  ", printer.Options{}, "(define x 1)\n"},
+		{
+			"(let loop ((i 0) (acc '())) (if (< i 10) (loop (+ i 1) (cons i acc)) (reverse acc)))",
+			printer.Options{Width: 30},
+			"(let loop ((i 0) (acc '()))\n" +
+				"  (if (< i 10)\n" +
+				"      (loop (+ i 1)\n" +
+				"            (cons i acc))\n" +
+				"      (reverse acc)))\n",
+		},
+		{"(list #x1F 1.50 #\\space \"a\\nb\" `(a ,@b))", printer.Options{}, "(list #x1F 1.50 #\\space \"a\\nb\" `(a ,@b))\n"},
+		{
+			"; header\n\n\n(define x 1) ; one\n(define y 2)\n\n\n(define z 3)\n; end\n",
+			printer.Options{},
+			"; header\n\n(define x 1) ; one\n(define y 2)\n\n(define z 3)\n; end\n",
+		},
+		{
+			"(define (f x) ; trailing\n  ;; own line\n  (g x) #| inline |# (h x))",
+			printer.Options{},
+			"(define (f x) ; trailing\n  ;; own line\n  (g x) #| inline |#\n  (h x))\n",
+		},
+		{"(f x #| inline |# y)", printer.Options{}, "(f x #| inline |# y)\n"},
+		{"#!/usr/bin/env scheme run\n(display  1)", printer.Options{}, "#!/usr/bin/env scheme run\n(display 1)\n"},
+		{"(f x #;(skipped  y) y)", printer.Options{}, "(f x #;(skipped  y) y)\n"},
+		{"(a b ; c\n)", printer.Options{}, "(a b ; c\n   )\n"},
+		{"(define (f)\n  (g)\n\n  (h))", printer.Options{Width: 10}, "(define (f)\n  (g)\n\n  (h))\n"},
+		{"(a . b)", printer.Options{}, "(a . b)\n"},
+		{"(#0=(a) . #0#)", printer.Options{}, "(#0=(a) . #0#)\n"},
+		{
+			"#u8(1 2 3 4 5 6 7 8 9 10 11 12 13 14 15 16 17 18 19 20)",
+			printer.Options{Width: 30},
+			"#u8(1 2 3 4 5 6 7 8 9 10 11 12\n" +
+				"    13 14 15 16 17 18 19 20)\n",
+		},
+	}
+
+	for _, c := range testCases {
+		output, err := printer.Format(c.Input, c.Options)
+		if err != nil {
+			t.Errorf("unexpected error %v for %q", err, c.Input)
+			continue
+		}
+		if output != c.Output {
+			t.Errorf("expected\n%s\ngot\n%s", c.Output, output)
+		}
+
+		if again, err := printer.Format(output, c.Options); err != nil || again != output {
+			t.Errorf("expected %q to be formatted as it is, got %q, %v", output, again, err)
+		}
+
+		input, _ := parser.ParseString(c.Input)
+		formatted, _ := parser.ParseString(output)
+		if len(input) != len(formatted) {
+			t.Errorf("expected %q to read back as %q", output, c.Input)
+			continue
+		}
+		for i := range input {
+			if !parser.Equal(input[i], formatted[i]) {
+				t.Errorf("expected %v to read back as %v", formatted[i], input[i])
+			}
+		}
+	}
+}
+
+func TestFormat_Errors(t *testing.T) {
+	testCases := []struct {
+		Input string
+		Err   error
+	}{
+		{"(define x", parser.UNEXPECTED_EOF},
+		{"(a))", parser.UNEXPECTED_RPAREN},
+		{"(. a)", parser.UNEXPECTED_DOT},
+	}
+
+	for _, c := range testCases {
+		if _, err := printer.Format(c.Input, printer.Options{}); !errors.Is(err, c.Err) {
+			t.Errorf("expected error %v got %v for %q", c.Err, err, c.Input)
+		}
+	}
+}
@@ -0,0 +1,231 @@
+package printer
+
+import (
+	"github.com/vkhonin/scheme/parser"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	defaultWidth  = 80
+	defaultIndent = 2
+)
+
+var (
+	// bodyForms are special forms written with their body indented, mapped
+	// to number of operands kept on line of keyword, e.g. bindings of let.
+	bodyForms = map[string]int{
+		"begin":              0,
+		"case":               1,
+		"case-lambda":        0,
+		"define":             1,
+		"define-library":     1,
+		"define-record-type": 2,
+		"define-syntax":      1,
+		"define-values":      1,
+		"delay":              0,
+		"delay-force":        0,
+		"do":                 2,
+		"guard":              1,
+		"lambda":             1,
+		"let":                1,
+		"let*":               1,
+		"let*-values":        1,
+		"let-syntax":         1,
+		"let-values":         1,
+		"letrec":             1,
+		"letrec*":            1,
+		"letrec-syntax":      1,
+		"parameterize":       1,
+		"syntax-rules":       1,
+		"unless":             1,
+		"when":               1,
+	}
+)
+
+// Options of Pretty.
+type Options struct {
+	Width  int // Maximum width of line, 80 if zero
+	Indent int // Indentation of bodies of special forms, 2 if zero
+}
+
+type prettyPrinter struct {
+	sb     strings.Builder
+	width  int
+	indent int
+}
+
+// Pretty returns external representation of sexpr as Write does, broken into
+// lines to fit width of opts where possible. Bodies of special forms, e.g.
+// let or lambda, are indented, operands of other combinations are aligned
+// under first of them and lists and vectors of atoms are filled. Cyclic data
+// are written on one line, as Write does.
+func Pretty(sexpr parser.Sexpr, opts Options) string {
+	if parser.IsCyclic(sexpr) {
+		return Write(sexpr)
+	}
+
+	p := prettyPrinter{width: opts.Width, indent: opts.Indent}
+
+	if p.width <= 0 {
+		p.width = defaultWidth
+	}
+	if p.indent <= 0 {
+		p.indent = defaultIndent
+	}
+
+	p.print(sexpr)
+
+	return p.sb.String()
+}
+
+// print writes sexpr starting at current column, on one line if it fits.
+func (p *prettyPrinter) print(sexpr parser.Sexpr) {
+	flat := Write(sexpr)
+	if p.column()+utf8.RuneCountInString(flat) <= p.width {
+		p.sb.WriteString(flat)
+		return
+	}
+
+	switch s := sexpr.(type) {
+	case *parser.Expr:
+		if isNull(s) {
+			p.sb.WriteString(flat)
+			return
+		}
+		p.printList(s)
+	case *parser.Vector:
+		column := p.column()
+		p.sb.WriteString("#(")
+		p.printItems(s.Elements, column+2)
+		p.sb.WriteByte(')')
+	default:
+		p.sb.WriteString(flat)
+	}
+}
+
+func (p *prettyPrinter) printList(e *parser.Expr) {
+	items, tail := listItems(e)
+	column := p.column()
+
+	p.sb.WriteByte('(')
+
+	name, isSymbol := symbolName(items[0])
+	kept, isBodyForm := bodyForms[name]
+
+	switch {
+	case isSymbol && isBodyForm:
+		// Named let keeps its name on line of keyword too.
+		if _, named := symbolName(itemAt(items, 1)); name == "let" && named {
+			kept++
+		}
+
+		p.sb.WriteString(Write(items[0]))
+		for _, item := range items[1:min(kept+1, len(items))] {
+			p.sb.WriteByte(' ')
+			p.print(item)
+		}
+		for _, item := range items[min(kept+1, len(items)):] {
+			p.newline(column + p.indent)
+			p.print(item)
+		}
+	case isSymbol && len(items) > 1 && column+len(Write(items[0]))+2 <= p.width/2:
+		p.sb.WriteString(Write(items[0]))
+		p.sb.WriteByte(' ')
+		p.printAligned(items[1:], p.column())
+	case isSymbol:
+		p.sb.WriteString(Write(items[0]))
+		for _, item := range items[1:] {
+			p.newline(column + p.indent)
+			p.print(item)
+		}
+	default:
+		p.printItems(items, column+1)
+	}
+
+	if tail != nil {
+		p.sb.WriteString(" . ")
+		p.print(tail)
+	}
+
+	p.sb.WriteByte(')')
+}
+
+// printItems writes items of list or vector starting at column. Atoms are
+// filled into lines, anything else is aligned.
+func (p *prettyPrinter) printItems(items []parser.Sexpr, column int) {
+	for _, item := range items {
+		switch item.(type) {
+		case *parser.Expr, *parser.Vector:
+			p.printAligned(items, column)
+			return
+		}
+	}
+
+	for i, item := range items {
+		flat := Write(item)
+		if i > 0 && p.column()+1+utf8.RuneCountInString(flat) > p.width {
+			p.newline(column)
+		} else if i > 0 {
+			p.sb.WriteByte(' ')
+		}
+		p.sb.WriteString(flat)
+	}
+}
+
+// printAligned writes items one per line starting at column.
+func (p *prettyPrinter) printAligned(items []parser.Sexpr, column int) {
+	for i, item := range items {
+		if i > 0 {
+			p.newline(column)
+		}
+		p.print(item)
+	}
+}
+
+func (p *prettyPrinter) newline(column int) {
+	p.sb.WriteByte('\n')
+	p.sb.WriteString(strings.Repeat(" ", column))
+}
+
+// column returns column of end of output, starting at 0.
+func (p *prettyPrinter) column() int {
+	s := p.sb.String()
+
+	return utf8.RuneCountInString(s[strings.LastIndexByte(s, '\n')+1:])
+}
+
+// listItems returns elements of non-empty list e and its tail, which is nil
+// for proper list.
+func listItems(e *parser.Expr) ([]parser.Sexpr, parser.Sexpr) {
+	var items []parser.Sexpr
+
+	for {
+		items = append(items, e.Car)
+
+		next, ok := e.Cdr.(*parser.Expr)
+		if !ok {
+			return items, e.Cdr
+		}
+		if isNull(next) {
+			return items, nil
+		}
+		e = next
+	}
+}
+
+func itemAt(items []parser.Sexpr, i int) parser.Sexpr {
+	if i < len(items) {
+		return items[i]
+	}
+
+	return nil
+}
+
+func symbolName(s parser.Sexpr) (string, bool) {
+	if a, ok := s.(*parser.Atom); ok && a.Type == parser.SYMBOL {
+		return (a.Value).(string), true
+	}
+
+	return "", false
+}
@@ -0,0 +1,85 @@
+package printer_test
+
+import (
+	"github.com/vkhonin/scheme/printer"
+	"testing"
+)
+
+func TestPretty(t *testing.T) {
+	testCases := []struct {
+		Input   string
+		Options printer.Options
+		Output  string
+	}{
+		{
+			"(define (fact n) (if (= n 0) 1 (* n (fact (- n 1)))))",
+			printer.Options{},
+			"(define (fact n) (if (= n 0) 1 (* n (fact (- n 1)))))",
+		},
+		{
+			"(define (fact n) (if (= n 0) 1 (* n (fact (- n 1)))))",
+			printer.Options{Width: 30},
+			"(define (fact n)\n" +
+				"  (if (= n 0)\n" +
+				"      1\n" +
+				"      (* n (fact (- n 1)))))",
+		},
+		{
+			"(let loop ((i 0) (acc '())) (if (< i 10) (loop (+ i 1) (cons i acc)) (reverse acc)))",
+			printer.Options{Width: 30},
+			"(let loop ((i 0)\n" +
+				"           (acc (quote ())))\n" +
+				"  (if (< i 10)\n" +
+				"      (loop (+ i 1)\n" +
+				"            (cons i acc))\n" +
+				"      (reverse acc)))",
+		},
+		{
+			"(lambda (x) (display x) (newline))",
+			printer.Options{Width: 20, Indent: 4},
+			"(lambda (x)\n" +
+				"    (display x)\n" +
+				"    (newline))",
+		},
+		{
+			"(cond ((null? x) 'empty) ((pair? x) 'pair) (else 'other))",
+			printer.Options{Width: 30},
+			"(cond ((null? x)\n" +
+				"       (quote empty))\n" +
+				"      ((pair? x) (quote pair))\n" +
+				"      (else (quote other)))",
+		},
+		{
+			"(string-append-with-long-name \"a\" \"b\")",
+			printer.Options{Width: 30},
+			"(string-append-with-long-name\n" +
+				"  \"a\"\n" +
+				"  \"b\")",
+		},
+		{
+			"#(1 2 3 4 5 6 7 8 9 10 11 12 13 14 15 16 17 18 19 20)",
+			printer.Options{Width: 30},
+			"#(1 2 3 4 5 6 7 8 9 10 11 12\n" +
+				"  13 14 15 16 17 18 19 20)",
+		},
+		{
+			"((alpha beta) (gamma delta) . epsilon)",
+			printer.Options{Width: 20},
+			"((alpha beta)\n" +
+				" (gamma delta) . epsilon)",
+		},
+	}
+
+	for _, c := range testCases {
+		datum := read(t, c.Input)
+
+		output := printer.Pretty(datum, c.Options)
+		if output != c.Output {
+			t.Errorf("expected\n%s\ngot\n%s", c.Output, output)
+		}
+
+		if readBack := read(t, output); !readBack.Equals(datum) {
+			t.Errorf("expected %s to read back as %s", output, c.Input)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package printer
+
+import (
+	"github.com/vkhonin/scheme/parser"
+)
+
+var (
+	// CYCLIC_DATUM is reported by WriteSimple for cyclic data.
+	CYCLIC_DATUM = parser.CYCLIC_DATUM
+)
+
+// Write returns external representation of sexpr as write procedure prints
+// it. It is parser.Write, which String methods of data use too.
+func Write(sexpr parser.Sexpr) string {
+	return parser.Write(sexpr)
+}
+
+// WriteShared returns representation of sexpr as write-shared procedure
+// prints it. It is parser.WriteShared.
+func WriteShared(sexpr parser.Sexpr) string {
+	return parser.WriteShared(sexpr)
+}
+
+// WriteSimple returns representation of sexpr as write-simple procedure
+// prints it, or CYCLIC_DATUM for cyclic data. It is parser.WriteSimple.
+func WriteSimple(sexpr parser.Sexpr) (string, error) {
+	return parser.WriteSimple(sexpr)
+}
+
+// Display returns representation of sexpr as display procedure prints it. It
+// is parser.Display.
+func Display(sexpr parser.Sexpr) string {
+	return parser.Display(sexpr)
+}
+
+// isNull reports whether e is empty list, i.e. parser.Nil or any other pair
+// with nil Car and Cdr.
+func isNull(e *parser.Expr) bool {
+	return e == parser.Nil || (e.Car == nil && e.Cdr == nil)
+}
@@ -0,0 +1,91 @@
+package printer_test
+
+import (
+	"github.com/vkhonin/scheme/lexer"
+	"github.com/vkhonin/scheme/parser"
+	"github.com/vkhonin/scheme/printer"
+	"testing"
+)
+
+type testCase struct {
+	Input   string
+	Write   string
+	Display string
+}
+
+func read(t *testing.T, src string) parser.Sexpr {
+	t.Helper()
+
+	var tokens []lexer.Token
+
+	for token, err := range lexer.NewFromString(src).Tokens() {
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		tokens = append(tokens, token)
+	}
+
+	p := parser.Parser{Tokens: tokens}
+
+	datum, err := p.ParseDatum()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return datum
+}
+
+func TestWrite(t *testing.T) {
+	testCases := []testCase{
+		{"#t", "#t", "#t"},
+		{"#f", "#f", "#f"},
+		{"#xFF", "255", "255"},
+		{"-1/2", "-1/2", "-1/2"},
+		{"1.5e3", "1500.0", "1500.0"},
+		{"1+2i", "1+2i", "1+2i"},
+		{`#\a`, `#\a`, "a"},
+		{`#\space`, `#\space`, " "},
+		{`#\x0`, `#\null`, "\x00"},
+		{`#\λ`, `#\λ`, "λ"},
+		{`"a \"b\"\n"`, `"a \"b\"\n"`, "a \"b\"\n"},
+		{`"\x7;"`, `"\a"`, "\a"},
+		{"abc", "abc", "abc"},
+		{"|a b|", "|a b|", "a b"},
+		{"||", "||", ""},
+		{"()", "()", "()"},
+		{"(a (b \"c\") . #\\d)", `(a (b "c") . #\d)`, "(a (b c) . d)"},
+		{"'a", "(quote a)", "(quote a)"},
+		{"#(1 \"s\" #())", `#(1 "s" #())`, "#(1 s #())"},
+		{"#u8(0 #xff)", "#u8(0 255)", "#u8(0 255)"},
+		{"#u8()", "#u8()", "#u8()"},
+	}
+
+	for _, c := range testCases {
+		datum := read(t, c.Input)
+
+		written := printer.Write(datum)
+		if written != c.Write {
+			t.Errorf("expected %s got %s for %s", c.Write, written, c.Input)
+		}
+
+		if displayed := printer.Display(datum); displayed != c.Display {
+			t.Errorf("expected %q got %q displaying %s", c.Display, displayed, c.Input)
+		}
+
+		if readBack := read(t, written); !readBack.Equals(datum) {
+			t.Errorf("expected %s to read back as %s", written, c.Input)
+		}
+	}
+}
+
+func TestWrite_HandBuilt(t *testing.T) {
+	list := &parser.Expr{
+		Car: &parser.Atom{Type: parser.SYMBOL, Value: "a"},
+		Cdr: &parser.Expr{Car: &parser.Atom{Type: parser.CHAR, Value: '\t'}, Cdr: &parser.Expr{}},
+	}
+
+	if written := printer.Write(list); written != `(a #\tab)` {
+		t.Errorf("expected (a #\\tab) got %s", written)
+	}
+}
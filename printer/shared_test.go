@@ -0,0 +1,80 @@
+package printer_test
+
+import (
+	"errors"
+	"github.com/vkhonin/scheme/lexer"
+	"github.com/vkhonin/scheme/parser"
+	"github.com/vkhonin/scheme/printer"
+	"testing"
+)
+
+func TestWrite_Labels(t *testing.T) {
+	testCases := []struct {
+		Input  string
+		Write  string
+		Shared string
+		Simple string
+	}{
+		{"(a b)", "(a b)", "(a b)", "(a b)"},
+		{"#0=(a . #0#)", "#0=(a . #0#)", "#0=(a . #0#)", ""},
+		{"#0=(a b . #0#)", "#0=(a b . #0#)", "#0=(a b . #0#)", ""},
+		{"(x . #0=(a b . #0#))", "(x . #0=(a b . #0#))", "(x . #0=(a b . #0#))", ""},
+		{"#0=(#0# . #0#)", "#0=(#0# . #0#)", "#0=(#0# . #0#)", ""},
+		{"#0=#(1 #0#)", "#0=#(1 #0#)", "#0=#(1 #0#)", ""},
+		{"(#0=(a) #0# #1=#() #1#)", "((a) (a) #() #())", "(#0=(a) #0# #1=#() #1#)", "((a) (a) #() #())"},
+		{"(#0=(a) . #0#)", "((a) a)", "(#0=(a) . #0#)", "((a) a)"},
+		{"#0=(#1=(b . #1#) #0# #1#)", "#0=(#1=(b . #1#) #0# #1#)", "#0=(#1=(b . #1#) #0# #1#)", ""},
+		{"(() ())", "(() ())", "(() ())", "(() ())"},
+	}
+
+	for _, c := range testCases {
+		datum := read(t, c.Input)
+
+		if written := printer.Write(datum); written != c.Write {
+			t.Errorf("expected %s got %s writing %s", c.Write, written, c.Input)
+		}
+
+		written := printer.WriteShared(datum)
+		if written != c.Shared {
+			t.Errorf("expected %s got %s writing shared %s", c.Shared, written, c.Input)
+		}
+
+		if readBack := read(t, written); printer.WriteShared(readBack) != written {
+			t.Errorf("expected %s to read back", written)
+		}
+
+		simple, err := printer.WriteSimple(datum)
+		if c.Simple == "" && !errors.Is(err, printer.CYCLIC_DATUM) {
+			t.Errorf("expected %v got %v writing simple %s", printer.CYCLIC_DATUM, err, c.Input)
+		} else if simple != c.Simple {
+			t.Errorf("expected %s got %s writing simple %s", c.Simple, simple, c.Input)
+		}
+	}
+
+	if displayed := printer.Display(read(t, `#0=("a" . #0#)`)); displayed != "#0=(a . #0#)" {
+		t.Errorf("expected #0=(a . #0#) got %s", displayed)
+	}
+
+	if pretty := printer.Pretty(read(t, "#0=(alpha beta gamma . #0#)"), printer.Options{Width: 10}); pretty != "#0=(alpha beta gamma . #0#)" {
+		t.Errorf("expected cyclic datum on one line, got %s", pretty)
+	}
+}
+
+func TestWrite_LongList(t *testing.T) {
+	tokens := []lexer.Token{{Type: lexer.LPAREN, Literal: "("}}
+	for range 100000 {
+		tokens = append(tokens, lexer.Token{Type: lexer.IDENT, Literal: "a"})
+	}
+	tokens = append(tokens, lexer.Token{Type: lexer.RPAREN, Literal: ")"})
+
+	p := parser.Parser{Tokens: tokens}
+
+	datum, err := p.ParseDatum()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if written := printer.Write(datum); len(written) != 2*100000+1 {
+		t.Errorf("expected %d characters got %d", 2*100000+1, len(written))
+	}
+}
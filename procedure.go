@@ -0,0 +1,179 @@
+package scheme
+
+import (
+	"context"
+	"fmt"
+	"github.com/vkhonin/scheme/eval"
+	"github.com/vkhonin/scheme/parser"
+	"reflect"
+)
+
+// Procedure is procedure of interpreter Go code calls, e.g. handler written
+// in Scheme, see Func.
+type Procedure struct {
+	interp *Interp
+	name   string
+}
+
+// Func returns procedure name is bound to in environment of interpreter. Name
+// is looked up each time procedure is called, so it calls the latest
+// definition.
+func (i *Interp) Func(name string) *Procedure {
+	return &Procedure{interp: i, name: name}
+}
+
+// Call calls procedure with args converted as by Value and returns its value.
+// Errors are reported as by EvalString, prefixed with name of procedure.
+func (p *Procedure) Call(args ...any) (parser.Sexpr, error) {
+	data := make([]parser.Sexpr, len(args))
+	for i, arg := range args {
+		datum, err := Value(arg)
+		if err != nil {
+			return nil, fmt.Errorf("%s: argument %d: %w", p.name, i+1, err)
+		}
+		data[i] = datum
+	}
+
+	return p.call(nil, data)
+}
+
+// As sets function fn points to, e.g. of type *func(string) (int, error), to
+// function calling procedure, so that it may be handed to Go code as
+// callback:
+//
+//	var handle func(ctx context.Context, req string) (int, error)
+//	err := interp.Func("handler").As(&handle)
+//
+// Function converts its arguments as by Value, and value of procedure to its
+// result as by Decode. If the first parameter is context.Context, procedure
+// is called with it as by EvalContext. Errors are returned as the last result
+// if it is error, and panic otherwise. Function evaluates with interpreter,
+// so it may not be called concurrently with other evaluations.
+//
+// It reports UNSUPPORTED_TYPE if fn is not pointer to function, or function
+// has results other than value Decode converts to, error or both, and
+// eval.UNBOUND_VARIABLE or eval.WRONG_TYPE if name is not bound to procedure.
+func (p *Procedure) As(fn any) error {
+	v := reflect.ValueOf(fn)
+	if v.Kind() != reflect.Pointer || v.IsNil() || v.Elem().Kind() != reflect.Func {
+		return fmt.Errorf("%s: %w: pointer to function expected, got %T", p.name, UNSUPPORTED_TYPE, fn)
+	}
+
+	if _, err := p.lookup(); err != nil {
+		return fmt.Errorf("%s: %w", p.name, err)
+	}
+
+	t := v.Elem().Type()
+	withContext := t.NumIn() > 0 && t.In(0) == contextType
+	withError := t.NumOut() > 0 && t.Out(t.NumOut()-1) == errorType
+
+	values := t.NumOut()
+	if withError {
+		values--
+	}
+	if values > 1 {
+		return fmt.Errorf("%s: %w: function with %d results", p.name, UNSUPPORTED_TYPE, t.NumOut())
+	}
+
+	var decode decoder
+	if values == 1 {
+		d, err := decoderOf(t.Out(0))
+		if err != nil {
+			return fmt.Errorf("%s: result: %w", p.name, err)
+		}
+		decode = d
+	}
+
+	v.Elem().Set(reflect.MakeFunc(t, func(in []reflect.Value) []reflect.Value {
+		out := make([]reflect.Value, t.NumOut())
+		for i := range out {
+			out[i] = reflect.Zero(t.Out(i))
+		}
+
+		fail := func(err error) []reflect.Value {
+			if !withError {
+				panic(err)
+			}
+			out[len(out)-1] = reflect.ValueOf(&err).Elem()
+			return out
+		}
+
+		var ctx context.Context
+		if withContext {
+			ctx, _ = in[0].Interface().(context.Context)
+			in = in[1:]
+		}
+
+		if t.IsVariadic() {
+			rest := in[len(in)-1]
+			in = in[:len(in)-1]
+			for i := range rest.Len() {
+				in = append(in, rest.Index(i))
+			}
+		}
+
+		args := make([]parser.Sexpr, len(in))
+		for i, arg := range in {
+			datum, err := Value(arg.Interface())
+			if err != nil {
+				return fail(fmt.Errorf("%s: argument %d: %w", p.name, i+1, err))
+			}
+			args[i] = datum
+		}
+
+		result, err := p.call(ctx, args)
+		if err != nil {
+			return fail(err)
+		}
+
+		if decode != nil {
+			value, err := decode(result)
+			if err != nil {
+				return fail(fmt.Errorf("%s: result: %w", p.name, err))
+			}
+			out[0] = value
+		}
+
+		return out
+	}))
+
+	return nil
+}
+
+// call applies procedure to args, evaluating with ctx unless it is nil.
+func (p *Procedure) call(ctx context.Context, args []parser.Sexpr) (parser.Sexpr, error) {
+	i := p.interp
+
+	if ctx != nil {
+		defer i.ev.SetContext(i.ev.Context())
+		i.ev.SetContext(ctx)
+	}
+
+	proc, err := p.lookup()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", p.name, err)
+	}
+
+	result, err := i.run(func() (parser.Sexpr, error) {
+		return i.ev.Apply(proc, args)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", p.name, err)
+	}
+
+	return result, nil
+}
+
+// lookup returns procedure name is bound to.
+func (p *Procedure) lookup() (parser.Sexpr, error) {
+	proc, err := p.interp.env.Lookup(p.name)
+	if err != nil {
+		return nil, err
+	}
+
+	if !eval.IsProcedure(proc) {
+		return nil, fmt.Errorf("%w: procedure expected, got %v", eval.WRONG_TYPE, proc)
+	}
+
+	return proc, nil
+}
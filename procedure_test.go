@@ -0,0 +1,170 @@
+package scheme_test
+
+import (
+	"context"
+	"errors"
+	"github.com/vkhonin/scheme"
+	"github.com/vkhonin/scheme/eval"
+	"github.com/vkhonin/scheme/printer"
+	"slices"
+	"sort"
+	"testing"
+	"time"
+)
+
+const handlers = `
+(define (handler req) (if (string? req) (* 2 (string->number req)) (error "bad request" req)))
+(define (scale factor . xs) (map (lambda (x) (* factor x)) xs))
+(define (less a b) (< a b))
+(define (spin) (let loop () (loop)))
+(define answer 42)`
+
+func newProcedureInterp(t *testing.T, options ...scheme.Option) *scheme.Interp {
+	interp := scheme.New(options...)
+	if _, err := interp.EvalString(handlers); err != nil {
+		t.Fatal(err)
+	}
+
+	return interp
+}
+
+func TestProcedure_As(t *testing.T) {
+	for _, options := range [][]scheme.Option{nil, {scheme.WithVM()}} {
+		interp := newProcedureInterp(t, options...)
+
+		var handle func(string) (int, error)
+		if err := interp.Func("handler").As(&handle); err != nil {
+			t.Fatal(err)
+		}
+
+		if n, err := handle("21"); err != nil || n != 42 {
+			t.Errorf("expected 42 got %v, %v", n, err)
+		}
+
+		var scale func(float64, ...int) []float64
+		if err := interp.Func("scale").As(&scale); err != nil {
+			t.Fatal(err)
+		}
+
+		if xs := scale(0.5, 1, 2); !slices.Equal(xs, []float64{0.5, 1}) {
+			t.Errorf("expected [0.5 1] got %v", xs)
+		}
+
+		var less func(a, b int) bool
+		if err := interp.Func("less").As(&less); err != nil {
+			t.Fatal(err)
+		}
+
+		ints := []int{3, 1, 2}
+		sort.Slice(ints, func(i, j int) bool { return less(ints[i], ints[j]) })
+		if !slices.Equal(ints, []int{1, 2, 3}) {
+			t.Errorf("expected ints sorted by procedure got %v", ints)
+		}
+
+		if _, err := interp.EvalString("(define (handler req) 0)"); err != nil {
+			t.Fatal(err)
+		}
+		if n, err := handle("21"); err != nil || n != 0 {
+			t.Errorf("expected redefined procedure called, got %v, %v", n, err)
+		}
+	}
+}
+
+func TestProcedure_As_Errors(t *testing.T) {
+	interp := newProcedureInterp(t)
+
+	var handle func(any) (int, error)
+	if err := interp.Func("handler").As(&handle); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := handle(1); err == nil || err.Error() != `handler: bad request 1` {
+		t.Errorf("expected error of procedure got %v", err)
+	}
+
+	if _, err := handle(make(chan int)); !errors.Is(err, scheme.UNSUPPORTED_TYPE) {
+		t.Errorf("expected error %v got %v", scheme.UNSUPPORTED_TYPE, err)
+	}
+
+	var wrongResult func(string) (string, error)
+	if err := interp.Func("handler").As(&wrongResult); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := wrongResult("1"); !errors.Is(err, eval.WRONG_TYPE) {
+		t.Errorf("expected error %v got %v", eval.WRONG_TYPE, err)
+	}
+
+	var noError func(any) int
+	if err := interp.Func("handler").As(&noError); err != nil {
+		t.Fatal(err)
+	}
+	func() {
+		defer func() {
+			if r := recover(); r == nil {
+				t.Errorf("expected panic for error of function without error result")
+			}
+		}()
+		noError(1)
+	}()
+
+	testCases := []struct {
+		Name string
+		Fn   any
+		Err  error
+	}{
+		{"missing", &handle, eval.UNBOUND_VARIABLE},
+		{"answer", &handle, eval.WRONG_TYPE},
+		{"handler", handle, scheme.UNSUPPORTED_TYPE},
+		{"handler", new(int), scheme.UNSUPPORTED_TYPE},
+		{"handler", (*func())(nil), scheme.UNSUPPORTED_TYPE},
+		{"handler", new(func() (int, int)), scheme.UNSUPPORTED_TYPE},
+		{"handler", new(func() chan int), scheme.UNSUPPORTED_TYPE},
+	}
+
+	for _, c := range testCases {
+		if err := interp.Func(c.Name).As(c.Fn); !errors.Is(err, c.Err) {
+			t.Errorf("expected error %v got %v for %s %T", c.Err, err, c.Name, c.Fn)
+		}
+	}
+}
+
+func TestProcedure_As_Context(t *testing.T) {
+	interp := newProcedureInterp(t)
+
+	var spin func(context.Context) error
+	if err := interp.Func("spin").As(&spin); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if err := spin(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected error %v got %v", context.DeadlineExceeded, err)
+	}
+
+	limited := newProcedureInterp(t, scheme.WithMaxSteps(1000))
+	if err := limited.Func("spin").As(&spin); err != nil {
+		t.Fatal(err)
+	}
+	if err := limited.DefineFunc("go-spin", spin); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := limited.EvalString("(go-spin)"); !errors.Is(err, scheme.ErrResourceLimit) {
+		t.Errorf("expected error %v got %v", scheme.ErrResourceLimit, err)
+	}
+}
+
+func TestProcedure_Call(t *testing.T) {
+	interp := newProcedureInterp(t)
+
+	result, err := interp.Func("scale").Call(2, 1, 2, 3)
+	if err != nil || printer.Write(result) != "(2 4 6)" {
+		t.Errorf("expected (2 4 6) got %v, %v", result, err)
+	}
+
+	if _, err := interp.Func("missing").Call(); !errors.Is(err, eval.UNBOUND_VARIABLE) {
+		t.Errorf("expected error %v got %v", eval.UNBOUND_VARIABLE, err)
+	}
+}
@@ -0,0 +1,86 @@
+// Package query finds data matching patterns, e.g. query
+// (define (?name . ?args) . ?body) finds procedure definitions and binds
+// their names, parameters and bodies.
+package query
+
+import (
+	"errors"
+	"fmt"
+	"github.com/vkhonin/scheme/parser"
+	"github.com/vkhonin/scheme/rewrite"
+	"strings"
+)
+
+var INVALID_QUERY = errors.New("invalid query")
+
+// Query is compiled query. Symbols starting with ? are variables of query,
+// _ matches anything, element followed by ... matches any number of elements,
+// as in syntax-rules pattern, and other data match equal data.
+type Query struct {
+	rule rewrite.Rule
+}
+
+// Match is datum matching query and bindings of variables of query, by their
+// names without ?.
+type Match struct {
+	Datum    parser.Sexpr
+	Bindings rewrite.Bindings
+}
+
+// Compile returns query of source src, which must be single datum. It
+// reports INVALID_QUERY if it isn't or if it is invalid pattern.
+func Compile(src string) (*Query, error) {
+	data, err := parser.ParseString(src)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", INVALID_QUERY, err)
+	}
+	if len(data) != 1 {
+		return nil, fmt.Errorf("%w: expected 1 datum got %d", INVALID_QUERY, len(data))
+	}
+
+	rule := rewrite.Rule{Pattern: data[0], Template: parser.Nil}
+	parser.Walk(data[0], func(s parser.Sexpr) bool {
+		if a, ok := s.(*parser.Atom); ok && a.Type == parser.SYMBOL {
+			if name := (a.Value).(string); !strings.HasPrefix(name, "?") && name != "_" && name != "..." {
+				rule.Literals = append(rule.Literals, name)
+			}
+		}
+		return true
+	})
+
+	if err := rule.Check(); err != nil {
+		return nil, fmt.Errorf("%w: %w", INVALID_QUERY, err)
+	}
+
+	return &Query{rule: rule}, nil
+}
+
+// Select returns matches of q in s and data it contains, in order Walk visits
+// them.
+func (q *Query) Select(s parser.Sexpr) []Match {
+	var matches []Match
+
+	parser.Walk(s, func(d parser.Sexpr) bool {
+		if bindings, ok := q.rule.Match(d); ok {
+			named := make(rewrite.Bindings, len(bindings))
+			for name, binding := range bindings {
+				named[strings.TrimPrefix(name, "?")] = binding
+			}
+			matches = append(matches, Match{Datum: d, Bindings: named})
+		}
+		return true
+	})
+
+	return matches
+}
+
+// Select returns matches of query of source src in s, see Compile and
+// Query.Select.
+func Select(s parser.Sexpr, src string) ([]Match, error) {
+	q, err := Compile(src)
+	if err != nil {
+		return nil, err
+	}
+
+	return q.Select(s), nil
+}
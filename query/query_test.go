@@ -0,0 +1,79 @@
+package query_test
+
+import (
+	"errors"
+	"github.com/vkhonin/scheme/parser"
+	"github.com/vkhonin/scheme/query"
+	"slices"
+	"testing"
+)
+
+const program = `(import (scheme base) (scheme write))
+(define x 1)
+(define (square n) (* n n))
+(define (add . ns)
+  (define (step a b) (+ a b))
+  (fold step 0 ns))
+(display (square x))`
+
+func TestSelect(t *testing.T) {
+	data, err := parser.ParseString("(" + program + ")")
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	testCases := []struct {
+		Query    string
+		Variable string
+		Expected []string
+	}{
+		{"(define (?name . ?args) . ?body)", "name", []string{"square", "add", "step"}},
+		{"(define (?name . ?args) . ?body)", "args", []string{"(n)", "ns", "(a b)"}},
+		{"(define ?name ?value)", "value", []string{"1", "(* n n)", "(+ a b)"}},
+		{"(define ?name . _)", "name", []string{"x", "(square n)", "(add . ns)", "(step a b)"}},
+		{"(import ?set ...)", "set", []string{"((scheme base) (scheme write))"}},
+		{"(* ?x n)", "x", []string{"n"}},
+		{"(display _)", "", []string{"(display (square x))"}},
+		{"(undefined ?x)", "x", nil},
+	}
+
+	for _, c := range testCases {
+		matches, err := query.Select(data[0], c.Query)
+		if err != nil {
+			t.Errorf("unexpected error %v for %s", err, c.Query)
+			continue
+		}
+
+		var actual []string
+		for _, m := range matches {
+			if c.Variable == "" {
+				actual = append(actual, parser.Write(m.Datum))
+				continue
+			}
+
+			binding := m.Bindings[c.Variable]
+			if binding.Items == nil {
+				actual = append(actual, parser.Write(binding.Datum))
+				continue
+			}
+
+			items := make([]parser.Sexpr, len(binding.Items))
+			for i, item := range binding.Items {
+				items[i] = item.Datum
+			}
+			actual = append(actual, parser.Write(parser.List(items...)))
+		}
+
+		if !slices.Equal(actual, c.Expected) {
+			t.Errorf("expected %v got %v for %s", c.Expected, actual, c.Query)
+		}
+	}
+}
+
+func TestCompile(t *testing.T) {
+	for _, src := range []string{"", "a b", "(a", "(?a ?a)", "(... ?a)"} {
+		if _, err := query.Compile(src); !errors.Is(err, query.INVALID_QUERY) {
+			t.Errorf("expected INVALID_QUERY got %v for %q", err, src)
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package rewrite
+
+import (
+	"fmt"
+	"github.com/vkhonin/scheme/parser"
+)
+
+// Expand returns template of r with pattern variables replaced by data of
+// bindings b, as syntax-rules template is expanded: subtemplate followed by
+// ellipses is expanded for each datum sequence variables in it are bound to,
+// and (... template) is expanded as template with ellipses not special in it.
+// It reports INVALID_TEMPLATE if sequences expanded together have different
+// lengths or subtemplate followed by ellipsis has no sequence variables.
+// Data bound are shared with result, not copied.
+func (r Rule) Expand(b Bindings) (parser.Sexpr, error) {
+	return r.expand(r.Template, b, false)
+}
+
+func (r Rule) expand(template parser.Sexpr, b Bindings, escaped bool) (parser.Sexpr, error) {
+	switch t := template.(type) {
+	case *parser.Atom:
+		name, ok := symbolName(t)
+		if !ok {
+			return t, nil
+		}
+		binding, ok := b[name]
+		if !ok {
+			return t, nil
+		}
+		if binding.Items != nil {
+			return nil, fmt.Errorf("%w: %s used with too few ellipses", INVALID_TEMPLATE, name)
+		}
+		return binding.Datum, nil
+	case *parser.Vector:
+		elements, err := r.expandItems(t.Elements, b, escaped)
+		if err != nil {
+			return nil, err
+		}
+		return &parser.Vector{Elements: elements}, nil
+	case *parser.Expr:
+		items, tail := spine(t)
+		if len(items) == 0 {
+			return parser.Nil, nil
+		}
+
+		if !escaped && tail == nil && len(items) == 2 && r.isEllipsis(items[0]) {
+			return r.expand(items[1], b, true)
+		}
+
+		expanded, err := r.expandItems(items, b, escaped)
+		if err != nil {
+			return nil, err
+		}
+
+		result := parser.Sexpr(parser.Nil)
+		if tail != nil {
+			if result, err = r.expand(tail, b, escaped); err != nil {
+				return nil, err
+			}
+		}
+		for i := len(expanded) - 1; i >= 0; i-- {
+			result = parser.Cons(expanded[i], result)
+		}
+		return result, nil
+	default:
+		return template, nil
+	}
+}
+
+// expandItems expands elements of list or vector template.
+func (r Rule) expandItems(items []parser.Sexpr, b Bindings, escaped bool) ([]parser.Sexpr, error) {
+	var expanded []parser.Sexpr
+
+	for i := 0; i < len(items); i++ {
+		ellipses := 0
+		for !escaped && i+ellipses+1 < len(items) && r.isEllipsis(items[i+ellipses+1]) {
+			ellipses++
+		}
+
+		if ellipses == 0 {
+			item, err := r.expand(items[i], b, escaped)
+			if err != nil {
+				return nil, err
+			}
+			expanded = append(expanded, item)
+			continue
+		}
+
+		repeated, err := r.expandRepeated(items[i], b, ellipses)
+		if err != nil {
+			return nil, err
+		}
+		expanded = append(expanded, repeated...)
+		i += ellipses
+	}
+
+	return expanded, nil
+}
+
+// expandRepeated expands subtemplate followed by number of ellipses.
+func (r Rule) expandRepeated(template parser.Sexpr, b Bindings, ellipses int) ([]parser.Sexpr, error) {
+	length := -1
+	var sequences []string
+
+	for name := range r.templateVariables(template, b, nil) {
+		binding := b[name]
+		if binding.Items == nil {
+			continue
+		}
+		if length >= 0 && len(binding.Items) != length {
+			return nil, fmt.Errorf("%w: sequences of different lengths expanded together", INVALID_TEMPLATE)
+		}
+		length = len(binding.Items)
+		sequences = append(sequences, name)
+	}
+
+	if length < 0 {
+		return nil, fmt.Errorf("%w: %s following no sequence variables", INVALID_TEMPLATE, ellipsis)
+	}
+
+	var expanded []parser.Sexpr
+
+	for i := 0; i < length; i++ {
+		inner := make(Bindings, len(b))
+		for name, binding := range b {
+			inner[name] = binding
+		}
+		for _, name := range sequences {
+			inner[name] = b[name].Items[i]
+		}
+
+		if ellipses > 1 {
+			items, err := r.expandRepeated(template, inner, ellipses-1)
+			if err != nil {
+				return nil, err
+			}
+			expanded = append(expanded, items...)
+			continue
+		}
+
+		item, err := r.expand(template, inner, false)
+		if err != nil {
+			return nil, err
+		}
+		expanded = append(expanded, item)
+	}
+
+	return expanded, nil
+}
+
+// templateVariables adds names of symbols of template bound in b to
+// variables.
+func (r Rule) templateVariables(template parser.Sexpr, b Bindings, variables map[string]bool) map[string]bool {
+	if variables == nil {
+		variables = make(map[string]bool)
+	}
+
+	parser.Walk(template, func(s parser.Sexpr) bool {
+		if name, ok := symbolName(s); ok {
+			if _, ok := b[name]; ok {
+				variables[name] = true
+			}
+		}
+		return true
+	})
+
+	return variables
+}
+
+// checkTemplate reports INVALID_TEMPLATE if template, at depth ellipses,
+// has misplaced ellipses or uses variables with fewer ellipses than pattern.
+func (r Rule) checkTemplate(template parser.Sexpr, depth int, variables map[string]int, escaped bool) error {
+	var items []parser.Sexpr
+
+	switch t := template.(type) {
+	case *parser.Atom:
+		name, ok := symbolName(t)
+		if !ok {
+			return nil
+		}
+		if d, ok := variables[name]; ok && d > depth {
+			return fmt.Errorf("%w: %s used with too few ellipses", INVALID_TEMPLATE, name)
+		}
+		if !escaped && r.isEllipsis(t) {
+			return fmt.Errorf("%w: misplaced %s", INVALID_TEMPLATE, ellipsis)
+		}
+		return nil
+	case *parser.Vector:
+		items = t.Elements
+	case *parser.Expr:
+		var tail parser.Sexpr
+		items, tail = spine(t)
+		if !escaped && tail == nil && len(items) == 2 && r.isEllipsis(items[0]) {
+			return r.checkTemplate(items[1], depth, variables, true)
+		}
+		if tail != nil {
+			if err := r.checkTemplate(tail, depth, variables, escaped); err != nil {
+				return err
+			}
+		}
+	default:
+		return nil
+	}
+
+	for i := 0; i < len(items); i++ {
+		ellipses := 0
+		for !escaped && i+ellipses+1 < len(items) && r.isEllipsis(items[i+ellipses+1]) {
+			ellipses++
+		}
+
+		if ellipses > 0 && !r.hasSequence(items[i], depth, variables) {
+			return fmt.Errorf("%w: %s following no sequence variables", INVALID_TEMPLATE, ellipsis)
+		}
+		if err := r.checkTemplate(items[i], depth+ellipses, variables, escaped); err != nil {
+			return err
+		}
+		i += ellipses
+	}
+
+	return nil
+}
+
+// hasSequence reports whether template has variables followed by more than
+// depth ellipses in pattern.
+func (r Rule) hasSequence(template parser.Sexpr, depth int, variables map[string]int) bool {
+	found := false
+
+	parser.Walk(template, func(s parser.Sexpr) bool {
+		if name, ok := symbolName(s); ok && variables[name] > depth {
+			found = true
+		}
+		return !found
+	})
+
+	return found
+}
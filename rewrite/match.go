@@ -0,0 +1,225 @@
+package rewrite
+
+import (
+	"fmt"
+	"github.com/vkhonin/scheme/parser"
+)
+
+// Binding is datum pattern variable matched or, for variable followed by
+// ellipses in pattern, bindings of each datum matched by subpattern it is
+// in. Items of such binding are not nil, even if there are none.
+type Binding struct {
+	Datum parser.Sexpr
+	Items []Binding
+}
+
+// Bindings are bindings of pattern variables by their names.
+type Bindings map[string]Binding
+
+// Match reports whether s matches pattern of r and returns bindings of its
+// pattern variables if it does. Pattern is matched as syntax-rules pattern:
+// _ matches anything, literals match equal symbols, other symbols are pattern
+// variables and element of list or vector followed by ellipsis matches any
+// number of elements. Other atoms match equal atoms.
+func (r Rule) Match(s parser.Sexpr) (Bindings, bool) {
+	m := matcher{rule: r, bindings: make(Bindings)}
+	if !m.match(r.Pattern, s) {
+		return nil, false
+	}
+
+	return m.bindings, true
+}
+
+type matcher struct {
+	rule     Rule
+	bindings Bindings
+}
+
+func (m *matcher) match(pattern, s parser.Sexpr) bool {
+	switch p := pattern.(type) {
+	case *parser.Atom:
+		if p.Type != parser.SYMBOL {
+			return parser.Equal(p, s)
+		}
+
+		name := (p.Value).(string)
+		switch {
+		case name == "_":
+		case m.rule.isLiteral(name):
+			return parser.Eq(p, s)
+		default:
+			m.bindings[name] = Binding{Datum: s}
+		}
+
+		return true
+	case *parser.Vector:
+		v, ok := s.(*parser.Vector)
+		if !ok {
+			return false
+		}
+		return m.matchItems(p.Elements, nil, v.Elements, nil, parser.Nil)
+	case *parser.Expr:
+		pItems, pTail := spine(p)
+		if len(pItems) == 0 {
+			return isNull(s)
+		}
+
+		if _, ok := s.(*parser.Expr); !ok {
+			return false
+		}
+		items, tail := spine(s)
+		if tail == nil {
+			tail = parser.Nil
+		}
+
+		return m.matchItems(pItems, pTail, items, pairs(s), tail)
+	default:
+		return parser.Equal(pattern, s)
+	}
+}
+
+// matchItems matches elements of list or vector with subpatterns. Tail
+// pattern of improper list pattern, unless nil, matches rest of list after
+// elements matched, which is cdrs[i] after i elements or tail after all.
+func (m *matcher) matchItems(pItems []parser.Sexpr, pTail parser.Sexpr, items []parser.Sexpr, cdrs []parser.Sexpr, tail parser.Sexpr) bool {
+	e := m.rule.ellipsisIndex(pItems)
+	if e < 0 {
+		if len(items) < len(pItems) || (pTail == nil && (len(items) > len(pItems) || !isNull(tail))) {
+			return false
+		}
+
+		for i, p := range pItems {
+			if !m.match(p, items[i]) {
+				return false
+			}
+		}
+
+		if pTail == nil {
+			return true
+		}
+		if len(items) > len(pItems) {
+			return m.match(pTail, cdrs[len(pItems)])
+		}
+		return m.match(pTail, tail)
+	}
+
+	before, repeated, after := pItems[:e], pItems[e], pItems[e+2:]
+	if len(items) < len(before)+len(after) {
+		return false
+	}
+	if pTail == nil && !isNull(tail) {
+		return false
+	}
+
+	for i, p := range before {
+		if !m.match(p, items[i]) {
+			return false
+		}
+	}
+
+	variables := m.rule.patternVariables(repeated, 0, nil)
+	sequences := make(map[string][]Binding, len(variables))
+	for name := range variables {
+		sequences[name] = make([]Binding, 0)
+	}
+
+	for _, item := range items[len(before) : len(items)-len(after)] {
+		inner := matcher{rule: m.rule, bindings: make(Bindings)}
+		if !inner.match(repeated, item) {
+			return false
+		}
+		for name := range variables {
+			sequences[name] = append(sequences[name], inner.bindings[name])
+		}
+	}
+	for name, sequence := range sequences {
+		m.bindings[name] = Binding{Items: sequence}
+	}
+
+	for i, p := range after {
+		if !m.match(p, items[len(items)-len(after)+i]) {
+			return false
+		}
+	}
+
+	if pTail != nil {
+		return m.match(pTail, tail)
+	}
+
+	return true
+}
+
+// patternVariables returns pattern variables of valid pattern, mapped to
+// number of ellipses they are followed by, depth being that number for
+// pattern itself.
+func (r Rule) patternVariables(pattern parser.Sexpr, depth int, variables map[string]int) map[string]int {
+	variables, _ = r.checkPattern(pattern, depth, variables)
+
+	return variables
+}
+
+// checkPattern adds pattern variables of pattern to variables as
+// patternVariables does. It reports INVALID_PATTERN for misplaced ellipses and
+// variables occurring more than once.
+func (r Rule) checkPattern(pattern parser.Sexpr, depth int, variables map[string]int) (map[string]int, error) {
+	if variables == nil {
+		variables = make(map[string]int)
+	}
+
+	var items []parser.Sexpr
+
+	switch p := pattern.(type) {
+	case *parser.Atom:
+		name, ok := symbolName(p)
+		if !ok || name == "_" || r.isLiteral(name) {
+			return variables, nil
+		}
+		if name == ellipsis {
+			return variables, fmt.Errorf("%w: misplaced %s", INVALID_PATTERN, ellipsis)
+		}
+		if _, ok := variables[name]; ok {
+			return variables, fmt.Errorf("%w: duplicate pattern variable %s", INVALID_PATTERN, name)
+		}
+		variables[name] = depth
+		return variables, nil
+	case *parser.Vector:
+		items = p.Elements
+	case *parser.Expr:
+		var tail parser.Sexpr
+		if items, tail = spine(p); tail != nil {
+			if _, err := r.checkPattern(tail, depth, variables); err != nil {
+				return variables, err
+			}
+		}
+	default:
+		return variables, nil
+	}
+
+	e := r.ellipsisIndex(items)
+	for i, item := range items {
+		itemDepth := depth
+		switch {
+		case i == e:
+			itemDepth++
+		case e >= 0 && i == e+1:
+			continue
+		}
+		if _, err := r.checkPattern(item, itemDepth, variables); err != nil {
+			return variables, err
+		}
+	}
+
+	return variables, nil
+}
+
+// ellipsisIndex returns index of subpattern followed by first ellipsis in
+// items, or -1 if there is none.
+func (r Rule) ellipsisIndex(items []parser.Sexpr) int {
+	for i := 1; i < len(items); i++ {
+		if r.isEllipsis(items[i]) {
+			return i - 1
+		}
+	}
+
+	return -1
+}
@@ -0,0 +1,196 @@
+// Package rewrite rewrites data with rules made of syntax-rules patterns and
+// templates, e.g. rule with pattern (unless c body ...), literal unless and
+// template (if c #f (begin body ...)).
+package rewrite
+
+import (
+	"errors"
+	"fmt"
+	"github.com/vkhonin/scheme/parser"
+	"slices"
+)
+
+// MaxRewrites is number of rewrites Apply makes before it reports
+// TOO_MANY_REWRITES, which stops rules rewriting data endlessly.
+const MaxRewrites = 100000
+
+const ellipsis = "..."
+
+var (
+	INVALID_PATTERN   = errors.New("invalid pattern")
+	INVALID_TEMPLATE  = errors.New("invalid template")
+	TOO_MANY_REWRITES = errors.New("too many rewrites")
+)
+
+// Rule rewrites data matching Pattern into Template with pattern variables
+// replaced by data they match. Literals are symbols matching only
+// themselves in Pattern.
+type Rule struct {
+	Pattern  parser.Sexpr
+	Template parser.Sexpr
+	Literals []string
+}
+
+// Check reports INVALID_PATTERN or INVALID_TEMPLATE if pattern or template
+// of r has misplaced ellipses, or if pattern variables are followed by fewer
+// ellipses in template than in pattern.
+func (r Rule) Check() error {
+	variables, err := r.checkPattern(r.Pattern, 0, nil)
+	if err != nil {
+		return err
+	}
+
+	return r.checkTemplate(r.Template, 0, variables, false)
+}
+
+// Apply returns s rewritten with rules. Datum is rewritten with first rule
+// matching it, repeatedly, until none does, and then elements of lists and
+// vectors are rewritten the same way, so outer data are rewritten first, as
+// macros are expanded. Rules are checked first, see Rule.Check. Apply
+// doesn't modify s, which must not be cyclic.
+func Apply(rules []Rule, s parser.Sexpr) (parser.Sexpr, error) {
+	for _, r := range rules {
+		if err := r.Check(); err != nil {
+			return nil, err
+		}
+	}
+
+	a := applier{rules: rules}
+
+	return a.rewrite(s)
+}
+
+type applier struct {
+	rules    []Rule
+	rewrites int
+}
+
+func (a *applier) rewrite(s parser.Sexpr) (parser.Sexpr, error) {
+	for matched := true; matched; {
+		matched = false
+
+		for _, r := range a.rules {
+			bindings, ok := r.Match(s)
+			if !ok {
+				continue
+			}
+
+			if a.rewrites++; a.rewrites > MaxRewrites {
+				return nil, fmt.Errorf("%w: more than %d", TOO_MANY_REWRITES, MaxRewrites)
+			}
+
+			expanded, err := r.Expand(bindings)
+			if err != nil {
+				return nil, err
+			}
+
+			s, matched = expanded, true
+			break
+		}
+	}
+
+	switch d := s.(type) {
+	case *parser.Vector:
+		elements := make([]parser.Sexpr, len(d.Elements))
+		for i, element := range d.Elements {
+			rewritten, err := a.rewrite(element)
+			if err != nil {
+				return nil, err
+			}
+			elements[i] = rewritten
+		}
+		return &parser.Vector{Elements: elements, Span: d.Span, Trivia: d.Trivia}, nil
+	case *parser.Expr:
+		if isNull(d) {
+			return s, nil
+		}
+
+		items, tail := spine(d)
+		for i, item := range items {
+			rewritten, err := a.rewrite(item)
+			if err != nil {
+				return nil, err
+			}
+			items[i] = rewritten
+		}
+
+		if tail == nil {
+			tail = parser.Nil
+		} else if rewritten, err := a.rewrite(tail); err != nil {
+			return nil, err
+		} else {
+			tail = rewritten
+		}
+
+		return rebuild(d, items, tail), nil
+	default:
+		return s, nil
+	}
+}
+
+// rebuild returns copy of list of items ending with tail, spans and trivia
+// of pairs of which are copied from those of list.
+func rebuild(list *parser.Expr, items []parser.Sexpr, tail parser.Sexpr) *parser.Expr {
+	var originals []*parser.Expr
+	for pair := list; len(originals) < len(items); pair, _ = pair.Cdr.(*parser.Expr) {
+		originals = append(originals, pair)
+	}
+
+	for i := len(items) - 1; i >= 0; i-- {
+		tail = &parser.Expr{Car: items[i], Cdr: tail, Span: originals[i].Span, Trivia: originals[i].Trivia}
+	}
+
+	return tail.(*parser.Expr)
+}
+
+// spine returns elements of list s and its tail, which is nil for proper
+// list.
+func spine(s parser.Sexpr) ([]parser.Sexpr, parser.Sexpr) {
+	var items []parser.Sexpr
+
+	for {
+		pair, ok := s.(*parser.Expr)
+		if !ok {
+			return items, s
+		}
+		if isNull(pair) {
+			return items, nil
+		}
+
+		items = append(items, pair.Car)
+		s = pair.Cdr
+	}
+}
+
+// pairs returns pairs of spine of list s.
+func pairs(s parser.Sexpr) []parser.Sexpr {
+	var pairs []parser.Sexpr
+
+	for pair, ok := s.(*parser.Expr); ok && !isNull(pair); pair, ok = pair.Cdr.(*parser.Expr) {
+		pairs = append(pairs, pair)
+	}
+
+	return pairs
+}
+
+func isNull(s parser.Sexpr) bool {
+	e, ok := s.(*parser.Expr)
+	return s == nil || (ok && e.Car == nil && e.Cdr == nil)
+}
+
+func symbolName(s parser.Sexpr) (string, bool) {
+	if a, ok := s.(*parser.Atom); ok && a.Type == parser.SYMBOL {
+		return (a.Value).(string), true
+	}
+
+	return "", false
+}
+
+func (r Rule) isLiteral(name string) bool {
+	return slices.Contains(r.Literals, name)
+}
+
+func (r Rule) isEllipsis(s parser.Sexpr) bool {
+	name, ok := symbolName(s)
+	return ok && name == ellipsis && !r.isLiteral(name)
+}
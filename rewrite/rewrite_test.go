@@ -0,0 +1,156 @@
+package rewrite_test
+
+import (
+	"errors"
+	"github.com/vkhonin/scheme/parser"
+	"github.com/vkhonin/scheme/rewrite"
+	"testing"
+)
+
+func read(t *testing.T, src string) parser.Sexpr {
+	t.Helper()
+
+	data, err := parser.ParseString(src)
+	if err != nil || len(data) != 1 {
+		t.Fatalf("unexpected error %v reading %s", err, src)
+	}
+
+	return data[0]
+}
+
+func rule(t *testing.T, pattern, template string, literals ...string) rewrite.Rule {
+	return rewrite.Rule{Pattern: read(t, pattern), Template: read(t, template), Literals: literals}
+}
+
+func TestRule_Match(t *testing.T) {
+	testCases := []struct {
+		Pattern  string
+		Input    string
+		Matches  bool
+		Variable string
+		Expected string
+	}{
+		{"(_ a b)", "(f 1 2)", true, "b", "2"},
+		{"(_ a b)", "(f 1)", false, "", ""},
+		{"(_ a b)", "(f 1 2 3)", false, "", ""},
+		{"(_ a . b)", "(f 1 2 3)", true, "b", "(2 3)"},
+		{"(_ a . b)", "(f 1)", true, "b", "()"},
+		{"(_ a ... z)", "(f 1 2 3)", true, "z", "3"},
+		{"(_ a ... z)", "(f)", false, "", ""},
+		{"(_ (a b) ...)", "(f (1 2) (3))", false, "", ""},
+		{"(_ a ... . r)", "(f 1 2 . 3)", true, "r", "3"},
+		{"(_ 1 \"s\" #\\c)", "(f 1 \"s\" #\\c)", true, "", ""},
+		{"(_ 1)", "(f 2)", false, "", ""},
+		{"#(a b ...)", "#(1 2 3)", true, "a", "1"},
+		{"#(a b ...)", "(1 2 3)", false, "", ""},
+		{"(else x)", "(else 1)", true, "x", "1"},
+		{"(else x)", "(other 1)", false, "", ""},
+		{"()", "()", true, "", ""},
+		{"()", "(1)", false, "", ""},
+	}
+
+	for _, c := range testCases {
+		r := rule(t, c.Pattern, "()", "else")
+
+		bindings, ok := r.Match(read(t, c.Input))
+		if ok != c.Matches {
+			t.Errorf("expected match %v got %v for %s and %s", c.Matches, ok, c.Pattern, c.Input)
+			continue
+		}
+		if c.Variable == "" {
+			continue
+		}
+
+		if actual := parser.Write(bindings[c.Variable].Datum); actual != c.Expected {
+			t.Errorf("expected %s bound to %s got %s for %s and %s", c.Variable, c.Expected, actual, c.Pattern, c.Input)
+		}
+	}
+
+	bindings, ok := rule(t, "(_ (a b ...) ...)", "()").Match(read(t, "(f (1 2 3) (4) (5 6))"))
+	if !ok {
+		t.Fatal("expected (f (1 2 3) (4) (5 6)) to match")
+	}
+
+	b := bindings["b"]
+	if len(b.Items) != 3 || len(b.Items[1].Items) != 0 || b.Items[1].Items == nil || parser.Write(b.Items[2].Items[0].Datum) != "6" {
+		t.Errorf("unexpected bindings of b %v", b)
+	}
+}
+
+func TestApply(t *testing.T) {
+	rules := []rewrite.Rule{
+		rule(t, "(unless c body ...)", "(if c #f (begin body ...))", "unless"),
+		rule(t, "(let ((name value) ...) body ...)", "((lambda (name ...) body ...) value ...)", "let"),
+		rule(t, "(cond (else e ...))", "(begin e ...)", "cond", "else"),
+		rule(t, "(cond (c e ...) clause ...)", "(if c (begin e ...) (cond clause ...))", "cond"),
+		rule(t, "(flat (a ...) ...)", "(list a ... ...)", "flat"),
+		rule(t, "(swap #(a b))", "#(b a)", "swap"),
+		rule(t, "(dots x ...)", "((x (... ...)) ...)", "dots"),
+		rule(t, "(quoted x)", "(... (x ...))", "quoted"),
+		rule(t, "(tail a . b)", "(b . a)", "tail"),
+	}
+
+	testCases := []struct {
+		Input    string
+		Expected string
+	}{
+		{"(unless (> x 0) (display x) (newline))", "(if (> x 0) #f (begin (display x) (newline)))"},
+		{"(let ((a 1) (b 2)) (+ a b))", "((lambda (a b) (+ a b)) 1 2)"},
+		{"(let () 1)", "((lambda () 1))"},
+		{"(cond (a 1) (b 2) (else 3))", "(if a (begin 1) (if b (begin 2) (begin 3)))"},
+		{"(f (unless a (unless b c)))", "(f (if a #f (begin (if b #f (begin c)))))"},
+		{"#((unless a b))", "#((if a #f (begin b)))"},
+		{"(flat (1 2) () (3))", "(list 1 2 3)"},
+		{"(swap #(1 2))", "#(2 1)"},
+		{"(dots 1 2)", "((1 ...) (2 ...))"},
+		{"(quoted 1)", "(1 ...)"},
+		{"(tail 1 2 3)", "((2 3) . 1)"},
+		{"(other (unless a) . #((unless b)))", "(other (if a #f (begin)) . #((if b #f (begin))))"},
+		{"unless", "unless"},
+	}
+
+	for _, c := range testCases {
+		input := read(t, c.Input)
+		written := parser.Write(input)
+
+		actual, err := rewrite.Apply(rules, input)
+		if err != nil {
+			t.Errorf("unexpected error %v for %s", err, c.Input)
+			continue
+		}
+
+		if parser.Write(actual) != c.Expected {
+			t.Errorf("expected %s got %s for %s", c.Expected, parser.Write(actual), c.Input)
+		}
+		if parser.Write(input) != written {
+			t.Errorf("expected %s unchanged got %s", written, parser.Write(input))
+		}
+	}
+}
+
+func TestApply_Errors(t *testing.T) {
+	testCases := []struct {
+		Pattern  string
+		Template string
+		Input    string
+		Expected error
+	}{
+		{"(... a)", "a", "(f)", rewrite.INVALID_PATTERN},
+		{"(_ a ... b ...)", "a", "(f)", rewrite.INVALID_PATTERN},
+		{"(_ a a)", "a", "(f)", rewrite.INVALID_PATTERN},
+		{"(_ a ...)", "a", "(f)", rewrite.INVALID_TEMPLATE},
+		{"(_ a ...)", "((a ...) ...)", "(f)", rewrite.INVALID_TEMPLATE},
+		{"(_ a)", "(a ...)", "(f)", rewrite.INVALID_TEMPLATE},
+		{"(_ a)", "(b ...)", "(f 1)", rewrite.INVALID_TEMPLATE},
+		{"(_ (a ...) (b ...))", "((a b) ...)", "(f (1 2) (3))", rewrite.INVALID_TEMPLATE},
+		{"(loop x)", "(loop (x))", "(loop 1)", rewrite.TOO_MANY_REWRITES},
+	}
+
+	for _, c := range testCases {
+		r := rule(t, c.Pattern, c.Template, "loop")
+
+		if _, err := rewrite.Apply([]rewrite.Rule{r}, read(t, c.Input)); !errors.Is(err, c.Expected) {
+			t.Errorf("expected %v got %v for %s and %s", c.Expected, err, c.Pattern, c.Template)
+		}
+	}
+}
@@ -0,0 +1,226 @@
+// Package scheme embeds interpreter in Go programs:
+//
+//	interp := scheme.New()
+//	interp.Define("limit", 10)
+//	interp.DefineFunc("greet", func(name string) string { return "hello " + name })
+//	value, err := interp.EvalString(`(list (* limit 2) (greet "world"))`)
+//
+// Interp keeps its environment and macros between calls, so definitions of
+// one program may be used by programs evaluated after it. Values are data of
+// parser package, which printer package writes as Scheme does.
+package scheme
+
+import (
+	"context"
+	"fmt"
+	"github.com/vkhonin/scheme/eval"
+	"github.com/vkhonin/scheme/lexer"
+	"github.com/vkhonin/scheme/parser"
+	"github.com/vkhonin/scheme/vm"
+	"io"
+	"os"
+	"strings"
+)
+
+// ErrResourceLimit is wrapped by errors of programs exceeding limits set with
+// WithMaxSteps, WithMaxCells or WithMaxDepth. It is eval.RESOURCE_LIMIT.
+var ErrResourceLimit = eval.RESOURCE_LIMIT
+
+// Interp is interpreter with its own environment, evaluating programs one at
+// a time.
+type Interp struct {
+	ev      *eval.Evaluator
+	env     *eval.Environment
+	backend eval.Backend
+
+	// running is set while interpreter evaluates program or procedure, see
+	// run.
+	running bool
+}
+
+// Option configures Interp New returns.
+type Option func(*Interp)
+
+// WithVM makes interpreter compile programs to bytecode and run them on
+// virtual machine, which is faster for long-running programs.
+func WithVM() Option {
+	return func(i *Interp) {
+		i.backend = vm.New(i.ev)
+	}
+}
+
+// WithCommandLine makes command-line procedure return args, e.g. script and
+// its arguments.
+func WithCommandLine(args ...string) Option {
+	return func(i *Interp) {
+		i.ev.CommandLine = args
+	}
+}
+
+// WithMaxSteps limits each program to n steps of evaluation, e.g. procedure
+// calls and iterations of loops, stopping infinite loops of untrusted
+// scripts.
+func WithMaxSteps(n int64) Option {
+	return func(i *Interp) {
+		i.ev.Limits.MaxSteps = n
+	}
+}
+
+// WithMaxCells limits each program to n cells allocated, i.e. pairs and
+// elements of vectors its procedures make, and machine words of digits of
+// big numbers arithmetic computes beyond the first.
+func WithMaxCells(n int64) Option {
+	return func(i *Interp) {
+		i.ev.Limits.MaxCells = n
+	}
+}
+
+// WithMaxDepth limits depth of recursion of programs to n nested calls, or
+// nested expressions unless WithVM is given. Limit of SafeEnvironment is
+// DefaultMaxDepth unless it is given.
+func WithMaxDepth(n int) Option {
+	return func(i *Interp) {
+		i.ev.Limits.MaxDepth = n
+	}
+}
+
+// WithEnvironment makes interpreter evaluate programs in env, e.g.
+// SafeEnvironment for untrusted scripts, rather than StandardEnvironment.
+func WithEnvironment(env *eval.Environment) Option {
+	return func(i *Interp) {
+		i.env = env
+	}
+}
+
+// New returns interpreter with environment of StandardEnvironment, evaluating
+// programs as they are unless options configure it otherwise.
+func New(options ...Option) *Interp {
+	ev := &eval.Evaluator{}
+	i := &Interp{ev: ev, env: StandardEnvironment(), backend: ev}
+
+	for _, option := range options {
+		option(i)
+	}
+
+	if i.ev.Limits.MaxDepth == 0 && isSafe(i.env) {
+		i.ev.Limits.MaxDepth = DefaultMaxDepth
+	}
+
+	return i
+}
+
+// EvalString evaluates program source and returns value of its last
+// expression. Errors are reported with position of expression they are
+// signalled in, and wrap errors of eval package, e.g. eval.UNBOUND_VARIABLE,
+// or *eval.Exit if program calls exit. Programs exceeding limits stop with
+// error wrapping *eval.Interrupted and ErrResourceLimit, which scripts can't
+// catch.
+func (i *Interp) EvalString(source string) (parser.Sexpr, error) {
+	return i.eval(strings.NewReader(source), "")
+}
+
+// EvalContext evaluates program source as EvalString does, stopping once ctx
+// is done, e.g. cancelled or past its deadline. Error it then returns wraps
+// *eval.Interrupted and error of ctx, which scripts can't catch.
+func (i *Interp) EvalContext(ctx context.Context, source string) (parser.Sexpr, error) {
+	defer i.ev.SetContext(i.ev.Context())
+	i.ev.SetContext(ctx)
+
+	return i.EvalString(source)
+}
+
+// EvalFile evaluates program of file at path as EvalString does, reporting
+// errors with path.
+func (i *Interp) EvalFile(path string) (parser.Sexpr, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return i.eval(f, path)
+}
+
+// Define binds name to value in environment of interpreter, replacing its
+// binding if any. Value is converted as by Value.
+func (i *Interp) Define(name string, value any) error {
+	datum, err := Value(value)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+
+	i.env.Define(name, datum)
+
+	return nil
+}
+
+// eval evaluates program read from r, naming it in errors unless name is
+// empty.
+func (i *Interp) eval(r io.Reader, name string) (parser.Sexpr, error) {
+	var tokens []lexer.Token
+	for token, err := range lexer.New(r).Tokens() {
+		if err != nil {
+			return nil, prefix(name, err)
+		}
+		tokens = append(tokens, token)
+	}
+
+	p := parser.Parser{Tokens: tokens, WithPositions: true}
+	program, err := p.Parse()
+	if err != nil {
+		return nil, prefix(name, err)
+	}
+
+	return i.run(func() (parser.Sexpr, error) {
+		result := eval.Unspecified
+
+		for _, datum := range program {
+			if result, err = i.backend.RunProgram([]parser.Sexpr{datum}, i.env); err != nil {
+				if name == "" {
+					return nil, fmt.Errorf("%s: %w", start(datum), err)
+				}
+				return nil, fmt.Errorf("%s:%s: %w", name, start(datum), err)
+			}
+		}
+
+		return result, nil
+	})
+}
+
+// run returns result of evaluation fn, counting resources it uses for limits
+// from zero unless it is nested in another one, e.g. of Go function calling
+// procedure, see Procedure.As.
+func (i *Interp) run(fn func() (parser.Sexpr, error)) (parser.Sexpr, error) {
+	if !i.running {
+		i.running = true
+		defer func() { i.running = false }()
+		i.ev.ResetUsage()
+	}
+
+	return fn()
+}
+
+// prefix returns err prefixed with name unless it is empty.
+func prefix(name string, err error) error {
+	if name == "" {
+		return err
+	}
+
+	return fmt.Errorf("%s: %w", name, err)
+}
+
+// start returns position of datum read with its position.
+func start(datum parser.Sexpr) lexer.Pos {
+	switch d := datum.(type) {
+	case *parser.Atom:
+		return d.Span.Start
+	case *parser.Expr:
+		return d.Span.Start
+	case *parser.Vector:
+		return d.Span.Start
+	case *parser.Bytevector:
+		return d.Span.Start
+	}
+
+	return lexer.Pos{}
+}
@@ -0,0 +1,190 @@
+package scheme_test
+
+import (
+	"errors"
+	"github.com/vkhonin/scheme"
+	"github.com/vkhonin/scheme/eval"
+	"github.com/vkhonin/scheme/parser"
+	"github.com/vkhonin/scheme/printer"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestInterp_EvalString(t *testing.T) {
+	testCases := []struct {
+		Input  string
+		Output string
+	}{
+		{"(+ 1 2)", "3"},
+		{"(define (square x) (* x x)) (square 7)", "49"},
+		{"(define-syntax twice (syntax-rules () ((_ e) (begin e e)))) (define n 0) (twice (set! n (+ n 1))) n", "2"},
+		{"(define x 1)", ""},
+		{"", ""},
+	}
+
+	for _, options := range [][]scheme.Option{nil, {scheme.WithVM()}} {
+		for _, c := range testCases {
+			result, err := scheme.New(options...).EvalString(c.Input)
+			if err != nil {
+				t.Errorf("unexpected error %v for %s", err, c.Input)
+				continue
+			}
+
+			if c.Output == "" {
+				if result != eval.Unspecified {
+					t.Errorf("expected unspecified value got %v for %s", printer.Write(result), c.Input)
+				}
+				continue
+			}
+
+			if printer.Write(result) != c.Output {
+				t.Errorf("expected %s got %s for %s", c.Output, printer.Write(result), c.Input)
+			}
+		}
+	}
+}
+
+func TestInterp_EvalString_Redefined(t *testing.T) {
+	testCases := []struct {
+		Input  string
+		Output string
+	}{
+		{"(define (f) (list (+ 1 2))) (define + -) (f)", "(-1)"},
+		{"(define (g) (if (< 1 2) 'yes 'no)) (define < >) (g)", "no"},
+		{"(define (h) (not #f)) (set! not (lambda (x) x)) (h)", "#f"},
+	}
+
+	for _, c := range testCases {
+		evaluated, err := scheme.New().EvalString(c.Input)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		compiled, err := scheme.New(scheme.WithVM()).EvalString(c.Input)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if printer.Write(evaluated) != c.Output || printer.Write(compiled) != c.Output {
+			t.Errorf("expected %s got %s evaluated and %s compiled for %s", c.Output, printer.Write(evaluated), printer.Write(compiled), c.Input)
+		}
+	}
+}
+
+func TestInterp_EvalString_Errors(t *testing.T) {
+	testCases := []struct {
+		Input   string
+		Err     error
+		Message string
+	}{
+		{"(define x 1)\n  (car x)", eval.WRONG_TYPE, "2:3: wrong type argument"},
+		{"undefined-variable", eval.UNBOUND_VARIABLE, "1:1: unbound variable"},
+		{"(car", nil, "unexpected EOF"},
+	}
+
+	for _, options := range [][]scheme.Option{nil, {scheme.WithVM()}} {
+		for _, c := range testCases {
+			_, err := scheme.New(options...).EvalString(c.Input)
+			if err == nil || (c.Err != nil && !errors.Is(err, c.Err)) || !strings.HasPrefix(err.Error(), c.Message) {
+				t.Errorf("expected error %q got %v for %s", c.Message, err, c.Input)
+			}
+		}
+	}
+}
+
+func TestInterp_EvalString_Exit(t *testing.T) {
+	_, err := scheme.New().EvalString("(exit 3)")
+
+	var exit *eval.Exit
+	if !errors.As(err, &exit) || exit.Code != 3 {
+		t.Errorf("expected exit with status 3 got %v", err)
+	}
+}
+
+func TestInterp_State(t *testing.T) {
+	interp := scheme.New(scheme.WithCommandLine("script", "arg"))
+
+	if err := interp.Define("limit", 10); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := interp.EvalString("(define (scale x) (* x limit))"); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := interp.EvalString("(list (scale 2) (command-line))")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if printer.Write(result) != `(20 ("script" "arg"))` {
+		t.Errorf("expected definitions kept between programs, got %v", printer.Write(result))
+	}
+
+	if err := interp.Define("bad", make(chan int)); !errors.Is(err, scheme.UNSUPPORTED_TYPE) {
+		t.Errorf("expected error %v got %v", scheme.UNSUPPORTED_TYPE, err)
+	}
+}
+
+func TestInterp_EvalFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lib.scm")
+	if err := os.WriteFile(path, []byte("(define (inc x) (+ x 1))\n(inc 1)\n(car 1)\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	interp := scheme.New()
+
+	_, err := interp.EvalFile(path)
+	if expected := path + ":3:1: wrong type argument"; err == nil || !strings.HasPrefix(err.Error(), expected) {
+		t.Errorf("expected error %q got %v", expected, err)
+	}
+
+	result, err := interp.EvalString("(inc 41)")
+	if err != nil || printer.Write(result) != "42" {
+		t.Errorf("expected 42 got %v, %v", result, err)
+	}
+
+	if _, err := interp.EvalFile(filepath.Join(t.TempDir(), "missing.scm")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected error %v got %v", os.ErrNotExist, err)
+	}
+}
+
+func TestValue(t *testing.T) {
+	testCases := []struct {
+		Value  any
+		Output string
+	}{
+		{nil, "()"},
+		{true, "#t"},
+		{-42, "-42"},
+		{uint64(1 << 63), "9223372036854775808"},
+		{1.5, "1.5"},
+		{"a\"b", `"a\"b"`},
+		{big.NewRat(1, 3), "1/3"},
+		{[]byte{1, 2}, "#u8(1 2)"},
+		{[]any{1, "a", []int{2}}, `(1 "a" (2))`},
+		{[2]bool{}, "(#f #f)"},
+		{parser.Symbol("sym"), "sym"},
+		{map[string]int{"b": 2, "a": 1}, `(("a" . 1) ("b" . 2))`},
+		{(*int)(nil), "()"},
+		{struct{ A int }{1}, "#<go *struct { A int }>"},
+	}
+
+	for _, c := range testCases {
+		result, err := scheme.Value(c.Value)
+		if err != nil {
+			t.Errorf("unexpected error %v for %#v", err, c.Value)
+			continue
+		}
+
+		if printer.Write(result) != c.Output {
+			t.Errorf("expected %s got %s for %#v", c.Output, printer.Write(result), c.Value)
+		}
+	}
+
+	if _, err := scheme.Value([]any{1, make(chan int)}); !errors.Is(err, scheme.UNSUPPORTED_TYPE) {
+		t.Errorf("expected error %v got %v", scheme.UNSUPPORTED_TYPE, err)
+	}
+}
@@ -0,0 +1,223 @@
+package sexpr
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/vkhonin/scheme/parser"
+	"github.com/vkhonin/scheme/parser/number"
+	"io"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+var (
+	NOT_JSON = errors.New("datum has no JSON representation")
+)
+
+// ToJSON returns JSON representation of s:
+//
+//   - booleans are booleans and empty list is null
+//   - exact integers and real numbers are numbers
+//   - strings, symbols and characters are strings
+//   - association lists, keys of which are symbols or strings, are objects
+//   - vectors, bytevectors and other proper lists are arrays
+//
+// It reports NOT_JSON for anything else, e.g. improper or cyclic lists and
+// infinite numbers.
+func ToJSON(s parser.Sexpr) ([]byte, error) {
+	if parser.IsCyclic(s) {
+		return nil, fmt.Errorf("%w: cyclic datum", NOT_JSON)
+	}
+
+	var buf bytes.Buffer
+
+	if err := writeJSON(&buf, s); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func writeJSON(buf *bytes.Buffer, s parser.Sexpr) error {
+	switch d := s.(type) {
+	case *parser.Atom:
+		return writeJSONAtom(buf, d)
+	case *parser.Vector:
+		return writeJSONArray(buf, d.Elements)
+	case *parser.Bytevector:
+		items := make([]parser.Sexpr, len(d.Bytes))
+		for i, b := range d.Bytes {
+			items[i] = parser.Int(int64(b))
+		}
+		return writeJSONArray(buf, items)
+	}
+
+	if isNull(s) {
+		buf.WriteString("null")
+		return nil
+	}
+
+	if entries, err := alist(s); err == nil {
+		buf.WriteByte('{')
+		for i, entry := range entries {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			writeJSONString(buf, entryKey(entry))
+			buf.WriteByte(':')
+			if err := writeJSON(buf, entry.Cdr); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+		return nil
+	}
+
+	items, err := parser.ToSlice(s)
+	if err != nil {
+		return fmt.Errorf("%w: %v", NOT_JSON, s)
+	}
+
+	return writeJSONArray(buf, items)
+}
+
+func writeJSONAtom(buf *bytes.Buffer, atom *parser.Atom) error {
+	switch atom.Type {
+	case parser.BOOL:
+		buf.WriteString(strconv.FormatBool((atom.Value).(bool)))
+	case parser.NUMBER:
+		n := (atom.Value).(*number.Number)
+		if i := n.Integer(); i != nil {
+			buf.WriteString(i.String())
+			return nil
+		}
+		if !n.IsReal() {
+			return fmt.Errorf("%w: %v", NOT_JSON, atom)
+		}
+		text, err := json.Marshal(n.Float())
+		if err != nil {
+			return fmt.Errorf("%w: %v", NOT_JSON, atom)
+		}
+		buf.Write(text)
+	case parser.CHAR:
+		writeJSONString(buf, string((atom.Value).(rune)))
+	default:
+		writeJSONString(buf, (atom.Value).(string))
+	}
+
+	return nil
+}
+
+func writeJSONArray(buf *bytes.Buffer, items []parser.Sexpr) error {
+	buf.WriteByte('[')
+	for i, item := range items {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		if err := writeJSON(buf, item); err != nil {
+			return err
+		}
+	}
+	buf.WriteByte(']')
+
+	return nil
+}
+
+func writeJSONString(buf *bytes.Buffer, s string) {
+	// Marshalling string never fails.
+	text, _ := json.Marshal(s)
+	buf.Write(text)
+}
+
+// FromJSON returns datum of JSON text data, mapped back as ToJSON maps data:
+// objects are association lists with symbol keys in order of data, arrays
+// are vectors, null is empty list and strings are strings. Numbers without
+// fraction or exponent are exact integers, others are inexact reals.
+func FromJSON(data []byte) (parser.Sexpr, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	s, err := readJSON(dec)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, errors.New("invalid character after top-level value")
+	}
+
+	return s, nil
+}
+
+func readJSON(dec *json.Decoder) (parser.Sexpr, error) {
+	token, err := dec.Token()
+	if err == io.EOF {
+		return nil, io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch t := token.(type) {
+	case nil:
+		return parser.Nil, nil
+	case bool:
+		return parser.Bool(t), nil
+	case string:
+		return parser.Str(t), nil
+	case json.Number:
+		return jsonNumber(t)
+	}
+
+	if token == json.Delim('[') {
+		var items []parser.Sexpr
+		for dec.More() {
+			item, err := readJSON(dec)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		// Closing delimiter is checked by decoder.
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+		return &parser.Vector{Elements: items}, nil
+	}
+
+	var entries []parser.Sexpr
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		value, err := readJSON(dec)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, parser.Cons(parser.Symbol(key.(string)), value))
+	}
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+
+	return parser.List(entries...), nil
+}
+
+func jsonNumber(n json.Number) (parser.Sexpr, error) {
+	if !strings.ContainsAny(string(n), ".eE") {
+		if i, ok := new(big.Int).SetString(string(n), 10); ok {
+			return parser.Num(number.NewFromInt(i)), nil
+		}
+	}
+
+	f, err := n.Float64()
+	if err != nil {
+		return nil, err
+	}
+
+	return parser.Float(f), nil
+}
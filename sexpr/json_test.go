@@ -0,0 +1,81 @@
+package sexpr_test
+
+import (
+	"errors"
+	"github.com/vkhonin/scheme/parser"
+	"github.com/vkhonin/scheme/sexpr"
+	"testing"
+)
+
+func TestToJSON(t *testing.T) {
+	testCases := []struct {
+		Input    string
+		Expected string
+	}{
+		{"#t", "true"},
+		{"()", "null"},
+		{"-12345678901234567890", "-12345678901234567890"},
+		{"1/4", "0.25"},
+		{"1.5e3", "1500"},
+		{`"a\n"`, `"a\n"`},
+		{"sym", `"sym"`},
+		{`#\λ`, `"λ"`},
+		{"#(1 #(2) ())", "[1,[2],null]"},
+		{"#()", "[]"},
+		{"#u8(0 255)", "[0,255]"},
+		{"(1 \"2\")", `[1,"2"]`},
+		{`((name . "x") ("port" . 80) (hosts "a" "b") (tls (on . #t)))`, `{"name":"x","port":80,"hosts":["a","b"],"tls":{"on":true}}`},
+	}
+
+	for _, c := range testCases {
+		data, err := sexpr.ToJSON(read(t, c.Input))
+		if err != nil {
+			t.Errorf("unexpected error %v for %s", err, c.Input)
+			continue
+		}
+
+		if string(data) != c.Expected {
+			t.Errorf("expected %s got %s for %s", c.Expected, data, c.Input)
+		}
+	}
+
+	for _, input := range []string{"(1 . 2)", "#0=(1 . #0#)", "+inf.0", "1+2i"} {
+		if _, err := sexpr.ToJSON(read(t, input)); !errors.Is(err, sexpr.NOT_JSON) {
+			t.Errorf("expected NOT_JSON got %v for %s", err, input)
+		}
+	}
+}
+
+func TestFromJSON(t *testing.T) {
+	testCases := []struct {
+		Input    string
+		Expected string
+	}{
+		{"false", "#f"},
+		{"null", "()"},
+		{"12345678901234567890", "12345678901234567890"},
+		{"-2.5e-1", "-0.25"},
+		{"1e2", "100.0"},
+		{`"aé"`, `"aé"`},
+		{`[1, [], {}]`, "#(1 #() ())"},
+		{`{"b": 1, "a": {"c": [true]}}`, "((b . 1) (a (c . #(#t))))"},
+	}
+
+	for _, c := range testCases {
+		s, err := sexpr.FromJSON([]byte(c.Input))
+		if err != nil {
+			t.Errorf("unexpected error %v for %s", err, c.Input)
+			continue
+		}
+
+		if written := parser.Write(s); written != c.Expected {
+			t.Errorf("expected %s got %s for %s", c.Expected, written, c.Input)
+		}
+	}
+
+	for _, input := range []string{"", "[1,", `{"a"}`, "1 2", "[1]]", "nul"} {
+		if s, err := sexpr.FromJSON([]byte(input)); err == nil {
+			t.Errorf("expected error got %v for %q", s, input)
+		}
+	}
+}
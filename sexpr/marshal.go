@@ -0,0 +1,467 @@
+// Package sexpr converts Scheme data to and from Go values and JSON.
+//
+// Marshal converts booleans, strings, integers and floats to booleans, strings,
+// exact integers and inexact reals. Slices and arrays are lists, except that
+// byte slices are bytevectors. Maps with string keys and structs are
+// association lists with symbol keys, e.g. ((name . "x") (ports 80 443)).
+// Names of struct fields are converted to kebab case, e.g. MaxSize is
+// max-size, unless they are given by sexpr tag:
+//
+//	Port int    `sexpr:"listen-port"`
+//	Tmp  int    `sexpr:"-"`         // Field is skipped
+//	Note string `sexpr:",omitempty"` // Field is skipped if it is zero
+//
+// Nil pointers, slices and maps are empty lists. Values of parser.Sexpr type
+// are kept as they are.
+package sexpr
+
+import (
+	"errors"
+	"fmt"
+	"github.com/vkhonin/scheme/parser"
+	"github.com/vkhonin/scheme/parser/number"
+	"math/big"
+	"reflect"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+var (
+	INVALID_TARGET   = errors.New("non-nil pointer expected")
+	TYPE_MISMATCH    = errors.New("type mismatch")
+	UNSUPPORTED_TYPE = errors.New("unsupported type")
+)
+
+var (
+	sexprType       = reflect.TypeFor[parser.Sexpr]()
+	marshalerType   = reflect.TypeFor[Marshaler]()
+	unmarshalerType = reflect.TypeFor[Unmarshaler]()
+)
+
+// Marshaler is implemented by types converting themselves to data.
+type Marshaler interface {
+	MarshalSexpr() (parser.Sexpr, error)
+}
+
+// Unmarshaler is implemented by types converting data to themselves.
+type Unmarshaler interface {
+	UnmarshalSexpr(s parser.Sexpr) error
+}
+
+// Marshal returns datum representing v.
+func Marshal(v any) (parser.Sexpr, error) {
+	return marshal(reflect.ValueOf(v))
+}
+
+func marshal(v reflect.Value) (parser.Sexpr, error) {
+	if !v.IsValid() {
+		return parser.Nil, nil
+	}
+
+	if v.Type().Implements(marshalerType) {
+		if v.Kind() == reflect.Pointer && v.IsNil() {
+			return parser.Nil, nil
+		}
+		return v.Interface().(Marshaler).MarshalSexpr()
+	}
+
+	if v.Type().Implements(sexprType) && !v.IsNil() {
+		return v.Interface().(parser.Sexpr), nil
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		return parser.Bool(v.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return parser.Int(v.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return parser.Num(number.NewFromInt(new(big.Int).SetUint64(v.Uint()))), nil
+	case reflect.Float32, reflect.Float64:
+		return parser.Float(v.Float()), nil
+	case reflect.String:
+		return parser.Str(v.String()), nil
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return parser.Nil, nil
+		}
+		return marshal(v.Elem())
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return &parser.Bytevector{Bytes: slices.Clone(v.Bytes())}, nil
+		}
+		fallthrough
+	case reflect.Array:
+		items := make([]parser.Sexpr, v.Len())
+		for i := range items {
+			item, err := marshal(v.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			items[i] = item
+		}
+		return parser.List(items...), nil
+	case reflect.Map:
+		return marshalMap(v)
+	case reflect.Struct:
+		return marshalStruct(v)
+	default:
+		return nil, fmt.Errorf("%w %s", UNSUPPORTED_TYPE, v.Type())
+	}
+}
+
+// marshalMap returns association list of map with string keys, sorted by key.
+func marshalMap(v reflect.Value) (parser.Sexpr, error) {
+	if v.Type().Key().Kind() != reflect.String {
+		return nil, fmt.Errorf("%w %s", UNSUPPORTED_TYPE, v.Type())
+	}
+
+	keys := v.MapKeys()
+	slices.SortFunc(keys, func(a, b reflect.Value) int {
+		return strings.Compare(a.String(), b.String())
+	})
+
+	entries := make([]parser.Sexpr, len(keys))
+	for i, key := range keys {
+		value, err := marshal(v.MapIndex(key))
+		if err != nil {
+			return nil, err
+		}
+		entries[i] = parser.Cons(parser.Symbol(key.String()), value)
+	}
+
+	return parser.List(entries...), nil
+}
+
+func marshalStruct(v reflect.Value) (parser.Sexpr, error) {
+	var entries []parser.Sexpr
+
+	for _, f := range structFields(v.Type()) {
+		field := v.FieldByIndex(f.index)
+		if f.omitEmpty && field.IsZero() {
+			continue
+		}
+
+		value, err := marshal(field)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, parser.Cons(parser.Symbol(f.name), value))
+	}
+
+	return parser.List(entries...), nil
+}
+
+// Unmarshal stores value of datum s in value v points to. Association list
+// entries without matching struct fields are ignored. Numbers are stored in
+// integer values only if they are exact integers in range.
+func Unmarshal(s parser.Sexpr, v any) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return INVALID_TARGET
+	}
+
+	return unmarshal(s, rv.Elem())
+}
+
+func unmarshal(s parser.Sexpr, v reflect.Value) error {
+	if v.CanAddr() && v.Addr().Type().Implements(unmarshalerType) {
+		return v.Addr().Interface().(Unmarshaler).UnmarshalSexpr(s)
+	}
+
+	if v.Type() == sexprType || (v.Type().Implements(sexprType) && reflect.TypeOf(s) == v.Type()) {
+		v.Set(reflect.ValueOf(s))
+		return nil
+	}
+
+	atom, _ := s.(*parser.Atom)
+
+	switch v.Kind() {
+	case reflect.Bool:
+		if atom == nil || atom.Type != parser.BOOL {
+			return mismatch(s, v)
+		}
+		v.SetBool((atom.Value).(bool))
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i := integer(atom)
+		if i == nil || !i.IsInt64() || v.OverflowInt(i.Int64()) {
+			return mismatch(s, v)
+		}
+		v.SetInt(i.Int64())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		i := integer(atom)
+		if i == nil || !i.IsUint64() || v.OverflowUint(i.Uint64()) {
+			return mismatch(s, v)
+		}
+		v.SetUint(i.Uint64())
+	case reflect.Float32, reflect.Float64:
+		if atom == nil || atom.Type != parser.NUMBER || !(atom.Value).(*number.Number).IsReal() {
+			return mismatch(s, v)
+		}
+		v.SetFloat((atom.Value).(*number.Number).Float())
+	case reflect.String:
+		if atom == nil || (atom.Type != parser.STRING && atom.Type != parser.SYMBOL) {
+			return mismatch(s, v)
+		}
+		v.SetString((atom.Value).(string))
+	case reflect.Pointer:
+		if isNull(s) {
+			v.SetZero()
+			return nil
+		}
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return unmarshal(s, v.Elem())
+	case reflect.Interface:
+		if v.NumMethod() != 0 {
+			return mismatch(s, v)
+		}
+		value, err := toAny(s)
+		if err != nil {
+			return err
+		}
+		if value == nil {
+			v.SetZero()
+		} else {
+			v.Set(reflect.ValueOf(value))
+		}
+	case reflect.Slice:
+		return unmarshalSlice(s, v)
+	case reflect.Array:
+		items, err := sequence(s)
+		if err != nil || len(items) != v.Len() {
+			return mismatch(s, v)
+		}
+		for i, item := range items {
+			if err := unmarshal(item, v.Index(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		return unmarshalMap(s, v)
+	case reflect.Struct:
+		return unmarshalStruct(s, v)
+	default:
+		return fmt.Errorf("%w %s", UNSUPPORTED_TYPE, v.Type())
+	}
+
+	return nil
+}
+
+func unmarshalSlice(s parser.Sexpr, v reflect.Value) error {
+	if b, ok := s.(*parser.Bytevector); ok && v.Type().Elem().Kind() == reflect.Uint8 {
+		v.SetBytes(slices.Clone(b.Bytes))
+		return nil
+	}
+
+	items, err := sequence(s)
+	if err != nil {
+		return mismatch(s, v)
+	}
+
+	slice := reflect.MakeSlice(v.Type(), len(items), len(items))
+	for i, item := range items {
+		if err := unmarshal(item, slice.Index(i)); err != nil {
+			return err
+		}
+	}
+	v.Set(slice)
+
+	return nil
+}
+
+func unmarshalMap(s parser.Sexpr, v reflect.Value) error {
+	if v.Type().Key().Kind() != reflect.String {
+		return fmt.Errorf("%w %s", UNSUPPORTED_TYPE, v.Type())
+	}
+
+	entries, err := alist(s)
+	if err != nil {
+		return mismatch(s, v)
+	}
+
+	if v.IsNil() {
+		v.Set(reflect.MakeMapWithSize(v.Type(), len(entries)))
+	}
+
+	for _, entry := range entries {
+		value := reflect.New(v.Type().Elem()).Elem()
+		if err := unmarshal(entry.Cdr, value); err != nil {
+			return err
+		}
+		v.SetMapIndex(reflect.ValueOf(entryKey(entry)).Convert(v.Type().Key()), value)
+	}
+
+	return nil
+}
+
+func unmarshalStruct(s parser.Sexpr, v reflect.Value) error {
+	entries, err := alist(s)
+	if err != nil {
+		return mismatch(s, v)
+	}
+
+	fields := structFields(v.Type())
+
+	for _, entry := range entries {
+		i := slices.IndexFunc(fields, func(f field) bool {
+			return f.name == entryKey(entry)
+		})
+		if i < 0 {
+			continue
+		}
+
+		if err := unmarshal(entry.Cdr, v.FieldByIndex(fields[i].index)); err != nil {
+			return fmt.Errorf("%w in field %s", err, fields[i].name)
+		}
+	}
+
+	return nil
+}
+
+// toAny returns natural Go value of s: bool, string for strings and symbols,
+// int64 for exact integers which fit it, float64 for other real numbers,
+// []byte for bytevectors and []any for lists and vectors. Empty list is nil.
+func toAny(s parser.Sexpr) (any, error) {
+	switch d := s.(type) {
+	case *parser.Atom:
+		switch d.Type {
+		case parser.NUMBER:
+			n := (d.Value).(*number.Number)
+			if i := n.Integer(); i != nil && i.IsInt64() {
+				return i.Int64(), nil
+			}
+			if n.IsReal() {
+				return n.Float(), nil
+			}
+			return n.Value(), nil
+		case parser.CHAR:
+			return string((d.Value).(rune)), nil
+		default:
+			return d.Value, nil
+		}
+	case *parser.Bytevector:
+		return slices.Clone(d.Bytes), nil
+	}
+
+	if isNull(s) {
+		return nil, nil
+	}
+
+	items, err := sequence(s)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v cannot be stored in any", TYPE_MISMATCH, s)
+	}
+
+	values := make([]any, len(items))
+	for i, item := range items {
+		if values[i], err = toAny(item); err != nil {
+			return nil, err
+		}
+	}
+
+	return values, nil
+}
+
+// field is struct field converted to association list entry.
+type field struct {
+	name      string
+	index     []int
+	omitEmpty bool
+}
+
+func structFields(t reflect.Type) []field {
+	var fields []field
+
+	for _, f := range reflect.VisibleFields(t) {
+		if !f.IsExported() || f.Anonymous {
+			continue
+		}
+
+		tag := f.Tag.Get("sexpr")
+		if tag == "-" {
+			continue
+		}
+
+		name, options, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = kebabCase(f.Name)
+		}
+
+		fields = append(fields, field{name: name, index: f.Index, omitEmpty: options == "omitempty"})
+	}
+
+	return fields
+}
+
+// kebabCase returns Go name in kebab case, e.g. max-size for MaxSize and
+// http-port for HTTPPort.
+func kebabCase(name string) string {
+	var sb strings.Builder
+
+	runes := []rune(name)
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) &&
+			(!unicode.IsUpper(runes[i-1]) || (i+1 < len(runes) && unicode.IsLower(runes[i+1]))) {
+			sb.WriteByte('-')
+		}
+		sb.WriteRune(unicode.ToLower(r))
+	}
+
+	return sb.String()
+}
+
+// sequence returns elements of proper list or vector s.
+func sequence(s parser.Sexpr) ([]parser.Sexpr, error) {
+	if vector, ok := s.(*parser.Vector); ok {
+		return vector.Elements, nil
+	}
+
+	return parser.ToSlice(s)
+}
+
+// alist returns entries of association list s, keys of which must be symbols
+// or strings.
+func alist(s parser.Sexpr) ([]*parser.Expr, error) {
+	items, err := parser.ToSlice(s)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]*parser.Expr, len(items))
+	for i, item := range items {
+		entry, ok := item.(*parser.Expr)
+		if !ok || isNull(entry) {
+			return nil, TYPE_MISMATCH
+		}
+		if key, ok := entry.Car.(*parser.Atom); !ok || (key.Type != parser.SYMBOL && key.Type != parser.STRING) {
+			return nil, TYPE_MISMATCH
+		}
+		entries[i] = entry
+	}
+
+	return entries, nil
+}
+
+func entryKey(entry *parser.Expr) string {
+	return (entry.Car.(*parser.Atom).Value).(string)
+}
+
+// integer returns value of atom if it is exact integer, or nil.
+func integer(atom *parser.Atom) *big.Int {
+	if atom == nil || atom.Type != parser.NUMBER {
+		return nil
+	}
+
+	return (atom.Value).(*number.Number).Integer()
+}
+
+func isNull(s parser.Sexpr) bool {
+	e, ok := s.(*parser.Expr)
+	return ok && e.Car == nil && e.Cdr == nil
+}
+
+func mismatch(s parser.Sexpr, v reflect.Value) error {
+	return fmt.Errorf("%w: %v cannot be stored in %s", TYPE_MISMATCH, s, v.Type())
+}
@@ -0,0 +1,176 @@
+package sexpr_test
+
+import (
+	"errors"
+	"github.com/vkhonin/scheme/parser"
+	"github.com/vkhonin/scheme/sexpr"
+	"reflect"
+	"testing"
+)
+
+type server struct {
+	Name     string
+	HTTPPort uint16
+	Hosts    []string
+	Weight   float64 `sexpr:"w"`
+	Tmp      int     `sexpr:"-"`
+	Note     string  `sexpr:",omitempty"`
+	Backup   *server
+}
+
+type level int
+
+func (l level) MarshalSexpr() (parser.Sexpr, error) {
+	return parser.Symbol([]string{"low", "high"}[l]), nil
+}
+
+func (l *level) UnmarshalSexpr(s parser.Sexpr) error {
+	if s.Equals(parser.Symbol("high")) {
+		*l = 1
+	} else {
+		*l = 0
+	}
+
+	return nil
+}
+
+func read(t *testing.T, src string) parser.Sexpr {
+	t.Helper()
+
+	program, err := parser.ParseString(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return program[0]
+}
+
+func TestMarshal(t *testing.T) {
+	testCases := []struct {
+		Value    any
+		Expected string
+	}{
+		{true, "#t"},
+		{-12, "-12"},
+		{uint64(1 << 63), "9223372036854775808"},
+		{1.5, "1.5"},
+		{"a\"b", `"a\"b"`},
+		{nil, "()"},
+		{[]int{1, 2}, "(1 2)"},
+		{[2]bool{true, false}, "(#t #f)"},
+		{[]byte{0, 255}, "#u8(0 255)"},
+		{map[string]int{"b": 2, "a": 1}, "((a . 1) (b . 2))"},
+		{[]any{"a", 1, parser.Symbol("s")}, `("a" 1 s)`},
+		{[]level{0, 1}, "(low high)"},
+		{
+			server{Name: "x", HTTPPort: 80, Hosts: []string{"h"}, Weight: 0.5, Tmp: 1},
+			`((name . "x") (http-port . 80) (hosts "h") (w . 0.5) (backup))`,
+		},
+		{
+			&server{Note: "n", Backup: &server{}},
+			`((name . "") (http-port . 0) (hosts) (w . 0.0) (note . "n") ` +
+				`(backup (name . "") (http-port . 0) (hosts) (w . 0.0) (backup)))`,
+		},
+	}
+
+	for _, c := range testCases {
+		datum, err := sexpr.Marshal(c.Value)
+		if err != nil {
+			t.Errorf("unexpected error %v marshalling %v", err, c.Value)
+			continue
+		}
+
+		if written := parser.Write(datum); written != c.Expected {
+			t.Errorf("expected %s got %s marshalling %v", c.Expected, written, c.Value)
+		}
+	}
+
+	if _, err := sexpr.Marshal(map[int]int{}); !errors.Is(err, sexpr.UNSUPPORTED_TYPE) {
+		t.Errorf("expected UNSUPPORTED_TYPE got %v", err)
+	}
+	if _, err := sexpr.Marshal(func() {}); !errors.Is(err, sexpr.UNSUPPORTED_TYPE) {
+		t.Errorf("expected UNSUPPORTED_TYPE got %v", err)
+	}
+}
+
+func TestUnmarshal(t *testing.T) {
+	var s server
+	src := `((name . "x") (http-port . 8080) (hosts a "b") (w . 1) (unknown . 1) (backup (name . y)))`
+
+	if err := sexpr.Unmarshal(read(t, src), &s); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := server{
+		Name:     "x",
+		HTTPPort: 8080,
+		Hosts:    []string{"a", "b"},
+		Weight:   1,
+		Backup:   &server{Name: "y"},
+	}
+	if !reflect.DeepEqual(s, expected) {
+		t.Errorf("expected %+v got %+v", expected, s)
+	}
+
+	testCases := []struct {
+		Input    string
+		Target   any
+		Expected any
+	}{
+		{"#f", new(bool), false},
+		{"-7", new(int8), int8(-7)},
+		{"1/2", new(float32), float32(0.5)},
+		{"sym", new(string), "sym"},
+		{"#(1 2)", new([]int), []int{1, 2}},
+		{"(1 2)", new([2]int), [2]int{1, 2}},
+		{"#u8(1 2)", new([]byte), []byte{1, 2}},
+		{`((a . 1) ("b" . 2))`, new(map[string]int), map[string]int{"a": 1, "b": 2}},
+		{`(1 2.5 "s" #\c (x) #(#t) #u8(3) ())`, new(any), []any{int64(1), 2.5, "s", "c", []any{"x"}, []any{true}, []byte{3}, nil}},
+		{"(low high)", new([]level), []level{0, 1}},
+		{"(a . b)", new(parser.Sexpr), parser.Cons(parser.Symbol("a"), parser.Symbol("b"))},
+	}
+
+	for _, c := range testCases {
+		if err := sexpr.Unmarshal(read(t, c.Input), c.Target); err != nil {
+			t.Errorf("unexpected error %v unmarshalling %s", err, c.Input)
+			continue
+		}
+
+		if got := reflect.ValueOf(c.Target).Elem().Interface(); !reflect.DeepEqual(got, c.Expected) {
+			if s, ok := got.(parser.Sexpr); !ok || !s.Equals(c.Expected.(parser.Sexpr)) {
+				t.Errorf("expected %v got %v unmarshalling %s", c.Expected, got, c.Input)
+			}
+		}
+	}
+}
+
+func TestUnmarshal_Errors(t *testing.T) {
+	testCases := []struct {
+		Input  string
+		Target any
+	}{
+		{"1", new(string)},
+		{"1.5", new(int)},
+		{"256", new(uint8)},
+		{"-1", new(uint)},
+		{"1+i", new(float64)},
+		{`"t"`, new(bool)},
+		{"(1 . 2)", new([]int)},
+		{"(1 2 3)", new([2]int)},
+		{"(1)", new(map[string]int)},
+		{"((1 . 2))", new(server)},
+		{`((name . 1))`, new(server)},
+		{"(a . b)", new(any)},
+	}
+
+	for _, c := range testCases {
+		if err := sexpr.Unmarshal(read(t, c.Input), c.Target); !errors.Is(err, sexpr.TYPE_MISMATCH) {
+			t.Errorf("expected TYPE_MISMATCH got %v unmarshalling %s into %T", err, c.Input, c.Target)
+		}
+	}
+
+	var i int
+	if err := sexpr.Unmarshal(parser.Int(1), i); !errors.Is(err, sexpr.INVALID_TARGET) {
+		t.Errorf("expected INVALID_TARGET got %v", err)
+	}
+}
@@ -0,0 +1,71 @@
+package scheme_test
+
+import (
+	"fmt"
+	"github.com/vkhonin/scheme"
+	"github.com/vkhonin/scheme/printer"
+	"strings"
+	"testing"
+)
+
+func TestInterp_Tasks(t *testing.T) {
+	var definitions strings.Builder
+	for i := range 100 {
+		fmt.Fprintf(&definitions, "(define v%d %d)\n", i, i)
+	}
+
+	for _, options := range [][]scheme.Option{nil, {scheme.WithVM()}} {
+		interp := scheme.New(options...)
+
+		_, err := interp.EvalString(`
+			(define results (make-channel 4))
+			(define (count n) (if (= n 0) 0 (+ 1 (count (- n 1)))))
+			(define (worker) (channel-send! results (count 2000)))
+			(for-each (lambda (i) (spawn worker)) '(1 2 3 4))`)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := interp.EvalString(definitions.String()); err != nil {
+			t.Fatal(err)
+		}
+
+		result, err := interp.EvalString("(map (lambda (i) (channel-receive results)) '(1 2 3 4))")
+		if err != nil || printer.Write(result) != "(2000 2000 2000 2000)" {
+			t.Errorf("expected values of tasks got %v, %v", result, err)
+		}
+	}
+}
+
+// TestInterp_Tasks_SharedVariable is meant for race detector, see go test
+// -race: tasks assign global variable and local one of closure they share
+// while reading both.
+func TestInterp_Tasks_SharedVariable(t *testing.T) {
+	for _, options := range [][]scheme.Option{nil, {scheme.WithVM()}} {
+		interp := scheme.New(options...)
+
+		result, err := interp.EvalString(`
+			(define shared 0)
+			(define (run local)
+			  (define (worker id)
+			    (lambda ()
+			      (let loop ((i 0))
+			        (if (< i 500)
+			            (begin (set! shared id) (set! local id) (loop (+ i 1)))
+			            (list shared local)))))
+			  (let ((a (spawn (worker 1))) (b (spawn (worker 2))))
+			    (list (channel-receive a) (channel-receive b) local)))
+			(run 0)`)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		values := printer.Write(result)
+		for _, s := range []string{"(", ")", " "} {
+			values = strings.ReplaceAll(values, s, "")
+		}
+		if len(values) != 5 || strings.Trim(values, "12") != "" {
+			t.Errorf("expected values assigned by tasks got %s", printer.Write(result))
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package scheme
+
+import (
+	"errors"
+	"fmt"
+	"github.com/vkhonin/scheme/parser"
+	"github.com/vkhonin/scheme/parser/number"
+	"math/big"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+var (
+	UNSUPPORTED_TYPE = errors.New("unsupported type")
+)
+
+// Value returns Scheme datum of Go value v:
+//
+//   - data of parser package are returned as they are
+//   - nil is empty list
+//   - booleans, integers, floats and strings are booleans, exact integers,
+//     inexact reals and strings
+//   - *big.Int is exact integer and *big.Rat is exact rational
+//   - []byte is bytevector
+//   - other slices and arrays are lists of their converted elements
+//   - maps are association lists of their converted keys and values, sorted
+//     by keys as they are written
+//   - nil pointers are empty list, and other pointers, structs and values
+//     with methods are objects, see Object
+//
+// It reports UNSUPPORTED_TYPE for values of other types, e.g. channels.
+func Value(v any) (parser.Sexpr, error) {
+	switch v := v.(type) {
+	case nil:
+		return parser.Nil, nil
+	case parser.Sexpr:
+		return v, nil
+	case *big.Int:
+		return parser.Num(number.NewFromInt(v)), nil
+	case *big.Rat:
+		return parser.Num(number.NewFromRat(v)), nil
+	case []byte:
+		return &parser.Bytevector{Bytes: v}, nil
+	}
+
+	rv := reflect.ValueOf(v)
+
+	switch rv.Kind() {
+	case reflect.Bool:
+		return parser.Bool(rv.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return parser.Int(rv.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return parser.Num(number.NewFromInt(new(big.Int).SetUint64(rv.Uint()))), nil
+	case reflect.Float32, reflect.Float64:
+		return parser.Float(rv.Float()), nil
+	case reflect.String:
+		return parser.Str(rv.String()), nil
+	case reflect.Slice, reflect.Array:
+		items := make([]parser.Sexpr, rv.Len())
+		for i := range items {
+			item, err := Value(rv.Index(i).Interface())
+			if err != nil {
+				return nil, err
+			}
+			items[i] = item
+		}
+		return parser.List(items...), nil
+	case reflect.Map:
+		return alist(rv)
+	case reflect.Pointer:
+		if rv.IsNil() {
+			return parser.Nil, nil
+		}
+		return &Object{value: rv}, nil
+	case reflect.Struct:
+		p := reflect.New(rv.Type())
+		p.Elem().Set(rv)
+		return &Object{value: p}, nil
+	}
+
+	if rv.NumMethod() > 0 {
+		return &Object{value: rv}, nil
+	}
+
+	return nil, fmt.Errorf("%w: %T", UNSUPPORTED_TYPE, v)
+}
+
+// alist returns association list of map m.
+func alist(m reflect.Value) (parser.Sexpr, error) {
+	entries := make([]parser.Sexpr, 0, m.Len())
+
+	for iter := m.MapRange(); iter.Next(); {
+		key, err := Value(iter.Key().Interface())
+		if err != nil {
+			return nil, err
+		}
+		value, err := Value(iter.Value().Interface())
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, parser.Cons(key, value))
+	}
+
+	slices.SortFunc(entries, func(a, b parser.Sexpr) int {
+		return strings.Compare(parser.Write(a.(*parser.Expr).Car), parser.Write(b.(*parser.Expr).Car))
+	})
+
+	return parser.List(entries...), nil
+}
@@ -0,0 +1,444 @@
+// Package vm runs programs compiled by compile package on stack machine,
+// which is faster than evaluator on loops and recursion. Machine shares
+// values, environments and builtin procedures with evaluator, so closures of
+// either may be called by the other, e.g. by map.
+package vm
+
+import (
+	"fmt"
+	"github.com/vkhonin/scheme/compile"
+	"github.com/vkhonin/scheme/eval"
+	"github.com/vkhonin/scheme/parser"
+	"slices"
+)
+
+// Machine runs compiled code with evaluator, which holds dynamic state, e.g.
+// exception handlers, calls procedures other than closures of machine and
+// expands macros.
+type Machine struct {
+	Options compile.Options // Options programs are compiled with, except environment
+
+	ev *eval.Evaluator
+}
+
+// Closure is procedure created by lambda expression compiled to Code. It
+// holds values of free variables of code, or boxes of those shared with
+// frames and other closures, and environment of global variables.
+type Closure struct {
+	Name string
+	Code *compile.Code
+	Free []parser.Sexpr
+	Env  *eval.Environment
+}
+
+// frame is state of procedure call: code run, index of next instruction,
+// index of slots of local variables in stack, where value of procedure is
+// pushed when it returns, free variables and environment of global variables.
+type frame struct {
+	code *compile.Code
+	pc   int
+	base int
+	free []parser.Sexpr
+	env  *eval.Environment
+}
+
+// box holds value of boxed variable, which tasks of spawn sharing closure
+// may read and assign concurrently as global variables.
+type box struct {
+	eval.Binding
+}
+
+func newBox(value parser.Sexpr) *box {
+	b := &box{}
+	b.Set(value)
+	return b
+}
+
+func (b *box) Equals(s parser.Sexpr) bool {
+	return b == s
+}
+
+func (*box) String() string {
+	return "#<box>"
+}
+
+// unassigned is value of letrec and internal define variables until their
+// initializers are evaluated.
+var unassigned parser.Sexpr = &unassignedValue{}
+
+// unassignedValue is not empty, so that unassigned is not equal to pointers
+// to other zero-size values, e.g. eval.Unspecified.
+type unassignedValue struct{ _ byte }
+
+func (u *unassignedValue) Equals(s parser.Sexpr) bool {
+	return u == s
+}
+
+func (*unassignedValue) String() string {
+	return "#<unassigned>"
+}
+
+// New returns machine running code with ev.
+func New(ev *eval.Evaluator) *Machine {
+	return &Machine{ev: ev}
+}
+
+// RunProgram compiles program data in order and runs them in env, returning
+// value of the last one, as ev.RunProgram does. Macros are expanded by
+// evaluator of m before each datum is compiled.
+func (m *Machine) RunProgram(program []parser.Sexpr, env *eval.Environment) (parser.Sexpr, error) {
+	m.ev.InitInteraction(env)
+
+	result := eval.Unspecified
+
+	for _, datum := range program {
+		expanded, err := m.ev.Expander().Expand([]parser.Sexpr{datum})
+		if err != nil {
+			return nil, err
+		}
+
+		opts := m.Options
+		opts.Env = env
+
+		code, err := compile.Program(expanded, opts)
+		if err != nil {
+			return nil, err
+		}
+
+		if result, err = m.Run(code, env); err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+// Run runs program code in env and returns its value.
+func (m *Machine) Run(code *compile.Code, env *eval.Environment) (parser.Sexpr, error) {
+	return m.execute(frame{code: code, env: env}, make([]parser.Sexpr, len(code.Locals)))
+}
+
+func (c *Closure) Equals(s parser.Sexpr) bool {
+	c2, ok := s.(*Closure)
+	return ok && c == c2
+}
+
+func (c *Closure) String() string {
+	if c.Name == "" {
+		return "#<procedure>"
+	}
+
+	return "#<procedure " + c.Name + ">"
+}
+
+// Apply calls closure with args on new machine with ev, which makes closures
+// callable by evaluator and builtin procedures.
+func (c *Closure) Apply(ev *eval.Evaluator, args []parser.Sexpr) (parser.Sexpr, error) {
+	defer ev.Leave(1)
+	if err := ev.Enter(); err != nil {
+		return nil, err
+	}
+
+	stack, err := c.enter(ev, slices.Clone(args), 0, len(args))
+	if err != nil {
+		return nil, err
+	}
+
+	return New(ev).execute(c.frame(0), stack)
+}
+
+// enter moves argc arguments on top of stack to slots of parameters of
+// closure starting at base, and returns stack with slots of other local
+// variables added. List of rest arguments is allocated by ev.
+func (c *Closure) enter(ev *eval.Evaluator, stack []parser.Sexpr, base, argc int) ([]parser.Sexpr, error) {
+	code := c.Code
+	n := len(code.Params)
+	if argc < n || (code.Rest == "" && argc > n) {
+		return nil, fmt.Errorf("%w: %v called with %d", eval.WRONG_ARITY, c, argc)
+	}
+
+	args := stack[len(stack)-argc:]
+	if code.Rest != "" {
+		if err := ev.Allocate(argc - n); err != nil {
+			return nil, err
+		}
+		rest := parser.List(args[n:]...)
+		copy(stack[base:], args[:n])
+		stack = append(stack[:base+n], rest)
+		n++
+	} else {
+		copy(stack[base:], args)
+		stack = stack[:base+n]
+	}
+
+	for i := range n {
+		if code.Locals[i].Boxed {
+			stack[base+i] = newBox(stack[base+i])
+		}
+	}
+
+	for range len(code.Locals) - n {
+		stack = append(stack, nil)
+	}
+
+	return stack, nil
+}
+
+// frame returns frame of call of closure with local variables at base.
+func (c *Closure) frame(base int) frame {
+	return frame{code: c.Code, base: base, free: c.Free, env: c.Env}
+}
+
+// execute runs code of frame f with stack holding its local variables until
+// it returns. Calls of closures push frames rather than recurse, so depth of
+// recursion of program is limited only by memory and limits of evaluator.
+func (m *Machine) execute(f frame, stack []parser.Sexpr) (parser.Sexpr, error) {
+	var frames []frame
+	defer func() { m.ev.Leave(len(frames)) }()
+
+	pop := func() parser.Sexpr {
+		value := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		return value
+	}
+
+	for {
+		in := f.code.Instructions[f.pc]
+		f.pc++
+
+		switch arg := in.Arg(); in.Op() {
+		case compile.CONST:
+			stack = append(stack, f.code.Consts[arg])
+		case compile.UNSPECIFIED:
+			stack = append(stack, eval.Unspecified)
+		case compile.REF:
+			b, err := f.global(arg)
+			if err != nil {
+				return nil, err
+			}
+			stack = append(stack, b.Value())
+		case compile.SET:
+			b, err := f.global(arg)
+			if err != nil {
+				return nil, err
+			}
+			b.Set(pop())
+		case compile.DEFINE:
+			f.env.Define(f.code.Names[arg], pop())
+		case compile.LOCAL:
+			value := stack[f.base+arg]
+			if b, ok := value.(*box); ok {
+				value = b.Value()
+			}
+			if value == unassigned {
+				return nil, fmt.Errorf("%w: %s", eval.UNASSIGNED, f.code.Locals[arg].Name)
+			}
+			stack = append(stack, value)
+		case compile.SET_LOCAL:
+			value := pop()
+			if b, ok := stack[f.base+arg].(*box); ok {
+				b.Set(value)
+			} else {
+				stack[f.base+arg] = value
+			}
+		case compile.BIND, compile.DECLARE:
+			value := unassigned
+			if in.Op() == compile.BIND {
+				value = pop()
+			}
+			if f.code.Locals[arg].Boxed {
+				value = newBox(value)
+			}
+			stack[f.base+arg] = value
+		case compile.FREE:
+			value := f.free[arg]
+			if b, ok := value.(*box); ok {
+				value = b.Value()
+			}
+			if value == unassigned {
+				return nil, fmt.Errorf("%w: %s", eval.UNASSIGNED, f.code.Free[arg].Name)
+			}
+			stack = append(stack, value)
+		case compile.SET_FREE:
+			b, ok := f.free[arg].(*box)
+			if !ok {
+				return nil, fmt.Errorf("assignment of unboxed variable %s", f.code.Free[arg].Name)
+			}
+			b.Set(pop())
+		case compile.POP:
+			stack = stack[:len(stack)-1]
+		case compile.DUP:
+			stack = append(stack, stack[len(stack)-1])
+		case compile.SWAP:
+			n := len(stack)
+			stack[n-2], stack[n-1] = stack[n-1], stack[n-2]
+		case compile.JUMP:
+			if err := m.ev.Step(); err != nil {
+				return nil, err
+			}
+			f.pc = arg
+		case compile.JUMP_FALSE:
+			if !eval.IsTrue(pop()) {
+				f.pc = arg
+			}
+		case compile.JUMP_TRUE_OR_POP:
+			if eval.IsTrue(stack[len(stack)-1]) {
+				f.pc = arg
+			} else {
+				stack = stack[:len(stack)-1]
+			}
+		case compile.JUMP_FALSE_OR_POP:
+			if !eval.IsTrue(stack[len(stack)-1]) {
+				f.pc = arg
+			} else {
+				stack = stack[:len(stack)-1]
+			}
+		case compile.CLOSURE:
+			code := f.code.Procedures[arg]
+			free := make([]parser.Sexpr, len(code.Free))
+			for i, capture := range code.Free {
+				if capture.Local {
+					free[i] = stack[f.base+capture.Index]
+				} else {
+					free[i] = f.free[capture.Index]
+				}
+			}
+			stack = append(stack, &Closure{Name: code.Name, Code: code, Free: free, Env: f.env})
+		case compile.CALL, compile.TAIL_CALL:
+			if err := m.ev.Step(); err != nil {
+				return nil, err
+			}
+
+			base := len(stack) - arg - 1
+			proc := stack[base]
+
+			if _, ok := proc.(*eval.Builtin); ok {
+				applied, args, err := eval.Applied(proc, stack[base+1:])
+				if err != nil {
+					return nil, err
+				}
+				if applied != proc {
+					proc, arg = applied, len(args)
+					stack = append(append(stack[:base], proc), args...)
+				}
+			}
+
+			closure, ok := proc.(*Closure)
+			if !ok {
+				value, err := m.ev.Apply(proc, slices.Clone(stack[base+1:]))
+				if err != nil {
+					return nil, err
+				}
+				stack = append(stack[:base], value)
+				continue
+			}
+
+			if in.Op() == compile.TAIL_CALL {
+				base = f.base
+			} else {
+				frames = append(frames, f)
+				if err := m.ev.Enter(); err != nil {
+					return nil, err
+				}
+			}
+
+			var err error
+			if stack, err = closure.enter(m.ev, stack, base, arg); err != nil {
+				return nil, err
+			}
+			f = closure.frame(base)
+		case compile.RETURN:
+			value := stack[len(stack)-1]
+			if len(frames) == 0 {
+				return value, nil
+			}
+
+			stack = append(stack[:f.base], value)
+			f, frames = frames[len(frames)-1], frames[:len(frames)-1]
+			m.ev.Leave(1)
+		case compile.MEMV:
+			key := stack[len(stack)-1]
+			found := false
+			for s := f.code.Consts[arg]; !found && !isNull(s); s = s.(*parser.Expr).Cdr {
+				found = parser.Eqv(key, s.(*parser.Expr).Car)
+			}
+			stack = append(stack, parser.Bool(found))
+		case compile.CONS:
+			if err := m.ev.Allocate(1); err != nil {
+				return nil, err
+			}
+			cdr := pop()
+			stack[len(stack)-1] = parser.Cons(stack[len(stack)-1], cdr)
+		case compile.APPEND:
+			tail := pop()
+			items, err := parser.ToSlice(stack[len(stack)-1])
+			if err != nil {
+				return nil, fmt.Errorf("%w: unquote-splicing of %v", eval.WRONG_TYPE, stack[len(stack)-1])
+			}
+			if err := m.ev.Allocate(len(items)); err != nil {
+				return nil, err
+			}
+			for i := len(items) - 1; i >= 0; i-- {
+				tail = parser.Cons(items[i], tail)
+			}
+			stack[len(stack)-1] = tail
+		case compile.LIST_VECTOR:
+			elements, err := parser.ToSlice(stack[len(stack)-1])
+			if err != nil {
+				return nil, err
+			}
+			if err := m.ev.Allocate(len(elements)); err != nil {
+				return nil, err
+			}
+			stack[len(stack)-1] = &parser.Vector{Elements: elements}
+		case compile.PROMISE:
+			stack[len(stack)-1] = eval.NewPromise(stack[len(stack)-1], arg == 1)
+		case compile.GUARD:
+			value, raised, err := m.ev.Catch(pop())
+			if err != nil {
+				return nil, err
+			}
+			if raised == nil {
+				stack = append(stack, value)
+				f.pc = arg
+			} else {
+				stack = append(stack, parser.Bool(raised.Continuable), raised.Payload)
+			}
+		case compile.RAISE:
+			payload := pop()
+			value, err := m.ev.Raise(payload, eval.IsTrue(pop()))
+			if err != nil {
+				return nil, err
+			}
+			stack = append(stack, value)
+		default:
+			return nil, fmt.Errorf("invalid instruction %v", in.Op())
+		}
+	}
+}
+
+// global returns binding of global variable Names[i] of code of frame,
+// cached in Globals of code while it is not stale.
+func (f *frame) global(i int) (*eval.Binding, error) {
+	if i >= len(f.code.Globals) {
+		return f.env.Binding(f.code.Names[i])
+	}
+
+	version := f.env.Version()
+	if cached := f.code.Globals[i].Load(); cached != nil && cached.Env == f.env && cached.Version == version {
+		return cached.Binding, nil
+	}
+
+	b, err := f.env.Binding(f.code.Names[i])
+	if err != nil {
+		return nil, err
+	}
+	f.code.Globals[i].Store(&compile.GlobalBinding{Env: f.env, Version: version, Binding: b})
+
+	return b, nil
+}
+
+func isNull(s parser.Sexpr) bool {
+	e, ok := s.(*parser.Expr)
+	return ok && e.Car == nil && e.Cdr == nil
+}
@@ -0,0 +1,264 @@
+package vm_test
+
+import (
+	"context"
+	"errors"
+	"github.com/vkhonin/scheme/eval"
+	"github.com/vkhonin/scheme/parser"
+	"github.com/vkhonin/scheme/printer"
+	"github.com/vkhonin/scheme/vm"
+	"testing"
+)
+
+func TestMachine_RunProgram(t *testing.T) {
+	testCases := []struct {
+		Input  string
+		Output string
+	}{
+		{"42", "42"},
+		{"'(a . b)", "(a . b)"},
+		{"(+ 1 2 3)", "6"},
+		{"(define x 2) (set! x (* x 10)) x", "20"},
+		{"(define (f x . rest) (list x rest)) (f 1 2 3)", "(1 (2 3))"},
+		{"((lambda args args) 1 2)", "(1 2)"},
+		{"(define (fact n) (if (= n 0) 1 (* n (fact (- n 1))))) (fact 20)", "2432902008176640000"},
+		{"(define (loop i acc) (if (= i 0) acc (loop (- i 1) (+ acc 1)))) (loop 100000 0)", "100000"},
+		{"(define (count n) (if (= n 0) 0 (+ 1 (count (- n 1))))) (count 100000)", "100000"},
+		{"(list (if #t 1 2) (if #f 1 2))", "(1 2)"},
+		{"(list (and) (and 1 2) (and 1 #f 2) (or) (or #f 2) (or #f #f))", "(#t 2 #f #f 2 #f)"},
+		{"(list (when #t 1 2) (unless #f 3))", "(2 3)"},
+		{"(cond ((cdr '(1 2 3)) => cdr) (else 'none))", "(3)"},
+		{"(list (cond (#f 1) (2)) (cond (#f 1) (else 3)))", "(2 3)"},
+		{"(define (sign n) (cond ((< n 0) 'negative) ((> n 0) 'positive) (else 'zero))) (map sign '(-1 0 1))", "(negative zero positive)"},
+		{"(list (case 3 ((1 2) 'low) ((3 4) 'high) (else 'none)) (case 9 ((1) 'one) (else => (lambda (x) (* x 2)))))", "(high 18)"},
+		{"(case 'x ((a) 1) ((x) => list))", "(x)"},
+		{"(let ((x 1) (y 2)) (let ((x y) (y x)) (list x y)))", "(2 1)"},
+		{"(let* ((x 1) (y (+ x 1))) (list x y))", "(1 2)"},
+		{"(letrec ((even? (lambda (n) (if (= n 0) #t (odd? (- n 1))))) (odd? (lambda (n) (if (= n 0) #f (even? (- n 1)))))) (even? 1001))", "#f"},
+		{"(let loop ((i 0) (acc '())) (if (= i 3) acc (loop (+ i 1) (cons i acc))))", "(2 1 0)"},
+		{"(define loop 5) (let loop ((i loop)) (if (> i 0) (loop (- i 1)) i))", "0"},
+		{"(do ((i 0 (+ i 1)) (acc '() (cons i acc))) ((= i 3) acc))", "(2 1 0)"},
+		{"(list (number->string +inf.0i 16) (number->string 1+inf.0i 2))", `("#i+inf.0i" "#i1+inf.0i")`},
+		{"(define ch (make-channel)) (define (f n) (if (= n 0) 'done (f (- n 1)))) (spawn (lambda () (channel-send! ch (f 1000)))) (channel-receive ch)", "done"},
+		{"(define ch (make-channel 1)) (channel-receive (spawn (lambda () (select (list ch 'v (lambda () (channel-receive ch)))))))", "v"},
+		{"(define procs (do ((i 0 (+ i 1)) (ps '() (cons (lambda () i) ps))) ((= i 3) ps))) (map (lambda (p) (p)) procs)", "(2 1 0)"},
+		{"(define (f) (define a 1) (define (g) (* a 2)) (g)) (f)", "2"},
+		{"(define (f) (begin (define a 1) (define b 2)) (+ a b)) (f)", "3"},
+		{"(begin (define z 1) (+ z 1))", "2"},
+		{"(define x 1) `(a ,x ,@(list 2 3) (b ,(+ x 1)) #(,x c) . ,x)", "(a 1 2 3 (b 2) #(1 c) . 1)"},
+		{"`(1 `(2 ,(3 ,(+ 1 3))))", "(1 (quasiquote (2 (unquote (3 4)))))"},
+		{"`(a b)", "(a b)"},
+		{"(define p (delay (begin (set! n (+ n 1)) n))) (define n 0) (force p) (force p)", "1"},
+		{"(define (stream n) (delay-force (if (= n 0) (delay 'done) (stream (- n 1))))) (force (stream 10000))", "done"},
+		{"(guard (e (#t (list 'caught e))) (raise 'oops))", "(caught oops)"},
+		{"(guard (e ((string? e) e) ((symbol? e) (list e))) (raise 'oops))", "(oops)"},
+		{"(guard (e ((error-object? e) (error-object-message e))) (car 1) 2)", `"wrong type argument: pair expected, got 1"`},
+		{"(guard (e ((symbol? e) 'outer)) (guard (e ((string? e) 'inner)) (raise 'oops)))", "outer"},
+		{"(guard (e (#f 1)) 2)", "2"},
+		{"(with-exception-handler (lambda (e) 10) (lambda () (+ 1 (raise-continuable 'c))))", "11"},
+		{"(with-exception-handler (lambda (e) 42) (lambda () (+ 1 (guard (e (#f 0)) (raise-continuable 1)))))", "43"},
+		{"(define (loop n) (apply (lambda (m) (if (= m 0) 'ok (loop (- m 1)))) (list n))) (loop 1000000)", "ok"},
+		{"(apply apply (list list 1 (list 2 3)))", "(1 2 3)"},
+		{"(guard (e (#t (error-object? e))) (with-exception-handler (lambda (e) 42) (lambda () (guard (e ((string? e) 0)) (raise 1)))))", "#t"},
+		{"(call/cc (lambda (k) (+ 1 (k 42))))", "42"},
+		{"(define (find-first p l) (call/cc (lambda (return) (for-each (lambda (x) (if (p x) (return x))) l) #f))) (find-first (lambda (x) (> x 3)) '(1 3 4 5))", "4"},
+		{"(let ((path '())) (dynamic-wind (lambda () (set! path (cons 'in path))) (lambda () 'body) (lambda () (set! path (cons 'out path)))) path)", "(out in)"},
+		{"(map (lambda (x) (* x x)) '(1 2 3))", "(1 4 9)"},
+		{"(apply (lambda (a b) (- a b)) '(10 3))", "7"},
+		{"(define-syntax swap! (syntax-rules () ((_ a b) (let ((tmp a)) (set! a b) (set! b tmp))))) (define p 1) (define q 2) (swap! p q) (list p q)", "(2 1)"},
+		{"(define-syntax my-or (syntax-rules () ((_ a b) (let ((t a)) (if t t b))))) (let ((t 5)) (my-or #f t))", "5"},
+		{"(eval '(* 6 7) (interaction-environment))", "42"},
+		{"(define compose (lambda (f g) (lambda (x) (f (g x))))) ((compose car cdr) '(1 2))", "2"},
+		{"(procedure? (lambda () 1))", "#t"},
+		{"(list (+ 1 (* 2 3)) (if (< 1 2) 'yes 'no) (and 1 (> 2 3)) (or #f (not #f)) (begin 1 2 'a))", "(7 yes #f #t a)"},
+		{"(define (f +) (+ 1 2)) (define (- a) a) (list (f *) (- 1))", "(2 1)"},
+		{"(guard (e ((error-object? e) 'caught)) (/ 1 0))", "caught"},
+		{"(define (counter) (let ((n 0)) (lambda () (set! n (+ n 1)) n))) (define c (counter)) (c) (c) (list (c) ((counter)))", "(3 1)"},
+		{"(define (make) (define n 0) (list (lambda () (set! n (+ n 1)) n) (lambda () n))) (define p (make)) ((car p)) ((car p)) ((car (cdr p)))", "2"},
+		{"(define (f x) (define g (lambda () x)) (set! x (* x 10)) (g)) (f 4)", "40"},
+		{"(define (f . xs) (lambda () xs)) ((f 1 2))", "(1 2)"},
+		{"(define (adder a) (lambda (b) (lambda (c) (+ a b c)))) (((adder 1) 2) 3)", "6"},
+		{"(define procs (do ((i 0 (+ i 1)) (ps '() (cons (lambda () (set! i (* i 10)) i) ps))) ((= i 3) ps))) (map (lambda (p) (p)) procs)", "(20 10 0)"},
+		{"(let ((x 1)) (define (get) x) (let ((x 2)) (list x (get))))", "(2 1)"},
+		{"(define x 'global) (define (f) x) (let ((x 'local)) (f))", "global"},
+		{"(define (f n) (letrec ((g (lambda () n)) (n2 (* n 2))) (list (g) n2))) (f 5)", "(5 10)"},
+		{"(guard (e (#t (let ((f (lambda () e))) (f)))) (raise 'oops))", "oops"},
+		{"(define (f) 1) (define (loop i acc) (if (= i 0) acc (begin (if (= i 2) (set! f (lambda () 10))) (loop (- i 1) (+ acc (f)))))) (loop 4 0)", "22"},
+		{"(define (g) (car '(1 2))) (define a (g)) (define (car p) 'redefined) (list a (g))", "(1 redefined)"},
+		{"(define (h) (+ 1 2)) (define a (h)) (set! + *) (list a (h))", "(3 2)"},
+	}
+
+	for _, c := range testCases {
+		program, err := parser.ParseString(c.Input)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		m := vm.New(&eval.Evaluator{})
+		m.Options.NoOptimize = true
+		unoptimized, err := m.RunProgram(program, eval.NewStandardEnvironment())
+		if err != nil {
+			t.Errorf("unexpected error %v without optimization for %s", err, c.Input)
+			continue
+		}
+
+		result, err := vm.New(&eval.Evaluator{}).RunProgram(program, eval.NewStandardEnvironment())
+		if err != nil {
+			t.Errorf("unexpected error %v for %s", err, c.Input)
+			continue
+		}
+
+		if !parser.Equal(result, unoptimized) {
+			t.Errorf("expected %v as without optimization got %v for %s", unoptimized, result, c.Input)
+		}
+
+		expected, err := parser.ParseString(c.Output)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !parser.Equal(result, expected[0]) {
+			t.Errorf("expected %v got %v for %s", expected[0], result, c.Input)
+		}
+
+		evaluated, err := (&eval.Evaluator{}).RunProgram(program, eval.NewStandardEnvironment())
+		if err != nil || !parser.Equal(result, evaluated) {
+			t.Errorf("expected value of evaluator %v got %v for %s", evaluated, result, c.Input)
+		}
+	}
+}
+
+func TestMachine_RunProgram_Errors(t *testing.T) {
+	testCases := []struct {
+		Input string
+		Err   error
+	}{
+		{"undefined-variable", eval.UNBOUND_VARIABLE},
+		{"(set! undefined-variable 1)", eval.UNBOUND_VARIABLE},
+		{"(1 2)", eval.NOT_A_PROCEDURE},
+		{"((lambda (x) x))", eval.WRONG_ARITY},
+		{"(car 1 2)", eval.WRONG_ARITY},
+		{"(car 1)", eval.WRONG_TYPE},
+		{"(letrec ((a b) (b 1)) a)", eval.UNASSIGNED},
+		{"(define (f) (g) (define (g) 1)) (f)", eval.UNASSIGNED},
+		{"(define (f) (let loop ((i 0)) (if (= i 1) x (loop (+ i 1)))) (define x 1)) (f)", eval.UNASSIGNED},
+		{"(define (f) (when #t (define x 1)) x)", eval.BAD_SYNTAX},
+		{"(let () (if #t (define x 1)))", eval.BAD_SYNTAX},
+		{"(raise 'oops)", nil},
+		{"(guard (e ((string? e) e)) (raise 'oops))", nil},
+		{"`(,@1)", eval.WRONG_TYPE},
+		{"()", eval.BAD_SYNTAX},
+		{"(if)", eval.BAD_SYNTAX},
+		{"(lambda (x x) x)", eval.BAD_SYNTAX},
+		{"(if #f (quote))", eval.BAD_SYNTAX},
+		{"(cond (else 1) (#t 2))", eval.BAD_SYNTAX},
+		{"(let ((x 1) (x 2)) x)", eval.BAD_SYNTAX},
+		{"`,@x", eval.BAD_SYNTAX},
+		{"(f . x)", eval.BAD_SYNTAX},
+	}
+
+	for _, c := range testCases {
+		program, err := parser.ParseString(c.Input)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = vm.New(&eval.Evaluator{}).RunProgram(program, eval.NewStandardEnvironment())
+
+		var condition *eval.Condition
+		if c.Err == nil && !errors.As(err, &condition) {
+			t.Errorf("expected raised condition got %v for %s", err, c.Input)
+		}
+		if c.Err != nil && !errors.Is(err, c.Err) {
+			t.Errorf("expected error %v got %v for %s", c.Err, err, c.Input)
+		}
+	}
+}
+
+func TestMachine_Interoperation(t *testing.T) {
+	env := eval.NewStandardEnvironment()
+	ev := &eval.Evaluator{}
+
+	program, err := parser.ParseString("(define (twice f x) (f (f x))) (define (inc x) (+ x 1))")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := vm.New(ev).RunProgram(program, env); err != nil {
+		t.Fatal(err)
+	}
+
+	program, err = parser.ParseString("(list (twice inc 1) (twice (lambda (x) (* x 3)) 1) inc)")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := ev.RunProgram(program, env)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if printer.Write(result) != "(3 9 #<procedure inc>)" {
+		t.Errorf("expected closures of machine called by evaluator, got %v", printer.Write(result))
+	}
+}
+
+func TestMachine_GlobalCache(t *testing.T) {
+	parent := eval.NewStandardEnvironment()
+	env := eval.NewEnvironment(parent)
+	ev := &eval.Evaluator{}
+
+	program, err := parser.ParseString("(define (f) (car '(1 2))) (f)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := vm.New(ev).RunProgram(program, env); err != nil {
+		t.Fatal(err)
+	}
+
+	call, err := parser.ParseString("(f)")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	env.Define("car", &eval.Builtin{Name: "car", MinArgs: 1, MaxArgs: 1, Fn: func(*eval.Evaluator, []parser.Sexpr) (parser.Sexpr, error) {
+		return parser.Symbol("shadowed"), nil
+	}})
+
+	result, err := ev.RunProgram(call, env)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if printer.Write(result) != "shadowed" {
+		t.Errorf("expected cached binding of parent environment replaced by definition, got %v", printer.Write(result))
+	}
+}
+
+func TestMachine_Context(t *testing.T) {
+	testCases := []string{
+		"(let loop () (loop))",
+		"(define (f) (f)) (f)",
+		"(do () (#f))",
+		"(guard (e (#t 'caught)) (do () (#f)))",
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	for _, c := range testCases {
+		program, err := parser.ParseString(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ev := &eval.Evaluator{}
+		ev.SetContext(ctx)
+
+		_, err = vm.New(ev).RunProgram(program, eval.NewStandardEnvironment())
+
+		var interrupted *eval.Interrupted
+		if !errors.As(err, &interrupted) || !errors.Is(err, context.Canceled) {
+			t.Errorf("expected interruption got %v for %s", err, c)
+		}
+	}
+}